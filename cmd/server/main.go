@@ -1,20 +1,38 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/kengru/odin-wallet/internal/config"
 	"github.com/kengru/odin-wallet/internal/handlers"
 	appMiddleware "github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/server"
 	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/internal/services/nlparse"
 	"github.com/kengru/odin-wallet/pkg/database"
+	"github.com/kengru/odin-wallet/pkg/hooks"
+	"github.com/kengru/odin-wallet/pkg/tracing"
 )
 
 func main() {
+	// Load the optional config file (written by `wallet setup`); environment
+	// variables take precedence over its values
+	if err := config.Load(config.Path()); err != nil {
+		log.Fatalf("Failed to load config file: %v", err)
+	}
+
 	// Get configuration from environment
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -26,97 +44,236 @@ func main() {
 		dbPath = "./data/wallet.db"
 	}
 
+	// The default secret is public, so anyone could sign session cookies and
+	// bearer tokens with it. It's only allowed in development.
+	const defaultSessionSecret = "dev-secret-change-in-production"
 	sessionSecret := os.Getenv("SESSION_SECRET")
-	if sessionSecret == "" {
-		sessionSecret = "dev-secret-change-in-production"
+	if sessionSecret == "" || sessionSecret == defaultSessionSecret {
+		if os.Getenv("WALLET_ENV") != "development" {
+			log.Fatal("SESSION_SECRET must be set to a private value (or WALLET_ENV=development to use the insecure default)")
+		}
+		log.Println("WARNING: using the default SESSION_SECRET; sessions and bearer tokens can be forged")
+		sessionSecret = defaultSessionSecret
+	}
+
+	schemaCheck, err := database.ParseSchemaCheckMode(os.Getenv("DB_SCHEMA_CHECK"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	passwordParams, err := services.ParsePasswordParams(
+		os.Getenv("ARGON2_MEMORY_KIB"), os.Getenv("ARGON2_ITERATIONS"), os.Getenv("ARGON2_PARALLELISM"),
+	)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	services.SetPasswordParams(passwordParams)
+
+	fieldCipher, err := services.FieldCipherFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	services.SetFieldCipher(fieldCipher)
+
+	dbTuning, err := database.TuningFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	replicationMode, err := database.ParseReplicationMode(os.Getenv("DB_REPLICATION"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	dbEncryptionKey := os.Getenv("DB_ENCRYPTION_KEY")
+	if err := database.ValidateEncryptionKey(dbEncryptionKey); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	queryTimeout := 30 * time.Second
+	if v := os.Getenv("DB_QUERY_TIMEOUT"); v != "" {
+		queryTimeout, err = time.ParseDuration(v)
+		if err != nil || queryTimeout < 0 {
+			log.Fatalf("Invalid configuration: invalid DB_QUERY_TIMEOUT %q: expected a duration like 30s", v)
+		}
+	}
+
+	// PDF rendering, receipt OCR and sync batches get longer than the rest
+	slowTimeout := 2 * time.Minute
+	if v := os.Getenv("SLOW_REQUEST_TIMEOUT"); v != "" {
+		slowTimeout, err = time.ParseDuration(v)
+		if err != nil || slowTimeout < 0 {
+			log.Fatalf("Invalid configuration: invalid SLOW_REQUEST_TIMEOUT %q: expected a duration like 2m", v)
+		}
+	}
+
+	// Time to finish requests and background work after SIGTERM
+	shutdownTimeout := 30 * time.Second
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		shutdownTimeout, err = time.ParseDuration(v)
+		if err != nil || shutdownTimeout < 0 {
+			log.Fatalf("Invalid configuration: invalid SHUTDOWN_TIMEOUT %q: expected a duration like 30s", v)
+		}
+	}
+
+	sessionCacheTTL := 30 * time.Second
+	if v := os.Getenv("SESSION_CACHE_TTL"); v != "" {
+		sessionCacheTTL, err = time.ParseDuration(v)
+		if err != nil || sessionCacheTTL < 0 {
+			log.Fatalf("Invalid configuration: invalid SESSION_CACHE_TTL %q: expected a duration like 30s", v)
+		}
+	}
+
+	// Sessions go to Redis when several servers share them
+	var sessionStore appMiddleware.SessionStore
+	redisSessions, err := appMiddleware.RedisSessionStoreFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if redisSessions != nil {
+		if err := redisSessions.Ping(context.Background()); err != nil {
+			log.Fatalf("Failed to connect to Redis: %v", err)
+		}
+		sessionStore = redisSessions
+	}
+
+	securityHeaders, err := appMiddleware.SecurityHeadersFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	featureDefaults, err := services.FeatureDefaultsFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	mailer, err := services.MailerFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ocrProvider, err := services.OCRProviderFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	parser, err := nlparse.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	telegramBot, err := services.TelegramFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	registrationMode, err := models.ParseRegistrationMode(os.Getenv("REGISTRATION_MODE"))
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Traces go to an OTLP collector when one is configured
+	tracer, err := tracing.FromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Audit events stream to syslog or a webhook when configured
+	auditSinks, err := services.AuditSinksFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	reminderDays := services.DefaultReminderDays
+	if v := os.Getenv("PAYMENT_REMINDER_DAYS"); v != "" {
+		reminderDays, err = strconv.Atoi(v)
+		if err != nil || reminderDays < 0 {
+			log.Fatalf("Invalid configuration: invalid PAYMENT_REMINDER_DAYS %q: expected a number of days", v)
+		}
 	}
 
 	// Initialize database
-	db, err := database.Init(dbPath)
+	db, err := database.Init(dbPath, database.Options{
+		SchemaCheck:   schemaCheck,
+		Tuning:        dbTuning,
+		EncryptionKey: dbEncryptionKey,
+		Replication:   replicationMode,
+		Trace:         tracer != nil,
+	})
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer db.Close()
+	replication := database.NewReplication(replicationMode, dbPath)
+	if !replication.IsPrimary() {
+		log.Printf("Running as a read replica of %s", replication.Primary())
+	}
+
+	// Encrypt what was written before the key was configured. Replicas get
+	// the primary's writes.
+	if replication.IsPrimary() {
+		if err := services.EncryptExistingFields(context.Background(), db); err != nil {
+			log.Fatalf("Failed to encrypt existing data: %v", err)
+		}
+	}
+
+	// Promote configured administrators
+	var adminEmails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.TrimSpace(strings.ToLower(email))
+		if email == "" {
+			continue
+		}
+		adminEmails = append(adminEmails, email)
+		if !replication.IsPrimary() {
+			continue
+		}
+		if _, err := db.Exec("UPDATE users SET is_admin = 1 WHERE email = ?", email); err != nil {
+			log.Printf("Warning: Failed to promote admin %s: %v", email, err)
+		}
+	}
 
-	// Initialize exchange rate service
-	exchangeService := services.NewExchangeService(db)
-	if err := exchangeService.Init(); err != nil {
+	app, err := server.New(db, server.Config{
+		SessionSecret:    sessionSecret,
+		SessionCacheTTL:  sessionCacheTTL,
+		SessionStore:     sessionStore,
+		RegistrationMode: registrationMode,
+		AdminEmails:      adminEmails,
+		QueryTimeout:     queryTimeout,
+		SlowTimeout:      slowTimeout,
+		ReminderDays:     reminderDays,
+		FeatureDefaults:  featureDefaults,
+		Hooks:            hooks.Default,
+		Mailer:           mailer,
+		Telegram:         telegramBot,
+		OCR:              ocrProvider,
+		Parser:           parser,
+		Replication:      replication,
+		Tracer:           tracer,
+		AuditSinks:       auditSinks,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up server: %v", err)
+	}
+
+	// Initialize exchange rates
+	if err := app.Exchange.Init(context.Background()); err != nil {
 		log.Printf("Warning: Failed to initialize exchange rates: %v", err)
 		// Continue anyway - exchange rates are nice-to-have
 	}
-	// Start daily updater
-	exchangeService.StartDailyUpdater()
 
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, sessionSecret)
-	accountHandler := handlers.NewAccountHandler(db, exchangeService)
-	transactionHandler := handlers.NewTransactionHandler(db, exchangeService)
-	exchangeHandler := handlers.NewExchangeHandler(exchangeService)
-	reportHandler := handlers.NewReportHandler(db, exchangeService)
-	budgetHandler := handlers.NewBudgetHandler(db)
+	app.Start(context.Background())
 
 	// Create router
 	r := chi.NewRouter()
 
 	// Global middleware
 	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(appMiddleware.Recover)
+	r.Use(appMiddleware.Secure(securityHeaders))
 	r.Use(middleware.Compress(5))
 
 	// API routes
-	r.Route("/api", func(r chi.Router) {
-		// Auth routes (public)
-		r.Route("/auth", func(r chi.Router) {
-			r.Post("/register", authHandler.Register)
-			r.Post("/login", authHandler.Login)
-			r.Post("/logout", authHandler.Logout)
-			r.Get("/me", authHandler.Me)
-		})
-
-		// Protected routes
-		r.Group(func(r chi.Router) {
-			r.Use(appMiddleware.Auth(db, sessionSecret))
-
-			// User preferences
-			r.Put("/user/preferences", authHandler.UpdatePreferences)
-			r.Post("/user/complete-onboarding", authHandler.CompleteOnboarding)
-
-			// Account routes
-			r.Route("/accounts", func(r chi.Router) {
-				r.Get("/", accountHandler.List)
-				r.Post("/", accountHandler.Create)
-				r.Get("/{id}", accountHandler.Get)
-				r.Put("/{id}", accountHandler.Update)
-				r.Delete("/{id}", accountHandler.Delete)
-				r.Post("/{id}/adjust-balance", accountHandler.AdjustBalance)
-
-				// Transaction routes nested under accounts
-				r.Get("/{id}/transactions", transactionHandler.ListByAccount)
-				r.Post("/{id}/transactions", transactionHandler.Create)
-			})
-
-			// Overview route
-			r.Get("/overview", accountHandler.Overview)
-
-			// Recent transactions across all accounts
-			r.Get("/transactions/recent", transactionHandler.Recent)
-
-			// Transfers
-			r.Post("/transfers", transactionHandler.Transfer)
-
-			// Exchange rates
-			r.Get("/exchange-rates", exchangeHandler.GetRates)
-			r.Get("/exchange-rates/convert", exchangeHandler.Convert)
-
-			// Reports
-			r.Get("/reports", reportHandler.GetReport)
-
-			// Budgets
-			r.Get("/budgets", budgetHandler.List)
-			r.Post("/budgets", budgetHandler.Set)
-			r.Delete("/budgets/{category}", budgetHandler.Delete)
-		})
-	})
+	r.Mount("/api", app.Routes)
 
 	// Health check
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -136,26 +293,37 @@ func main() {
 		frontendPath = filepath.Join(execDir, "frontend", "dist")
 	}
 
-	// Create file server for SPA
-	r.Get("/*", func(w http.ResponseWriter, req *http.Request) {
-		// Get the absolute path to prevent directory traversal
-		path := filepath.Join(frontendPath, filepath.Clean(req.URL.Path))
+	// Serve the SPA, with long-lived caching for hashed assets
+	r.Method(http.MethodGet, "/*", handlers.NewStaticHandler(frontendPath))
 
-		// Check if file exists
-		info, err := os.Stat(path)
-		if os.IsNotExist(err) || info.IsDir() {
-			// Serve index.html for SPA routing
-			http.ServeFile(w, req, filepath.Join(frontendPath, "index.html"))
-			return
-		}
+	// Shut down safely on SIGINT or SIGTERM, which container runtimes and
+	// `litestream replicate -exec` send: finish the requests in flight and
+	// the background work, run the plugin shutdown hooks, then close the
+	// database so the last writes are in the WAL for Litestream to ship
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// Serve the actual file
-		http.FileServer(http.Dir(frontendPath)).ServeHTTP(w, req)
-	})
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Starting Odin Wallet server on port %s", port)
+		log.Printf("Serving frontend from: %s", frontendPath)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
 
-	log.Printf("Starting Odin Wallet server on port %s", port)
-	log.Printf("Serving frontend from: %s", frontendPath)
-	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	<-ctx.Done()
+	log.Printf("Shutting down, waiting up to %v", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: Requests still running at shutdown: %v", err)
+	}
+	if err := app.Stop(shutdownCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Warning: Failed to close database: %v", err)
 	}
+	log.Printf("Shutdown complete")
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/kengru/odin-wallet/internal/config"
+	"github.com/kengru/odin-wallet/pkg/database"
+)
+
+// runEncryptDB converts the plaintext database at DB_PATH into one
+// encrypted with DB_ENCRYPTION_KEY, keeping the original next to it until
+// the operator has checked the server starts. The server must be stopped.
+func runEncryptDB(out io.Writer) error {
+	if err := config.Load(config.Path()); err != nil {
+		return err
+	}
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "./data/wallet.db"
+	}
+	key := os.Getenv("DB_ENCRYPTION_KEY")
+
+	encryptedPath := dbPath + ".encrypting"
+	backupPath := dbPath + ".plaintext"
+	if _, err := os.Stat(backupPath); err == nil {
+		return fmt.Errorf("%s already exists, remove it first", backupPath)
+	}
+
+	fmt.Fprintf(out, "Encrypting %s...\n", dbPath)
+	if err := database.EncryptFile(dbPath, encryptedPath, key); err != nil {
+		return err
+	}
+
+	// Make sure the copy opens with the key before replacing anything
+	db, err := database.Init(encryptedPath, database.Options{SchemaCheck: database.SchemaCheckStrict, EncryptionKey: key})
+	if err != nil {
+		os.Remove(encryptedPath)
+		return fmt.Errorf("encrypted copy failed verification: %w", err)
+	}
+	db.Close()
+
+	if err := os.Rename(dbPath, backupPath); err != nil {
+		return fmt.Errorf("failed to move the plaintext database aside: %w", err)
+	}
+	// The write-ahead log belongs to the plaintext file; its contents were
+	// part of the export
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+		os.Remove(encryptedPath + suffix)
+	}
+	if err := os.Rename(encryptedPath, dbPath); err != nil {
+		return fmt.Errorf("failed to move the encrypted database into place: %w", err)
+	}
+
+	fmt.Fprintf(out, "Done. The plaintext original is at %s: delete it once the server starts with DB_ENCRYPTION_KEY.\n", backupPath)
+	return nil
+}
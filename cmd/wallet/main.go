@@ -0,0 +1,41 @@
+// Command wallet provides administrative commands for an Odin Wallet instance
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: wallet <command>
+
+Commands:
+  setup       Interactively create the config file, database and first admin user
+  encrypt-db  Encrypt a plaintext database with DB_ENCRYPTION_KEY (needs a
+              build with -tags sqlcipher; stop the server first)
+  help        Show this help
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "setup":
+		err = runSetup(os.Stdin, os.Stdout)
+	case "encrypt-db":
+		err = runEncryptDB(os.Stdout)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
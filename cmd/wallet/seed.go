@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type demoTransaction struct {
+	daysAgo     int
+	txType      string
+	amount      float64
+	description string
+	category    string
+}
+
+type demoAccount struct {
+	name         string
+	accountType  string
+	color        string
+	currency     string
+	creditLimit  sql.NullFloat64
+	closingDate  sql.NullInt64
+	interestRate sql.NullFloat64
+	transactions []demoTransaction
+}
+
+// seedDemoData creates a few accounts with two months of history so a new
+// instance has something to explore
+func seedDemoData(db *sql.DB, userID int64) error {
+	accounts := []demoAccount{
+		{
+			name: "Everyday Checking", accountType: "debit", color: "#DDE61F", currency: "DOP",
+			transactions: []demoTransaction{
+				{60, "deposit", 45000, "Opening balance", "opening_balance"},
+				{58, "deposit", 65000, "Salary", "income"},
+				{55, "withdrawal", 18000, "Rent", "rent"},
+				{50, "withdrawal", 4200, "Supermercado Nacional", "groceries"},
+				{44, "withdrawal", 2300, "Electricity bill", "utilities"},
+				{40, "withdrawal", 1500, "Dinner out", "dining"},
+				{28, "deposit", 65000, "Salary", "income"},
+				{25, "withdrawal", 18000, "Rent", "rent"},
+				{20, "withdrawal", 3900, "Supermercado Nacional", "groceries"},
+				{14, "withdrawal", 2100, "Electricity bill", "utilities"},
+				{9, "withdrawal", 850, "Uber rides", "transport"},
+				{3, "withdrawal", 1200, "Gym membership", "fitness"},
+			},
+		},
+		{
+			name: "Visa Gold", accountType: "credit_card", color: "#1F8BE6", currency: "USD",
+			creditLimit: sql.NullFloat64{Float64: 2500, Valid: true},
+			closingDate: sql.NullInt64{Int64: 15, Valid: true},
+			transactions: []demoTransaction{
+				{47, "expense", 15.99, "Streaming subscription", "subscriptions"},
+				{33, "expense", 120, "New shoes", "shopping"},
+				{30, "payment", 135.99, "Card payment", "transfer"},
+				{17, "expense", 15.99, "Streaming subscription", "subscriptions"},
+				{6, "expense", 64.5, "Concert tickets", "entertainment"},
+			},
+		},
+		{
+			name: "Emergency Fund", accountType: "saving", color: "#2FBF71", currency: "DOP",
+			interestRate: sql.NullFloat64{Float64: 4.5, Valid: true},
+			transactions: []demoTransaction{
+				{60, "deposit", 150000, "Opening balance", "opening_balance"},
+				{57, "deposit", 10000, "Monthly savings", "transfer"},
+				{27, "deposit", 10000, "Monthly savings", "transfer"},
+			},
+		},
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, a := range accounts {
+		var balance float64
+		var creditOwed sql.NullFloat64
+		if a.accountType == "credit_card" {
+			creditOwed = sql.NullFloat64{Float64: 0, Valid: true}
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO accounts (user_id, name, type, color, currency, current_balance,
+				credit_limit, credit_owed, closing_date, yearly_interest_rate, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, a.name, a.accountType, a.color, a.currency, balance,
+			a.creditLimit, creditOwed, a.closingDate, a.interestRate, now.AddDate(0, 0, -60), now)
+		if err != nil {
+			return fmt.Errorf("failed to create demo account: %w", err)
+		}
+		accountID, _ := result.LastInsertId()
+
+		for _, t := range a.transactions {
+			switch t.txType {
+			case "deposit", "payment":
+				if a.accountType == "credit_card" {
+					creditOwed.Float64 -= t.amount
+				} else {
+					balance += t.amount
+				}
+			default:
+				if a.accountType == "credit_card" {
+					creditOwed.Float64 += t.amount
+				} else {
+					balance -= t.amount
+				}
+			}
+
+			balanceAfter := balance
+			if a.accountType == "credit_card" {
+				balanceAfter = creditOwed.Float64
+			}
+
+			_, err := tx.Exec(`
+				INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, accountID, t.txType, t.amount, t.description, t.category, balanceAfter, now.AddDate(0, 0, -t.daysAgo))
+			if err != nil {
+				return fmt.Errorf("failed to create demo transaction: %w", err)
+			}
+		}
+
+		_, err = tx.Exec("UPDATE accounts SET current_balance = ?, credit_owed = ? WHERE id = ?", balance, creditOwed, accountID)
+		if err != nil {
+			return fmt.Errorf("failed to update demo account balance: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit demo data: %w", err)
+	}
+	return nil
+}
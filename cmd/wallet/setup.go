@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/kengru/odin-wallet/internal/config"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/database"
+	"golang.org/x/term"
+)
+
+// prompter reads answers from the terminal, hiding password input when
+// stdin is a TTY
+type prompter struct {
+	in     *os.File
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(question+" ("+hint+")", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func (p *prompter) password(question string) (string, error) {
+	fd := int(p.in.Fd())
+	if !term.IsTerminal(fd) {
+		return p.ask(question, "")
+	}
+	fmt.Fprintf(p.out, "%s: ", question)
+	pw, err := term.ReadPassword(fd)
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(pw), nil
+}
+
+func runSetup(in *os.File, out io.Writer) error {
+	p := &prompter{in: in, reader: bufio.NewReader(in), out: out}
+
+	fmt.Fprintln(out, "Odin Wallet setup")
+	fmt.Fprintln(out, "=================")
+	fmt.Fprintln(out)
+
+	configPath, err := p.ask("Config file", config.Path())
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		overwrite, err := p.confirm(configPath+" already exists. Overwrite it?", false)
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			return fmt.Errorf("setup cancelled, existing config left untouched")
+		}
+	}
+
+	port, err := p.ask("Port", "7009")
+	if err != nil {
+		return err
+	}
+	dbPath, err := p.ask("Database path", "./data/wallet.db")
+	if err != nil {
+		return err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate session secret: %w", err)
+	}
+	sessionSecret := hex.EncodeToString(secret)
+	fmt.Fprintln(out, "Generated a new session secret.")
+
+	fmt.Fprintf(out, "Initializing database at %s...\n", dbPath)
+	db, err := database.Init(dbPath, database.Options{
+		SchemaCheck:   database.SchemaCheckStrict,
+		EncryptionKey: os.Getenv("DB_ENCRYPTION_KEY"),
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "Create the first admin user")
+	email, err := p.ask("Admin email", "")
+	if err != nil {
+		return err
+	}
+	email = strings.TrimSpace(strings.ToLower(email))
+	if email == "" || !strings.Contains(email, "@") {
+		return fmt.Errorf("invalid email address")
+	}
+
+	userID, err := createAdmin(p, db, email)
+	if err != nil {
+		return err
+	}
+
+	seed, err := p.confirm("Seed demo accounts and transactions for this user?", false)
+	if err != nil {
+		return err
+	}
+	if seed {
+		if err := seedDemoData(db, userID); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Demo data created.")
+	}
+
+	err = config.Write(configPath, []config.Setting{
+		{Key: "PORT", Value: port, Comment: "HTTP port"},
+		{Key: "DB_PATH", Value: dbPath, Comment: "SQLite database file"},
+		{Key: "SESSION_SECRET", Value: sessionSecret, Comment: "Secret for session cookies, keep private"},
+		{Key: "ADMIN_EMAILS", Value: email, Comment: "Comma-separated instance administrators"},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Wrote %s\n", configPath)
+	if configPath != config.DefaultPath {
+		fmt.Fprintf(out, "Start the server with: WALLET_CONFIG=%s ./server\n", configPath)
+	} else {
+		fmt.Fprintln(out, "Start the server with: ./server")
+	}
+	return nil
+}
+
+// createAdmin creates the admin user, or promotes it if the email is already
+// registered
+func createAdmin(p *prompter, db *sql.DB, email string) (int64, error) {
+	var userID int64
+	err := db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
+	if err == nil {
+		if _, err := db.Exec("UPDATE users SET is_admin = 1 WHERE id = ?", userID); err != nil {
+			return 0, fmt.Errorf("failed to promote user: %w", err)
+		}
+		fmt.Fprintf(p.out, "%s already exists and is now an admin.\n", email)
+		return userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	password, err := p.password("Admin password (min 8 characters)")
+	if err != nil {
+		return 0, err
+	}
+	if len(password) < 8 {
+		return 0, fmt.Errorf("password must be at least 8 characters")
+	}
+	confirmation, err := p.password("Confirm password")
+	if err != nil {
+		return 0, err
+	}
+	if password != confirmation {
+		return 0, fmt.Errorf("passwords do not match")
+	}
+
+	hash, err := services.HashPassword(password)
+	if err != nil {
+		return 0, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO users (email, password_hash, is_admin, onboarding_completed) VALUES (?, ?, 1, 1)",
+		email, hash,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create admin user: %w", err)
+	}
+	userID, _ = result.LastInsertId()
+	fmt.Fprintf(p.out, "Created admin user %s.\n", email)
+	return userID, nil
+}
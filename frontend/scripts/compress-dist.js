@@ -0,0 +1,37 @@
+import { brotliCompressSync, constants, gzipSync } from "zlib";
+import { readdirSync, readFileSync, statSync, writeFileSync } from "fs";
+import { dirname, extname, join } from "path";
+import { fileURLToPath } from "url";
+
+// Writes .br and .gz copies of the built text assets next to them, which the
+// Go server serves to clients that accept those encodings
+
+const __dirname = dirname(fileURLToPath(import.meta.url));
+const distDir = join(__dirname, "..", "dist");
+
+const compressible = new Set([".html", ".js", ".css", ".svg", ".json", ".webmanifest", ".txt"]);
+// Compressing tiny files saves next to nothing
+const minSize = 1024;
+
+function walk(dir) {
+  return readdirSync(dir).flatMap((name) => {
+    const path = join(dir, name);
+    return statSync(path).isDirectory() ? walk(path) : [path];
+  });
+}
+
+let count = 0;
+for (const path of walk(distDir)) {
+  if (!compressible.has(extname(path))) continue;
+  const data = readFileSync(path);
+  if (data.length < minSize) continue;
+
+  writeFileSync(
+    path + ".br",
+    brotliCompressSync(data, { params: { [constants.BROTLI_PARAM_QUALITY]: 11 } })
+  );
+  writeFileSync(path + ".gz", gzipSync(data, { level: 9 }));
+  count++;
+}
+
+console.log(`Compressed ${count} files in dist`);
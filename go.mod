@@ -7,5 +7,9 @@ toolchain go1.24.2
 require (
 	github.com/go-chi/chi/v5 v5.2.3
 	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/mutecomm/go-sqlcipher/v4 v4.4.2
 	golang.org/x/crypto v0.46.0
+	golang.org/x/term v0.38.0
 )
+
+require golang.org/x/sys v0.39.0 // indirect
@@ -0,0 +1,118 @@
+// Package config loads server settings from an optional KEY=VALUE file so a
+// deployment does not have to be configured purely through the environment.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPath is used when WALLET_CONFIG is not set
+const DefaultPath = "./wallet.conf"
+
+// Path returns the config file location
+func Path() string {
+	if path := os.Getenv("WALLET_CONFIG"); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
+// Load reads the config file and exports its values as environment
+// variables. Variables already set in the environment take precedence. A
+// missing file is not an error.
+func Load(path string) error {
+	values, err := Read(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Read parses a config file. Blank lines and lines starting with # are
+// ignored; values may be wrapped in double quotes.
+func Read(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNum)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return values, nil
+}
+
+// Setting is a single KEY=VALUE entry with an optional comment
+type Setting struct {
+	Key     string
+	Value   string
+	Comment string
+}
+
+// Write saves settings to path, readable only by the owner since the file
+// holds secrets
+func Write(path string, settings []Setting) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# Odin Wallet configuration\n")
+	for _, s := range settings {
+		b.WriteString("\n")
+		if s.Comment != "" {
+			b.WriteString("# " + s.Comment + "\n")
+		}
+		value := s.Value
+		if strings.ContainsAny(value, " #\t") {
+			value = `"` + value + `"`
+		}
+		b.WriteString(s.Key + "=" + value + "\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// Convert changes an account's type, such as a debit account that became a
+// savings account or a card balance turned into a loan. The balance and the
+// transaction history carry over; fields the old type had and the new one
+// doesn't are cleared.
+func (h *AccountHandler) Convert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ConvertAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// The balance moves to another column for some conversions
+	unlock := h.locker.Lock(account.ID)
+	defer unlock()
+	account, err := h.getAccountByID(ctx, account.ID, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+
+	if !slices.Contains(accountTypes, req.Type) {
+		jsonError(w, "Invalid account type", http.StatusBadRequest)
+		return
+	}
+	if req.Type == account.Type {
+		jsonError(w, "Account is already of this type", http.StatusBadRequest)
+		return
+	}
+	if !account.CanConvertTo(req.Type) {
+		jsonError(w, fmt.Sprintf("A %s account can't be converted to %s", account.Type, req.Type), http.StatusBadRequest)
+		return
+	}
+	if msg := validateConversion(req); msg != "" {
+		jsonError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if msg, err := h.conversionBlocked(ctx, account, req.Type); err != nil {
+		jsonError(w, "Failed to check the account's history", http.StatusInternalServerError)
+		return
+	} else if msg != "" {
+		jsonError(w, msg, http.StatusConflict)
+		return
+	}
+
+	// Carry the balance and the fields both types share over; the rest of
+	// the old type's fields are cleared
+	var creditLimit, creditOwed, loanInitialAmount, loanCurrentOwed, monthlyPayment, yearlyInterestRate sql.NullFloat64
+	var closingDate, dueDate sql.NullInt64
+	currentBalance := account.CurrentBalance
+	if account.YearlyInterestRate != nil {
+		yearlyInterestRate = sql.NullFloat64{Float64: *account.YearlyInterestRate, Valid: true}
+	}
+	switch req.Type {
+	case models.AccountTypeCash, models.AccountTypeDebit:
+		yearlyInterestRate = sql.NullFloat64{}
+	case models.AccountTypeSaving, models.AccountTypeInvestment:
+		if req.YearlyInterestRate != nil {
+			yearlyInterestRate = sql.NullFloat64{Float64: *req.YearlyInterestRate, Valid: true}
+		}
+	case models.AccountTypeCreditCard:
+		currentBalance = 0
+		creditOwed = sql.NullFloat64{Float64: account.GetDisplayBalance(), Valid: true}
+		creditLimit = nullableFloat(req.CreditLimit)
+		closingDate = nullableDay(req.ClosingDate)
+		dueDate = nullableDay(req.DueDate)
+	case models.AccountTypeLoan:
+		currentBalance = 0
+		loanCurrentOwed = sql.NullFloat64{Float64: account.GetDisplayBalance(), Valid: true}
+		loanInitialAmount = loanCurrentOwed
+		if req.LoanInitialAmount != nil {
+			loanInitialAmount = nullableFloat(req.LoanInitialAmount)
+		}
+		monthlyPayment = nullableFloat(req.MonthlyPayment)
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE accounts SET type = ?, current_balance = ?,
+			credit_limit = ?, credit_owed = ?, closing_date = ?, due_date = ?,
+			loan_initial_amount = ?, loan_current_owed = ?, monthly_payment = ?,
+			yearly_interest_rate = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND user_id = ? AND version = ?
+	`, string(req.Type), currentBalance,
+		creditLimit, creditOwed, closingDate, dueDate,
+		loanInitialAmount, loanCurrentOwed, monthlyPayment,
+		yearlyInterestRate, time.Now(), account.ID, userID, account.Version)
+	if err != nil {
+		jsonError(w, "Failed to convert account", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		balanceConflict(w)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "converted",
+		EntityID: &account.ID,
+		Summary:  fmt.Sprintf("Converted %s from %s to %s", account.Name, account.Type, req.Type),
+		Details:  map[string]interface{}{"from": account.Type, "to": req.Type},
+	})
+
+	converted, err := h.getAccountByID(ctx, account.ID, userID)
+	if err != nil {
+		jsonError(w, "Account converted but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, converted, http.StatusOK)
+}
+
+// validateConversion checks the fields given for the new type, returning
+// what's wrong or ""
+func validateConversion(req models.ConvertAccountRequest) string {
+	card := req.CreditLimit != nil || req.ClosingDate != nil || req.DueDate != nil
+	loan := req.LoanInitialAmount != nil || req.MonthlyPayment != nil
+	switch {
+	case card && req.Type != models.AccountTypeCreditCard:
+		return "Credit limit, closing and due dates only apply to credit cards"
+	case loan && req.Type != models.AccountTypeLoan:
+		return "Initial amount and monthly payment only apply to loans"
+	case req.YearlyInterestRate != nil && (req.Type == models.AccountTypeCash || req.Type == models.AccountTypeDebit):
+		return "Cash and debit accounts don't earn interest"
+	}
+	for _, day := range []*int{req.ClosingDate, req.DueDate} {
+		if day != nil && (*day < 1 || *day > 31) {
+			return "Closing and due dates must be days of the month (1-31)"
+		}
+	}
+	for _, amount := range []*float64{req.CreditLimit, req.LoanInitialAmount, req.MonthlyPayment, req.YearlyInterestRate} {
+		if amount != nil && *amount < 0 {
+			return "Amounts and rates cannot be negative"
+		}
+	}
+	return ""
+}
+
+// conversionBlocked returns why the account's history or links keep it from
+// becoming the new type, or "" when nothing does
+func (h *AccountHandler) conversionBlocked(ctx context.Context, account *models.Account, to models.AccountType) (string, error) {
+	rows, err := h.db.QueryContext(ctx, "SELECT DISTINCT type FROM transactions WHERE account_id = ?", account.ID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	allowed := models.LedgerTransactionTypes(to)
+	for rows.Next() {
+		var txType models.TransactionType
+		if err := rows.Scan(&txType); err != nil {
+			return "", err
+		}
+		if !slices.Contains(allowed, txType) {
+			return fmt.Sprintf("The account has %s transactions, which a %s account can't hold", txType, to), nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	// Bills can't be paid from a loan
+	if to == models.AccountTypeLoan {
+		var bills int
+		if err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM bills WHERE account_id = ?", account.ID).Scan(&bills); err != nil {
+			return "", err
+		}
+		if bills > 0 {
+			return fmt.Sprintf("%d bills are paid from the account; move them to another account first", bills), nil
+		}
+	}
+	return "", nil
+}
+
+func nullableFloat(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+func nullableDay(day *int) sql.NullInt64 {
+	if day == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*day), Valid: true}
+}
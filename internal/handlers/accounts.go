@@ -1,71 +1,106 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/kengru/odin-wallet/internal/middleware"
 	"github.com/kengru/odin-wallet/internal/models"
 	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/database"
 )
 
 type AccountHandler struct {
 	db              *sql.DB
 	exchangeService *services.ExchangeService
+	locker          *services.AccountLocker
+	alerts          *services.BalanceAlertService
+	audit           *services.AuditService
+	stmts           *database.Statements
 }
 
-func NewAccountHandler(db *sql.DB, exchangeService *services.ExchangeService) *AccountHandler {
-	return &AccountHandler{db: db, exchangeService: exchangeService}
+func NewAccountHandler(db *sql.DB, stmts *database.Statements, exchangeService *services.ExchangeService, locker *services.AccountLocker, alertService *services.BalanceAlertService, audit *services.AuditService) *AccountHandler {
+	return &AccountHandler{db: db, exchangeService: exchangeService, locker: locker, alerts: alertService, audit: audit, stmts: stmts}
 }
 
 func (h *AccountHandler) List(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
 	}
 
-	rows, err := h.db.Query(`
-		SELECT id, user_id, name, type, color, currency, current_balance,
-			   credit_limit, credit_owed, closing_date,
-			   loan_initial_amount, loan_current_owed, monthly_payment,
-			   yearly_interest_rate, created_at, updated_at
+	s, err := newSerializer(r, accountExpansions...)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Before the query, which holds a connection until its rows are read
+	locale := services.UserLocale(ctx, h.db, userID)
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+accountColumns+`
 		FROM accounts
-		WHERE user_id = ?
+		WHERE user_id = ? AND profile_id = ?
 		ORDER BY created_at DESC
-	`, userID)
+	`, userID, middleware.GetProfileID(ctx))
 	if err != nil {
 		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
+	advisor := middleware.GetAdvisorAccess(ctx)
 	accounts := []models.Account{}
 	for rows.Next() {
-		var a models.AccountDB
-		err := rows.Scan(
-			&a.ID, &a.UserID, &a.Name, &a.Type, &a.Color, &a.Currency, &a.CurrentBalance,
-			&a.CreditLimit, &a.CreditOwed, &a.ClosingDate,
-			&a.LoanInitialAmount, &a.LoanCurrentOwed, &a.MonthlyPayment,
-			&a.YearlyInterestRate, &a.CreatedAt, &a.UpdatedAt,
-		)
+		account, err := scanAccount(rows)
 		if err != nil {
 			jsonError(w, "Failed to scan account", http.StatusInternalServerError)
 			return
 		}
-		accounts = append(accounts, *a.ToAccount())
+		if advisor != nil && !advisor.CanViewAccount(account.ID) {
+			continue
+		}
+		account.FormattedBalance = services.FormatMoney(account.GetDisplayBalance(), account.Currency, locale)
+		accounts = append(accounts, *account)
 	}
+	rows.Close()
 
-	jsonResponse(w, accounts, http.StatusOK)
+	response := make([]map[string]interface{}, 0, len(accounts))
+	for i := range accounts {
+		obj, err := h.serializeAccount(ctx, s, &accounts[i])
+		if err != nil {
+			jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+			return
+		}
+		response = append(response, obj)
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// accountTypes are the types an account can have
+var accountTypes = []models.AccountType{
+	models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeCreditCard,
+	models.AccountTypeLoan, models.AccountTypeSaving, models.AccountTypeInvestment,
+	models.AccountTypeAsset,
 }
 
 func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -84,22 +119,17 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate account type
-	validTypes := []models.AccountType{
-		models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeCreditCard,
-		models.AccountTypeLoan, models.AccountTypeSaving, models.AccountTypeInvestment,
-	}
-	validType := false
-	for _, t := range validTypes {
-		if t == req.Type {
-			validType = true
-			break
-		}
-	}
-	if !validType {
+	if !slices.Contains(accountTypes, req.Type) {
 		jsonError(w, "Invalid account type", http.StatusBadRequest)
 		return
 	}
 
+	req.Institution = strings.TrimSpace(req.Institution)
+	if err := models.ValidateAccountDisplay(req.Icon, req.Institution, req.Last4); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Set defaults
 	if req.Color == "" {
 		req.Color = "#DDE61F"
@@ -111,10 +141,10 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 	// Prepare values based on account type
 	var currentBalance float64
 	var creditLimit, creditOwed, loanInitialAmount, loanCurrentOwed, monthlyPayment, yearlyInterestRate sql.NullFloat64
-	var closingDate sql.NullInt64
+	var closingDate, dueDate sql.NullInt64
 
 	switch req.Type {
-	case models.AccountTypeCash, models.AccountTypeDebit:
+	case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeAsset:
 		if req.InitialBalance != nil {
 			currentBalance = *req.InitialBalance
 		}
@@ -129,6 +159,16 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 		if req.ClosingDate != nil {
 			closingDate = sql.NullInt64{Int64: int64(*req.ClosingDate), Valid: true}
 		}
+		if req.YearlyInterestRate != nil {
+			yearlyInterestRate = sql.NullFloat64{Float64: *req.YearlyInterestRate, Valid: true}
+		}
+		if req.DueDate != nil {
+			if *req.DueDate < 1 || *req.DueDate > 31 {
+				jsonError(w, "Due date must be a day of the month (1-31)", http.StatusBadRequest)
+				return
+			}
+			dueDate = sql.NullInt64{Int64: int64(*req.DueDate), Valid: true}
+		}
 
 	case models.AccountTypeLoan:
 		if req.LoanInitialAmount != nil {
@@ -140,6 +180,9 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 		if req.MonthlyPayment != nil {
 			monthlyPayment = sql.NullFloat64{Float64: *req.MonthlyPayment, Valid: true}
 		}
+		if req.YearlyInterestRate != nil {
+			yearlyInterestRate = sql.NullFloat64{Float64: *req.YearlyInterestRate, Valid: true}
+		}
 
 	case models.AccountTypeSaving, models.AccountTypeInvestment:
 		if req.InitialBalance != nil {
@@ -151,17 +194,24 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	now := time.Now()
-	result, err := h.db.Exec(`
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		INSERT INTO accounts (
 			user_id, name, type, color, currency, current_balance,
-			credit_limit, credit_owed, closing_date,
+			credit_limit, credit_owed, closing_date, due_date,
 			loan_initial_amount, loan_current_owed, monthly_payment,
-			yearly_interest_rate, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			yearly_interest_rate, icon, institution, last4, profile_id, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, userID, req.Name, string(req.Type), req.Color, req.Currency, currentBalance,
-		creditLimit, creditOwed, closingDate,
+		creditLimit, creditOwed, closingDate, dueDate,
 		loanInitialAmount, loanCurrentOwed, monthlyPayment,
-		yearlyInterestRate, now, now)
+		yearlyInterestRate, req.Icon, req.Institution, req.Last4, middleware.GetProfileID(ctx), now, now)
 
 	if err != nil {
 		jsonError(w, "Failed to create account", http.StatusInternalServerError)
@@ -170,8 +220,48 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	accountID, _ := result.LastInsertId()
 
+	// Record the starting balance in the ledger so history explains it
+	openingBalance := currentBalance
+	switch req.Type {
+	case models.AccountTypeCreditCard:
+		openingBalance = creditOwed.Float64
+	case models.AccountTypeLoan:
+		openingBalance = loanCurrentOwed.Float64
+	}
+	if openingBalance != 0 {
+		if err := recordBalanceChange(ctx, tx, userID, accountID, req.Type, openingBalance, openingBalance,
+			"Opening balance", models.CategoryOpeningBalance, now); err != nil {
+			jsonError(w, "Failed to record opening balance", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// An asset's starting value begins its valuation history
+	if req.Type == models.AccountTypeAsset {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO asset_valuations (account_id, value, change, source, note, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, accountID, currentBalance, currentBalance, string(models.ValuationManual), "Initial value", now); err != nil {
+			jsonError(w, "Failed to record initial valuation", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "created",
+		EntityID: &accountID,
+		Summary:  fmt.Sprintf("Created %s account %s", req.Type, req.Name),
+	})
+
 	// Fetch and return the created account
-	account, err := h.getAccountByID(accountID, userID)
+	account, err := h.getAccountByID(ctx, accountID, userID)
 	if err != nil {
 		jsonError(w, "Account created but failed to fetch", http.StatusInternalServerError)
 		return
@@ -181,7 +271,8 @@ func (h *AccountHandler) Create(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -193,7 +284,13 @@ func (h *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	account, err := h.getAccountByID(accountID, userID)
+	s, err := newSerializer(r, accountExpansions...)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.getAccountByID(ctx, accountID, userID)
 	if err == sql.ErrNoRows {
 		jsonError(w, "Account not found", http.StatusNotFound)
 		return
@@ -203,11 +300,105 @@ func (h *AccountHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jsonResponse(w, account, http.StatusOK)
+	response, err := h.serializeAccount(ctx, s, account)
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// BalanceAsOf rebuilds the account's balance at a past date from its
+// transaction history. as_of is a day, YYYY-MM-DD, for its closing balance,
+// or an RFC 3339 instant; it defaults to now.
+func (h *AccountHandler) BalanceAsOf(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	at, asOf := time.Now(), time.Now().Format(time.RFC3339)
+	if v := r.URL.Query().Get("as_of"); v != "" {
+		if day, err := time.ParseInLocation("2006-01-02", v, time.Now().Location()); err == nil {
+			at, asOf = day.AddDate(0, 0, 1), v
+		} else if instant, err := time.Parse(time.RFC3339, v); err == nil {
+			at, asOf = instant, v
+		} else {
+			jsonError(w, "Invalid as_of: use RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	changes, err := services.BalanceChangesSince(ctx, h.db, account.UserID, at)
+	if err != nil {
+		jsonError(w, "Failed to calculate balance", http.StatusInternalServerError)
+		return
+	}
+
+	locale := services.UserLocale(ctx, h.db, account.UserID)
+	jsonResponse(w, accountBalanceAt(account, changes, at, asOf, locale), http.StatusOK)
+}
+
+// accountBalanceAt describes the account's balance just before at, given
+// the changes since then from services.BalanceChangesSince
+func accountBalanceAt(account *models.Account, changes map[int64]float64, at time.Time, asOf, locale string) models.AccountBalance {
+	balance := models.AccountBalance{
+		AccountID: account.ID,
+		Name:      account.Name,
+		Type:      account.Type,
+		Currency:  account.Currency,
+		AsOf:      asOf,
+		Open:      account.CreatedAt.Before(at),
+	}
+	if balance.Open {
+		balance.Balance = services.BalanceBefore(account, changes[account.ID])
+	}
+	balance.FormattedBalance = services.FormatMoney(balance.Balance, account.Currency, locale)
+	return balance
+}
+
+// accountExpansions are the nested resources account endpoints can include
+var accountExpansions = []string{"transactions.recent"}
+
+// recentTransactionsLimit is how many transactions transactions.recent holds
+const recentTransactionsLimit = 5
+
+// serializeAccount applies the request's field selection and expansions to
+// an account
+func (h *AccountHandler) serializeAccount(ctx context.Context, s *serializer, account *models.Account) (map[string]interface{}, error) {
+	expanded := map[string]interface{}{}
+	if s.Expanding("transactions.recent") {
+		rows, err := h.db.QueryContext(ctx, `
+			SELECT `+transactionColumns+`
+			FROM transactions t
+			JOIN accounts a ON t.account_id = a.id
+			WHERE t.account_id = ?
+			ORDER BY t.created_at DESC, t.id DESC
+			LIMIT ?
+		`, account.ID, recentTransactionsLimit)
+		if err != nil {
+			return nil, err
+		}
+		recent := []models.Transaction{}
+		for rows.Next() {
+			t, err := scanTransaction(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			recent = append(recent, *t)
+		}
+		rows.Close()
+		expanded["transactions.recent"] = recent
+	}
+	return s.Object(account, expanded)
 }
 
 func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -219,10 +410,13 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify ownership
-	var exists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = ? AND user_id = ?)", accountID, userID).Scan(&exists)
-	if err != nil || !exists {
+	// Balance fields can be edited directly, so serialize with other writes
+	unlock := h.locker.Lock(accountID)
+	defer unlock()
+
+	// Verify ownership and read the balance a direct edit reconciles from
+	account, err := h.getAccountByID(ctx, accountID, userID)
+	if err != nil {
 		jsonError(w, "Account not found", http.StatusNotFound)
 		return
 	}
@@ -233,6 +427,23 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Fields left out of the request are validated as empty, which always passes
+	var icon, institution, last4 string
+	if req.Icon != nil {
+		icon = *req.Icon
+	}
+	if req.Institution != nil {
+		institution = strings.TrimSpace(*req.Institution)
+		req.Institution = &institution
+	}
+	if req.Last4 != nil {
+		last4 = *req.Last4
+	}
+	if err := models.ValidateAccountDisplay(icon, institution, last4); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Build dynamic update query
 	updates := []string{}
 	args := []interface{}{}
@@ -249,7 +460,23 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		updates = append(updates, "currency = ?")
 		args = append(args, *req.Currency)
 	}
+	if req.Icon != nil {
+		updates = append(updates, "icon = ?")
+		args = append(args, *req.Icon)
+	}
+	if req.Institution != nil {
+		updates = append(updates, "institution = ?")
+		args = append(args, *req.Institution)
+	}
+	if req.Last4 != nil {
+		updates = append(updates, "last4 = ?")
+		args = append(args, *req.Last4)
+	}
 	if req.CurrentBalance != nil {
+		if account.Type == models.AccountTypeAsset {
+			jsonError(w, "Record a valuation to change an asset's value", http.StatusBadRequest)
+			return
+		}
 		updates = append(updates, "current_balance = ?")
 		args = append(args, *req.CurrentBalance)
 	}
@@ -265,6 +492,14 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		updates = append(updates, "closing_date = ?")
 		args = append(args, *req.ClosingDate)
 	}
+	if req.DueDate != nil {
+		if *req.DueDate < 1 || *req.DueDate > 31 {
+			jsonError(w, "Due date must be a day of the month (1-31)", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "due_date = ?")
+		args = append(args, *req.DueDate)
+	}
 	if req.LoanCurrentOwed != nil {
 		updates = append(updates, "loan_current_owed = ?")
 		args = append(args, *req.LoanCurrentOwed)
@@ -283,7 +518,7 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updates = append(updates, "updated_at = ?")
+	updates = append(updates, "updated_at = ?", "version = version + 1")
 	args = append(args, time.Now())
 	args = append(args, accountID, userID)
 
@@ -294,16 +529,75 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 		}
 		query += u
 	}
-	query += " WHERE id = ? AND user_id = ?"
+	query += " WHERE id = ? AND user_id = ? AND version = ?"
 
-	_, err = h.db.Exec(query, args...)
-	if err != nil {
-		jsonError(w, "Failed to update account", http.StatusInternalServerError)
-		return
+	for attempt := 1; ; attempt++ {
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Only apply the edit to the version the reconciliation below was
+		// computed from
+		result, err := tx.ExecContext(ctx, query, append(args, account.Version)...)
+		if err != nil {
+			jsonError(w, "Failed to update account", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			tx.Rollback()
+			if attempt == maxBalanceAttempts {
+				balanceConflict(w)
+				return
+			}
+			if account, err = h.getAccountByID(ctx, accountID, userID); err != nil {
+				jsonError(w, "Account not found", http.StatusNotFound)
+				return
+			}
+			continue
+		}
+
+		// Setting the balance field directly is a reconciliation; record the
+		// difference so the ledger still adds up to the new balance
+		var newBalance *float64
+		switch account.Type {
+		case models.AccountTypeCreditCard:
+			newBalance = req.CreditOwed
+		case models.AccountTypeLoan:
+			newBalance = req.LoanCurrentOwed
+		default:
+			newBalance = req.CurrentBalance
+		}
+		if newBalance != nil && *newBalance != account.GetDisplayBalance() {
+			if err := recordBalanceChange(ctx, tx, userID, accountID, account.Type, *newBalance-account.GetDisplayBalance(), *newBalance,
+				"Balance adjustment", models.CategoryTransfer, time.Now()); err != nil {
+				jsonError(w, "Failed to record balance adjustment", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		break
 	}
 
+	checkBalanceAlerts(ctx, h.alerts, accountID)
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "updated",
+		EntityID: &accountID,
+		Summary:  "Updated account " + account.Name,
+		Details:  map[string]interface{}{"fields": changedFields(req)},
+	})
+
 	// Fetch and return updated account
-	account, err := h.getAccountByID(accountID, userID)
+	account, err = h.getAccountByID(ctx, accountID, userID)
 	if err != nil {
 		jsonError(w, "Account updated but failed to fetch", http.StatusInternalServerError)
 		return
@@ -313,7 +607,8 @@ func (h *AccountHandler) Update(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -325,7 +620,29 @@ func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", accountID, userID)
+	var name string
+	err = h.db.QueryRowContext(ctx, "SELECT name FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?", accountID, userID, middleware.GetProfileID(ctx)).Scan(&name)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	// Deleting the account would delete its transactions in closed periods
+	var first time.Time
+	err = h.db.QueryRowContext(ctx, "SELECT created_at FROM transactions WHERE account_id = ? ORDER BY created_at LIMIT 1", accountID).Scan(&first)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && !checkPeriodOpen(ctx, w, h.db, userID, first) {
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM accounts WHERE id = ? AND user_id = ?", accountID, userID)
 	if err != nil {
 		jsonError(w, "Failed to delete account", http.StatusInternalServerError)
 		return
@@ -337,6 +654,21 @@ func (h *AccountHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Expenses repaid by a deposit in the deleted account are pending again
+	h.db.ExecContext(ctx, `
+		UPDATE transactions SET reimbursement_status = ?
+		WHERE reimbursement_status = ? AND reimbursed_by_id IS NULL
+		  AND account_id IN (SELECT id FROM accounts WHERE user_id = ?)
+	`, string(models.ReimbursementPending), string(models.ReimbursementReimbursed), userID)
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "deleted",
+		EntityID: &accountID,
+		Summary:  "Deleted account " + name,
+	})
+
 	jsonResponse(w, map[string]string{"message": "Account deleted successfully"}, http.StatusOK)
 }
 
@@ -346,7 +678,8 @@ type AdjustBalanceRequest struct {
 }
 
 func (h *AccountHandler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -358,36 +691,6 @@ func (h *AccountHandler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch account to verify ownership and type
-	account, err := h.getAccountByID(accountID, userID)
-	if err == sql.ErrNoRows {
-		jsonError(w, "Account not found", http.StatusNotFound)
-		return
-	}
-	if err != nil {
-		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
-		return
-	}
-
-	// Only allow balance adjustment for asset accounts
-	assetTypes := []models.AccountType{
-		models.AccountTypeCash,
-		models.AccountTypeDebit,
-		models.AccountTypeSaving,
-		models.AccountTypeInvestment,
-	}
-	isAsset := false
-	for _, t := range assetTypes {
-		if t == account.Type {
-			isAsset = true
-			break
-		}
-	}
-	if !isAsset {
-		jsonError(w, "Balance adjustment only allowed for cash, debit, savings, and investment accounts", http.StatusBadRequest)
-		return
-	}
-
 	var req AdjustBalanceRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "Invalid request body", http.StatusBadRequest)
@@ -399,61 +702,151 @@ func (h *AccountHandler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Start transaction
-	tx, err := h.db.Begin()
+	// Hold the account lock until the adjusted balance is written
+	unlock := h.locker.Lock(accountID)
+	defer unlock()
+
+	for attempt := 1; ; attempt++ {
+		// Fetch account to verify ownership and type
+		account, err := h.getAccountByID(ctx, accountID, userID)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
+
+		// Only allow balance adjustment for asset accounts. Property changes
+		// value through valuations instead.
+		if !account.IsAssetAccount() || account.Type == models.AccountTypeAsset {
+			jsonError(w, "Balance adjustment only allowed for cash, debit, savings, and investment accounts", http.StatusBadRequest)
+			return
+		}
+
+		// Start transaction
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Calculate new balance
+		newBalance := account.CurrentBalance + req.Amount
+
+		// Update account balance, unless another write got there first
+		err = setBalance(ctx, tx, accountID, account.Type, newBalance, account.Version)
+		if err == errBalanceConflict {
+			tx.Rollback()
+			if attempt < maxBalanceAttempts {
+				continue
+			}
+			balanceConflict(w)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to update account balance", http.StatusInternalServerError)
+			return
+		}
+
+		// Create description if not provided
+		description := req.Description
+		if description == "" {
+			description = "Balance adjustment"
+		}
+
+		// Insert adjustment transaction
+		if err := recordBalanceChange(ctx, tx, userID, accountID, account.Type, req.Amount, newBalance,
+			description, models.CategoryTransfer, time.Now()); err != nil {
+			jsonError(w, "Failed to create adjustment transaction", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	checkBalanceAlerts(ctx, h.alerts, accountID)
+
+	// Fetch and return updated account
+	updatedAccount, err := h.getAccountByID(ctx, accountID, userID)
 	if err != nil {
-		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		jsonError(w, "Balance adjusted but failed to fetch account", http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback()
 
-	// Calculate new balance
-	newBalance := account.CurrentBalance + req.Amount
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "balance_adjusted",
+		EntityID: &accountID,
+		Summary:  fmt.Sprintf("Adjusted the balance of %s by %.2f %s", updatedAccount.Name, req.Amount, updatedAccount.Currency),
+		Details:  map[string]interface{}{"amount": req.Amount},
+	})
 
-	// Determine transaction type
-	txType := "deposit"
-	if req.Amount < 0 {
-		txType = "withdrawal"
-	}
+	jsonResponse(w, updatedAccount, http.StatusOK)
+}
 
-	// Create description if not provided
-	description := req.Description
-	if description == "" {
-		description = "Balance adjustment"
+// Unfreeze lifts a budget freeze before the end of its period
+func (h *AccountHandler) Unfreeze(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
 	}
 
-	// Insert adjustment transaction
-	_, err = tx.Exec(`
-		INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, accountID, txType, abs(req.Amount), description, "transfer", newBalance, time.Now())
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		jsonError(w, "Failed to create adjustment transaction", http.StatusInternalServerError)
+		jsonError(w, "Invalid account ID", http.StatusBadRequest)
 		return
 	}
 
-	// Update account balance
-	_, err = tx.Exec(`
-		UPDATE accounts SET current_balance = ?, updated_at = ? WHERE id = ?
-	`, newBalance, time.Now(), accountID)
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE accounts SET status = ?, frozen_until = NULL, frozen_reason = NULL, updated_at = ?
+		WHERE id = ? AND user_id = ? AND profile_id = ?
+	`, string(models.AccountStatusActive), time.Now(), accountID, userID, middleware.GetProfileID(ctx))
 	if err != nil {
-		jsonError(w, "Failed to update account balance", http.StatusInternalServerError)
+		jsonError(w, "Failed to unfreeze account", http.StatusInternalServerError)
 		return
 	}
 
-	if err := tx.Commit(); err != nil {
-		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		jsonError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	// Fetch and return updated account
-	updatedAccount, err := h.getAccountByID(accountID, userID)
+	account, err := h.getAccountByID(ctx, accountID, userID)
 	if err != nil {
-		jsonError(w, "Balance adjusted but failed to fetch account", http.StatusInternalServerError)
+		jsonError(w, "Account unfrozen but failed to fetch", http.StatusInternalServerError)
 		return
 	}
 
-	jsonResponse(w, updatedAccount, http.StatusOK)
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "unfrozen",
+		EntityID: &accountID,
+		Summary:  "Unfroze account " + account.Name,
+	})
+
+	jsonResponse(w, account, http.StatusOK)
+}
+
+// recordBalanceChange inserts the transaction that moves an account's balance
+// field by delta to balanceAfter
+func recordBalanceChange(ctx context.Context, tx *sql.Tx, userID, accountID int64, accountType models.AccountType, delta, balanceAfter float64, description string, category models.TransactionCategory, at time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, accountID, string(models.BalanceChangeType(accountType, delta)), abs(delta), services.EncryptField(userID, description), string(category), balanceAfter, at)
+	return err
 }
 
 func abs(x float64) float64 {
@@ -464,7 +857,8 @@ func abs(x float64) float64 {
 }
 
 func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -472,7 +866,7 @@ func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
 
 	// Get user's preferred currency
 	var preferredCurrency sql.NullString
-	err := h.db.QueryRow("SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferredCurrency)
+	err := h.db.QueryRowContext(ctx, "SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferredCurrency)
 	if err != nil && err != sql.ErrNoRows {
 		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
 		return
@@ -483,11 +877,11 @@ func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
 		baseCurrency = preferredCurrency.String
 	}
 
-	rows, err := h.db.Query(`
-		SELECT type, currency, current_balance, credit_owed, loan_current_owed, loan_initial_amount
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed, loan_initial_amount
 		FROM accounts
-		WHERE user_id = ?
-	`, userID)
+		WHERE user_id = ? AND profile_id = ?
+	`, userID, middleware.GetProfileID(ctx))
 	if err != nil {
 		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
 		return
@@ -496,17 +890,20 @@ func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
 
 	overview := models.FinancialOverview{
 		BaseCurrency:      baseCurrency,
+		CustomRates:       h.exchangeService != nil && h.exchangeService.HasCustomRates(userID),
 		AssetsByType:      make(map[string]float64),
 		LiabilitiesByType: make(map[string]float64),
+		Accounts:          []models.AccountContribution{},
 	}
 
 	for rows.Next() {
-		var accountType string
+		var accountID int64
+		var name, accountType string
 		var currency string
 		var currentBalance float64
 		var creditOwed, loanCurrentOwed, loanInitialAmount sql.NullFloat64
 
-		err := rows.Scan(&accountType, &currency, &currentBalance, &creditOwed, &loanCurrentOwed, &loanInitialAmount)
+		err := rows.Scan(&accountID, &name, &accountType, &currency, &currentBalance, &creditOwed, &loanCurrentOwed, &loanInitialAmount)
 		if err != nil {
 			continue
 		}
@@ -516,7 +913,7 @@ func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
 			if currency == baseCurrency || h.exchangeService == nil {
 				return amount
 			}
-			converted, err := h.exchangeService.Convert(amount, currency, baseCurrency)
+			converted, err := h.exchangeService.ConvertFor(userID, amount, currency, baseCurrency)
 			if err != nil {
 				log.Printf("Currency conversion failed %s->%s: %v", currency, baseCurrency, err)
 				return amount
@@ -524,18 +921,37 @@ func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
 			return converted
 		}
 
-		switch models.AccountType(accountType) {
-		case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
+		account := &models.Account{Type: models.AccountType(accountType)}
+		contribution := models.AccountContribution{
+			AccountID: accountID,
+			Name:      name,
+			Type:      account.Type,
+			Currency:  currency,
+		}
+
+		switch account.Type {
+		case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment, models.AccountTypeAsset:
 			convertedBalance := convertToBase(currentBalance)
 			overview.TotalAssets += convertedBalance
 			overview.AssetsByType[accountType] += convertedBalance
+			contribution.Balance, contribution.Converted = currentBalance, convertedBalance
+			if account.IsLiquidAccount() {
+				overview.LiquidAssets += convertedBalance
+				contribution.Group = models.ContributionLiquid
+			} else {
+				overview.IlliquidAssets += convertedBalance
+				contribution.Group = models.ContributionIlliquid
+			}
 		case models.AccountTypeCreditCard:
+			contribution.Group = models.ContributionLiability
 			if creditOwed.Valid {
 				convertedOwed := convertToBase(creditOwed.Float64)
 				overview.TotalLiabilities += convertedOwed
 				overview.LiabilitiesByType[accountType] += convertedOwed
+				contribution.Balance, contribution.Converted = creditOwed.Float64, convertedOwed
 			}
 		case models.AccountTypeLoan:
+			contribution.Group = models.ContributionLiability
 			// Use loan_current_owed if set, otherwise fall back to loan_initial_amount
 			var loanLiability float64
 			if loanCurrentOwed.Valid {
@@ -547,29 +963,111 @@ func (h *AccountHandler) Overview(w http.ResponseWriter, r *http.Request) {
 				convertedLiability := convertToBase(loanLiability)
 				overview.TotalLiabilities += convertedLiability
 				overview.LiabilitiesByType[accountType] += convertedLiability
+				contribution.Balance, contribution.Converted = loanLiability, convertedLiability
 			}
+		default:
+			continue
+		}
+		overview.Accounts = append(overview.Accounts, contribution)
+	}
+
+	for i, c := range overview.Accounts {
+		total := overview.TotalAssets
+		if c.Group == models.ContributionLiability {
+			total = overview.TotalLiabilities
 		}
+		if total != 0 {
+			overview.Accounts[i].Share = c.Converted / total * 100
+		}
+	}
+	sort.SliceStable(overview.Accounts, func(i, j int) bool {
+		return math.Abs(overview.Accounts[i].Converted) > math.Abs(overview.Accounts[j].Converted)
+	})
+	if overview.TotalAssets > 0 {
+		ratio := overview.LiquidAssets / overview.TotalAssets * 100
+		overview.LiquidityRatio = &ratio
 	}
 
 	overview.NetWorth = overview.TotalAssets - overview.TotalLiabilities
 
+	locale := services.UserLocale(ctx, h.db, userID)
+	overview.Formatted = map[string]string{
+		"total_assets":      services.FormatMoney(overview.TotalAssets, baseCurrency, locale),
+		"total_liabilities": services.FormatMoney(overview.TotalLiabilities, baseCurrency, locale),
+		"net_worth":         services.FormatMoney(overview.NetWorth, baseCurrency, locale),
+		"liquid_assets":     services.FormatMoney(overview.LiquidAssets, baseCurrency, locale),
+		"illiquid_assets":   services.FormatMoney(overview.IlliquidAssets, baseCurrency, locale),
+	}
+
+	overview.UpcomingBills, err = upcomingBills(ctx, h.db, userID, locale)
+	if err != nil {
+		jsonError(w, "Failed to fetch bills", http.StatusInternalServerError)
+		return
+	}
+
 	jsonResponse(w, overview, http.StatusOK)
 }
 
-func (h *AccountHandler) getAccountByID(accountID, userID int64) (*models.Account, error) {
-	var a models.AccountDB
-	err := h.db.QueryRow(`
-		SELECT id, user_id, name, type, color, currency, current_balance,
-			   credit_limit, credit_owed, closing_date,
-			   loan_initial_amount, loan_current_owed, monthly_payment,
-			   yearly_interest_rate, created_at, updated_at
+// accountFromURL loads the account in the URL, writing the error response when
+// it isn't one of the user's accounts
+func (h *AccountHandler) accountFromURL(w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid account ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	account, err := h.getAccountByID(r.Context(), accountID, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return nil, false
+	}
+	return account, true
+}
+
+// accountByIDQuery fetches one of the user's accounts. It backs most account
+// routes, so it runs as a prepared statement.
+const accountByIDQuery = `
+		SELECT ` + accountColumns + `
 		FROM accounts
-		WHERE id = ? AND user_id = ?
-	`, accountID, userID).Scan(
+		WHERE id = ? AND user_id = ? AND profile_id = ?
+	`
+
+func (h *AccountHandler) getAccountByID(ctx context.Context, accountID, userID int64) (*models.Account, error) {
+	account, err := scanAccount(h.stmts.QueryRowContext(ctx, accountByIDQuery, accountID, userID, middleware.GetProfileID(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	account.FormattedBalance = services.FormatMoney(account.GetDisplayBalance(), account.Currency, services.UserLocale(ctx, h.db, userID))
+	return account, nil
+}
+
+// accountColumns is the column list read by scanAccount
+const accountColumns = `id, user_id, name, type, color, currency, current_balance,
+			   credit_limit, credit_owed, closing_date, due_date,
+			   loan_initial_amount, loan_current_owed, monthly_payment,
+			   yearly_interest_rate, status, frozen_until, frozen_reason,
+			   icon, institution, last4, version, profile_id, created_at, updated_at`
+
+// scanAccount scans a row selected with accountColumns
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var a models.AccountDB
+	err := row.Scan(
 		&a.ID, &a.UserID, &a.Name, &a.Type, &a.Color, &a.Currency, &a.CurrentBalance,
-		&a.CreditLimit, &a.CreditOwed, &a.ClosingDate,
+		&a.CreditLimit, &a.CreditOwed, &a.ClosingDate, &a.DueDate,
 		&a.LoanInitialAmount, &a.LoanCurrentOwed, &a.MonthlyPayment,
-		&a.YearlyInterestRate, &a.CreatedAt, &a.UpdatedAt,
+		&a.YearlyInterestRate, &a.Status, &a.FrozenUntil, &a.FrozenReason,
+		&a.Icon, &a.Institution, &a.Last4, &a.Version, &a.ProfileID, &a.CreatedAt, &a.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
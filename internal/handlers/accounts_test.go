@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestCreateAndListAccounts(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+
+	var accounts []models.Account
+	f.Client.Get("/api/accounts").Expect(http.StatusOK).Decode(&accounts)
+	if len(accounts) != 3 {
+		t.Fatalf("got %d accounts, want 3", len(accounts))
+	}
+
+	checking := f.Client.Account(f.Checking.ID)
+	if checking.CurrentBalance != testutil.CheckingBalance {
+		t.Errorf("checking balance = %v, want %v", checking.CurrentBalance, testutil.CheckingBalance)
+	}
+	card := f.Client.Account(f.Card.ID)
+	if card.CreditOwed == nil || *card.CreditOwed != testutil.CardOwed {
+		t.Errorf("card owed = %v, want %v", card.CreditOwed, testutil.CardOwed)
+	}
+}
+
+func TestCreateAccountValidation(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+
+	tests := []struct {
+		name string
+		req  models.CreateAccountRequest
+		want string
+	}{
+		{"missing name", models.CreateAccountRequest{Type: models.AccountTypeDebit, Currency: "DOP"}, "Account name is required"},
+		{"unknown type", models.CreateAccountRequest{Name: "Wallet", Type: "piggy_bank", Currency: "DOP"}, "Invalid account type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := c.Post("/api/accounts", tt.req).Expect(http.StatusBadRequest).Error(); msg != tt.want {
+				t.Errorf("error = %q, want %q", msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccountsAreIsolatedBetweenUsers(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	other := app.Register(t, "ben@example.com")
+
+	path := fmt.Sprintf("/api/accounts/%d", f.Checking.ID)
+	other.Get(path).Expect(http.StatusNotFound)
+	other.Delete(path).Expect(http.StatusNotFound)
+
+	var accounts []models.Account
+	other.Get("/api/accounts").Expect(http.StatusOK).Decode(&accounts)
+	if len(accounts) != 0 {
+		t.Errorf("other user sees %d accounts, want 0", len(accounts))
+	}
+	f.Client.Get(path).Expect(http.StatusOK)
+}
+
+func TestConvertAccount(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	convert := func(id int64) string { return fmt.Sprintf("/api/accounts/%d/convert", id) }
+
+	rate := 4.5
+	var saving models.Account
+	f.Client.Post(convert(f.Checking.ID), models.ConvertAccountRequest{Type: models.AccountTypeSaving, YearlyInterestRate: &rate}).
+		Expect(http.StatusOK).Decode(&saving)
+	if saving.Type != models.AccountTypeSaving || saving.CurrentBalance != testutil.CheckingBalance ||
+		saving.YearlyInterestRate == nil || *saving.YearlyInterestRate != rate {
+		t.Errorf("converted checking = %+v, want a saving account with the balance and rate", saving)
+	}
+
+	// Loans can't pay bills, so a card paying one stays a card
+	name, amount, day := "Internet", 1500.0, 10
+	f.Client.Post("/api/bills", models.BillRequest{Name: &name, Amount: &amount, DueDay: &day, AccountID: &f.Card.ID}).
+		Expect(http.StatusCreated)
+	f.Client.Post(convert(f.Card.ID), models.ConvertAccountRequest{Type: models.AccountTypeLoan}).Expect(http.StatusConflict)
+	app.DB.Exec("DELETE FROM bills")
+
+	payment := 800.0
+	var loan models.Account
+	f.Client.Post(convert(f.Card.ID), models.ConvertAccountRequest{Type: models.AccountTypeLoan, MonthlyPayment: &payment}).
+		Expect(http.StatusOK).Decode(&loan)
+	if loan.LoanCurrentOwed == nil || *loan.LoanCurrentOwed != testutil.CardOwed || loan.LoanInitialAmount == nil ||
+		*loan.LoanInitialAmount != testutil.CardOwed || loan.MonthlyPayment == nil || *loan.MonthlyPayment != payment ||
+		loan.CreditLimit != nil || loan.CreditOwed != nil || loan.DueDate != nil {
+		t.Errorf("converted card = %+v, want a loan owing what the card did, without card fields", loan)
+	}
+
+	// Revaluations only belong in investment accounts
+	investment := f.Client.CreateAccount(models.CreateAccountRequest{Name: "Brokerage", Type: models.AccountTypeInvestment, Currency: "DOP"})
+	f.Client.Post(fmt.Sprintf("/api/accounts/%d/revalue", investment.ID), models.RevalueRequest{Value: 1200}).Expect(http.StatusOK)
+	f.Client.Post(convert(investment.ID), models.ConvertAccountRequest{Type: models.AccountTypeDebit}).Expect(http.StatusConflict)
+
+	limit := 1000.0
+	tests := []struct {
+		name string
+		id   int64
+		req  models.ConvertAccountRequest
+		want string
+	}{
+		{"across groups", f.Savings.ID, models.ConvertAccountRequest{Type: models.AccountTypeCreditCard}, "A saving account can't be converted to credit_card"},
+		{"same type", f.Savings.ID, models.ConvertAccountRequest{Type: models.AccountTypeSaving}, "Account is already of this type"},
+		{"unknown type", f.Savings.ID, models.ConvertAccountRequest{Type: "piggy_bank"}, "Invalid account type"},
+		{"other type's fields", f.Savings.ID, models.ConvertAccountRequest{Type: models.AccountTypeDebit, CreditLimit: &limit}, "Credit limit, closing and due dates only apply to credit cards"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if msg := f.Client.Post(convert(tt.id), tt.req).Expect(http.StatusBadRequest).Error(); msg != tt.want {
+				t.Errorf("error = %q, want %q", msg, tt.want)
+			}
+		})
+	}
+
+	var converted int
+	app.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'converted'").Scan(&converted)
+	if converted != 2 {
+		t.Errorf("%d conversions audited, want 2", converted)
+	}
+	app.Register(t, "ben@example.com").Post(convert(f.Savings.ID), models.ConvertAccountRequest{Type: models.AccountTypeDebit}).
+		Expect(http.StatusNotFound)
+}
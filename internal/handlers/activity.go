@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+type ActivityHandler struct {
+	db *sql.DB
+}
+
+func NewActivityHandler(db *sql.DB) *ActivityHandler {
+	return &ActivityHandler{db: db}
+}
+
+// List returns the user's activity feed from the audit log, newest first.
+// Filter with types (comma-separated: transaction, account, budget, login)
+// and since (RFC 3339 or YYYY-MM-DD). Pages are walked with before, set to
+// the next_before of the previous page.
+func (h *ActivityHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if types := splitList(query.Get("types")); len(types) > 0 {
+		placeholders := make([]string, len(types))
+		for i, v := range types {
+			if !slices.Contains(models.ActivityTypes, v) {
+				jsonError(w, "Invalid activity type: "+v, http.StatusBadRequest)
+				return
+			}
+			placeholders[i] = "?"
+			args = append(args, v)
+		}
+		conditions = append(conditions, "type IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if v := query.Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid before", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "id < ?")
+		args = append(args, before)
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			since, err = time.ParseInLocation("2006-01-02", v, time.Now().Location())
+		}
+		if err != nil {
+			jsonError(w, "Invalid since: use RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, since.In(time.Now().Location()).Format("2006-01-02 15:04:05"))
+	}
+	// One extra row tells whether there is another page
+	args = append(args, limit+1)
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, user_id, type, action, entity_id, summary, details, ip_address, created_at
+		FROM audit_log
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY id DESC
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		jsonError(w, "Failed to fetch activity", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		var entityID sql.NullInt64
+		var details, ipAddress sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &e.Action, &entityID, &e.Summary, &details, &ipAddress, &e.CreatedAt); err != nil {
+			continue
+		}
+		if entityID.Valid {
+			e.EntityID = &entityID.Int64
+		}
+		if details.Valid {
+			json.Unmarshal([]byte(details.String), &e.Details)
+		}
+		e.IPAddress = ipAddress.String
+		events = append(events, e)
+	}
+
+	response := models.ActivityResponse{Events: events}
+	if len(events) > limit {
+		response.Events = events[:limit]
+		next := events[limit-1].ID
+		response.NextBefore = &next
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// changedFields lists the fields set in a partial update request, for the
+// audit log. Values are left out so nothing sensitive is copied there.
+func changedFields(req interface{}) []string {
+	encoded, err := json.Marshal(req)
+	if err != nil {
+		return nil
+	}
+	var set map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &set); err != nil {
+		return nil
+	}
+	fields := []string{}
+	for name, value := range set {
+		if string(value) != "null" {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
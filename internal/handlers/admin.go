@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/jobs"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type AdminHandler struct {
+	db            *sql.DB
+	locker        *services.AccountLocker
+	integrity     *services.IntegrityService
+	scheduler     *jobs.Scheduler
+	notifications *services.NotificationService
+}
+
+func NewAdminHandler(db *sql.DB, locker *services.AccountLocker, integrity *services.IntegrityService, scheduler *jobs.Scheduler, notifications *services.NotificationService) *AdminHandler {
+	return &AdminHandler{db: db, locker: locker, integrity: integrity, scheduler: scheduler, notifications: notifications}
+}
+
+// Jobs returns the schedule and last run of every background job
+func (h *AdminHandler) Jobs(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, h.scheduler.Status(), http.StatusOK)
+}
+
+// AccountLocks returns wait time metrics for the per-account write locks
+func (h *AdminHandler) AccountLocks(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, h.locker.Stats(), http.StatusOK)
+}
+
+// Integrity checks every account's stored balance against its transaction
+// history. Pass account_id to check a single account.
+func (h *AdminHandler) Integrity(w http.ResponseWriter, r *http.Request) {
+	h.runIntegrity(w, r, false)
+}
+
+// RepairIntegrity runs the integrity check and rewrites broken balance_after
+// chains
+func (h *AdminHandler) RepairIntegrity(w http.ResponseWriter, r *http.Request) {
+	h.runIntegrity(w, r, true)
+}
+
+func (h *AdminHandler) runIntegrity(w http.ResponseWriter, r *http.Request, repair bool) {
+	var accountID int64
+	if accountIDStr := r.URL.Query().Get("account_id"); accountIDStr != "" {
+		id, err := strconv.ParseInt(accountIDStr, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid account ID", http.StatusBadRequest)
+			return
+		}
+		accountID = id
+	}
+
+	report, err := h.integrity.Check(r.Context(), accountID, repair)
+	if err != nil {
+		jsonError(w, "Failed to check balance integrity", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, report, http.StatusOK)
+}
+
+// FeatureUsageSummary aggregates local usage counters for one feature
+type FeatureUsageSummary struct {
+	Feature     string    `json:"feature"`
+	TotalUses   int64     `json:"total_uses"`
+	UniqueUsers int64     `json:"unique_users"`
+	LastUsedAt  time.Time `json:"last_used_at"`
+}
+
+// UserFeatureUsage is a single user's counter for a feature
+type UserFeatureUsage struct {
+	UserID     int64     `json:"user_id"`
+	Email      string    `json:"email"`
+	Feature    string    `json:"feature"`
+	Count      int64     `json:"count"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// FeatureUsageResponse is returned by the admin usage endpoint
+type FeatureUsageResponse struct {
+	OptedInUsers int64                 `json:"opted_in_users"`
+	TotalUsers   int64                 `json:"total_users"`
+	Features     []FeatureUsageSummary `json:"features"`
+	ByUser       []UserFeatureUsage    `json:"by_user,omitempty"`
+}
+
+// FeatureUsage returns the opt-in feature usage counters. Pass by_user=true to
+// include the per-user breakdown.
+func (h *AdminHandler) FeatureUsage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var response FeatureUsageResponse
+
+	err := h.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN telemetry_opt_in = 1 THEN 1 ELSE 0 END), 0)
+		FROM users
+	`).Scan(&response.TotalUsers, &response.OptedInUsers)
+	if err != nil {
+		jsonError(w, "Failed to count users", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT feature, SUM(count), COUNT(DISTINCT user_id), MAX(last_used_at)
+		FROM feature_usage
+		GROUP BY feature
+		ORDER BY SUM(count) DESC
+	`)
+	if err != nil {
+		jsonError(w, "Failed to fetch feature usage", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response.Features = []FeatureUsageSummary{}
+	for rows.Next() {
+		var f FeatureUsageSummary
+		var lastUsed sql.NullString
+		if err := rows.Scan(&f.Feature, &f.TotalUses, &f.UniqueUsers, &lastUsed); err != nil {
+			continue
+		}
+		f.LastUsedAt = parseDBTime(lastUsed.String)
+		response.Features = append(response.Features, f)
+	}
+
+	if r.URL.Query().Get("by_user") == "true" {
+		userRows, err := h.db.QueryContext(ctx, `
+			SELECT f.user_id, u.email, f.feature, f.count, f.last_used_at
+			FROM feature_usage f
+			JOIN users u ON f.user_id = u.id
+			ORDER BY u.email, f.count DESC
+		`)
+		if err != nil {
+			jsonError(w, "Failed to fetch feature usage", http.StatusInternalServerError)
+			return
+		}
+		defer userRows.Close()
+
+		response.ByUser = []UserFeatureUsage{}
+		for userRows.Next() {
+			var u UserFeatureUsage
+			if err := userRows.Scan(&u.UserID, &u.Email, &u.Feature, &u.Count, &u.LastUsedAt); err != nil {
+				continue
+			}
+			response.ByUser = append(response.ByUser, u)
+		}
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// TableStats is the number of rows in one table
+type TableStats struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// InstanceStats describes the health of the instance's database and jobs
+type InstanceStats struct {
+	DatabaseBytes     int64              `json:"database_bytes"`
+	FreeBytes         int64              `json:"free_bytes"`
+	Tables            []TableStats       `json:"tables"`
+	OldestTransaction *time.Time         `json:"oldest_transaction"`
+	NewestTransaction *time.Time         `json:"newest_transaction"`
+	Jobs              []models.JobStatus `json:"jobs"`
+}
+
+// Stats returns the database size, row counts per table, the date range of
+// all transactions and background job timing, so self-hosters can monitor
+// the instance without opening the database
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats := InstanceStats{Tables: []TableStats{}, Jobs: h.scheduler.Status()}
+
+	var pageSize, pageCount, freePages int64
+	err := h.db.QueryRowContext(ctx, "SELECT page_size, page_count, freelist_count FROM pragma_page_size, pragma_page_count, pragma_freelist_count").
+		Scan(&pageSize, &pageCount, &freePages)
+	if err != nil {
+		jsonError(w, "Failed to read database size", http.StatusInternalServerError)
+		return
+	}
+	stats.DatabaseBytes = pageSize * pageCount
+	stats.FreeBytes = pageSize * freePages
+
+	rows, err := h.db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		jsonError(w, "Failed to list tables", http.StatusInternalServerError)
+		return
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	for _, table := range tables {
+		t := TableStats{Table: table}
+		// Table names come from sqlite_master, not from the request
+		if err := h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM "`+strings.ReplaceAll(table, `"`, `""`)+`"`).Scan(&t.Rows); err != nil {
+			jsonError(w, "Failed to count rows", http.StatusInternalServerError)
+			return
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+
+	var oldest, newest sql.NullString
+	if err := h.db.QueryRowContext(ctx, "SELECT MIN(created_at), MAX(created_at) FROM transactions").Scan(&oldest, &newest); err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	if oldest.Valid {
+		t := parseDBTime(oldest.String)
+		stats.OldestTransaction = &t
+	}
+	if newest.Valid {
+		t := parseDBTime(newest.String)
+		stats.NewestTransaction = &t
+	}
+
+	jsonResponse(w, stats, http.StatusOK)
+}
+
+// parseDBTime parses timestamps returned by SQLite aggregates, which come
+// back as plain strings instead of time values
+func parseDBTime(s string) time.Time {
+	layouts := []string{
+		"2006-01-02 15:04:05.999999999-07:00",
+		"2006-01-02T15:04:05.999999999-07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type AdvisorHandler struct {
+	db    *sql.DB
+	audit *services.AuditService
+}
+
+func NewAdvisorHandler(db *sql.DB, audit *services.AuditService) *AdvisorHandler {
+	return &AdvisorHandler{db: db, audit: audit}
+}
+
+// List reviews who the user has given advisor access to, what they can see
+// and when they last used it
+func (h *AdvisorHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT g.id, g.advisor_id, u.email, COALESCE(u.name, ''), g.reports, g.last_used_at, g.created_at, g.updated_at
+		FROM advisor_grants g
+		JOIN users u ON g.advisor_id = u.id
+		WHERE g.user_id = ?
+		ORDER BY g.created_at, g.id
+	`, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch advisors", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	grants := []models.AdvisorGrant{}
+	for rows.Next() {
+		var g models.AdvisorGrant
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&g.ID, &g.AdvisorID, &g.AdvisorEmail, &g.AdvisorName, &g.Reports, &lastUsedAt, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			continue
+		}
+		if lastUsedAt.Valid {
+			g.LastUsedAt = &lastUsedAt.Time
+		}
+		grants = append(grants, g)
+	}
+	rows.Close()
+
+	for i := range grants {
+		if grants[i].Accounts, err = h.grantAccounts(ctx, grants[i].ID); err != nil {
+			jsonError(w, "Failed to fetch advisors", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	jsonResponse(w, grants, http.StatusOK)
+}
+
+// Clients lists the users who have given the current user advisor access
+func (h *AdvisorHandler) Clients(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT g.id, g.user_id, u.email, COALESCE(u.name, ''), g.reports
+		FROM advisor_grants g
+		JOIN users u ON g.user_id = u.id
+		WHERE g.advisor_id = ?
+		ORDER BY u.email
+	`, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch clients", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	clients := []models.AdvisorClient{}
+	for rows.Next() {
+		var c models.AdvisorClient
+		if err := rows.Scan(&c.GrantID, &c.OwnerID, &c.OwnerEmail, &c.OwnerName, &c.Reports); err != nil {
+			continue
+		}
+		clients = append(clients, c)
+	}
+	rows.Close()
+
+	for i := range clients {
+		if clients[i].Accounts, err = h.grantAccounts(ctx, clients[i].GrantID); err != nil {
+			jsonError(w, "Failed to fetch clients", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	jsonResponse(w, clients, http.StatusOK)
+}
+
+// Grant gives the user registered with the requested email read-only access
+// to some of the current user's accounts and optionally their reports. A
+// second grant to the same advisor replaces the first.
+func (h *AdvisorHandler) Grant(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.AdvisorGrantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	if req.Email == "" {
+		jsonError(w, "email is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.AccountIDs) == 0 && !req.Reports {
+		jsonError(w, "Share at least one account or the reports", http.StatusBadRequest)
+		return
+	}
+
+	var advisorID int64
+	err := h.db.QueryRowContext(ctx, "SELECT id FROM users WHERE email = ?", req.Email).Scan(&advisorID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "No user is registered with this email", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+	if advisorID == userID {
+		jsonError(w, "You can't grant access to yourself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, accountID := range req.AccountIDs {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM accounts WHERE id = ? AND user_id = ?)", accountID, userID).Scan(&exists); err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			jsonError(w, "Account not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	now := time.Now()
+	var grantID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO advisor_grants (user_id, advisor_id, reports, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, advisor_id) DO UPDATE SET
+			reports = excluded.reports,
+			updated_at = excluded.updated_at
+		RETURNING id
+	`, userID, advisorID, req.Reports, now, now).Scan(&grantID)
+	if err != nil {
+		jsonError(w, "Failed to grant access", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM advisor_grant_accounts WHERE grant_id = ?", grantID); err != nil {
+		jsonError(w, "Failed to grant access", http.StatusInternalServerError)
+		return
+	}
+	for _, accountID := range req.AccountIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO advisor_grant_accounts (grant_id, account_id) VALUES (?, ?)", grantID, accountID); err != nil {
+			jsonError(w, "Failed to grant access", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAdvisor,
+		Action:   "granted",
+		EntityID: &grantID,
+		Summary:  "Gave " + req.Email + " read-only access",
+		Details:  map[string]interface{}{"advisor_id": advisorID, "account_ids": req.AccountIDs, "reports": req.Reports},
+	})
+
+	grant := models.AdvisorGrant{
+		ID:           grantID,
+		AdvisorID:    advisorID,
+		AdvisorEmail: req.Email,
+		Reports:      req.Reports,
+	}
+	var lastUsedAt sql.NullTime
+	err = h.db.QueryRowContext(ctx, `
+		SELECT COALESCE(u.name, ''), g.last_used_at, g.created_at, g.updated_at
+		FROM advisor_grants g
+		JOIN users u ON g.advisor_id = u.id
+		WHERE g.id = ?
+	`, grantID).Scan(&grant.AdvisorName, &lastUsedAt, &grant.CreatedAt, &grant.UpdatedAt)
+	if lastUsedAt.Valid {
+		grant.LastUsedAt = &lastUsedAt.Time
+	}
+	if err == nil {
+		grant.Accounts, err = h.grantAccounts(ctx, grantID)
+	}
+	if err != nil {
+		jsonError(w, "Access granted but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, grant, http.StatusOK)
+}
+
+// Revoke removes an advisor's access
+func (h *AdvisorHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	grantID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid grant ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM advisor_grants WHERE id = ? AND user_id = ?", grantID, userID)
+	if err != nil {
+		jsonError(w, "Failed to revoke access", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Grant not found", http.StatusNotFound)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAdvisor,
+		Action:   "revoked",
+		EntityID: &grantID,
+		Summary:  "Revoked an advisor's access",
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// grantAccounts returns the accounts shared by a grant
+func (h *AdvisorHandler) grantAccounts(ctx context.Context, grantID int64) ([]models.AdvisorAccount, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT a.id, a.name
+		FROM advisor_grant_accounts ga
+		JOIN accounts a ON ga.account_id = a.id
+		WHERE ga.grant_id = ?
+		ORDER BY a.name
+	`, grantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.AdvisorAccount{}
+	for rows.Next() {
+		var a models.AdvisorAccount
+		if err := rows.Scan(&a.ID, &a.Name); err != nil {
+			continue
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
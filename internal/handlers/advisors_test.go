@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/handlers"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestAdvisorSeesPrivateTransactionsRedacted(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	advisor := app.Register(t, "advisor@example.com")
+
+	latitude, longitude := 18.4861, -69.9312
+	path := fmt.Sprintf("/api/accounts/%d/transactions", f.Checking.ID)
+	f.Client.Post(path, models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 1200, Description: "Pharmacy", Category: models.CategoryHealthcare,
+		Location: &models.Location{Latitude: &latitude, Longitude: &longitude, PlaceName: "Farmacia Carol"}, IsPrivate: true,
+	}).Expect(http.StatusCreated)
+	f.Client.Post(path, models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 800, Description: "Lunch", Category: models.CategoryDining,
+	}).Expect(http.StatusCreated)
+	f.Client.Post("/api/advisors", models.AdvisorGrantRequest{
+		Email: "advisor@example.com", AccountIDs: []int64{f.Checking.ID}, Reports: true,
+	}).Expect(http.StatusOK)
+	viewing := fmt.Sprintf("advisor_for=%d", f.Client.User.ID)
+
+	// The owner sees everything
+	var list models.TransactionListResponse
+	f.Client.Get(path).Expect(http.StatusOK).Decode(&list)
+	if tx := list.Transactions[1]; tx.Description != "Pharmacy" || tx.Location == nil {
+		t.Errorf("owner sees %+v, want the private transaction in full", tx)
+	}
+
+	list = models.TransactionListResponse{}
+	advisor.Get(path + "?" + viewing).Expect(http.StatusOK).Decode(&list)
+	if len(list.Transactions) != 3 {
+		t.Fatalf("advisor sees %d transactions, want 3", len(list.Transactions))
+	}
+	private := list.Transactions[1]
+	if private.Description != "Private transaction" || private.Category != models.CategoryOther ||
+		private.Location != nil || private.Amount != 1200 {
+		t.Errorf("advisor sees %+v, want only the amount of the private transaction", private)
+	}
+	if lunch := list.Transactions[0]; lunch.Description != "Lunch" || lunch.Category != models.CategoryDining {
+		t.Errorf("advisor sees %+v, want the lunch in full", lunch)
+	}
+
+	// Reports keep the amount under "other"
+	var report handlers.ReportResponse
+	advisor.Get("/api/reports?" + viewing).Expect(http.StatusOK).Decode(&report)
+	byCategory := make(map[string]float64)
+	for _, c := range report.ExpensesByCategory {
+		byCategory[c.Category] = c.Amount
+	}
+	if byCategory["other"] != 1200 || byCategory["dining"] != 800 || len(byCategory) != 2 || report.TotalExpenses != 2000 {
+		t.Errorf("advisor's expenses by category = %v, want other 1200 and dining 800", byCategory)
+	}
+	var review handlers.YearInReview
+	advisor.Get("/api/reports/year-in-review?" + viewing).Expect(http.StatusOK).Decode(&review)
+	if p := review.BiggestPurchase; p == nil || p.Description != "Private transaction" || p.Category != "other" {
+		t.Errorf("advisor's biggest purchase = %+v, want it redacted", p)
+	}
+
+	var places handlers.LocationReport
+	advisor.Get("/api/reports/by-location?" + viewing).Expect(http.StatusOK).Decode(&places)
+	if len(places.Places) != 0 || places.Unlocated != 2000 {
+		t.Errorf("advisor's locations = %+v, want the private one unlocated", places)
+	}
+
+	// The report webhook's URL is a credential
+	advisor.Get("/api/webhooks/report?" + viewing).Expect(http.StatusForbidden)
+}
+
+func TestAdvisorReportsOnlySharedAccounts(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	advisor := app.Register(t, "advisor@example.com")
+
+	f.Client.Post(fmt.Sprintf("/api/accounts/%d/transactions", f.Checking.ID), models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 800, Description: "Lunch", Category: models.CategoryDining,
+	}).Expect(http.StatusCreated)
+	f.Client.Post(fmt.Sprintf("/api/accounts/%d/transactions", f.Savings.ID), models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 5000, Description: "Clinic", Category: models.CategoryHealthcare,
+	}).Expect(http.StatusCreated)
+	f.Client.Post("/api/advisors", models.AdvisorGrantRequest{
+		Email: "advisor@example.com", AccountIDs: []int64{f.Checking.ID}, Reports: true,
+	}).Expect(http.StatusOK)
+	viewing := fmt.Sprintf("advisor_for=%d", f.Client.User.ID)
+
+	var report handlers.ReportResponse
+	f.Client.Get("/api/reports").Expect(http.StatusOK).Decode(&report)
+	if report.TotalExpenses != 5800 {
+		t.Errorf("owner's expenses = %v, want 5800", report.TotalExpenses)
+	}
+
+	report = handlers.ReportResponse{}
+	advisor.Get("/api/reports?" + viewing).Expect(http.StatusOK).Decode(&report)
+	if report.TotalExpenses != 800 || len(report.ExpensesByCategory) != 1 || report.ExpensesByCategory[0].Category != "dining" {
+		t.Errorf("advisor's expenses = %v by %+v, want only the 800 on the shared account", report.TotalExpenses, report.ExpensesByCategory)
+	}
+	var review handlers.YearInReview
+	advisor.Get("/api/reports/year-in-review?" + viewing).Expect(http.StatusOK).Decode(&review)
+	if p := review.BiggestPurchase; p == nil || p.Description != "Lunch" {
+		t.Errorf("advisor's biggest purchase = %+v, want the lunch", p)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// maxAlertsPerAccount keeps alert checks on balance writes cheap
+const maxAlertsPerAccount = 10
+
+// ListAlerts returns an account's balance alerts
+func (h *AccountHandler) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, account_id, direction, threshold, triggered, created_at
+		FROM balance_alerts
+		WHERE account_id = ?
+		ORDER BY id
+	`, account.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch alerts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	alerts := []models.BalanceAlert{}
+	for rows.Next() {
+		a, err := scanBalanceAlert(rows)
+		if err != nil {
+			continue
+		}
+		alerts = append(alerts, *a)
+	}
+
+	jsonResponse(w, alerts, http.StatusOK)
+}
+
+// CreateAlert adds a balance alert to an account. The alert is evaluated
+// right away, so a balance already past the threshold notifies immediately.
+func (h *AccountHandler) CreateAlert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CreateBalanceAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.Direction.IsValid() {
+		jsonError(w, "Invalid direction: use below or above", http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM balance_alerts WHERE account_id = ?", account.ID).Scan(&count); err != nil {
+		jsonError(w, "Failed to fetch alerts", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAlertsPerAccount {
+		jsonError(w, "Too many alerts for this account", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO balance_alerts (user_id, account_id, direction, threshold, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, account.UserID, account.ID, string(req.Direction), req.Threshold, now, now)
+	if err != nil {
+		jsonError(w, "Failed to create alert", http.StatusInternalServerError)
+		return
+	}
+	alertID, _ := result.LastInsertId()
+
+	checkBalanceAlerts(ctx, h.alerts, account.ID)
+
+	alert, err := h.balanceAlertByID(ctx, account.ID, alertID)
+	if err != nil {
+		jsonError(w, "Alert created but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, alert, http.StatusCreated)
+}
+
+// DeleteAlert removes a balance alert
+func (h *AccountHandler) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	alertID, err := strconv.ParseInt(chi.URLParam(r, "alertID"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid alert ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM balance_alerts WHERE id = ? AND account_id = ?", alertID, account.ID)
+	if err != nil {
+		jsonError(w, "Failed to delete alert", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AccountHandler) balanceAlertByID(ctx context.Context, accountID, alertID int64) (*models.BalanceAlert, error) {
+	return scanBalanceAlert(h.db.QueryRowContext(ctx, `
+		SELECT id, account_id, direction, threshold, triggered, created_at
+		FROM balance_alerts
+		WHERE id = ? AND account_id = ?
+	`, alertID, accountID))
+}
+
+func scanBalanceAlert(row rowScanner) (*models.BalanceAlert, error) {
+	var a models.BalanceAlert
+	if err := row.Scan(&a.ID, &a.AccountID, &a.Direction, &a.Threshold, &a.Triggered, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// announcementKey is the dedupe key of an announcement's notifications,
+// which ties them back to it
+func announcementKey(id int64) string {
+	return fmt.Sprintf("announcement:%d", id)
+}
+
+// ListAnnouncements returns every announcement, newest first, with how many
+// users it reached and how many acknowledged it
+func (h *AdminHandler) ListAnnouncements(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT a.id, a.kind, a.title, a.message, a.created_by, a.created_at,
+		       COUNT(n.id), COUNT(n.acknowledged_at)
+		FROM announcements a
+		LEFT JOIN notifications n ON n.dedupe_key = 'announcement:' || a.id AND n.in_app = 1
+		GROUP BY a.id
+		ORDER BY a.created_at DESC, a.id DESC
+	`)
+	if err != nil {
+		jsonError(w, "Failed to fetch announcements", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	announcements := []models.Announcement{}
+	for rows.Next() {
+		var a models.Announcement
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.Kind, &a.Title, &a.Message, &createdBy, &a.CreatedAt, &a.Recipients, &a.Acknowledged); err != nil {
+			continue
+		}
+		if createdBy.Valid {
+			a.CreatedBy = &createdBy.Int64
+		}
+		announcements = append(announcements, a)
+	}
+
+	jsonResponse(w, announcements, http.StatusOK)
+}
+
+// CreateAnnouncement posts an announcement to every user's notification
+// feed. Users get it on the channels they chose for announcements.
+func (h *AdminHandler) CreateAnnouncement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateAnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = models.AnnouncementGeneral
+	}
+	if !req.Kind.IsValid() {
+		jsonError(w, "Invalid kind. Use maintenance, feature or general", http.StatusBadRequest)
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Title == "" || req.Message == "" {
+		jsonError(w, "title and message are required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Title) > models.MaxAnnouncementTitleLength {
+		jsonError(w, fmt.Sprintf("Title must be at most %d characters", models.MaxAnnouncementTitleLength), http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Message) > models.MaxAnnouncementMessageLength {
+		jsonError(w, fmt.Sprintf("Message must be at most %d characters", models.MaxAnnouncementMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO announcements (kind, title, message, created_by, created_at) VALUES (?, ?, ?, ?, ?)
+	`, string(req.Kind), req.Title, req.Message, userID, now)
+	if err != nil {
+		jsonError(w, "Failed to create announcement", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	recipients, err := h.notifications.Broadcast(ctx, models.NotificationAnnouncement, req.Title, req.Message,
+		announcementKey(id), map[string]interface{}{"announcement_id": id, "kind": req.Kind})
+	if err != nil {
+		jsonError(w, "Announcement created but failed to notify users", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, models.Announcement{
+		ID:         id,
+		Kind:       req.Kind,
+		Title:      req.Title,
+		Message:    req.Message,
+		CreatedBy:  &userID,
+		Recipients: recipients,
+		CreatedAt:  now,
+	}, http.StatusCreated)
+}
+
+// DeleteAnnouncement withdraws an announcement, removing it from every
+// user's feed
+func (h *AdminHandler) DeleteAnnouncement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid announcement ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to delete announcement", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM announcements WHERE id = ?", id)
+	if err != nil {
+		jsonError(w, "Failed to delete announcement", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Announcement not found", http.StatusNotFound)
+		return
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM notifications WHERE dedupe_key = ?", announcementKey(id)); err != nil {
+		jsonError(w, "Failed to delete announcement", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to delete announcement", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
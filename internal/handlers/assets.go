@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// assetAccount loads the account in the URL and checks it is an asset,
+// writing the error response when it isn't
+func (h *AccountHandler) assetAccount(w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+	if account.Type != models.AccountTypeAsset {
+		jsonError(w, "Valuations are only available for asset accounts", http.StatusBadRequest)
+		return nil, false
+	}
+	return account, true
+}
+
+// ListValuations returns an asset's valuation history, newest first, and its
+// depreciation schedule
+func (h *AccountHandler) ListValuations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.assetAccount(w, r)
+	if !ok {
+		return
+	}
+
+	history := models.AssetHistory{
+		AccountID:  account.ID,
+		Currency:   account.Currency,
+		Value:      account.CurrentBalance,
+		Valuations: []models.AssetValuation{},
+	}
+
+	var d models.DepreciationSchedule
+	err := h.db.QueryRowContext(ctx, `
+		SELECT account_id, method, yearly_rate, salvage_value, base_value, last_applied_at, created_at
+		FROM asset_depreciation
+		WHERE account_id = ?
+	`, account.ID).Scan(&d.AccountID, &d.Method, &d.YearlyRate, &d.SalvageValue, &d.BaseValue, &d.LastAppliedAt, &d.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch depreciation schedule", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		history.Depreciation = &d
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, account_id, value, change, source, note, transaction_id, created_at
+		FROM asset_valuations
+		WHERE account_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, account.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch valuations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v models.AssetValuation
+		var note sql.NullString
+		var transactionID sql.NullInt64
+		if err := rows.Scan(&v.ID, &v.AccountID, &v.Value, &v.Change, &v.Source, &note, &transactionID, &v.CreatedAt); err != nil {
+			continue
+		}
+		v.Note = note.String
+		if transactionID.Valid {
+			v.TransactionID = &transactionID.Int64
+		}
+		history.Valuations = append(history.Valuations, v)
+	}
+
+	jsonResponse(w, history, http.StatusOK)
+}
+
+// AddValuation records what an asset is worth now. The account's value is
+// set to it and the change is recorded as a revalue transaction.
+func (h *AccountHandler) AddValuation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ValuationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Value < 0 {
+		jsonError(w, "Value cannot be negative", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	var note interface{}
+	if req.Note != "" {
+		note = req.Note
+	}
+
+	account, ok := h.assetAccount(w, r)
+	if !ok {
+		return
+	}
+
+	unlock := h.locker.Lock(account.ID)
+	defer unlock()
+
+	var valuation models.AssetValuation
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			var err error
+			if account, err = h.getAccountByID(ctx, account.ID, userID); err != nil {
+				jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		now := time.Now()
+		valuation = models.AssetValuation{
+			AccountID: account.ID,
+			Value:     req.Value,
+			Change:    math.Round((req.Value-account.CurrentBalance)*100) / 100,
+			Source:    models.ValuationManual,
+			Note:      req.Note,
+			CreatedAt: now,
+		}
+
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// A valuation confirming the current value is still history, but
+		// has no balance change to record
+		if valuation.Change != 0 {
+			description := "Valuation"
+			if req.Note != "" {
+				description = "Valuation: " + req.Note
+			}
+			transactionID, err := setMarketValue(ctx, tx, userID, account, req.Value, description)
+			if err == errBalanceConflict {
+				tx.Rollback()
+				if attempt < maxBalanceAttempts {
+					continue
+				}
+				balanceConflict(w)
+				return
+			}
+			if err != nil {
+				jsonError(w, "Failed to update account value", http.StatusInternalServerError)
+				return
+			}
+			valuation.TransactionID = &transactionID
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO asset_valuations (account_id, value, change, source, note, transaction_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, account.ID, valuation.Value, valuation.Change, string(valuation.Source), note, valuation.TransactionID, now)
+		if err != nil {
+			jsonError(w, "Failed to record valuation", http.StatusInternalServerError)
+			return
+		}
+		valuation.ID, _ = result.LastInsertId()
+
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	checkBalanceAlerts(ctx, h.alerts, account.ID)
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "valued",
+		EntityID: &account.ID,
+		Summary:  fmt.Sprintf("Valued %s at %.2f %s", account.Name, req.Value, account.Currency),
+		Details:  map[string]interface{}{"value": req.Value, "change": valuation.Change},
+	})
+
+	jsonResponse(w, valuation, http.StatusCreated)
+}
+
+// SetDepreciation adds or replaces an asset's depreciation schedule. It
+// starts from the current value and first applies a month from now.
+func (h *AccountHandler) SetDepreciation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.assetAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.DepreciationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	schedule := models.DepreciationSchedule{
+		AccountID:     account.ID,
+		Method:        req.Method,
+		YearlyRate:    req.YearlyRate,
+		SalvageValue:  req.SalvageValue,
+		BaseValue:     account.CurrentBalance,
+		LastAppliedAt: now,
+		CreatedAt:     now,
+	}
+	_, err := h.db.ExecContext(ctx, `
+		INSERT INTO asset_depreciation (account_id, method, yearly_rate, salvage_value, base_value, last_applied_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(account_id) DO UPDATE SET
+			method = excluded.method,
+			yearly_rate = excluded.yearly_rate,
+			salvage_value = excluded.salvage_value,
+			base_value = excluded.base_value,
+			last_applied_at = excluded.last_applied_at,
+			created_at = excluded.created_at
+	`, schedule.AccountID, string(schedule.Method), schedule.YearlyRate, schedule.SalvageValue, schedule.BaseValue, now, now)
+	if err != nil {
+		jsonError(w, "Failed to save depreciation schedule", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, schedule, http.StatusOK)
+}
+
+// DeleteDepreciation stops depreciating an asset. Past depreciation stays
+// in its history.
+func (h *AccountHandler) DeleteDepreciation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.assetAccount(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM asset_depreciation WHERE account_id = ?", account.ID)
+	if err != nil {
+		jsonError(w, "Failed to delete depreciation schedule", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Depreciation schedule not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, map[string]string{"message": "Depreciation schedule deleted successfully"}, http.StatusOK)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ATMWithdrawal moves cash from a debit account into a cash account. Both
+// sides are tagged as a cash withdrawal so reports don't count them as
+// spending; an optional ATM fee is recorded as a separate withdrawal from the
+// debit account, which is spending.
+func (h *TransactionHandler) ATMWithdrawal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ATMWithdrawalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Fee < 0 {
+		jsonError(w, "Fee cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	var fromType, toType models.AccountType
+	err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?", req.FromAccountID, userID, middleware.GetProfileID(ctx)).Scan(&fromType)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Source account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch source account", http.StatusInternalServerError)
+		return
+	}
+	err = h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?", req.ToAccountID, userID, middleware.GetProfileID(ctx)).Scan(&toType)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Destination account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch destination account", http.StatusInternalServerError)
+		return
+	}
+	if fromType != models.AccountTypeDebit || toType != models.AccountTypeCash {
+		jsonError(w, "ATM withdrawals go from a debit account to a cash account", http.StatusBadRequest)
+		return
+	}
+
+	description := req.Description
+	if description == "" {
+		description = "ATM withdrawal"
+	}
+	h.transfer(ctx, w, userID, models.TransferRequest{
+		FromAccountID: req.FromAccountID,
+		ToAccountID:   req.ToAccountID,
+		Amount:        req.Amount,
+		Description:   description,
+	}, transferOptions{
+		category:       models.CategoryCashWithdrawal,
+		fee:            req.Fee,
+		feeDescription: "ATM fee",
+	})
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type AttachmentHandler struct {
+	db  *sql.DB
+	ocr services.OCRProvider // nil disables receipt parsing
+}
+
+func NewAttachmentHandler(db *sql.DB, ocr services.OCRProvider) *AttachmentHandler {
+	return &AttachmentHandler{db: db, ocr: ocr}
+}
+
+// ReceiptProposal is what was read off a receipt, with a pre-filled
+// transaction the user can review and confirm by creating it
+type ReceiptProposal struct {
+	AttachmentID int64                           `json:"attachment_id"`
+	Receipt      services.ReceiptData            `json:"receipt"`
+	Text         string                          `json:"text"`
+	AccountID    *int64                          `json:"account_id,omitempty"`
+	Transaction  models.CreateTransactionRequest `json:"transaction"`
+}
+
+// Upload stores a receipt or other file sent as the multipart field "file",
+// optionally linked to one of the user's transactions (transaction_id)
+func (h *AttachmentHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxAttachmentSize+1<<20)
+	if err := r.ParseMultipartForm(models.MaxAttachmentSize); err != nil {
+		jsonError(w, fmt.Sprintf("Invalid upload: files must be at most %d MB", models.MaxAttachmentSize>>20), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		jsonError(w, "File is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxAttachmentSize+1))
+	if err != nil {
+		jsonError(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	if len(data) > models.MaxAttachmentSize {
+		jsonError(w, fmt.Sprintf("Files must be at most %d MB", models.MaxAttachmentSize>>20), http.StatusBadRequest)
+		return
+	}
+	if len(data) == 0 {
+		jsonError(w, "File is empty", http.StatusBadRequest)
+		return
+	}
+
+	// Trust the content, not the name or the declared type
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	allowed := false
+	for _, t := range models.AttachmentContentTypes {
+		if t == contentType {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		jsonError(w, "Unsupported file type: upload an image or a PDF", http.StatusBadRequest)
+		return
+	}
+
+	var transactionID *int64
+	if v := r.FormValue("transaction_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+		exists, err := transactionInProfile(ctx, h.db, id, userID)
+		if err != nil || !exists {
+			jsonError(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		transactionID = &id
+	}
+
+	filename := filepath.Base(header.Filename)
+	if filename == "." || filename == "/" {
+		filename = "receipt"
+	}
+
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO attachments (user_id, transaction_id, filename, content_type, size, data, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, transactionID, filename, contentType, len(data), data, now)
+	if err != nil {
+		jsonError(w, "Failed to store attachment", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	jsonResponse(w, models.Attachment{
+		ID:            id,
+		TransactionID: transactionID,
+		Filename:      filename,
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		CreatedAt:     now,
+	}, http.StatusCreated)
+}
+
+// List returns the user's attachments, newest first (transaction_id to
+// filter by transaction)
+func (h *AttachmentHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := "SELECT id, transaction_id, filename, content_type, size, created_at FROM attachments WHERE user_id = ?"
+	args := []interface{}{userID}
+	if v := r.URL.Query().Get("transaction_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid transaction ID", http.StatusBadRequest)
+			return
+		}
+		query += " AND transaction_id = ?"
+		args = append(args, id)
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		jsonError(w, "Failed to fetch attachments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.Attachment{}
+	for rows.Next() {
+		var a models.Attachment
+		var transactionID sql.NullInt64
+		if err := rows.Scan(&a.ID, &transactionID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+			continue
+		}
+		if transactionID.Valid {
+			a.TransactionID = &transactionID.Int64
+		}
+		attachments = append(attachments, a)
+	}
+
+	jsonResponse(w, attachments, http.StatusOK)
+}
+
+// Download returns an attachment's file
+func (h *AttachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+	attachment, data, ok := h.attachmentFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// Delete removes an attachment
+func (h *AttachmentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	attachment, _, ok := h.attachmentFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.db.ExecContext(ctx, "DELETE FROM attachments WHERE id = ?", attachment.ID); err != nil {
+		jsonError(w, "Failed to delete attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Parse reads a receipt image with the configured OCR provider and proposes
+// a transaction with the merchant as description and the total as amount.
+// Nothing is recorded until the user creates the transaction.
+func (h *AttachmentHandler) Parse(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if h.ocr == nil {
+		jsonError(w, "Receipt parsing is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	attachment, data, ok := h.attachmentFromURL(w, r)
+	if !ok {
+		return
+	}
+	if attachment.ContentType == "application/pdf" {
+		jsonError(w, "Only images can be parsed", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional
+	var req models.ParseReceiptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := middleware.GetUserID(ctx)
+	proposal := ReceiptProposal{AttachmentID: attachment.ID, AccountID: req.AccountID}
+	proposal.Transaction.Category = models.CategoryOther
+
+	if req.AccountID != nil {
+		var accountType models.AccountType
+		err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?",
+			*req.AccountID, userID, middleware.GetProfileID(ctx)).Scan(&accountType)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
+		switch accountType {
+		case models.AccountTypeCreditCard:
+			proposal.Transaction.Type = models.TransactionTypeExpense
+		case models.AccountTypeLoan:
+			jsonError(w, "Receipts can't be paid from a loan", http.StatusBadRequest)
+			return
+		default:
+			proposal.Transaction.Type = models.TransactionTypeWithdrawal
+		}
+	}
+
+	text, err := h.ocr.ExtractText(ctx, data, attachment.ContentType)
+	if err != nil {
+		log.Printf("Receipt OCR failed for attachment %d: %v", attachment.ID, err)
+		jsonError(w, "Failed to read the receipt", http.StatusBadGateway)
+		return
+	}
+
+	// US-style receipts put the month first
+	dayFirst := services.UserLocale(ctx, h.db, userID) != "en-US"
+	proposal.Text = text
+	proposal.Receipt = services.ParseReceipt(text, dayFirst)
+	proposal.Transaction.Description = proposal.Receipt.Merchant
+	if proposal.Receipt.Total != nil {
+		proposal.Transaction.Amount = *proposal.Receipt.Total
+	}
+
+	jsonResponse(w, proposal, http.StatusOK)
+}
+
+// attachmentFromURL loads the user's attachment in the URL with its data,
+// writing the error response when it isn't found
+func (h *AttachmentHandler) attachmentFromURL(w http.ResponseWriter, r *http.Request) (*models.Attachment, []byte, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid attachment ID", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	attachment, data, err := h.attachmentByID(r.Context(), id, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Attachment not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch attachment", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return attachment, data, true
+}
+
+func (h *AttachmentHandler) attachmentByID(ctx context.Context, id, userID int64) (*models.Attachment, []byte, error) {
+	var a models.Attachment
+	var transactionID sql.NullInt64
+	var data []byte
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, transaction_id, filename, content_type, size, data, created_at
+		FROM attachments WHERE id = ? AND user_id = ?
+	`, id, userID).Scan(&a.ID, &transactionID, &a.Filename, &a.ContentType, &a.Size, &data, &a.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if transactionID.Valid {
+		a.TransactionID = &transactionID.Int64
+	}
+	return &a, data, nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// AuditExportHandler reports on the audit export for the admin API
+type AuditExportHandler struct {
+	exporter *services.AuditExporter
+}
+
+func NewAuditExportHandler(exporter *services.AuditExporter) *AuditExportHandler {
+	return &AuditExportHandler{exporter: exporter}
+}
+
+// Status returns each sink's position in the audit log, how many events
+// it's behind and its last error; an empty list when nothing is exported
+func (h *AuditExportHandler) Status(w http.ResponseWriter, r *http.Request) {
+	statuses, err := h.exporter.Status(r.Context())
+	if err != nil {
+		jsonError(w, "Failed to read audit export status", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, statuses, http.StatusOK)
+}
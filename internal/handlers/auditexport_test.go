@@ -0,0 +1,172 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestAuditExport(t *testing.T) {
+	receiver := &webhookReceiver{status: http.StatusServiceUnavailable}
+	endpoint := httptest.NewServer(receiver)
+	defer endpoint.Close()
+
+	// A syslog server over TCP, reading octet-counted messages
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	messages := make(chan string, 100)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil {
+				return
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				return
+			}
+			messages <- string(msg)
+		}
+	}()
+
+	env := map[string]string{
+		"AUDIT_SYSLOG_ADDR":    "tcp://" + listener.Addr().String(),
+		"AUDIT_WEBHOOK_URL":    endpoint.URL,
+		"AUDIT_WEBHOOK_SECRET": "audit-secret",
+	}
+	sinks, err := services.AuditSinksFromEnv(func(key string) string { return env[key] })
+	if err != nil || len(sinks) != 2 {
+		t.Fatalf("AuditSinksFromEnv = %v, %v", sinks, err)
+	}
+	cfg := testutil.DefaultConfig()
+	cfg.AdminEmails = []string{"admin@example.com"}
+	cfg.AuditSinks = sinks
+	app := testutil.NewAppWithConfig(t, cfg)
+	exporter := app.Server.AuditExport
+	ctx := context.Background()
+
+	// Events from before the sinks were added aren't sent
+	admin := app.Register(t, "admin@example.com")
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if receiver.count() != 0 {
+		t.Fatalf("%d deliveries of the history, want none", receiver.count())
+	}
+
+	app.Register(t, "ana@example.com")
+	app.Client(t).Login("ana@example.com", testutil.Password).Expect(http.StatusOK)
+
+	// The webhook is down: its events wait while syslog gets them
+	if err := exporter.Flush(ctx); err == nil {
+		t.Fatal("flush succeeded with the webhook down")
+	}
+	var statuses []models.AuditSinkStatus
+	admin.Get("/api/admin/audit-export").Expect(http.StatusOK).Decode(&statuses)
+	byName := map[string]models.AuditSinkStatus{}
+	for _, s := range statuses {
+		byName[s.Sink] = s
+	}
+	if s := byName["webhook"]; s.Pending != 2 || s.Failures != 1 || !strings.Contains(s.LastError, "503") || s.LastSuccessAt != nil {
+		t.Errorf("webhook status = %+v, want 2 pending after 1 failure", s)
+	}
+	if s := byName["syslog"]; s.Pending != 0 || s.Failures != 0 || s.LastSuccessAt == nil {
+		t.Errorf("syslog status = %+v, want nothing pending", s)
+	}
+	app.Client(t).Login("ana@example.com", testutil.Password).Expect(http.StatusOK)
+	app.Client(t).Get("/api/admin/audit-export").Expect(http.StatusUnauthorized)
+
+	for _, action := range []string{"registered", "logged_in"} {
+		select {
+		case msg := <-messages:
+			if !strings.HasPrefix(msg, "<38>1 ") || !strings.Contains(msg, " odin-wallet ") ||
+				!strings.Contains(msg, `"action":"`+action+`"`) || !strings.Contains(msg, `"user_email":"ana@example.com"`) {
+				t.Errorf("syslog message = %q, want the %s event", msg, action)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no syslog message for %s", action)
+		}
+	}
+
+	// Back up, the webhook gets what it missed in order, signed
+	receiver.mu.Lock()
+	receiver.status = http.StatusOK
+	receiver.mu.Unlock()
+	if err := exporter.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	receiver.mu.Lock()
+	body, signature := receiver.bodies[len(receiver.bodies)-1], receiver.signatures[len(receiver.signatures)-1]
+	receiver.mu.Unlock()
+	var delivery struct {
+		Events []models.ExportedAuditEvent `json:"events"`
+	}
+	if err := json.Unmarshal(body, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if len(delivery.Events) != 3 || delivery.Events[0].Action != "registered" || delivery.Events[2].Action != "logged_in" ||
+		delivery.Events[0].ID >= delivery.Events[1].ID {
+		t.Fatalf("delivered %+v, want the 3 missed events in order", delivery.Events)
+	}
+	timestamp, sig, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",v1=")
+	mac := hmac.New(sha256.New, []byte("audit-secret"))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if sig != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("signature %q doesn't match the body", signature)
+	}
+
+	statuses = nil
+	admin.Get("/api/admin/audit-export").Expect(http.StatusOK).Decode(&statuses)
+	for _, s := range statuses {
+		if s.Pending != 0 || s.Failures != 0 || s.LastError != "" {
+			t.Errorf("%s status = %+v, want caught up", s.Sink, s)
+		}
+	}
+
+	// Running, events go out as they're recorded
+	app.Server.Start(ctx)
+	defer app.Server.Stop(ctx)
+	delivered := receiver.count()
+	app.Client(t).Login("ana@example.com", testutil.Password).Expect(http.StatusOK)
+	deadline := time.Now().Add(5 * time.Second)
+	for receiver.count() == delivered {
+		if time.Now().After(deadline) {
+			t.Fatal("login not exported while running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	env["AUDIT_SYSLOG_ADDR"] = "logs.example.com:514"
+	if _, err := services.AuditSinksFromEnv(func(key string) string { return env[key] }); err == nil {
+		t.Error("syslog address without a scheme accepted")
+	}
+}
@@ -1,31 +1,86 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/kengru/odin-wallet/internal/middleware"
 	"github.com/kengru/odin-wallet/internal/models"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/kengru/odin-wallet/internal/services"
 )
 
 type AuthHandler struct {
 	db            *sql.DB
 	sessionSecret string
+	registration  models.RegistrationMode
+	adminEmails   map[string]bool
+	audit         *services.AuditService
+	sessions      middleware.SessionStore
 }
 
-func NewAuthHandler(db *sql.DB, sessionSecret string) *AuthHandler {
+func NewAuthHandler(db *sql.DB, sessions middleware.SessionStore, sessionSecret string, registration models.RegistrationMode, adminEmails []string, audit *services.AuditService) *AuthHandler {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		admins[email] = true
+	}
 	return &AuthHandler{
 		db:            db,
 		sessionSecret: sessionSecret,
+		registration:  registration,
+		adminEmails:   admins,
+		audit:         audit,
+		sessions:      sessions,
+	}
+}
+
+// RegistrationInfo reports whether registration needs an invite and, given
+// ?invite=, whether that invite can still be used
+func (h *AuthHandler) RegistrationInfo(w http.ResponseWriter, r *http.Request) {
+	info := models.RegistrationInfo{Mode: h.registration}
+	if token := r.URL.Query().Get("invite"); token != "" {
+		inviteID, email, err := h.validInvite(r.Context(), token)
+		if err != nil {
+			jsonError(w, "Failed to check invite", http.StatusInternalServerError)
+			return
+		}
+		valid := inviteID != 0
+		info.InviteValid = &valid
+		info.InviteEmail = email
+	}
+	jsonResponse(w, info, http.StatusOK)
+}
+
+// validInvite returns the ID of the unused, unexpired invite with the given
+// token and the email it's restricted to, or 0 when there is none
+func (h *AuthHandler) validInvite(ctx context.Context, token string) (int64, *string, error) {
+	var id int64
+	var email sql.NullString
+	var expiresAt time.Time
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, email, expires_at FROM invites WHERE token_hash = ? AND used_at IS NULL
+	`, hashInviteToken(token)).Scan(&id, &email, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if email.Valid {
+		return id, &email.String, nil
 	}
+	return id, nil, nil
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var req models.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "Invalid request body", http.StatusBadRequest)
@@ -45,17 +100,47 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Invite-only instances let in configured admins and invited people
+	isAdmin := h.adminEmails[req.Email]
+	var inviteID int64
+	if h.registration == models.RegistrationInvite && !isAdmin {
+		var inviteEmail *string
+		var err error
+		if req.InviteToken != "" {
+			inviteID, inviteEmail, err = h.validInvite(ctx, req.InviteToken)
+			if err != nil {
+				jsonError(w, "Failed to check invite", http.StatusInternalServerError)
+				return
+			}
+		}
+		if inviteID == 0 {
+			jsonError(w, "Registration requires a valid invite", http.StatusForbidden)
+			return
+		}
+		if inviteEmail != nil && *inviteEmail != req.Email {
+			jsonError(w, "This invite is for a different email address", http.StatusForbidden)
+			return
+		}
+	}
+
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := services.HashPassword(req.Password)
 	if err != nil {
 		jsonError(w, "Failed to process password", http.StatusInternalServerError)
 		return
 	}
 
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
 	// Insert user
-	result, err := h.db.Exec(
-		"INSERT INTO users (email, password_hash) VALUES (?, ?)",
-		req.Email, string(hashedPassword),
+	result, err := tx.ExecContext(ctx,
+		"INSERT INTO users (email, password_hash, is_admin) VALUES (?, ?, ?)",
+		req.Email, hashedPassword, isAdmin,
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
@@ -68,8 +153,28 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	userID, _ := result.LastInsertId()
 
+	// Use up the invite, unless someone else registered with it meanwhile
+	if inviteID != 0 {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE invites SET used_at = ?, used_by = ? WHERE id = ? AND used_at IS NULL
+		`, time.Now(), userID, inviteID)
+		if err != nil {
+			jsonError(w, "Failed to create user", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			jsonError(w, "Registration requires a valid invite", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
 	// Create session
-	sessionID, err := h.createSession(userID)
+	sessionID, err := h.createSession(ctx, userID)
 	if err != nil {
 		jsonError(w, "Failed to create session", http.StatusInternalServerError)
 		return
@@ -78,11 +183,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Set session cookie
 	h.setSessionCookie(w, sessionID)
 
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:    userID,
+		Type:      models.ActivityLogin,
+		Action:    "registered",
+		Summary:   "Registered",
+		IPAddress: services.ClientIP(r),
+	})
+
 	// Return user
 	user := &models.User{
 		ID:                userID,
 		Email:             req.Email,
 		PreferredCurrency: "DOP", // Default
+		Locale:            services.DefaultLocale,
+		MonthStartDay:     1,
+		IsAdmin:           isAdmin,
 	}
 
 	jsonResponse(w, models.AuthResponse{
@@ -92,50 +208,20 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	var req models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
-
-	// Find user
-	var user models.User
-	var name sql.NullString
-	var preferredCurrency sql.NullString
-	var onboardingCompleted sql.NullInt64
-	err := h.db.QueryRow(
-		"SELECT id, email, name, preferred_currency, onboarding_completed, password_hash, created_at FROM users WHERE email = ?",
-		req.Email,
-	).Scan(&user.ID, &user.Email, &name, &preferredCurrency, &onboardingCompleted, &user.PasswordHash, &user.CreatedAt)
-
-	if err == sql.ErrNoRows {
-		jsonError(w, "Invalid email or password", http.StatusUnauthorized)
-		return
-	}
-	if err != nil {
-		jsonError(w, "Failed to find user", http.StatusInternalServerError)
-		return
-	}
-
-	if name.Valid {
-		user.Name = &name.String
-	}
-	user.PreferredCurrency = "DOP" // Default
-	if preferredCurrency.Valid {
-		user.PreferredCurrency = preferredCurrency.String
-	}
-	user.OnboardingCompleted = onboardingCompleted.Valid && onboardingCompleted.Int64 == 1
-
-	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		jsonError(w, "Invalid email or password", http.StatusUnauthorized)
+	user, ok := h.checkCredentials(w, r, req.Email, req.Password)
+	if !ok {
 		return
 	}
 
 	// Create session
-	sessionID, err := h.createSession(user.ID)
+	sessionID, err := h.createSession(ctx, user.ID)
 	if err != nil {
 		jsonError(w, "Failed to create session", http.StatusInternalServerError)
 		return
@@ -144,17 +230,85 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// Set session cookie
 	h.setSessionCookie(w, sessionID)
 
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:    user.ID,
+		Type:      models.ActivityLogin,
+		Action:    "logged_in",
+		Summary:   "Logged in",
+		IPAddress: services.ClientIP(r),
+	})
+
 	jsonResponse(w, models.AuthResponse{
-		User:    &user,
+		User:    user,
 		Message: "Login successful",
 	}, http.StatusOK)
 }
 
+// checkCredentials finds the user with the given email and verifies their
+// password, upgrading its hash when needed. It writes the error response
+// when the credentials don't match.
+func (h *AuthHandler) checkCredentials(w http.ResponseWriter, r *http.Request, email, password string) (*models.User, bool) {
+	ctx := r.Context()
+	email = strings.TrimSpace(strings.ToLower(email))
+
+	// Find user
+	var passwordHash string
+	user, err := scanUser(h.db.QueryRowContext(ctx,
+		"SELECT "+userColumns+", password_hash FROM users WHERE email = ?",
+		email,
+	), &passwordHash)
+
+	if err == sql.ErrNoRows {
+		jsonError(w, "Invalid email or password", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to find user", http.StatusInternalServerError)
+		return nil, false
+	}
+	user.PasswordHash = passwordHash
+
+	// Verify password
+	if !services.CheckPassword(user.PasswordHash, password) {
+		h.audit.Record(ctx, models.AuditEvent{
+			UserID:    user.ID,
+			Type:      models.ActivityLogin,
+			Action:    "login_failed",
+			Summary:   "Failed login attempt",
+			IPAddress: services.ClientIP(r),
+		})
+		jsonError(w, "Invalid email or password", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Upgrade bcrypt and outdated argon2id hashes now that we have the
+	// plaintext; a failure here shouldn't block the login
+	if services.NeedsRehash(user.PasswordHash) {
+		if rehashed, err := services.HashPassword(password); err == nil {
+			if _, err := h.db.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", rehashed, user.ID); err != nil {
+				log.Printf("Warning: Failed to rehash password for user %d: %v", user.ID, err)
+			}
+		}
+	}
+	return user, true
+}
+
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	cookie, err := r.Cookie("session_id")
 	if err == nil {
-		// Delete session from database
-		h.db.Exec("DELETE FROM sessions WHERE id = ?", cookie.Value)
+		if session, err := h.sessions.Get(ctx, cookie.Value); err == nil {
+			h.audit.Record(ctx, models.AuditEvent{
+				UserID:    session.UserID,
+				Type:      models.ActivityLogin,
+				Action:    "logged_out",
+				Summary:   "Logged out",
+				IPAddress: services.ClientIP(r),
+			})
+		}
+
+		// Delete session
+		h.sessions.Delete(ctx, cookie.Value)
 	}
 
 	// Clear cookie
@@ -171,6 +325,26 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if token, ok := middleware.BearerToken(r); ok {
+		userID, err := middleware.AccessTokenUser(ctx, h.db, h.sessionSecret, token)
+		if errors.Is(err, middleware.ErrInvalidAccessToken) || errors.Is(err, middleware.ErrAccessTokenExpired) {
+			jsonError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to validate access token", http.StatusInternalServerError)
+			return
+		}
+		user, err := scanUser(h.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", userID))
+		if err != nil {
+			jsonError(w, "Failed to get user", http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, models.AuthResponse{User: user}, http.StatusOK)
+		return
+	}
+
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
 		jsonError(w, "Not authenticated", http.StatusUnauthorized)
@@ -178,47 +352,38 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Find session and user
-	var user models.User
-	var name sql.NullString
-	var preferredCurrency sql.NullString
-	var onboardingCompleted sql.NullInt64
-	var expiresAt time.Time
-	err = h.db.QueryRow(`
-		SELECT u.id, u.email, u.name, u.preferred_currency, u.onboarding_completed, u.created_at, s.expires_at
-		FROM users u
-		JOIN sessions s ON u.id = s.user_id
-		WHERE s.id = ?
-	`, cookie.Value).Scan(&user.ID, &user.Email, &name, &preferredCurrency, &onboardingCompleted, &user.CreatedAt, &expiresAt)
-
-	if err == sql.ErrNoRows {
+	session, err := h.sessions.Get(ctx, cookie.Value)
+	if errors.Is(err, middleware.ErrSessionNotFound) {
 		jsonError(w, "Session not found", http.StatusUnauthorized)
 		return
 	}
 	if err != nil {
-		jsonError(w, "Failed to get user", http.StatusInternalServerError)
+		jsonError(w, "Failed to get session", http.StatusInternalServerError)
 		return
 	}
 
 	// Check if session expired
-	if time.Now().After(expiresAt) {
-		h.db.Exec("DELETE FROM sessions WHERE id = ?", cookie.Value)
+	if time.Now().After(session.ExpiresAt) {
+		h.sessions.Delete(ctx, cookie.Value)
 		jsonError(w, "Session expired", http.StatusUnauthorized)
 		return
 	}
 
-	if name.Valid {
-		user.Name = &name.String
+	user, err := scanUser(h.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", session.UserID))
+	if err == sql.ErrNoRows {
+		jsonError(w, "Session not found", http.StatusUnauthorized)
+		return
 	}
-	user.PreferredCurrency = "DOP" // Default
-	if preferredCurrency.Valid {
-		user.PreferredCurrency = preferredCurrency.String
+	if err != nil {
+		jsonError(w, "Failed to get user", http.StatusInternalServerError)
+		return
 	}
-	user.OnboardingCompleted = onboardingCompleted.Valid && onboardingCompleted.Int64 == 1
 
-	jsonResponse(w, models.AuthResponse{User: &user}, http.StatusOK)
+	jsonResponse(w, models.AuthResponse{User: user}, http.StatusOK)
 }
 
 func (h *AuthHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
 		jsonError(w, "Not authenticated", http.StatusUnauthorized)
@@ -226,13 +391,8 @@ func (h *AuthHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get user ID from session
-	var userID int64
-	var expiresAt time.Time
-	err = h.db.QueryRow(`
-		SELECT user_id, expires_at FROM sessions WHERE id = ?
-	`, cookie.Value).Scan(&userID, &expiresAt)
-
-	if err == sql.ErrNoRows {
+	session, err := h.sessions.Get(ctx, cookie.Value)
+	if errors.Is(err, middleware.ErrSessionNotFound) {
 		jsonError(w, "Session not found", http.StatusUnauthorized)
 		return
 	}
@@ -241,10 +401,11 @@ func (h *AuthHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if time.Now().After(expiresAt) {
+	if time.Now().After(session.ExpiresAt) {
 		jsonError(w, "Session expired", http.StatusUnauthorized)
 		return
 	}
+	userID := session.UserID
 
 	// Parse request
 	var req models.UpdatePreferencesRequest
@@ -280,6 +441,47 @@ func (h *AuthHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request)
 		args = append(args, *req.PreferredCurrency)
 	}
 
+	if req.Locale != nil {
+		if !services.IsValidLocale(*req.Locale) {
+			jsonError(w, "Invalid locale. Must be one of "+strings.Join(services.SupportedLocales(), ", "), http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "locale = ?")
+		args = append(args, *req.Locale)
+	}
+
+	if req.WeekStart != nil {
+		if *req.WeekStart < 0 || *req.WeekStart > 6 {
+			jsonError(w, "Invalid week start. Must be 0 (Sunday) to 6 (Saturday)", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "week_start = ?")
+		args = append(args, *req.WeekStart)
+	}
+
+	if req.MonthStartDay != nil {
+		if *req.MonthStartDay < 1 || *req.MonthStartDay > models.MaxMonthStartDay {
+			jsonError(w, "Invalid month start day. Must be between 1 and 28", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "month_start_day = ?")
+		args = append(args, *req.MonthStartDay)
+	}
+
+	if req.TelemetryOptIn != nil {
+		updates = append(updates, "telemetry_opt_in = ?")
+		args = append(args, *req.TelemetryOptIn)
+	}
+
+	if req.BudgetMode != nil {
+		if !req.BudgetMode.IsValid() {
+			jsonError(w, "Invalid budget mode. Must be standard or zero_based", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "budget_mode = ?")
+		args = append(args, string(*req.BudgetMode))
+	}
+
 	if len(updates) == 0 {
 		jsonError(w, "No fields to update", http.StatusBadRequest)
 		return
@@ -289,40 +491,27 @@ func (h *AuthHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request)
 	query := "UPDATE users SET " + strings.Join(updates, ", ") + " WHERE id = ?"
 	args = append(args, userID)
 
-	_, err = h.db.Exec(query, args...)
+	_, err = h.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		jsonError(w, "Failed to update preferences", http.StatusInternalServerError)
 		return
 	}
 
 	// Fetch updated user
-	var user models.User
-	var name sql.NullString
-	var preferredCurrency sql.NullString
-	err = h.db.QueryRow(`
-		SELECT id, email, name, preferred_currency, created_at FROM users WHERE id = ?
-	`, userID).Scan(&user.ID, &user.Email, &name, &preferredCurrency, &user.CreatedAt)
-
+	user, err := scanUser(h.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", userID))
 	if err != nil {
 		jsonError(w, "Failed to fetch updated user", http.StatusInternalServerError)
 		return
 	}
 
-	if name.Valid {
-		user.Name = &name.String
-	}
-	user.PreferredCurrency = "DOP"
-	if preferredCurrency.Valid {
-		user.PreferredCurrency = preferredCurrency.String
-	}
-
 	jsonResponse(w, models.AuthResponse{
-		User:    &user,
+		User:    user,
 		Message: "Preferences updated successfully",
 	}, http.StatusOK)
 }
 
 func (h *AuthHandler) CompleteOnboarding(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
 		jsonError(w, "Not authenticated", http.StatusUnauthorized)
@@ -330,13 +519,8 @@ func (h *AuthHandler) CompleteOnboarding(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Get user ID from session
-	var userID int64
-	var expiresAt time.Time
-	err = h.db.QueryRow(`
-		SELECT user_id, expires_at FROM sessions WHERE id = ?
-	`, cookie.Value).Scan(&userID, &expiresAt)
-
-	if err == sql.ErrNoRows {
+	session, err := h.sessions.Get(ctx, cookie.Value)
+	if errors.Is(err, middleware.ErrSessionNotFound) {
 		jsonError(w, "Session not found", http.StatusUnauthorized)
 		return
 	}
@@ -345,13 +529,14 @@ func (h *AuthHandler) CompleteOnboarding(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if time.Now().After(expiresAt) {
+	if time.Now().After(session.ExpiresAt) {
 		jsonError(w, "Session expired", http.StatusUnauthorized)
 		return
 	}
+	userID := session.UserID
 
 	// Update onboarding_completed
-	_, err = h.db.Exec("UPDATE users SET onboarding_completed = 1 WHERE id = ?", userID)
+	_, err = h.db.ExecContext(ctx, "UPDATE users SET onboarding_completed = 1 WHERE id = ?", userID)
 	if err != nil {
 		jsonError(w, "Failed to update onboarding status", http.StatusInternalServerError)
 		return
@@ -360,7 +545,7 @@ func (h *AuthHandler) CompleteOnboarding(w http.ResponseWriter, r *http.Request)
 	jsonResponse(w, map[string]string{"message": "Onboarding completed"}, http.StatusOK)
 }
 
-func (h *AuthHandler) createSession(userID int64) (string, error) {
+func (h *AuthHandler) createSession(ctx context.Context, userID int64) (string, error) {
 	// Generate session ID
 	bytes := make([]byte, 32)
 	if _, err := rand.Read(bytes); err != nil {
@@ -371,21 +556,14 @@ func (h *AuthHandler) createSession(userID int64) (string, error) {
 	// Session expires in 7 days
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
 
-	// Insert session
-	_, err := h.db.Exec(
-		"INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)",
-		sessionID, userID, expiresAt,
-	)
-	if err != nil {
+	if err := h.sessions.Create(ctx, middleware.Session{ID: sessionID, UserID: userID, ExpiresAt: expiresAt}); err != nil {
 		return "", err
 	}
 
 	// Clean up old sessions for this user (keep last 5)
-	h.db.Exec(`
-		DELETE FROM sessions WHERE user_id = ? AND id NOT IN (
-			SELECT id FROM sessions WHERE user_id = ? ORDER BY created_at DESC LIMIT 5
-		)
-	`, userID, userID)
+	if _, err := h.sessions.Prune(ctx, userID, 5); err != nil {
+		log.Printf("Warning: Failed to prune sessions of user %d: %v", userID, err)
+	}
 
 	return sessionID, nil
 }
@@ -402,6 +580,52 @@ func (h *AuthHandler) setSessionCookie(w http.ResponseWriter, sessionID string)
 	})
 }
 
+// userColumns is the column list expected by scanUser
+const userColumns = "users.id, users.email, users.name, users.preferred_currency, users.locale, users.week_start, users.month_start_day, users.onboarding_completed, users.is_admin, users.telemetry_opt_in, users.budget_mode, users.created_at"
+
+// scanUser scans a row selected with userColumns. Any extra destinations are
+// scanned from the columns following userColumns.
+func scanUser(row rowScanner, extra ...interface{}) (*models.User, error) {
+	var user models.User
+	var name sql.NullString
+	var preferredCurrency, locale, budgetMode sql.NullString
+	var weekStart, monthStartDay sql.NullInt64
+	var onboardingCompleted, isAdmin, telemetryOptIn sql.NullInt64
+	dest := []interface{}{
+		&user.ID, &user.Email, &name, &preferredCurrency, &locale, &weekStart, &monthStartDay, &onboardingCompleted,
+		&isAdmin, &telemetryOptIn, &budgetMode, &user.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if name.Valid {
+		user.Name = &name.String
+	}
+	user.PreferredCurrency = "DOP" // Default
+	if preferredCurrency.Valid && preferredCurrency.String != "" {
+		user.PreferredCurrency = preferredCurrency.String
+	}
+	user.Locale = services.DefaultLocale
+	if locale.Valid && services.IsValidLocale(locale.String) {
+		user.Locale = locale.String
+	}
+	user.WeekStart = int(weekStart.Int64)
+	user.MonthStartDay = 1
+	if monthStartDay.Valid && monthStartDay.Int64 >= 1 {
+		user.MonthStartDay = int(monthStartDay.Int64)
+	}
+	user.OnboardingCompleted = onboardingCompleted.Valid && onboardingCompleted.Int64 == 1
+	user.IsAdmin = isAdmin.Valid && isAdmin.Int64 == 1
+	user.TelemetryOptIn = telemetryOptIn.Valid && telemetryOptIn.Int64 == 1
+	user.BudgetMode = models.BudgetModeStandard
+	if mode := models.BudgetMode(budgetMode.String); mode.IsValid() {
+		user.BudgetMode = mode
+	}
+
+	return &user, nil
+}
+
 // Helper functions for JSON responses
 func jsonResponse(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -412,3 +636,9 @@ func jsonResponse(w http.ResponseWriter, data interface{}, status int) {
 func jsonError(w http.ResponseWriter, message string, status int) {
 	jsonResponse(w, map[string]string{"error": message}, status)
 }
+
+// NotFound answers API paths that match no route, so clients get JSON
+// instead of the SPA's index.html
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	jsonError(w, "Not found", http.StatusNotFound)
+}
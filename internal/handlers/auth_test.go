@@ -0,0 +1,128 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	appMiddleware "github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestRegisterLoginLogout(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+	if c.User == nil || c.User.Email != "ana@example.com" {
+		t.Fatalf("registered user = %+v, want ana@example.com", c.User)
+	}
+
+	var me models.AuthResponse
+	c.Get("/api/auth/me").Expect(http.StatusOK).Decode(&me)
+	if me.User.ID != c.User.ID {
+		t.Errorf("me = user %d, want %d", me.User.ID, c.User.ID)
+	}
+
+	c.Post("/api/auth/logout", nil).Expect(http.StatusOK)
+	c.Get("/api/auth/me").Expect(http.StatusUnauthorized)
+	c.Get("/api/accounts").Expect(http.StatusUnauthorized)
+
+	if msg := c.Login("ana@example.com", "wrong-password").Expect(http.StatusUnauthorized).Error(); msg != "Invalid email or password" {
+		t.Errorf("wrong password error = %q", msg)
+	}
+	c.Login("ana@example.com", testutil.Password).Expect(http.StatusOK)
+	c.Get("/api/auth/me").Expect(http.StatusOK)
+}
+
+func TestRegisterDuplicateEmail(t *testing.T) {
+	app := testutil.NewApp(t)
+	app.Register(t, "ana@example.com")
+
+	resp := app.Client(t).Post("/api/auth/register", models.RegisterRequest{Email: "ana@example.com", Password: testutil.Password})
+	resp.Expect(http.StatusConflict)
+}
+
+func TestProtectedRoutesNeedSession(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Client(t)
+
+	for _, path := range []string{"/api/accounts", "/api/overview", "/api/notifications", "/api/bills"} {
+		c.Get(path).Expect(http.StatusUnauthorized)
+	}
+}
+
+func TestCachedSessionEndsOnLogout(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+
+	// The first request caches the session
+	c.Get("/api/accounts").Expect(http.StatusOK)
+	c.Get("/api/accounts").Expect(http.StatusOK)
+
+	c.Post("/api/auth/logout", nil).Expect(http.StatusOK)
+	c.Get("/api/accounts").Expect(http.StatusUnauthorized)
+}
+
+func TestCachedSessionEndsOnErase(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+	other := app.Client(t)
+	other.Login("ana@example.com", testutil.Password).Expect(http.StatusOK)
+	other.Get("/api/accounts").Expect(http.StatusOK)
+
+	c.Do(http.MethodDelete, "/api/auth/me", models.DeleteAccountRequest{Password: testutil.Password}).Expect(http.StatusOK)
+	other.Get("/api/accounts").Expect(http.StatusUnauthorized)
+}
+
+func TestRedisSessionsSharedByServers(t *testing.T) {
+	rdb := testutil.NewRedis(t)
+	env := map[string]string{"SESSION_STORE": "redis", "REDIS_URL": rdb.URL}
+	store, err := appMiddleware.RedisSessionStoreFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testutil.DefaultConfig()
+	cfg.SessionStore = store
+	app := testutil.NewAppWithConfig(t, cfg)
+	peer := app.Peer(t, cfg)
+
+	c := app.Register(t, "ana@example.com")
+	var me models.AuthResponse
+	c.On(peer).Get("/api/auth/me").Expect(http.StatusOK).Decode(&me)
+	if me.User.ID != c.User.ID {
+		t.Errorf("me on the other server = user %d, want %d", me.User.ID, c.User.ID)
+	}
+	c.On(peer).Get("/api/accounts").Expect(http.StatusOK)
+	var rows int
+	app.DB.QueryRow("SELECT COUNT(*) FROM sessions").Scan(&rows)
+	if rows != 0 {
+		t.Errorf("%d sessions in the database, want them all in Redis", rows)
+	}
+
+	// Signing out on one server signs out on the other
+	c.On(peer).Post("/api/auth/logout", nil).Expect(http.StatusOK)
+	c.Get("/api/auth/me").Expect(http.StatusUnauthorized)
+
+	// Only the newest 5 sessions are kept
+	var clients []*testutil.Client
+	for i := 0; i < 6; i++ {
+		client := app.Client(t)
+		client.Login("ana@example.com", testutil.Password).Expect(http.StatusOK)
+		clients = append(clients, client)
+	}
+	clients[0].Get("/api/accounts").Expect(http.StatusUnauthorized)
+	clients[1].On(peer).Get("/api/accounts").Expect(http.StatusOK)
+	if keys := rdb.Keys(); len(keys) != 6 {
+		t.Errorf("Redis keys = %v, want 5 sessions and the user's set", keys)
+	}
+
+	clients[5].On(peer).Do(http.MethodDelete, "/api/auth/me", models.DeleteAccountRequest{Password: testutil.Password}).Expect(http.StatusOK)
+	clients[1].Get("/api/accounts").Expect(http.StatusUnauthorized)
+	if keys := rdb.Keys(); len(keys) != 0 {
+		t.Errorf("Redis keys after erasing the user = %v, want none", keys)
+	}
+
+	env["SESSION_STORE"] = "memcached"
+	if _, err := appMiddleware.RedisSessionStoreFromEnv(func(key string) string { return env[key] }); err == nil {
+		t.Error("unknown session store accepted")
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// maxBalanceAttempts bounds how often a balance write that lost a race is
+// re-read and retried before the request fails with 409 Conflict
+const maxBalanceAttempts = 3
+
+// errBalanceConflict means the account changed between reading its balance
+// and writing the new one
+var errBalanceConflict = errors.New("account was modified concurrently")
+
+// balanceColumn is the accounts column holding an account type's balance
+func balanceColumn(accountType models.AccountType) string {
+	switch accountType {
+	case models.AccountTypeCreditCard:
+		return "credit_owed"
+	case models.AccountTypeLoan:
+		return "loan_current_owed"
+	default:
+		return "current_balance"
+	}
+}
+
+// setBalance writes an account's balance if its version is still the one read
+// along with the old balance, and bumps the version. The account lock only
+// serializes writers in this process; the version also catches writes from
+// other processes sharing the database.
+func setBalance(ctx context.Context, tx *sql.Tx, accountID int64, accountType models.AccountType, balance float64, version int64) error {
+	result, err := tx.ExecContext(ctx,
+		"UPDATE accounts SET "+balanceColumn(accountType)+" = ?, version = version + 1, updated_at = ? WHERE id = ? AND version = ?",
+		balance, time.Now(), accountID, version)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return errBalanceConflict
+	}
+	return nil
+}
+
+// balanceConflict reports a balance write that kept losing races
+func balanceConflict(w http.ResponseWriter) {
+	jsonError(w, "Account was modified by another request, please retry", http.StatusConflict)
+}
+
+// checkBalanceAlerts evaluates the balance alerts of accounts whose balance
+// just changed. Failures are logged; they never fail the balance write.
+func checkBalanceAlerts(ctx context.Context, alerts *services.BalanceAlertService, accountIDs ...int64) {
+	if alerts == nil {
+		return
+	}
+	for _, id := range accountIDs {
+		if err := alerts.Check(ctx, id); err != nil {
+			log.Printf("Balance alert check failed for account %d: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// balanceSignatureTolerance is how far a balance update's signature time may
+// be from the server's clock
+const balanceSignatureTolerance = 5 * time.Minute
+
+// BalanceFeedHandler maps accounts to balance feeds and receives the
+// balances they push, reconciling the account to each one
+type BalanceFeedHandler struct {
+	db       *sql.DB
+	accounts *AccountHandler
+	features *services.FeatureFlags
+}
+
+func NewBalanceFeedHandler(db *sql.DB, accounts *AccountHandler, features *services.FeatureFlags) *BalanceFeedHandler {
+	return &BalanceFeedHandler{db: db, accounts: accounts, features: features}
+}
+
+// List returns the balance feeds of the active profile's accounts, without
+// their secrets
+func (h *BalanceFeedHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT f.id, f.account_id, f.name, f.last_balance, f.last_received_at, f.created_at
+		FROM balance_feeds f
+		JOIN accounts a ON f.account_id = a.id
+		WHERE f.user_id = ? AND a.profile_id = ?
+		ORDER BY f.created_at DESC, f.id DESC
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to fetch balance feeds", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	feeds := []models.BalanceFeed{}
+	for rows.Next() {
+		var f models.BalanceFeed
+		var lastBalance sql.NullFloat64
+		var lastReceivedAt sql.NullTime
+		if err := rows.Scan(&f.ID, &f.AccountID, &f.Name, &lastBalance, &lastReceivedAt, &f.CreatedAt); err != nil {
+			continue
+		}
+		if lastBalance.Valid {
+			f.LastBalance = &lastBalance.Float64
+		}
+		if lastReceivedAt.Valid {
+			f.LastReceivedAt = &lastReceivedAt.Time
+		}
+		feeds = append(feeds, f)
+	}
+
+	jsonResponse(w, feeds, http.StatusOK)
+}
+
+// Create maps an account to a new balance feed. The signing secret is only
+// shown in this response.
+func (h *BalanceFeedHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateBalanceFeedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Normalize(); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.accounts.getAccountByID(ctx, req.AccountID, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+	if account.Type == models.AccountTypeAsset {
+		jsonError(w, "Record a valuation to change an asset's value", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	if err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM balance_feeds WHERE account_id = ?", account.ID).Scan(&exists); err != nil {
+		jsonError(w, "Failed to create balance feed", http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		jsonError(w, "Account already has a balance feed", http.StatusConflict)
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		jsonError(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO balance_feeds (user_id, account_id, name, secret, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, account.ID, req.Name, services.EncryptField(userID, secret), now)
+	if err != nil {
+		jsonError(w, "Failed to create balance feed", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	jsonResponse(w, models.BalanceFeed{
+		ID:        id,
+		AccountID: account.ID,
+		Name:      req.Name,
+		Secret:    secret,
+		CreatedAt: now,
+	}, http.StatusCreated)
+}
+
+// Delete stops a balance feed. Balances it already pushed stay recorded.
+func (h *BalanceFeedHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid balance feed ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		DELETE FROM balance_feeds
+		WHERE id = ? AND user_id = ? AND account_id IN (SELECT id FROM accounts WHERE profile_id = ?)
+	`, id, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to delete balance feed", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Balance feed not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Receive takes a balance pushed by a feed and records the difference from
+// the account's balance as an adjustment, so the ledger adds up to it. The
+// request is signed like report webhook deliveries: the X-Wallet-Signature
+// header is "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">" with the
+// feed's secret. Updates signed before the last accepted one are refused.
+func (h *BalanceFeedHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var req models.BalanceUpdateRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var userID, accountID, profileID int64
+	var name, secret string
+	var lastSignedAt sql.NullInt64
+	err = h.db.QueryRowContext(ctx, `
+		SELECT f.user_id, f.account_id, f.name, f.secret, f.last_signed_at, a.profile_id
+		FROM balance_feeds f
+		JOIN accounts a ON f.account_id = a.id
+		WHERE f.id = ?
+	`, req.FeedID).Scan(&userID, &accountID, &name, &secret, &lastSignedAt, &profileID)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch balance feed", http.StatusInternalServerError)
+		return
+	}
+	// Unknown feeds get the same answer as bad signatures
+	signedAt, valid := verifySignature(r.Header.Get("X-Wallet-Signature"), services.DecryptField(userID, secret), body, time.Now())
+	if err == sql.ErrNoRows || !valid {
+		jsonError(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	// Feeds of users without bank feeds are answered as if they didn't exist
+	if !h.features.Enabled(ctx, userID, models.FeatureBankFeeds) {
+		jsonError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	// Each push must be signed after the last, so a captured one can't be
+	// replayed within the signature tolerance
+	if lastSignedAt.Valid && signedAt <= lastSignedAt.Int64 {
+		jsonError(w, "Balance update isn't newer than the last one", http.StatusConflict)
+		return
+	}
+	if req.Balance == nil {
+		jsonError(w, "balance is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx = middleware.WithProfileID(ctx, profileID)
+	unlock := h.accounts.locker.Lock(accountID)
+	defer unlock()
+
+	var result models.BalanceUpdateResult
+	var account *models.Account
+	for attempt := 1; ; attempt++ {
+		account, err = h.accounts.getAccountByID(ctx, accountID, userID)
+		if err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
+		if currency := strings.ToUpper(strings.TrimSpace(req.Currency)); currency != "" && currency != account.Currency {
+			jsonError(w, "Balance is in "+currency+" but the account is in "+account.Currency, http.StatusUnprocessableEntity)
+			return
+		}
+
+		now := time.Now()
+		previous := account.GetDisplayBalance()
+		result = models.BalanceUpdateResult{AccountID: accountID, PreviousBalance: previous, Balance: *req.Balance, Adjustment: *req.Balance - previous}
+
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		if result.Adjustment != 0 {
+			err = setBalance(ctx, tx, accountID, account.Type, *req.Balance, account.Version)
+			if err == errBalanceConflict {
+				tx.Rollback()
+				if attempt < maxBalanceAttempts {
+					continue
+				}
+				balanceConflict(w)
+				return
+			}
+			if err != nil {
+				jsonError(w, "Failed to update account balance", http.StatusInternalServerError)
+				return
+			}
+			if err := recordBalanceChange(ctx, tx, userID, accountID, account.Type, result.Adjustment, *req.Balance,
+				"Balance update from "+name, models.CategoryTransfer, now); err != nil {
+				jsonError(w, "Failed to record balance adjustment", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// A concurrent update signed later wins
+		update, err := tx.ExecContext(ctx, `
+			UPDATE balance_feeds SET last_balance = ?, last_signed_at = ?, last_received_at = ?
+			WHERE id = ? AND (last_signed_at IS NULL OR last_signed_at < ?)
+		`, *req.Balance, signedAt, now, req.FeedID, signedAt)
+		if err != nil {
+			jsonError(w, "Failed to update balance feed", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := update.RowsAffected(); n == 0 {
+			jsonError(w, "Balance update isn't newer than the last one", http.StatusConflict)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	if result.Adjustment != 0 {
+		checkBalanceAlerts(ctx, h.accounts.alerts, accountID)
+		h.accounts.audit.Record(ctx, models.AuditEvent{
+			UserID:   userID,
+			Type:     models.ActivityAccount,
+			Action:   "balance_adjusted",
+			EntityID: &accountID,
+			Summary:  "Balance of " + account.Name + " updated by " + name,
+			Details:  map[string]interface{}{"feed_id": req.FeedID, "previous_balance": result.PreviousBalance, "balance": result.Balance},
+		})
+	}
+
+	jsonResponse(w, result, http.StatusOK)
+}
+
+// verifySignature checks a "t=<unix time>,v1=<signature>" header against
+// the body, returning the time it was signed
+func verifySignature(header, secret string, body []byte, now time.Time) (int64, bool) {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || secret == "" || signature == "" {
+		return 0, false
+	}
+	if skew := now.Sub(time.Unix(signedAt, 0)); skew > balanceSignatureTolerance || skew < -balanceSignatureTolerance {
+		return 0, false
+	}
+	return signedAt, hmac.Equal([]byte(signature), []byte(services.SignWebhook(secret, timestamp, body)))
+}
@@ -0,0 +1,116 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestBalanceFeeds(t *testing.T) {
+	app := testutil.NewApp(t)
+	fx := app.Seed(t, "ana@example.com")
+	bob := app.Register(t, "bob@example.com")
+
+	var feed models.BalanceFeed
+	fx.Client.Post("/api/integrations/balance-feeds", models.CreateBalanceFeedRequest{AccountID: fx.Checking.ID, Name: "BHD scraper"}).
+		Expect(http.StatusCreated).Decode(&feed)
+	if feed.Secret == "" {
+		t.Fatal("secret missing on creation")
+	}
+	fx.Client.Post("/api/integrations/balance-feeds", models.CreateBalanceFeedRequest{AccountID: fx.Checking.ID, Name: "Again"}).Expect(http.StatusConflict)
+	bob.Post("/api/integrations/balance-feeds", models.CreateBalanceFeedRequest{AccountID: fx.Savings.ID, Name: "Not mine"}).Expect(http.StatusNotFound)
+
+	// push sends a balance signed at the given time and returns the status
+	push := func(secret string, req models.BalanceUpdateRequest, signedAt time.Time) (int, models.BalanceUpdateResult) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		httpReq, _ := http.NewRequest(http.MethodPost, app.URL+"/api/integrations/balance", bytes.NewReader(body))
+		httpReq.Header.Set("X-Wallet-Signature", "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+		resp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result models.BalanceUpdateResult
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+	balance := func(amount float64) *float64 { return &amount }
+	now := time.Now()
+
+	status, result := push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(23500), Currency: "dop"}, now)
+	if status != http.StatusOK || result.PreviousBalance != testutil.CheckingBalance || result.Adjustment != -1500 {
+		t.Fatalf("push: status %d, result %+v, want a -1,500 adjustment", status, result)
+	}
+	if got := fx.Client.Account(fx.Checking.ID).CurrentBalance; got != 23500 {
+		t.Errorf("balance = %v, want 23,500", got)
+	}
+	var txs []models.Transaction
+	fx.Client.Get("/api/transactions/recent").Expect(http.StatusOK).Decode(&txs)
+	if len(txs) == 0 || txs[0].Description != "Balance update from BHD scraper" || txs[0].Amount != 1500 ||
+		txs[0].Type != models.TransactionTypeWithdrawal || txs[0].BalanceAfter != 23500 {
+		t.Errorf("latest transaction = %+v, want the adjustment", txs)
+	}
+
+	// Replaying the push is refused, and the same balance signed later records nothing
+	if status, _ = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(23500), Currency: "dop"}, now); status != http.StatusConflict {
+		t.Errorf("replayed push: status %d, want 409", status)
+	}
+	now = now.Add(time.Second)
+	if status, result = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(23500)}, now); status != http.StatusOK || result.Adjustment != 0 {
+		t.Errorf("repeat push: status %d, result %+v, want no adjustment", status, result)
+	}
+
+	// Bad signatures, unknown feeds, stale and replayed updates are refused
+	if status, _ = push("whsec_wrong", models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(1)}, now); status != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status %d, want 401", status)
+	}
+	if status, _ = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID + 100, Balance: balance(1)}, now); status != http.StatusUnauthorized {
+		t.Errorf("unknown feed: status %d, want 401", status)
+	}
+	if status, _ = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(1)}, now.Add(-time.Hour)); status != http.StatusUnauthorized {
+		t.Errorf("old signature: status %d, want 401", status)
+	}
+	if status, _ = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(1)}, now.Add(-time.Minute)); status != http.StatusConflict {
+		t.Errorf("update signed before the last: status %d, want 409", status)
+	}
+	if status, _ = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(1), Currency: "USD"}, now.Add(time.Second)); status != http.StatusUnprocessableEntity {
+		t.Errorf("wrong currency: status %d, want 422", status)
+	}
+
+	// Credit cards take the amount owed
+	var card models.BalanceFeed
+	fx.Client.Post("/api/integrations/balance-feeds", models.CreateBalanceFeedRequest{AccountID: fx.Card.ID, Name: "Card statement"}).
+		Expect(http.StatusCreated).Decode(&card)
+	if status, result = push(card.Secret, models.BalanceUpdateRequest{FeedID: card.ID, Balance: balance(7000)}, now); status != http.StatusOK || result.Adjustment != 2000 {
+		t.Errorf("card push: status %d, result %+v, want a 2,000 adjustment", status, result)
+	}
+	if got := fx.Client.Account(fx.Card.ID).CreditOwed; got == nil || *got != 7000 {
+		t.Errorf("card owed = %v, want 7,000", got)
+	}
+
+	var feeds []models.BalanceFeed
+	fx.Client.Get("/api/integrations/balance-feeds").Expect(http.StatusOK).Decode(&feeds)
+	if len(feeds) != 2 || feeds[1].Secret != "" || feeds[1].LastBalance == nil || *feeds[1].LastBalance != 23500 {
+		t.Errorf("feeds = %+v, want both without secrets", feeds)
+	}
+
+	bob.Delete("/api/integrations/balance-feeds/" + strconv.FormatInt(feed.ID, 10)).Expect(http.StatusNotFound)
+	fx.Client.Delete("/api/integrations/balance-feeds/" + strconv.FormatInt(feed.ID, 10)).Expect(http.StatusNoContent)
+	if status, _ = push(feed.Secret, models.BalanceUpdateRequest{FeedID: feed.ID, Balance: balance(1)}, now); status != http.StatusUnauthorized {
+		t.Errorf("deleted feed: status %d, want 401", status)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+var (
+	benchRows = flag.Int("bench.rows", 1_000_000, "transactions in the large history benchmarks")
+	benchDays = flag.Int("bench.days", 5*365, "days the large history benchmarks span")
+)
+
+// BenchmarkLargeHistory measures the hot read paths for a user with
+// -bench.rows transactions. Seeding takes a while, so the sub-benchmarks
+// share one history; run them with -bench LargeHistory.
+func BenchmarkLargeHistory(b *testing.B) {
+	app := testutil.NewApp(b)
+	f := app.Seed(b, "bench@example.com")
+	start := time.Now()
+	app.SeedHistory(b, *benchRows, *benchDays, f.Checking, f.Savings, f.Card)
+	b.Logf("seeded %d transactions in %s", *benchRows, time.Since(start))
+
+	// Recent transactions include transfers, which show the linked account
+	for i := 0; i < 25; i++ {
+		f.Client.Post("/api/transfers", models.TransferRequest{
+			FromAccountID: f.Checking.ID,
+			ToAccountID:   f.Savings.ID,
+			Amount:        100,
+		}).Expect(http.StatusCreated)
+	}
+
+	paths := []struct {
+		name string
+		path string
+	}{
+		{"Report", "/api/reports"},
+		{"CompareReports", "/api/reports/compare"},
+		{"CategoryTrend", "/api/reports/categories/groceries/trend?months=36"},
+		{"Heatmap", "/api/reports/heatmap"},
+		{"ListByAccount", fmt.Sprintf("/api/accounts/%d/transactions?page=50&page_size=100", f.Checking.ID)},
+		{"Recent", "/api/transactions/recent?limit=50"},
+	}
+	for _, p := range paths {
+		b.Run(p.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// Checked here: the client fails the parent benchmark, which
+				// can't be done from a sub-benchmark
+				if resp := f.Client.Get(p.path); resp.StatusCode != http.StatusOK {
+					b.Fatalf("GET %s: got status %d: %s", p.path, resp.StatusCode, resp.Body)
+				}
+			}
+		})
+	}
+}
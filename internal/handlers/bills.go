@@ -0,0 +1,663 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// upcomingBillDays is how far ahead the overview lists bills
+const upcomingBillDays = 14
+
+// errBillAlreadyPaid is returned when a bill's due date moved on while it
+// was being paid
+var errBillAlreadyPaid = errors.New("bill was already paid")
+
+// billTransactionError carries the response of a payment transaction the
+// transaction handler refused
+type billTransactionError struct {
+	status  int
+	message string
+}
+
+func (e *billTransactionError) Error() string {
+	return e.message
+}
+
+type BillHandler struct {
+	db           *sql.DB
+	transactions *TransactionHandler
+	audit        *services.AuditService
+}
+
+func NewBillHandler(db *sql.DB, transactions *TransactionHandler, audit *services.AuditService) *BillHandler {
+	return &BillHandler{db: db, transactions: transactions, audit: audit}
+}
+
+const billColumns = `b.id, b.account_id, a.name, b.name, b.amount, a.currency, b.due_day, b.category,
+	b.autopay, b.next_due_date, b.last_paid_at, b.created_at, b.updated_at`
+
+// List returns the user's bills, soonest due first
+func (h *BillHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		JOIN accounts a ON b.account_id = a.id
+		WHERE b.user_id = ? AND a.profile_id = ?
+		ORDER BY b.next_due_date, b.id
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to fetch bills", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	today := startOfDay(time.Now())
+	bills := []models.Bill{}
+	for rows.Next() {
+		b, err := scanBill(rows, today)
+		if err != nil {
+			continue
+		}
+		bills = append(bills, *b)
+	}
+
+	jsonResponse(w, bills, http.StatusOK)
+}
+
+// Get returns one bill
+func (h *BillHandler) Get(w http.ResponseWriter, r *http.Request) {
+	bill, ok := h.billFromURL(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, bill, http.StatusOK)
+}
+
+// Create adds a bill. Its first due date is the next due day from today.
+func (h *BillHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.BillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == nil || req.Amount == nil || req.DueDay == nil || req.AccountID == nil {
+		jsonError(w, "name, amount, due_day and account_id are required", http.StatusBadRequest)
+		return
+	}
+	if req.Category == nil {
+		category := models.CategoryOther
+		req.Category = &category
+	}
+	autopay := req.Autopay != nil && *req.Autopay
+
+	name, ok := validateBillRequest(w, req)
+	if !ok {
+		return
+	}
+	if !h.validBillAccount(w, ctx, userID, *req.AccountID) {
+		return
+	}
+
+	now := time.Now()
+	nextDue := services.NextBillDueDate(*req.DueDay, startOfDay(now))
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO bills (user_id, account_id, name, amount, due_day, category, autopay, next_due_date, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, *req.AccountID, name, *req.Amount, *req.DueDay, string(*req.Category), autopay, nextDue, now, now)
+	if err != nil {
+		jsonError(w, "Failed to create bill", http.StatusInternalServerError)
+		return
+	}
+	billID, _ := result.LastInsertId()
+
+	bill, err := h.billByID(ctx, billID, userID)
+	if err != nil {
+		jsonError(w, "Bill created but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityBill,
+		Action:   "created",
+		EntityID: &billID,
+		Summary:  fmt.Sprintf("Added bill %s", bill.Name),
+		Details:  map[string]interface{}{"amount": bill.Amount, "due_day": bill.DueDay, "autopay": bill.Autopay},
+	})
+
+	jsonResponse(w, bill, http.StatusCreated)
+}
+
+// Update changes a bill. A new due day moves the next due date within the
+// same month.
+func (h *BillHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bill, ok := h.billFromURL(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserID(ctx)
+
+	var req models.BillRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the bill as it will be after the update
+	merged := models.BillRequest{
+		Name:      &bill.Name,
+		Amount:    &bill.Amount,
+		DueDay:    &bill.DueDay,
+		AccountID: &bill.AccountID,
+		Category:  &bill.Category,
+		Autopay:   &bill.Autopay,
+	}
+	if req.Name != nil {
+		merged.Name = req.Name
+	}
+	if req.Amount != nil {
+		merged.Amount = req.Amount
+	}
+	if req.DueDay != nil {
+		merged.DueDay = req.DueDay
+	}
+	if req.AccountID != nil {
+		merged.AccountID = req.AccountID
+	}
+	if req.Category != nil {
+		merged.Category = req.Category
+	}
+	if req.Autopay != nil {
+		merged.Autopay = req.Autopay
+	}
+
+	name, ok := validateBillRequest(w, merged)
+	if !ok {
+		return
+	}
+	if req.AccountID != nil && !h.validBillAccount(w, ctx, userID, *req.AccountID) {
+		return
+	}
+
+	nextDue := bill.NextDueDate
+	if *merged.DueDay != bill.DueDay {
+		monthStart := time.Date(nextDue.Year(), nextDue.Month(), 1, 0, 0, 0, 0, time.Now().Location())
+		nextDue = services.NextBillDueDate(*merged.DueDay, monthStart)
+	}
+
+	_, err := h.db.ExecContext(ctx, `
+		UPDATE bills
+		SET name = ?, amount = ?, due_day = ?, account_id = ?, category = ?, autopay = ?, next_due_date = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`, name, *merged.Amount, *merged.DueDay, *merged.AccountID, string(*merged.Category), *merged.Autopay, nextDue, time.Now(), bill.ID, userID)
+	if err != nil {
+		jsonError(w, "Failed to update bill", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.billByID(ctx, bill.ID, userID)
+	if err != nil {
+		jsonError(w, "Bill updated but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityBill,
+		Action:   "updated",
+		EntityID: &bill.ID,
+		Summary:  fmt.Sprintf("Updated bill %s", updated.Name),
+		Details:  map[string]interface{}{"fields": changedFields(req)},
+	})
+
+	jsonResponse(w, updated, http.StatusOK)
+}
+
+// Delete removes a bill and its payment history. Transactions that paid it
+// are kept.
+func (h *BillHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bill, ok := h.billFromURL(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserID(ctx)
+
+	if _, err := h.db.ExecContext(ctx, "DELETE FROM bills WHERE id = ? AND user_id = ?", bill.ID, userID); err != nil {
+		jsonError(w, "Failed to delete bill", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityBill,
+		Action:   "deleted",
+		EntityID: &bill.ID,
+		Summary:  fmt.Sprintf("Deleted bill %s", bill.Name),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Pay marks a bill paid for its current due date and moves it to the next
+// month. With create_transaction set, the payment is also recorded on the
+// bill's account.
+func (h *BillHandler) Pay(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bill, ok := h.billFromURL(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserID(ctx)
+
+	var req models.PayBillRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	amount := bill.Amount
+	if req.Amount != nil {
+		if *req.Amount <= 0 {
+			jsonError(w, "Amount must be positive", http.StatusBadRequest)
+			return
+		}
+		amount = *req.Amount
+	}
+
+	payment, err := h.pay(ctx, userID, bill, amount, req.CreateTransaction)
+	var rejected *billTransactionError
+	if errors.As(err, &rejected) {
+		jsonError(w, rejected.message, rejected.status)
+		return
+	}
+	if err == errBillAlreadyPaid {
+		jsonError(w, "Bill was already paid", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to record payment", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, payment, http.StatusCreated)
+}
+
+// ListPayments returns a bill's payment history, newest first
+func (h *BillHandler) ListPayments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	bill, ok := h.billFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, bill_id, due_date, amount, transaction_id, paid_at
+		FROM bill_payments
+		WHERE bill_id = ?
+		ORDER BY due_date DESC, id DESC
+	`, bill.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	payments := []models.BillPayment{}
+	for rows.Next() {
+		var p models.BillPayment
+		var transactionID sql.NullInt64
+		if err := rows.Scan(&p.ID, &p.BillID, &p.DueDate, &p.Amount, &transactionID, &p.PaidAt); err != nil {
+			continue
+		}
+		if transactionID.Valid {
+			p.TransactionID = &transactionID.Int64
+		}
+		payments = append(payments, p)
+	}
+
+	jsonResponse(w, payments, http.StatusOK)
+}
+
+// PayAutopay pays every autopay bill that has fallen due, recording the
+// payment as a transaction on its account, and returns how many were paid
+func (h *BillHandler) PayAutopay(ctx context.Context) (int, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT b.id, b.user_id, a.profile_id
+		FROM bills b
+		JOIN accounts a ON b.account_id = a.id
+		WHERE b.autopay = 1
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch bills: %w", err)
+	}
+	type autopayBill struct {
+		id        int64
+		userID    int64
+		profileID int64
+	}
+	var bills []autopayBill
+	for rows.Next() {
+		var b autopayBill
+		if err := rows.Scan(&b.id, &b.userID, &b.profileID); err != nil {
+			continue
+		}
+		bills = append(bills, b)
+	}
+	rows.Close()
+
+	today := startOfDay(time.Now())
+	paid := 0
+	for _, b := range bills {
+		ctx := middleware.WithProfileID(ctx, b.profileID)
+		bill, err := h.billByID(ctx, b.id, b.userID)
+		if err != nil || bill.NextDueDate.After(today) {
+			continue
+		}
+		if _, err := h.pay(ctx, b.userID, bill, bill.Amount, true); err != nil {
+			log.Printf("Autopay of bill %d failed: %v", bill.ID, err)
+			continue
+		}
+		paid++
+	}
+	return paid, nil
+}
+
+// pay records a payment for the bill's current due date and advances it a
+// month, creating the paying transaction when asked. A refused transaction
+// leaves the bill unpaid.
+func (h *BillHandler) pay(ctx context.Context, userID int64, bill *models.Bill, amount float64, createTransaction bool) (*models.BillPayment, error) {
+	now := time.Now()
+	payment := &models.BillPayment{
+		BillID:  bill.ID,
+		DueDate: bill.NextDueDate,
+		Amount:  amount,
+		PaidAt:  now,
+	}
+	nextDue := services.FollowingBillDueDate(bill.DueDay, startOfDay(bill.NextDueDate))
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// The due date guards against paying the same month twice
+	result, err := tx.ExecContext(ctx, `
+		UPDATE bills SET next_due_date = ?, last_paid_at = ?, updated_at = ?
+		WHERE id = ? AND datetime(next_due_date) = datetime(?)
+	`, nextDue, now, now, bill.ID, bill.NextDueDate)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, errBillAlreadyPaid
+	}
+	result, err = tx.ExecContext(ctx, `
+		INSERT INTO bill_payments (bill_id, due_date, amount, paid_at)
+		VALUES (?, ?, ?, ?)
+	`, bill.ID, bill.NextDueDate, amount, now)
+	if err != nil {
+		return nil, err
+	}
+	payment.ID, _ = result.LastInsertId()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if createTransaction {
+		transactionID, err := h.createPayment(ctx, userID, bill, amount)
+		if err != nil {
+			h.undoPayment(ctx, bill, payment.ID)
+			return nil, err
+		}
+		payment.TransactionID = &transactionID
+		if _, err := h.db.ExecContext(ctx, "UPDATE bill_payments SET transaction_id = ? WHERE id = ?", transactionID, payment.ID); err != nil {
+			log.Printf("Failed to link transaction %d to bill payment %d: %v", transactionID, payment.ID, err)
+		}
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityBill,
+		Action:   "paid",
+		EntityID: &bill.ID,
+		Summary:  fmt.Sprintf("Paid bill %s (%.2f %s)", bill.Name, amount, bill.Currency),
+		Details: map[string]interface{}{
+			"amount":         amount,
+			"due_date":       bill.NextDueDate.Format("2006-01-02"),
+			"transaction_id": payment.TransactionID,
+		},
+	})
+
+	return payment, nil
+}
+
+// createPayment records a bill payment on the bill's account exactly like
+// the API does, with the same locking, alerts and budget checks
+func (h *BillHandler) createPayment(ctx context.Context, userID int64, bill *models.Bill, amount float64) (int64, error) {
+	var accountType models.AccountType
+	err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ?", bill.AccountID).Scan(&accountType)
+	if err != nil {
+		return 0, err
+	}
+	req := models.CreateTransactionRequest{
+		Type:        models.TransactionTypeWithdrawal,
+		Amount:      amount,
+		Description: bill.Name,
+		Category:    bill.Category,
+	}
+	if accountType == models.AccountTypeCreditCard {
+		req.Type = models.TransactionTypeExpense
+	}
+
+	rec := httptest.NewRecorder()
+	h.transactions.create(ctx, rec, userID, bill.AccountID, req)
+	if rec.Code != http.StatusCreated {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return 0, &billTransactionError{status: rec.Code, message: body.Error}
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+// undoPayment puts a bill back on the due date of a payment that couldn't
+// be completed
+func (h *BillHandler) undoPayment(ctx context.Context, bill *models.Bill, paymentID int64) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Printf("Failed to undo payment %d of bill %d: %v", paymentID, bill.ID, err)
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM bill_payments WHERE id = ?", paymentID); err != nil {
+		log.Printf("Failed to undo payment %d of bill %d: %v", paymentID, bill.ID, err)
+		return
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE bills SET next_due_date = ?, last_paid_at = ? WHERE id = ?",
+		bill.NextDueDate, bill.LastPaidAt, bill.ID)
+	if err != nil {
+		log.Printf("Failed to undo payment %d of bill %d: %v", paymentID, bill.ID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to undo payment %d of bill %d: %v", paymentID, bill.ID, err)
+	}
+}
+
+// validateBillRequest checks a complete bill request, writing the error
+// response when it is invalid, and returns the trimmed name
+func validateBillRequest(w http.ResponseWriter, req models.BillRequest) (string, bool) {
+	name, err := models.ValidateBillName(*req.Name)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	if *req.Amount <= 0 {
+		jsonError(w, "Amount must be positive", http.StatusBadRequest)
+		return "", false
+	}
+	if *req.DueDay < 1 || *req.DueDay > 31 {
+		jsonError(w, "Due day must be a day of the month (1-31)", http.StatusBadRequest)
+		return "", false
+	}
+	if !isValidCategory(*req.Category) || *req.Category == models.CategoryIncome || *req.Category == models.CategoryTransfer {
+		jsonError(w, "Invalid category", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+// validBillAccount checks that a bill can be paid from the account, writing
+// the error response when it can't
+func (h *BillHandler) validBillAccount(w http.ResponseWriter, ctx context.Context, userID, accountID int64) bool {
+	var accountType models.AccountType
+	err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?", accountID, userID, middleware.GetProfileID(ctx)).Scan(&accountType)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return false
+	}
+	if accountType == models.AccountTypeLoan || accountType == models.AccountTypeAsset {
+		jsonError(w, "Bills can't be paid from this account", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// billFromURL loads the bill in the URL, writing the error response when it
+// isn't one of the user's bills
+func (h *BillHandler) billFromURL(w http.ResponseWriter, r *http.Request) (*models.Bill, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	billID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid bill ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	bill, err := h.billByID(r.Context(), billID, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Bill not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch bill", http.StatusInternalServerError)
+		return nil, false
+	}
+	return bill, true
+}
+
+func (h *BillHandler) billByID(ctx context.Context, billID, userID int64) (*models.Bill, error) {
+	return scanBill(h.db.QueryRowContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		JOIN accounts a ON b.account_id = a.id
+		WHERE b.id = ? AND b.user_id = ? AND a.profile_id = ?
+	`, billID, userID, middleware.GetProfileID(ctx)), startOfDay(time.Now()))
+}
+
+// upcomingBills lists the user's bills that are overdue or due within
+// upcomingBillDays, soonest first, for the overview
+func upcomingBills(ctx context.Context, db *sql.DB, userID int64, locale string) ([]models.UpcomingBill, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+billColumns+`
+		FROM bills b
+		JOIN accounts a ON b.account_id = a.id
+		WHERE b.user_id = ? AND a.profile_id = ?
+		ORDER BY b.next_due_date, b.id
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	today := startOfDay(time.Now())
+	horizon := today.AddDate(0, 0, upcomingBillDays)
+	upcoming := []models.UpcomingBill{}
+	for rows.Next() {
+		b, err := scanBill(rows, today)
+		if err != nil {
+			continue
+		}
+		if b.NextDueDate.After(horizon) {
+			continue
+		}
+		upcoming = append(upcoming, models.UpcomingBill{
+			ID:              b.ID,
+			Name:            b.Name,
+			Amount:          b.Amount,
+			Currency:        b.Currency,
+			FormattedAmount: services.FormatMoney(b.Amount, b.Currency, locale),
+			DueDate:         b.NextDueDate,
+			Autopay:         b.Autopay,
+			Overdue:         b.Overdue,
+		})
+	}
+	return upcoming, rows.Err()
+}
+
+func scanBill(row rowScanner, today time.Time) (*models.Bill, error) {
+	var b models.Bill
+	var lastPaidAt sql.NullTime
+	err := row.Scan(&b.ID, &b.AccountID, &b.AccountName, &b.Name, &b.Amount, &b.Currency, &b.DueDay, &b.Category,
+		&b.Autopay, &b.NextDueDate, &lastPaidAt, &b.CreatedAt, &b.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastPaidAt.Valid {
+		b.LastPaidAt = &lastPaidAt.Time
+	}
+	b.Overdue = startOfDay(b.NextDueDate).Before(today)
+	return &b, nil
+}
+
+// startOfDay returns midnight of t's day in the server's time zone
+func startOfDay(t time.Time) time.Time {
+	t = t.In(time.Now().Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -3,61 +3,194 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/kengru/odin-wallet/internal/middleware"
 	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
 )
 
 type BudgetHandler struct {
-	db *sql.DB
+	db      *sql.DB
+	budgets *services.BudgetService
+	audit   *services.AuditService
 }
 
-func NewBudgetHandler(db *sql.DB) *BudgetHandler {
-	return &BudgetHandler{db: db}
+func NewBudgetHandler(db *sql.DB, budgetService *services.BudgetService, audit *services.AuditService) *BudgetHandler {
+	return &BudgetHandler{db: db, budgets: budgetService, audit: audit}
 }
 
 // List returns all budgets for the authenticated user
 func (h *BudgetHandler) List(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
 	}
 
-	rows, err := h.db.Query(`
-		SELECT id, user_id, category, monthly_limit, created_at, updated_at
-		FROM category_budgets
-		WHERE user_id = ?
-		ORDER BY category
-	`, userID)
+	budgets, err := h.budgets.List(ctx, userID)
 	if err != nil {
 		jsonError(w, "Failed to fetch budgets", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	budgets := []models.CategoryBudget{}
-	for rows.Next() {
-		var budget models.CategoryBudget
-		err := rows.Scan(
-			&budget.ID, &budget.UserID, &budget.Category,
-			&budget.MonthlyLimit, &budget.CreatedAt, &budget.UpdatedAt,
-		)
+	jsonResponse(w, budgets, http.StatusOK)
+}
+
+// Progress returns spending against each budget for its current period, or
+// the period containing date (YYYY-MM-DD)
+func (h *BudgetHandler) Progress(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	at := time.Now()
+	if dateStr := r.URL.Query().Get("date"); dateStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dateStr, at.Location())
 		if err != nil {
-			continue
+			jsonError(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
 		}
-		budgets = append(budgets, budget)
+		at = parsed
 	}
 
-	jsonResponse(w, budgets, http.StatusOK)
+	progress, err := h.budgets.Progress(ctx, userID, at)
+	if err != nil {
+		jsonError(w, "Failed to calculate budget progress", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, progress, http.StatusOK)
+}
+
+// History returns every change to the user's budgets with its effective
+// dates, optionally for a single category
+func (h *BudgetHandler) History(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	history, err := h.budgets.History(ctx, userID, r.URL.Query().Get("category"))
+	if err != nil {
+		jsonError(w, "Failed to fetch budget history", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, history, http.StatusOK)
+}
+
+// GetTotal returns spending against the overall monthly budget
+func (h *BudgetHandler) GetTotal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	progress, err := h.budgets.TotalProgress(ctx, userID, time.Now())
+	if errors.Is(err, services.ErrNoTotalBudget) {
+		jsonError(w, "No total budget set", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to calculate budget progress", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, progress, http.StatusOK)
+}
+
+// SetTotal sets the overall monthly budget
+func (h *BudgetHandler) SetTotal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetTotalBudgetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.MonthlyLimit <= 0 {
+		jsonError(w, "Monthly limit must be positive", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.db.ExecContext(ctx, "UPDATE users SET monthly_budget = ? WHERE id = ?", req.MonthlyLimit, userID)
+	if err != nil {
+		jsonError(w, "Failed to set budget", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityBudget,
+		Action:  "total_set",
+		Summary: fmt.Sprintf("Set the overall monthly budget to %.2f", req.MonthlyLimit),
+		Details: map[string]interface{}{"monthly_limit": req.MonthlyLimit},
+	})
+
+	progress, err := h.budgets.TotalProgress(ctx, userID, time.Now())
+	if err != nil {
+		jsonError(w, "Budget saved but failed to calculate progress", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, progress, http.StatusOK)
+}
+
+// DeleteTotal removes the overall monthly budget
+func (h *BudgetHandler) DeleteTotal(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "UPDATE users SET monthly_budget = NULL WHERE id = ? AND monthly_budget IS NOT NULL", userID)
+	if err != nil {
+		jsonError(w, "Failed to delete budget", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		jsonError(w, "No total budget set", http.StatusNotFound)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityBudget,
+		Action:  "total_deleted",
+		Summary: "Removed the overall monthly budget",
+	})
+
+	jsonResponse(w, map[string]string{"message": "Budget deleted successfully"}, http.StatusOK)
 }
 
 // Set creates or updates a budget for a category
 func (h *BudgetHandler) Set(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -88,41 +221,140 @@ func (h *BudgetHandler) Set(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Period == "" {
+		req.Period = models.BudgetPeriodMonthly
+	}
+	if !req.Period.IsValid() {
+		jsonError(w, "Invalid budget period", http.StatusBadRequest)
+		return
+	}
+
+	if req.FreezeAccountID != nil {
+		var accountType string
+		err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?",
+			*req.FreezeAccountID, userID, middleware.GetProfileID(ctx)).Scan(&accountType)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Freeze account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
+		if models.AccountType(accountType) == models.AccountTypeLoan {
+			jsonError(w, "Loan accounts cannot be frozen", http.StatusBadRequest)
+			return
+		}
+	}
+
 	now := time.Now()
 
+	// Changes can be backdated, but not to before the latest change
+	effectiveFrom := now
+	if req.EffectiveFrom != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", req.EffectiveFrom, now.Location())
+		if err != nil {
+			jsonError(w, "Invalid effective_from format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if parsed.After(now) {
+			jsonError(w, "effective_from cannot be in the future", http.StatusBadRequest)
+			return
+		}
+		effectiveFrom = parsed
+	}
+
+	// The check, the budget and its history are written together, so a
+	// concurrent change can't slip in between them
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var latest time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT effective_from FROM budget_versions
+		WHERE user_id = ? AND profile_id = ? AND category = ?
+		ORDER BY effective_from DESC LIMIT 1
+	`, userID, middleware.GetProfileID(ctx), req.Category).Scan(&latest)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch budget history", http.StatusInternalServerError)
+		return
+	}
+	if err == nil && effectiveFrom.Before(latest) {
+		jsonError(w, "effective_from cannot be before the latest change to this budget", http.StatusBadRequest)
+		return
+	}
+
 	// Upsert budget
-	_, err := h.db.Exec(`
-		INSERT INTO category_budgets (user_id, category, monthly_limit, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(user_id, category)
-		DO UPDATE SET monthly_limit = excluded.monthly_limit, updated_at = excluded.updated_at
-	`, userID, req.Category, req.MonthlyLimit, now, now)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO category_budgets (user_id, profile_id, category, monthly_limit, period, rollover, freeze_account_id, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, profile_id, category)
+		DO UPDATE SET monthly_limit = excluded.monthly_limit, period = excluded.period,
+			rollover = excluded.rollover, freeze_account_id = excluded.freeze_account_id,
+			updated_at = excluded.updated_at
+	`, userID, middleware.GetProfileID(ctx), req.Category, req.MonthlyLimit, string(req.Period), req.Rollover, req.FreezeAccountID, now, now)
 	if err != nil {
 		jsonError(w, "Failed to set budget", http.StatusInternalServerError)
 		return
 	}
 
+	limit := req.MonthlyLimit
+	if err := h.budgets.RecordVersion(ctx, tx, userID, req.Category, &limit, req.Period, req.Rollover, effectiveFrom); err != nil {
+		jsonError(w, "Failed to record budget history", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityBudget,
+		Action:  "set",
+		Summary: fmt.Sprintf("Set the %s budget to %.2f (%s)", categoryLabel(req.Category), req.MonthlyLimit, req.Period),
+		Details: map[string]interface{}{"category": req.Category, "limit": req.MonthlyLimit, "period": req.Period, "rollover": req.Rollover},
+	})
+
 	// Fetch and return the budget
 	var budget models.CategoryBudget
-	err = h.db.QueryRow(`
-		SELECT id, user_id, category, monthly_limit, created_at, updated_at
+	var freezeAccountID sql.NullInt64
+	err = h.db.QueryRowContext(ctx, `
+		SELECT id, user_id, category, monthly_limit, COALESCE(period, 'monthly'), COALESCE(rollover, 0),
+			   created_at, updated_at, freeze_account_id
 		FROM category_budgets
-		WHERE user_id = ? AND category = ?
-	`, userID, req.Category).Scan(
+		WHERE user_id = ? AND profile_id = ? AND category = ?
+	`, userID, middleware.GetProfileID(ctx), req.Category).Scan(
 		&budget.ID, &budget.UserID, &budget.Category,
-		&budget.MonthlyLimit, &budget.CreatedAt, &budget.UpdatedAt,
+		&budget.MonthlyLimit, &budget.Period, &budget.Rollover,
+		&budget.CreatedAt, &budget.UpdatedAt, &freezeAccountID,
 	)
 	if err != nil {
 		jsonError(w, "Budget saved but failed to fetch", http.StatusInternalServerError)
 		return
 	}
+	if freezeAccountID.Valid {
+		budget.FreezeAccountID = &freezeAccountID.Int64
+	}
+
+	// The new limit may already be exceeded
+	if budget.FreezeAccountID != nil {
+		if err := h.budgets.EnforceFreezes(ctx, userID); err != nil {
+			log.Printf("Budget freeze check failed for user %d: %v", userID, err)
+		}
+	}
 
 	jsonResponse(w, budget, http.StatusOK)
 }
 
 // Delete removes a budget for a category
 func (h *BudgetHandler) Delete(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -134,10 +366,17 @@ func (h *BudgetHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec(`
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
 		DELETE FROM category_budgets
-		WHERE user_id = ? AND category = ?
-	`, userID, category)
+		WHERE user_id = ? AND profile_id = ? AND category = ?
+	`, userID, middleware.GetProfileID(ctx), category)
 	if err != nil {
 		jsonError(w, "Failed to delete budget", http.StatusInternalServerError)
 		return
@@ -149,5 +388,186 @@ func (h *BudgetHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.budgets.RecordVersion(ctx, tx, userID, category, nil, models.BudgetPeriodMonthly, false, time.Now()); err != nil {
+		jsonError(w, "Failed to record budget history", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityBudget,
+		Action:  "deleted",
+		Summary: fmt.Sprintf("Removed the %s budget", categoryLabel(category)),
+		Details: map[string]interface{}{"category": category},
+	})
+
 	jsonResponse(w, map[string]string{"message": "Budget deleted successfully"}, http.StatusOK)
 }
+
+// ZeroBased returns a month's income, its allocations and what is left to
+// allocate, for users budgeting in zero-based mode. month (YYYY-MM)
+// defaults to the current month.
+func (h *BudgetHandler) ZeroBased(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	month, ok := allocationMonth(w, r.URL.Query().Get("month"))
+	if !ok {
+		return
+	}
+
+	h.writeZeroBased(w, r, userID, month, http.StatusOK)
+}
+
+// Allocate gives part of a month's income to a spending category or an
+// envelope, replacing what was allocated to it before. Allocating 0 removes
+// the allocation. Allocations may exceed income; the plan warns about it.
+func (h *BudgetHandler) Allocate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetAllocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	month, ok := allocationMonth(w, req.Month)
+	if !ok {
+		return
+	}
+	if req.Amount < 0 {
+		jsonError(w, "Amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if (req.Category == "") == (req.EnvelopeID == nil) {
+		jsonError(w, "Allocate to either a category or an envelope_id", http.StatusBadRequest)
+		return
+	}
+
+	if !h.requireZeroBased(w, r, userID) {
+		return
+	}
+
+	// The allocation's target: a category column or an envelope_id column,
+	// the other one NULL
+	profileID := middleware.GetProfileID(ctx)
+	var column, label string
+	var category, envelopeID, target interface{}
+	if req.EnvelopeID != nil {
+		err := h.db.QueryRowContext(ctx, `
+			SELECT e.name FROM envelopes e
+			JOIN accounts a ON e.account_id = a.id
+			WHERE e.id = ? AND a.user_id = ? AND a.profile_id = ?
+		`, *req.EnvelopeID, userID, profileID).Scan(&label)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Envelope not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch envelope", http.StatusInternalServerError)
+			return
+		}
+		column, envelopeID, target = "envelope_id", *req.EnvelopeID, *req.EnvelopeID
+	} else {
+		c := models.TransactionCategory(req.Category)
+		if !isValidCategory(c) || c == models.CategoryIncome || c == models.CategoryTransfer || models.IsSystemCategory(c) {
+			jsonError(w, "Invalid category", http.StatusBadRequest)
+			return
+		}
+		column, category, target = "category", req.Category, req.Category
+		label = categoryLabel(req.Category)
+	}
+
+	monthKey := month.Format("2006-01")
+	now := time.Now()
+	var existingID int64
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id FROM budget_allocations WHERE user_id = ? AND profile_id = ? AND month = ? AND `+column+` = ?
+	`, userID, profileID, monthKey, target).Scan(&existingID)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err == nil {
+		switch {
+		case existingID != 0 && req.Amount == 0:
+			_, err = h.db.ExecContext(ctx, "DELETE FROM budget_allocations WHERE id = ?", existingID)
+		case existingID != 0:
+			_, err = h.db.ExecContext(ctx, "UPDATE budget_allocations SET amount = ?, updated_at = ? WHERE id = ?", req.Amount, now, existingID)
+		case req.Amount > 0:
+			_, err = h.db.ExecContext(ctx, `
+				INSERT INTO budget_allocations (user_id, profile_id, month, category, envelope_id, amount, created_at, updated_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, profileID, monthKey, category, envelopeID, req.Amount, now, now)
+		}
+	}
+	if err != nil {
+		jsonError(w, "Failed to save allocation", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityBudget,
+		Action:  "allocated",
+		Summary: fmt.Sprintf("Allocated %.2f to %s for %s", req.Amount, label, monthKey),
+		Details: map[string]interface{}{"month": monthKey, "category": req.Category, "envelope_id": req.EnvelopeID, "amount": req.Amount},
+	})
+
+	h.writeZeroBased(w, r, userID, month, http.StatusOK)
+}
+
+// requireZeroBased writes the error response and returns false unless the
+// user budgets in zero-based mode
+func (h *BudgetHandler) requireZeroBased(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	enabled, err := h.budgets.ZeroBasedEnabled(r.Context(), userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return false
+	}
+	if !enabled {
+		jsonError(w, "Zero-based budgeting is off", http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// writeZeroBased responds with the zero-based plan for month
+func (h *BudgetHandler) writeZeroBased(w http.ResponseWriter, r *http.Request, userID int64, month time.Time, status int) {
+	plan, err := h.budgets.ZeroBased(r.Context(), userID, month)
+	if errors.Is(err, services.ErrZeroBasedOff) {
+		jsonError(w, "Zero-based budgeting is off", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to calculate the budget plan", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, plan, status)
+}
+
+// allocationMonth parses a YYYY-MM month, defaulting to the current one,
+// writing the error response when it's invalid
+func allocationMonth(w http.ResponseWriter, value string) (time.Time, bool) {
+	now := time.Now()
+	if value == "" {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), true
+	}
+	month, err := time.ParseInLocation("2006-01", value, now.Location())
+	if err != nil {
+		jsonError(w, "Invalid month format. Use YYYY-MM", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	return month, true
+}
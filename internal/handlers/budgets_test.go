@@ -0,0 +1,28 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestBudgetHistory(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+
+	f.Client.Post("/api/budgets", models.SetBudgetRequest{Category: "dining", MonthlyLimit: 500}).Expect(http.StatusOK)
+	if msg := f.Client.Post("/api/budgets", models.SetBudgetRequest{Category: "dining", MonthlyLimit: 600, EffectiveFrom: "2020-01-01"}).
+		Expect(http.StatusBadRequest).Error(); msg != "effective_from cannot be before the latest change to this budget" {
+		t.Errorf("backdated change error = %q", msg)
+	}
+	f.Client.Delete("/api/budgets/dining").Expect(http.StatusOK)
+	f.Client.Delete("/api/budgets/dining").Expect(http.StatusNotFound)
+
+	var history []models.BudgetVersion
+	f.Client.Get("/api/budgets/history").Expect(http.StatusOK).Decode(&history)
+	if len(history) != 2 || history[0].MonthlyLimit != 500 || !history[1].Deleted {
+		t.Fatalf("history = %+v, want the 500 limit then its deletion", history)
+	}
+}
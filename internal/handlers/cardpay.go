@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// PayCard pays a credit card from an asset account. The amount is the
+// statement balance, the minimum payment or a custom amount, resolved here
+// from the card's statement so clients don't have to compute it. Cards
+// without a closing date use the current amount owed as the statement
+// balance. The payment is recorded as a transfer.
+func (h *TransactionHandler) PayCard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	cardID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.PayCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var cardType models.AccountType
+	var cardCurrency string
+	var closingDay sql.NullInt64
+	var owed sql.NullFloat64
+	err = h.db.QueryRowContext(ctx, `
+		SELECT type, currency, closing_date, credit_owed FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?
+	`, cardID, userID, middleware.GetProfileID(ctx)).Scan(&cardType, &cardCurrency, &closingDay, &owed)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+	if cardType != models.AccountTypeCreditCard {
+		jsonError(w, "Only credit cards can be paid this way", http.StatusBadRequest)
+		return
+	}
+
+	var sourceCurrency string
+	err = h.db.QueryRowContext(ctx, "SELECT currency FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?", req.SourceAccountID, userID, middleware.GetProfileID(ctx)).Scan(&sourceCurrency)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Source account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch source account", http.StatusInternalServerError)
+		return
+	}
+
+	statementBalance := math.Max(owed.Float64, 0)
+	if closingDay.Valid {
+		closing := services.LastStatementClosing(int(closingDay.Int64), time.Now())
+		if statementBalance, err = services.StatementBalance(ctx, h.db, cardID, closing); err != nil {
+			jsonError(w, "Failed to compute statement balance", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var amount float64
+	switch req.AmountType {
+	case models.CardPayStatement:
+		amount = statementBalance
+	case models.CardPayMinimum:
+		amount = services.CardMinimumPayment(statementBalance)
+	case models.CardPayCustom:
+		if req.Amount <= 0 {
+			jsonError(w, "Amount must be positive", http.StatusBadRequest)
+			return
+		}
+		amount = req.Amount
+	default:
+		jsonError(w, "Invalid amount_type: use statement_balance, minimum or custom", http.StatusBadRequest)
+		return
+	}
+	amount = math.Round(amount*100) / 100
+	if amount <= 0 {
+		jsonError(w, "Nothing is due on this card", http.StatusBadRequest)
+		return
+	}
+
+	// Transfers take the amount in the source account's currency
+	if sourceCurrency != cardCurrency {
+		converted, err := h.exchangeService.ConvertFor(userID, amount, cardCurrency, sourceCurrency)
+		if err != nil {
+			jsonError(w, "Failed to convert currency: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		amount = math.Round(converted*100) / 100
+	}
+
+	description := req.Description
+	if description == "" {
+		description = "Card payment"
+	}
+	h.transfer(ctx, w, userID, models.TransferRequest{
+		FromAccountID: req.SourceAccountID,
+		ToAccountID:   cardID,
+		Amount:        amount,
+		Description:   description,
+	}, transferOptions{})
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type CreditScoreHandler struct {
+	db    *sql.DB
+	audit *services.AuditService
+}
+
+func NewCreditScoreHandler(db *sql.DB, audit *services.AuditService) *CreditScoreHandler {
+	return &CreditScoreHandler{db: db, audit: audit}
+}
+
+// List returns the user's credit scores, newest first, along with a series
+// per bureau for charting. bureau limits it to one bureau and from
+// (YYYY-MM-DD) to scores recorded on or after that day.
+func (h *CreditScoreHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+	if bureau := r.URL.Query().Get("bureau"); bureau != "" {
+		conditions = append(conditions, "COALESCE(bureau, '') = ?")
+		args = append(args, bureau)
+	}
+	if from := r.URL.Query().Get("from"); from != "" {
+		if _, err := time.Parse("2006-01-02", from); err != nil {
+			jsonError(w, "Invalid from date. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "recorded_on >= ?")
+		args = append(args, from)
+	}
+
+	var reminders sql.NullInt64
+	if err := h.db.QueryRowContext(ctx, "SELECT credit_score_reminders FROM users WHERE id = ?", userID).Scan(&reminders); err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, score, COALESCE(bureau, ''), recorded_on, COALESCE(note, ''), created_at
+		FROM credit_scores
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY recorded_on DESC, id DESC
+	`, args...)
+	if err != nil {
+		jsonError(w, "Failed to fetch credit scores", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	history := models.CreditScoreHistory{
+		Scores:    []models.CreditScore{},
+		Series:    []models.CreditScoreSeries{},
+		Reminders: reminders.Int64 == 1,
+	}
+	for rows.Next() {
+		var s models.CreditScore
+		if err := rows.Scan(&s.ID, &s.Score, &s.Bureau, &s.RecordedOn, &s.Note, &s.CreatedAt); err != nil {
+			continue
+		}
+		history.Scores = append(history.Scores, s)
+	}
+	history.Series = creditScoreSeries(history.Scores)
+
+	jsonResponse(w, history, http.StatusOK)
+}
+
+// creditScoreSeries groups scores, newest first, into a series per bureau
+// with the points oldest first
+func creditScoreSeries(scores []models.CreditScore) []models.CreditScoreSeries {
+	series := []models.CreditScoreSeries{}
+	index := make(map[string]int)
+	for i := len(scores) - 1; i >= 0; i-- {
+		s := scores[i]
+		n, ok := index[s.Bureau]
+		if !ok {
+			n = len(series)
+			index[s.Bureau] = n
+			series = append(series, models.CreditScoreSeries{Bureau: s.Bureau})
+		}
+		series[n].Points = append(series[n].Points, models.CreditScorePoint{Date: s.RecordedOn, Score: s.Score})
+	}
+	for i := range series {
+		points := series[i].Points
+		series[i].Latest = points[len(points)-1].Score
+		if len(points) > 1 {
+			change := points[len(points)-1].Score - points[len(points)-2].Score
+			series[i].Change = &change
+		}
+	}
+	return series
+}
+
+// Create records a credit score
+func (h *CreditScoreHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreditScoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Score == nil {
+		jsonError(w, "score is required", http.StatusBadRequest)
+		return
+	}
+	if *req.Score < models.MinCreditScore || *req.Score > models.MaxCreditScore {
+		jsonError(w, fmt.Sprintf("Score must be between %d and %d", models.MinCreditScore, models.MaxCreditScore), http.StatusBadRequest)
+		return
+	}
+	bureau := strings.TrimSpace(req.Bureau)
+	if utf8.RuneCountInString(bureau) > models.MaxCreditBureauLength {
+		jsonError(w, fmt.Sprintf("Bureau must be at most %d characters", models.MaxCreditBureauLength), http.StatusBadRequest)
+		return
+	}
+	note := strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(note) > models.MaxCreditScoreNoteLength {
+		jsonError(w, fmt.Sprintf("Note must be at most %d characters", models.MaxCreditScoreNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	recordedOn := now.Format("2006-01-02")
+	if req.RecordedOn != "" {
+		day, err := time.ParseInLocation("2006-01-02", req.RecordedOn, now.Location())
+		if err != nil {
+			jsonError(w, "Invalid recorded_on format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if day.After(now) {
+			jsonError(w, "recorded_on cannot be in the future", http.StatusBadRequest)
+			return
+		}
+		recordedOn = req.RecordedOn
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO credit_scores (user_id, score, bureau, recorded_on, note, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, *req.Score, sql.NullString{String: bureau, Valid: bureau != ""}, recordedOn, sql.NullString{String: note, Valid: note != ""}, now)
+	if err != nil {
+		jsonError(w, "Failed to record credit score", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityCreditScore,
+		Action:   "recorded",
+		EntityID: &id,
+		Summary:  fmt.Sprintf("Recorded a credit score of %d", *req.Score),
+		Details:  map[string]interface{}{"score": *req.Score, "bureau": bureau, "recorded_on": recordedOn},
+	})
+
+	jsonResponse(w, models.CreditScore{
+		ID:         id,
+		Score:      *req.Score,
+		Bureau:     bureau,
+		RecordedOn: recordedOn,
+		Note:       note,
+		CreatedAt:  now,
+	}, http.StatusCreated)
+}
+
+// Delete removes a recorded credit score
+func (h *CreditScoreHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid credit score ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM credit_scores WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		jsonError(w, "Failed to delete credit score", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Credit score not found", http.StatusNotFound)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityCreditScore,
+		Action:   "deleted",
+		EntityID: &id,
+		Summary:  "Deleted a credit score",
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetReminders turns on or off the reminder to record a new score once the
+// latest is a quarter old
+func (h *CreditScoreHandler) SetReminders(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreditScoreRemindersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.db.ExecContext(ctx, "UPDATE users SET credit_score_reminders = ? WHERE id = ?", req.Enabled, userID); err != nil {
+		jsonError(w, "Failed to update reminders", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, map[string]bool{"reminders": req.Enabled}, http.StatusOK)
+}
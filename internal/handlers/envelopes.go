@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// maxEnvelopes keeps an account's envelope list manageable
+const maxEnvelopes = 20
+
+// ListEnvelopes returns an account's envelopes with their balances and the
+// part of the account balance no envelope claims
+func (h *AccountHandler) ListEnvelopes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.envelopeAccount(w, r)
+	if !ok {
+		return
+	}
+
+	envelopes, err := h.envelopes(ctx, account.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch envelopes", http.StatusInternalServerError)
+		return
+	}
+
+	summary := models.EnvelopeSummary{
+		AccountID: account.ID,
+		Currency:  account.Currency,
+		Balance:   account.CurrentBalance,
+		Envelopes: envelopes,
+	}
+	for _, e := range envelopes {
+		summary.Allocated += e.Balance
+	}
+	summary.Allocated = math.Round(summary.Allocated*100) / 100
+	summary.Unallocated = math.Round((summary.Balance-summary.Allocated)*100) / 100
+
+	jsonResponse(w, summary, http.StatusOK)
+}
+
+// CreateEnvelope adds an envelope to an asset account
+func (h *AccountHandler) CreateEnvelope(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.envelopeAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.EnvelopeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var name string
+	if req.Name != nil {
+		name = *req.Name
+	}
+	name, err := models.ValidateEnvelopeName(name)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.TargetAmount != nil && *req.TargetAmount < 0 {
+		jsonError(w, "Target amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if req.TargetAmount != nil && *req.TargetAmount == 0 {
+		req.TargetAmount = nil
+	}
+
+	var count int
+	if err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM envelopes WHERE account_id = ?", account.ID).Scan(&count); err != nil {
+		jsonError(w, "Failed to fetch envelopes", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxEnvelopes {
+		jsonError(w, "Too many envelopes for this account", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx,
+		"INSERT INTO envelopes (account_id, name, target_amount, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+		account.ID, name, req.TargetAmount, now, now)
+	if err != nil {
+		jsonError(w, "Failed to create envelope", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	envelope, err := h.envelopeByID(ctx, account.ID, id)
+	if err != nil {
+		jsonError(w, "Failed to fetch envelope", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, envelope, http.StatusCreated)
+}
+
+// UpdateEnvelope renames an envelope or changes its target
+func (h *AccountHandler) UpdateEnvelope(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.envelopeAccount(w, r)
+	if !ok {
+		return
+	}
+	envelope, ok := h.envelopeFromURL(w, r, account.ID)
+	if !ok {
+		return
+	}
+
+	var req models.EnvelopeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := envelope.Name
+	if req.Name != nil {
+		var err error
+		if name, err = models.ValidateEnvelopeName(*req.Name); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	target := envelope.TargetAmount
+	if req.TargetAmount != nil {
+		if *req.TargetAmount < 0 {
+			jsonError(w, "Target amount cannot be negative", http.StatusBadRequest)
+			return
+		}
+		target = req.TargetAmount
+		if *target == 0 {
+			target = nil
+		}
+	}
+
+	_, err := h.db.ExecContext(ctx,
+		"UPDATE envelopes SET name = ?, target_amount = ?, updated_at = ? WHERE id = ?",
+		name, target, time.Now(), envelope.ID)
+	if err != nil {
+		jsonError(w, "Failed to update envelope", http.StatusInternalServerError)
+		return
+	}
+
+	envelope, err = h.envelopeByID(ctx, account.ID, envelope.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch envelope", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, envelope, http.StatusOK)
+}
+
+// DeleteEnvelope removes an envelope and its allocations. The money stays in
+// the account and becomes unallocated.
+func (h *AccountHandler) DeleteEnvelope(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.envelopeAccount(w, r)
+	if !ok {
+		return
+	}
+	envelope, ok := h.envelopeFromURL(w, r, account.ID)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM envelope_allocations WHERE envelope_id = ?", envelope.ID); err != nil {
+		jsonError(w, "Failed to delete envelope", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM envelopes WHERE id = ?", envelope.ID); err != nil {
+		jsonError(w, "Failed to delete envelope", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAllocations returns an envelope's allocations, newest first
+func (h *AccountHandler) ListAllocations(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.envelopeAccount(w, r)
+	if !ok {
+		return
+	}
+	envelope, ok := h.envelopeFromURL(w, r, account.ID)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, envelope_id, transaction_id, amount, COALESCE(note, ''), created_at
+		FROM envelope_allocations
+		WHERE envelope_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, envelope.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch allocations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	allocations := []models.EnvelopeAllocation{}
+	for rows.Next() {
+		var a models.EnvelopeAllocation
+		var transactionID sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.EnvelopeID, &transactionID, &a.Amount, &a.Note, &a.CreatedAt); err != nil {
+			continue
+		}
+		if transactionID.Valid {
+			a.TransactionID = &transactionID.Int64
+		}
+		allocations = append(allocations, a)
+	}
+
+	jsonResponse(w, allocations, http.StatusOK)
+}
+
+// Allocate moves money into an envelope (positive amount) or releases it back
+// to the account (negative amount). Envelopes can't go below zero, and money
+// can only be allocated while the account has unallocated balance to cover it.
+func (h *AccountHandler) Allocate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.envelopeAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.AllocateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Amount = math.Round(req.Amount*100) / 100
+	if req.Amount == 0 {
+		jsonError(w, "Allocation amount cannot be zero", http.StatusBadRequest)
+		return
+	}
+
+	if req.TransactionID != nil {
+		var exists bool
+		err := h.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM transactions WHERE id = ? AND account_id = ?)", *req.TransactionID, account.ID).Scan(&exists)
+		if err != nil || !exists {
+			jsonError(w, "Transaction not found in this account", http.StatusNotFound)
+			return
+		}
+	}
+
+	// Hold the account lock so the balance checks below see every allocation
+	unlock := h.locker.Lock(account.ID)
+	defer unlock()
+
+	// Re-read under the lock in case a transaction changed the balance
+	account, err := h.getAccountByID(ctx, account.ID, account.UserID)
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+	envelope, ok := h.envelopeFromURL(w, r, account.ID)
+	if !ok {
+		return
+	}
+
+	if req.Amount < 0 && envelope.Balance+req.Amount < -0.005 {
+		jsonError(w, "Cannot release more than the envelope holds", http.StatusBadRequest)
+		return
+	}
+	if req.Amount > 0 {
+		var allocated float64
+		err := h.db.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(al.amount), 0)
+			FROM envelope_allocations al
+			JOIN envelopes e ON al.envelope_id = e.id
+			WHERE e.account_id = ?
+		`, account.ID).Scan(&allocated)
+		if err != nil {
+			jsonError(w, "Failed to fetch envelopes", http.StatusInternalServerError)
+			return
+		}
+		if allocated+req.Amount > account.CurrentBalance+0.005 {
+			jsonError(w, "Not enough unallocated balance in this account", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var note interface{}
+	if req.Note != "" {
+		note = req.Note
+	}
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx,
+		"INSERT INTO envelope_allocations (envelope_id, transaction_id, amount, note, created_at) VALUES (?, ?, ?, ?, ?)",
+		envelope.ID, req.TransactionID, req.Amount, note, now)
+	if err != nil {
+		jsonError(w, "Failed to record allocation", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	jsonResponse(w, models.EnvelopeAllocation{
+		ID:            id,
+		EnvelopeID:    envelope.ID,
+		TransactionID: req.TransactionID,
+		Amount:        req.Amount,
+		Note:          req.Note,
+		CreatedAt:     now,
+	}, http.StatusCreated)
+}
+
+// envelopeAccount loads the account in the URL and checks it can hold
+// envelopes, writing the error response when it can't
+func (h *AccountHandler) envelopeAccount(w http.ResponseWriter, r *http.Request) (*models.Account, bool) {
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !account.IsAssetAccount() || account.Type == models.AccountTypeAsset {
+		jsonError(w, "Envelopes are only available for cash, debit, savings, and investment accounts", http.StatusBadRequest)
+		return nil, false
+	}
+	return account, true
+}
+
+// envelopeFromURL loads the envelope in the URL, writing the error response
+// when it isn't one of the account's envelopes
+func (h *AccountHandler) envelopeFromURL(w http.ResponseWriter, r *http.Request, accountID int64) (*models.Envelope, bool) {
+	envelopeID, err := strconv.ParseInt(chi.URLParam(r, "envelopeID"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid envelope ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	envelope, err := h.envelopeByID(r.Context(), accountID, envelopeID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Envelope not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch envelope", http.StatusInternalServerError)
+		return nil, false
+	}
+	return envelope, true
+}
+
+const envelopeQuery = `
+	SELECT e.id, e.account_id, e.name, e.target_amount, e.created_at, e.updated_at,
+	       COALESCE((SELECT SUM(al.amount) FROM envelope_allocations al WHERE al.envelope_id = e.id), 0)
+	FROM envelopes e
+`
+
+// envelopes returns an account's envelopes in creation order
+func (h *AccountHandler) envelopes(ctx context.Context, accountID int64) ([]models.Envelope, error) {
+	rows, err := h.db.QueryContext(ctx, envelopeQuery+" WHERE e.account_id = ? ORDER BY e.id", accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	envelopes := []models.Envelope{}
+	for rows.Next() {
+		e, err := scanEnvelope(rows)
+		if err != nil {
+			return nil, err
+		}
+		envelopes = append(envelopes, *e)
+	}
+	return envelopes, rows.Err()
+}
+
+func (h *AccountHandler) envelopeByID(ctx context.Context, accountID, envelopeID int64) (*models.Envelope, error) {
+	row := h.db.QueryRowContext(ctx, envelopeQuery+" WHERE e.id = ? AND e.account_id = ?", envelopeID, accountID)
+	return scanEnvelope(row)
+}
+
+func scanEnvelope(row rowScanner) (*models.Envelope, error) {
+	var e models.Envelope
+	var target sql.NullFloat64
+	if err := row.Scan(&e.ID, &e.AccountID, &e.Name, &target, &e.CreatedAt, &e.UpdatedAt, &e.Balance); err != nil {
+		return nil, err
+	}
+	e.Balance = math.Round(e.Balance*100) / 100
+	if target.Valid {
+		e.TargetAmount = &target.Float64
+		progress := math.Round(math.Min(e.Balance/target.Float64, 1)*10000) / 100
+		e.Progress = &progress
+	}
+	return &e, nil
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// userDataTables lists every table holding a user's data, in the order rows
+// are deleted (children before parents). Each query selects the user's rows
+// for export and the matching delete removes them. New tables holding user
+// data (attachments included) must be added here.
+var userDataTables = []struct {
+	name   string
+	query  string
+	delete string
+}{
+	{"pinned_items", "SELECT * FROM pinned_items WHERE user_id = ?", "DELETE FROM pinned_items WHERE user_id = ?"},
+	{"audit_log", "SELECT * FROM audit_log WHERE user_id = ?", "DELETE FROM audit_log WHERE user_id = ?"},
+	{
+		"attachments",
+		"SELECT id, transaction_id, filename, content_type, size, created_at FROM attachments WHERE user_id = ?",
+		"DELETE FROM attachments WHERE user_id = ?",
+	},
+	{"telegram_links", "SELECT * FROM telegram_links WHERE user_id = ?", "DELETE FROM telegram_links WHERE user_id = ?"},
+	{"telegram_link_codes", "", "DELETE FROM telegram_link_codes WHERE user_id = ?"},
+	{"custom_exchange_rates", "SELECT * FROM custom_exchange_rates WHERE user_id = ?", "DELETE FROM custom_exchange_rates WHERE user_id = ?"},
+	{"balance_alerts", "SELECT * FROM balance_alerts WHERE user_id = ?", "DELETE FROM balance_alerts WHERE user_id = ?"},
+	{"insurance_policies", "SELECT * FROM insurance_policies WHERE user_id = ?", "DELETE FROM insurance_policies WHERE user_id = ?"},
+	{
+		"bill_payments",
+		"SELECT * FROM bill_payments WHERE bill_id IN (SELECT id FROM bills WHERE user_id = ?)",
+		"DELETE FROM bill_payments WHERE bill_id IN (SELECT id FROM bills WHERE user_id = ?)",
+	},
+	{"bills", "SELECT * FROM bills WHERE user_id = ?", "DELETE FROM bills WHERE user_id = ?"},
+	{"notifications", "SELECT * FROM notifications WHERE user_id = ?", "DELETE FROM notifications WHERE user_id = ?"},
+	{"notification_preferences", "SELECT * FROM notification_preferences WHERE user_id = ?", "DELETE FROM notification_preferences WHERE user_id = ?"},
+	{"credit_scores", "SELECT * FROM credit_scores WHERE user_id = ?", "DELETE FROM credit_scores WHERE user_id = ?"},
+	{"budget_allocations", "SELECT * FROM budget_allocations WHERE user_id = ?", "DELETE FROM budget_allocations WHERE user_id = ?"},
+	{"budget_versions", "SELECT * FROM budget_versions WHERE user_id = ?", "DELETE FROM budget_versions WHERE user_id = ?"},
+	{"category_budgets", "SELECT * FROM category_budgets WHERE user_id = ?", "DELETE FROM category_budgets WHERE user_id = ?"},
+	{"tax_categories", "SELECT * FROM tax_categories WHERE user_id = ?", "DELETE FROM tax_categories WHERE user_id = ?"},
+	{"profiles", "SELECT * FROM profiles WHERE user_id = ?", "DELETE FROM profiles WHERE user_id = ?"},
+	// Grants the user gave and the ones they were given as an advisor
+	{
+		"advisor_grant_accounts",
+		"SELECT * FROM advisor_grant_accounts WHERE grant_id IN (SELECT id FROM advisor_grants WHERE user_id = ?)",
+		"DELETE FROM advisor_grant_accounts WHERE grant_id IN (SELECT id FROM advisor_grants WHERE ? IN (user_id, advisor_id))",
+	},
+	{"advisor_grants", "SELECT * FROM advisor_grants WHERE user_id = ?", "DELETE FROM advisor_grants WHERE ? IN (user_id, advisor_id)"},
+	{"feature_usage", "SELECT * FROM feature_usage WHERE user_id = ?", "DELETE FROM feature_usage WHERE user_id = ?"},
+	{"report_webhooks", "SELECT id, user_id, url, weekday, last_period, attempts, last_attempt_at, last_error, created_at, updated_at FROM report_webhooks WHERE user_id = ?", "DELETE FROM report_webhooks WHERE user_id = ?"},
+	{"api_keys", "SELECT id, user_id, profile_id, name, hint, last_used_at, created_at FROM api_keys WHERE user_id = ?", "DELETE FROM api_keys WHERE user_id = ?"},
+	{"insights", "SELECT * FROM insights WHERE user_id = ?", "DELETE FROM insights WHERE user_id = ?"},
+	{"balance_feeds", "SELECT id, user_id, account_id, name, last_balance, last_signed_at, last_received_at, created_at FROM balance_feeds WHERE user_id = ?", "DELETE FROM balance_feeds WHERE user_id = ?"},
+	{"feature_flags", "SELECT * FROM feature_flags WHERE user_id = ?", "DELETE FROM feature_flags WHERE user_id = ?"},
+	{"fx_conversions", "SELECT * FROM fx_conversions WHERE user_id = ?", "DELETE FROM fx_conversions WHERE user_id = ?"},
+	{
+		"envelope_allocations",
+		"SELECT * FROM envelope_allocations WHERE envelope_id IN (SELECT e.id FROM envelopes e JOIN accounts a ON e.account_id = a.id WHERE a.user_id = ?)",
+		"DELETE FROM envelope_allocations WHERE envelope_id IN (SELECT e.id FROM envelopes e JOIN accounts a ON e.account_id = a.id WHERE a.user_id = ?)",
+	},
+	{
+		"envelopes",
+		"SELECT * FROM envelopes WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		"DELETE FROM envelopes WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+	},
+	{
+		"asset_valuations",
+		"SELECT * FROM asset_valuations WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		"DELETE FROM asset_valuations WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+	},
+	{
+		"asset_depreciation",
+		"SELECT * FROM asset_depreciation WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		"DELETE FROM asset_depreciation WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+	},
+	{
+		"account_snapshots",
+		"SELECT * FROM account_snapshots WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		"DELETE FROM account_snapshots WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+	},
+	{
+		"transactions",
+		"SELECT * FROM transactions WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+		"DELETE FROM transactions WHERE account_id IN (SELECT id FROM accounts WHERE user_id = ?)",
+	},
+	{"accounts", "SELECT * FROM accounts WHERE user_id = ?", "DELETE FROM accounts WHERE user_id = ?"},
+	{"sync_mutations", "", "DELETE FROM sync_mutations WHERE user_id = ?"},
+	// After accounts and transactions, whose deletes add tombstones here
+	{"sync_changes", "", "DELETE FROM sync_changes WHERE user_id = ?"},
+	// Invites stay for the admins' records, without the address they were for
+	{"invites", "", "UPDATE invites SET email = NULL WHERE used_by = ?"},
+	{"announcements", "", "UPDATE announcements SET created_by = NULL WHERE created_by = ?"},
+	{"sessions", "", "DELETE FROM sessions WHERE user_id = ?"},
+	{"refresh_tokens", "", "DELETE FROM refresh_tokens WHERE user_id = ?"},
+	{
+		"user",
+		"SELECT id, email, name, preferred_currency, monthly_budget, created_at FROM users WHERE id = ?",
+		"DELETE FROM users WHERE id = ?",
+	},
+}
+
+// DeleteMe permanently erases the current user and everything they own. The
+// password must be confirmed, and the whole erase runs in one database
+// transaction so a failure leaves the account untouched.
+func (h *AuthHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	cookie, err := r.Cookie("session_id")
+	if err != nil {
+		jsonError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.sessions.Get(ctx, cookie.Value)
+	if errors.Is(err, middleware.ErrSessionNotFound) || (err == nil && time.Now().After(session.ExpiresAt)) {
+		jsonError(w, "Session not found", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to get session", http.StatusInternalServerError)
+		return
+	}
+
+	userID := session.UserID
+	var passwordHash string
+	err = h.db.QueryRowContext(ctx, "SELECT password_hash FROM users WHERE id = ?", userID).Scan(&passwordHash)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Session not found", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to get user", http.StatusInternalServerError)
+		return
+	}
+
+	if !services.CheckPassword(passwordHash, req.Password) {
+		jsonError(w, "Incorrect password", http.StatusForbidden)
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Export first, inside the same transaction, so the copy matches exactly
+	// what gets deleted
+	var export map[string]interface{}
+	if req.Export {
+		export = map[string]interface{}{"exported_at": time.Now()}
+		for _, table := range userDataTables {
+			if table.query == "" {
+				continue
+			}
+			rows, err := exportRows(ctx, tx, table.query, userID)
+			if err != nil {
+				jsonError(w, "Failed to export data", http.StatusInternalServerError)
+				return
+			}
+			if table.name == "transactions" {
+				for _, row := range rows {
+					for _, column := range []string{"description", "notes", "place_name"} {
+						if v, ok := row[column].(string); ok {
+							row[column] = services.DecryptField(userID, v)
+						}
+					}
+					for _, column := range []string{"latitude", "longitude"} {
+						if v, ok := row[column].(string); ok {
+							if c := decryptCoordinate(userID, sql.NullString{String: v, Valid: true}); c.Valid {
+								row[column] = c.Float64
+							}
+						}
+					}
+				}
+			}
+			if table.name == "user" && len(rows) > 0 {
+				export[table.name] = rows[0]
+				continue
+			}
+			export[table.name] = rows
+		}
+	}
+
+	for _, table := range userDataTables {
+		if _, err := tx.ExecContext(ctx, table.delete, userID); err != nil {
+			jsonError(w, "Failed to delete account", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	// Sessions kept outside the database weren't deleted with the rest
+	if err := h.sessions.DeleteUser(ctx, userID); err != nil {
+		log.Printf("Warning: Failed to delete sessions of erased user %d: %v", userID, err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	response := map[string]interface{}{"message": "Account deleted"}
+	if export != nil {
+		response["export"] = export
+	}
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// exportRows returns the query's rows as column name to value maps
+func exportRows(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
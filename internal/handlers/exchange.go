@@ -1,12 +1,23 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
 	"github.com/kengru/odin-wallet/internal/services"
 )
 
+// ratesMaxAge is how long clients may reuse rate responses without asking.
+// Fetched rates change once a day; a custom rate set in the meantime shows
+// up once this runs out.
+const ratesMaxAge = 5 * time.Minute
+
 type ExchangeHandler struct {
 	exchangeService *services.ExchangeService
 }
@@ -15,19 +26,34 @@ func NewExchangeHandler(exchangeService *services.ExchangeService) *ExchangeHand
 	return &ExchangeHandler{exchangeService: exchangeService}
 }
 
-// GetRates returns all exchange rates for a base currency
+// GetRates returns all exchange rates for a base currency, with the user's
+// custom rates in place of fetched ones and listed under "custom"
 func (h *ExchangeHandler) GetRates(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
 	base := r.URL.Query().Get("base")
 	if base == "" {
 		base = "USD" // Default to USD
 	}
 
-	rates := h.exchangeService.GetAllRates(base)
+	rates := h.exchangeService.GetAllRatesFor(userID, base)
+	h.setCacheControl(w, userID)
 	jsonResponse(w, rates, http.StatusOK)
 }
 
-// Convert converts an amount between currencies
+// Convert converts an amount between currencies, flagging conversions that
+// used a custom rate
 func (h *ExchangeHandler) Convert(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
 	from := r.URL.Query().Get("from")
 	to := r.URL.Query().Get("to")
 	amountStr := r.URL.Query().Get("amount")
@@ -43,21 +69,105 @@ func (h *ExchangeHandler) Convert(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	converted, err := h.exchangeService.Convert(amount, from, to)
-	if err != nil {
-		jsonError(w, err.Error(), http.StatusNotFound)
+	rate, custom, ok := h.exchangeService.GetRateFor(userID, from, to)
+	if !ok {
+		jsonError(w, fmt.Sprintf("exchange rate not found for %s->%s", from, to), http.StatusNotFound)
 		return
 	}
 
+	h.setCacheControl(w, userID)
 	jsonResponse(w, map[string]interface{}{
 		"from":      from,
 		"to":        to,
 		"amount":    amount,
-		"converted": converted,
-		"rate":      converted / amount,
+		"converted": amount * rate,
+		"rate":      rate,
+		"custom":    custom,
 	}, http.StatusOK)
 }
 
+// setCacheControl lets clients reuse rate responses for ratesMaxAge. Users
+// with custom rates revalidate every time, since theirs change whenever
+// they edit them.
+func (h *ExchangeHandler) setCacheControl(w http.ResponseWriter, userID int64) {
+	if h.exchangeService.HasCustomRates(userID) {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		return
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ratesMaxAge.Seconds())))
+}
+
+// ListCustomRates returns the rates the user pinned
+func (h *ExchangeHandler) ListCustomRates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rates, err := h.exchangeService.ListCustomRates(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch custom rates", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, rates, http.StatusOK)
+}
+
+// SetCustomRate pins a rate for a currency pair, overriding the fetched rate
+// in the user's conversions until it is removed
+func (h *ExchangeHandler) SetCustomRate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetCustomRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Normalize(); err != nil {
+		jsonError(w, "Invalid custom rate: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rate, err := h.exchangeService.SetCustomRate(ctx, userID, req.Base, req.Target, req.Rate)
+	if err != nil {
+		jsonError(w, "Failed to save custom rate", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, rate, http.StatusOK)
+}
+
+// DeleteCustomRate removes a pinned rate, going back to the fetched one
+func (h *ExchangeHandler) DeleteCustomRate(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	base := strings.ToUpper(chi.URLParam(r, "base"))
+	target := strings.ToUpper(chi.URLParam(r, "target"))
+	deleted, err := h.exchangeService.DeleteCustomRate(ctx, userID, base, target)
+	if err != nil {
+		jsonError(w, "Failed to delete custom rate", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		jsonError(w, "Custom rate not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func parseFloat(s string, f *float64) (bool, error) {
 	_, err := fmt.Sscanf(s, "%f", f)
 	return err == nil, err
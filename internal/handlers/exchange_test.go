@@ -0,0 +1,34 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestExchangeRatesCacheControl(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+
+	for _, path := range []string{"/api/exchange-rates?base=USD", "/api/exchange-rates/convert?from=USD&to=USD&amount=10"} {
+		if got := c.Get(path).Expect(http.StatusOK).Header.Get("Cache-Control"); got != "private, max-age=300" {
+			t.Errorf("%s: Cache-Control = %q, want private, max-age=300", path, got)
+		}
+	}
+
+	// Custom rates can change at any time, so they're always revalidated
+	c.Put("/api/exchange/custom", models.SetCustomRateRequest{Base: "USD", Target: "DOP", Rate: 60}).Expect(http.StatusOK)
+	resp := c.Get("/api/exchange-rates?base=USD").Expect(http.StatusOK)
+	if got := resp.Header.Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("Cache-Control with custom rates = %q, want private, no-cache", got)
+	}
+	var rates struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	resp.Decode(&rates)
+	if rates.Rates["DOP"] != 60 {
+		t.Errorf("USD->DOP = %v, want the custom 60", rates.Rates["DOP"])
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type ExportHandler struct {
+	db *sql.DB
+}
+
+func NewExportHandler(db *sql.DB) *ExportHandler {
+	return &ExportHandler{db: db}
+}
+
+// ledgerAccountGroups places each account type in the chart of accounts
+var ledgerAccountGroups = map[models.AccountType][]string{
+	models.AccountTypeCash:       {"Assets", "Cash"},
+	models.AccountTypeDebit:      {"Assets", "Bank"},
+	models.AccountTypeSaving:     {"Assets", "Savings"},
+	models.AccountTypeInvestment: {"Assets", "Investments"},
+	models.AccountTypeAsset:      {"Assets", "Property"},
+	models.AccountTypeCreditCard: {"Liabilities", "Credit Cards"},
+	models.AccountTypeLoan:       {"Liabilities", "Loans"},
+}
+
+// exportTransaction is a transaction as the ledger export needs it
+type exportTransaction struct {
+	id          int64
+	accountID   int64
+	txType      models.TransactionType
+	amount      float64
+	description string
+	category    string
+	linkedID    sql.NullInt64
+	createdAt   time.Time
+}
+
+// Ledger exports the current profile's accounts and transactions as a
+// plain-text accounting file, ?format=beancount (the default) or ledger.
+// Transfers become one transaction moving money between both accounts, at
+// the rate that was used when the currencies differ; everything else is
+// balanced against an Income, Expenses or Equity account for its category.
+func (h *ExportHandler) Ledger(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	format := services.LedgerFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = services.LedgerBeancount
+	}
+	if format != services.LedgerBeancount && format != services.LedgerLedger {
+		jsonError(w, "Invalid format. Use beancount or ledger", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, type, currency
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ?
+		ORDER BY id
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	names := make(map[int64]string)
+	accountCurrency := make(map[int64]string)
+	currencies := make(map[string]string)
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var id int64
+		var name, currency string
+		var accountType models.AccountType
+		if err := rows.Scan(&id, &name, &accountType, &currency); err != nil {
+			continue
+		}
+		group, ok := ledgerAccountGroups[accountType]
+		if !ok {
+			group = []string{"Assets", "Other"}
+		}
+		ledgerName := services.LedgerAccountName(append(group, name)...)
+		// Accounts whose names only differ in punctuation would collide
+		if taken[ledgerName] {
+			ledgerName += "-" + strconv.FormatInt(id, 10)
+		}
+		taken[ledgerName] = true
+		names[id] = ledgerName
+		accountCurrency[id] = currency
+		currencies[ledgerName] = currency
+	}
+	rows.Close()
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT t.id, t.account_id, t.type, t.amount, COALESCE(t.description, ''), COALESCE(t.category, 'other'),
+		       t.linked_transaction_id, t.created_at
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?
+		ORDER BY t.created_at, t.id
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	var transactions []exportTransaction
+	byID := make(map[int64]int)
+	for rows.Next() {
+		var t exportTransaction
+		if err := rows.Scan(&t.id, &t.accountID, &t.txType, &t.amount, &t.description, &t.category, &t.linkedID, &t.createdAt); err != nil {
+			continue
+		}
+		t.description = services.DecryptField(userID, t.description)
+		byID[t.id] = len(transactions)
+		transactions = append(transactions, t)
+	}
+	rows.Close()
+
+	var entries []services.LedgerTransaction
+	written := make(map[int64]bool)
+	for _, t := range transactions {
+		if written[t.id] {
+			continue
+		}
+		narration := t.description
+		if narration == "" {
+			narration = categoryLabel(t.category)
+		}
+		entry := services.LedgerTransaction{Date: t.createdAt, Narration: narration}
+		posting := services.LedgerPosting{
+			Account:  names[t.accountID],
+			Amount:   ledgerValue(t),
+			Currency: accountCurrency[t.accountID],
+		}
+
+		// The other side of a transfer, when it's part of the export
+		if i, ok := byID[t.linkedID.Int64]; t.linkedID.Valid && ok {
+			other := transactions[i]
+			written[other.id] = true
+			counter := services.LedgerPosting{
+				Account:  names[other.accountID],
+				Amount:   ledgerValue(other),
+				Currency: accountCurrency[other.accountID],
+			}
+			if counter.Currency != posting.Currency {
+				posting.Cost, posting.CostCurrency = math.Abs(counter.Amount), counter.Currency
+			}
+			entry.Postings = []services.LedgerPosting{posting, counter}
+		} else {
+			entry.Postings = []services.LedgerPosting{posting, {Account: counterAccount(t, posting.Amount)}}
+		}
+		entries = append(entries, entry)
+	}
+
+	var buf bytes.Buffer
+	title := "Odin Wallet export " + time.Now().Format("2006-01-02")
+	if err := services.WriteLedger(&buf, format, title, currencies, entries); err != nil {
+		jsonError(w, "Failed to write export", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="odin-wallet.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// ledgerValue is how much a transaction adds to its account's value: what
+// comes into an asset, or what's paid off a liability. Revaluations are
+// already signed.
+func ledgerValue(t exportTransaction) float64 {
+	switch t.txType {
+	case models.TransactionTypeDeposit, models.TransactionTypePayment, models.TransactionTypeRevalue:
+		return t.amount
+	default:
+		return -t.amount
+	}
+}
+
+// counterAccount is the account that balances a transaction with no other
+// side in the export
+func counterAccount(t exportTransaction, amount float64) string {
+	switch {
+	case t.category == string(models.CategoryOpeningBalance):
+		return "Equity:Opening-Balances"
+	case t.txType == models.TransactionTypeRevalue:
+		return "Income:Revaluation"
+	case t.category == string(models.CategoryTransfer):
+		return "Equity:Transfers"
+	case amount > 0:
+		return services.LedgerAccountName("Income", t.category)
+	default:
+		return services.LedgerAccountName("Expenses", t.category)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type FeatureHandler struct {
+	flags *services.FeatureFlags
+}
+
+func NewFeatureHandler(flags *services.FeatureFlags) *FeatureHandler {
+	return &FeatureHandler{flags: flags}
+}
+
+// List returns every feature flag as the user gets it, so the frontend can
+// hide what's switched off
+func (h *FeatureHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	features, err := h.flags.ForUser(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch features", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, features, http.StatusOK)
+}
+
+// AdminList returns the deployment defaults and every per-user override
+func (h *FeatureHandler) AdminList(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.flags.ListOverrides(r.Context())
+	if err != nil {
+		jsonError(w, "Failed to fetch feature overrides", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, models.FeatureFlagsResponse{Defaults: h.flags.Defaults(), Overrides: overrides}, http.StatusOK)
+}
+
+// SetOverride turns a feature on or off for one user
+func (h *FeatureHandler) SetOverride(w http.ResponseWriter, r *http.Request) {
+	feature, userID, ok := featureParams(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.SetFeatureOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.flags.SetOverride(r.Context(), userID, feature, req.Enabled)
+	if err != nil {
+		jsonError(w, "Failed to save feature override", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		jsonError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ClearOverride puts a user back on the deployment default for a feature
+func (h *FeatureHandler) ClearOverride(w http.ResponseWriter, r *http.Request) {
+	feature, userID, ok := featureParams(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.flags.ClearOverride(r.Context(), userID, feature)
+	if err != nil {
+		jsonError(w, "Failed to delete feature override", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		jsonError(w, "Feature override not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func featureParams(w http.ResponseWriter, r *http.Request) (models.Feature, int64, bool) {
+	feature := models.Feature(chi.URLParam(r, "feature"))
+	if !feature.IsValid() {
+		jsonError(w, "Unknown feature", http.StatusNotFound)
+		return "", 0, false
+	}
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid user ID", http.StatusBadRequest)
+		return "", 0, false
+	}
+	return feature, userID, true
+}
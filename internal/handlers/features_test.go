@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestFeatureFlagOverrides(t *testing.T) {
+	cfg := testutil.DefaultConfig()
+	cfg.AdminEmails = []string{"admin@example.com"}
+	cfg.FeatureDefaults = map[models.Feature]bool{models.FeatureBankFeeds: false}
+	app := testutil.NewAppWithConfig(t, cfg)
+	admin := app.Register(t, "admin@example.com")
+	ana := app.Register(t, "ana@example.com")
+
+	var features map[models.Feature]bool
+	ana.Get("/api/user/features").Expect(http.StatusOK).Decode(&features)
+	if features[models.FeatureBankFeeds] || !features[models.FeatureTelegram] || !features[models.FeatureIntegrations] {
+		t.Fatalf("default features = %v, want all but bank_feeds", features)
+	}
+	// A feature that's off is answered as if its routes didn't exist
+	ana.Get("/api/integrations/balance-feeds").Expect(http.StatusNotFound)
+	ana.Get("/api/telegram").Expect(http.StatusOK)
+
+	path := func(feature models.Feature) string {
+		return fmt.Sprintf("/api/admin/features/%s/users/%d", feature, ana.User.ID)
+	}
+	ana.Put(path(models.FeatureBankFeeds), models.SetFeatureOverrideRequest{Enabled: true}).Expect(http.StatusForbidden)
+	admin.Put(path(models.FeatureBankFeeds), models.SetFeatureOverrideRequest{Enabled: true}).Expect(http.StatusNoContent)
+	admin.Put(path(models.FeatureTelegram), models.SetFeatureOverrideRequest{Enabled: false}).Expect(http.StatusNoContent)
+	admin.Put(path("teleport"), models.SetFeatureOverrideRequest{Enabled: true}).Expect(http.StatusNotFound)
+
+	ana.Get("/api/user/features").Expect(http.StatusOK).Decode(&features)
+	if !features[models.FeatureBankFeeds] || features[models.FeatureTelegram] {
+		t.Errorf("overridden features = %v, want bank_feeds without telegram", features)
+	}
+	ana.Get("/api/integrations/balance-feeds").Expect(http.StatusOK)
+	ana.Get("/api/telegram").Expect(http.StatusNotFound)
+	if app.Server.Features.Enabled(context.Background(), admin.User.ID, models.FeatureBankFeeds) {
+		t.Error("override leaked to another user")
+	}
+
+	var flags models.FeatureFlagsResponse
+	admin.Get("/api/admin/features").Expect(http.StatusOK).Decode(&flags)
+	if len(flags.Overrides) != 2 || flags.Defaults[models.FeatureBankFeeds] || !flags.Defaults[models.FeatureTelegram] {
+		t.Errorf("admin view = %+v, want 2 overrides and bank_feeds off by default", flags)
+	}
+
+	admin.Delete(path(models.FeatureTelegram)).Expect(http.StatusNoContent)
+	admin.Delete(path(models.FeatureTelegram)).Expect(http.StatusNotFound)
+	if !app.Server.Features.Enabled(context.Background(), ana.User.ID, models.FeatureTelegram) {
+		t.Error("cleared override should fall back to the deployment default")
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+)
+
+// FXCostMonth is what conversions cost in one month
+type FXCostMonth struct {
+	Month     string  `json:"month"`
+	Converted float64 `json:"converted"`
+	Margin    float64 `json:"margin"`
+	Fees      float64 `json:"fees"`
+	Count     int     `json:"count"`
+}
+
+// FXCostPair is what conversions between two currencies cost. Sent is in
+// the source currency; the rest are in the report's currency.
+type FXCostPair struct {
+	FromCurrency  string  `json:"from_currency"`
+	ToCurrency    string  `json:"to_currency"`
+	Sent          float64 `json:"sent"`
+	Converted     float64 `json:"converted"`
+	Margin        float64 `json:"margin"`
+	Fees          float64 `json:"fees"`
+	MarginPercent float64 `json:"margin_percent"`
+	Count         int     `json:"count"`
+}
+
+// FXCostReport is what the user lost to banks' exchange rates and transfer
+// fees over a date range, in the preferred currency. Converted is the
+// mid-market value of what was sent.
+type FXCostReport struct {
+	From          string        `json:"from"`
+	To            string        `json:"to"`
+	Currency      string        `json:"currency"`
+	Converted     float64       `json:"converted"`
+	Margin        float64       `json:"margin"`
+	Fees          float64       `json:"fees"`
+	Total         float64       `json:"total"`
+	MarginPercent float64       `json:"margin_percent"`
+	Months        []FXCostMonth `json:"months"`
+	Pairs         []FXCostPair  `json:"pairs"`
+}
+
+// FXCosts reports the FX margin and fees recorded on cross-currency
+// transfers between ?from= and ?to= (YYYY-MM-DD, inclusive; default the
+// last 12 months). The margin is the mid-market value of what was sent
+// minus what arrived.
+func (h *ReportHandler) FXCosts(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := reportRange(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT c.from_currency, c.to_currency, c.amount, c.received_amount, c.mid_market_amount, c.fee, c.created_at
+		FROM fx_conversions c
+		JOIN transactions t ON c.transaction_id = t.id
+		JOIN accounts a ON t.account_id = a.id
+		WHERE c.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND c.created_at >= ? AND c.created_at < ?
+		ORDER BY c.created_at
+	`, userID, middleware.GetProfileID(ctx), from.Format("2006-01-02 15:04:05"), to.AddDate(0, 0, 1).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		jsonError(w, "Failed to fetch conversions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := FXCostReport{
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Currency: currency,
+		Months:   []FXCostMonth{},
+		Pairs:    []FXCostPair{},
+	}
+	months := make(map[string]*FXCostMonth)
+	var monthOrder []string
+	pairs := make(map[string]*FXCostPair)
+	for rows.Next() {
+		var fromCurrency, toCurrency string
+		var amount, received, mid, fee float64
+		var createdAt time.Time
+		if err := rows.Scan(&fromCurrency, &toCurrency, &amount, &received, &mid, &fee, &createdAt); err != nil {
+			continue
+		}
+		converted := h.convert(userID, mid, toCurrency, currency)
+		margin := h.convert(userID, mid-received, toCurrency, currency)
+		fee = h.convert(userID, fee, fromCurrency, currency)
+
+		report.Converted += converted
+		report.Margin += margin
+		report.Fees += fee
+
+		key := createdAt.Format("2006-01")
+		month, ok := months[key]
+		if !ok {
+			month = &FXCostMonth{Month: key}
+			months[key] = month
+			monthOrder = append(monthOrder, key)
+		}
+		month.Converted += converted
+		month.Margin += margin
+		month.Fees += fee
+		month.Count++
+
+		pair, ok := pairs[fromCurrency+"_"+toCurrency]
+		if !ok {
+			pair = &FXCostPair{FromCurrency: fromCurrency, ToCurrency: toCurrency}
+			pairs[fromCurrency+"_"+toCurrency] = pair
+		}
+		pair.Sent += amount
+		pair.Converted += converted
+		pair.Margin += margin
+		pair.Fees += fee
+		pair.Count++
+	}
+
+	for _, key := range monthOrder {
+		month := months[key]
+		month.Converted = math.Round(month.Converted*100) / 100
+		month.Margin = math.Round(month.Margin*100) / 100
+		month.Fees = math.Round(month.Fees*100) / 100
+		report.Months = append(report.Months, *month)
+	}
+	for _, pair := range pairs {
+		if pair.Converted > 0 {
+			pair.MarginPercent = math.Round(pair.Margin/pair.Converted*10000) / 100
+		}
+		pair.Sent = math.Round(pair.Sent*100) / 100
+		pair.Converted = math.Round(pair.Converted*100) / 100
+		pair.Margin = math.Round(pair.Margin*100) / 100
+		pair.Fees = math.Round(pair.Fees*100) / 100
+		report.Pairs = append(report.Pairs, *pair)
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		a, b := report.Pairs[i], report.Pairs[j]
+		if a.Margin+a.Fees != b.Margin+b.Fees {
+			return a.Margin+a.Fees > b.Margin+b.Fees
+		}
+		return a.FromCurrency+a.ToCurrency < b.FromCurrency+b.ToCurrency
+	})
+
+	if report.Converted > 0 {
+		report.MarginPercent = math.Round(report.Margin/report.Converted*10000) / 100
+	}
+	report.Total = math.Round((report.Margin+report.Fees)*100) / 100
+	report.Converted = math.Round(report.Converted*100) / 100
+	report.Margin = math.Round(report.Margin*100) / 100
+	report.Fees = math.Round(report.Fees*100) / 100
+
+	jsonResponse(w, report, http.StatusOK)
+}
@@ -0,0 +1,93 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+	"github.com/kengru/odin-wallet/pkg/hooks"
+)
+
+func TestPluginHooks(t *testing.T) {
+	registry := hooks.New()
+	var mu sync.Mutex
+	var created []hooks.Transaction
+	var reports []hooks.Report
+	registry.OnTransactionCreated(func(ctx context.Context, tx hooks.Transaction) {
+		mu.Lock()
+		created = append(created, tx)
+		mu.Unlock()
+	})
+	registry.OnReportGenerated(func(ctx context.Context, r hooks.Report) {
+		mu.Lock()
+		reports = append(reports, r)
+		mu.Unlock()
+	})
+	registry.OnTransactionCreated(func(ctx context.Context, tx hooks.Transaction) {
+		panic("a broken plugin must not take the server down")
+	})
+	registry.OnImportRow(func(ctx context.Context, row *hooks.ImportRow) error {
+		if strings.Contains(row.Description, "UBER") {
+			return hooks.ErrSkipRow
+		}
+		row.Description = strings.ToLower(row.Description)
+		return nil
+	})
+
+	cfg := testutil.DefaultConfig()
+	cfg.Hooks = registry
+	app := testutil.NewAppWithConfig(t, cfg)
+	f := app.Seed(t, "ana@example.com")
+
+	f.Client.Post(fmt.Sprintf("/api/accounts/%d/transactions", f.Checking.ID), models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 1500, Category: models.CategoryGroceries, Description: "Market",
+	}).Expect(http.StatusCreated)
+	f.Client.Get("/api/reports").Expect(http.StatusOK)
+	registry.Wait()
+
+	mu.Lock()
+	if len(created) != 1 || created[0].Amount != 1500 || created[0].Currency != "DOP" || created[0].Description != "Market" {
+		t.Errorf("created hooks = %+v, want the 1500 DOP withdrawal", created)
+	}
+	if len(reports) != 1 || reports[0].Format != "json" || reports[0].ExpensesByCategory["groceries"] != 1500 {
+		t.Errorf("report hooks = %+v, want one json report with 1500 in groceries", reports)
+	}
+	mu.Unlock()
+
+	statement := "Fecha,Descripcion,Monto\n01/03/2026,SUPERMERCADO NACIONAL,-100.00\n02/03/2026,UBER TRIP,-20.00\n"
+	var result models.ImportResult
+	f.Client.Upload("/api/import", "statement.csv", []byte(statement), map[string]string{"format": "popular"}).
+		Expect(http.StatusCreated).Decode(&result)
+	if result.TransactionCount != 1 {
+		t.Fatalf("imported %d transactions, want the row the hook kept", result.TransactionCount)
+	}
+	var list models.TransactionListResponse
+	f.Client.Get(fmt.Sprintf("/api/accounts/%d/transactions", result.AccountIDs[0])).Expect(http.StatusOK).Decode(&list)
+	if len(list.Transactions) != 1 || list.Transactions[0].Description != "supermercado nacional" {
+		t.Errorf("imported transactions = %+v, want the description the hook rewrote", list.Transactions)
+	}
+}
+
+func TestImportRowHookRejectsFile(t *testing.T) {
+	registry := hooks.New()
+	registry.OnImportRow(func(ctx context.Context, row *hooks.ImportRow) error {
+		return errors.New("statements from this bank are not allowed")
+	})
+	cfg := testutil.DefaultConfig()
+	cfg.Hooks = registry
+	app := testutil.NewAppWithConfig(t, cfg)
+	c := app.Register(t, "ana@example.com")
+
+	statement := "Fecha,Descripcion,Monto\n01/03/2026,SUPERMERCADO,-100.00\n"
+	msg := c.Upload("/api/import/preview", "statement.csv", []byte(statement), map[string]string{"format": "popular"}).
+		Expect(http.StatusBadRequest).Error()
+	if msg != "Import rejected: statements from this bank are not allowed" {
+		t.Errorf("error = %q", msg)
+	}
+}
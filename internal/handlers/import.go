@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/hooks"
+)
+
+type ImportHandler struct {
+	db     *sql.DB
+	locker *services.AccountLocker
+	audit  *services.AuditService
+	hooks  *hooks.Registry
+}
+
+func NewImportHandler(db *sql.DB, locker *services.AccountLocker, audit *services.AuditService, hookRegistry *hooks.Registry) *ImportHandler {
+	return &ImportHandler{db: db, locker: locker, audit: audit, hooks: hookRegistry}
+}
+
+// Presets lists the banks whose statements can be imported, by the format
+// name that selects them
+func (h *ImportHandler) Presets(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, services.BankPresets(), http.StatusOK)
+}
+
+// Preview shows what importing a GnuCash or Money Manager EX file would
+// create, including how its categories map to ours, without saving anything
+func (h *ImportHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	book, mapping, ok := h.readImport(w, r, userID)
+	if !ok {
+		return
+	}
+
+	jsonResponse(w, book.Preview(mapping), http.StatusOK)
+}
+
+// Import creates the accounts of a GnuCash or Money Manager EX file or a
+// bank statement in the current profile, with their full transaction
+// history. A statement can instead be added to an existing account with
+// account_id.
+func (h *ImportHandler) Import(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	book, mapping, ok := h.readImport(w, r, userID)
+	if !ok {
+		return
+	}
+	if len(book.Accounts) == 0 {
+		jsonError(w, "The file has no accounts to import", http.StatusBadRequest)
+		return
+	}
+	if v := r.FormValue("account_id"); v != "" {
+		accountID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid account ID", http.StatusBadRequest)
+			return
+		}
+		h.importIntoAccount(w, r, userID, accountID, book, mapping)
+		return
+	}
+	if len(book.Entries) > 0 && !checkPeriodOpen(ctx, w, h.db, userID, book.Entries[0].Date) {
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := importBook(ctx, tx, userID, middleware.GetProfileID(ctx), book, mapping)
+	if err != nil {
+		jsonError(w, "Failed to import", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityAccount,
+		Action:  "imported",
+		Summary: fmt.Sprintf("Imported %d accounts from %s", len(result.AccountIDs), book.Format),
+		Details: map[string]interface{}{"account_ids": result.AccountIDs, "transactions": result.TransactionCount, "transfers": result.TransferCount},
+	})
+
+	jsonResponse(w, result, http.StatusCreated)
+}
+
+// importIntoAccount adds a statement's transactions to an existing account.
+// Statements overlap, so days up to the account's latest transaction are
+// taken as already recorded and skipped.
+func (h *ImportHandler) importIntoAccount(w http.ResponseWriter, r *http.Request, userID, accountID int64, book *services.ImportedBook, mapping map[string]models.TransactionCategory) {
+	ctx := r.Context()
+	if len(book.Accounts) != 1 {
+		jsonError(w, "Only bank statements can be imported into an existing account", http.StatusBadRequest)
+		return
+	}
+
+	unlock := h.locker.Lock(accountID)
+	defer unlock()
+
+	var accountType models.AccountType
+	var balance float64
+	var version int64
+	err := h.db.QueryRowContext(ctx, `
+		SELECT type, CASE type WHEN 'credit_card' THEN -COALESCE(credit_owed, 0) ELSE current_balance END, version
+		FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?
+	`, accountID, userID, middleware.GetProfileID(ctx)).Scan(&accountType, &balance, &version)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+	switch accountType {
+	case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeCreditCard:
+	default:
+		jsonError(w, "Statements can only be imported into cash, bank, savings or credit card accounts", http.StatusBadRequest)
+		return
+	}
+
+	var latest time.Time
+	err = h.db.QueryRowContext(ctx, "SELECT created_at FROM transactions WHERE account_id = ? ORDER BY created_at DESC LIMIT 1", accountID).Scan(&latest)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	var entries []services.ImportedEntry
+	skipped := 0
+	for _, e := range book.Entries {
+		switch {
+		case e.Opening:
+		case !latest.IsZero() && (!e.Date.After(latest) || sameDay(e.Date, latest)):
+			skipped++
+		default:
+			entries = append(entries, e)
+		}
+	}
+	result := &models.ImportResult{Format: book.Format, AccountIDs: []int64{accountID}, Skipped: skipped}
+	if len(entries) == 0 {
+		jsonResponse(w, result, http.StatusOK)
+		return
+	}
+	if !checkPeriodOpen(ctx, w, h.db, userID, entries[0].Date) {
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	post, err := newEntryPoster(ctx, tx, userID)
+	if err != nil {
+		jsonError(w, "Failed to import", http.StatusInternalServerError)
+		return
+	}
+	defer post.close()
+	account := &importedAccount{id: accountID, accountType: accountType, value: balance}
+	for _, e := range entries {
+		if _, err := post.post(ctx, account, e, e.Amount, book.CategoryFor(e, mapping)); err != nil {
+			jsonError(w, "Failed to import", http.StatusInternalServerError)
+			return
+		}
+		result.TransactionCount++
+	}
+
+	final := account.value
+	if accountType == models.AccountTypeCreditCard {
+		final = -final
+	}
+	err = setBalance(ctx, tx, accountID, accountType, final, version)
+	if err == errBalanceConflict {
+		balanceConflict(w)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to update account balance", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "imported",
+		EntityID: &accountID,
+		Summary:  fmt.Sprintf("Imported %d transactions from a %s statement", result.TransactionCount, book.Format),
+		Details:  map[string]interface{}{"transactions": result.TransactionCount, "skipped": skipped},
+	})
+
+	jsonResponse(w, result, http.StatusCreated)
+}
+
+// sameDay reports whether two times fall on the same calendar day
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.In(a.Location()).Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// readImport parses the multipart upload shared by Preview and Import: the
+// file, an optional format and an optional JSON object of category
+// overrides. It writes the error response when the upload is invalid.
+func (h *ImportHandler) readImport(w http.ResponseWriter, r *http.Request, userID int64) (*services.ImportedBook, map[string]models.TransactionCategory, bool) {
+	// Leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxImportSize+1<<20)
+	if err := r.ParseMultipartForm(models.MaxImportSize); err != nil {
+		jsonError(w, fmt.Sprintf("Invalid upload: files must be at most %d MB", models.MaxImportSize>>20), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		jsonError(w, "File is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxImportSize+1))
+	if err != nil {
+		jsonError(w, "Failed to read file", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if len(data) > models.MaxImportSize {
+		jsonError(w, fmt.Sprintf("Files must be at most %d MB", models.MaxImportSize>>20), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if len(data) == 0 {
+		jsonError(w, "File is empty", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	overrides := map[string]models.TransactionCategory{}
+	if v := r.FormValue("categories"); v != "" {
+		if err := json.Unmarshal([]byte(v), &overrides); err != nil {
+			jsonError(w, "Invalid categories: send an object mapping the file's categories to ours", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		for _, category := range overrides {
+			if !isValidCategory(category) || category == models.CategoryTransfer {
+				jsonError(w, "Invalid category: "+string(category), http.StatusBadRequest)
+				return nil, nil, false
+			}
+		}
+	}
+
+	book, err := services.ParseImport(data, r.FormValue("format"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if err := h.runImportHooks(r.Context(), userID, book); err != nil {
+		jsonError(w, "Import rejected: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	return book, book.Categories(overrides), true
+}
+
+// runImportHooks passes every entry of a book through the plugin hooks,
+// keeping their edits and dropping the entries they skip
+func (h *ImportHandler) runImportHooks(ctx context.Context, userID int64, book *services.ImportedBook) error {
+	if !h.hooks.HasImportRowHooks() {
+		return nil
+	}
+	entries := book.Entries[:0]
+	for _, e := range book.Entries {
+		row := hooks.ImportRow{
+			UserID:      userID,
+			Format:      book.Format,
+			Date:        e.Date,
+			Account:     e.Account,
+			Amount:      e.Amount,
+			Transfer:    e.IsTransfer(),
+			Description: e.Description,
+			Notes:       e.Notes,
+			Category:    e.Category,
+		}
+		err := h.hooks.ImportRow(ctx, &row)
+		if errors.Is(err, hooks.ErrSkipRow) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		e.Description, e.Notes, e.Category = row.Description, row.Notes, row.Category
+		entries = append(entries, e)
+	}
+	book.Entries = entries
+	return nil
+}
+
+// importBook creates the book's accounts and replays its entries in order,
+// keeping each account's running balance so every transaction has the
+// balance it left behind
+func importBook(ctx context.Context, tx *sql.Tx, userID, profileID int64, book *services.ImportedBook, mapping map[string]models.TransactionCategory) (*models.ImportResult, error) {
+	result := &models.ImportResult{Format: book.Format, AccountIDs: []int64{}}
+
+	accounts := make(map[string]*importedAccount)
+	opened := make(map[string]time.Time)
+	for _, e := range book.Entries {
+		for _, key := range []string{e.Account, e.ToAccount} {
+			if first, ok := opened[key]; key != "" && (!ok || e.Date.Before(first)) {
+				opened[key] = e.Date
+			}
+		}
+	}
+
+	now := time.Now()
+	for _, a := range book.Accounts {
+		createdAt, ok := opened[a.Key]
+		if !ok {
+			createdAt = now
+		}
+		currency := a.Currency
+		if currency == "" {
+			currency = "USD"
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO accounts (user_id, name, type, currency, current_balance, profile_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 0, ?, ?, ?)
+		`, userID, a.Name, string(a.Type), currency, profileID, createdAt, now)
+		if err != nil {
+			return nil, err
+		}
+		id, _ := res.LastInsertId()
+		accounts[a.Key] = &importedAccount{id: id, accountType: a.Type}
+		result.AccountIDs = append(result.AccountIDs, id)
+	}
+
+	post, err := newEntryPoster(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer post.close()
+
+	for _, e := range book.Entries {
+		from, ok := accounts[e.Account]
+		if !ok {
+			continue
+		}
+		fromID, err := post.post(ctx, from, e, e.Amount, book.CategoryFor(e, mapping))
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsTransfer() {
+			result.TransactionCount++
+			continue
+		}
+
+		to, ok := accounts[e.ToAccount]
+		if !ok {
+			continue
+		}
+		toID, err := post.post(ctx, to, e, e.ToAmount, models.CategoryTransfer)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE transactions SET linked_transaction_id = ? WHERE id = ?", toID, fromID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE transactions SET linked_transaction_id = ? WHERE id = ?", fromID, toID); err != nil {
+			return nil, err
+		}
+		result.TransferCount++
+	}
+
+	for _, a := range accounts {
+		var err error
+		switch a.accountType {
+		case models.AccountTypeCreditCard:
+			_, err = tx.ExecContext(ctx, "UPDATE accounts SET credit_owed = ? WHERE id = ?", -a.value, a.id)
+		case models.AccountTypeLoan:
+			_, err = tx.ExecContext(ctx, "UPDATE accounts SET loan_current_owed = ?, loan_initial_amount = ? WHERE id = ?", -a.value, a.mostOwed, a.id)
+		default:
+			_, err = tx.ExecContext(ctx, "UPDATE accounts SET current_balance = ? WHERE id = ?", a.value, a.id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// importedAccount is an account entries are being replayed into
+type importedAccount struct {
+	id          int64
+	accountType models.AccountType
+	value       float64 // what the account is worth; negative for debts
+	mostOwed    float64
+}
+
+// entryPoster inserts imported entries, keeping each account's running
+// balance so every transaction has the balance it left behind
+type entryPoster struct {
+	insert *sql.Stmt
+	userID int64
+}
+
+func newEntryPoster(ctx context.Context, tx *sql.Tx, userID int64) (*entryPoster, error) {
+	insert, err := tx.PrepareContext(ctx, `
+		INSERT INTO transactions (account_id, type, amount, description, notes, category, balance_after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return &entryPoster{insert: insert, userID: userID}, nil
+}
+
+func (p *entryPoster) close() {
+	p.insert.Close()
+}
+
+// post records a change in an account's value as a transaction
+func (p *entryPoster) post(ctx context.Context, a *importedAccount, e services.ImportedEntry, amount float64, category models.TransactionCategory) (int64, error) {
+	a.value = math.Round((a.value+amount)*100) / 100
+	// Liabilities keep what's owed, which goes up as their value goes down
+	delta, balance := amount, a.value
+	if a.accountType == models.AccountTypeCreditCard || a.accountType == models.AccountTypeLoan {
+		delta, balance = -amount, -a.value
+		a.mostOwed = math.Max(a.mostOwed, balance)
+	}
+	var notes interface{}
+	if e.Notes != "" && e.Notes != e.Description {
+		notes = services.EncryptField(p.userID, e.Notes)
+	}
+	res, err := p.insert.ExecContext(ctx, a.id, string(models.BalanceChangeType(a.accountType, delta)), math.Abs(amount),
+		services.EncryptField(p.userID, e.Description), notes, string(category), balance, e.Date)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type InsightHandler struct {
+	db       *sql.DB
+	insights *services.InsightService
+}
+
+func NewInsightHandler(db *sql.DB, insights *services.InsightService) *InsightHandler {
+	return &InsightHandler{db: db, insights: insights}
+}
+
+// List returns the insights of the active profile, most recently updated
+// first. Dismissed insights are left out unless include_dismissed=true.
+func (h *InsightHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	query := `
+		SELECT id, kind, title, message, data, period, dismissed_at, created_at, updated_at
+		FROM insights
+		WHERE user_id = ? AND profile_id = ?
+	`
+	if r.URL.Query().Get("include_dismissed") != "true" {
+		query += " AND dismissed_at IS NULL"
+	}
+	query += " ORDER BY period DESC, updated_at DESC, id DESC LIMIT ?"
+
+	rows, err := h.db.QueryContext(ctx, query, userID, middleware.GetProfileID(ctx), limit)
+	if err != nil {
+		jsonError(w, "Failed to fetch insights", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	insights := []models.Insight{}
+	for rows.Next() {
+		var i models.Insight
+		var data sql.NullString
+		var dismissedAt sql.NullTime
+		if err := rows.Scan(&i.ID, &i.Kind, &i.Title, &i.Message, &data, &i.Period, &dismissedAt, &i.CreatedAt, &i.UpdatedAt); err != nil {
+			continue
+		}
+		if data.Valid {
+			i.Data = []byte(data.String)
+		}
+		if dismissedAt.Valid {
+			i.DismissedAt = &dismissedAt.Time
+		}
+		insights = append(insights, i)
+	}
+
+	jsonResponse(w, insights, http.StatusOK)
+}
+
+// Dismiss hides an insight. It stays hidden when insights are worked out
+// again, for the rest of its period.
+func (h *InsightHandler) Dismiss(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid insight ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE insights SET dismissed_at = COALESCE(dismissed_at, ?)
+		WHERE id = ? AND user_id = ? AND profile_id = ?
+	`, time.Now(), id, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to dismiss insight", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Insight not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Refresh works out the user's insights now instead of waiting for the
+// next run of the job
+func (h *InsightHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := h.insights.Generate(ctx, userID, time.Now()); err != nil {
+		jsonError(w, "Failed to work out insights", http.StatusInternalServerError)
+		return
+	}
+	h.List(w, r)
+}
@@ -0,0 +1,103 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestSpendingInsights(t *testing.T) {
+	app := testutil.NewApp(t)
+	fx := app.Seed(t, "ana@example.com")
+	bob := app.Register(t, "bob@example.com")
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	lastMonth := time.Date(2026, 2, 5, 9, 0, 0, 0, time.Local)
+	thisMonth := time.Date(2026, 3, 5, 9, 0, 0, 0, time.Local)
+
+	spend := func(amount float64, category models.TransactionCategory, at time.Time) int64 {
+		t.Helper()
+		var tx models.Transaction
+		fx.Client.Post(fmt.Sprintf("/api/accounts/%d/transactions", fx.Checking.ID), models.CreateTransactionRequest{
+			Type: models.TransactionTypeWithdrawal, Amount: amount, Category: category,
+		}).Expect(http.StatusCreated).Decode(&tx)
+		if _, err := app.DB.Exec("UPDATE transactions SET created_at = ? WHERE id = ?", at, tx.ID); err != nil {
+			t.Fatal(err)
+		}
+		return tx.ID
+	}
+	spend(1000, models.CategoryDining, lastMonth)
+	spend(500, models.CategoryGroceries, lastMonth)
+	spend(2000, models.CategoryDining, thisMonth)
+	spend(500, models.CategoryGroceries, thisMonth)
+	subscription := spend(300, models.CategorySubscriptions, thisMonth)
+
+	generate := func() {
+		t.Helper()
+		if _, err := app.Server.Insights.Generate(context.Background(), fx.Client.User.ID, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(query string) map[models.InsightKind]models.Insight {
+		t.Helper()
+		var insights []models.Insight
+		fx.Client.Get("/api/insights" + query).Expect(http.StatusOK).Decode(&insights)
+		byKind := map[models.InsightKind]models.Insight{}
+		for _, i := range insights {
+			byKind[i.Kind] = i
+		}
+		if len(byKind) != len(insights) {
+			t.Fatalf("insights = %+v, want one of each kind", insights)
+		}
+		return byKind
+	}
+
+	generate()
+	insights := list("")
+	if len(insights) != 4 {
+		t.Fatalf("insights = %+v, want total and dining changes, top category and subscriptions", insights)
+	}
+	dining := insights[models.InsightCategoryChange]
+	if dining.Title != "Dining up 100%" || dining.Period != "2026-03" {
+		t.Errorf("category change = %+v, want dining up 100%% in March", dining)
+	}
+	if got := insights[models.InsightTotalChange].Title; got != "Spending up 87%" {
+		t.Errorf("total change title = %q, want Spending up 87%%", got)
+	}
+	if got := insights[models.InsightTopCategory].Title; got != "Dining leads your spending" {
+		t.Errorf("top category title = %q", got)
+	}
+	if _, ok := insights[models.InsightSubscriptions]; !ok {
+		t.Error("subscriptions insight missing")
+	}
+
+	// Dismissed insights stay dismissed when worked out again
+	bob.Post(fmt.Sprintf("/api/insights/%d/dismiss", dining.ID), nil).Expect(http.StatusNotFound)
+	fx.Client.Post(fmt.Sprintf("/api/insights/%d/dismiss", dining.ID), nil).Expect(http.StatusNoContent)
+	generate()
+	if _, ok := list("")[models.InsightCategoryChange]; ok {
+		t.Error("dismissed insight came back")
+	}
+	if got := list("?include_dismissed=true")[models.InsightCategoryChange]; got.DismissedAt == nil {
+		t.Errorf("dismissed insight = %+v, want it listed as dismissed", got)
+	}
+
+	// Insights that no longer hold are removed
+	if _, err := app.DB.Exec("UPDATE transactions SET created_at = ? WHERE id = ?", lastMonth.AddDate(0, -3, 0), subscription); err != nil {
+		t.Fatal(err)
+	}
+	generate()
+	if _, ok := list("")[models.InsightSubscriptions]; ok {
+		t.Error("subscriptions insight outlived the subscription")
+	}
+
+	var others []models.Insight
+	bob.Get("/api/insights").Expect(http.StatusOK).Decode(&others)
+	if len(others) != 0 {
+		t.Errorf("bob's insights = %+v, want none", others)
+	}
+}
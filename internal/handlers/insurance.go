@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type InsuranceHandler struct {
+	db    *sql.DB
+	audit *services.AuditService
+}
+
+func NewInsuranceHandler(db *sql.DB, audit *services.AuditService) *InsuranceHandler {
+	return &InsuranceHandler{db: db, audit: audit}
+}
+
+const policyColumns = `p.id, p.name, p.type, COALESCE(p.provider, ''), COALESCE(p.policy_number, ''), p.premium,
+	p.premium_frequency, p.currency, p.coverage_amount, p.renewal_date, p.bill_id, COALESCE(b.name, ''),
+	COALESCE(p.notes, ''), p.created_at, p.updated_at`
+
+// List returns the user's insurance policies, soonest renewal first
+func (h *InsuranceHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+policyColumns+`
+		FROM insurance_policies p
+		LEFT JOIN bills b ON p.bill_id = b.id
+		WHERE p.user_id = ?
+		ORDER BY p.renewal_date, p.id
+	`, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch insurance policies", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	today := startOfDay(time.Now())
+	policies := []models.InsurancePolicy{}
+	for rows.Next() {
+		p, err := scanPolicy(rows, today)
+		if err != nil {
+			continue
+		}
+		policies = append(policies, *p)
+	}
+
+	jsonResponse(w, policies, http.StatusOK)
+}
+
+// Get returns one insurance policy
+func (h *InsuranceHandler) Get(w http.ResponseWriter, r *http.Request) {
+	policy, ok := h.policyFromURL(w, r)
+	if !ok {
+		return
+	}
+	jsonResponse(w, policy, http.StatusOK)
+}
+
+// Create records an insurance policy. Its currency defaults to the linked
+// bill's, or the user's preferred currency.
+func (h *InsuranceHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.InsurancePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == nil || req.Type == nil || req.Premium == nil || req.RenewalDate == nil {
+		jsonError(w, "name, type, premium and renewal_date are required", http.StatusBadRequest)
+		return
+	}
+	if req.PremiumFrequency == nil {
+		frequency := models.PremiumMonthly
+		req.PremiumFrequency = &frequency
+	}
+	if !validatePolicyRequest(w, &req) {
+		return
+	}
+
+	billCurrency, ok := h.validPolicyBill(w, ctx, userID, req.BillID)
+	if !ok {
+		return
+	}
+	if req.Currency == nil {
+		currency := billCurrency
+		if currency == "" {
+			var preferred sql.NullString
+			h.db.QueryRowContext(ctx, "SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferred)
+			currency = preferred.String
+		}
+		if currency == "" {
+			currency = "DOP"
+		}
+		req.Currency = &currency
+	}
+
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO insurance_policies (user_id, name, type, provider, policy_number, premium, premium_frequency,
+			currency, coverage_amount, renewal_date, bill_id, notes, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, *req.Name, string(*req.Type), optionalText(req.Provider), optionalText(req.PolicyNumber), *req.Premium,
+		string(*req.PremiumFrequency), *req.Currency, optionalAmount(req.CoverageAmount), *req.RenewalDate,
+		optionalID(req.BillID), optionalText(req.Notes), now, now)
+	if err != nil {
+		jsonError(w, "Failed to create insurance policy", http.StatusInternalServerError)
+		return
+	}
+	policyID, _ := result.LastInsertId()
+
+	policy, err := h.policyByID(ctx, policyID, userID)
+	if err != nil {
+		jsonError(w, "Policy created but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityInsurance,
+		Action:   "created",
+		EntityID: &policyID,
+		Summary:  fmt.Sprintf("Added insurance policy %s", policy.Name),
+		Details:  map[string]interface{}{"type": policy.Type, "premium": policy.Premium, "renewal_date": policy.RenewalDate},
+	})
+
+	jsonResponse(w, policy, http.StatusCreated)
+}
+
+// Update changes an insurance policy
+func (h *InsuranceHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	policy, ok := h.policyFromURL(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserID(ctx)
+
+	var req models.InsurancePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the policy as it will be after the update
+	merged := models.InsurancePolicyRequest{
+		Name:             &policy.Name,
+		Type:             &policy.Type,
+		Provider:         &policy.Provider,
+		PolicyNumber:     &policy.PolicyNumber,
+		Premium:          &policy.Premium,
+		PremiumFrequency: &policy.PremiumFrequency,
+		Currency:         &policy.Currency,
+		CoverageAmount:   policy.CoverageAmount,
+		RenewalDate:      &policy.RenewalDate,
+		BillID:           policy.BillID,
+		Notes:            &policy.Notes,
+	}
+	if req.Name != nil {
+		merged.Name = req.Name
+	}
+	if req.Type != nil {
+		merged.Type = req.Type
+	}
+	if req.Provider != nil {
+		merged.Provider = req.Provider
+	}
+	if req.PolicyNumber != nil {
+		merged.PolicyNumber = req.PolicyNumber
+	}
+	if req.Premium != nil {
+		merged.Premium = req.Premium
+	}
+	if req.PremiumFrequency != nil {
+		merged.PremiumFrequency = req.PremiumFrequency
+	}
+	if req.Currency != nil {
+		merged.Currency = req.Currency
+	}
+	if req.CoverageAmount != nil {
+		merged.CoverageAmount = req.CoverageAmount
+	}
+	if req.RenewalDate != nil {
+		merged.RenewalDate = req.RenewalDate
+	}
+	if req.BillID != nil {
+		merged.BillID = req.BillID
+	}
+	if req.Notes != nil {
+		merged.Notes = req.Notes
+	}
+
+	if !validatePolicyRequest(w, &merged) {
+		return
+	}
+	if req.BillID != nil {
+		if _, ok := h.validPolicyBill(w, ctx, userID, req.BillID); !ok {
+			return
+		}
+	}
+
+	_, err := h.db.ExecContext(ctx, `
+		UPDATE insurance_policies
+		SET name = ?, type = ?, provider = ?, policy_number = ?, premium = ?, premium_frequency = ?, currency = ?,
+			coverage_amount = ?, renewal_date = ?, bill_id = ?, notes = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+	`, *merged.Name, string(*merged.Type), optionalText(merged.Provider), optionalText(merged.PolicyNumber), *merged.Premium,
+		string(*merged.PremiumFrequency), *merged.Currency, optionalAmount(merged.CoverageAmount), *merged.RenewalDate,
+		optionalID(merged.BillID), optionalText(merged.Notes), time.Now(), policy.ID, userID)
+	if err != nil {
+		jsonError(w, "Failed to update insurance policy", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.policyByID(ctx, policy.ID, userID)
+	if err != nil {
+		jsonError(w, "Policy updated but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityInsurance,
+		Action:   "updated",
+		EntityID: &policy.ID,
+		Summary:  fmt.Sprintf("Updated insurance policy %s", updated.Name),
+		Details:  map[string]interface{}{"fields": changedFields(req)},
+	})
+
+	jsonResponse(w, updated, http.StatusOK)
+}
+
+// Renew moves a policy's renewal date a year ahead, or to renewal_date, and
+// optionally sets the premium for the new term
+func (h *InsuranceHandler) Renew(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	policy, ok := h.policyFromURL(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserID(ctx)
+
+	var req models.RenewPolicyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			jsonError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	current, err := time.ParseInLocation("2006-01-02", policy.RenewalDate, time.Now().Location())
+	if err != nil {
+		jsonError(w, "Failed to renew insurance policy", http.StatusInternalServerError)
+		return
+	}
+	renewal := current.AddDate(1, 0, 0)
+	if req.RenewalDate != "" {
+		renewal, err = time.ParseInLocation("2006-01-02", req.RenewalDate, time.Now().Location())
+		if err != nil {
+			jsonError(w, "Invalid renewal_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if !renewal.After(current) {
+			jsonError(w, "The new renewal_date must be after the current one", http.StatusBadRequest)
+			return
+		}
+	}
+	premium := policy.Premium
+	if req.Premium != nil {
+		if *req.Premium <= 0 {
+			jsonError(w, "Premium must be positive", http.StatusBadRequest)
+			return
+		}
+		premium = *req.Premium
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE insurance_policies SET renewal_date = ?, premium = ?, updated_at = ? WHERE id = ? AND user_id = ?
+	`, renewal.Format("2006-01-02"), premium, time.Now(), policy.ID, userID)
+	if err != nil {
+		jsonError(w, "Failed to renew insurance policy", http.StatusInternalServerError)
+		return
+	}
+
+	updated, err := h.policyByID(ctx, policy.ID, userID)
+	if err != nil {
+		jsonError(w, "Policy renewed but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityInsurance,
+		Action:   "renewed",
+		EntityID: &policy.ID,
+		Summary:  fmt.Sprintf("Renewed insurance policy %s until %s", updated.Name, updated.RenewalDate),
+		Details:  map[string]interface{}{"renewal_date": updated.RenewalDate, "premium": premium},
+	})
+
+	jsonResponse(w, updated, http.StatusOK)
+}
+
+// Delete removes an insurance policy. The bill paying its premium is kept.
+func (h *InsuranceHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	policy, ok := h.policyFromURL(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := middleware.GetUserID(ctx)
+
+	if _, err := h.db.ExecContext(ctx, "DELETE FROM insurance_policies WHERE id = ? AND user_id = ?", policy.ID, userID); err != nil {
+		jsonError(w, "Failed to delete insurance policy", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityInsurance,
+		Action:   "deleted",
+		EntityID: &policy.ID,
+		Summary:  fmt.Sprintf("Deleted insurance policy %s", policy.Name),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validatePolicyRequest checks a complete policy request and trims its text
+// fields, writing the error response when it's invalid
+func validatePolicyRequest(w http.ResponseWriter, req *models.InsurancePolicyRequest) bool {
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{{"Name", req.Name}, {"Provider", req.Provider}, {"Policy number", req.PolicyNumber}} {
+		if field.value == nil {
+			continue
+		}
+		*field.value = strings.TrimSpace(*field.value)
+		if utf8.RuneCountInString(*field.value) > models.MaxInsuranceNameLength {
+			jsonError(w, fmt.Sprintf("%s must be at most %d characters", field.name, models.MaxInsuranceNameLength), http.StatusBadRequest)
+			return false
+		}
+	}
+	if *req.Name == "" {
+		jsonError(w, "Name is required", http.StatusBadRequest)
+		return false
+	}
+	if !req.Type.IsValid() {
+		jsonError(w, "Invalid insurance type. Use health, life, auto, home, travel or other", http.StatusBadRequest)
+		return false
+	}
+	if *req.Premium <= 0 {
+		jsonError(w, "Premium must be positive", http.StatusBadRequest)
+		return false
+	}
+	if req.PremiumFrequency.PaymentsPerYear() == 0 {
+		jsonError(w, "Invalid premium_frequency. Use monthly, quarterly or yearly", http.StatusBadRequest)
+		return false
+	}
+	if req.CoverageAmount != nil && *req.CoverageAmount < 0 {
+		jsonError(w, "Coverage amount cannot be negative", http.StatusBadRequest)
+		return false
+	}
+	if _, err := time.Parse("2006-01-02", *req.RenewalDate); err != nil {
+		jsonError(w, "Invalid renewal_date format. Use YYYY-MM-DD", http.StatusBadRequest)
+		return false
+	}
+	if req.Currency != nil {
+		*req.Currency = strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if *req.Currency == "" {
+			jsonError(w, "Currency is required", http.StatusBadRequest)
+			return false
+		}
+	}
+	if req.Notes != nil {
+		*req.Notes = strings.TrimSpace(*req.Notes)
+		if utf8.RuneCountInString(*req.Notes) > models.MaxInsuranceNotesLength {
+			jsonError(w, fmt.Sprintf("Notes must be at most %d characters", models.MaxInsuranceNotesLength), http.StatusBadRequest)
+			return false
+		}
+	}
+	return true
+}
+
+// validPolicyBill checks that a policy's premium is linked to one of the
+// user's bills, returning the bill's currency. A nil or 0 bill ID unlinks
+// it.
+func (h *InsuranceHandler) validPolicyBill(w http.ResponseWriter, ctx context.Context, userID int64, billID *int64) (string, bool) {
+	if billID == nil || *billID == 0 {
+		return "", true
+	}
+	var currency string
+	err := h.db.QueryRowContext(ctx, `
+		SELECT a.currency FROM bills b JOIN accounts a ON b.account_id = a.id WHERE b.id = ? AND b.user_id = ?
+	`, *billID, userID).Scan(&currency)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Bill not found", http.StatusNotFound)
+		return "", false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch bill", http.StatusInternalServerError)
+		return "", false
+	}
+	return currency, true
+}
+
+// policyFromURL loads the policy in the URL, writing the error response
+// when it isn't one of the user's policies
+func (h *InsuranceHandler) policyFromURL(w http.ResponseWriter, r *http.Request) (*models.InsurancePolicy, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	policyID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid policy ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	policy, err := h.policyByID(r.Context(), policyID, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Insurance policy not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch insurance policy", http.StatusInternalServerError)
+		return nil, false
+	}
+	return policy, true
+}
+
+func (h *InsuranceHandler) policyByID(ctx context.Context, policyID, userID int64) (*models.InsurancePolicy, error) {
+	return scanPolicy(h.db.QueryRowContext(ctx, `
+		SELECT `+policyColumns+`
+		FROM insurance_policies p
+		LEFT JOIN bills b ON p.bill_id = b.id
+		WHERE p.id = ? AND p.user_id = ?
+	`, policyID, userID), startOfDay(time.Now()))
+}
+
+func scanPolicy(row rowScanner, today time.Time) (*models.InsurancePolicy, error) {
+	var p models.InsurancePolicy
+	var coverage sql.NullFloat64
+	var billID sql.NullInt64
+	err := row.Scan(&p.ID, &p.Name, &p.Type, &p.Provider, &p.PolicyNumber, &p.Premium,
+		&p.PremiumFrequency, &p.Currency, &coverage, &p.RenewalDate, &billID, &p.BillName,
+		&p.Notes, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if coverage.Valid {
+		p.CoverageAmount = &coverage.Float64
+	}
+	if billID.Valid {
+		p.BillID = &billID.Int64
+	}
+	p.AnnualPremium = p.Premium * float64(p.PremiumFrequency.PaymentsPerYear())
+	if renewal, err := time.ParseInLocation("2006-01-02", p.RenewalDate, today.Location()); err == nil {
+		p.DaysUntilRenewal = int(renewal.Sub(today).Hours()/24 + 0.5)
+	}
+	return &p, nil
+}
+
+// optionalText stores an empty or missing text field as NULL
+func optionalText(s *string) interface{} {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return *s
+}
+
+// optionalAmount stores a missing or zero amount as NULL
+func optionalAmount(f *float64) interface{} {
+	if f == nil || *f == 0 {
+		return nil
+	}
+	return *f
+}
+
+// optionalID stores a missing or zero ID as NULL
+func optionalID(id *int64) interface{} {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return *id
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services/nlparse"
+)
+
+// integrationPollLimit is how many items a trigger returns. Zapier
+// deduplicates by id, so it only needs enough to cover one polling interval.
+const integrationPollLimit = "50"
+
+// IntegrationHandler manages integration keys and serves the endpoints
+// automation services such as Zapier and IFTTT call with them: polling
+// triggers, which return the newest items first as a plain array, each with
+// a stable id, and actions
+type IntegrationHandler struct {
+	db           *sql.DB
+	transactions *TransactionHandler
+	parser       nlparse.Parser
+}
+
+func NewIntegrationHandler(db *sql.DB, transactions *TransactionHandler, parser nlparse.Parser) *IntegrationHandler {
+	return &IntegrationHandler{db: db, transactions: transactions, parser: parser}
+}
+
+// ListKeys returns the user's integration keys, without the keys themselves
+func (h *IntegrationHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, hint, profile_id, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var k models.APIKey
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.Hint, &k.ProfileID, &lastUsedAt, &k.CreatedAt); err != nil {
+			continue
+		}
+		if lastUsedAt.Valid {
+			k.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, k)
+	}
+
+	jsonResponse(w, keys, http.StatusOK)
+}
+
+// CreateKey issues an integration key for the active profile. The key is
+// only shown in this response.
+func (h *IntegrationHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Normalize(); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_keys WHERE user_id = ?", userID).Scan(&count); err != nil {
+		jsonError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	if count >= models.MaxAPIKeys {
+		jsonError(w, "Too many API keys: delete one first", http.StatusConflict)
+		return
+	}
+
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		jsonError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	key := models.APIKeyPrefix + hex.EncodeToString(bytes)
+	hint := key[:len(models.APIKeyPrefix)+6]
+
+	now := time.Now()
+	profileID := middleware.GetProfileID(ctx)
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO api_keys (user_id, profile_id, name, key_hash, hint, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, profileID, req.Name, middleware.HashAPIKey(key), hint, now)
+	if err != nil {
+		jsonError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	jsonResponse(w, models.APIKey{
+		ID:        id,
+		Name:      req.Name,
+		Key:       key,
+		Hint:      hint,
+		ProfileID: profileID,
+		CreatedAt: now,
+	}, http.StatusCreated)
+}
+
+// DeleteKey revokes an integration key
+func (h *IntegrationHandler) DeleteKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		jsonError(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me returns who a key belongs to, for services to test a connection
+func (h *IntegrationHandler) Me(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+	keyID, _ := middleware.GetAPIKeyID(ctx)
+
+	me := models.IntegrationMe{ID: userID, KeyID: keyID}
+	err := h.db.QueryRowContext(ctx, `
+		SELECT u.email, k.name FROM users u JOIN api_keys k ON k.user_id = u.id WHERE u.id = ? AND k.id = ?
+	`, userID, keyID).Scan(&me.Email, &me.KeyName)
+	if err != nil {
+		jsonError(w, "Failed to fetch user", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, me, http.StatusOK)
+}
+
+// NewTransactions is the new transaction trigger: the latest transactions,
+// newest first, with the same filters as /api/transactions/recent
+func (h *IntegrationHandler) NewTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("limit") == "" {
+		query.Set("limit", integrationPollLimit)
+		r.URL.RawQuery = query.Encode()
+	}
+	h.transactions.Recent(w, r)
+}
+
+// CreateTransaction is the record transaction action
+func (h *IntegrationHandler) CreateTransaction(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.IntegrationTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var accountType models.AccountType
+	err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?",
+		req.AccountID, userID, middleware.GetProfileID(ctx)).Scan(&accountType)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Type == "" {
+		if accountType == models.AccountTypeCreditCard {
+			req.Type = models.TransactionTypeExpense
+		} else {
+			req.Type = models.TransactionTypeWithdrawal
+		}
+	}
+
+	h.transactions.create(ctx, w, userID, req.AccountID, models.CreateTransactionRequest{
+		Type:        req.Type,
+		Amount:      req.Amount,
+		Description: req.Description,
+		Category:    req.Category,
+	})
+}
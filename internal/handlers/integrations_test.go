@@ -0,0 +1,130 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestIntegrationKeys(t *testing.T) {
+	app := testutil.NewApp(t)
+	fx := app.Seed(t, "ana@example.com")
+	bob := app.Register(t, "bob@example.com")
+
+	var key models.APIKey
+	fx.Client.Post("/api/integrations/keys", models.CreateAPIKeyRequest{Name: "Zapier"}).Expect(http.StatusCreated).Decode(&key)
+	if key.Key == "" || key.Hint == "" {
+		t.Fatalf("created key = %+v, want the key and its hint", key)
+	}
+
+	var keys []models.APIKey
+	fx.Client.Get("/api/integrations/keys").Expect(http.StatusOK).Decode(&keys)
+	if len(keys) != 1 || keys[0].Key != "" {
+		t.Fatalf("listed keys = %+v, want one key without its secret", keys)
+	}
+
+	// Integrations don't need a session; the key goes in the header or the URL
+	zap := app.Client(t)
+	withKey := func(path string) string { return path + "?api_key=" + key.Key }
+	zap.Get("/api/integrations/v1/me").Expect(http.StatusUnauthorized)
+	zap.Get("/api/integrations/v1/me?api_key=wk_nope").Expect(http.StatusUnauthorized)
+
+	req, _ := http.NewRequest(http.MethodGet, app.URL+"/api/integrations/v1/me", nil)
+	req.Header.Set("X-API-Key", key.Key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("header auth: got status %d, want 200", resp.StatusCode)
+	}
+
+	var me models.IntegrationMe
+	zap.Get(withKey("/api/integrations/v1/me")).Expect(http.StatusOK).Decode(&me)
+	if me.Email != "ana@example.com" || me.KeyName != "Zapier" {
+		t.Errorf("me = %+v, want ana's Zapier key", me)
+	}
+
+	// The action defaults to spending on the account's kind
+	var created models.Transaction
+	zap.Post(withKey("/api/integrations/v1/actions/transactions"), models.IntegrationTransactionRequest{
+		AccountID: fx.Card.ID, Amount: 120, Description: "Coffee", Category: models.CategoryDining,
+	}).Expect(http.StatusCreated).Decode(&created)
+	if created.Type != models.TransactionTypeExpense {
+		t.Errorf("card spending type = %s, want expense", created.Type)
+	}
+	zap.Post(withKey("/api/integrations/v1/actions/transactions"), models.IntegrationTransactionRequest{
+		AccountID: fx.Checking.ID, Amount: 80, Description: "Lunch",
+	}).Expect(http.StatusCreated).Decode(&created)
+	if created.Type != models.TransactionTypeWithdrawal {
+		t.Errorf("checking spending type = %s, want withdrawal", created.Type)
+	}
+
+	// Another user's account isn't reachable with the key
+	other := bob.CreateAccount(models.CreateAccountRequest{Name: "Bob", Type: models.AccountTypeDebit, Currency: "DOP"})
+	zap.Post(withKey("/api/integrations/v1/actions/transactions"), models.IntegrationTransactionRequest{
+		AccountID: other.ID, Amount: 10,
+	}).Expect(http.StatusNotFound)
+
+	// The trigger lists the newest first, with ids to deduplicate on
+	var recent []models.Transaction
+	zap.Get(withKey("/api/integrations/v1/triggers/transactions")).Expect(http.StatusOK).Decode(&recent)
+	if len(recent) < 2 || recent[0].ID != created.ID || recent[0].Description != "Lunch" {
+		t.Fatalf("trigger = %+v, want the lunch first", recent)
+	}
+
+	var accounts []map[string]interface{}
+	zap.Get(withKey("/api/integrations/v1/accounts")).Expect(http.StatusOK).Decode(&accounts)
+	if len(accounts) != 3 {
+		t.Errorf("accounts = %d, want 3", len(accounts))
+	}
+
+	// Keys only work until they're deleted, and only by their owner
+	bob.Delete(fmt.Sprintf("/api/integrations/keys/%d", key.ID)).Expect(http.StatusNotFound)
+	fx.Client.Delete(fmt.Sprintf("/api/integrations/keys/%d", key.ID)).Expect(http.StatusNoContent)
+	zap.Get(withKey("/api/integrations/v1/me")).Expect(http.StatusUnauthorized)
+}
+
+func TestQuickAdd(t *testing.T) {
+	app := testutil.NewApp(t)
+	fx := app.Seed(t, "ana@example.com")
+
+	var key models.APIKey
+	fx.Client.Post("/api/integrations/keys", models.CreateAPIKeyRequest{Name: "Shortcuts"}).Expect(http.StatusCreated).Decode(&key)
+	shortcut := app.Client(t)
+	path := "/api/quick?api_key=" + key.Key
+
+	shortcut.Post("/api/quick", models.QuickEntryRequest{Text: "coffee 4.50 card"}).Expect(http.StatusUnauthorized)
+
+	var entry models.QuickEntryResponse
+	shortcut.Post(path, models.QuickEntryRequest{Text: "Coffee 4.50 card"}).Expect(http.StatusCreated).Decode(&entry)
+	tx := entry.Transaction
+	if tx.AccountID != fx.Card.ID || tx.Type != models.TransactionTypeExpense || tx.Amount != 4.5 ||
+		tx.Category != models.CategoryDining || tx.Description != "Coffee" {
+		t.Errorf("coffee = %+v, want a 4.50 dining expense on the card", tx)
+	}
+	if entry.Message == "" || entry.AccountName != "Card" {
+		t.Errorf("response = %+v, want a message about the card", entry)
+	}
+
+	shortcut.Post(path, models.QuickEntryRequest{Text: "salary RD$30,000 checking"}).Expect(http.StatusCreated).Decode(&entry)
+	if tx := entry.Transaction; tx.AccountID != fx.Checking.ID || tx.Type != models.TransactionTypeDeposit || tx.Amount != 30000 {
+		t.Errorf("salary = %+v, want a 30,000 deposit on checking", tx)
+	}
+
+	// A category named outright wins over a keyword, and is left out of the
+	// description
+	shortcut.Post(path, models.QuickEntryRequest{Text: "savings 20 pizza night gifts"}).Expect(http.StatusCreated).Decode(&entry)
+	if tx := entry.Transaction; tx.AccountID != fx.Savings.ID || tx.Category != models.CategoryGifts || tx.Description != "pizza night" {
+		t.Errorf("gift = %+v, want a gift from savings described as pizza night", tx)
+	}
+
+	if msg := shortcut.Post(path, models.QuickEntryRequest{Text: "lunch 12"}).Expect(http.StatusBadRequest).Error(); msg == "" {
+		t.Error("phrase without an account among several should say which accounts to name")
+	}
+	shortcut.Post(path, models.QuickEntryRequest{Text: "lunch card"}).Expect(http.StatusBadRequest)
+}
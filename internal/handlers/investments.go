@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// Revalue sets an investment account's market value. The change is recorded
+// as a revalue transaction so growth stays apart from contributions, which
+// are recorded as deposits and withdrawals.
+func (h *AccountHandler) Revalue(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.RevalueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Value < 0 {
+		jsonError(w, "Value cannot be negative", http.StatusBadRequest)
+		return
+	}
+	description := req.Description
+	if description == "" {
+		description = "Market value change"
+	}
+
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+	if account.Type != models.AccountTypeInvestment {
+		jsonError(w, "Only investment accounts can be revalued", http.StatusBadRequest)
+		return
+	}
+
+	unlock := h.locker.Lock(account.ID)
+	defer unlock()
+
+	var change float64
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			var err error
+			if account, err = h.getAccountByID(ctx, account.ID, userID); err != nil {
+				jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		change = math.Round((req.Value-account.CurrentBalance)*100) / 100
+		if change == 0 {
+			jsonError(w, "Value is unchanged", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = setMarketValue(ctx, tx, userID, account, req.Value, description)
+		if err == errBalanceConflict {
+			tx.Rollback()
+			if attempt < maxBalanceAttempts {
+				continue
+			}
+			balanceConflict(w)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to record revaluation", http.StatusInternalServerError)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	checkBalanceAlerts(ctx, h.alerts, account.ID)
+
+	updated, err := h.getAccountByID(ctx, account.ID, userID)
+	if err != nil {
+		jsonError(w, "Account revalued but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "revalued",
+		EntityID: &account.ID,
+		Summary:  fmt.Sprintf("Revalued %s to %.2f %s (%+.2f)", updated.Name, req.Value, updated.Currency, change),
+		Details:  map[string]interface{}{"value": req.Value, "change": change},
+	})
+
+	jsonResponse(w, updated, http.StatusOK)
+}
+
+// setMarketValue writes an account's new value and records the difference
+// as a revalue transaction, returning the transaction's ID. It fails with
+// errBalanceConflict when the account changed since it was read.
+func setMarketValue(ctx context.Context, tx *sql.Tx, userID int64, account *models.Account, value float64, description string) (int64, error) {
+	if err := setBalance(ctx, tx, account.ID, account.Type, value, account.Version); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, account.ID, string(models.TransactionTypeRevalue), math.Round((value-account.CurrentBalance)*100)/100,
+		services.EncryptField(userID, description), string(models.CategoryOther), value, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// InvestmentAccountGrowth splits one investment account's value into what
+// was paid in and what the market added, in the account's currency
+type InvestmentAccountGrowth struct {
+	AccountID   int64    `json:"account_id"`
+	Name        string   `json:"name"`
+	Currency    string   `json:"currency"`
+	Contributed float64  `json:"contributed"`
+	Earned      float64  `json:"earned"`
+	Value       float64  `json:"value"`
+	ReturnPct   *float64 `json:"return_pct,omitempty"`
+}
+
+// GrowthPoint is the cumulative position at the end of a month
+type GrowthPoint struct {
+	Month       string  `json:"month"`
+	PeriodStart string  `json:"period_start"`
+	Contributed float64 `json:"contributed"`
+	Earned      float64 `json:"earned"`
+	Value       float64 `json:"value"`
+}
+
+// InvestmentGrowth is the contributed vs earned breakdown of all investment
+// accounts. Totals and months are in the preferred currency.
+type InvestmentGrowth struct {
+	Currency    string                    `json:"currency"`
+	Contributed float64                   `json:"contributed"`
+	Earned      float64                   `json:"earned"`
+	Value       float64                   `json:"value"`
+	ReturnPct   *float64                  `json:"return_pct,omitempty"`
+	Accounts    []InvestmentAccountGrowth `json:"accounts"`
+	Months      []GrowthPoint             `json:"months"`
+}
+
+// Investments reports how much of each investment account's value was
+// contributed (deposits less withdrawals, transfers included) and how much
+// was earned (revaluations), with the running totals at the end of each of
+// the last ?months= months (default 12).
+func (h *ReportHandler) Investments(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	months := 12
+	if v := r.URL.Query().Get("months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendMonths {
+			jsonError(w, fmt.Sprintf("months must be between 1 and %d", maxTrendMonths), http.StatusBadRequest)
+			return
+		}
+		months = n
+	}
+
+	prefs, err := h.periodPreferences(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	current := prefs.MonthContaining(now)
+	starts := make([]time.Time, months)
+	for i := range starts {
+		starts[i] = current.AddDate(0, i-months+1, 0)
+	}
+
+	growth := InvestmentGrowth{
+		Currency: currency,
+		Accounts: []InvestmentAccountGrowth{},
+		Months:   make([]GrowthPoint, months),
+	}
+	index := make(map[int64]int)
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, currency, current_balance
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ?`+reportAccounts(ctx, "id")+` AND type = ?
+		ORDER BY name
+	`, userID, middleware.GetProfileID(ctx), models.AccountTypeInvestment)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var a InvestmentAccountGrowth
+		if err := rows.Scan(&a.AccountID, &a.Name, &a.Currency, &a.Value); err != nil {
+			continue
+		}
+		index[a.AccountID] = len(growth.Accounts)
+		growth.Accounts = append(growth.Accounts, a)
+	}
+	rows.Close()
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT t.account_id, t.type, t.amount, t.created_at
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND a.type = ?
+	`, userID, middleware.GetProfileID(ctx), models.AccountTypeInvestment)
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	// Changes in each month, plus everything before the first one
+	contributedIn := make([]float64, months)
+	earnedIn := make([]float64, months)
+	var contributedBefore, earnedBefore float64
+	for rows.Next() {
+		var accountID int64
+		var txType string
+		var amount float64
+		var createdAt time.Time
+		if err := rows.Scan(&accountID, &txType, &amount, &createdAt); err != nil {
+			continue
+		}
+		i, ok := index[accountID]
+		if !ok {
+			continue
+		}
+		account := &growth.Accounts[i]
+
+		var contributed, earned float64
+		switch models.TransactionType(txType) {
+		case models.TransactionTypeDeposit:
+			contributed = amount
+		case models.TransactionTypeWithdrawal:
+			contributed = -amount
+		case models.TransactionTypeRevalue:
+			earned = amount
+		}
+		account.Contributed += contributed
+		account.Earned += earned
+
+		contributed = h.convert(userID, contributed, account.Currency, currency)
+		earned = h.convert(userID, earned, account.Currency, currency)
+		m := sort.Search(months, func(i int) bool { return starts[i].After(createdAt.In(now.Location())) }) - 1
+		if m < 0 {
+			contributedBefore += contributed
+			earnedBefore += earned
+			continue
+		}
+		contributedIn[m] += contributed
+		earnedIn[m] += earned
+	}
+
+	for i := range growth.Accounts {
+		a := &growth.Accounts[i]
+		a.Contributed = roundMoney(a.Contributed)
+		a.Earned = roundMoney(a.Earned)
+		a.ReturnPct = returnPct(a.Earned, a.Contributed)
+		growth.Value += h.convert(userID, a.Value, a.Currency, currency)
+	}
+
+	contributed, earned := contributedBefore, earnedBefore
+	for i, start := range starts {
+		contributed += contributedIn[i]
+		earned += earnedIn[i]
+		growth.Months[i] = GrowthPoint{
+			Month:       start.Format("2006-01"),
+			PeriodStart: start.Format("2006-01-02"),
+			Contributed: roundMoney(contributed),
+			Earned:      roundMoney(earned),
+			Value:       roundMoney(contributed + earned),
+		}
+	}
+	growth.Contributed = roundMoney(contributed)
+	growth.Earned = roundMoney(earned)
+	growth.Value = roundMoney(growth.Value)
+	growth.ReturnPct = returnPct(growth.Earned, growth.Contributed)
+
+	jsonResponse(w, growth, http.StatusOK)
+}
+
+// returnPct is earnings as a percentage of what was contributed, or nil
+// when nothing was
+func returnPct(earned, contributed float64) *float64 {
+	if contributed <= 0 {
+		return nil
+	}
+	pct := math.Round(earned/contributed*10000) / 100
+	return &pct
+}
+
+func roundMoney(x float64) float64 {
+	return math.Round(x*100) / 100
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ListInvites returns every invite, newest first. Tokens aren't included.
+func (h *AdminHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, email, created_by, expires_at, used_at, used_by, created_at
+		FROM invites
+		ORDER BY created_at DESC, id DESC
+	`)
+	if err != nil {
+		jsonError(w, "Failed to fetch invites", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		var inv models.Invite
+		var email sql.NullString
+		var createdBy, usedBy sql.NullInt64
+		var usedAt sql.NullTime
+		if err := rows.Scan(&inv.ID, &email, &createdBy, &inv.ExpiresAt, &usedAt, &usedBy, &inv.CreatedAt); err != nil {
+			continue
+		}
+		if email.Valid {
+			inv.Email = &email.String
+		}
+		if createdBy.Valid {
+			inv.CreatedBy = &createdBy.Int64
+		}
+		if usedAt.Valid {
+			inv.UsedAt = &usedAt.Time
+		}
+		if usedBy.Valid {
+			inv.UsedBy = &usedBy.Int64
+		}
+		invites = append(invites, inv)
+	}
+
+	jsonResponse(w, invites, http.StatusOK)
+}
+
+// CreateInvite issues a single-use registration link. The token is only
+// shown in this response.
+func (h *AdminHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Email != nil {
+		email := strings.TrimSpace(strings.ToLower(*req.Email))
+		if !strings.Contains(email, "@") {
+			jsonError(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		req.Email = &email
+	}
+	hours := models.DefaultInviteHours
+	if req.ExpiresInHours != nil {
+		hours = *req.ExpiresInHours
+		if hours < 1 || hours > models.MaxInviteHours {
+			jsonError(w, "expires_in_hours must be between 1 and "+strconv.Itoa(models.MaxInviteHours), http.StatusBadRequest)
+			return
+		}
+	}
+
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		jsonError(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(bytes)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(hours) * time.Hour)
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO invites (token_hash, email, created_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hashInviteToken(token), req.Email, userID, expiresAt, now)
+	if err != nil {
+		jsonError(w, "Failed to create invite", http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	jsonResponse(w, models.Invite{
+		ID:        id,
+		Token:     token,
+		Path:      "/register?invite=" + url.QueryEscape(token),
+		Email:     req.Email,
+		CreatedBy: &userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}, http.StatusCreated)
+}
+
+// DeleteInvite revokes an invite. Accounts already registered with it stay.
+func (h *AdminHandler) DeleteInvite(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM invites WHERE id = ?", id)
+	if err != nil {
+		jsonError(w, "Failed to delete invite", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// hashInviteToken is how invite tokens are stored, so a copy of the
+// database can't be used to register
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// LoanPayoff is one payoff scenario for a loan
+type LoanPayoff struct {
+	services.Payoff
+	MonthlyPayment float64 `json:"monthly_payment"`
+	PayoffDate     string  `json:"payoff_date"`
+}
+
+// LoanWhatIfResponse compares paying a loan off as scheduled with paying an
+// extra amount every month
+type LoanWhatIfResponse struct {
+	AccountID          int64      `json:"account_id"`
+	Currency           string     `json:"currency"`
+	Balance            float64    `json:"balance"`
+	YearlyInterestRate float64    `json:"yearly_interest_rate"`
+	Extra              float64    `json:"extra"`
+	Current            LoanPayoff `json:"current"`
+	WithExtra          LoanPayoff `json:"with_extra"`
+	MonthsSooner       int        `json:"months_sooner"`
+	InterestSaved      float64    `json:"interest_saved"`
+}
+
+// LoanWhatIf shows how much sooner a loan is paid off, and how much interest
+// is saved, by adding an extra amount to each monthly payment
+func (h *AccountHandler) LoanWhatIf(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	accountID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid account ID", http.StatusBadRequest)
+		return
+	}
+
+	extra, err := strconv.ParseFloat(r.URL.Query().Get("extra"), 64)
+	if err != nil || extra <= 0 {
+		jsonError(w, "Extra amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	account, err := h.getAccountByID(ctx, accountID, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+	if account.Type != models.AccountTypeLoan {
+		jsonError(w, "What-if calculations are only available for loans", http.StatusBadRequest)
+		return
+	}
+	if account.MonthlyPayment == nil || *account.MonthlyPayment <= 0 {
+		jsonError(w, "Set the loan's monthly payment first", http.StatusBadRequest)
+		return
+	}
+
+	var rate float64
+	if account.YearlyInterestRate != nil {
+		rate = *account.YearlyInterestRate
+	}
+	balance := account.GetLiabilityAmount()
+	payment := *account.MonthlyPayment
+
+	current, err := services.Amortize(balance, rate, payment)
+	if err == services.ErrPaymentTooLow {
+		jsonError(w, "The monthly payment doesn't cover the loan's interest", http.StatusBadRequest)
+		return
+	}
+	withExtra, _ := services.Amortize(balance, rate, payment+extra)
+
+	now := time.Now()
+	jsonResponse(w, LoanWhatIfResponse{
+		AccountID:          account.ID,
+		Currency:           account.Currency,
+		Balance:            balance,
+		YearlyInterestRate: rate,
+		Extra:              extra,
+		Current:            LoanPayoff{Payoff: current, MonthlyPayment: payment, PayoffDate: now.AddDate(0, current.Months, 0).Format("2006-01")},
+		WithExtra:          LoanPayoff{Payoff: withExtra, MonthlyPayment: payment + extra, PayoffDate: now.AddDate(0, withExtra.Months, 0).Format("2006-01")},
+		MonthsSooner:       current.Months - withExtra.Months,
+		InterestSaved:      math.Round((current.TotalInterest-withExtra.TotalInterest)*100) / 100,
+	}, http.StatusOK)
+}
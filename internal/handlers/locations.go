@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// LocationSpend is what was spent at one place. Transactions with a place
+// name are grouped by name; those with only coordinates by the point
+// rounded to about 100 m. Latitude and longitude are the average of the
+// transactions' points, when any have one.
+type LocationSpend struct {
+	PlaceName string   `json:"place_name,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Amount    float64  `json:"amount"`
+	Count     int      `json:"count"`
+	FirstAt   string   `json:"first_at"`
+	LastAt    string   `json:"last_at"`
+
+	latSum, lonSum float64
+	points         int
+}
+
+// LocationReport is spending per place over a date range in the preferred
+// currency, largest first
+type LocationReport struct {
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Currency  string          `json:"currency"`
+	Total     float64         `json:"total"`
+	Located   float64         `json:"located"`
+	Unlocated float64         `json:"unlocated"`
+	Places    []LocationSpend `json:"places"`
+}
+
+// ByLocation summarizes spending per place between ?from= and ?to=
+// (YYYY-MM-DD, inclusive; default the last 12 months). Spending without a
+// location is totalled as unlocated. Transfers, opening balances and cash
+// withdrawals aren't spending.
+func (h *ReportHandler) ByLocation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := reportRange(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT t.amount, a.currency, t.latitude, t.longitude, t.place_name, t.created_at, COALESCE(t.is_private, 0)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.type IN ('withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('transfer', 'opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ? AND t.created_at < ?
+		ORDER BY t.created_at
+	`, userID, middleware.GetProfileID(ctx), from.Format("2006-01-02 15:04:05"), to.AddDate(0, 0, 1).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := LocationReport{
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Currency: currency,
+		Places:   []LocationSpend{},
+	}
+	places := make(map[string]*LocationSpend)
+	var order []string
+	for rows.Next() {
+		var amount float64
+		var accountCurrency string
+		var storedLatitude, storedLongitude, placeName sql.NullString
+		var createdAt time.Time
+		var private bool
+		if err := rows.Scan(&amount, &accountCurrency, &storedLatitude, &storedLongitude, &placeName, &createdAt, &private); err != nil {
+			continue
+		}
+		latitude, longitude := decryptCoordinate(userID, storedLatitude), decryptCoordinate(userID, storedLongitude)
+		placeName.String = services.DecryptField(userID, placeName.String)
+		// Advisors don't see where private transactions were made
+		if private && middleware.GetAdvisorAccess(ctx) != nil {
+			latitude, longitude, placeName = sql.NullFloat64{}, sql.NullFloat64{}, sql.NullString{}
+		}
+		amount = h.convert(userID, amount, accountCurrency, currency)
+		report.Total += amount
+
+		name := strings.TrimSpace(placeName.String)
+		hasPoint := latitude.Valid && longitude.Valid
+		var key string
+		switch {
+		case name != "":
+			key = "name:" + strings.ToLower(name)
+		case hasPoint:
+			key = fmt.Sprintf("point:%.3f,%.3f", latitude.Float64, longitude.Float64)
+		default:
+			report.Unlocated += amount
+			continue
+		}
+		report.Located += amount
+
+		place, ok := places[key]
+		if !ok {
+			place = &LocationSpend{PlaceName: name, FirstAt: createdAt.Format(time.RFC3339)}
+			places[key] = place
+			order = append(order, key)
+		}
+		place.Amount += amount
+		place.Count++
+		place.LastAt = createdAt.Format(time.RFC3339)
+		if hasPoint {
+			place.latSum += latitude.Float64
+			place.lonSum += longitude.Float64
+			place.points++
+		}
+	}
+
+	for _, key := range order {
+		place := places[key]
+		place.Amount = math.Round(place.Amount*100) / 100
+		if place.points > 0 {
+			latitude := math.Round(place.latSum/float64(place.points)*1e6) / 1e6
+			longitude := math.Round(place.lonSum/float64(place.points)*1e6) / 1e6
+			place.Latitude, place.Longitude = &latitude, &longitude
+		}
+		report.Places = append(report.Places, *place)
+	}
+	sort.SliceStable(report.Places, func(i, j int) bool {
+		return report.Places[i].Amount > report.Places[j].Amount
+	})
+	report.Total = math.Round(report.Total*100) / 100
+	report.Located = math.Round(report.Located*100) / 100
+	report.Unlocated = math.Round(report.Unlocated*100) / 100
+
+	jsonResponse(w, report, http.StatusOK)
+}
+
+// reportRange reads the inclusive ?from= and ?to= dates (YYYY-MM-DD) of a
+// report, defaulting to the last 12 months
+func reportRange(r *http.Request) (from, to time.Time, err error) {
+	now := time.Now()
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from = to.AddDate(-1, 0, 1)
+	query := r.URL.Query()
+	if v := query.Get("from"); v != "" {
+		if from, err = time.ParseInLocation("2006-01-02", v, now.Location()); err != nil {
+			return from, to, fmt.Errorf("Invalid from: use YYYY-MM-DD")
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, now.Location()); err != nil {
+			return from, to, fmt.Errorf("Invalid to: use YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("to must not be before from")
+	}
+	return from, to, nil
+}
@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/handlers"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestLocationsEncryptedAtRest(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	path := fmt.Sprintf("/api/accounts/%d/transactions", f.Checking.ID)
+
+	// Written before the key is set, then encrypted at startup
+	latitude, longitude := 18.4861, -69.9312
+	f.Client.Post(path, models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 1200, Description: "Pharmacy", Category: models.CategoryHealthcare,
+		Location: &models.Location{Latitude: &latitude, Longitude: &longitude, PlaceName: "Farmacia Carol"},
+	}).Expect(http.StatusCreated)
+
+	env := map[string]string{"DATA_ENCRYPTION_KEY": strings.Repeat("ab", 32)}
+	cipher, err := services.FieldCipherFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	services.SetFieldCipher(cipher)
+	defer services.SetFieldCipher(nil)
+	if err := services.EncryptExistingFields(context.Background(), app.DB); err != nil {
+		t.Fatal(err)
+	}
+	f.Client.Post(path, models.CreateTransactionRequest{
+		Type: models.TransactionTypeWithdrawal, Amount: 300, Description: "Coffee", Category: models.CategoryDining,
+		Location: &models.Location{Latitude: &latitude, Longitude: &longitude, PlaceName: "Farmacia Carol"},
+	}).Expect(http.StatusCreated)
+
+	rows, err := app.DB.Query("SELECT place_name, latitude, longitude FROM transactions WHERE place_name IS NOT NULL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := 0
+	for rows.Next() {
+		var placeName, lat, lon string
+		if err := rows.Scan(&placeName, &lat, &lon); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range []string{placeName, lat, lon} {
+			if !strings.HasPrefix(v, "enc:v1:") {
+				t.Errorf("location stored as %q, want it encrypted", v)
+			}
+		}
+		stored++
+	}
+	rows.Close()
+	if stored != 2 {
+		t.Fatalf("%d located transactions stored, want 2", stored)
+	}
+
+	var found models.TransactionListResponse
+	f.Client.Get("/api/transactions/search?q=carol").Expect(http.StatusOK).Decode(&found)
+	if len(found.Transactions) != 2 {
+		t.Fatalf("search found %d transactions, want 2", len(found.Transactions))
+	}
+	if l := found.Transactions[0].Location; l == nil || l.PlaceName != "Farmacia Carol" || l.Latitude == nil || *l.Latitude != latitude {
+		t.Errorf("location = %+v, want it decrypted", l)
+	}
+
+	var report handlers.LocationReport
+	f.Client.Get("/api/reports/by-location").Expect(http.StatusOK).Decode(&report)
+	if len(report.Places) != 1 || report.Places[0].PlaceName != "Farmacia Carol" || report.Places[0].Count != 2 ||
+		report.Places[0].Longitude == nil || *report.Places[0].Longitude != longitude {
+		t.Errorf("places = %+v, want both transactions at Farmacia Carol", report.Places)
+	}
+}
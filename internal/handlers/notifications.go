@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type NotificationHandler struct {
+	db            *sql.DB
+	notifications *services.NotificationService
+}
+
+func NewNotificationHandler(db *sql.DB, notifications *services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{db: db, notifications: notifications}
+}
+
+// List returns the user's notification feed, newest first. Pass unread=true
+// to only return notifications that have not been acknowledged.
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	query := `
+		SELECT id, user_id, type, title, message, data, acknowledged_at, created_at
+		FROM notifications
+		WHERE user_id = ? AND in_app = 1
+	`
+	if r.URL.Query().Get("unread") == "true" {
+		query += " AND acknowledged_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+
+	rows, err := h.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		jsonError(w, "Failed to fetch notifications", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		var n models.Notification
+		var data sql.NullString
+		var acknowledgedAt sql.NullTime
+		err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &data, &acknowledgedAt, &n.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if data.Valid {
+			n.Data = []byte(data.String)
+		}
+		if acknowledgedAt.Valid {
+			n.AcknowledgedAt = &acknowledgedAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+
+	jsonResponse(w, notifications, http.StatusOK)
+}
+
+// Acknowledge marks a notification as read/dismissed
+func (h *NotificationHandler) Acknowledge(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	notificationID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE notifications SET acknowledged_at = COALESCE(acknowledged_at, ?)
+		WHERE id = ? AND user_id = ? AND in_app = 1
+	`, time.Now(), notificationID, userID)
+	if err != nil {
+		jsonError(w, "Failed to acknowledge notification", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		jsonError(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, map[string]string{"message": "Notification acknowledged"}, http.StatusOK)
+}
+
+// AcknowledgeAll marks every unread notification as read
+func (h *NotificationHandler) AcknowledgeAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE notifications SET acknowledged_at = ?
+		WHERE user_id = ? AND in_app = 1 AND acknowledged_at IS NULL
+	`, time.Now(), userID)
+	if err != nil {
+		jsonError(w, "Failed to acknowledge notifications", http.StatusInternalServerError)
+		return
+	}
+
+	count, _ := result.RowsAffected()
+	jsonResponse(w, map[string]interface{}{"message": "Notifications acknowledged", "count": count}, http.StatusOK)
+}
+
+// Preferences returns the channels each notification type is delivered on
+// and the user's quiet hours
+func (h *NotificationHandler) Preferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := h.settings(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch notification preferences", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, settings, http.StatusOK)
+}
+
+// UpdatePreferences changes the channels of the given notification types
+// and the quiet hours
+func (h *NotificationHandler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateNotificationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(req.Preferences))
+	for _, p := range req.Preferences {
+		if !p.Type.IsValid() {
+			jsonError(w, "Invalid notification type: "+string(p.Type), http.StatusBadRequest)
+			return
+		}
+		pref, err := h.notifications.Preference(ctx, userID, p.Type)
+		if err != nil {
+			jsonError(w, "Failed to fetch notification preferences", http.StatusInternalServerError)
+			return
+		}
+		if p.InApp != nil {
+			pref.InApp = *p.InApp
+		}
+		if p.Email != nil {
+			pref.Email = *p.Email
+		}
+		if p.Push != nil {
+			pref.Push = *p.Push
+		}
+		prefs = append(prefs, pref)
+	}
+	if q := req.QuietHours; q != nil && (q.Start != "" || q.End != "") {
+		if err := q.Validate(); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to update notification preferences", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, pref := range prefs {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO notification_preferences (user_id, type, in_app, email, push, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, type) DO UPDATE SET
+				in_app = excluded.in_app, email = excluded.email, push = excluded.push, updated_at = excluded.updated_at
+		`, userID, string(pref.Type), pref.InApp, pref.Email, pref.Push, now)
+		if err != nil {
+			jsonError(w, "Failed to update notification preferences", http.StatusInternalServerError)
+			return
+		}
+	}
+	if q := req.QuietHours; q != nil {
+		var start, end, timezone sql.NullString
+		if q.Start != "" || q.End != "" {
+			start = sql.NullString{String: q.Start, Valid: true}
+			end = sql.NullString{String: q.End, Valid: true}
+			timezone = sql.NullString{String: q.Timezone, Valid: q.Timezone != ""}
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE users SET quiet_hours_start = ?, quiet_hours_end = ?, quiet_hours_timezone = ? WHERE id = ?
+		`, start, end, timezone, userID)
+		if err != nil {
+			jsonError(w, "Failed to update quiet hours", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to update notification preferences", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := h.settings(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch notification preferences", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, settings, http.StatusOK)
+}
+
+func (h *NotificationHandler) settings(ctx context.Context, userID int64) (*models.NotificationSettings, error) {
+	settings := &models.NotificationSettings{
+		Preferences:    make([]models.NotificationPreference, 0, len(models.NotificationTypes)),
+		EmailAvailable: h.notifications.EmailEnabled(),
+	}
+	for _, t := range models.NotificationTypes {
+		pref, err := h.notifications.Preference(ctx, userID, t)
+		if err != nil {
+			return nil, err
+		}
+		settings.Preferences = append(settings.Preferences, pref)
+	}
+
+	quiet, err := h.notifications.QuietHours(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	settings.QuietHours = quiet
+
+	// Push goes to the Telegram chat linked to the account
+	if h.notifications.PushEnabled() {
+		err := h.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM telegram_links WHERE user_id = ?)
+		`, userID).Scan(&settings.PushAvailable)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
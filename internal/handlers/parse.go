@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services/nlparse"
+)
+
+// maxParseText keeps what's sent to the parser, and maybe a language
+// model, to a sentence or two
+const maxParseText = 500
+
+// ParseHandler reads transactions described in everyday words
+type ParseHandler struct {
+	db     *sql.DB
+	parser nlparse.Parser
+}
+
+func NewParseHandler(db *sql.DB, parser nlparse.Parser) *ParseHandler {
+	return &ParseHandler{db: db, parser: parser}
+}
+
+// Parse reads a transaction from text against the accounts of the active
+// profile. Nothing is recorded: the client shows the result for the user to
+// correct and confirm, then creates it on the account.
+func (h *ParseHandler) Parse(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ParseTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" {
+		jsonError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(req.Text) > maxParseText {
+		jsonError(w, "text is too long", http.StatusBadRequest)
+		return
+	}
+
+	accounts, err := profileAccounts(ctx, h.db, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+
+	parsed, err := h.parser.Parse(ctx, nlparse.Input{Text: req.Text, Accounts: accounts, Now: time.Now()})
+	if errors.Is(err, nlparse.ErrNoAmount) {
+		jsonError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to read the text", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, parsed, http.StatusOK)
+}
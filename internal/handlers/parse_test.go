@@ -0,0 +1,99 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services/nlparse"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestParseTransaction(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+	debit := c.CreateAccount(models.CreateAccountRequest{Name: "BHD Debit", Type: models.AccountTypeDebit, Currency: "DOP"})
+	c.CreateAccount(models.CreateAccountRequest{Name: "Visa Gold", Type: models.AccountTypeCreditCard, Currency: "USD", CreditLimit: new(float64)})
+
+	parse := func(text string) models.ParsedTransaction {
+		t.Helper()
+		var parsed models.ParsedTransaction
+		c.Post("/api/transactions/parse", models.ParseTransactionRequest{Text: text}).Expect(http.StatusOK).Decode(&parsed)
+		return parsed
+	}
+
+	parsed := parse("paid 1,200 DOP for electricity yesterday from BHD debit")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	tx := parsed.Transaction
+	if parsed.AccountID == nil || *parsed.AccountID != debit.ID || parsed.Source != nlparse.SourceRules {
+		t.Fatalf("parsed = %+v, want BHD Debit by the rules", parsed)
+	}
+	if tx.Amount != 1200 || tx.Type != models.TransactionTypeWithdrawal || tx.Category != models.CategoryUtilities ||
+		tx.Description != "electricity" || parsed.Currency != "DOP" || parsed.Date != yesterday {
+		t.Errorf("parsed = %+v, want a 1,200 DOP electricity withdrawal yesterday", parsed)
+	}
+	if len(parsed.Warnings) != 1 {
+		t.Errorf("warnings = %q, want one about the date", parsed.Warnings)
+	}
+
+	// A word of an account's name picks it, and its currency is checked
+	parsed = parse("coffee at Café Lua 4,50 € visa")
+	if parsed.AccountName != "Visa Gold" || parsed.Transaction.Type != models.TransactionTypeExpense ||
+		parsed.Transaction.Amount != 4.5 || parsed.Transaction.Category != models.CategoryDining ||
+		parsed.Transaction.Description != "coffee at Café Lua" || len(parsed.Warnings) != 1 {
+		t.Errorf("parsed = %+v, want a 4.50 dining expense on Visa Gold with a currency warning", parsed)
+	}
+
+	parsed = parse("received 500 dollars")
+	if parsed.AccountID != nil || parsed.Transaction.Type != models.TransactionTypeDeposit || len(parsed.Warnings) != 1 {
+		t.Errorf("parsed = %+v, want a deposit asking for the account", parsed)
+	}
+
+	c.Post("/api/transactions/parse", models.ParseTransactionRequest{Text: "electricity yesterday"}).Expect(http.StatusUnprocessableEntity)
+	c.Post("/api/transactions/parse", models.ParseTransactionRequest{Text: " "}).Expect(http.StatusBadRequest)
+}
+
+// completer answers with a canned reply, or fails without one
+type completer string
+
+func (c completer) Complete(ctx context.Context, system, prompt string) (string, error) {
+	if c == "" {
+		return "", errors.New("model unavailable")
+	}
+	return string(c), nil
+}
+
+func TestParseTransactionWithLLM(t *testing.T) {
+	llm := &nlparse.LLM{Fallback: nlparse.Rules{}}
+	cfg := testutil.DefaultConfig()
+	cfg.Parser = llm
+	app := testutil.NewAppWithConfig(t, cfg)
+	c := app.Register(t, "ana@example.com")
+	cash := c.CreateAccount(models.CreateAccountRequest{Name: "Wallet", Type: models.AccountTypeCash, Currency: "DOP"})
+
+	llm.Completer = completer(fmt.Sprintf("```json\n"+`{"account_id": %d, "type": "withdrawal", "amount": 350, "currency": "",
+		"category": "groceries", "description": "Veggies at the market", "date": %q}`+"\n```", cash.ID, time.Now().Format("2006-01-02")))
+	var parsed models.ParsedTransaction
+	c.Post("/api/transactions/parse", models.ParseTransactionRequest{Text: "350 for veggies"}).Expect(http.StatusOK).Decode(&parsed)
+	if parsed.Source != nlparse.SourceLLM || parsed.AccountID == nil || *parsed.AccountID != cash.ID ||
+		parsed.Transaction.Category != models.CategoryGroceries || len(parsed.Warnings) != 0 {
+		t.Errorf("parsed = %+v, want the model's answer", parsed)
+	}
+
+	// Accounts the user doesn't have are dropped
+	llm.Completer = completer(`{"account_id": 999, "type": "teleport", "amount": 10, "category": "yachts"}`)
+	c.Post("/api/transactions/parse", models.ParseTransactionRequest{Text: "10 for something"}).Expect(http.StatusOK).Decode(&parsed)
+	if parsed.AccountID != nil || parsed.Transaction.Type != models.TransactionTypeWithdrawal || parsed.Transaction.Category != models.CategoryOther {
+		t.Errorf("parsed = %+v, want the account, type and category dropped", parsed)
+	}
+
+	llm.Completer = completer("")
+	c.Post("/api/transactions/parse", models.ParseTransactionRequest{Text: "350 for veggies"}).Expect(http.StatusOK).Decode(&parsed)
+	if parsed.Source != nlparse.SourceRules || parsed.Transaction.Amount != 350 {
+		t.Errorf("parsed = %+v, want the rules to take over", parsed)
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type PeriodHandler struct {
+	db    *sql.DB
+	audit *services.AuditService
+}
+
+func NewPeriodHandler(db *sql.DB, audit *services.AuditService) *PeriodHandler {
+	return &PeriodHandler{db: db, audit: audit}
+}
+
+// GetClosing returns how far the user's books are closed
+func (h *PeriodHandler) GetClosing(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	closed, err := closedBefore(ctx, h.db, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch closed periods", http.StatusInternalServerError)
+		return
+	}
+
+	closing := periodClosing(closed)
+	if closed != nil {
+		if closing.Balances, err = h.closingBalances(ctx, userID, *closed); err != nil {
+			jsonError(w, "Failed to calculate balances", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	jsonResponse(w, closing, http.StatusOK)
+}
+
+// Close closes the financial month in the request and every month before
+// it. Only months that have ended can be closed.
+func (h *PeriodHandler) Close(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	start, ok := h.monthFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+	end := start.AddDate(0, 1, 0)
+	if end.After(time.Now()) {
+		jsonError(w, "Only months that have ended can be closed", http.StatusBadRequest)
+		return
+	}
+
+	closed, err := closedBefore(ctx, h.db, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch closed periods", http.StatusInternalServerError)
+		return
+	}
+	if closed != nil && !closed.Before(end) {
+		jsonError(w, "This month is already closed", http.StatusConflict)
+		return
+	}
+
+	if _, err := h.db.ExecContext(ctx, "UPDATE users SET closed_before = ? WHERE id = ?", end, userID); err != nil {
+		jsonError(w, "Failed to close period", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityPeriod,
+		Action:  "closed",
+		Summary: "Closed the books through " + end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Details: map[string]interface{}{"month": start.Format("2006-01")},
+	})
+
+	closing := periodClosing(&end)
+	if closing.Balances, err = h.closingBalances(ctx, userID, end); err != nil {
+		jsonError(w, "Failed to calculate balances", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, closing, http.StatusOK)
+}
+
+// Reopen reopens the financial month in the request and every month after
+// it, so their transactions can be edited again
+func (h *PeriodHandler) Reopen(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	start, ok := h.monthFromRequest(w, r, userID)
+	if !ok {
+		return
+	}
+
+	closed, err := closedBefore(ctx, h.db, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch closed periods", http.StatusInternalServerError)
+		return
+	}
+	if closed == nil || !start.Before(*closed) {
+		jsonError(w, "This month isn't closed", http.StatusConflict)
+		return
+	}
+
+	if _, err := h.db.ExecContext(ctx, "UPDATE users SET closed_before = ? WHERE id = ?", start, userID); err != nil {
+		jsonError(w, "Failed to reopen period", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:  userID,
+		Type:    models.ActivityPeriod,
+		Action:  "reopened",
+		Summary: "Reopened the books from " + start.Format("2006-01-02"),
+		Details: map[string]interface{}{"month": start.Format("2006-01")},
+	})
+
+	jsonResponse(w, periodClosing(&start), http.StatusOK)
+}
+
+// monthFromRequest returns the start of the financial month named in the
+// request body, writing the error response when it's invalid
+func (h *PeriodHandler) monthFromRequest(w http.ResponseWriter, r *http.Request, userID int64) (time.Time, bool) {
+	var req models.ClosePeriodRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+	month, err := time.Parse("2006-01", req.Month)
+	if err != nil {
+		jsonError(w, "Invalid month format. Use YYYY-MM", http.StatusBadRequest)
+		return time.Time{}, false
+	}
+
+	var monthStartDay sql.NullInt64
+	if err := h.db.QueryRowContext(r.Context(), "SELECT month_start_day FROM users WHERE id = ?", userID).Scan(&monthStartDay); err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return time.Time{}, false
+	}
+	prefs := models.PeriodPreferences{MonthStartDay: int(monthStartDay.Int64)}
+	return prefs.MonthStarting(month.Year(), month.Month(), time.Now().Location()), true
+}
+
+// closingBalances rebuilds every account's balance at the end of the day
+// before closed, including accounts in other profiles since the books are
+// closed for all of them
+func (h *PeriodHandler) closingBalances(ctx context.Context, userID int64, closed time.Time) ([]models.AccountBalance, error) {
+	changes, err := services.BalanceChangesSince(ctx, h.db, userID, closed)
+	if err != nil {
+		return nil, err
+	}
+	locale := services.UserLocale(ctx, h.db, userID)
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+accountColumns+`
+		FROM accounts
+		WHERE user_id = ? AND created_at < ?
+		ORDER BY profile_id, created_at
+	`, userID, closed.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	asOf := closed.AddDate(0, 0, -1).Format("2006-01-02")
+	balances := []models.AccountBalance{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, accountBalanceAt(account, changes, closed, asOf, locale))
+	}
+	return balances, rows.Err()
+}
+
+// periodClosing describes a closing at closed, which may be nil
+func periodClosing(closed *time.Time) models.PeriodClosing {
+	var closing models.PeriodClosing
+	if closed != nil {
+		through := closed.AddDate(0, 0, -1).Format("2006-01-02")
+		openFrom := closed.Format("2006-01-02")
+		closing.ClosedThrough, closing.OpenFrom = &through, &openFrom
+	}
+	return closing
+}
+
+// closedBefore returns when the user's open period starts, or nil when no
+// period is closed
+func closedBefore(ctx context.Context, db *sql.DB, userID int64) (*time.Time, error) {
+	var closed sql.NullTime
+	err := db.QueryRowContext(ctx, "SELECT closed_before FROM users WHERE id = ?", userID).Scan(&closed)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if !closed.Valid {
+		return nil, nil
+	}
+	t := closed.Time.In(time.Now().Location())
+	return &t, nil
+}
+
+// checkPeriodOpen writes the error response and returns false when any of
+// the dates falls in a closed period
+func checkPeriodOpen(ctx context.Context, w http.ResponseWriter, db *sql.DB, userID int64, dates ...time.Time) bool {
+	closed, err := closedBefore(ctx, db, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch closed periods", http.StatusInternalServerError)
+		return false
+	}
+	if closed == nil {
+		return true
+	}
+	for _, at := range dates {
+		if at.Before(*closed) {
+			jsonError(w, fmt.Sprintf("Transactions before %s are in a closed period; reopen it first", closed.Format("2006-01-02")), http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// checkTransactionsOpen is checkPeriodOpen for the dates of existing
+// transactions. Transactions that don't exist are left for the caller to
+// report.
+func checkTransactionsOpen(ctx context.Context, w http.ResponseWriter, db *sql.DB, userID int64, transactionIDs ...int64) bool {
+	var dates []time.Time
+	for _, id := range transactionIDs {
+		var createdAt time.Time
+		err := db.QueryRowContext(ctx, `
+			SELECT t.created_at FROM transactions t
+			JOIN accounts a ON t.account_id = a.id
+			WHERE t.id = ? AND a.user_id = ?
+		`, id, userID).Scan(&createdAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch transaction", http.StatusInternalServerError)
+			return false
+		}
+		dates = append(dates, createdAt)
+	}
+	return checkPeriodOpen(ctx, w, db, userID, dates...)
+}
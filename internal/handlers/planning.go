@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type PlanningHandler struct {
+	db              *sql.DB
+	exchangeService *services.ExchangeService
+}
+
+func NewPlanningHandler(db *sql.DB, exchangeService *services.ExchangeService) *PlanningHandler {
+	return &PlanningHandler{db: db, exchangeService: exchangeService}
+}
+
+// DebtPayoffResponse is a payoff plan in the user's preferred currency
+type DebtPayoffResponse struct {
+	*services.DebtPlan
+	Currency string `json:"currency"`
+}
+
+// DebtPayoff sequences a monthly budget across all credit cards and loans
+// using the avalanche (highest rate first) or snowball (smallest balance
+// first) strategy and returns the month-by-month plan
+func (h *PlanningHandler) DebtPayoff(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	strategy := services.DebtStrategy(r.URL.Query().Get("strategy"))
+	if strategy == "" {
+		strategy = services.DebtAvalanche
+	}
+	if !strategy.IsValid() {
+		jsonError(w, "Invalid strategy: use avalanche or snowball", http.StatusBadRequest)
+		return
+	}
+
+	monthlyBudget, err := strconv.ParseFloat(r.URL.Query().Get("monthly_budget"), 64)
+	if err != nil || monthlyBudget <= 0 {
+		jsonError(w, "monthly_budget must be a positive amount", http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.preferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, type, currency,
+		       CASE type WHEN 'credit_card' THEN COALESCE(credit_owed, 0) ELSE COALESCE(loan_current_owed, 0) END,
+		       COALESCE(yearly_interest_rate, 0), monthly_payment
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ? AND type IN ('credit_card', 'loan')
+		ORDER BY id
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	debts := []services.Debt{}
+	for rows.Next() {
+		var d services.Debt
+		var accountCurrency string
+		var monthlyPayment sql.NullFloat64
+		if err := rows.Scan(&d.AccountID, &d.Name, &d.Type, &accountCurrency, &d.Balance, &d.YearlyInterestRate, &monthlyPayment); err != nil {
+			jsonError(w, "Failed to scan account", http.StatusInternalServerError)
+			return
+		}
+		if d.Balance <= 0 {
+			continue
+		}
+
+		if models.AccountType(d.Type) == models.AccountTypeCreditCard || !monthlyPayment.Valid {
+			d.MinimumPayment = services.CardMinimumPayment(d.Balance)
+		} else {
+			d.MinimumPayment = monthlyPayment.Float64
+		}
+		d.Balance = h.convert(userID, d.Balance, accountCurrency, currency)
+		d.MinimumPayment = math.Round(h.convert(userID, d.MinimumPayment, accountCurrency, currency)*100) / 100
+		debts = append(debts, d)
+	}
+	if err := rows.Err(); err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+
+	plan, err := services.PlanDebtPayoff(debts, monthlyBudget, strategy, time.Now())
+	var tooLow *services.BudgetTooLowError
+	if errors.As(err, &tooLow) {
+		jsonError(w, fmt.Sprintf("monthly_budget must cover the minimum payments of %.2f %s", tooLow.Minimum, currency), http.StatusBadRequest)
+		return
+	}
+	if err == services.ErrPaymentTooLow {
+		jsonError(w, "monthly_budget doesn't cover the interest on your debts", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to build payoff plan", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, DebtPayoffResponse{DebtPlan: plan, Currency: currency}, http.StatusOK)
+}
+
+// Emergency fund defaults: months of essential expenses to aim for and
+// complete months of history to average
+const (
+	defaultEmergencyFundMonths = 6
+	maxEmergencyFundMonths     = 24
+	defaultEssentialsHistory   = 6
+	maxEssentialsHistory       = 24
+)
+
+// EssentialExpense is one essential category's monthly average
+type EssentialExpense struct {
+	Category       models.TransactionCategory `json:"category"`
+	Label          string                     `json:"label"`
+	MonthlyAverage float64                    `json:"monthly_average"`
+}
+
+// EmergencyFundResponse is how many months of essential expenses savings
+// cover, in the user's preferred currency
+type EmergencyFundResponse struct {
+	Currency          string             `json:"currency"`
+	HistoryMonths     int                `json:"history_months"`
+	MonthlyEssentials float64            `json:"monthly_essentials"`
+	Essentials        []EssentialExpense `json:"essentials"`
+	Savings           float64            `json:"savings"`
+	MonthsCovered     *float64           `json:"months_covered,omitempty"`
+	TargetMonths      int                `json:"target_months"`
+	TargetAmount      float64            `json:"target_amount"`
+	Shortfall         float64            `json:"shortfall"`
+	ProgressPct       float64            `json:"progress_pct"`
+}
+
+// EmergencyFund averages essential expenses (groceries, transport,
+// utilities, rent and healthcare) over the last ?months= complete months
+// and reports how many months the balance of savings accounts covers and how
+// much more is needed to cover ?target_months= (default 6)
+func (h *PlanningHandler) EmergencyFund(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	targetMonths := defaultEmergencyFundMonths
+	if v := query.Get("target_months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEmergencyFundMonths {
+			jsonError(w, fmt.Sprintf("target_months must be between 1 and %d", maxEmergencyFundMonths), http.StatusBadRequest)
+			return
+		}
+		targetMonths = n
+	}
+	historyMonths := defaultEssentialsHistory
+	if v := query.Get("months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEssentialsHistory {
+			jsonError(w, fmt.Sprintf("months must be between 1 and %d", maxEssentialsHistory), http.StatusBadRequest)
+			return
+		}
+		historyMonths = n
+	}
+
+	currency, err := h.preferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+	var monthStartDay sql.NullInt64
+	err = h.db.QueryRowContext(ctx, "SELECT month_start_day FROM users WHERE id = ?", userID).Scan(&monthStartDay)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+	prefs := models.PeriodPreferences{MonthStartDay: int(monthStartDay.Int64)}
+
+	// The current month is left out so a month in progress doesn't pull the
+	// average down
+	end := prefs.MonthContaining(time.Now())
+	start := end.AddDate(0, -historyMonths, 0)
+
+	essentials := models.EssentialCategories()
+	placeholders := make([]string, len(essentials))
+	args := []interface{}{userID, middleware.GetProfileID(ctx), start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05")}
+	for i, c := range essentials {
+		placeholders[i] = "?"
+		args = append(args, string(c))
+	}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT t.category, a.currency, SUM(t.amount)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ? AND t.type IN ('withdrawal', 'expense')
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ? AND t.created_at < ?
+		  AND t.category IN (`+strings.Join(placeholders, ", ")+`)
+		GROUP BY t.category, a.currency
+	`, args...)
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	totals := make(map[models.TransactionCategory]float64)
+	for rows.Next() {
+		var category, accountCurrency string
+		var amount float64
+		if err := rows.Scan(&category, &accountCurrency, &amount); err != nil {
+			continue
+		}
+		totals[models.TransactionCategory(category)] += h.convert(userID, amount, accountCurrency, currency)
+	}
+	rows.Close()
+
+	response := EmergencyFundResponse{
+		Currency:      currency,
+		HistoryMonths: historyMonths,
+		Essentials:    []EssentialExpense{},
+		TargetMonths:  targetMonths,
+	}
+	for _, c := range essentials {
+		average := math.Round(totals[c]/float64(historyMonths)*100) / 100
+		response.Essentials = append(response.Essentials, EssentialExpense{
+			Category:       c,
+			Label:          models.LocalizedCategoryLabel(middleware.GetLocale(ctx), c),
+			MonthlyAverage: average,
+		})
+		response.MonthlyEssentials += average
+	}
+	response.MonthlyEssentials = math.Round(response.MonthlyEssentials*100) / 100
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT currency, current_balance
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ? AND type = ?
+	`, userID, middleware.GetProfileID(ctx), models.AccountTypeSaving)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var accountCurrency string
+		var balance float64
+		if err := rows.Scan(&accountCurrency, &balance); err != nil {
+			continue
+		}
+		response.Savings += h.convert(userID, balance, accountCurrency, currency)
+	}
+	response.Savings = math.Round(response.Savings*100) / 100
+
+	response.TargetAmount = math.Round(response.MonthlyEssentials*float64(targetMonths)*100) / 100
+	response.Shortfall = math.Max(math.Round((response.TargetAmount-response.Savings)*100)/100, 0)
+	response.ProgressPct = 100
+	if response.TargetAmount > 0 {
+		response.ProgressPct = math.Min(math.Round(response.Savings/response.TargetAmount*10000)/100, 100)
+	}
+	// Without essential expenses on record there is nothing to cover
+	if response.MonthlyEssentials > 0 {
+		covered := math.Round(response.Savings/response.MonthlyEssentials*10) / 10
+		response.MonthsCovered = &covered
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// Ages a retirement projection can run between
+const (
+	minRetirementAge = 16
+	maxRetirementAge = 100
+)
+
+// RetirementResponse is a retirement projection in the user's preferred
+// currency
+type RetirementResponse struct {
+	*services.RetirementProjection
+	Currency string `json:"currency"`
+}
+
+// Retirement projects savings and investment balances, plus a
+// monthly_contribution, from current_age to target_age. Each account grows
+// at its own interest rate (investments without one at the default return)
+// and the pessimistic and optimistic scenarios shift every rate down or up.
+func (h *PlanningHandler) Retirement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	monthlyContribution := 0.0
+	if v := query.Get("monthly_contribution"); v != "" {
+		var err error
+		monthlyContribution, err = strconv.ParseFloat(v, 64)
+		if err != nil || monthlyContribution < 0 {
+			jsonError(w, "monthly_contribution cannot be negative", http.StatusBadRequest)
+			return
+		}
+	}
+	currentAge, err := strconv.Atoi(query.Get("current_age"))
+	if err != nil || currentAge < minRetirementAge || currentAge >= maxRetirementAge {
+		jsonError(w, fmt.Sprintf("current_age must be between %d and %d", minRetirementAge, maxRetirementAge-1), http.StatusBadRequest)
+		return
+	}
+	targetAge, err := strconv.Atoi(query.Get("target_age"))
+	if err != nil || targetAge <= currentAge || targetAge > maxRetirementAge {
+		jsonError(w, fmt.Sprintf("target_age must be after current_age and at most %d", maxRetirementAge), http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.preferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, type, currency, current_balance, yearly_interest_rate
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ? AND type IN (?, ?)
+		ORDER BY id
+	`, userID, middleware.GetProfileID(ctx), models.AccountTypeSaving, models.AccountTypeInvestment)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	accounts := []services.RetirementAccount{}
+	for rows.Next() {
+		var a services.RetirementAccount
+		var accountCurrency string
+		var rate sql.NullFloat64
+		if err := rows.Scan(&a.AccountID, &a.Name, &a.Type, &accountCurrency, &a.Balance, &rate); err != nil {
+			jsonError(w, "Failed to scan account", http.StatusInternalServerError)
+			return
+		}
+		if a.Balance <= 0 {
+			continue
+		}
+		a.YearlyRate = rate.Float64
+		if !rate.Valid && models.AccountType(a.Type) == models.AccountTypeInvestment {
+			a.YearlyRate = services.DefaultInvestmentReturn
+		}
+		a.Balance = math.Round(h.convert(userID, a.Balance, accountCurrency, currency)*100) / 100
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+
+	projection := services.ProjectRetirement(accounts, monthlyContribution, currentAge, targetAge, time.Now())
+	jsonResponse(w, RetirementResponse{RetirementProjection: projection, Currency: currency}, http.StatusOK)
+}
+
+// maxRunwayDays caps how far ahead a runway projection can look
+const maxRunwayDays = 90
+
+// Runway projects the balance of each asset account day by day over the
+// next ?days= (default 30), taking off the bills due from it and its
+// average discretionary spending over the last services.RunwayHistoryDays
+// days, and warns about accounts projected to go negative. Spending that
+// paid a bill, transfers and cash withdrawals don't count as discretionary.
+func (h *PlanningHandler) Runway(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	days := services.DefaultRunwayDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRunwayDays {
+			jsonError(w, fmt.Sprintf("days must be between 1 and %d", maxRunwayDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	profileID := middleware.GetProfileID(ctx)
+	today := startOfDay(time.Now())
+	locale := services.UserLocale(ctx, h.db, userID)
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, type, currency, current_balance
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ? AND type IN (?, ?, ?, ?, ?)
+		ORDER BY id
+	`, userID, profileID, models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving,
+		models.AccountTypeInvestment, models.AccountTypeAsset)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	accounts := []services.RunwayAccount{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var a services.RunwayAccount
+		if err := rows.Scan(&a.AccountID, &a.Name, &a.Type, &a.Currency, &a.Balance); err != nil {
+			rows.Close()
+			jsonError(w, "Failed to scan account", http.StatusInternalServerError)
+			return
+		}
+		index[a.AccountID] = len(accounts)
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT t.account_id, SUM(t.amount)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ? AND t.type = 'withdrawal'
+		  AND t.created_at >= ?
+		  AND COALESCE(t.category, 'other') NOT IN (?, ?)
+		  AND t.reimbursement_status IS NULL
+		  AND t.id NOT IN (SELECT transaction_id FROM bill_payments WHERE transaction_id IS NOT NULL)
+		GROUP BY t.account_id
+	`, userID, profileID, today.AddDate(0, 0, -services.RunwayHistoryDays).Format("2006-01-02 15:04:05"),
+		string(models.CategoryTransfer), string(models.CategoryCashWithdrawal))
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var accountID int64
+		var spent float64
+		if err := rows.Scan(&accountID, &spent); err != nil {
+			continue
+		}
+		if i, ok := index[accountID]; ok {
+			accounts[i].DailySpending = math.Round(spent/services.RunwayHistoryDays*100) / 100
+		}
+	}
+	rows.Close()
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT b.id, b.name, b.account_id, b.amount, b.due_day, b.next_due_date
+		FROM bills b
+		JOIN accounts a ON b.account_id = a.id
+		WHERE b.user_id = ? AND a.profile_id = ?
+	`, userID, profileID)
+	if err != nil {
+		jsonError(w, "Failed to fetch bills", http.StatusInternalServerError)
+		return
+	}
+	bills := []services.RunwayBill{}
+	for rows.Next() {
+		var b services.RunwayBill
+		if err := rows.Scan(&b.ID, &b.Name, &b.AccountID, &b.Amount, &b.DueDay, &b.NextDueDate); err != nil {
+			continue
+		}
+		if _, ok := index[b.AccountID]; ok {
+			bills = append(bills, b)
+		}
+	}
+	rows.Close()
+
+	projection := services.ProjectRunway(accounts, services.ScheduleBills(bills, today, days), today, days)
+	for _, a := range projection.Accounts {
+		if a.NegativeOn == nil {
+			continue
+		}
+		projection.Warnings = append(projection.Warnings, models.TranslateMessage(middleware.GetLocale(ctx),
+			fmt.Sprintf("Projected to go negative: %s on %s, reaching %s", a.Name, *a.NegativeOn,
+				services.FormatMoney(a.LowestBalance, a.Currency, locale))))
+	}
+
+	jsonResponse(w, projection, http.StatusOK)
+}
+
+func (h *PlanningHandler) preferredCurrency(ctx context.Context, userID int64) (string, error) {
+	var preferredCurrency sql.NullString
+	err := h.db.QueryRowContext(ctx, "SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferredCurrency)
+	if err != nil {
+		return "", err
+	}
+	if preferredCurrency.String == "" {
+		return "DOP", nil
+	}
+	return preferredCurrency.String, nil
+}
+
+func (h *PlanningHandler) convert(userID int64, amount float64, from, to string) float64 {
+	if from == to || h.exchangeService == nil {
+		return amount
+	}
+	converted, err := h.exchangeService.ConvertFor(userID, amount, from, to)
+	if err != nil {
+		return amount
+	}
+	return converted
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+type ProfileHandler struct {
+	db    *sql.DB
+	audit *services.AuditService
+}
+
+func NewProfileHandler(db *sql.DB, audit *services.AuditService) *ProfileHandler {
+	return &ProfileHandler{db: db, audit: audit}
+}
+
+// List returns the user's profiles, the default profile first
+func (h *ProfileHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	counts := make(map[int64]int)
+	rows, err := h.db.QueryContext(ctx, "SELECT profile_id, COUNT(*) FROM accounts WHERE user_id = ? GROUP BY profile_id", userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch profiles", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var profileID int64
+		var count int
+		if err := rows.Scan(&profileID, &count); err == nil {
+			counts[profileID] = count
+		}
+	}
+	rows.Close()
+
+	profiles := []models.Profile{{
+		ID:           models.DefaultProfileID,
+		Name:         models.DefaultProfileName,
+		Kind:         models.ProfileKindPersonal,
+		IsDefault:    true,
+		AccountCount: counts[models.DefaultProfileID],
+	}}
+
+	rows, err = h.db.QueryContext(ctx, "SELECT id, name, kind, created_at FROM profiles WHERE user_id = ? ORDER BY name", userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch profiles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Profile
+		var createdAt time.Time
+		if err := rows.Scan(&p.ID, &p.Name, &p.Kind, &createdAt); err != nil {
+			continue
+		}
+		p.CreatedAt = &createdAt
+		p.AccountCount = counts[p.ID]
+		profiles = append(profiles, p)
+	}
+
+	jsonResponse(w, profiles, http.StatusOK)
+}
+
+// Create adds a profile. Kind defaults to business.
+func (h *ProfileHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == nil {
+		jsonError(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	name, err := models.ValidateProfileName(*req.Name)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	kind := models.ProfileKindBusiness
+	if req.Kind != nil {
+		kind = *req.Kind
+	}
+	if !kind.IsValid() {
+		jsonError(w, "Invalid kind: use personal or business", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO profiles (user_id, name, kind, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, name, string(kind), now, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			jsonError(w, "A profile with this name already exists", http.StatusConflict)
+			return
+		}
+		jsonError(w, "Failed to create profile", http.StatusInternalServerError)
+		return
+	}
+	profileID, _ := result.LastInsertId()
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityProfile,
+		Action:   "created",
+		EntityID: &profileID,
+		Summary:  "Created profile " + name,
+	})
+
+	jsonResponse(w, models.Profile{ID: profileID, Name: name, Kind: kind, CreatedAt: &now}, http.StatusCreated)
+}
+
+// Update renames a profile or changes its kind. The default profile can't
+// be changed.
+func (h *ProfileHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	profile, ok := h.profileFromURL(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var req models.ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil {
+		name, err := models.ValidateProfileName(*req.Name)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		profile.Name = name
+	}
+	if req.Kind != nil {
+		if !req.Kind.IsValid() {
+			jsonError(w, "Invalid kind: use personal or business", http.StatusBadRequest)
+			return
+		}
+		profile.Kind = *req.Kind
+	}
+
+	_, err := h.db.ExecContext(ctx, "UPDATE profiles SET name = ?, kind = ?, updated_at = ? WHERE id = ?",
+		profile.Name, string(profile.Kind), time.Now(), profile.ID)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			jsonError(w, "A profile with this name already exists", http.StatusConflict)
+			return
+		}
+		jsonError(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityProfile,
+		Action:   "updated",
+		EntityID: &profile.ID,
+		Summary:  "Updated profile " + profile.Name,
+	})
+
+	jsonResponse(w, profile, http.StatusOK)
+}
+
+// Delete removes a profile and its budgets. Its accounts have to be moved
+// or deleted first.
+func (h *ProfileHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	profile, ok := h.profileFromURL(w, r, userID)
+	if !ok {
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var accounts int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM accounts WHERE user_id = ? AND profile_id = ?", userID, profile.ID).Scan(&accounts); err != nil {
+		jsonError(w, "Failed to delete profile", http.StatusInternalServerError)
+		return
+	}
+	if accounts > 0 {
+		jsonError(w, "Move or delete the profile's accounts first", http.StatusConflict)
+		return
+	}
+
+	for _, query := range []string{
+		"DELETE FROM category_budgets WHERE user_id = ? AND profile_id = ?",
+		"DELETE FROM budget_versions WHERE user_id = ? AND profile_id = ?",
+		"DELETE FROM budget_allocations WHERE user_id = ? AND profile_id = ?",
+		"DELETE FROM api_keys WHERE user_id = ? AND profile_id = ?",
+		"DELETE FROM insights WHERE user_id = ? AND profile_id = ?",
+		"DELETE FROM profiles WHERE user_id = ? AND id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID, profile.ID); err != nil {
+			jsonError(w, "Failed to delete profile", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityProfile,
+		Action:   "deleted",
+		EntityID: &profile.ID,
+		Summary:  "Deleted profile " + profile.Name,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveAccount moves one of the user's accounts, from any profile, into the
+// profile in the URL. Its transactions move with it.
+func (h *ProfileHandler) MoveAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+	name := models.DefaultProfileName
+	if profileID != models.DefaultProfileID {
+		profile, ok := h.profileFromURL(w, r, userID)
+		if !ok {
+			return
+		}
+		name = profile.Name
+	}
+
+	var req models.MoveAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "UPDATE accounts SET profile_id = ?, updated_at = ?, version = version + 1 WHERE id = ? AND user_id = ?",
+		profileID, time.Now(), req.AccountID, userID)
+	if err != nil {
+		jsonError(w, "Failed to move account", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	// Budgets freezing the account belong to the profile it left
+	h.db.ExecContext(ctx, "UPDATE category_budgets SET freeze_account_id = NULL WHERE freeze_account_id = ? AND profile_id != ?", req.AccountID, profileID)
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityAccount,
+		Action:   "moved",
+		EntityID: &req.AccountID,
+		Summary:  "Moved an account to profile " + name,
+		Details:  map[string]interface{}{"profile_id": profileID},
+	})
+
+	jsonResponse(w, map[string]string{"message": "Account moved successfully"}, http.StatusOK)
+}
+
+// profileFromURL loads the profile in the URL, writing the error response
+// when it isn't one of the user's profiles. The default profile has no row
+// and is never found.
+func (h *ProfileHandler) profileFromURL(w http.ResponseWriter, r *http.Request, userID int64) (*models.Profile, bool) {
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid profile ID", http.StatusBadRequest)
+		return nil, false
+	}
+	if profileID == models.DefaultProfileID {
+		jsonError(w, "The default profile can't be changed", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var p models.Profile
+	var createdAt time.Time
+	err = h.db.QueryRowContext(r.Context(), "SELECT id, name, kind, created_at FROM profiles WHERE id = ? AND user_id = ?", profileID, userID).
+		Scan(&p.ID, &p.Name, &p.Kind, &createdAt)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Profile not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch profile", http.StatusInternalServerError)
+		return nil, false
+	}
+	p.CreatedAt = &createdAt
+	return &p, true
+}
+
+// accountInProfile reports whether an account is one of the user's in the
+// active profile
+func accountInProfile(ctx context.Context, db *sql.DB, accountID, userID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?)",
+		accountID, userID, middleware.GetProfileID(ctx)).Scan(&exists)
+	return exists, err
+}
+
+// transactionInProfile reports whether a transaction is on one of the
+// user's accounts in the active profile
+func transactionInProfile(ctx context.Context, db *sql.DB, transactionID, userID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM transactions t
+			JOIN accounts a ON t.account_id = a.id
+			WHERE t.id = ? AND a.user_id = ? AND a.profile_id = ?
+		)
+	`, transactionID, userID, middleware.GetProfileID(ctx)).Scan(&exists)
+	return exists, err
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/internal/services/nlparse"
+)
+
+// Quick records a transaction from a phrase such as "coffee 4.50 visa", for
+// iOS Shortcuts and Android automations. It's authenticated with an
+// integration key and answers with a sentence to show or speak. Phrases
+// that leave the account unclear, or name another currency, are refused
+// rather than guessed.
+func (h *IntegrationHandler) Quick(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.QuickEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		jsonError(w, "text is required", http.StatusBadRequest)
+		return
+	}
+
+	accounts, err := profileAccounts(ctx, h.db, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	parsed, err := h.parser.Parse(ctx, nlparse.Input{Text: req.Text, Accounts: accounts, Now: time.Now()})
+	if errors.Is(err, nlparse.ErrNoAmount) {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to read the text", http.StatusInternalServerError)
+		return
+	}
+
+	// Nothing is recorded that a person would have wanted to check first
+	var account *models.Account
+	for _, a := range accounts {
+		if parsed.AccountID != nil && a.ID == *parsed.AccountID {
+			account = a
+		}
+	}
+	if account == nil || parsed.Currency != "" && !strings.EqualFold(parsed.Currency, account.Currency) || account.Type == models.AccountTypeLoan {
+		jsonError(w, strings.Join(parsed.Warnings, "; "), http.StatusBadRequest)
+		return
+	}
+	create := parsed.Transaction
+
+	// Record it exactly like the API does, then answer with a sentence
+	rec := httptest.NewRecorder()
+	h.transactions.create(ctx, rec, userID, account.ID, create)
+	if rec.Code != http.StatusCreated {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+		return
+	}
+
+	var transaction models.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &transaction); err != nil {
+		jsonError(w, "Transaction recorded but failed to read it back", http.StatusInternalServerError)
+		return
+	}
+	locale := services.UserLocale(ctx, h.db, userID)
+	verb := "Spent"
+	if create.Type == models.TransactionTypeDeposit {
+		verb = "Received"
+	}
+	jsonResponse(w, models.QuickEntryResponse{
+		Transaction: transaction,
+		AccountName: account.Name,
+		Message: fmt.Sprintf("%s %s on %s (%s). Balance: %s", verb,
+			services.FormatMoney(create.Amount, account.Currency, locale),
+			account.Name, create.Category,
+			services.FormatMoney(transaction.BalanceAfter, account.Currency, locale)),
+	}, http.StatusCreated)
+}
+
+// profileAccounts returns the user's accounts in the active profile
+func profileAccounts(ctx context.Context, db *sql.DB, userID int64) ([]*models.Account, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+accountColumns+`
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ?
+		ORDER BY name
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
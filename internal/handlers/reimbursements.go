@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ListReimbursable returns the user's reimbursable expenses, newest first,
+// with the total still pending in the preferred currency. ?status= limits
+// the list to pending or reimbursed expenses.
+func (h *TransactionHandler) ListReimbursable(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	statuses := []interface{}{string(models.ReimbursementPending), string(models.ReimbursementReimbursed)}
+	switch status := models.ReimbursementStatus(r.URL.Query().Get("status")); status {
+	case "":
+	case models.ReimbursementPending, models.ReimbursementReimbursed:
+		statuses = []interface{}{string(status)}
+	default:
+		jsonError(w, "Invalid status: use pending or reimbursed", http.StatusBadRequest)
+		return
+	}
+
+	var preferred sql.NullString
+	if err := h.db.QueryRowContext(ctx, "SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferred); err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+	list := models.ReimbursementList{Currency: "DOP", Transactions: []models.Transaction{}}
+	if preferred.String != "" {
+		list.Currency = preferred.String
+	}
+
+	args := append([]interface{}{userID, middleware.GetProfileID(ctx)}, statuses...)
+	placeholders := "?"
+	if len(statuses) == 2 {
+		placeholders = "?, ?"
+	}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+transactionColumns+`, a.currency
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ? AND t.reimbursement_status IN (`+placeholders+`)
+		ORDER BY t.created_at DESC, t.id DESC
+	`, args...)
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency string
+		t, err := scanTransaction(rows, &currency)
+		if err != nil {
+			continue
+		}
+		if t.ReimbursementStatus == models.ReimbursementPending {
+			list.Pending += h.convert(userID, t.Amount, currency, list.Currency)
+		}
+		list.Transactions = append(list.Transactions, *t)
+	}
+	list.Pending = math.Round(list.Pending*100) / 100
+
+	jsonResponse(w, list, http.StatusOK)
+}
+
+// LinkReimbursement marks a reimbursable expense as repaid by one of the
+// user's deposits. A deposit can repay several expenses; relinking an
+// expense releases its previous deposit when nothing else links to it.
+func (h *TransactionHandler) LinkReimbursement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	transactionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.LinkReimbursementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.DepositID == 0 {
+		jsonError(w, "deposit_id is required", http.StatusBadRequest)
+		return
+	}
+	if !checkTransactionsOpen(ctx, w, h.db, userID, transactionID, req.DepositID) {
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var status sql.NullString
+	var previous sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT t.reimbursement_status, t.reimbursed_by_id
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ? AND a.user_id = ? AND a.profile_id = ?
+	`, transactionID, userID, middleware.GetProfileID(ctx)).Scan(&status, &previous)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+	if status.String != string(models.ReimbursementPending) && status.String != string(models.ReimbursementReimbursed) {
+		jsonError(w, "Transaction is not reimbursable", http.StatusBadRequest)
+		return
+	}
+
+	var depositType models.TransactionType
+	var depositCategory sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT t.type, t.category
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ? AND a.user_id = ? AND a.profile_id = ?
+	`, req.DepositID, userID, middleware.GetProfileID(ctx)).Scan(&depositType, &depositCategory)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Deposit not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch deposit", http.StatusInternalServerError)
+		return
+	}
+	if depositType != models.TransactionTypeDeposit || depositCategory.String == string(models.CategoryTransfer) {
+		jsonError(w, "Reimbursements must be deposits from outside your accounts", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE transactions SET reimbursement_status = ?, reimbursed_by_id = ? WHERE id = ?",
+		string(models.ReimbursementReimbursed), req.DepositID, transactionID); err != nil {
+		jsonError(w, "Failed to link reimbursement", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE transactions SET reimbursement_status = ? WHERE id = ?",
+		string(models.ReimbursementDeposit), req.DepositID); err != nil {
+		jsonError(w, "Failed to link reimbursement", http.StatusInternalServerError)
+		return
+	}
+	if previous.Valid && previous.Int64 != req.DepositID {
+		if err := releaseReimbursement(ctx, tx, previous.Int64); err != nil {
+			jsonError(w, "Failed to link reimbursement", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "reimbursed",
+		EntityID: &transactionID,
+		Summary:  "Linked a reimbursement to an expense",
+		Details:  map[string]interface{}{"deposit_id": req.DepositID},
+	})
+
+	h.respondTransaction(ctx, w, transactionID)
+}
+
+// UnlinkReimbursement returns a reimbursed expense to pending
+func (h *TransactionHandler) UnlinkReimbursement(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	transactionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	if !checkTransactionsOpen(ctx, w, h.db, userID, transactionID) {
+		return
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var status sql.NullString
+	var deposit sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+		SELECT t.reimbursement_status, t.reimbursed_by_id
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ? AND a.user_id = ? AND a.profile_id = ?
+	`, transactionID, userID, middleware.GetProfileID(ctx)).Scan(&status, &deposit)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+	if status.String != string(models.ReimbursementReimbursed) {
+		jsonError(w, "Transaction has no linked reimbursement", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE transactions SET reimbursement_status = ?, reimbursed_by_id = NULL WHERE id = ?",
+		string(models.ReimbursementPending), transactionID); err != nil {
+		jsonError(w, "Failed to unlink reimbursement", http.StatusInternalServerError)
+		return
+	}
+	if deposit.Valid {
+		if err := releaseReimbursement(ctx, tx, deposit.Int64); err != nil {
+			jsonError(w, "Failed to unlink reimbursement", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "unreimbursed",
+		EntityID: &transactionID,
+		Summary:  "Unlinked a reimbursement from an expense",
+	})
+
+	h.respondTransaction(ctx, w, transactionID)
+}
+
+// respondTransaction writes a transaction as the response
+func (h *TransactionHandler) respondTransaction(ctx context.Context, w http.ResponseWriter, transactionID int64) {
+	transaction, err := scanTransaction(h.db.QueryRowContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ?
+	`, transactionID))
+	if err != nil {
+		jsonError(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, transaction, http.StatusOK)
+}
+
+// releaseReimbursement turns a deposit back into ordinary income once no
+// expense is linked to it
+func releaseReimbursement(ctx context.Context, tx *sql.Tx, depositID int64) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE transactions SET reimbursement_status = NULL
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM transactions WHERE reimbursed_by_id = ?)
+	`, depositID, depositID)
+	if err != nil {
+		return fmt.Errorf("release reimbursement %d: %w", depositID, err)
+	}
+	return nil
+}
+
+// convert converts an amount between currencies with the user's rates,
+// falling back to the original amount when no rate is available
+func (h *TransactionHandler) convert(userID int64, amount float64, from, to string) float64 {
+	if from == to || h.exchangeService == nil {
+		return amount
+	}
+	converted, err := h.exchangeService.ConvertFor(userID, amount, from, to)
+	if err != nil {
+		return amount
+	}
+	return converted
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/kengru/odin-wallet/pkg/database"
+)
+
+// ReplicationHandler reports on database replication for the admin API
+type ReplicationHandler struct {
+	db          *sql.DB
+	replication *database.Replication
+}
+
+func NewReplicationHandler(db *sql.DB, replication *database.Replication) *ReplicationHandler {
+	return &ReplicationHandler{db: db, replication: replication}
+}
+
+// Status returns the replication mode, whether this server is the primary
+// and the size of the write-ahead log
+func (h *ReplicationHandler) Status(w http.ResponseWriter, r *http.Request) {
+	status, err := h.replication.Status(r.Context(), h.db)
+	if err != nil {
+		jsonError(w, "Failed to read replication status", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, status, http.StatusOK)
+}
+
+// Checkpoint copies the write-ahead log into the database file as far as
+// replication allows, for taking a consistent snapshot of the file
+func (h *ReplicationHandler) Checkpoint(w http.ResponseWriter, r *http.Request) {
+	cp, err := h.replication.Checkpoint(r.Context(), h.db)
+	if err != nil {
+		jsonError(w, "Failed to checkpoint the database", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, cp, http.StatusOK)
+}
@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	appMiddleware "github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+	"github.com/kengru/odin-wallet/pkg/database"
+	"github.com/kengru/odin-wallet/pkg/hooks"
+)
+
+func TestLiteFSReplica(t *testing.T) {
+	dir := t.TempDir()
+	registry := hooks.New()
+	var shutdown []string
+	registry.OnShutdown(func(ctx context.Context) { shutdown = append(shutdown, "flushed") })
+	registry.OnShutdown(func(ctx context.Context) { panic("plugin bug") })
+	registry.OnShutdown(func(ctx context.Context) { shutdown = append(shutdown, "closed") })
+
+	cfg := testutil.DefaultConfig()
+	cfg.AdminEmails = []string{"admin@example.com"}
+	cfg.Hooks = registry
+	cfg.Replication = database.NewReplication(database.ReplicationLiteFS, filepath.Join(dir, "wallet.db"))
+	app := testutil.NewAppWithConfig(t, cfg)
+	admin := app.Register(t, "admin@example.com")
+	ana := app.Register(t, "ana@example.com")
+	optIn := true
+	ana.Put("/api/user/preferences", models.UpdatePreferencesRequest{TelemetryOptIn: &optIn}).Expect(http.StatusOK)
+	ana.Get("/api/accounts").Expect(http.StatusOK)
+
+	var status database.ReplicationStatus
+	admin.Get("/api/admin/replication").Expect(http.StatusOK).Decode(&status)
+	if status.Mode != database.ReplicationLiteFS || !status.Primary {
+		t.Fatalf("status = %+v, want the LiteFS primary", status)
+	}
+	ana.Get("/api/admin/replication").Expect(http.StatusForbidden)
+	var cp database.Checkpoint
+	admin.Post("/api/admin/replication/checkpoint", nil).Expect(http.StatusOK).Decode(&cp)
+	admin.Get("/api/admin/replication").Expect(http.StatusOK).Decode(&status)
+	if status.LastCheckpoint == nil {
+		t.Error("last checkpoint missing from the status")
+	}
+
+	// LiteFS names the primary in .primary on replicas
+	if err := os.WriteFile(filepath.Join(dir, ".primary"), []byte("wallet-1.internal\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp := ana.Post("/api/accounts", models.CreateAccountRequest{Name: "Cash", Type: models.AccountTypeCash, Currency: "DOP"}).
+		Expect(http.StatusServiceUnavailable)
+	if got := resp.Header.Get(appMiddleware.PrimaryHeader); got != "wallet-1.internal" {
+		t.Errorf("primary header = %q, want wallet-1.internal", got)
+	}
+	// Reads don't write on a replica, not even usage counters
+	ana.Get("/api/accounts").Expect(http.StatusOK)
+	var uses int
+	if err := app.DB.QueryRow("SELECT count FROM feature_usage WHERE user_id = ? AND feature = 'accounts'", ana.User.ID).Scan(&uses); err != nil {
+		t.Fatal(err)
+	}
+	if uses != 1 {
+		t.Errorf("accounts used %d times, want only the read on the primary counted", uses)
+	}
+	admin.Get("/api/admin/replication").Expect(http.StatusOK).Decode(&status)
+	if status.Primary || status.PrimaryHost != "wallet-1.internal" {
+		t.Errorf("replica status = %+v, want it to name the primary", status)
+	}
+
+	// Promoted back to primary
+	if err := os.Remove(filepath.Join(dir, ".primary")); err != nil {
+		t.Fatal(err)
+	}
+	ana.CreateAccount(models.CreateAccountRequest{Name: "Cash", Type: models.AccountTypeCash, Currency: "DOP"})
+
+	if err := app.Server.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(shutdown) != 2 || shutdown[0] != "flushed" || shutdown[1] != "closed" {
+		t.Errorf("shutdown hooks ran %v, want both around the panicking one, in order", shutdown)
+	}
+}
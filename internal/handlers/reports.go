@@ -1,25 +1,37 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
 	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/hooks"
 )
 
 type ReportHandler struct {
 	db              *sql.DB
 	exchangeService *services.ExchangeService
+	budgets         *services.BudgetService
+	hooks           *hooks.Registry
 }
 
-func NewReportHandler(db *sql.DB, exchangeService *services.ExchangeService) *ReportHandler {
-	return &ReportHandler{db: db, exchangeService: exchangeService}
+func NewReportHandler(db *sql.DB, exchangeService *services.ExchangeService, budgetService *services.BudgetService, hookRegistry *hooks.Registry) *ReportHandler {
+	return &ReportHandler{db: db, exchangeService: exchangeService, budgets: budgetService, hooks: hookRegistry}
 }
 
 type CategoryReport struct {
 	Category   string   `json:"category"`
+	Label      string   `json:"label"`
 	Amount     float64  `json:"amount"`
 	Budget     *float64 `json:"budget,omitempty"`
 	Percentage *float64 `json:"percentage,omitempty"`
@@ -29,6 +41,7 @@ type CategoryReport struct {
 type ReportResponse struct {
 	PeriodStart          string           `json:"period_start"`
 	PeriodEnd            string           `json:"period_end"`
+	PeriodLabel          string           `json:"period_label"`
 	Currency             string           `json:"currency"`
 	TotalIncome          float64          `json:"total_income"`
 	TotalExpenses        float64          `json:"total_expenses"`
@@ -37,7 +50,8 @@ type ReportResponse struct {
 }
 
 func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -49,182 +63,204 @@ func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
 		period = "month"
 	}
 
-	dateStr := r.URL.Query().Get("date")
-	var startDate, endDate time.Time
+	prefs, err := h.periodPreferences(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
 
-	now := time.Now()
+	startDate, endDate, err := reportPeriod(period, r.URL.Query().Get("date"), time.Now(), prefs)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.buildReport(ctx, userID, period, startDate, endDate)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.reportGenerated(ctx, userID, "json", period, report)
+	jsonResponse(w, report, http.StatusOK)
+}
+
+// reportGenerated runs the plugin hooks for a report that was generated
+func (h *ReportHandler) reportGenerated(ctx context.Context, userID int64, format, period string, report *ReportResponse) {
+	byCategory := make(map[string]float64, len(report.ExpensesByCategory))
+	for _, c := range report.ExpensesByCategory {
+		byCategory[c.Category] = c.Amount
+	}
+	h.hooks.ReportGenerated(ctx, hooks.Report{
+		UserID:             userID,
+		Format:             format,
+		Period:             period,
+		PeriodStart:        report.PeriodStart,
+		PeriodEnd:          report.PeriodEnd,
+		Currency:           report.Currency,
+		TotalIncome:        report.TotalIncome,
+		TotalExpenses:      report.TotalExpenses,
+		ExpensesByCategory: byCategory,
+	})
+}
+
+// reportPeriod resolves the start and end of the week or month containing
+// dateStr, or the current period when dateStr is empty. Weeks and months
+// begin where the user's period preferences say; a month given as YYYY-MM is
+// the financial month starting in that calendar month.
+func reportPeriod(period, dateStr string, now time.Time, prefs models.PeriodPreferences) (time.Time, time.Time, error) {
+	var startDate, endDate time.Time
 
 	if dateStr == "" {
 		// Default to current period
 		if period == "week" {
-			// Start of current week (Sunday)
-			weekday := int(now.Weekday())
-			startDate = time.Date(now.Year(), now.Month(), now.Day()-weekday, 0, 0, 0, 0, now.Location())
+			startDate = prefs.WeekContaining(now)
 			endDate = startDate.AddDate(0, 0, 7).Add(-time.Second)
 		} else {
-			// Start of current month
-			startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+			startDate = prefs.MonthContaining(now)
 			endDate = startDate.AddDate(0, 1, 0).Add(-time.Second)
 		}
-	} else {
-		// Parse the provided date
-		if period == "week" {
-			// Expect format: "2025-W52" or just a date like "2025-12-23"
-			parsed, err := time.Parse("2006-01-02", dateStr)
+		return startDate, endDate, nil
+	}
+
+	// Parse the provided date
+	if period == "week" {
+		// Expect format: "2025-W52" or just a date like "2025-12-23"
+		parsed, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			// Try parsing as year-month
+			parsed, err = time.Parse("2006-01", dateStr)
 			if err != nil {
-				// Try parsing as year-month
-				parsed, err = time.Parse("2006-01", dateStr)
-				if err != nil {
-					jsonError(w, "Invalid date format. Use YYYY-MM-DD or YYYY-MM", http.StatusBadRequest)
-					return
-				}
+				return startDate, endDate, errors.New("Invalid date format. Use YYYY-MM-DD or YYYY-MM")
 			}
-			weekday := int(parsed.Weekday())
-			startDate = time.Date(parsed.Year(), parsed.Month(), parsed.Day()-weekday, 0, 0, 0, 0, parsed.Location())
-			endDate = startDate.AddDate(0, 0, 7).Add(-time.Second)
+		}
+		startDate = prefs.WeekContaining(parsed)
+		endDate = startDate.AddDate(0, 0, 7).Add(-time.Second)
+	} else {
+		// Expect format: "2025-12"
+		if parsed, err := time.Parse("2006-01", dateStr); err == nil {
+			startDate = prefs.MonthStarting(parsed.Year(), parsed.Month(), parsed.Location())
 		} else {
-			// Expect format: "2025-12"
-			parsed, err := time.Parse("2006-01", dateStr)
+			// Try full date format
+			parsed, err = time.Parse("2006-01-02", dateStr)
 			if err != nil {
-				// Try full date format
-				parsed, err = time.Parse("2006-01-02", dateStr)
-				if err != nil {
-					jsonError(w, "Invalid date format. Use YYYY-MM or YYYY-MM-DD", http.StatusBadRequest)
-					return
-				}
+				return startDate, endDate, errors.New("Invalid date format. Use YYYY-MM or YYYY-MM-DD")
 			}
-			startDate = time.Date(parsed.Year(), parsed.Month(), 1, 0, 0, 0, 0, parsed.Location())
-			endDate = startDate.AddDate(0, 1, 0).Add(-time.Second)
+			startDate = prefs.MonthContaining(parsed)
 		}
+		endDate = startDate.AddDate(0, 1, 0).Add(-time.Second)
 	}
 
-	// Get user's preferred currency
-	var preferredCurrency sql.NullString
-	err := h.db.QueryRow("SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferredCurrency)
-	if err != nil && err != sql.ErrNoRows {
-		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
-		return
-	}
+	return startDate, endDate, nil
+}
 
-	baseCurrency := "DOP"
-	if preferredCurrency.Valid && preferredCurrency.String != "" {
-		baseCurrency = preferredCurrency.String
+// periodPreferences loads where the user's weeks and months begin
+func (h *ReportHandler) periodPreferences(ctx context.Context, userID int64) (models.PeriodPreferences, error) {
+	var weekStart, monthStartDay sql.NullInt64
+	err := h.db.QueryRowContext(ctx, "SELECT week_start, month_start_day FROM users WHERE id = ?", userID).Scan(&weekStart, &monthStartDay)
+	if err != nil && err != sql.ErrNoRows {
+		return models.PeriodPreferences{}, err
 	}
+	return models.PeriodPreferences{
+		WeekStart:     time.Weekday(weekStart.Int64),
+		MonthStartDay: int(monthStartDay.Int64),
+	}, nil
+}
 
-	// Get all user's account IDs with their currencies
-	accountCurrencies := make(map[int64]string)
-	accountRows, err := h.db.Query("SELECT id, currency FROM accounts WHERE user_id = ?", userID)
+// buildReport aggregates income, expenses and budget progress for a period in
+// the user's preferred currency
+func (h *ReportHandler) buildReport(ctx context.Context, userID int64, period string, startDate, endDate time.Time) (*ReportResponse, error) {
+	baseCurrency, err := h.getPreferredCurrency(ctx, userID)
 	if err != nil {
-		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
-		return
+		return nil, errors.New("Failed to fetch user preferences")
 	}
-	defer accountRows.Close()
 
-	var accountIDs []int64
-	for accountRows.Next() {
-		var id int64
-		var currency string
-		if err := accountRows.Scan(&id, &currency); err != nil {
-			continue
-		}
-		accountIDs = append(accountIDs, id)
-		accountCurrencies[id] = currency
-	}
-
-	if len(accountIDs) == 0 {
-		// No accounts, return empty report
-		jsonResponse(w, ReportResponse{
-			PeriodStart:        startDate.Format("2006-01-02"),
-			PeriodEnd:          endDate.Format("2006-01-02"),
-			Currency:           baseCurrency,
-			TotalIncome:        0,
-			TotalExpenses:      0,
-			ExpensesByCategory: []CategoryReport{},
-		}, http.StatusOK)
-		return
+	locale := middleware.GetLocale(ctx)
+	periodLabel := models.MonthLabel(locale, startDate)
+	if period == "week" {
+		periodLabel = models.WeekLabel(locale, startDate)
 	}
 
-	// Build query for transactions within date range
-	query := `
-		SELECT t.account_id, t.type, t.amount, t.category, t.created_at
+	// Totals are grouped per currency in SQL and converted afterwards.
+	// Payments (credit card payments) are internal transfers reducing debt,
+	// and starting balances and cash withdrawals aren't income or spending.
+	category := reportCategory(ctx)
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT a.currency, t.type, `+category+`, SUM(t.amount)
 		FROM transactions t
 		JOIN accounts a ON t.account_id = a.id
-		WHERE a.user_id = ? AND t.created_at >= ? AND t.created_at <= ?
-		ORDER BY t.created_at DESC
-	`
-
-	rows, err := h.db.Query(query, userID, startDate.Format("2006-01-02 15:04:05"), endDate.Format("2006-01-02 15:04:05"))
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.created_at >= ? AND t.created_at <= ?
+		  AND t.type IN ('deposit', 'withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		GROUP BY a.currency, t.type, `+category+`
+	`, userID, middleware.GetProfileID(ctx), startDate.Format("2006-01-02 15:04:05"), endDate.Format("2006-01-02 15:04:05"))
 	if err != nil {
-		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
-		return
+		return nil, errors.New("Failed to fetch transactions")
 	}
 	defer rows.Close()
 
-	var totalIncome, totalExpenses float64
-	expensesByCategory := make(map[string]float64)
+	income := make(map[string]float64)
+	expenses := make(map[string]float64)
+	expensesByCategory := make(map[string]map[string]float64)
 
 	for rows.Next() {
-		var accountID int64
-		var txType string
+		var currency, txType, category string
 		var amount float64
-		var category string
-		var createdAt time.Time
-
-		if err := rows.Scan(&accountID, &txType, &amount, &category, &createdAt); err != nil {
-			continue
+		if err := rows.Scan(&currency, &txType, &category, &amount); err != nil {
+			return nil, errors.New("Failed to fetch transactions")
 		}
 
-		// Convert to base currency
-		accountCurrency := accountCurrencies[accountID]
-		convertedAmount := amount
-		if accountCurrency != baseCurrency && h.exchangeService != nil {
-			converted, err := h.exchangeService.Convert(amount, accountCurrency, baseCurrency)
-			if err == nil {
-				convertedAmount = converted
-			}
+		if txType == "deposit" {
+			income[currency] += amount
+			continue
 		}
-
-		// Categorize based on transaction type
-		switch txType {
-		case "deposit":
-			totalIncome += convertedAmount
-		case "withdrawal", "expense":
-			totalExpenses += convertedAmount
-			expensesByCategory[category] += convertedAmount
+		expenses[currency] += amount
+		if expensesByCategory[category] == nil {
+			expensesByCategory[category] = make(map[string]float64)
 		}
-		// Note: "payment" type (credit card payments) are not counted as income or expense
-		// They're internal transfers reducing debt
+		expensesByCategory[category][currency] += amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.New("Failed to fetch transactions")
 	}
 
-	// Get first transaction date for this user
+	totalIncome := h.convertTotals(userID, income, baseCurrency)
+	totalExpenses := h.convertTotals(userID, expenses, baseCurrency)
+
+	// Get first transaction date for this user. Taking each account's first
+	// transaction reads one index entry per account rather than the whole
+	// history, and the aggregate comes back as text: its first ten
+	// characters are the local calendar day.
 	var firstTxDate *string
-	var firstDate sql.NullTime
-	err = h.db.QueryRow(`
-		SELECT MIN(t.created_at)
-		FROM transactions t
-		JOIN accounts a ON t.account_id = a.id
-		WHERE a.user_id = ?
-	`, userID).Scan(&firstDate)
-	if err == nil && firstDate.Valid {
-		dateStr := firstDate.Time.Format("2006-01-02")
+	var firstDate sql.NullString
+	err = h.db.QueryRowContext(ctx, `
+		SELECT MIN((SELECT MIN(t.created_at) FROM transactions t WHERE t.account_id = a.id))
+		FROM accounts a
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+`
+	`, userID, middleware.GetProfileID(ctx)).Scan(&firstDate)
+	if err == nil && len(firstDate.String) >= 10 {
+		dateStr := firstDate.String[:10]
 		firstTxDate = &dateStr
 	}
 
-	// Fetch user's budgets (only for monthly reports)
+	// Fetch budgets whose period matches the report, using the limits in
+	// effect at the time and any amount carried over from earlier periods.
+	// Budgets track spending on every account, so advisors don't see them.
 	budgets := make(map[string]float64)
-	if period == "month" {
-		budgetRows, err := h.db.Query(`
-			SELECT category, monthly_limit
-			FROM category_budgets
-			WHERE user_id = ?
-		`, userID)
-		if err == nil {
-			defer budgetRows.Close()
-			for budgetRows.Next() {
-				var category string
-				var limit float64
-				if err := budgetRows.Scan(&category, &limit); err == nil {
-					budgets[category] = limit
+	budgetPeriod := map[string]models.BudgetPeriod{
+		"week":  models.BudgetPeriodWeekly,
+		"month": models.BudgetPeriodMonthly,
+	}[period]
+	budgetsAt := endDate
+	if now := time.Now(); !now.Before(startDate) && now.Before(endDate) {
+		budgetsAt = now
+	}
+	if middleware.GetAdvisorAccess(ctx) == nil {
+		if progress, err := h.budgets.Progress(ctx, userID, budgetsAt); err == nil {
+			for _, p := range progress {
+				if p.Period == budgetPeriod {
+					budgets[p.Category] = p.Available
 				}
 			}
 		}
@@ -232,9 +268,11 @@ func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
 
 	// Build category reports with budget information
 	categoryReports := make([]CategoryReport, 0, len(expensesByCategory))
-	for category, amount := range expensesByCategory {
+	for category, amounts := range expensesByCategory {
+		amount := h.convertTotals(userID, amounts, baseCurrency)
 		catReport := CategoryReport{
 			Category: category,
+			Label:    models.LocalizedCategoryLabel(locale, models.TransactionCategory(category)),
 			Amount:   amount,
 		}
 
@@ -250,15 +288,599 @@ func (h *ReportHandler) GetReport(w http.ResponseWriter, r *http.Request) {
 		categoryReports = append(categoryReports, catReport)
 	}
 
-	report := ReportResponse{
+	return &ReportResponse{
 		PeriodStart:          startDate.Format("2006-01-02"),
 		PeriodEnd:            endDate.Format("2006-01-02"),
+		PeriodLabel:          periodLabel,
 		Currency:             baseCurrency,
 		TotalIncome:          totalIncome,
 		TotalExpenses:        totalExpenses,
 		ExpensesByCategory:   categoryReports,
 		FirstTransactionDate: firstTxDate,
+	}, nil
+}
+
+// getPreferredCurrency returns the user's preferred currency, defaulting to DOP
+func (h *ReportHandler) getPreferredCurrency(ctx context.Context, userID int64) (string, error) {
+	var preferredCurrency sql.NullString
+	err := h.db.QueryRowContext(ctx, "SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferredCurrency)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
 	}
 
-	jsonResponse(w, report, http.StatusOK)
+	if preferredCurrency.Valid && preferredCurrency.String != "" {
+		return preferredCurrency.String, nil
+	}
+	return "DOP", nil
+}
+
+// convert converts an amount into the base currency with the user's rates,
+// falling back to the original amount when no rate is available
+func (h *ReportHandler) convert(userID int64, amount float64, from, to string) float64 {
+	if from == to || h.exchangeService == nil {
+		return amount
+	}
+	converted, err := h.exchangeService.ConvertFor(userID, amount, from, to)
+	if err != nil {
+		return amount
+	}
+	return converted
+}
+
+// convertTotals converts amounts keyed by currency into the base currency
+// and adds them up
+func (h *ReportHandler) convertTotals(userID int64, totals map[string]float64, to string) float64 {
+	var sum float64
+	for currency, amount := range totals {
+		sum += h.convert(userID, amount, currency, to)
+	}
+	return sum
+}
+
+// TopTransaction is a single large expense highlighted in a report
+type TopTransaction struct {
+	ID          int64   `json:"id"`
+	AccountName string  `json:"account_name"`
+	Description string  `json:"description"`
+	Category    string  `json:"category"`
+	Amount      float64 `json:"amount"`
+	Date        string  `json:"date"`
+}
+
+// topExpenses returns the largest expenses in a period, converted to the base
+// currency and sorted by converted amount
+func (h *ReportHandler) topExpenses(ctx context.Context, userID int64, startDate, endDate time.Time, baseCurrency string, limit int) ([]TopTransaction, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT t.id, a.name, a.currency, COALESCE(t.description, ''), COALESCE(t.category, 'other'), t.amount, t.created_at,
+		       COALESCE(t.is_private, 0)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.type IN ('withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ? AND t.created_at <= ?
+	`, userID, middleware.GetProfileID(ctx), startDate.Format("2006-01-02 15:04:05"), endDate.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	top := []TopTransaction{}
+	for rows.Next() {
+		var t TopTransaction
+		var currency string
+		var createdAt time.Time
+		var private bool
+		if err := rows.Scan(&t.ID, &t.AccountName, &currency, &t.Description, &t.Category, &t.Amount, &createdAt, &private); err != nil {
+			continue
+		}
+		t.Description = services.DecryptField(userID, t.Description)
+		redactReportRow(ctx, private, &t.Description, &t.Category)
+		t.Amount = h.convert(userID, t.Amount, currency, baseCurrency)
+		t.Date = createdAt.Format("2006-01-02")
+		top = append(top, t)
+	}
+
+	sort.Slice(top, func(i, j int) bool { return top[i].Amount > top[j].Amount })
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top, nil
+}
+
+// MonthlyPDF renders the monthly report (totals, category breakdown and top
+// transactions) as a downloadable PDF
+func (h *ReportHandler) MonthlyPDF(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	prefs, err := h.periodPreferences(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	startDate, endDate, err := reportPeriod("month", r.URL.Query().Get("date"), time.Now(), prefs)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.buildReport(ctx, userID, "month", startDate, endDate)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	top, err := h.topExpenses(ctx, userID, startDate, endDate, report.Currency, 10)
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+
+	locale := services.UserLocale(ctx, h.db, userID)
+	money := func(amount float64) string {
+		return services.FormatMoney(amount, report.Currency, locale)
+	}
+
+	doc := services.NewPDFDocument()
+	doc.Title("Odin Wallet - Monthly Report")
+	doc.Paragraph(startDate.Format("January 2006") + " (" + report.PeriodStart + " to " + report.PeriodEnd + ")")
+	doc.Paragraph("Generated " + time.Now().Format("2006-01-02 15:04") + ", amounts in " + report.Currency)
+	doc.Line()
+
+	doc.Heading("Summary")
+	summaryWidths := []float64{200}
+	doc.Row([]string{"Total income", money(report.TotalIncome)}, summaryWidths, false)
+	doc.Row([]string{"Total expenses", money(report.TotalExpenses)}, summaryWidths, false)
+	doc.Row([]string{"Net", money(report.TotalIncome - report.TotalExpenses)}, summaryWidths, true)
+
+	doc.Heading("Expenses by category")
+	categories := append([]CategoryReport(nil), report.ExpensesByCategory...)
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Amount > categories[j].Amount })
+	categoryWidths := []float64{150, 110, 110}
+	doc.Row([]string{"Category", "Spent", "Budget", "Used"}, categoryWidths, true)
+	if len(categories) == 0 {
+		doc.Paragraph("No expenses recorded this month.")
+	}
+	for _, c := range categories {
+		budget, used := "-", "-"
+		if c.Budget != nil {
+			budget = money(*c.Budget)
+			used = fmt.Sprintf("%.0f%%", *c.Percentage)
+		}
+		doc.Row([]string{categoryLabel(c.Category), money(c.Amount), budget, used}, categoryWidths, false)
+	}
+
+	doc.Heading("Top transactions")
+	topWidths := []float64{70, 190, 110, 100}
+	doc.Row([]string{"Date", "Description", "Account", "Amount"}, topWidths, true)
+	if len(top) == 0 {
+		doc.Paragraph("No transactions recorded this month.")
+	}
+	for _, t := range top {
+		doc.Row([]string{t.Date, truncate(t.Description, 32), truncate(t.AccountName, 18), money(t.Amount)}, topWidths, false)
+	}
+
+	h.reportGenerated(ctx, userID, "pdf", "month", report)
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="odin-wallet-report-%s.pdf"`, startDate.Format("2006-01")))
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc.Bytes())
+}
+
+// categoryLabel returns the human-readable label for a category
+func categoryLabel(category string) string {
+	if label, ok := models.CategoryLabels[models.TransactionCategory(category)]; ok {
+		return label
+	}
+	return category
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+// Delta describes how a value changed between two periods
+type Delta struct {
+	A             float64  `json:"a"`
+	B             float64  `json:"b"`
+	Change        float64  `json:"change"`
+	PercentChange *float64 `json:"percent_change"`
+}
+
+func newDelta(a, b float64) Delta {
+	d := Delta{A: a, B: b, Change: b - a}
+	if a != 0 {
+		// Relative to the magnitude so a shrinking deficit reads as an improvement
+		percent := (b - a) / math.Abs(a) * 100
+		d.PercentChange = &percent
+	}
+	return d
+}
+
+// CategoryComparison is the change in spending for a single category
+type CategoryComparison struct {
+	Category string `json:"category"`
+	Delta
+}
+
+// ComparisonPeriod identifies one side of a comparison
+type ComparisonPeriod struct {
+	PeriodStart string `json:"period_start"`
+	PeriodEnd   string `json:"period_end"`
+}
+
+// ReportComparison compares two report periods
+type ReportComparison struct {
+	Period     string               `json:"period"`
+	Currency   string               `json:"currency"`
+	A          ComparisonPeriod     `json:"a"`
+	B          ComparisonPeriod     `json:"b"`
+	Income     Delta                `json:"income"`
+	Expenses   Delta                `json:"expenses"`
+	Net        Delta                `json:"net"`
+	Categories []CategoryComparison `json:"categories"`
+}
+
+// Compare returns income, expense and per-category deltas between period a
+// and period b. When omitted, b defaults to the current period and a to the
+// period right before b.
+func (h *ReportHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if period != "month" && period != "week" {
+		jsonError(w, "Invalid period. Use month or week", http.StatusBadRequest)
+		return
+	}
+
+	prefs, err := h.periodPreferences(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	bStart, bEnd, err := reportPeriod(period, r.URL.Query().Get("b"), time.Now(), prefs)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var aStart, aEnd time.Time
+	if aStr := r.URL.Query().Get("a"); aStr != "" {
+		aStart, aEnd, err = reportPeriod(period, aStr, time.Now(), prefs)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Previous period: any instant just before b starts
+		aStart, aEnd, _ = reportPeriod(period, bStart.AddDate(0, 0, -1).Format("2006-01-02"), time.Now(), prefs)
+	}
+
+	reportA, err := h.buildReport(ctx, userID, period, aStart, aEnd)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	reportB, err := h.buildReport(ctx, userID, period, bStart, bEnd)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	categoryAmounts := make(map[string][2]float64)
+	for _, c := range reportA.ExpensesByCategory {
+		amounts := categoryAmounts[c.Category]
+		amounts[0] = c.Amount
+		categoryAmounts[c.Category] = amounts
+	}
+	for _, c := range reportB.ExpensesByCategory {
+		amounts := categoryAmounts[c.Category]
+		amounts[1] = c.Amount
+		categoryAmounts[c.Category] = amounts
+	}
+
+	categories := make([]CategoryComparison, 0, len(categoryAmounts))
+	for category, amounts := range categoryAmounts {
+		categories = append(categories, CategoryComparison{
+			Category: category,
+			Delta:    newDelta(amounts[0], amounts[1]),
+		})
+	}
+	// Biggest movers first
+	sort.Slice(categories, func(i, j int) bool {
+		ci, cj := categories[i].Change, categories[j].Change
+		if ci < 0 {
+			ci = -ci
+		}
+		if cj < 0 {
+			cj = -cj
+		}
+		if ci != cj {
+			return ci > cj
+		}
+		return categories[i].Category < categories[j].Category
+	})
+
+	jsonResponse(w, ReportComparison{
+		Period:     period,
+		Currency:   reportB.Currency,
+		A:          ComparisonPeriod{PeriodStart: reportA.PeriodStart, PeriodEnd: reportA.PeriodEnd},
+		B:          ComparisonPeriod{PeriodStart: reportB.PeriodStart, PeriodEnd: reportB.PeriodEnd},
+		Income:     newDelta(reportA.TotalIncome, reportB.TotalIncome),
+		Expenses:   newDelta(reportA.TotalExpenses, reportB.TotalExpenses),
+		Net:        newDelta(reportA.TotalIncome-reportA.TotalExpenses, reportB.TotalIncome-reportB.TotalExpenses),
+		Categories: categories,
+	}, http.StatusOK)
+}
+
+// maxTrendMonths bounds how far back a category trend reaches
+const maxTrendMonths = 36
+
+// TrendPoint is a category's spending in one month
+type TrendPoint struct {
+	Month       string  `json:"month"`
+	Label       string  `json:"label"`
+	PeriodStart string  `json:"period_start"`
+	Amount      float64 `json:"amount"`
+}
+
+// CategoryTrend is a category's month-by-month spending
+type CategoryTrend struct {
+	Category string       `json:"category"`
+	Label    string       `json:"label"`
+	Currency string       `json:"currency"`
+	Total    float64      `json:"total"`
+	Average  float64      `json:"average"`
+	Months   []TrendPoint `json:"months"`
+}
+
+// CategoryTrend returns a category's spending for each of the last ?months=
+// months (default 12, including the current one), oldest first. Months follow
+// the user's financial month and amounts are in the preferred currency.
+func (h *ReportHandler) CategoryTrend(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	category := models.TransactionCategory(chi.URLParam(r, "category"))
+	if !isValidCategory(category) {
+		jsonError(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+
+	months := 12
+	if v := r.URL.Query().Get("months"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTrendMonths {
+			jsonError(w, fmt.Sprintf("months must be between 1 and %d", maxTrendMonths), http.StatusBadRequest)
+			return
+		}
+		months = n
+	}
+
+	prefs, err := h.periodPreferences(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	current := prefs.MonthContaining(now)
+	starts := make([]time.Time, months)
+	for i := range starts {
+		starts[i] = current.AddDate(0, i-months+1, 0)
+	}
+	end := current.AddDate(0, 1, 0)
+
+	// Months begin at midnight, so totals are grouped per local calendar day
+	// and currency in SQL, then bucketed into months and converted once per
+	// month and currency
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT substr(t.created_at, 1, 10) AS day, a.currency, SUM(t.amount)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.type IN ('withdrawal', 'expense')
+		  AND `+reportCategory(ctx)+` = ?
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ? AND t.created_at < ?
+		GROUP BY day, a.currency
+	`, userID, middleware.GetProfileID(ctx), category, starts[0].Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	amounts := make([]map[string]float64, months)
+	for i := range amounts {
+		amounts[i] = make(map[string]float64)
+	}
+	for rows.Next() {
+		var day, accountCurrency string
+		var amount float64
+		if err := rows.Scan(&day, &accountCurrency, &amount); err != nil {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", day, now.Location())
+		if err != nil {
+			continue
+		}
+		// Latest month whose start isn't after the day
+		i := sort.Search(months, func(i int) bool { return starts[i].After(date) }) - 1
+		if i < 0 {
+			continue
+		}
+		amounts[i][accountCurrency] += amount
+	}
+
+	locale := middleware.GetLocale(ctx)
+	trend := CategoryTrend{
+		Category: string(category),
+		Label:    models.LocalizedCategoryLabel(locale, category),
+		Currency: currency,
+		Months:   make([]TrendPoint, months),
+	}
+	for i, start := range starts {
+		amount := math.Round(h.convertTotals(userID, amounts[i], currency)*100) / 100
+		trend.Months[i] = TrendPoint{
+			Month:       start.Format("2006-01"),
+			Label:       models.MonthLabel(locale, start),
+			PeriodStart: start.Format("2006-01-02"),
+			Amount:      amount,
+		}
+		trend.Total += amount
+	}
+	trend.Total = math.Round(trend.Total*100) / 100
+	trend.Average = math.Round(trend.Total/float64(months)*100) / 100
+
+	jsonResponse(w, trend, http.StatusOK)
+}
+
+// HeatmapDay is the spending on one calendar day
+type HeatmapDay struct {
+	Date   string  `json:"date"`
+	Amount float64 `json:"amount"`
+	Count  int     `json:"count"`
+}
+
+// SpendingHeatmap is a year of daily spending. Days without spending are
+// left out; Max is the busiest day, for scaling the colors.
+type SpendingHeatmap struct {
+	Year     int          `json:"year"`
+	Currency string       `json:"currency"`
+	Total    float64      `json:"total"`
+	Max      float64      `json:"max"`
+	Days     []HeatmapDay `json:"days"`
+}
+
+// Heatmap returns the total spent on each day of ?year= (default: this year)
+// in the preferred currency. Transfers, opening balances and cash withdrawals
+// aren't spending.
+func (h *ReportHandler) Heatmap(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	year, err := reviewYear(r.URL.Query().Get("year"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.Now().Location())
+	end := start.AddDate(1, 0, 0)
+
+	// Timestamps are stored in local time, so their first ten characters are
+	// the local calendar day. Totals are grouped per currency and converted
+	// afterwards.
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT substr(t.created_at, 1, 10) AS day, a.currency, SUM(t.amount), COUNT(*)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.type IN ('withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('transfer', 'opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ? AND t.created_at < ?
+		GROUP BY day, a.currency
+		ORDER BY day
+	`, userID, middleware.GetProfileID(ctx), start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	heatmap := SpendingHeatmap{Year: year, Currency: currency, Days: []HeatmapDay{}}
+	for rows.Next() {
+		var day, accountCurrency string
+		var amount float64
+		var count int
+		if err := rows.Scan(&day, &accountCurrency, &amount, &count); err != nil {
+			continue
+		}
+		amount = h.convert(userID, amount, accountCurrency, currency)
+
+		// Rows are ordered by day, so a day in several currencies is adjacent
+		if n := len(heatmap.Days); n > 0 && heatmap.Days[n-1].Date == day {
+			heatmap.Days[n-1].Amount += amount
+			heatmap.Days[n-1].Count += count
+		} else {
+			heatmap.Days = append(heatmap.Days, HeatmapDay{Date: day, Amount: amount, Count: count})
+		}
+	}
+
+	for i := range heatmap.Days {
+		day := &heatmap.Days[i]
+		day.Amount = math.Round(day.Amount*100) / 100
+		heatmap.Total += day.Amount
+		heatmap.Max = math.Max(heatmap.Max, day.Amount)
+	}
+	heatmap.Total = math.Round(heatmap.Total*100) / 100
+
+	jsonResponse(w, heatmap, http.StatusOK)
+}
+
+// reportCategory is the SQL expression a report groups a transaction's
+// category by. Advisors see private transactions under "other".
+func reportCategory(ctx context.Context) string {
+	if middleware.GetAdvisorAccess(ctx) != nil {
+		return "CASE WHEN COALESCE(t.is_private, 0) = 1 THEN 'other' ELSE COALESCE(t.category, 'other') END"
+	}
+	return "COALESCE(t.category, 'other')"
+}
+
+// redactReportRow hides the description and category of a private
+// transaction a report lists for an advisor
+func redactReportRow(ctx context.Context, private bool, description, category *string) {
+	t := models.Transaction{Description: *description, Category: models.TransactionCategory(*category), IsPrivate: private}
+	redactForViewer(ctx, &t)
+	*description, *category = t.Description, string(t.Category)
+}
+
+// reportAccounts narrows a report query to the accounts shared with an
+// advisor. column is the query's account ID column.
+func reportAccounts(ctx context.Context, column string) string {
+	access := middleware.GetAdvisorAccess(ctx)
+	if access == nil {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s IN (SELECT account_id FROM advisor_grant_accounts WHERE grant_id = %d)", column, access.GrantID)
 }
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/handlers"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestMonthlyReportTotals(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+
+	for _, tx := range []struct {
+		account int64
+		req     models.CreateTransactionRequest
+	}{
+		{f.Checking.ID, models.CreateTransactionRequest{Type: models.TransactionTypeDeposit, Amount: 40000, Category: models.CategoryIncome}},
+		{f.Checking.ID, models.CreateTransactionRequest{Type: models.TransactionTypeWithdrawal, Amount: 1500, Category: models.CategoryGroceries}},
+		{f.Card.ID, models.CreateTransactionRequest{Type: models.TransactionTypeExpense, Amount: 2500, Category: models.CategoryGroceries}},
+		{f.Savings.ID, models.CreateTransactionRequest{Type: models.TransactionTypeWithdrawal, Amount: 800, Category: models.CategoryDining}},
+	} {
+		f.Client.Post(fmt.Sprintf("/api/accounts/%d/transactions", tx.account), tx.req).Expect(http.StatusCreated)
+	}
+
+	var report handlers.ReportResponse
+	f.Client.Get("/api/reports").Expect(http.StatusOK).Decode(&report)
+
+	// Opening balances are neither income nor spending
+	if report.TotalIncome != 40000 {
+		t.Errorf("income = %v, want 40000", report.TotalIncome)
+	}
+	if report.TotalExpenses != 4800 {
+		t.Errorf("expenses = %v, want 4800", report.TotalExpenses)
+	}
+	byCategory := make(map[string]float64)
+	for _, c := range report.ExpensesByCategory {
+		byCategory[c.Category] = c.Amount
+	}
+	if byCategory["groceries"] != 4000 || byCategory["dining"] != 800 || len(byCategory) != 2 {
+		t.Errorf("expenses by category = %v, want groceries 4000 and dining 800", byCategory)
+	}
+	today := time.Now().Format("2006-01-02")
+	if report.FirstTransactionDate == nil || *report.FirstTransactionDate != today {
+		t.Errorf("first transaction date = %v, want %s", report.FirstTransactionDate, today)
+	}
+}
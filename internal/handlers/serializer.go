@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// serializer shapes a JSON response for one request. ?fields=id,name keeps
+// only the listed top-level fields, and ?expand=a.b adds nested resources the
+// endpoint supports (it fills them in with Expanding and Object). Without
+// either parameter responses are unchanged.
+type serializer struct {
+	fields map[string]bool
+	expand map[string]bool
+}
+
+// newSerializer reads fields and expand from the query string. Expansions
+// other than the allowed ones are rejected so typos don't silently return
+// less than the client asked for.
+func newSerializer(r *http.Request, allowedExpansions ...string) (*serializer, error) {
+	s := &serializer{}
+	if fields := splitList(r.URL.Query().Get("fields")); len(fields) > 0 {
+		s.fields = make(map[string]bool)
+		for _, f := range fields {
+			s.fields[f] = true
+		}
+	}
+
+	allowed := make(map[string]bool)
+	for _, e := range allowedExpansions {
+		allowed[e] = true
+	}
+	for _, e := range splitList(r.URL.Query().Get("expand")) {
+		if !allowed[e] {
+			return nil, fmt.Errorf("cannot expand %q", e)
+		}
+		if s.expand == nil {
+			s.expand = make(map[string]bool)
+		}
+		s.expand[e] = true
+	}
+	return s, nil
+}
+
+// Expanding reports whether the client asked for an expansion
+func (s *serializer) Expanding(path string) bool {
+	return s.expand[path]
+}
+
+// Object serializes v, adds expanded resources and drops fields that weren't
+// asked for. expanded maps expansion paths ("transactions.recent") to their
+// values, which are nested under the path's segments.
+func (s *serializer) Object(v interface{}, expanded map[string]interface{}) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// Keep numbers exact rather than round-tripping them through float64
+	var obj map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, err
+	}
+
+	for path, value := range expanded {
+		segments := strings.Split(path, ".")
+		parent := obj
+		for _, segment := range segments[:len(segments)-1] {
+			child, ok := parent[segment].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[segment] = child
+			}
+			parent = child
+		}
+		parent[segments[len(segments)-1]] = value
+	}
+
+	if s.fields == nil {
+		return obj, nil
+	}
+	for key := range obj {
+		if s.fields[key] {
+			continue
+		}
+		// Expansions are kept even when their field wasn't listed
+		if _, ok := expanded[key]; ok {
+			continue
+		}
+		if s.expandsUnder(key) {
+			continue
+		}
+		delete(obj, key)
+	}
+	return obj, nil
+}
+
+// expandsUnder reports whether an expansion nests under a top-level key
+func (s *serializer) expandsUnder(key string) bool {
+	for path := range s.expand {
+		if strings.HasPrefix(path, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList parses a comma-separated query parameter
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// CreateSnapshot records the account's current balances and limits along
+// with an optional note
+func (h *AccountHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional
+	var req models.CreateSnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if utf8.RuneCountInString(req.Note) > models.MaxSnapshotNoteLength {
+		jsonError(w, fmt.Sprintf("Note must be at most %d characters", models.MaxSnapshotNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	var note interface{}
+	if req.Note != "" {
+		note = req.Note
+	}
+
+	// Copy straight from the row so the snapshot is consistent even if a
+	// transaction lands at the same time
+	result, err := h.db.ExecContext(ctx, `
+		INSERT INTO account_snapshots (
+			account_id, note, name, type, currency, current_balance, credit_limit, credit_owed,
+			loan_initial_amount, loan_current_owed, monthly_payment, yearly_interest_rate, status, created_at
+		)
+		SELECT id, ?, name, type, currency, current_balance, credit_limit, credit_owed,
+		       loan_initial_amount, loan_current_owed, monthly_payment, yearly_interest_rate, COALESCE(status, 'active'), ?
+		FROM accounts
+		WHERE id = ?
+	`, note, time.Now(), account.ID)
+	if err != nil {
+		jsonError(w, "Failed to create snapshot", http.StatusInternalServerError)
+		return
+	}
+	snapshotID, _ := result.LastInsertId()
+
+	snapshot, err := h.snapshotByID(ctx, account.ID, snapshotID)
+	if err != nil {
+		jsonError(w, "Snapshot created but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, snapshot, http.StatusCreated)
+}
+
+// ListSnapshots returns an account's snapshots, newest first
+func (h *AccountHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, snapshotQuery+" WHERE account_id = ? ORDER BY created_at DESC, id DESC", account.ID)
+	if err != nil {
+		jsonError(w, "Failed to fetch snapshots", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	snapshots := []models.AccountSnapshot{}
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, *s)
+	}
+
+	jsonResponse(w, snapshots, http.StatusOK)
+}
+
+// DeleteSnapshot removes a snapshot
+func (h *AccountHandler) DeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	account, ok := h.accountFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	snapshotID, err := strconv.ParseInt(chi.URLParam(r, "snapshotID"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid snapshot ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM account_snapshots WHERE id = ? AND account_id = ?", snapshotID, account.ID)
+	if err != nil {
+		jsonError(w, "Failed to delete snapshot", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const snapshotQuery = `
+	SELECT id, account_id, COALESCE(note, ''), name, type, currency, current_balance, credit_limit, credit_owed,
+	       loan_initial_amount, loan_current_owed, monthly_payment, yearly_interest_rate, status, created_at
+	FROM account_snapshots
+`
+
+func (h *AccountHandler) snapshotByID(ctx context.Context, accountID, snapshotID int64) (*models.AccountSnapshot, error) {
+	return scanSnapshot(h.db.QueryRowContext(ctx, snapshotQuery+" WHERE id = ? AND account_id = ?", snapshotID, accountID))
+}
+
+func scanSnapshot(row rowScanner) (*models.AccountSnapshot, error) {
+	var s models.AccountSnapshot
+	var creditLimit, creditOwed, loanInitial, loanOwed, monthlyPayment, rate sql.NullFloat64
+	err := row.Scan(&s.ID, &s.AccountID, &s.Note, &s.Name, &s.Type, &s.Currency, &s.CurrentBalance,
+		&creditLimit, &creditOwed, &loanInitial, &loanOwed, &monthlyPayment, &rate, &s.Status, &s.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.CreditLimit = nullFloat(creditLimit)
+	s.CreditOwed = nullFloat(creditOwed)
+	s.LoanInitialAmount = nullFloat(loanInitial)
+	s.LoanCurrentOwed = nullFloat(loanOwed)
+	s.MonthlyPayment = nullFloat(monthlyPayment)
+	s.YearlyInterestRate = nullFloat(rate)
+	return &s, nil
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
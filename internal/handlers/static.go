@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// StaticHandler serves the built frontend. Paths that aren't files get
+// index.html so the SPA can route them. Files are opened through http.FS,
+// which refuses names that climb out of the dist folder.
+type StaticHandler struct {
+	root http.FileSystem
+}
+
+func NewStaticHandler(dir string) *StaticHandler {
+	return &StaticHandler{root: http.FS(os.DirFS(dir))}
+}
+
+// precompressed are the encodings the frontend build writes next to each
+// asset, in order of preference
+var precompressed = []struct {
+	encoding  string
+	extension string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func (h *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if containsDotDot(r.URL.Path) {
+		http.Error(w, "invalid URL path", http.StatusBadRequest)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	if !h.isFile(name) {
+		// Serve index.html for SPA routing
+		name = "/index.html"
+	}
+
+	w.Header().Set("Cache-Control", cacheControl(name))
+	h.serveFile(w, r, name)
+}
+
+// containsDotDot reports whether a URL path has a ".." segment. Cleaning
+// would resolve it inside the root anyway, but such a request is never a
+// legitimate one.
+func containsDotDot(p string) bool {
+	for _, segment := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *StaticHandler) isFile(name string) bool {
+	f, err := h.root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
+
+// cacheControl returns the caching policy for a file. Vite puts content
+// hashes in the names of everything under assets/, so those never change;
+// anything else, index.html above all, must be revalidated so a deploy is
+// picked up right away.
+func cacheControl(name string) string {
+	if strings.HasPrefix(name, "/assets/") {
+		return "public, max-age=31536000, immutable"
+	}
+	return "no-cache"
+}
+
+// serveFile serves a precompressed copy of the file when the client accepts
+// its encoding, falling back to the file itself
+func (h *StaticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	accepted := r.Header.Get("Accept-Encoding")
+	for _, p := range precompressed {
+		if !acceptsEncoding(accepted, p.encoding) {
+			continue
+		}
+		f, err := h.root.Open(name + p.extension)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			continue
+		}
+
+		// The type is the original file's, not the archive's
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Encoding", p.encoding)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+		return
+	}
+
+	f, err := h.root.Open(name)
+	if err != nil {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, "404 page not found", http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows an
+// encoding, honoring q=0 exclusions
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
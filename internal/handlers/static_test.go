@@ -0,0 +1,133 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/handlers"
+	appMiddleware "github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestStaticCachingAndPrecompression(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":              "<html>app</html>",
+		"assets/index-abc1.js":    "console.log('app')",
+		"assets/index-abc1.js.br": "brotli bytes",
+		"favicon.svg":             "<svg/>",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := handlers.NewStaticHandler(dir)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		body           string
+		cacheControl   string
+		encoding       string
+	}{
+		{"spa route", "/accounts/3", "", "<html>app</html>", "no-cache", ""},
+		{"hashed asset", "/assets/index-abc1.js", "gzip", "console.log('app')", "public, max-age=31536000, immutable", ""},
+		{"precompressed asset", "/assets/index-abc1.js", "gzip, br", "brotli bytes", "public, max-age=31536000, immutable", "br"},
+		{"encoding refused", "/assets/index-abc1.js", "br;q=0", "console.log('app')", "public, max-age=31536000, immutable", ""},
+		{"unhashed file", "/favicon.svg", "br", "<svg/>", "no-cache", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			if got := rec.Body.String(); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestStaticRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	dist := filepath.Join(dir, "dist")
+	if err := os.MkdirAll(dist, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dist, "index.html"), []byte("<html>app</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := handlers.NewStaticHandler(dist)
+
+	for _, target := range []string{"/../secret.txt", "/assets/../../secret.txt", `/..\secret.txt`} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = target
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", target, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("%s: served a file outside dist", target)
+		}
+	}
+}
+
+func TestUnknownAPIPathIsJSON404(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Register(t, "ana@example.com")
+
+	for _, path := range []string{"/api/nope", "/api/accounts/1/nope"} {
+		if msg := c.Get(path).Expect(http.StatusNotFound).Error(); msg != "Not found" {
+			t.Errorf("%s: error = %q, want Not found", path, msg)
+		}
+	}
+}
+
+func TestAPIResponsesCarrySecurityHeaders(t *testing.T) {
+	app := testutil.NewApp(t)
+	c := app.Client(t)
+
+	for _, resp := range []*testutil.Response{
+		c.Get("/api/auth/registration").Expect(http.StatusOK),
+		c.Get("/api/accounts").Expect(http.StatusUnauthorized),
+	} {
+		for name, want := range map[string]string{
+			"Content-Security-Policy": appMiddleware.DefaultSecurityHeaders.ContentSecurityPolicy,
+			"X-Content-Type-Options":  "nosniff",
+			"X-Frame-Options":         "DENY",
+			"Referrer-Policy":         "strict-origin-when-cross-origin",
+		} {
+			if got := resp.Header.Get(name); got != want {
+				t.Errorf("%s = %q, want %q", name, got, want)
+			}
+		}
+	}
+}
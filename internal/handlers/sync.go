@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// syncPageSize caps the changes returned by one incremental pull
+const syncPageSize = 500
+
+var errSyncApply = errors.New("failed to apply mutation")
+
+// SyncHandler serves the offline sync protocol: clients pull changes since
+// a token and push mutations they made while offline
+type SyncHandler struct {
+	db           *sql.DB
+	transactions *TransactionHandler
+}
+
+func NewSyncHandler(db *sql.DB, transactions *TransactionHandler) *SyncHandler {
+	return &SyncHandler{db: db, transactions: transactions}
+}
+
+// Pull returns the accounts and transactions changed after the since token.
+// Without since it returns everything, for a first sync or to start over.
+func (h *SyncHandler) Pull(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		h.fullSync(ctx, w, userID)
+		return
+	}
+	seq, err := strconv.ParseInt(since, 10, 64)
+	if err != nil || seq < 0 {
+		jsonError(w, "Invalid sync token", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT seq, entity, entity_id, deleted, changed_at
+		FROM sync_changes
+		WHERE user_id = ? AND seq > ?
+		ORDER BY seq
+		LIMIT ?
+	`, userID, seq, syncPageSize+1)
+	if err != nil {
+		jsonError(w, "Failed to fetch changes", http.StatusInternalServerError)
+		return
+	}
+	type changeRow struct {
+		seq int64
+		models.SyncChange
+	}
+	var changed []changeRow
+	for rows.Next() {
+		var c changeRow
+		var changedAt time.Time
+		if err := rows.Scan(&c.seq, &c.Entity, &c.ID, &c.Deleted, &changedAt); err != nil {
+			rows.Close()
+			jsonError(w, "Failed to fetch changes", http.StatusInternalServerError)
+			return
+		}
+		c.ChangedAt = &changedAt
+		changed = append(changed, c)
+	}
+	rows.Close()
+
+	response := models.SyncResponse{Changes: []models.SyncChange{}, Token: since}
+	if len(changed) > syncPageSize {
+		changed = changed[:syncPageSize]
+		response.HasMore = true
+	}
+
+	for _, c := range changed {
+		if !c.Deleted {
+			data, err := h.entity(ctx, userID, c.Entity, c.ID)
+			if err != nil && err != sql.ErrNoRows {
+				jsonError(w, "Failed to fetch changes", http.StatusInternalServerError)
+				return
+			}
+			// Deleted after this page was read; its tombstone comes later
+			if err == sql.ErrNoRows {
+				continue
+			}
+			c.Data = data
+		}
+		response.Changes = append(response.Changes, c.SyncChange)
+		response.Token = strconv.FormatInt(c.seq, 10)
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+func (h *SyncHandler) fullSync(ctx context.Context, w http.ResponseWriter, userID int64) {
+	// Read the token first: anything written while the snapshot is taken is
+	// sent again on the next pull rather than missed
+	var seq int64
+	if err := h.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(seq), 0) FROM sync_changes").Scan(&seq); err != nil {
+		jsonError(w, "Failed to fetch changes", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.SyncResponse{Changes: []models.SyncChange{}, Token: strconv.FormatInt(seq, 10), Full: true}
+
+	rows, err := h.db.QueryContext(ctx, "SELECT "+accountColumns+" FROM accounts WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			rows.Close()
+			jsonError(w, "Failed to scan account", http.StatusInternalServerError)
+			return
+		}
+		response.Changes = append(response.Changes, models.SyncChange{Entity: models.SyncEntityAccount, ID: account.ID, Data: account})
+	}
+	rows.Close()
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ?
+		ORDER BY t.id
+	`, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		transaction, err := scanTransaction(rows)
+		if err != nil {
+			rows.Close()
+			jsonError(w, "Failed to scan transaction", http.StatusInternalServerError)
+			return
+		}
+		response.Changes = append(response.Changes, models.SyncChange{Entity: models.SyncEntityTransaction, ID: transaction.ID, Data: transaction})
+	}
+	rows.Close()
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// entity loads the current state of a synced entity the user owns
+func (h *SyncHandler) entity(ctx context.Context, userID int64, entity string, id int64) (interface{}, error) {
+	switch entity {
+	case models.SyncEntityAccount:
+		return scanAccount(h.db.QueryRowContext(ctx, "SELECT "+accountColumns+" FROM accounts WHERE id = ? AND user_id = ?", id, userID))
+	case models.SyncEntityTransaction:
+		return scanTransaction(h.db.QueryRowContext(ctx, `
+			SELECT `+transactionColumns+`
+			FROM transactions t
+			JOIN accounts a ON t.account_id = a.id
+			WHERE t.id = ? AND a.user_id = ?
+		`, id, userID))
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Push applies a batch of client mutations in order. Each gets its own
+// result; a rejected or conflicting mutation doesn't stop the rest.
+func (h *SyncHandler) Push(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Mutations) > models.MaxSyncMutations {
+		jsonError(w, "Too many mutations: send at most "+strconv.Itoa(models.MaxSyncMutations)+" per request", http.StatusBadRequest)
+		return
+	}
+	for _, m := range req.Mutations {
+		if m.ClientID == "" || len(m.ClientID) > 64 {
+			jsonError(w, "Every mutation needs a client_id of at most 64 characters", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Changes made by earlier mutations in the batch aren't conflicts for
+	// later ones editing the same transaction
+	applied := make(map[int64]int64)
+
+	response := models.SyncPushResponse{Results: make([]models.SyncMutationResult, 0, len(req.Mutations))}
+	for _, m := range req.Mutations {
+		result, err := h.applyMutation(ctx, userID, m, applied)
+		if err != nil {
+			jsonError(w, "Failed to apply mutations", http.StatusInternalServerError)
+			return
+		}
+		response.Results = append(response.Results, *result)
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// applyMutation applies one mutation and returns its result. applied maps
+// transactions updated earlier in the batch to the change they produced.
+func (h *SyncHandler) applyMutation(ctx context.Context, userID int64, m models.SyncMutation, applied map[int64]int64) (*models.SyncMutationResult, error) {
+	// A retried mutation gets the result it had the first time
+	var stored string
+	err := h.db.QueryRowContext(ctx, "SELECT result FROM sync_mutations WHERE user_id = ? AND client_id = ?", userID, m.ClientID).Scan(&stored)
+	if err == nil {
+		var result models.SyncMutationResult
+		if err := json.Unmarshal([]byte(services.DecryptField(userID, stored)), &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	result := &models.SyncMutationResult{ClientID: m.ClientID}
+	reject := func(message string) (*models.SyncMutationResult, error) {
+		result.Status = models.SyncStatusRejected
+		result.Error = message
+		return result, nil
+	}
+
+	if m.Entity != models.SyncEntityTransaction {
+		return reject("Only transactions can be changed through sync")
+	}
+
+	rec := httptest.NewRecorder()
+	switch m.Op {
+	case models.SyncOpCreate:
+		if m.AccountID == nil {
+			return reject("account_id is required")
+		}
+		var create models.CreateTransactionRequest
+		if err := json.Unmarshal(m.Data, &create); err != nil {
+			return reject("Invalid data")
+		}
+		h.transactions.create(ctx, rec, userID, *m.AccountID, create)
+
+	case models.SyncOpUpdate:
+		if m.ID == nil {
+			return reject("id is required")
+		}
+		var update models.UpdateTransactionRequest
+		if err := json.Unmarshal(m.Data, &update); err != nil {
+			return reject("Invalid data")
+		}
+
+		// The server's version wins if it changed after the client's copy
+		if m.BaseToken != "" {
+			base, err := strconv.ParseInt(m.BaseToken, 10, 64)
+			if err != nil {
+				return reject("Invalid base_token")
+			}
+			if seq := applied[*m.ID]; seq > base {
+				base = seq
+			}
+			var changed bool
+			err = h.db.QueryRowContext(ctx, `
+				SELECT EXISTS(SELECT 1 FROM sync_changes WHERE user_id = ? AND entity = ? AND entity_id = ? AND seq > ?)
+			`, userID, models.SyncEntityTransaction, *m.ID, base).Scan(&changed)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				current, err := h.entity(ctx, userID, models.SyncEntityTransaction, *m.ID)
+				if err == sql.ErrNoRows {
+					return reject("Transaction not found")
+				}
+				if err != nil {
+					return nil, err
+				}
+				result.Status = models.SyncStatusConflict
+				result.Data, _ = json.Marshal(current)
+				return result, nil
+			}
+		}
+		h.transactions.update(ctx, rec, userID, *m.ID, update)
+		if rec.Code == http.StatusOK {
+			var seq int64
+			h.db.QueryRowContext(ctx, `
+				SELECT COALESCE(MAX(seq), 0) FROM sync_changes WHERE entity = ? AND entity_id = ?
+			`, models.SyncEntityTransaction, *m.ID).Scan(&seq)
+			applied[*m.ID] = seq
+		}
+
+	default:
+		return reject("Invalid op: use create or update")
+	}
+
+	if rec.Code >= http.StatusInternalServerError {
+		return nil, errSyncApply
+	}
+	if rec.Code >= http.StatusBadRequest {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return reject(body.Error)
+	}
+
+	result.Status = models.SyncStatusApplied
+	result.Data = json.RawMessage(rec.Body.Bytes())
+
+	// Remember it so a retry doesn't create the transaction again. The
+	// result holds the transaction's description, so it's encrypted too.
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.db.ExecContext(ctx, `
+		INSERT INTO sync_mutations (user_id, client_id, result, created_at)
+		VALUES (?, ?, ?, ?)
+	`, userID, m.ClientID, services.EncryptField(userID, string(encoded)), time.Now()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
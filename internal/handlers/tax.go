@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// TaxCategoryTotal is a year's tax-relevant income and spending in one
+// category
+type TaxCategoryTotal struct {
+	Category string  `json:"category"`
+	Income   float64 `json:"income"`
+	Expenses float64 `json:"expenses"`
+	Count    int     `json:"count"`
+}
+
+// TaxSummary totals the transactions with one tax treatment
+type TaxSummary struct {
+	Income     float64            `json:"income"`
+	Expenses   float64            `json:"expenses"`
+	Categories []TaxCategoryTotal `json:"categories"`
+}
+
+// TaxTransaction is a tax-relevant transaction. Amount is in the account's
+// currency and ConvertedAmount in the report's.
+type TaxTransaction struct {
+	ID              int64               `json:"id"`
+	Date            string              `json:"date"`
+	AccountName     string              `json:"account_name"`
+	Type            string              `json:"type"`
+	Category        string              `json:"category"`
+	Description     string              `json:"description"`
+	Treatment       models.TaxTreatment `json:"treatment"`
+	Amount          float64             `json:"amount"`
+	Currency        string              `json:"currency"`
+	ConvertedAmount float64             `json:"converted_amount"`
+}
+
+// TaxReport is a year of tax-relevant transactions in the preferred
+// currency, oldest first
+type TaxReport struct {
+	Year         int              `json:"year"`
+	Currency     string           `json:"currency"`
+	Deductible   TaxSummary       `json:"deductible"`
+	Business     TaxSummary       `json:"business"`
+	Transactions []TaxTransaction `json:"transactions"`
+}
+
+// ListTaxCategories returns the user's tax-relevant categories
+func (h *ReportHandler) ListTaxCategories(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT category, treatment, updated_at FROM tax_categories
+		WHERE user_id = ?
+		ORDER BY category
+	`, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch tax categories", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	categories := []models.TaxCategory{}
+	for rows.Next() {
+		var c models.TaxCategory
+		if err := rows.Scan(&c.Category, &c.Treatment, &c.UpdatedAt); err != nil {
+			continue
+		}
+		categories = append(categories, c)
+	}
+
+	jsonResponse(w, categories, http.StatusOK)
+}
+
+// SetTaxCategory tags the category in the URL with a tax treatment
+func (h *ReportHandler) SetTaxCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	category := models.TransactionCategory(chi.URLParam(r, "category"))
+	if !isValidCategory(category) {
+		jsonError(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+
+	var req models.TaxCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.Treatment.IsValid() {
+		jsonError(w, "Invalid treatment: use deductible or business", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	_, err := h.db.ExecContext(ctx, `
+		INSERT INTO tax_categories (user_id, category, treatment, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, category) DO UPDATE SET
+			treatment = excluded.treatment,
+			updated_at = excluded.updated_at
+	`, userID, string(category), string(req.Treatment), now, now)
+	if err != nil {
+		jsonError(w, "Failed to save tax category", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, models.TaxCategory{Category: category, Treatment: req.Treatment, UpdatedAt: now}, http.StatusOK)
+}
+
+// DeleteTaxCategory removes the tax treatment of the category in the URL.
+// Transactions tagged individually keep their treatment.
+func (h *ReportHandler) DeleteTaxCategory(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM tax_categories WHERE user_id = ? AND category = ?", userID, chi.URLParam(r, "category"))
+	if err != nil {
+		jsonError(w, "Failed to delete tax category", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Tax category not found", http.StatusNotFound)
+		return
+	}
+
+	jsonResponse(w, map[string]string{"message": "Tax category deleted successfully"}, http.StatusOK)
+}
+
+// TaxReport aggregates the tax-relevant transactions of ?year= (default:
+// this year). A transaction's own treatment takes precedence over its
+// category's. With ?format=csv the transactions are returned as a CSV file.
+func (h *ReportHandler) TaxReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	year, err := reviewYear(r.URL.Query().Get("year"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		jsonError(w, "Invalid format: use json or csv", http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, now.Location())
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT t.id, t.created_at, a.name, a.currency, t.type, COALESCE(t.category, 'other'),
+		       COALESCE(t.description, ''), t.amount, COALESCE(t.tax_treatment, tc.treatment), COALESCE(t.is_private, 0)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		LEFT JOIN tax_categories tc ON tc.user_id = a.user_id AND tc.category = COALESCE(t.category, 'other')
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.created_at >= ? AND t.created_at < ?
+		  AND t.type IN ('deposit', 'withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('transfer', 'opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		  AND COALESCE(t.tax_treatment, tc.treatment) IN ('deductible', 'business')
+		ORDER BY t.created_at, t.id
+	`, userID, middleware.GetProfileID(ctx), start.Format("2006-01-02 15:04:05"), start.AddDate(1, 0, 0).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := TaxReport{
+		Year:         year,
+		Currency:     currency,
+		Deductible:   TaxSummary{Categories: []TaxCategoryTotal{}},
+		Business:     TaxSummary{Categories: []TaxCategoryTotal{}},
+		Transactions: []TaxTransaction{},
+	}
+	totals := map[models.TaxTreatment]map[string]*TaxCategoryTotal{
+		models.TaxDeductible: {},
+		models.TaxBusiness:   {},
+	}
+	for rows.Next() {
+		var t TaxTransaction
+		var createdAt time.Time
+		var private bool
+		if err := rows.Scan(&t.ID, &createdAt, &t.AccountName, &t.Currency, &t.Type, &t.Category,
+			&t.Description, &t.Amount, &t.Treatment, &private); err != nil {
+			continue
+		}
+		t.Date = createdAt.Format("2006-01-02")
+		t.Description = services.DecryptField(userID, t.Description)
+		redactReportRow(ctx, private, &t.Description, &t.Category)
+		t.ConvertedAmount = math.Round(h.convert(userID, t.Amount, t.Currency, currency)*100) / 100
+		report.Transactions = append(report.Transactions, t)
+
+		summary := &report.Deductible
+		if t.Treatment == models.TaxBusiness {
+			summary = &report.Business
+		}
+		total, ok := totals[t.Treatment][t.Category]
+		if !ok {
+			total = &TaxCategoryTotal{Category: t.Category}
+			totals[t.Treatment][t.Category] = total
+		}
+		total.Count++
+		if t.Type == string(models.TransactionTypeDeposit) {
+			total.Income += t.ConvertedAmount
+			summary.Income += t.ConvertedAmount
+		} else {
+			total.Expenses += t.ConvertedAmount
+			summary.Expenses += t.ConvertedAmount
+		}
+	}
+
+	for treatment, summary := range map[models.TaxTreatment]*TaxSummary{
+		models.TaxDeductible: &report.Deductible,
+		models.TaxBusiness:   &report.Business,
+	} {
+		for _, total := range totals[treatment] {
+			total.Income = math.Round(total.Income*100) / 100
+			total.Expenses = math.Round(total.Expenses*100) / 100
+			summary.Categories = append(summary.Categories, *total)
+		}
+		sort.Slice(summary.Categories, func(i, j int) bool {
+			a, b := summary.Categories[i], summary.Categories[j]
+			if a.Expenses+a.Income != b.Expenses+b.Income {
+				return a.Expenses+a.Income > b.Expenses+b.Income
+			}
+			return a.Category < b.Category
+		})
+		summary.Income = math.Round(summary.Income*100) / 100
+		summary.Expenses = math.Round(summary.Expenses*100) / 100
+	}
+
+	if format == "csv" {
+		writeTaxCSV(w, &report)
+		return
+	}
+	jsonResponse(w, report, http.StatusOK)
+}
+
+// writeTaxCSV writes a tax report's transactions as a CSV file, one row per
+// transaction
+func writeTaxCSV(w http.ResponseWriter, report *TaxReport) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="odin-wallet-tax-%d.csv"`, report.Year))
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "treatment", "category", "type", "description", "account", "amount", "currency", "amount_" + report.Currency})
+	for _, t := range report.Transactions {
+		out.Write([]string{
+			t.Date,
+			string(t.Treatment),
+			t.Category,
+			t.Type,
+			csvText(t.Description),
+			csvText(t.AccountName),
+			strconv.FormatFloat(t.Amount, 'f', 2, 64),
+			t.Currency,
+			strconv.FormatFloat(t.ConvertedAmount, 'f', 2, 64),
+		})
+	}
+	out.Flush()
+}
+
+// csvText keeps user-entered text from being read as a formula when the CSV
+// is opened in a spreadsheet
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// telegramMessageTimeout bounds the work done for a single bot message
+const telegramMessageTimeout = 30 * time.Second
+
+const telegramHelp = `Commands:
+spent 12.50 groceries [description] - record spending
+balance - show your account balances
+/account NAME - choose the account spending is recorded on
+/unlink - disconnect this chat`
+
+// TelegramHandler links Telegram chats to users and runs the quick entry bot
+type TelegramHandler struct {
+	db           *sql.DB
+	bot          *services.TelegramClient // nil disables the bot
+	transactions *TransactionHandler
+	features     *services.FeatureFlags
+}
+
+func NewTelegramHandler(db *sql.DB, bot *services.TelegramClient, transactions *TransactionHandler, features *services.FeatureFlags) *TelegramHandler {
+	return &TelegramHandler{db: db, bot: bot, transactions: transactions, features: features}
+}
+
+// Status reports whether the bot is available and which chat is linked
+func (h *TelegramHandler) Status(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	status := models.TelegramStatus{Enabled: h.bot != nil}
+	link, err := h.linkByUser(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch Telegram link", http.StatusInternalServerError)
+		return
+	}
+	status.Link = link
+
+	jsonResponse(w, status, http.StatusOK)
+}
+
+// CreateLinkCode issues a one-time code that links the chat it's sent from.
+// Earlier unused codes stop working.
+func (h *TelegramHandler) CreateLinkCode(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+	if h.bot == nil {
+		jsonError(w, "Telegram bot is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	bytes := make([]byte, 5)
+	if _, err := rand.Read(bytes); err != nil {
+		jsonError(w, "Failed to create link code", http.StatusInternalServerError)
+		return
+	}
+	code := base32.StdEncoding.EncodeToString(bytes)
+
+	now := time.Now()
+	expiresAt := now.Add(models.TelegramLinkCodeTTL)
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM telegram_link_codes WHERE user_id = ?", userID); err != nil {
+		jsonError(w, "Failed to create link code", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO telegram_link_codes (code, user_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?)
+	`, code, userID, expiresAt, now); err != nil {
+		jsonError(w, "Failed to create link code", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, models.TelegramLinkCode{
+		Code:      code,
+		Command:   "/link " + code,
+		ExpiresAt: expiresAt,
+	}, http.StatusCreated)
+}
+
+// Update picks the account "spent" messages are recorded on (null to ask
+// the bot to use the only spending account)
+func (h *TelegramHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateTelegramRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.AccountID != nil {
+		var accountType models.AccountType
+		err := h.db.QueryRowContext(ctx, "SELECT type FROM accounts WHERE id = ? AND user_id = ?", *req.AccountID, userID).Scan(&accountType)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
+		if accountType == models.AccountTypeLoan {
+			jsonError(w, "Spending can't be recorded on a loan", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := h.db.ExecContext(ctx, "UPDATE telegram_links SET account_id = ? WHERE user_id = ?", req.AccountID, userID)
+	if err != nil {
+		jsonError(w, "Failed to update Telegram link", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "No Telegram chat is linked", http.StatusNotFound)
+		return
+	}
+
+	link, err := h.linkByUser(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch Telegram link", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, models.TelegramStatus{Enabled: h.bot != nil, Link: link}, http.StatusOK)
+}
+
+// Unlink disconnects the user's Telegram chat
+func (h *TelegramHandler) Unlink(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM telegram_links WHERE user_id = ?", userID)
+	if err != nil {
+		jsonError(w, "Failed to unlink Telegram", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "No Telegram chat is linked", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StartBot polls Telegram for messages and answers them until ctx is
+// cancelled. It does nothing when the bot isn't configured.
+func (h *TelegramHandler) StartBot(ctx context.Context) {
+	if h.bot == nil {
+		return
+	}
+	go func() {
+		var offset int64
+		for {
+			messages, err := h.bot.GetUpdates(ctx, offset)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Telegram polling failed: %v", err)
+				time.Sleep(5 * time.Second)
+				continue
+			}
+			for _, m := range messages {
+				offset = m.UpdateID + 1
+				if m.ChatID == 0 || m.Text == "" {
+					continue
+				}
+				h.reply(ctx, m.ChatID, m.Text)
+			}
+		}
+	}()
+	log.Printf("Telegram bot started")
+}
+
+func (h *TelegramHandler) reply(ctx context.Context, chatID int64, text string) {
+	ctx, cancel := context.WithTimeout(ctx, telegramMessageTimeout)
+	defer cancel()
+
+	answer := h.handleMessage(ctx, chatID, text)
+	if err := h.bot.SendMessage(ctx, chatID, answer); err != nil {
+		log.Printf("Telegram reply to chat %d failed: %v", chatID, err)
+	}
+}
+
+// handleMessage runs a bot command and returns the reply
+func (h *TelegramHandler) handleMessage(ctx context.Context, chatID int64, text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return telegramHelp
+	}
+	// Commands may be addressed to the bot in groups, like /balance@WalletBot
+	command := strings.ToLower(strings.TrimPrefix(strings.SplitN(fields[0], "@", 2)[0], "/"))
+	args := fields[1:]
+
+	// /start carries the code when the chat is opened from a deep link
+	if (command == "link" || command == "start") && len(args) == 1 {
+		return h.linkChat(ctx, chatID, args[0])
+	}
+
+	var userID int64
+	var accountID sql.NullInt64
+	err := h.db.QueryRowContext(ctx, "SELECT user_id, account_id FROM telegram_links WHERE chat_id = ?", chatID).Scan(&userID, &accountID)
+	if err == sql.ErrNoRows {
+		return "This chat isn't linked to a wallet yet. Create a link code in the app and send it here as /link CODE."
+	}
+	if err != nil {
+		log.Printf("Telegram link lookup for chat %d failed: %v", chatID, err)
+		return "Something went wrong, please try again."
+	}
+	if !h.features.Enabled(ctx, userID, models.FeatureTelegram) {
+		return "Telegram quick entry is turned off for your wallet."
+	}
+
+	switch command {
+	case "spent", "spend":
+		return h.recordSpending(ctx, userID, accountID, args)
+	case "balance", "balances":
+		return h.balances(ctx, userID)
+	case "account":
+		return h.chooseAccount(ctx, userID, strings.Join(args, " "))
+	case "unlink":
+		if _, err := h.db.ExecContext(ctx, "DELETE FROM telegram_links WHERE chat_id = ?", chatID); err != nil {
+			return "Something went wrong, please try again."
+		}
+		return "This chat is no longer linked to your wallet."
+	default:
+		return telegramHelp
+	}
+}
+
+func (h *TelegramHandler) linkChat(ctx context.Context, chatID int64, code string) string {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "Something went wrong, please try again."
+	}
+	defer tx.Rollback()
+
+	var userID int64
+	var expiresAt time.Time
+	err = tx.QueryRowContext(ctx, "SELECT user_id, expires_at FROM telegram_link_codes WHERE code = ?", strings.ToUpper(code)).Scan(&userID, &expiresAt)
+	if err == sql.ErrNoRows || (err == nil && time.Now().After(expiresAt)) {
+		return "That link code is invalid or expired. Create a new one in the app."
+	}
+	if err != nil {
+		return "Something went wrong, please try again."
+	}
+
+	// Codes are single use, and a chat belongs to one user at a time
+	if _, err := tx.ExecContext(ctx, "DELETE FROM telegram_link_codes WHERE user_id = ?", userID); err != nil {
+		return "Something went wrong, please try again."
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM telegram_links WHERE chat_id = ? OR user_id = ?", chatID, userID); err != nil {
+		return "Something went wrong, please try again."
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO telegram_links (user_id, chat_id, created_at)
+		VALUES (?, ?, ?)
+	`, userID, chatID, time.Now()); err != nil {
+		return "Something went wrong, please try again."
+	}
+	if err := tx.Commit(); err != nil {
+		return "Something went wrong, please try again."
+	}
+
+	return "Linked! Send \"spent 12.50 groceries\" to record spending or \"balance\" to see your accounts.\n\n" + telegramHelp
+}
+
+// recordSpending parses "12.50 groceries coffee with Ana": an amount, an
+// optional category and a description
+func (h *TelegramHandler) recordSpending(ctx context.Context, userID int64, accountID sql.NullInt64, args []string) string {
+	if len(args) == 0 {
+		return "Send the amount, like \"spent 12.50 groceries\"."
+	}
+	amount, ok := parseChatAmount(args[0])
+	if !ok {
+		return fmt.Sprintf("%q isn't an amount. Send something like \"spent 12.50 groceries\".", args[0])
+	}
+
+	req := models.CreateTransactionRequest{Amount: amount, Category: models.CategoryOther}
+	rest := args[1:]
+	if len(rest) > 0 {
+		category := models.TransactionCategory(strings.ToLower(rest[0]))
+		if isValidCategory(category) && category != models.CategoryTransfer {
+			req.Category = category
+			rest = rest[1:]
+		}
+	}
+	req.Description = strings.Join(rest, " ")
+
+	account, reply := h.spendingAccount(ctx, userID, accountID)
+	if account == nil {
+		return reply
+	}
+	if account.Type == models.AccountTypeCreditCard {
+		req.Type = models.TransactionTypeExpense
+	} else {
+		req.Type = models.TransactionTypeWithdrawal
+	}
+
+	// Record it exactly like the API does, with the same locking, alerts
+	// and budget checks
+	rec := httptest.NewRecorder()
+	h.transactions.create(ctx, rec, userID, account.ID, req)
+	if rec.Code != http.StatusCreated {
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return "Couldn't record that: " + body.Error
+	}
+
+	var transaction models.Transaction
+	if err := json.Unmarshal(rec.Body.Bytes(), &transaction); err != nil {
+		return "Recorded."
+	}
+	locale := services.UserLocale(ctx, h.db, userID)
+	return fmt.Sprintf("Recorded %s (%s) on %s. Balance: %s",
+		services.FormatMoney(amount, account.Currency, locale),
+		req.Category,
+		account.Name,
+		services.FormatMoney(transaction.BalanceAfter, account.Currency, locale))
+}
+
+// spendingAccount returns the chat's chosen account, or the user's only
+// account that accepts spending. Without one it returns the reply to send.
+func (h *TelegramHandler) spendingAccount(ctx context.Context, userID int64, accountID sql.NullInt64) (*models.Account, string) {
+	accounts, err := h.accounts(ctx, userID)
+	if err != nil {
+		return nil, "Something went wrong, please try again."
+	}
+
+	var candidates []*models.Account
+	for _, a := range accounts {
+		if accountID.Valid && a.ID == accountID.Int64 {
+			return a, ""
+		}
+		if a.Type != models.AccountTypeLoan {
+			candidates = append(candidates, a)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], ""
+	}
+	if len(candidates) == 0 {
+		return nil, "You don't have an account to record spending on yet."
+	}
+
+	names := make([]string, len(candidates))
+	for i, a := range candidates {
+		names[i] = a.Name
+	}
+	return nil, "Choose the account to record spending on with /account NAME. Your accounts: " + strings.Join(names, ", ")
+}
+
+func (h *TelegramHandler) chooseAccount(ctx context.Context, userID int64, name string) string {
+	if name == "" {
+		return "Send /account followed by the account's name."
+	}
+	accounts, err := h.accounts(ctx, userID)
+	if err != nil {
+		return "Something went wrong, please try again."
+	}
+	for _, a := range accounts {
+		if !strings.EqualFold(a.Name, name) {
+			continue
+		}
+		if a.Type == models.AccountTypeLoan {
+			return "Spending can't be recorded on a loan."
+		}
+		if _, err := h.db.ExecContext(ctx, "UPDATE telegram_links SET account_id = ? WHERE user_id = ?", a.ID, userID); err != nil {
+			return "Something went wrong, please try again."
+		}
+		return fmt.Sprintf("Spending will be recorded on %s.", a.Name)
+	}
+	return fmt.Sprintf("No account is named %q.", name)
+}
+
+func (h *TelegramHandler) balances(ctx context.Context, userID int64) string {
+	accounts, err := h.accounts(ctx, userID)
+	if err != nil {
+		return "Something went wrong, please try again."
+	}
+	if len(accounts) == 0 {
+		return "You don't have any accounts yet."
+	}
+
+	locale := services.UserLocale(ctx, h.db, userID)
+	lines := make([]string, len(accounts))
+	for i, a := range accounts {
+		lines[i] = a.Name + ": " + services.FormatMoney(a.GetDisplayBalance(), a.Currency, locale)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (h *TelegramHandler) accounts(ctx context.Context, userID int64) ([]*models.Account, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+accountColumns+`
+		FROM accounts
+		WHERE user_id = ?
+		ORDER BY name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (h *TelegramHandler) linkByUser(ctx context.Context, userID int64) (*models.TelegramLink, error) {
+	var link models.TelegramLink
+	var accountID sql.NullInt64
+	err := h.db.QueryRowContext(ctx, `
+		SELECT chat_id, account_id, created_at FROM telegram_links WHERE user_id = ?
+	`, userID).Scan(&link.ChatID, &accountID, &link.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if accountID.Valid {
+		link.AccountID = &accountID.Int64
+	}
+	return &link, nil
+}
+
+// parseChatAmount reads amounts typed in a chat, accepting a decimal comma
+// ("12,50") as well as thousands separators ("1,250.00")
+func parseChatAmount(s string) (float64, bool) {
+	s = strings.TrimLeft(s, "$")
+	if strings.Contains(s, ",") && !strings.Contains(s, ".") && len(s)-strings.LastIndex(s, ",") <= 3 {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || amount <= 0 || math.IsInf(amount, 0) || math.IsNaN(amount) {
+		return 0, false
+	}
+	return amount, true
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// maxTokenFamilies is how many devices a user can stay signed in on with
+// refresh tokens; signing in on another revokes the least recently used
+const maxTokenFamilies = 10
+
+// Token issues an access and refresh token pair for clients that can't use
+// the session cookie, such as mobile apps. The password grant signs in and
+// starts a new token family; the refresh_token grant rotates a refresh token,
+// which can only be used once. Presenting a rotated token again revokes its
+// whole family, since it means the token was copied.
+func (h *AuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req models.TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch req.GrantType {
+	case models.GrantPassword:
+		user, ok := h.checkCredentials(w, r, req.Email, req.Password)
+		if !ok {
+			return
+		}
+		familyID, err := randomToken(16)
+		if err != nil {
+			jsonError(w, "Failed to create token", http.StatusInternalServerError)
+			return
+		}
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		resp, err := h.issueTokens(ctx, tx, user.ID, familyID)
+		if err != nil {
+			jsonError(w, "Failed to create token", http.StatusInternalServerError)
+			return
+		}
+		// Keep the most recently used families
+		_, err = tx.ExecContext(ctx, `
+			UPDATE refresh_tokens SET revoked_at = ?
+			WHERE user_id = ? AND revoked_at IS NULL AND family_id NOT IN (
+				SELECT family_id FROM refresh_tokens WHERE user_id = ?
+				GROUP BY family_id ORDER BY MAX(created_at) DESC, MAX(id) DESC LIMIT ?
+			)
+		`, time.Now(), user.ID, user.ID, maxTokenFamilies)
+		if err != nil {
+			jsonError(w, "Failed to create token", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+
+		h.audit.Record(ctx, models.AuditEvent{
+			UserID:    user.ID,
+			Type:      models.ActivityLogin,
+			Action:    "logged_in",
+			Summary:   "Logged in with a token",
+			IPAddress: services.ClientIP(r),
+		})
+		resp.User = user
+		jsonResponse(w, resp, http.StatusOK)
+
+	case models.GrantRefreshToken:
+		if req.RefreshToken == "" {
+			jsonError(w, "Refresh token is required", http.StatusBadRequest)
+			return
+		}
+		h.refresh(w, r, req.RefreshToken)
+
+	default:
+		jsonError(w, "Invalid grant_type. Use password or refresh_token", http.StatusBadRequest)
+	}
+}
+
+// refresh rotates a refresh token, replacing it with a new pair in the same
+// family
+func (h *AuthHandler) refresh(w http.ResponseWriter, r *http.Request, token string) {
+	ctx := r.Context()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var id, userID int64
+	var familyID string
+	var expiresAt time.Time
+	var rotatedAt, revokedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, expires_at, rotated_at, revoked_at FROM refresh_tokens WHERE token_hash = ?
+	`, hashInviteToken(token)).Scan(&id, &userID, &familyID, &expiresAt, &rotatedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to validate refresh token", http.StatusInternalServerError)
+		return
+	}
+	if revokedAt.Valid {
+		jsonError(w, "Refresh token revoked", http.StatusUnauthorized)
+		return
+	}
+	if time.Now().After(expiresAt) {
+		jsonError(w, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	// Claim the token; losing the claim to another request counts as reuse
+	rotated := false
+	if !rotatedAt.Valid {
+		res, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET rotated_at = ? WHERE id = ? AND rotated_at IS NULL", time.Now(), id)
+		if err != nil {
+			jsonError(w, "Failed to rotate refresh token", http.StatusInternalServerError)
+			return
+		}
+		n, _ := res.RowsAffected()
+		rotated = n == 1
+	}
+	if !rotated {
+		if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", time.Now(), familyID); err != nil {
+			jsonError(w, "Failed to revoke refresh token", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		h.audit.Record(ctx, models.AuditEvent{
+			UserID:    userID,
+			Type:      models.ActivityLogin,
+			Action:    "token_reused",
+			Summary:   "A used refresh token was presented again; the device was signed out",
+			IPAddress: services.ClientIP(r),
+		})
+		jsonError(w, "Refresh token already used", http.StatusUnauthorized)
+		return
+	}
+
+	resp, err := h.issueTokens(ctx, tx, userID, familyID)
+	if err != nil {
+		jsonError(w, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, resp, http.StatusOK)
+}
+
+// RevokeToken signs out the device a refresh token was issued to, ending
+// its access tokens too. Unknown tokens are ignored so the response doesn't
+// reveal which tokens exist.
+func (h *AuthHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req models.RevokeTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		jsonError(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	var userID int64
+	var familyID string
+	err := h.db.QueryRowContext(ctx, "SELECT user_id, family_id FROM refresh_tokens WHERE token_hash = ?", hashInviteToken(req.RefreshToken)).Scan(&userID, &familyID)
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		res, err := h.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", time.Now(), familyID)
+		if err != nil {
+			jsonError(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			h.audit.Record(ctx, models.AuditEvent{
+				UserID:    userID,
+				Type:      models.ActivityLogin,
+				Action:    "logged_out",
+				Summary:   "Logged out",
+				IPAddress: services.ClientIP(r),
+			})
+		}
+	}
+
+	jsonResponse(w, map[string]string{"message": "Token revoked"}, http.StatusOK)
+}
+
+// issueTokens stores a new refresh token in a family and signs an access
+// token to go with it
+func (h *AuthHandler) issueTokens(ctx context.Context, tx *sql.Tx, userID int64, familyID string) (*models.TokenResponse, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)
+	`, userID, familyID, hashInviteToken(refreshToken), now.Add(models.RefreshTokenTTL), now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:      middleware.NewAccessToken(h.sessionSecret, userID, familyID, now.Add(models.AccessTokenTTL)),
+		TokenType:        "Bearer",
+		ExpiresIn:        int(models.AccessTokenTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int(models.RefreshTokenTTL.Seconds()),
+	}, nil
+}
+
+// randomToken returns n random bytes, hex encoded
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
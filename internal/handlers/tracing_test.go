@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/testutil"
+	"github.com/kengru/odin-wallet/pkg/tracing"
+)
+
+// exportedSpan is the part of an OTLP/JSON span the test looks at
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Attributes   []struct {
+		Key   string `json:"key"`
+		Value struct {
+			StringValue string `json:"stringValue"`
+			IntValue    string `json:"intValue"`
+		} `json:"value"`
+	} `json:"attributes"`
+}
+
+func (s exportedSpan) attr(key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value.StringValue + a.Value.IntValue
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	var mu sync.Mutex
+	var spans []exportedSpan
+	var service, auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []struct {
+						Key   string `json:"key"`
+						Value struct {
+							StringValue string `json:"stringValue"`
+						} `json:"value"`
+					} `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if r.URL.Path != "/v1/traces" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "bad export", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		auth = r.Header.Get("Authorization")
+		for _, rs := range req.ResourceSpans {
+			service = rs.Resource.Attributes[0].Value.StringValue
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": collector.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "Authorization=Bearer%20secret",
+		"OTEL_SERVICE_NAME":           "wallet-test",
+	}
+	tracer, err := tracing.FromEnv(func(key string) string { return env[key] })
+	if err != nil || tracer == nil {
+		t.Fatalf("FromEnv = %v, %v", tracer, err)
+	}
+	cfg := testutil.DefaultConfig()
+	cfg.Tracer = tracer
+	app := testutil.NewAppWithConfig(t, cfg)
+	fx := app.Seed(t, "ana@example.com")
+
+	fx.Client.Get("/api/reports/categories/groceries/trend").Expect(http.StatusOK)
+
+	// A caller's trace is continued
+	req, _ := http.NewRequest(http.MethodGet, app.URL+"/api/accounts", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// Outgoing calls pass the trace on
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+	ctx, job := tracer.Start(context.Background(), "job exchange_rates", tracing.SpanKindInternal)
+	outReq, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/v6/latest/USD?key=secret", nil)
+	outResp, err := (&http.Client{Transport: tracing.Transport(nil)}).Do(outReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outResp.Body.Close()
+	job.End()
+	if !strings.HasPrefix(received, "00-"+job.TraceID()+"-") {
+		t.Errorf("upstream traceparent = %q, want the job's trace %s", received, job.TraceID())
+	}
+
+	if err := app.Server.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if service != "wallet-test" || auth != "Bearer secret" {
+		t.Errorf("service %q with authorization %q, want wallet-test and the configured header", service, auth)
+	}
+
+	var trend, accounts *exportedSpan
+	for i, s := range spans {
+		switch s.Name {
+		case "GET /api/reports/categories/{category}/trend":
+			trend = &spans[i]
+		case "GET /api/accounts":
+			accounts = &spans[i]
+		}
+	}
+	if trend == nil || trend.Kind != int(tracing.SpanKindServer) || trend.attr("http.response.status_code") != "200" {
+		t.Fatalf("report request span = %+v, want a server span named after the route", trend)
+	}
+	queries := 0
+	for _, s := range spans {
+		if s.ParentSpanID == trend.SpanID && s.TraceID == trend.TraceID && s.attr("db.system") == "sqlite" {
+			queries++
+		}
+	}
+	if queries == 0 {
+		t.Error("no database spans under the report request")
+	}
+
+	if accounts == nil || accounts.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || accounts.ParentSpanID != "00f067aa0ba902b7" ||
+		accounts.attr("http.response.status_code") != "401" {
+		t.Errorf("accounts span = %+v, want it in the caller's trace", accounts)
+	}
+
+	var client *exportedSpan
+	for i, s := range spans {
+		if s.Kind == int(tracing.SpanKindClient) && s.TraceID == job.TraceID() && s.ParentSpanID == job.SpanID() {
+			client = &spans[i]
+		}
+	}
+	if client == nil || strings.Contains(client.attr("url.full"), "secret") || client.attr("http.response.status_code") != "200" {
+		t.Errorf("outgoing request span = %+v, want it under the job without the query", client)
+	}
+
+	env["OTEL_TRACES_SAMPLER_ARG"] = "2"
+	if _, err := tracing.FromEnv(func(key string) string { return env[key] }); err == nil {
+		t.Error("sample ratio above 1 accepted")
+	}
+}
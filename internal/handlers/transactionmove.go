@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// afterMoved matches the transactions of an account that come after the
+// moved one, in the created_at, id order balances are chained in
+const afterMoved = "(created_at, id) > (SELECT created_at, id FROM transactions WHERE id = ?)"
+
+// Move reassigns a transaction recorded in the wrong account to another of
+// the user's accounts. Both balances and the balance_after of every later
+// transaction in both accounts are replayed, so the two ledgers read as if
+// it had been recorded in the right account. Its transfer, reimbursement,
+// attachment and bill links are kept.
+func (h *TransactionHandler) Move(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	transactionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		jsonError(w, "Invalid transaction ID", http.StatusBadRequest)
+		return
+	}
+	toAccountID, err := strconv.ParseInt(r.URL.Query().Get("to_account"), 10, 64)
+	if err != nil {
+		jsonError(w, "to_account must be an account ID", http.StatusBadRequest)
+		return
+	}
+
+	if ok, err := transactionInProfile(ctx, h.db, transactionID, userID); err != nil || !ok {
+		jsonError(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	if !checkTransactionsOpen(ctx, w, h.db, userID, transactionID) {
+		return
+	}
+
+	var fromAccountID int64
+	var txType models.TransactionType
+	var amount float64
+	var linkedID sql.NullInt64
+	err = h.db.QueryRowContext(ctx, "SELECT account_id, type, amount, linked_transaction_id FROM transactions WHERE id = ?", transactionID).
+		Scan(&fromAccountID, &txType, &amount, &linkedID)
+	if err != nil {
+		jsonError(w, "Failed to fetch transaction", http.StatusInternalServerError)
+		return
+	}
+	if toAccountID == fromAccountID {
+		jsonError(w, "Transaction is already in this account", http.StatusBadRequest)
+		return
+	}
+
+	// Hold both accounts until their balances are rewritten
+	unlock := h.locker.Lock(fromAccountID, toAccountID)
+	defer unlock()
+
+	// The account was checked with the transaction's profile; the target
+	// only has to be the user's
+	from, err := moveAccount(ctx, h.db, fromAccountID, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+	to, err := moveAccount(ctx, h.db, toAccountID, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+		return
+	}
+
+	if msg, err := h.moveBlocked(ctx, transactionID, txType, linkedID, from, to); err != nil {
+		jsonError(w, "Failed to check the transaction's links", http.StatusInternalServerError)
+		return
+	} else if msg != "" {
+		jsonError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	effect := models.BalanceEffect(txType, amount)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if from, err = moveAccount(ctx, h.db, fromAccountID, userID); err == nil {
+				to, err = moveAccount(ctx, h.db, toAccountID, userID)
+			}
+			if err != nil {
+				jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		err := moveTransaction(ctx, h.db, transactionID, effect, from, to)
+		if err == errBalanceConflict {
+			if attempt < maxBalanceAttempts {
+				continue
+			}
+			balanceConflict(w)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to move transaction", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	checkBalanceAlerts(ctx, h.alerts, fromAccountID, toAccountID)
+
+	// Spending moved into another profile counts against its budgets
+	if isSpending(txType) && to.ProfileID != from.ProfileID {
+		if err := h.budgets.EnforceFreezes(middleware.WithProfileID(ctx, to.ProfileID), userID); err != nil {
+			log.Printf("Budget freeze check failed for user %d: %v", userID, err)
+		}
+	}
+
+	transaction, err := scanTransaction(h.db.QueryRowContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ?
+	`, transactionID))
+	if err != nil {
+		jsonError(w, "Transaction moved but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "moved",
+		EntityID: &transactionID,
+		Summary:  fmt.Sprintf("Moved a %s of %.2f from %s to %s", txType, amount, from.Name, to.Name),
+		Details:  map[string]interface{}{"from_account_id": from.ID, "to_account_id": to.ID},
+	})
+
+	jsonResponse(w, transaction, http.StatusOK)
+}
+
+// moveAccount reads what moving a transaction needs of one of the user's
+// accounts
+func moveAccount(ctx context.Context, db *sql.DB, accountID, userID int64) (*models.Account, error) {
+	var a models.AccountDB
+	err := db.QueryRowContext(ctx, `
+		SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed, status, frozen_until, version, profile_id
+		FROM accounts
+		WHERE id = ? AND user_id = ?
+	`, accountID, userID).Scan(&a.ID, &a.Name, &a.Type, &a.Currency, &a.CurrentBalance, &a.CreditOwed, &a.LoanCurrentOwed,
+		&a.Status, &a.FrozenUntil, &a.Version, &a.ProfileID)
+	if err != nil {
+		return nil, err
+	}
+	return a.ToAccount(), nil
+}
+
+// moveBlocked returns why the transaction can't go to the account, or ""
+// when it can
+func (h *TransactionHandler) moveBlocked(ctx context.Context, transactionID int64, txType models.TransactionType, linkedID sql.NullInt64, from, to *models.Account) (string, error) {
+	if !models.IsValidTransactionType(txType, to.Type) {
+		return fmt.Sprintf("A %s can't be recorded in a %s account", txType, to.Type), nil
+	}
+	if to.Currency != from.Currency {
+		return fmt.Sprintf("The accounts are in different currencies (%s and %s)", from.Currency, to.Currency), nil
+	}
+	if isSpending(txType) && to.IsFrozen() {
+		return "Account is frozen", nil
+	}
+
+	// A transfer stays between two different accounts
+	if linkedID.Valid {
+		var linkedAccountID int64
+		err := h.db.QueryRowContext(ctx, "SELECT account_id FROM transactions WHERE id = ?", linkedID.Int64).Scan(&linkedAccountID)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+		if err == nil && linkedAccountID == to.ID {
+			return "The other side of this transfer is already in that account", nil
+		}
+	}
+
+	// Envelopes it funds would be left holding money their account lost
+	var allocations int
+	if err := h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM envelope_allocations WHERE transaction_id = ?", transactionID).Scan(&allocations); err != nil {
+		return "", err
+	}
+	if allocations > 0 {
+		return "The transaction funds envelopes in its account; remove those allocations first", nil
+	}
+	return "", nil
+}
+
+// moveTransaction moves the transaction from one account to the other and
+// replays both balances. It fails with errBalanceConflict when either
+// account changed since it was read.
+func moveTransaction(ctx context.Context, db *sql.DB, transactionID int64, effect float64, from, to *models.Account) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// What the target account held just before the transaction: the balance
+	// after its previous transaction, or else before its next one, or else
+	// its current balance
+	var before float64
+	err = tx.QueryRowContext(ctx, `
+		SELECT balance_after FROM transactions
+		WHERE account_id = ? AND NOT `+afterMoved+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, to.ID, transactionID).Scan(&before)
+	if err == sql.ErrNoRows {
+		var nextType models.TransactionType
+		var nextAmount, nextBalance float64
+		err = tx.QueryRowContext(ctx, `
+			SELECT type, amount, balance_after FROM transactions
+			WHERE account_id = ? AND `+afterMoved+`
+			ORDER BY created_at, id
+			LIMIT 1
+		`, to.ID, transactionID).Scan(&nextType, &nextAmount, &nextBalance)
+		switch err {
+		case nil:
+			before = nextBalance - models.BalanceEffect(nextType, nextAmount)
+		case sql.ErrNoRows:
+			before, err = to.GetDisplayBalance(), nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE transactions SET balance_after = balance_after - ? WHERE account_id = ? AND "+afterMoved,
+		effect, from.ID, transactionID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE transactions SET balance_after = balance_after + ? WHERE account_id = ? AND "+afterMoved,
+		effect, to.ID, transactionID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE transactions SET account_id = ?, balance_after = ? WHERE id = ?",
+		to.ID, before+effect, transactionID); err != nil {
+		return err
+	}
+
+	if err := setBalance(ctx, tx, from.ID, from.Type, from.GetDisplayBalance()-effect, from.Version); err != nil {
+		return err
+	}
+	if err := setBalance(ctx, tx, to.ID, to.Type, to.GetDisplayBalance()+effect, to.Version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
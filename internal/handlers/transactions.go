@@ -1,29 +1,52 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/kengru/odin-wallet/internal/middleware"
 	"github.com/kengru/odin-wallet/internal/models"
 	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/database"
+	"github.com/kengru/odin-wallet/pkg/hooks"
 )
 
 type TransactionHandler struct {
 	db              *sql.DB
 	exchangeService *services.ExchangeService
+	locker          *services.AccountLocker
+	budgets         *services.BudgetService
+	alerts          *services.BalanceAlertService
+	audit           *services.AuditService
+	stmts           *database.Statements
+	hooks           *hooks.Registry
 }
 
-func NewTransactionHandler(db *sql.DB, exchangeService *services.ExchangeService) *TransactionHandler {
-	return &TransactionHandler{db: db, exchangeService: exchangeService}
+func NewTransactionHandler(db *sql.DB, stmts *database.Statements, exchangeService *services.ExchangeService, locker *services.AccountLocker, budgetService *services.BudgetService, alertService *services.BalanceAlertService, audit *services.AuditService, hookRegistry *hooks.Registry) *TransactionHandler {
+	// Inserts run inside a transaction, where statements can't be prepared
+	// on demand
+	stmts.Warm(insertTransactionQuery)
+	return &TransactionHandler{db: db, exchangeService: exchangeService, locker: locker, budgets: budgetService, alerts: alertService, audit: audit, stmts: stmts, hooks: hookRegistry}
 }
 
+// insertTransactionQuery records a transaction created through the API
+const insertTransactionQuery = `
+			INSERT INTO transactions (account_id, type, amount, description, category, balance_after, is_private, latitude, longitude, place_name, reimbursement_status, tax_treatment, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
 func (h *TransactionHandler) Create(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -35,140 +58,218 @@ func (h *TransactionHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get account and verify ownership
-	var accountType string
-	var currentBalance float64
-	var creditOwed, loanCurrentOwed sql.NullFloat64
-	err = h.db.QueryRow(`
-		SELECT type, current_balance, credit_owed, loan_current_owed
-		FROM accounts
-		WHERE id = ? AND user_id = ?
-	`, accountID, userID).Scan(&accountType, &currentBalance, &creditOwed, &loanCurrentOwed)
-
-	if err == sql.ErrNoRows {
-		jsonError(w, "Account not found", http.StatusNotFound)
-		return
-	}
-	if err != nil {
-		jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
-		return
-	}
-
 	var req models.CreateTransactionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Validate transaction type for account type
-	if !models.IsValidTransactionType(req.Type, models.AccountType(accountType)) {
-		jsonError(w, "Invalid transaction type for this account", http.StatusBadRequest)
+	if ok, err := accountInProfile(ctx, h.db, accountID, userID); err != nil || !ok {
+		jsonError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
+	h.create(ctx, w, userID, accountID, req)
+}
+
+// create records a transaction on one of the user's accounts and writes the
+// created transaction as the response
+func (h *TransactionHandler) create(ctx context.Context, w http.ResponseWriter, userID, accountID int64, req models.CreateTransactionRequest) {
 	// Validate amount
 	if req.Amount <= 0 {
 		jsonError(w, "Amount must be positive", http.StatusBadRequest)
 		return
 	}
 
+	if !checkPeriodOpen(ctx, w, h.db, userID, time.Now()) {
+		return
+	}
+
 	// Set default category if empty
 	if req.Category == "" {
 		req.Category = models.CategoryOther
 	}
+	if req.Location != nil {
+		if err := req.Location.Validate(); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	latitude, longitude, placeName := locationValues(userID, req.Location)
+	var reimbursement interface{}
+	if req.Reimbursable {
+		if !isSpending(req.Type) {
+			jsonError(w, "Only withdrawals and expenses can be reimbursable", http.StatusBadRequest)
+			return
+		}
+		reimbursement = string(models.ReimbursementPending)
+	}
+	var taxTreatment interface{}
+	if req.TaxTreatment != "" {
+		if !req.TaxTreatment.IsValidForTransaction() {
+			jsonError(w, "Invalid tax_treatment: use deductible, business or none", http.StatusBadRequest)
+			return
+		}
+		taxTreatment = string(req.TaxTreatment)
+	}
 
-	// Calculate new balance and update account
-	var balanceAfter float64
-	var updateQuery string
-	var updateValue float64
+	// Hold the account lock until the new balance is written
+	unlock := h.locker.Lock(accountID)
+	defer unlock()
+
+	var transactionID, profileID int64
+	var currency string
+	for attempt := 1; ; attempt++ {
+		// Get account and verify ownership
+		var accountType models.AccountType
+		var currentBalance float64
+		var creditOwed, loanCurrentOwed sql.NullFloat64
+		var status sql.NullString
+		var frozenUntil sql.NullTime
+		var version int64
+		err := h.db.QueryRowContext(ctx, `
+			SELECT type, currency, current_balance, credit_owed, loan_current_owed, status, frozen_until, version, profile_id
+			FROM accounts
+			WHERE id = ? AND user_id = ?
+		`, accountID, userID).Scan(&accountType, &currency, &currentBalance, &creditOwed, &loanCurrentOwed, &status, &frozenUntil, &version, &profileID)
+
+		if err == sql.ErrNoRows {
+			jsonError(w, "Account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch account", http.StatusInternalServerError)
+			return
+		}
 
-	switch models.AccountType(accountType) {
-	case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
-		if req.Type == models.TransactionTypeDeposit {
-			balanceAfter = currentBalance + req.Amount
-		} else { // withdrawal
-			balanceAfter = currentBalance - req.Amount
+		// Validate transaction type for account type
+		if !models.IsValidTransactionType(req.Type, accountType) {
+			jsonError(w, "Invalid transaction type for this account", http.StatusBadRequest)
+			return
 		}
-		updateQuery = "UPDATE accounts SET current_balance = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
-		updateValue = balanceAfter
 
-	case models.AccountTypeCreditCard:
-		owed := float64(0)
-		if creditOwed.Valid {
-			owed = creditOwed.Float64
+		// Frozen accounts only accept money coming in
+		if isSpending(req.Type) && models.FreezeActive(status, frozenUntil) {
+			jsonError(w, "Account is frozen", http.StatusForbidden)
+			return
 		}
-		if req.Type == models.TransactionTypeExpense {
-			balanceAfter = owed + req.Amount
-		} else { // payment
-			balanceAfter = owed - req.Amount
+
+		// Calculate new balance
+		var balanceAfter float64
+		switch accountType {
+		case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
+			if req.Type == models.TransactionTypeDeposit {
+				balanceAfter = currentBalance + req.Amount
+			} else { // withdrawal
+				balanceAfter = currentBalance - req.Amount
+			}
+
+		case models.AccountTypeCreditCard:
+			if req.Type == models.TransactionTypeExpense {
+				balanceAfter = creditOwed.Float64 + req.Amount
+			} else { // payment
+				balanceAfter = creditOwed.Float64 - req.Amount
+			}
+
+		case models.AccountTypeLoan:
+			// Loan only supports payment type
+			balanceAfter = loanCurrentOwed.Float64 - req.Amount
 		}
-		updateQuery = "UPDATE accounts SET credit_owed = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
-		updateValue = balanceAfter
 
-	case models.AccountTypeLoan:
-		owed := float64(0)
-		if loanCurrentOwed.Valid {
-			owed = loanCurrentOwed.Float64
+		// Use transaction for atomicity
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Update account balance, unless another write got there first
+		err = setBalance(ctx, tx, accountID, accountType, balanceAfter, version)
+		if err == errBalanceConflict {
+			tx.Rollback()
+			if attempt < maxBalanceAttempts {
+				continue
+			}
+			balanceConflict(w)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to update account balance", http.StatusInternalServerError)
+			return
 		}
-		// Loan only supports payment type
-		balanceAfter = owed - req.Amount
-		updateQuery = "UPDATE accounts SET loan_current_owed = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
-		updateValue = balanceAfter
-	}
 
-	// Use transaction for atomicity
-	tx, err := h.db.Begin()
-	if err != nil {
-		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
-		return
-	}
-	defer tx.Rollback()
+		// Insert transaction
+		result, err := h.stmts.TxExecContext(ctx, tx, insertTransactionQuery, accountID, string(req.Type), req.Amount, services.EncryptField(userID, req.Description), string(req.Category), balanceAfter, req.IsPrivate,
+			latitude, longitude, placeName, reimbursement, taxTreatment, time.Now())
+		if err != nil {
+			jsonError(w, "Failed to create transaction", http.StatusInternalServerError)
+			return
+		}
 
-	// Update account balance
-	_, err = tx.Exec(updateQuery, updateValue, accountID)
-	if err != nil {
-		jsonError(w, "Failed to update account balance", http.StatusInternalServerError)
-		return
-	}
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
 
-	// Insert transaction
-	result, err := tx.Exec(`
-		INSERT INTO transactions (account_id, type, amount, description, category, balance_after)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, accountID, string(req.Type), req.Amount, req.Description, string(req.Category), balanceAfter)
-	if err != nil {
-		jsonError(w, "Failed to create transaction", http.StatusInternalServerError)
-		return
+		transactionID, _ = result.LastInsertId()
+		break
 	}
 
-	if err := tx.Commit(); err != nil {
-		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
-		return
-	}
+	checkBalanceAlerts(ctx, h.alerts, accountID)
 
-	transactionID, _ := result.LastInsertId()
+	// Budgets of the account's profile, which sync and bots don't select
+	if isSpending(req.Type) {
+		if err := h.budgets.EnforceFreezes(middleware.WithProfileID(ctx, profileID), userID); err != nil {
+			log.Printf("Budget freeze check failed for user %d: %v", userID, err)
+		}
+	}
 
 	// Fetch and return the created transaction
-	var transaction models.Transaction
-	err = h.db.QueryRow(`
-		SELECT id, account_id, type, amount, description, category, balance_after, created_at
-		FROM transactions
-		WHERE id = ?
-	`, transactionID).Scan(
-		&transaction.ID, &transaction.AccountID, &transaction.Type,
-		&transaction.Amount, &transaction.Description, &transaction.Category,
-		&transaction.BalanceAfter, &transaction.CreatedAt,
-	)
+	transaction, err := scanTransaction(h.db.QueryRowContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ?
+	`, transactionID))
 	if err != nil {
 		jsonError(w, "Transaction created but failed to fetch", http.StatusInternalServerError)
 		return
 	}
 
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "created",
+		EntityID: &transactionID,
+		Summary:  fmt.Sprintf("Recorded a %s of %.2f", req.Type, req.Amount),
+		Details: map[string]interface{}{
+			"account_id": accountID,
+			"amount":     req.Amount,
+			"category":   req.Category,
+		},
+	})
+
+	h.hooks.TransactionCreated(ctx, hooks.Transaction{
+		ID:           transaction.ID,
+		UserID:       userID,
+		AccountID:    accountID,
+		Type:         string(transaction.Type),
+		Amount:       transaction.Amount,
+		Currency:     currency,
+		Description:  transaction.Description,
+		Category:     string(transaction.Category),
+		BalanceAfter: transaction.BalanceAfter,
+		IsPrivate:    transaction.IsPrivate,
+		CreatedAt:    transaction.CreatedAt,
+	})
+
 	jsonResponse(w, transaction, http.StatusCreated)
 }
 
 func (h *TransactionHandler) ListByAccount(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -182,7 +283,7 @@ func (h *TransactionHandler) ListByAccount(w http.ResponseWriter, r *http.Reques
 
 	// Verify account ownership
 	var exists bool
-	err = h.db.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = ? AND user_id = ?)", accountID, userID).Scan(&exists)
+	err = h.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?)", accountID, userID, middleware.GetProfileID(ctx)).Scan(&exists)
 	if err != nil || !exists {
 		jsonError(w, "Account not found", http.StatusNotFound)
 		return
@@ -201,18 +302,19 @@ func (h *TransactionHandler) ListByAccount(w http.ResponseWriter, r *http.Reques
 
 	// Get total count
 	var total int
-	err = h.db.QueryRow("SELECT COUNT(*) FROM transactions WHERE account_id = ?", accountID).Scan(&total)
+	err = h.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM transactions WHERE account_id = ?", accountID).Scan(&total)
 	if err != nil {
 		jsonError(w, "Failed to count transactions", http.StatusInternalServerError)
 		return
 	}
 
 	// Get transactions
-	rows, err := h.db.Query(`
-		SELECT id, account_id, type, amount, description, category, balance_after, created_at
-		FROM transactions
-		WHERE account_id = ?
-		ORDER BY created_at DESC
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.account_id = ?
+		ORDER BY t.created_at DESC
 		LIMIT ? OFFSET ?
 	`, accountID, pageSize, offset)
 	if err != nil {
@@ -223,16 +325,12 @@ func (h *TransactionHandler) ListByAccount(w http.ResponseWriter, r *http.Reques
 
 	transactions := []models.Transaction{}
 	for rows.Next() {
-		var t models.Transaction
-		err := rows.Scan(
-			&t.ID, &t.AccountID, &t.Type,
-			&t.Amount, &t.Description, &t.Category,
-			&t.BalanceAfter, &t.CreatedAt,
-		)
+		t, err := scanTransaction(rows)
 		if err != nil {
 			continue
 		}
-		transactions = append(transactions, t)
+		redactForViewer(ctx, t)
+		transactions = append(transactions, *t)
 	}
 
 	jsonResponse(w, models.TransactionListResponse{
@@ -244,29 +342,85 @@ func (h *TransactionHandler) ListByAccount(w http.ResponseWriter, r *http.Reques
 }
 
 func (h *TransactionHandler) Recent(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
 	}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
 	if limit < 1 || limit > 50 {
 		limit = 10
 	}
 
-	rows, err := h.db.Query(`
-		SELECT t.id, t.account_id, t.type, t.amount, t.description, t.category, t.balance_after,
-		       t.linked_transaction_id, t.created_at,
-		       COALESCE((SELECT a2.name FROM transactions t2
-		                 JOIN accounts a2 ON t2.account_id = a2.id
-		                 WHERE t2.id = t.linked_transaction_id), '') as linked_account_name
+	// Optional filters, each a comma-separated list
+	conditions := []string{"a.user_id = ?", "a.profile_id = ?"}
+	args := []interface{}{userID, middleware.GetProfileID(ctx)}
+
+	if ids := splitList(query.Get("account_ids")); len(ids) > 0 {
+		placeholders := make([]string, len(ids))
+		for i, v := range ids {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				jsonError(w, "Invalid account ID: "+v, http.StatusBadRequest)
+				return
+			}
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		conditions = append(conditions, "t.account_id IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if types := splitList(query.Get("types")); len(types) > 0 {
+		placeholders := make([]string, len(types))
+		for i, v := range types {
+			switch models.TransactionType(v) {
+			case models.TransactionTypeDeposit, models.TransactionTypeWithdrawal, models.TransactionTypeExpense, models.TransactionTypePayment, models.TransactionTypeRevalue:
+			default:
+				jsonError(w, "Invalid transaction type: "+v, http.StatusBadRequest)
+				return
+			}
+			placeholders[i] = "?"
+			args = append(args, v)
+		}
+		conditions = append(conditions, "t.type IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if categories := splitList(query.Get("categories")); len(categories) > 0 {
+		placeholders := make([]string, len(categories))
+		for i, v := range categories {
+			category := models.TransactionCategory(v)
+			if !isValidCategory(category) && !models.IsSystemCategory(category) {
+				jsonError(w, "Invalid category: "+v, http.StatusBadRequest)
+				return
+			}
+			placeholders[i] = "?"
+			args = append(args, v)
+		}
+		conditions = append(conditions, "COALESCE(t.category, 'other') IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if v := query.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			since, err = time.ParseInLocation("2006-01-02", v, time.Now().Location())
+		}
+		if err != nil {
+			jsonError(w, "Invalid since: use RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "t.created_at >= ?")
+		args = append(args, since.In(time.Now().Location()).Format("2006-01-02 15:04:05"))
+	}
+	args = append(args, limit)
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+transactionColumns+`, a.name, a.color
 		FROM transactions t
 		JOIN accounts a ON t.account_id = a.id
-		WHERE a.user_id = ?
-		ORDER BY t.created_at DESC
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY t.created_at DESC, t.id DESC
 		LIMIT ?
-	`, userID, limit)
+	`, args...)
 	if err != nil {
 		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
 		return
@@ -274,31 +428,78 @@ func (h *TransactionHandler) Recent(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	transactions := []models.Transaction{}
+	var linkedIDs []int64
 	for rows.Next() {
-		var t models.Transaction
-		var linkedID sql.NullInt64
-		var linkedName string
-		err := rows.Scan(
-			&t.ID, &t.AccountID, &t.Type,
-			&t.Amount, &t.Description, &t.Category,
-			&t.BalanceAfter, &linkedID, &t.CreatedAt, &linkedName,
-		)
+		var accountName, accountColor string
+		t, err := scanTransaction(rows, &accountName, &accountColor)
 		if err != nil {
 			continue
 		}
-		if linkedID.Valid {
-			t.LinkedTransactionID = &linkedID.Int64
-			t.LinkedAccountName = linkedName
+		if t.LinkedTransactionID != nil {
+			linkedIDs = append(linkedIDs, *t.LinkedTransactionID)
+		}
+		t.AccountName = accountName
+		t.AccountColor = accountColor
+		transactions = append(transactions, *t)
+	}
+	// Free the connection for the lookup below
+	rows.Close()
+
+	linkedNames, err := h.linkedAccountNames(ctx, linkedIDs)
+	if err != nil {
+		jsonError(w, "Failed to fetch transactions", http.StatusInternalServerError)
+		return
+	}
+	for i := range transactions {
+		if id := transactions[i].LinkedTransactionID; id != nil {
+			transactions[i].LinkedAccountName = linkedNames[*id]
 		}
-		transactions = append(transactions, t)
 	}
 
 	jsonResponse(w, transactions, http.StatusOK)
 }
 
+// linkedAccountNames maps the IDs of transfer counterparts to the names of
+// their accounts, looking them all up in one query. Joining them into the
+// listing instead makes SQLite sort the whole history before the limit.
+func (h *TransactionHandler) linkedAccountNames(ctx context.Context, ids []int64) (map[int64]string, error) {
+	names := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT t.id, a.name
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id IN (`+strings.Join(placeholders, ", ")+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, rows.Err()
+}
+
 // Transfer handles inter-account transfers
 func (h *TransactionHandler) Transfer(w http.ResponseWriter, r *http.Request) {
-	userID, ok := middleware.GetUserID(r.Context())
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
 	if !ok {
 		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
@@ -310,17 +511,50 @@ func (h *TransactionHandler) Transfer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Fee < 0 {
+		jsonError(w, "Fee cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	h.transfer(ctx, w, userID, req, transferOptions{fee: req.Fee, feeDescription: "Transfer fee"})
+}
+
+// transferOptions adjusts how a transfer is recorded
+type transferOptions struct {
+	// category tags both sides of the transfer, CategoryTransfer by default
+	category models.TransactionCategory
+	// fee is charged to the source account, in its currency, as a separate
+	// withdrawal recorded with the transfer
+	fee            float64
+	feeDescription string
+}
+
+// transfer moves req.Amount (in the source account's currency) from an asset
+// account to any other account of the user and writes the response
+func (h *TransactionHandler) transfer(ctx context.Context, w http.ResponseWriter, userID int64, req models.TransferRequest, opts transferOptions) {
+	if opts.category == "" {
+		opts.category = models.CategoryTransfer
+	}
+
 	// Validate amount
 	if req.Amount <= 0 {
 		jsonError(w, "Amount must be positive", http.StatusBadRequest)
 		return
 	}
 
+	if req.ReceivedAmount != nil && *req.ReceivedAmount <= 0 {
+		jsonError(w, "received_amount must be positive", http.StatusBadRequest)
+		return
+	}
+
 	if req.FromAccountID == req.ToAccountID {
 		jsonError(w, "Cannot transfer to the same account", http.StatusBadRequest)
 		return
 	}
 
+	unlock := h.locker.Lock(req.FromAccountID, req.ToAccountID)
+	defer unlock()
+
 	// Fetch both accounts
 	type accountInfo struct {
 		ID             int64
@@ -330,215 +564,737 @@ func (h *TransactionHandler) Transfer(w http.ResponseWriter, r *http.Request) {
 		CurrentBalance float64
 		CreditOwed     sql.NullFloat64
 		LoanOwed       sql.NullFloat64
+		Status         sql.NullString
+		FrozenUntil    sql.NullTime
+		Version        int64
 	}
 
 	var fromAccount, toAccount accountInfo
+	var fromAmount, toAmount, midAmount, fromNewBalance float64
+	var fromTxID, toTxID int64
+	var fromTxType models.TransactionType
+	var fromDescription string
+	var now time.Time
+
+	for attempt := 1; ; attempt++ {
+		err := h.db.QueryRowContext(ctx, `
+			SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed, status, frozen_until, version
+			FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?
+		`, req.FromAccountID, userID, middleware.GetProfileID(ctx)).Scan(
+			&fromAccount.ID, &fromAccount.Name, &fromAccount.Type, &fromAccount.Currency,
+			&fromAccount.CurrentBalance, &fromAccount.CreditOwed, &fromAccount.LoanOwed,
+			&fromAccount.Status, &fromAccount.FrozenUntil, &fromAccount.Version,
+		)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Source account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch source account", http.StatusInternalServerError)
+			return
+		}
 
-	err := h.db.QueryRow(`
-		SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed
-		FROM accounts WHERE id = ? AND user_id = ?
-	`, req.FromAccountID, userID).Scan(
-		&fromAccount.ID, &fromAccount.Name, &fromAccount.Type, &fromAccount.Currency,
-		&fromAccount.CurrentBalance, &fromAccount.CreditOwed, &fromAccount.LoanOwed,
-	)
-	if err == sql.ErrNoRows {
-		jsonError(w, "Source account not found", http.StatusNotFound)
-		return
+		err = h.db.QueryRowContext(ctx, `
+			SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed, status, frozen_until, version
+			FROM accounts WHERE id = ? AND user_id = ? AND profile_id = ?
+		`, req.ToAccountID, userID, middleware.GetProfileID(ctx)).Scan(
+			&toAccount.ID, &toAccount.Name, &toAccount.Type, &toAccount.Currency,
+			&toAccount.CurrentBalance, &toAccount.CreditOwed, &toAccount.LoanOwed,
+			&toAccount.Status, &toAccount.FrozenUntil, &toAccount.Version,
+		)
+		if err == sql.ErrNoRows {
+			jsonError(w, "Destination account not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to fetch destination account", http.StatusInternalServerError)
+			return
+		}
+
+		if models.FreezeActive(fromAccount.Status, fromAccount.FrozenUntil) {
+			jsonError(w, "Source account is frozen", http.StatusForbidden)
+			return
+		}
+
+		// Validate transfer direction
+		// Source must be an asset account
+		assetTypes := map[models.AccountType]bool{
+			models.AccountTypeCash:       true,
+			models.AccountTypeDebit:      true,
+			models.AccountTypeSaving:     true,
+			models.AccountTypeInvestment: true,
+		}
+		if !assetTypes[fromAccount.Type] {
+			jsonError(w, "Can only transfer from asset accounts (cash, debit, savings, investment)", http.StatusBadRequest)
+			return
+		}
+
+		// Destination can be asset or liability
+		validDestTypes := map[models.AccountType]bool{
+			models.AccountTypeCash:       true,
+			models.AccountTypeDebit:      true,
+			models.AccountTypeSaving:     true,
+			models.AccountTypeInvestment: true,
+			models.AccountTypeCreditCard: true,
+			models.AccountTypeLoan:       true,
+		}
+		if !validDestTypes[toAccount.Type] {
+			jsonError(w, "Invalid destination account type", http.StatusBadRequest)
+			return
+		}
+
+		// Handle currency conversion
+		fromAmount = req.Amount
+		toAmount = req.Amount
+
+		if req.ReceivedAmount != nil {
+			if fromAccount.Currency == toAccount.Currency {
+				jsonError(w, "received_amount is only for transfers between currencies", http.StatusBadRequest)
+				return
+			}
+			// The bank's rate is measured against the market rate, not a
+			// custom rate the user pinned
+			midAmount, err = h.exchangeService.Convert(req.Amount, fromAccount.Currency, toAccount.Currency)
+			if err != nil {
+				jsonError(w, "No mid-market rate for "+fromAccount.Currency+" to "+toAccount.Currency, http.StatusBadRequest)
+				return
+			}
+			toAmount = *req.ReceivedAmount
+		} else if fromAccount.Currency != toAccount.Currency {
+			convertedAmount, err := h.exchangeService.ConvertFor(userID, req.Amount, fromAccount.Currency, toAccount.Currency)
+			if err != nil {
+				jsonError(w, "Failed to convert currency: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			toAmount = convertedAmount
+		}
+
+		// Calculate new balances
+		fromNewBalance = fromAccount.CurrentBalance - fromAmount - opts.fee
+
+		var toNewBalance float64
+		switch toAccount.Type {
+		case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
+			toNewBalance = toAccount.CurrentBalance + toAmount
+		case models.AccountTypeCreditCard:
+			toNewBalance = toAccount.CreditOwed.Float64 - toAmount // Payment reduces owed
+		case models.AccountTypeLoan:
+			toNewBalance = toAccount.LoanOwed.Float64 - toAmount // Payment reduces owed
+		}
+
+		// Start database transaction
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		now = time.Now()
+
+		// Update source (withdrawal) and destination accounts, unless another
+		// write got to either of them first
+		err = setBalance(ctx, tx, fromAccount.ID, fromAccount.Type, fromNewBalance, fromAccount.Version)
+		if err == nil {
+			err = setBalance(ctx, tx, toAccount.ID, toAccount.Type, toNewBalance, toAccount.Version)
+		}
+		if err == errBalanceConflict {
+			tx.Rollback()
+			if attempt < maxBalanceAttempts {
+				continue
+			}
+			balanceConflict(w)
+			return
+		}
+		if err != nil {
+			jsonError(w, "Failed to update account balances", http.StatusInternalServerError)
+			return
+		}
+
+		// Create description with account names
+		description := req.Description
+		if description == "" {
+			description = "Transfer"
+		}
+		fromDescription = description + " → " + toAccount.Name
+		toDescription := description + " ← " + fromAccount.Name
+
+		// Determine transaction types
+		fromTxType = models.TransactionTypeWithdrawal
+		var toTxType models.TransactionType
+		switch toAccount.Type {
+		case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
+			toTxType = models.TransactionTypeDeposit
+		case models.AccountTypeCreditCard, models.AccountTypeLoan:
+			toTxType = models.TransactionTypePayment
+		}
+
+		// Insert withdrawal transaction (source)
+		result1, err := tx.ExecContext(ctx, `
+			INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, fromAccount.ID, string(fromTxType), fromAmount, services.EncryptField(userID, fromDescription), string(opts.category), fromNewBalance+opts.fee, now)
+		if err != nil {
+			jsonError(w, "Failed to create source transaction", http.StatusInternalServerError)
+			return
+		}
+		fromTxID, _ = result1.LastInsertId()
+
+		// Insert deposit/payment transaction (destination)
+		result2, err := tx.ExecContext(ctx, `
+			INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, toAccount.ID, string(toTxType), toAmount, services.EncryptField(userID, toDescription), string(opts.category), toNewBalance, now)
+		if err != nil {
+			jsonError(w, "Failed to create destination transaction", http.StatusInternalServerError)
+			return
+		}
+		toTxID, _ = result2.LastInsertId()
+
+		// The fee is real spending, unlike the transfer itself
+		if opts.fee > 0 {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, fromAccount.ID, string(models.TransactionTypeWithdrawal), opts.fee, services.EncryptField(userID, opts.feeDescription), string(models.CategoryOther), fromNewBalance, now)
+			if err != nil {
+				jsonError(w, "Failed to record fee", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Link transactions
+		_, err = tx.ExecContext(ctx, "UPDATE transactions SET linked_transaction_id = ? WHERE id = ?", toTxID, fromTxID)
+		if err != nil {
+			jsonError(w, "Failed to link transactions", http.StatusInternalServerError)
+			return
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE transactions SET linked_transaction_id = ? WHERE id = ?", fromTxID, toTxID)
+		if err != nil {
+			jsonError(w, "Failed to link transactions", http.StatusInternalServerError)
+			return
+		}
+
+		if req.ReceivedAmount != nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO fx_conversions (user_id, transaction_id, from_currency, to_currency, amount, received_amount, mid_market_amount, fee, created_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, userID, fromTxID, fromAccount.Currency, toAccount.Currency, fromAmount, toAmount, midAmount, opts.fee, now)
+			if err != nil {
+				jsonError(w, "Failed to record FX margin", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
+		}
+		break
 	}
-	if err != nil {
-		jsonError(w, "Failed to fetch source account", http.StatusInternalServerError)
+
+	checkBalanceAlerts(ctx, h.alerts, fromAccount.ID, toAccount.ID)
+
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "transfer",
+		EntityID: &fromTxID,
+		Summary:  fmt.Sprintf("Transferred %.2f %s from %s to %s", fromAmount, fromAccount.Currency, fromAccount.Name, toAccount.Name),
+		Details: map[string]interface{}{
+			"from_account_id": fromAccount.ID,
+			"to_account_id":   toAccount.ID,
+			"amount":          fromAmount,
+		},
+	})
+
+	// Return the source transaction (withdrawal)
+	response := models.Transaction{
+		ID:                  fromTxID,
+		AccountID:           fromAccount.ID,
+		Type:                fromTxType,
+		Amount:              fromAmount,
+		Description:         fromDescription,
+		Category:            opts.category,
+		BalanceAfter:        fromNewBalance + opts.fee,
+		LinkedTransactionID: &toTxID,
+		LinkedAccountName:   toAccount.Name,
+		CreatedAt:           now,
+	}
+
+	// Include converted amount info if cross-currency
+	if fromAccount.Currency != toAccount.Currency {
+		body := map[string]interface{}{
+			"transaction":      response,
+			"converted_amount": toAmount,
+			"to_currency":      toAccount.Currency,
+		}
+		if req.ReceivedAmount != nil {
+			body["mid_market_amount"] = math.Round(midAmount*100) / 100
+			body["fx_margin"] = math.Round((midAmount-toAmount)*100) / 100
+		}
+		jsonResponse(w, body, http.StatusCreated)
 		return
 	}
 
-	err = h.db.QueryRow(`
-		SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed
-		FROM accounts WHERE id = ? AND user_id = ?
-	`, req.ToAccountID, userID).Scan(
-		&toAccount.ID, &toAccount.Name, &toAccount.Type, &toAccount.Currency,
-		&toAccount.CurrentBalance, &toAccount.CreditOwed, &toAccount.LoanOwed,
-	)
-	if err == sql.ErrNoRows {
-		jsonError(w, "Destination account not found", http.StatusNotFound)
+	jsonResponse(w, response, http.StatusCreated)
+}
+
+// Update edits the descriptive fields of a transaction (description, category,
+// notes and metadata). Amounts are left untouched so balances stay consistent.
+func (h *TransactionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
 	}
+
+	transactionID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		jsonError(w, "Failed to fetch destination account", http.StatusInternalServerError)
+		jsonError(w, "Invalid transaction ID", http.StatusBadRequest)
 		return
 	}
 
-	// Validate transfer direction
-	// Source must be an asset account
-	assetTypes := map[models.AccountType]bool{
-		models.AccountTypeCash:       true,
-		models.AccountTypeDebit:      true,
-		models.AccountTypeSaving:     true,
-		models.AccountTypeInvestment: true,
+	var req models.UpdateTransactionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
-	if !assetTypes[fromAccount.Type] {
-		jsonError(w, "Can only transfer from asset accounts (cash, debit, savings, investment)", http.StatusBadRequest)
+
+	if ok, err := transactionInProfile(ctx, h.db, transactionID, userID); err != nil || !ok {
+		jsonError(w, "Transaction not found", http.StatusNotFound)
 		return
 	}
 
-	// Destination can be asset or liability
-	validDestTypes := map[models.AccountType]bool{
-		models.AccountTypeCash:       true,
-		models.AccountTypeDebit:      true,
-		models.AccountTypeSaving:     true,
-		models.AccountTypeInvestment: true,
-		models.AccountTypeCreditCard: true,
-		models.AccountTypeLoan:       true,
+	h.update(ctx, w, userID, transactionID, req)
+}
+
+// update edits one of the user's transactions and writes the updated
+// transaction as the response
+func (h *TransactionHandler) update(ctx context.Context, w http.ResponseWriter, userID, transactionID int64, req models.UpdateTransactionRequest) {
+	// Verify ownership through the account
+	var exists bool
+	err := h.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM transactions t
+			JOIN accounts a ON t.account_id = a.id
+			WHERE t.id = ? AND a.user_id = ?
+		)
+	`, transactionID, userID).Scan(&exists)
+	if err != nil || !exists {
+		jsonError(w, "Transaction not found", http.StatusNotFound)
+		return
 	}
-	if !validDestTypes[toAccount.Type] {
-		jsonError(w, "Invalid destination account type", http.StatusBadRequest)
+	if !checkTransactionsOpen(ctx, w, h.db, userID, transactionID) {
 		return
 	}
 
-	// Handle currency conversion
-	fromAmount := req.Amount
-	toAmount := req.Amount
+	// Build dynamic update query
+	updates := []string{}
+	args := []interface{}{}
 
-	if fromAccount.Currency != toAccount.Currency {
-		convertedAmount, err := h.exchangeService.Convert(req.Amount, fromAccount.Currency, toAccount.Currency)
+	if req.Description != nil {
+		updates = append(updates, "description = ?")
+		args = append(args, services.EncryptField(userID, *req.Description))
+	}
+	if req.Category != nil {
+		if !isValidCategory(*req.Category) {
+			jsonError(w, "Invalid category", http.StatusBadRequest)
+			return
+		}
+		updates = append(updates, "category = ?")
+		args = append(args, string(*req.Category))
+	}
+	if req.Notes != nil {
+		updates = append(updates, "notes = ?")
+		args = append(args, services.EncryptField(userID, *req.Notes))
+	}
+	if req.Metadata != nil {
+		if len(*req.Metadata) == 0 {
+			updates = append(updates, "metadata = NULL")
+		} else {
+			metadata, err := json.Marshal(*req.Metadata)
+			if err != nil {
+				jsonError(w, "Invalid metadata", http.StatusBadRequest)
+				return
+			}
+			updates = append(updates, "metadata = ?")
+			args = append(args, string(metadata))
+		}
+	}
+	if req.Location != nil {
+		if err := req.Location.Validate(); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		latitude, longitude, placeName := locationValues(userID, req.Location)
+		updates = append(updates, "latitude = ?", "longitude = ?", "place_name = ?")
+		args = append(args, latitude, longitude, placeName)
+	}
+	if req.TaxTreatment != nil {
+		switch {
+		case *req.TaxTreatment == "":
+			updates = append(updates, "tax_treatment = NULL")
+		case req.TaxTreatment.IsValidForTransaction():
+			updates = append(updates, "tax_treatment = ?")
+			args = append(args, string(*req.TaxTreatment))
+		default:
+			jsonError(w, "Invalid tax_treatment: use deductible, business or none", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.IsPrivate != nil {
+		updates = append(updates, "is_private = ?")
+		args = append(args, *req.IsPrivate)
+	}
+	// Flagging an expense that is already reimbursable keeps its link to a
+	// reimbursement; unflagging one releases the deposit it was linked to
+	var unlinkedDeposit sql.NullInt64
+	if req.Reimbursable != nil {
+		var txType models.TransactionType
+		var status sql.NullString
+		err := h.db.QueryRowContext(ctx, "SELECT type, reimbursement_status, reimbursed_by_id FROM transactions WHERE id = ?", transactionID).Scan(&txType, &status, &unlinkedDeposit)
 		if err != nil {
-			jsonError(w, "Failed to convert currency: "+err.Error(), http.StatusInternalServerError)
+			jsonError(w, "Failed to fetch transaction", http.StatusInternalServerError)
+			return
+		}
+		reimbursable := status.String == string(models.ReimbursementPending) || status.String == string(models.ReimbursementReimbursed)
+		switch {
+		case *req.Reimbursable && !isSpending(txType):
+			jsonError(w, "Only withdrawals and expenses can be reimbursable", http.StatusBadRequest)
 			return
+		case *req.Reimbursable && !reimbursable:
+			updates = append(updates, "reimbursement_status = ?")
+			args = append(args, string(models.ReimbursementPending))
+		case !*req.Reimbursable && reimbursable:
+			updates = append(updates, "reimbursement_status = NULL", "reimbursed_by_id = NULL")
+		}
+		if *req.Reimbursable || !reimbursable {
+			unlinkedDeposit = sql.NullInt64{}
 		}
-		toAmount = convertedAmount
 	}
 
-	// Calculate new balances
-	fromNewBalance := fromAccount.CurrentBalance - fromAmount
+	if len(updates) == 0 && req.Reimbursable == nil {
+		jsonError(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
 
-	var toNewBalance float64
-	var toUpdateQuery string
+	if len(updates) > 0 {
+		tx, err := h.db.BeginTx(ctx, nil)
+		if err != nil {
+			jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
 
-	switch toAccount.Type {
-	case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
-		toNewBalance = toAccount.CurrentBalance + toAmount
-		toUpdateQuery = "UPDATE accounts SET current_balance = ?, updated_at = ? WHERE id = ?"
-	case models.AccountTypeCreditCard:
-		owed := float64(0)
-		if toAccount.CreditOwed.Valid {
-			owed = toAccount.CreditOwed.Float64
+		args = append(args, transactionID)
+		query := "UPDATE transactions SET " + strings.Join(updates, ", ") + " WHERE id = ?"
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			jsonError(w, "Failed to update transaction", http.StatusInternalServerError)
+			return
 		}
-		toNewBalance = owed - toAmount // Payment reduces owed
-		toUpdateQuery = "UPDATE accounts SET credit_owed = ?, updated_at = ? WHERE id = ?"
-	case models.AccountTypeLoan:
-		owed := float64(0)
-		if toAccount.LoanOwed.Valid {
-			owed = toAccount.LoanOwed.Float64
+		if unlinkedDeposit.Valid {
+			if err := releaseReimbursement(ctx, tx, unlinkedDeposit.Int64); err != nil {
+				jsonError(w, "Failed to update transaction", http.StatusInternalServerError)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
+			return
 		}
-		toNewBalance = owed - toAmount // Payment reduces owed
-		toUpdateQuery = "UPDATE accounts SET loan_current_owed = ?, updated_at = ? WHERE id = ?"
 	}
 
-	// Start database transaction
-	tx, err := h.db.Begin()
+	transaction, err := scanTransaction(h.db.QueryRowContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE t.id = ?
+	`, transactionID))
 	if err != nil {
-		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		jsonError(w, "Transaction updated but failed to fetch", http.StatusInternalServerError)
 		return
 	}
-	defer tx.Rollback()
 
-	now := time.Now()
+	h.audit.Record(ctx, models.AuditEvent{
+		UserID:   userID,
+		Type:     models.ActivityTransaction,
+		Action:   "updated",
+		EntityID: &transactionID,
+		Summary:  "Edited a transaction",
+		Details:  map[string]interface{}{"fields": changedFields(req)},
+	})
 
-	// Update source account (withdrawal)
-	_, err = tx.Exec("UPDATE accounts SET current_balance = ?, updated_at = ? WHERE id = ?",
-		fromNewBalance, now, fromAccount.ID)
-	if err != nil {
-		jsonError(w, "Failed to update source account", http.StatusInternalServerError)
+	jsonResponse(w, transaction, http.StatusOK)
+}
+
+// Search finds transactions across all of the user's accounts whose
+// description, notes, metadata or place name match the query. An exact metadata match can
+// be requested with meta_key and meta_value.
+func (h *TransactionHandler) Search(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
 		return
 	}
 
-	// Update destination account
-	_, err = tx.Exec(toUpdateQuery, toNewBalance, now, toAccount.ID)
-	if err != nil {
-		jsonError(w, "Failed to update destination account", http.StatusInternalServerError)
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	metaKey := strings.TrimSpace(r.URL.Query().Get("meta_key"))
+	metaValue := r.URL.Query().Get("meta_value")
+
+	if q == "" && metaKey == "" {
+		jsonError(w, "Missing search query: q or meta_key", http.StatusBadRequest)
 		return
 	}
 
-	// Create description with account names
-	description := req.Description
-	if description == "" {
-		description = "Transfer"
+	// Parse pagination params
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
 	}
-	fromDescription := description + " → " + toAccount.Name
-	toDescription := description + " ← " + fromAccount.Name
+	offset := (page - 1) * pageSize
 
-	// Determine transaction types
-	fromTxType := models.TransactionTypeWithdrawal
-	var toTxType models.TransactionType
-	switch toAccount.Type {
-	case models.AccountTypeCash, models.AccountTypeDebit, models.AccountTypeSaving, models.AccountTypeInvestment:
-		toTxType = models.TransactionTypeDeposit
-	case models.AccountTypeCreditCard, models.AccountTypeLoan:
-		toTxType = models.TransactionTypePayment
+	conditions := []string{"a.user_id = ?", "a.profile_id = ?"}
+	args := []interface{}{userID, middleware.GetProfileID(ctx)}
+
+	// Encrypted descriptions, notes and place names can't be matched in
+	// SQL; the query is then applied after decrypting, below
+	filterInGo := q != "" && services.FieldEncryptionEnabled()
+	if q != "" && !filterInGo {
+		pattern := "%" + escapeLike(q) + "%"
+		conditions = append(conditions, `(t.description LIKE ? ESCAPE '\' OR t.notes LIKE ? ESCAPE '\' OR t.metadata LIKE ? ESCAPE '\' OR t.place_name LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	if metaKey != "" {
+		path := `$."` + strings.ReplaceAll(metaKey, `"`, `""`) + `"`
+		if metaValue != "" {
+			conditions = append(conditions, "json_extract(t.metadata, ?) = ?")
+			args = append(args, path, metaValue)
+		} else {
+			conditions = append(conditions, "json_extract(t.metadata, ?) IS NOT NULL")
+			args = append(args, path)
+		}
+	}
+	if accountIDStr := r.URL.Query().Get("account_id"); accountIDStr != "" {
+		accountID, err := strconv.ParseInt(accountIDStr, 10, 64)
+		if err != nil {
+			jsonError(w, "Invalid account ID", http.StatusBadRequest)
+			return
+		}
+		conditions = append(conditions, "t.account_id = ?")
+		args = append(args, accountID)
 	}
 
-	// Insert withdrawal transaction (source)
-	result1, err := tx.Exec(`
-		INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, fromAccount.ID, string(fromTxType), fromAmount, fromDescription, string(models.CategoryTransfer), fromNewBalance, now)
-	if err != nil {
-		jsonError(w, "Failed to create source transaction", http.StatusInternalServerError)
+	where := strings.Join(conditions, " AND ")
+	if filterInGo {
+		h.searchDecrypted(w, r, where, args, q, page, pageSize)
 		return
 	}
-	fromTxID, _ := result1.LastInsertId()
 
-	// Insert deposit/payment transaction (destination)
-	result2, err := tx.Exec(`
-		INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, toAccount.ID, string(toTxType), toAmount, toDescription, string(models.CategoryTransfer), toNewBalance, now)
+	// Get total count
+	var total int
+	err := h.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE `+where, args...).Scan(&total)
 	if err != nil {
-		jsonError(w, "Failed to create destination transaction", http.StatusInternalServerError)
+		jsonError(w, "Failed to count transactions", http.StatusInternalServerError)
 		return
 	}
-	toTxID, _ := result2.LastInsertId()
 
-	// Link transactions
-	_, err = tx.Exec("UPDATE transactions SET linked_transaction_id = ? WHERE id = ?", toTxID, fromTxID)
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE `+where+`
+		ORDER BY t.created_at DESC
+		LIMIT ? OFFSET ?
+	`, append(args, pageSize, offset)...)
 	if err != nil {
-		jsonError(w, "Failed to link transactions", http.StatusInternalServerError)
+		jsonError(w, "Failed to search transactions", http.StatusInternalServerError)
 		return
 	}
-	_, err = tx.Exec("UPDATE transactions SET linked_transaction_id = ? WHERE id = ?", fromTxID, toTxID)
+	defer rows.Close()
+
+	transactions := []models.Transaction{}
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			continue
+		}
+		redactForViewer(ctx, t)
+		transactions = append(transactions, *t)
+	}
+
+	jsonResponse(w, models.TransactionListResponse{
+		Transactions: transactions,
+		Total:        total,
+		Page:         page,
+		PageSize:     pageSize,
+	}, http.StatusOK)
+}
+
+// searchDecrypted runs a search when descriptions and notes are encrypted:
+// every transaction matching the other filters is decrypted and checked for
+// q, case-insensitively like LIKE, before paginating
+func (h *TransactionHandler) searchDecrypted(w http.ResponseWriter, r *http.Request, where string, args []interface{}, q string, page, pageSize int) {
+	rows, err := h.db.QueryContext(r.Context(), `
+		SELECT `+transactionColumns+`
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE `+where+`
+		ORDER BY t.created_at DESC
+	`, args...)
 	if err != nil {
-		jsonError(w, "Failed to link transactions", http.StatusInternalServerError)
+		jsonError(w, "Failed to search transactions", http.StatusInternalServerError)
 		return
 	}
+	defer rows.Close()
 
-	if err := tx.Commit(); err != nil {
-		jsonError(w, "Failed to commit transaction", http.StatusInternalServerError)
-		return
+	q = strings.ToLower(q)
+	matches := func(s string) bool { return strings.Contains(strings.ToLower(s), q) }
+
+	matched := []models.Transaction{}
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			continue
+		}
+		found := matches(t.Description) || matches(t.Notes)
+		if t.Location != nil {
+			found = found || matches(t.Location.PlaceName)
+		}
+		for key, value := range t.Metadata {
+			found = found || matches(key) || matches(value)
+		}
+		if found {
+			matched = append(matched, *t)
+		}
 	}
 
-	// Return the source transaction (withdrawal)
-	response := models.Transaction{
-		ID:                  fromTxID,
-		AccountID:           fromAccount.ID,
-		Type:                fromTxType,
-		Amount:              fromAmount,
-		Description:         fromDescription,
-		Category:            models.CategoryTransfer,
-		BalanceAfter:        fromNewBalance,
-		LinkedTransactionID: &toTxID,
-		LinkedAccountName:   toAccount.Name,
-		CreatedAt:           now,
+	transactions := []models.Transaction{}
+	if start := (page - 1) * pageSize; start < len(matched) {
+		transactions = matched[start:min(start+pageSize, len(matched))]
 	}
 
-	// Include converted amount info if cross-currency
-	if fromAccount.Currency != toAccount.Currency {
-		jsonResponse(w, map[string]interface{}{
-			"transaction":      response,
-			"converted_amount": toAmount,
-			"to_currency":      toAccount.Currency,
-		}, http.StatusCreated)
-		return
+	jsonResponse(w, models.TransactionListResponse{
+		Transactions: transactions,
+		Total:        len(matched),
+		Page:         page,
+		PageSize:     pageSize,
+	}, http.StatusOK)
+}
+
+// transactionColumns is the column list expected by scanTransaction. Queries
+// must alias the transactions table as t and join its account as a. The
+// owner's ID comes last so encrypted fields can be decrypted with their key.
+const transactionColumns = `t.id, t.account_id, t.type, t.amount, t.description, t.category,
+		       t.balance_after, t.linked_transaction_id, t.notes, t.metadata,
+		       COALESCE(t.is_private, 0), t.created_at, t.latitude, t.longitude, t.place_name,
+		       t.reimbursement_status, t.reimbursed_by_id, t.tax_treatment,
+		       a.user_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTransaction scans a row selected with transactionColumns. Any extra
+// destinations are scanned from the columns following transactionColumns.
+func scanTransaction(row rowScanner, extra ...interface{}) (*models.Transaction, error) {
+	var t models.TransactionDB
+	var userID int64
+	var latitude, longitude sql.NullString
+	dest := []interface{}{
+		&t.ID, &t.AccountID, &t.Type, &t.Amount, &t.Description, &t.Category,
+		&t.BalanceAfter, &t.LinkedTransactionID, &t.Notes, &t.Metadata,
+		&t.IsPrivate, &t.CreatedAt, &latitude, &longitude, &t.PlaceName,
+		&t.ReimbursementStatus, &t.ReimbursedByID, &t.TaxTreatment, &userID,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
 	}
+	t.Description.String = services.DecryptField(userID, t.Description.String)
+	t.Notes.String = services.DecryptField(userID, t.Notes.String)
+	t.PlaceName.String = services.DecryptField(userID, t.PlaceName.String)
+	t.Latitude = decryptCoordinate(userID, latitude)
+	t.Longitude = decryptCoordinate(userID, longitude)
+	return t.ToTransaction(), nil
+}
 
-	jsonResponse(w, response, http.StatusCreated)
+// redactForViewer hides the details of a private transaction shown to
+// someone other than the owner of its account, such as an advisor
+func redactForViewer(ctx context.Context, t *models.Transaction) {
+	if middleware.GetAdvisorAccess(ctx) != nil {
+		t.Redact()
+	}
+}
+
+// locationValues returns the latitude, longitude and place name columns for
+// a validated location, NULL where unset. Coordinates are kept to 6 decimal
+// places, about 10 cm. Like descriptions, all three are encrypted for the
+// user when field encryption is on, coordinates then being stored as text.
+func locationValues(userID int64, l *models.Location) (latitude, longitude, placeName interface{}) {
+	if l == nil {
+		return nil, nil, nil
+	}
+	if l.Latitude != nil && l.Longitude != nil {
+		latitude = services.EncryptCoordinate(userID, math.Round(*l.Latitude*1e6)/1e6)
+		longitude = services.EncryptCoordinate(userID, math.Round(*l.Longitude*1e6)/1e6)
+	}
+	if l.PlaceName != "" {
+		placeName = services.EncryptField(userID, l.PlaceName)
+	}
+	return latitude, longitude, placeName
+}
+
+// decryptCoordinate reads a latitude or longitude stored by locationValues
+func decryptCoordinate(userID int64, value sql.NullString) sql.NullFloat64 {
+	if !value.Valid {
+		return sql.NullFloat64{}
+	}
+	f, err := strconv.ParseFloat(services.DecryptField(userID, value.String), 64)
+	return sql.NullFloat64{Float64: f, Valid: err == nil}
+}
+
+// isSpending returns true for transaction types that take money out of an
+// account or add to a debt
+func isSpending(txType models.TransactionType) bool {
+	return txType == models.TransactionTypeWithdrawal || txType == models.TransactionTypeExpense
+}
+
+// Categories lists the categories transactions can be given, labeled in the
+// user's language
+func (h *TransactionHandler) Categories(w http.ResponseWriter, r *http.Request) {
+	locale := middleware.GetLocale(r.Context())
+	options := make([]models.CategoryOption, 0, len(models.AllCategories()))
+	for _, c := range models.AllCategories() {
+		options = append(options, models.CategoryOption{Category: c, Label: models.LocalizedCategoryLabel(locale, c)})
+	}
+	jsonResponse(w, options, http.StatusOK)
+}
+
+// isValidCategory checks a category against the predefined list
+func isValidCategory(category models.TransactionCategory) bool {
+	for _, c := range models.AllCategories() {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
 }
 
 // Helper to get account type from string
@@ -0,0 +1,190 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+func TestTransferBetweenAccounts(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+
+	var tx models.Transaction
+	f.Client.Post("/api/transfers", models.TransferRequest{
+		FromAccountID: f.Checking.ID,
+		ToAccountID:   f.Savings.ID,
+		Amount:        5000,
+		Description:   "Monthly savings",
+	}).Expect(http.StatusCreated).Decode(&tx)
+	if tx.LinkedTransactionID == nil {
+		t.Error("transfer isn't linked to the deposit")
+	}
+
+	if got := f.Client.Account(f.Checking.ID).CurrentBalance; got != testutil.CheckingBalance-5000 {
+		t.Errorf("checking balance = %v, want %v", got, testutil.CheckingBalance-5000)
+	}
+	if got := f.Client.Account(f.Savings.ID).CurrentBalance; got != testutil.SavingsBalance+5000 {
+		t.Errorf("savings balance = %v, want %v", got, testutil.SavingsBalance+5000)
+	}
+}
+
+func TestTransferPaysCreditCard(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+
+	f.Client.Post("/api/transfers", models.TransferRequest{
+		FromAccountID: f.Checking.ID,
+		ToAccountID:   f.Card.ID,
+		Amount:        2000,
+	}).Expect(http.StatusCreated)
+
+	card := f.Client.Account(f.Card.ID)
+	if card.CreditOwed == nil || *card.CreditOwed != testutil.CardOwed-2000 {
+		t.Errorf("card owed = %v, want %v", card.CreditOwed, testutil.CardOwed-2000)
+	}
+}
+
+func TestTransferValidation(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	other := app.Seed(t, "ben@example.com")
+
+	tests := []struct {
+		name   string
+		req    models.TransferRequest
+		status int
+	}{
+		{"same account", models.TransferRequest{FromAccountID: f.Checking.ID, ToAccountID: f.Checking.ID, Amount: 10}, http.StatusBadRequest},
+		{"zero amount", models.TransferRequest{FromAccountID: f.Checking.ID, ToAccountID: f.Savings.ID}, http.StatusBadRequest},
+		{"negative fee", models.TransferRequest{FromAccountID: f.Checking.ID, ToAccountID: f.Savings.ID, Amount: 10, Fee: -1}, http.StatusBadRequest},
+		{"from a card", models.TransferRequest{FromAccountID: f.Card.ID, ToAccountID: f.Savings.ID, Amount: 10}, http.StatusBadRequest},
+		{"to another user's account", models.TransferRequest{FromAccountID: f.Checking.ID, ToAccountID: other.Savings.ID, Amount: 10}, http.StatusNotFound},
+		{"from another user's account", models.TransferRequest{FromAccountID: other.Checking.ID, ToAccountID: f.Savings.ID, Amount: 10}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.Client.Post("/api/transfers", tt.req).Expect(tt.status)
+		})
+	}
+
+	// Nothing moved
+	for _, a := range []models.Account{f.Checking, f.Savings, other.Checking, other.Savings} {
+		c := f.Client
+		if a.ID == other.Checking.ID || a.ID == other.Savings.ID {
+			c = other.Client
+		}
+		if got := c.Account(a.ID).CurrentBalance; got != a.CurrentBalance {
+			t.Errorf("%s balance = %v, want %v", a.Name, got, a.CurrentBalance)
+		}
+	}
+	var page struct {
+		Total int `json:"total"`
+	}
+	f.Client.Get(fmt.Sprintf("/api/accounts/%d/transactions", f.Savings.ID)).Expect(http.StatusOK).Decode(&page)
+	if page.Total != 1 {
+		t.Errorf("savings has %d transactions, want only its opening balance", page.Total)
+	}
+}
+
+func TestRecentShowsTransferCounterpart(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+
+	f.Client.Post("/api/transfers", models.TransferRequest{
+		FromAccountID: f.Checking.ID,
+		ToAccountID:   f.Savings.ID,
+		Amount:        1000,
+	}).Expect(http.StatusCreated)
+
+	var recent []models.Transaction
+	f.Client.Get("/api/transactions/recent").Expect(http.StatusOK).Decode(&recent)
+	linked := 0
+	for _, tx := range recent {
+		if tx.LinkedTransactionID == nil {
+			continue
+		}
+		linked++
+		want := map[int64]string{f.Checking.ID: "Savings", f.Savings.ID: "Checking"}[tx.AccountID]
+		if tx.LinkedAccountName != want {
+			t.Errorf("transaction on account %d links to %q, want %q", tx.AccountID, tx.LinkedAccountName, want)
+		}
+	}
+	if linked != 2 {
+		t.Errorf("got %d linked transactions, want 2", linked)
+	}
+}
+
+func TestMoveTransaction(t *testing.T) {
+	cfg := testutil.DefaultConfig()
+	cfg.AdminEmails = []string{"ana@example.com"}
+	app := testutil.NewAppWithConfig(t, cfg)
+	f := app.Seed(t, "ana@example.com")
+	record := func(account models.Account, txType models.TransactionType, amount float64) models.Transaction {
+		var tx models.Transaction
+		f.Client.Post(fmt.Sprintf("/api/accounts/%d/transactions", account.ID), models.CreateTransactionRequest{Type: txType, Amount: amount}).
+			Expect(http.StatusCreated).Decode(&tx)
+		return tx
+	}
+	move := func(id, to int64) string { return fmt.Sprintf("/api/transactions/%d/move?to_account=%d", id, to) }
+
+	// A withdrawal meant for savings, with later transactions on both sides
+	wrong := record(f.Checking, models.TransactionTypeWithdrawal, 500)
+	record(f.Savings, models.TransactionTypeDeposit, 200)
+	record(f.Checking, models.TransactionTypeDeposit, 100)
+
+	var moved models.Transaction
+	f.Client.Post(move(wrong.ID, f.Savings.ID), nil).Expect(http.StatusOK).Decode(&moved)
+	if moved.AccountID != f.Savings.ID || moved.BalanceAfter != testutil.SavingsBalance-500 {
+		t.Errorf("moved transaction = %+v, want it in savings after its opening balance", moved)
+	}
+	if got := f.Client.Account(f.Checking.ID).CurrentBalance; got != testutil.CheckingBalance+100 {
+		t.Errorf("checking balance = %v, want %v", got, testutil.CheckingBalance+100)
+	}
+	if got := f.Client.Account(f.Savings.ID).CurrentBalance; got != testutil.SavingsBalance+200-500 {
+		t.Errorf("savings balance = %v, want %v", got, testutil.SavingsBalance+200-500)
+	}
+	var list models.TransactionListResponse
+	f.Client.Get(fmt.Sprintf("/api/accounts/%d/transactions", f.Savings.ID)).Expect(http.StatusOK).Decode(&list)
+	if len(list.Transactions) != 3 || list.Transactions[0].BalanceAfter != testutil.SavingsBalance+200-500 {
+		t.Errorf("savings history = %+v, want the later deposit replayed after the move", list.Transactions)
+	}
+
+	// Both ledgers still add up
+	var report struct {
+		Discrepancies []struct {
+			AccountID int64 `json:"account_id"`
+		} `json:"discrepancies"`
+	}
+	f.Client.Get("/api/admin/integrity").Expect(http.StatusOK).Decode(&report)
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("integrity discrepancies after the move: %+v", report.Discrepancies)
+	}
+
+	var transfer models.Transaction
+	f.Client.Post("/api/transfers", models.TransferRequest{FromAccountID: f.Checking.ID, ToAccountID: f.Savings.ID, Amount: 300}).
+		Expect(http.StatusCreated).Decode(&transfer)
+	expense := record(f.Card, models.TransactionTypeExpense, 50)
+	other := app.Seed(t, "ben@example.com")
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"transfer onto its other side", move(transfer.ID, f.Savings.ID), http.StatusBadRequest},
+		{"type the account doesn't take", move(expense.ID, f.Checking.ID), http.StatusBadRequest},
+		{"same account", move(expense.ID, f.Card.ID), http.StatusBadRequest},
+		{"missing account", fmt.Sprintf("/api/transactions/%d/move", expense.ID), http.StatusBadRequest},
+		{"someone else's account", move(expense.ID, other.Checking.ID), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.Client.Post(tt.path, nil).Expect(tt.status)
+		})
+	}
+	other.Client.Post(move(wrong.ID, other.Checking.ID), nil).Expect(http.StatusNotFound)
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// Report webhook deliveries are tried hourly, up to maxWebhookAttempts
+// times per week before the user is told it failed
+const (
+	maxWebhookAttempts = 3
+	webhookTimeout     = 15 * time.Second
+	webhookEvent       = "weekly_report"
+)
+
+type ReportWebhookHandler struct {
+	db            *sql.DB
+	reports       *ReportHandler
+	notifications *services.NotificationService
+	client        *http.Client
+}
+
+func NewReportWebhookHandler(db *sql.DB, reports *ReportHandler, notifications *services.NotificationService) *ReportWebhookHandler {
+	return &ReportWebhookHandler{
+		db:            db,
+		reports:       reports,
+		notifications: notifications,
+		client:        &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Get returns the user's report webhook, without its secret
+func (h *ReportWebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	hook, _, err := h.webhook(ctx, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Report webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch report webhook", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, hook, http.StatusOK)
+}
+
+// Set creates the report webhook or changes its URL and weekday. The
+// signing secret is returned when the webhook is created or rotate_secret
+// is set, and never again.
+func (h *ReportWebhookHandler) Set(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetReportWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Normalize(); err != nil {
+		jsonError(w, "Invalid report webhook: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _, err := h.webhook(ctx, userID)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		jsonError(w, "Failed to fetch report webhook", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	var secret string
+	if !exists || req.RotateSecret {
+		secret, err = newWebhookSecret()
+		if err != nil {
+			jsonError(w, "Failed to generate secret", http.StatusInternalServerError)
+			return
+		}
+	}
+	if exists {
+		_, err = h.db.ExecContext(ctx, `
+			UPDATE report_webhooks SET url = ?, weekday = ?, updated_at = ? WHERE user_id = ?
+		`, req.URL, *req.Weekday, now, userID)
+		if err == nil && secret != "" {
+			_, err = h.db.ExecContext(ctx, "UPDATE report_webhooks SET secret = ? WHERE user_id = ?", services.EncryptField(userID, secret), userID)
+		}
+	} else {
+		prefs, prefsErr := h.reports.periodPreferences(ctx, userID)
+		if prefsErr != nil {
+			jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+			return
+		}
+		// Deliveries start with the week in progress; Test sends last week's
+		start, _ := lastWeek(prefs, now)
+		_, err = h.db.ExecContext(ctx, `
+			INSERT INTO report_webhooks (user_id, url, secret, weekday, last_period, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, userID, req.URL, services.EncryptField(userID, secret), *req.Weekday, start.Format("2006-01-02"), now, now)
+	}
+	if err != nil {
+		jsonError(w, "Failed to save report webhook", http.StatusInternalServerError)
+		return
+	}
+
+	hook, _, err := h.webhook(ctx, userID)
+	if err != nil {
+		jsonError(w, "Report webhook saved but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+	hook.Secret = secret
+
+	status := http.StatusOK
+	if !exists {
+		status = http.StatusCreated
+	}
+	jsonResponse(w, hook, status)
+}
+
+// Delete stops the weekly deliveries
+func (h *ReportWebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := h.db.ExecContext(ctx, "DELETE FROM report_webhooks WHERE user_id = ?", userID)
+	if err != nil {
+		jsonError(w, "Failed to delete report webhook", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		jsonError(w, "Report webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Test sends last week's report right away, without touching the schedule,
+// so a pipeline can be set up against a real delivery
+func (h *ReportWebhookHandler) Test(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	hook, secret, err := h.webhook(ctx, userID)
+	if err == sql.ErrNoRows {
+		jsonError(w, "Report webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonError(w, "Failed to fetch report webhook", http.StatusInternalServerError)
+		return
+	}
+
+	prefs, err := h.reports.periodPreferences(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+	start, end := lastWeek(prefs, time.Now())
+	status, err := h.deliver(ctx, userID, hook.URL, secret, start, end)
+
+	result := models.ReportWebhookTestResult{Delivered: err == nil, StatusCode: status}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	jsonResponse(w, result, http.StatusOK)
+}
+
+// webhook returns the user's report webhook and its decrypted secret
+func (h *ReportWebhookHandler) webhook(ctx context.Context, userID int64) (*models.ReportWebhook, string, error) {
+	var hook models.ReportWebhook
+	var secret string
+	var lastPeriod, lastError sql.NullString
+	var lastAttemptAt sql.NullTime
+	err := h.db.QueryRowContext(ctx, `
+		SELECT url, weekday, secret, last_period, last_attempt_at, last_error, created_at
+		FROM report_webhooks WHERE user_id = ?
+	`, userID).Scan(&hook.URL, &hook.Weekday, &secret, &lastPeriod, &lastAttemptAt, &lastError, &hook.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if lastPeriod.Valid {
+		hook.LastPeriod = &lastPeriod.String
+	}
+	if lastAttemptAt.Valid {
+		hook.LastAttemptAt = &lastAttemptAt.Time
+	}
+	hook.LastError = lastError.String
+	return &hook, services.DecryptField(userID, secret), nil
+}
+
+// DeliverDue sends last week's report to every webhook whose weekday has
+// come, retrying failed deliveries on later runs, and returns how many were
+// delivered
+func (h *ReportWebhookHandler) DeliverDue(ctx context.Context, now time.Time) (int, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, user_id, url, secret, weekday, COALESCE(last_period, ''), attempts
+		FROM report_webhooks
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch report webhooks: %w", err)
+	}
+	type dueWebhook struct {
+		id         int64
+		userID     int64
+		url        string
+		secret     string
+		weekday    int
+		lastPeriod string
+		attempts   int
+	}
+	var due []dueWebhook
+	for rows.Next() {
+		var d dueWebhook
+		if err := rows.Scan(&d.id, &d.userID, &d.url, &d.secret, &d.weekday, &d.lastPeriod, &d.attempts); err != nil {
+			continue
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+
+	delivered := 0
+	for _, d := range due {
+		prefs, err := h.reports.periodPreferences(ctx, d.userID)
+		if err != nil {
+			log.Printf("Report webhook %d: failed to fetch preferences: %v", d.id, err)
+			continue
+		}
+		start, end := lastWeek(prefs, now)
+		period := start.Format("2006-01-02")
+		weekStart := end.Add(time.Second)
+		sendOn := weekStart.AddDate(0, 0, (d.weekday-int(weekStart.Weekday())+7)%7)
+		if d.lastPeriod >= period || now.Before(sendOn) {
+			continue
+		}
+
+		_, err = h.deliver(ctx, d.userID, d.url, services.DecryptField(d.userID, d.secret), start, end)
+		if err == nil {
+			_, err = h.db.ExecContext(ctx, `
+				UPDATE report_webhooks SET last_period = ?, attempts = 0, last_attempt_at = ?, last_error = NULL WHERE id = ?
+			`, period, now, d.id)
+			if err != nil {
+				log.Printf("Report webhook %d: failed to record delivery: %v", d.id, err)
+			}
+			delivered++
+			continue
+		}
+
+		// Give up on the week after the last attempt, and tell the user
+		attempts := d.attempts + 1
+		lastPeriod := sql.NullString{String: d.lastPeriod, Valid: d.lastPeriod != ""}
+		if attempts >= maxWebhookAttempts {
+			lastPeriod = sql.NullString{String: period, Valid: true}
+		}
+		_, dbErr := h.db.ExecContext(ctx, `
+			UPDATE report_webhooks SET last_period = ?, attempts = ?, last_attempt_at = ?, last_error = ? WHERE id = ?
+		`, lastPeriod, attempts%maxWebhookAttempts, now, err.Error(), d.id)
+		if dbErr != nil {
+			log.Printf("Report webhook %d: failed to record failure: %v", d.id, dbErr)
+		}
+		if attempts < maxWebhookAttempts {
+			continue
+		}
+		notifyErr := h.notifications.Notify(ctx, d.userID, models.NotificationReportWebhook,
+			"Weekly report webhook failed",
+			fmt.Sprintf("Your report for the week of %s couldn't be delivered after %d attempts: %s. Check the webhook URL in your report settings.",
+				start.Format("Jan 2"), maxWebhookAttempts, err.Error()),
+			fmt.Sprintf("report_webhook:%d:%s", d.id, period),
+			map[string]interface{}{"url": d.url, "period_start": period, "error": err.Error()})
+		if notifyErr != nil {
+			log.Printf("Report webhook %d: failed to notify user: %v", d.id, notifyErr)
+		}
+	}
+	return delivered, nil
+}
+
+// deliver posts a week's report, signed with the webhook's secret. The
+// signature header is "t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">",
+// so receivers can also reject replays.
+func (h *ReportWebhookHandler) deliver(ctx context.Context, userID int64, url, secret string, start, end time.Time) (int, error) {
+	report, err := h.reports.buildReport(ctx, userID, "week", start, end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to build report: %w", err)
+	}
+	now := time.Now()
+	body, err := json.Marshal(models.ReportWebhookDelivery{Event: webhookEvent, SentAt: now, Report: report})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OdinWallet-Webhook/1")
+	req.Header.Set("X-Wallet-Event", webhookEvent)
+	req.Header.Set("X-Wallet-Signature", "t="+timestamp+",v1="+services.SignWebhook(secret, timestamp, body))
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// lastWeek returns the start and end of the full week before the one
+// containing now
+func lastWeek(prefs models.PeriodPreferences, now time.Time) (time.Time, time.Time) {
+	current := prefs.WeekContaining(now)
+	return prefs.WeekContaining(current.AddDate(0, 0, -1)), current.Add(-time.Second)
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/testutil"
+)
+
+// webhookReceiver records deliveries and answers with status
+type webhookReceiver struct {
+	mu         sync.Mutex
+	status     int
+	signatures []string
+	bodies     [][]byte
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.signatures = append(rec.signatures, r.Header.Get("X-Wallet-Signature"))
+	rec.bodies = append(rec.bodies, body)
+	w.WriteHeader(rec.status)
+}
+
+func (rec *webhookReceiver) count() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.bodies)
+}
+
+func TestReportWebhookDeliveries(t *testing.T) {
+	app := testutil.NewApp(t)
+	f := app.Seed(t, "ana@example.com")
+	receiver := &webhookReceiver{status: http.StatusOK}
+	endpoint := httptest.NewServer(receiver)
+	defer endpoint.Close()
+
+	f.Client.Put("/api/webhooks/report", models.SetReportWebhookRequest{URL: "ftp://example.com"}).Expect(http.StatusBadRequest)
+
+	today := int(time.Now().Weekday())
+	var hook models.ReportWebhook
+	f.Client.Put("/api/webhooks/report", models.SetReportWebhookRequest{URL: endpoint.URL, Weekday: &today}).
+		Expect(http.StatusCreated).Decode(&hook)
+	if !strings.HasPrefix(hook.Secret, "whsec_") {
+		t.Fatalf("secret = %q, want a whsec_ secret on creation", hook.Secret)
+	}
+	var fetched models.ReportWebhook
+	f.Client.Get("/api/webhooks/report").Expect(http.StatusOK).Decode(&fetched)
+	if fetched.Secret != "" || fetched.URL != endpoint.URL {
+		t.Errorf("fetched webhook = %+v, want the URL without the secret", fetched)
+	}
+
+	var result models.ReportWebhookTestResult
+	f.Client.Post("/api/webhooks/report/test", nil).Expect(http.StatusOK).Decode(&result)
+	if !result.Delivered || receiver.count() != 1 {
+		t.Fatalf("test delivery = %+v with %d requests, want one delivery", result, receiver.count())
+	}
+	verifyWebhookSignature(t, hook.Secret, receiver.signatures[0], receiver.bodies[0])
+	var delivery struct {
+		Event  string `json:"event"`
+		Report struct {
+			PeriodStart string `json:"period_start"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal(receiver.bodies[0], &delivery); err != nil || delivery.Event != "weekly_report" || delivery.Report.PeriodStart == "" {
+		t.Errorf("delivery = %s, want a weekly_report with the report", receiver.bodies[0])
+	}
+
+	// Deliveries start with the week in progress
+	ctx := context.Background()
+	now := time.Now()
+	if n, err := app.Server.ReportWebhooks.DeliverDue(ctx, now); err != nil || n != 0 {
+		t.Fatalf("delivered %d (%v) right after creation, want 0", n, err)
+	}
+	nextWeek := now.AddDate(0, 0, 7)
+	if n, _ := app.Server.ReportWebhooks.DeliverDue(ctx, nextWeek); n != 1 {
+		t.Fatalf("delivered %d next week, want 1", n)
+	}
+	if n, _ := app.Server.ReportWebhooks.DeliverDue(ctx, nextWeek.Add(time.Hour)); n != 0 {
+		t.Errorf("delivered %d again the same week, want 0", n)
+	}
+
+	// Failures are retried, then the user is told and the week is skipped
+	receiver.mu.Lock()
+	receiver.status = http.StatusInternalServerError
+	receiver.mu.Unlock()
+	weekAfter := now.AddDate(0, 0, 14)
+	before := receiver.count()
+	for i := 0; i < 4; i++ {
+		app.Server.ReportWebhooks.DeliverDue(ctx, weekAfter.Add(time.Duration(i)*time.Hour))
+	}
+	if got := receiver.count() - before; got != 3 {
+		t.Errorf("made %d attempts, want 3", got)
+	}
+	var notifications []models.Notification
+	f.Client.Get("/api/notifications").Expect(http.StatusOK).Decode(&notifications)
+	failed := 0
+	for _, n := range notifications {
+		if n.Type == models.NotificationReportWebhook {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("got %d failure notifications, want 1", failed)
+	}
+
+	f.Client.Delete("/api/webhooks/report").Expect(http.StatusNoContent)
+	f.Client.Get("/api/webhooks/report").Expect(http.StatusNotFound)
+}
+
+func verifyWebhookSignature(t *testing.T, secret, header string, body []byte) {
+	t.Helper()
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature header %q doesn't match the body", header)
+	}
+}
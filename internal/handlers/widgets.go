@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/hooks"
+)
+
+// maxPinnedItems keeps the widget payload small
+const maxPinnedItems = 8
+
+type WidgetHandler struct {
+	db      *sql.DB
+	reports *ReportHandler
+	budgets *services.BudgetService
+}
+
+func NewWidgetHandler(db *sql.DB, exchangeService *services.ExchangeService, budgetService *services.BudgetService) *WidgetHandler {
+	// Widgets only borrow the report queries, so no report hooks run
+	return &WidgetHandler{db: db, reports: NewReportHandler(db, exchangeService, budgetService, hooks.New()), budgets: budgetService}
+}
+
+// ListPinned returns the user's pinned item configuration
+func (h *WidgetHandler) ListPinned(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := h.pinnedItems(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch pinned items", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, items, http.StatusOK)
+}
+
+// SetPinned replaces the user's pinned items
+func (h *WidgetHandler) SetPinned(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.SetPinnedItemsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) > maxPinnedItems {
+		jsonError(w, "Too many pinned items", http.StatusBadRequest)
+		return
+	}
+
+	for i := range req.Items {
+		item := &req.Items[i]
+		item.Label = strings.TrimSpace(item.Label)
+
+		switch item.Kind {
+		case models.PinnedAccountBalance:
+			if item.AccountID == nil {
+				jsonError(w, "account_id is required for account_balance items", http.StatusBadRequest)
+				return
+			}
+			exists, err := accountInProfile(ctx, h.db, *item.AccountID, userID)
+			if err != nil || !exists {
+				jsonError(w, "Account not found", http.StatusNotFound)
+				return
+			}
+			item.Category = nil
+		case models.PinnedBudgetRemaining:
+			if item.Category == nil || *item.Category == "" {
+				jsonError(w, "category is required for budget_remaining items", http.StatusBadRequest)
+				return
+			}
+			item.AccountID = nil
+		case models.PinnedSafeToSpend:
+			item.AccountID = nil
+			item.Category = nil
+		default:
+			jsonError(w, "Invalid pinned item kind", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		jsonError(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM pinned_items WHERE user_id = ?", userID); err != nil {
+		jsonError(w, "Failed to update pinned items", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for i, item := range req.Items {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO pinned_items (user_id, kind, account_id, category, label, position, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, userID, string(item.Kind), item.AccountID, item.Category, item.Label, i, now)
+		if err != nil {
+			jsonError(w, "Failed to update pinned items", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		jsonError(w, "Failed to commit pinned items", http.StatusInternalServerError)
+		return
+	}
+
+	items, err := h.pinnedItems(ctx, userID)
+	if err != nil {
+		jsonError(w, "Pinned items saved but failed to fetch", http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, items, http.StatusOK)
+}
+
+// Widgets resolves the user's pinned items to their current values in the
+// active profile. Items of other profiles are left out.
+func (h *WidgetHandler) Widgets(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	items, err := h.pinnedItems(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch pinned items", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.WidgetResponse{
+		Items:     []models.WidgetValue{},
+		UpdatedAt: time.Now(),
+	}
+	if len(items) == 0 {
+		jsonResponse(w, response, http.StatusOK)
+		return
+	}
+
+	accounts, err := h.accounts(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch accounts", http.StatusInternalServerError)
+		return
+	}
+
+	baseCurrency, err := h.reports.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		jsonError(w, "Failed to fetch user preferences", http.StatusInternalServerError)
+		return
+	}
+
+	// Budget progress is only calculated when a pinned item needs it
+	var budgets map[string]models.BudgetProgress
+	loadBudgets := func() error {
+		if budgets != nil {
+			return nil
+		}
+		progress, err := h.budgets.Progress(ctx, userID, time.Now())
+		if err != nil {
+			return err
+		}
+		budgets = make(map[string]models.BudgetProgress)
+		for _, p := range progress {
+			budgets[p.Category] = p
+		}
+		return nil
+	}
+
+	for _, item := range items {
+		value := models.WidgetValue{Kind: item.Kind, Label: item.Label}
+
+		switch item.Kind {
+		case models.PinnedAccountBalance:
+			account, ok := accounts[*item.AccountID]
+			if !ok {
+				continue
+			}
+			value.Value = account.GetDisplayBalance()
+			value.Currency = account.Currency
+			if value.Label == "" {
+				value.Label = account.Name
+			}
+		case models.PinnedBudgetRemaining:
+			if err := loadBudgets(); err != nil {
+				jsonError(w, "Failed to calculate budget progress", http.StatusInternalServerError)
+				return
+			}
+			budget, ok := budgets[*item.Category]
+			if !ok {
+				continue
+			}
+			value.Value = budget.Remaining
+			value.Currency = budget.Currency
+			if value.Label == "" {
+				value.Label = categoryLabel(*item.Category) + " budget"
+			}
+		case models.PinnedSafeToSpend:
+			if err := loadBudgets(); err != nil {
+				jsonError(w, "Failed to calculate budget progress", http.StatusInternalServerError)
+				return
+			}
+			value.Value = h.safeToSpend(userID, accounts, budgets, baseCurrency)
+			value.Currency = baseCurrency
+			if value.Label == "" {
+				value.Label = "Safe to spend"
+			}
+		}
+
+		response.Items = append(response.Items, value)
+	}
+
+	jsonResponse(w, response, http.StatusOK)
+}
+
+// safeToSpend is the cash and debit balance left after paying off credit
+// cards and setting aside what remains of the current budgets
+func (h *WidgetHandler) safeToSpend(userID int64, accounts map[int64]*models.Account, budgets map[string]models.BudgetProgress, currency string) float64 {
+	var total float64
+	for _, account := range accounts {
+		switch account.Type {
+		case models.AccountTypeCash, models.AccountTypeDebit:
+			total += h.reports.convert(userID, account.CurrentBalance, account.Currency, currency)
+		case models.AccountTypeCreditCard:
+			total -= h.reports.convert(userID, account.GetLiabilityAmount(), account.Currency, currency)
+		}
+	}
+
+	for _, budget := range budgets {
+		if budget.Remaining > 0 {
+			total -= budget.Remaining
+		}
+	}
+
+	return total
+}
+
+func (h *WidgetHandler) pinnedItems(ctx context.Context, userID int64) ([]models.PinnedItem, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, kind, account_id, category, COALESCE(label, ''), position, created_at
+		FROM pinned_items
+		WHERE user_id = ?
+		ORDER BY position, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []models.PinnedItem{}
+	for rows.Next() {
+		var item models.PinnedItem
+		var accountID sql.NullInt64
+		var category sql.NullString
+		err := rows.Scan(&item.ID, &item.Kind, &accountID, &category, &item.Label, &item.Position, &item.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if accountID.Valid {
+			item.AccountID = &accountID.Int64
+		}
+		if category.Valid {
+			item.Category = &category.String
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (h *WidgetHandler) accounts(ctx context.Context, userID int64) (map[int64]*models.Account, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, name, type, currency, current_balance, credit_owed, loan_current_owed
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ?
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := make(map[int64]*models.Account)
+	for rows.Next() {
+		var a models.AccountDB
+		if err := rows.Scan(&a.ID, &a.Name, &a.Type, &a.Currency, &a.CurrentBalance, &a.CreditOwed, &a.LoanCurrentOwed); err != nil {
+			continue
+		}
+		accounts[a.ID] = a.ToAccount()
+	}
+	return accounts, nil
+}
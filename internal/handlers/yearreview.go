@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+)
+
+// CategoryRanking is a category's share of a year's spending
+type CategoryRanking struct {
+	Rank         int     `json:"rank"`
+	Category     string  `json:"category"`
+	Label        string  `json:"label"`
+	Amount       float64 `json:"amount"`
+	Share        float64 `json:"share"`
+	PreviousYear float64 `json:"previous_year"`
+}
+
+// CategoryImprovement is the category with the largest drop in spending
+// compared to the previous year
+type CategoryImprovement struct {
+	Category      string  `json:"category"`
+	Label         string  `json:"label"`
+	PreviousYear  float64 `json:"previous_year"`
+	ThisYear      float64 `json:"this_year"`
+	Saved         float64 `json:"saved"`
+	PercentChange float64 `json:"percent_change"`
+}
+
+// NetWorthChange compares net worth at the start and end of a period
+type NetWorthChange struct {
+	Start         float64  `json:"start"`
+	End           float64  `json:"end"`
+	Change        float64  `json:"change"`
+	PercentChange *float64 `json:"percent_change"`
+}
+
+// PeriodSummary is income and expenses for part of the year
+type PeriodSummary struct {
+	Period      string   `json:"period"`
+	Label       string   `json:"label,omitempty"` // months only
+	Income      float64  `json:"income"`
+	Expenses    float64  `json:"expenses"`
+	SavingsRate *float64 `json:"savings_rate"`
+}
+
+// YearInReview is the annual summary returned by the year-in-review endpoint
+type YearInReview struct {
+	Year                 int                  `json:"year"`
+	Currency             string               `json:"currency"`
+	TotalIncome          float64              `json:"total_income"`
+	TotalExpenses        float64              `json:"total_expenses"`
+	Net                  float64              `json:"net"`
+	SavingsRate          *float64             `json:"savings_rate"`
+	TransactionCount     int                  `json:"transaction_count"`
+	CategoryRankings     []CategoryRanking    `json:"category_rankings"`
+	NetWorth             NetWorthChange       `json:"net_worth"`
+	BiggestPurchase      *TopTransaction      `json:"biggest_purchase"`
+	MostImprovedCategory *CategoryImprovement `json:"most_improved_category"`
+	Quarters             []PeriodSummary      `json:"quarters"`
+	Months               []PeriodSummary      `json:"months"`
+}
+
+// YearInReview returns the annual summary for ?year= (default: this year)
+func (h *ReportHandler) YearInReview(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	year, err := reviewYear(r.URL.Query().Get("year"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.buildYearInReview(ctx, userID, year)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonResponse(w, review, http.StatusOK)
+}
+
+// YearInReviewPDF renders the annual summary as a PDF
+func (h *ReportHandler) YearInReviewPDF(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := middleware.GetUserID(ctx)
+	if !ok {
+		jsonError(w, "User not found in context", http.StatusUnauthorized)
+		return
+	}
+
+	year, err := reviewYear(r.URL.Query().Get("year"))
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.buildYearInReview(ctx, userID, year)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	locale := services.UserLocale(ctx, h.db, userID)
+	currency := review.Currency
+	money := func(amount float64) string {
+		return services.FormatMoney(amount, currency, locale)
+	}
+	rate := func(r *float64) string {
+		if r == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f%%", *r)
+	}
+
+	doc := services.NewPDFDocument()
+	doc.Title(fmt.Sprintf("Odin Wallet - %d in Review", year))
+	doc.Paragraph("Generated " + time.Now().Format("2006-01-02 15:04") + ", amounts in " + currency)
+	doc.Line()
+
+	doc.Heading("The year at a glance")
+	summaryWidths := []float64{200}
+	doc.Row([]string{"Total income", money(review.TotalIncome)}, summaryWidths, false)
+	doc.Row([]string{"Total expenses", money(review.TotalExpenses)}, summaryWidths, false)
+	doc.Row([]string{"Net", money(review.Net)}, summaryWidths, true)
+	doc.Row([]string{"Savings rate", rate(review.SavingsRate)}, summaryWidths, false)
+	doc.Row([]string{"Transactions", strconv.Itoa(review.TransactionCount)}, summaryWidths, false)
+
+	doc.Heading("Net worth")
+	doc.Row([]string{"Start of year", money(review.NetWorth.Start)}, summaryWidths, false)
+	doc.Row([]string{"End of year", money(review.NetWorth.End)}, summaryWidths, false)
+	doc.Row([]string{"Change", money(review.NetWorth.Change) + " (" + rate(review.NetWorth.PercentChange) + ")"}, summaryWidths, true)
+
+	doc.Heading("Highlights")
+	if review.BiggestPurchase != nil {
+		p := review.BiggestPurchase
+		doc.Paragraph(fmt.Sprintf("Biggest purchase: %s, %s on %s", truncate(p.Description, 40), money(p.Amount), p.Date))
+	}
+	if review.MostImprovedCategory != nil {
+		c := review.MostImprovedCategory
+		doc.Paragraph(fmt.Sprintf("Most improved: %s, %s less than last year (%.0f%%)", categoryLabel(c.Category), money(c.Saved), c.PercentChange))
+	}
+	if review.BiggestPurchase == nil && review.MostImprovedCategory == nil {
+		doc.Paragraph("No spending recorded this year.")
+	}
+
+	doc.Heading("Top categories")
+	rankWidths := []float64{30, 150, 110, 80}
+	doc.Row([]string{"#", "Category", "Spent", "Share", "Last year"}, rankWidths, true)
+	for _, c := range review.CategoryRankings {
+		doc.Row([]string{
+			strconv.Itoa(c.Rank), categoryLabel(c.Category), money(c.Amount),
+			fmt.Sprintf("%.1f%%", c.Share), money(c.PreviousYear),
+		}, rankWidths, false)
+	}
+
+	doc.Heading("Savings rate by quarter")
+	periodWidths := []float64{80, 130, 130}
+	doc.Row([]string{"Quarter", "Income", "Expenses", "Savings rate"}, periodWidths, true)
+	for _, q := range review.Quarters {
+		doc.Row([]string{q.Period, money(q.Income), money(q.Expenses), rate(q.SavingsRate)}, periodWidths, false)
+	}
+
+	doc.Heading("Month by month")
+	doc.Row([]string{"Month", "Income", "Expenses", "Savings rate"}, periodWidths, true)
+	for _, m := range review.Months {
+		doc.Row([]string{m.Period, money(m.Income), money(m.Expenses), rate(m.SavingsRate)}, periodWidths, false)
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="odin-wallet-%d-in-review.pdf"`, year))
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc.Bytes())
+}
+
+func reviewYear(yearStr string) (int, error) {
+	now := time.Now()
+	if yearStr == "" {
+		return now.Year(), nil
+	}
+	year, err := strconv.Atoi(yearStr)
+	if err != nil || year < 1970 || year > now.Year() {
+		return 0, fmt.Errorf("Invalid year")
+	}
+	return year, nil
+}
+
+// buildYearInReview aggregates a year of transactions in the user's preferred
+// currency. Transfers between accounts and balance adjustments are neither
+// income nor spending.
+func (h *ReportHandler) buildYearInReview(ctx context.Context, userID int64, year int) (*YearInReview, error) {
+	currency, err := h.getPreferredCurrency(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch user preferences")
+	}
+
+	now := time.Now()
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, now.Location())
+	end := start.AddDate(1, 0, 0)
+	previousStart := start.AddDate(-1, 0, 0)
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT t.id, a.name, a.currency, t.type, COALESCE(t.description, ''), COALESCE(t.category, 'other'), t.amount, t.created_at,
+		       COALESCE(t.is_private, 0)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ?`+reportAccounts(ctx, "a.id")+` AND t.created_at >= ? AND t.created_at < ?
+		  AND COALESCE(t.category, 'other') NOT IN ('transfer', 'opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+	`, userID, middleware.GetProfileID(ctx), previousStart.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch transactions")
+	}
+	defer rows.Close()
+
+	review := &YearInReview{
+		Year:             year,
+		Currency:         currency,
+		CategoryRankings: []CategoryRanking{},
+	}
+	quarters := make([]PeriodSummary, 4)
+	months := make([]PeriodSummary, 12)
+	thisYear := make(map[string]float64)
+	lastYear := make(map[string]float64)
+
+	for rows.Next() {
+		var t TopTransaction
+		var accountCurrency, txType string
+		var createdAt time.Time
+		var private bool
+		if err := rows.Scan(&t.ID, &t.AccountName, &accountCurrency, &txType, &t.Description, &t.Category, &t.Amount, &createdAt, &private); err != nil {
+			continue
+		}
+		t.Description = services.DecryptField(userID, t.Description)
+		redactReportRow(ctx, private, &t.Description, &t.Category)
+		t.Amount = h.convert(userID, t.Amount, accountCurrency, currency)
+		createdAt = createdAt.In(now.Location())
+
+		isExpense := txType == string(models.TransactionTypeWithdrawal) || txType == string(models.TransactionTypeExpense)
+		if createdAt.Before(start) {
+			if isExpense {
+				lastYear[t.Category] += t.Amount
+			}
+			continue
+		}
+
+		review.TransactionCount++
+		month := int(createdAt.Month()) - 1
+		switch {
+		case txType == string(models.TransactionTypeDeposit):
+			review.TotalIncome += t.Amount
+			quarters[month/3].Income += t.Amount
+			months[month].Income += t.Amount
+		case isExpense:
+			review.TotalExpenses += t.Amount
+			quarters[month/3].Expenses += t.Amount
+			months[month].Expenses += t.Amount
+			thisYear[t.Category] += t.Amount
+
+			if review.BiggestPurchase == nil || t.Amount > review.BiggestPurchase.Amount {
+				t.Date = createdAt.Format("2006-01-02")
+				purchase := t
+				review.BiggestPurchase = &purchase
+			}
+		}
+	}
+
+	review.Net = review.TotalIncome - review.TotalExpenses
+	review.SavingsRate = savingsRate(review.TotalIncome, review.TotalExpenses)
+
+	for i := range quarters {
+		quarters[i].Period = fmt.Sprintf("Q%d", i+1)
+		quarters[i].SavingsRate = savingsRate(quarters[i].Income, quarters[i].Expenses)
+	}
+	locale := middleware.GetLocale(ctx)
+	for i := range months {
+		monthStart := time.Date(year, time.Month(i+1), 1, 0, 0, 0, 0, now.Location())
+		months[i].Period = monthStart.Format("2006-01")
+		months[i].Label = models.MonthLabel(locale, monthStart)
+		months[i].SavingsRate = savingsRate(months[i].Income, months[i].Expenses)
+	}
+	review.Quarters = quarters
+	review.Months = months
+
+	for category, amount := range thisYear {
+		ranking := CategoryRanking{
+			Category:     category,
+			Label:        models.LocalizedCategoryLabel(locale, models.TransactionCategory(category)),
+			Amount:       amount,
+			PreviousYear: lastYear[category],
+		}
+		if review.TotalExpenses > 0 {
+			ranking.Share = amount / review.TotalExpenses * 100
+		}
+		review.CategoryRankings = append(review.CategoryRankings, ranking)
+	}
+	sort.Slice(review.CategoryRankings, func(i, j int) bool {
+		return review.CategoryRankings[i].Amount > review.CategoryRankings[j].Amount
+	})
+	for i := range review.CategoryRankings {
+		review.CategoryRankings[i].Rank = i + 1
+	}
+
+	for category, previous := range lastYear {
+		saved := previous - thisYear[category]
+		if saved <= 0 || (review.MostImprovedCategory != nil && saved <= review.MostImprovedCategory.Saved) {
+			continue
+		}
+		review.MostImprovedCategory = &CategoryImprovement{
+			Category:      category,
+			Label:         models.LocalizedCategoryLabel(locale, models.TransactionCategory(category)),
+			PreviousYear:  previous,
+			ThisYear:      thisYear[category],
+			Saved:         saved,
+			PercentChange: -saved / previous * 100,
+		}
+	}
+
+	// Net worth is rebuilt from current balances, so the end of the current
+	// year is today
+	if end.After(now) {
+		end = now
+	}
+	startWorth, err := h.netWorthAt(ctx, userID, start, currency)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to calculate net worth")
+	}
+	endWorth, err := h.netWorthAt(ctx, userID, end, currency)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to calculate net worth")
+	}
+	review.NetWorth = NetWorthChange{Start: startWorth, End: endWorth, Change: endWorth - startWorth}
+	if startWorth != 0 {
+		percent := (endWorth - startWorth) / math.Abs(startWorth) * 100
+		review.NetWorth.PercentChange = &percent
+	}
+
+	return review, nil
+}
+
+func savingsRate(income, expenses float64) *float64 {
+	if income <= 0 {
+		return nil
+	}
+	rate := (income - expenses) / income * 100
+	return &rate
+}
+
+// netWorthAt reconstructs the user's net worth at a point in time by undoing
+// every transaction recorded after it. Accounts opened later count as zero.
+func (h *ReportHandler) netWorthAt(ctx context.Context, userID int64, at time.Time, currency string) (float64, error) {
+	later, err := services.BalanceChangesSince(ctx, h.db, userID, at)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, type, currency, current_balance, credit_owed, loan_current_owed, loan_initial_amount, created_at
+		FROM accounts
+		WHERE user_id = ? AND profile_id = ?`+reportAccounts(ctx, "id")+`
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var netWorth float64
+	for rows.Next() {
+		var a models.AccountDB
+		if err := rows.Scan(&a.ID, &a.Type, &a.Currency, &a.CurrentBalance, &a.CreditOwed, &a.LoanCurrentOwed, &a.LoanInitialAmount, &a.CreatedAt); err != nil {
+			continue
+		}
+		if !a.CreatedAt.Before(at) {
+			continue
+		}
+
+		account := a.ToAccount()
+		balance := h.convert(userID, services.BalanceBefore(account, later[a.ID]), a.Currency, currency)
+		if account.IsAssetAccount() {
+			netWorth += balance
+		} else {
+			netWorth -= balance
+		}
+	}
+
+	return netWorth, nil
+}
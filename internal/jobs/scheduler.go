@@ -0,0 +1,220 @@
+// Package jobs runs the server's periodic background work on cron-style
+// schedules, retrying failed runs and keeping each job's last status for
+// the admin API
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/pkg/tracing"
+)
+
+// DefaultRetryDelay is the wait before the first retry of a failed run;
+// each further retry waits twice as long
+const DefaultRetryDelay = 30 * time.Second
+
+// Job is a unit of background work
+type Job struct {
+	Name string
+	// Schedule is a cron expression or shorthand accepted by ParseSchedule
+	Schedule string
+	// RunAtStart runs the job as soon as the scheduler starts, before its
+	// first scheduled time
+	RunAtStart bool
+	// Retries is how many times a failed run is retried before giving up
+	// until the next scheduled time
+	Retries    int
+	RetryDelay time.Duration
+	// Run does the work and returns a short summary of what it did
+	Run func(ctx context.Context) (string, error)
+}
+
+type entry struct {
+	job      Job
+	schedule Schedule
+	status   models.JobStatus
+}
+
+// Scheduler runs registered jobs. Each job runs in its own goroutine and
+// never overlaps with itself.
+type Scheduler struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	started bool
+	active  func() bool
+	running sync.WaitGroup
+	tracer  *tracing.Tracer
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{entries: make(map[string]*entry)}
+}
+
+// Register adds a job. It fails on a duplicate name or an invalid schedule;
+// jobs must be registered before Start.
+func (s *Scheduler) Register(job Job) error {
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", job.Name, err)
+	}
+	if job.RetryDelay <= 0 {
+		job.RetryDelay = DefaultRetryDelay
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return fmt.Errorf("job %s: scheduler already started", job.Name)
+	}
+	if _, ok := s.entries[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.entries[job.Name] = &entry{
+		job:      job,
+		schedule: schedule,
+		status:   models.JobStatus{Name: job.Name, Schedule: job.Schedule},
+	}
+	return nil
+}
+
+// SetActive makes the scheduler skip runs while active returns false, as on
+// a read replica that can't write. It's checked before every run.
+func (s *Scheduler) SetActive(active func() bool) {
+	s.mu.Lock()
+	s.active = active
+	s.mu.Unlock()
+}
+
+// SetTracer traces each run as the root of its own trace
+func (s *Scheduler) SetTracer(tracer *tracing.Tracer) {
+	s.mu.Lock()
+	s.tracer = tracer
+	s.mu.Unlock()
+}
+
+// Start runs every registered job on its schedule until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.started = true
+	entries := make([]*entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.loop(ctx, e)
+		}()
+		log.Printf("Job %s scheduled (%s)", e.job.Name, e.job.Schedule)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	if e.job.RunAtStart {
+		s.run(ctx, e)
+	}
+	for {
+		next := e.schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("Job %s has no future run time, stopping", e.job.Name)
+			return
+		}
+		s.mu.Lock()
+		e.status.NextRunAt = &next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, e)
+	}
+}
+
+// Wait blocks until every job has stopped after the context given to Start
+// is cancelled, letting runs in progress finish
+func (s *Scheduler) Wait() {
+	s.running.Wait()
+}
+
+// run runs the job once, retrying failures with a doubling delay
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	start := time.Now()
+	s.mu.Lock()
+	if s.active != nil && !s.active() {
+		e.status.LastResult = "skipped: not the primary"
+		s.mu.Unlock()
+		return
+	}
+	e.status.Running = true
+	s.mu.Unlock()
+
+	result, err := s.attempt(ctx, e)
+	delay := e.job.RetryDelay
+	for retry := 1; err != nil && retry <= e.job.Retries && ctx.Err() == nil; retry++ {
+		log.Printf("Job %s failed, retrying in %v (%d/%d): %v", e.job.Name, delay, retry, e.job.Retries, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+			result, err = s.attempt(ctx, e)
+		}
+		delay *= 2
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.status.Running = false
+	e.status.LastRunAt = &start
+	e.status.LastDuration = time.Since(start).Seconds()
+	e.status.Runs++
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		log.Printf("Job %s failed: %v", e.job.Name, err)
+		return
+	}
+	e.status.LastError = ""
+	e.status.LastResult = result
+}
+
+// attempt runs the job, turning a panic into an error so one bad run
+// doesn't take the server down
+func (s *Scheduler) attempt(ctx context.Context, e *entry) (result string, err error) {
+	s.mu.Lock()
+	tracer := s.tracer
+	s.mu.Unlock()
+	ctx, span := tracer.Start(ctx, "job "+e.job.Name, tracing.SpanKindInternal, tracing.String("job.name", e.job.Name))
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+		span.RecordError(err)
+		span.End()
+	}()
+	return e.job.Run(ctx)
+}
+
+// Status returns every job's status, sorted by name
+func (s *Scheduler) Status() []models.JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]models.JobStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
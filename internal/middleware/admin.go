@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// RequireAdmin only lets through users flagged as instance administrators.
+// It must run after Auth.
+func RequireAdmin(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				jsonError(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+
+			var isAdmin sql.NullInt64
+			err := db.QueryRowContext(r.Context(), "SELECT is_admin FROM users WHERE id = ?", userID).Scan(&isAdmin)
+			if err != nil && err != sql.ErrNoRows {
+				jsonError(w, "Failed to verify permissions", http.StatusInternalServerError)
+				return
+			}
+			if !isAdmin.Valid || isAdmin.Int64 != 1 {
+				jsonError(w, "Admin access required", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const AdvisorAccessKey contextKey = "advisor_access"
+
+// AdvisorHeader selects the user whose finances an advisor is viewing
+const AdvisorHeader = "X-Advisor-For"
+
+// advisorLastUsedInterval is how stale a grant's last_used_at may get before
+// a request refreshes it, so browsing doesn't write on every read
+const advisorLastUsedInterval = time.Minute
+
+// AdvisorAccess is what an advisor may see of the user whose finances they
+// are viewing
+type AdvisorAccess struct {
+	GrantID    int64
+	AdvisorID  int64
+	OwnerID    int64
+	AccountIDs map[int64]bool
+	Reports    bool
+}
+
+// CanViewAccount reports whether the account was shared with the advisor
+func (a *AdvisorAccess) CanViewAccount(accountID int64) bool {
+	return a.AccountIDs[accountID]
+}
+
+// Advisor lets a user view another user's finances with the X-Advisor-For
+// header, or the advisor_for query parameter, set to the other user's ID.
+// Only read requests to the accounts and reports they were granted are let
+// through; handlers then see the owner as the current user. It must run
+// after Auth and before Profile.
+func Advisor(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(AdvisorHeader)
+			if value == "" {
+				value = r.URL.Query().Get("advisor_for")
+			}
+			if value == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			advisorID, ok := GetUserID(r.Context())
+			if !ok {
+				jsonError(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			ownerID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				jsonError(w, "Invalid advisor user ID", http.StatusBadRequest)
+				return
+			}
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				jsonError(w, "Advisor access is read-only", http.StatusForbidden)
+				return
+			}
+
+			access := &AdvisorAccess{AdvisorID: advisorID, OwnerID: ownerID, AccountIDs: make(map[int64]bool)}
+			var lastUsedAt sql.NullTime
+			err = db.QueryRowContext(r.Context(), "SELECT id, reports, last_used_at FROM advisor_grants WHERE user_id = ? AND advisor_id = ?",
+				ownerID, advisorID).Scan(&access.GrantID, &access.Reports, &lastUsedAt)
+			if err == sql.ErrNoRows {
+				jsonError(w, "Access grant not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				jsonError(w, "Failed to verify permissions", http.StatusInternalServerError)
+				return
+			}
+
+			rows, err := db.QueryContext(r.Context(), "SELECT account_id FROM advisor_grant_accounts WHERE grant_id = ?", access.GrantID)
+			if err != nil {
+				jsonError(w, "Failed to verify permissions", http.StatusInternalServerError)
+				return
+			}
+			for rows.Next() {
+				var accountID int64
+				if err := rows.Scan(&accountID); err == nil {
+					access.AccountIDs[accountID] = true
+				}
+			}
+			rows.Close()
+
+			// Judge the path chi routes on
+			path := r.URL.Path
+			if r.URL.RawPath != "" {
+				path = r.URL.RawPath
+			}
+			if !access.allows(path) {
+				jsonError(w, "Not available with advisor access", http.StatusForbidden)
+				return
+			}
+
+			if !IsReplica(r.Context()) && (!lastUsedAt.Valid || time.Since(lastUsedAt.Time) > advisorLastUsedInterval) {
+				db.ExecContext(r.Context(), "UPDATE advisor_grants SET last_used_at = ? WHERE id = ?", time.Now(), access.GrantID)
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, ownerID)
+			ctx = context.WithValue(ctx, AdvisorAccessKey, access)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// allows reports whether the grant covers a read of path. The account list
+// is filtered by its handler; single accounts and their transactions need
+// the account to be shared, and reports need the reports grant.
+func (a *AdvisorAccess) allows(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	if path == "/api/accounts" {
+		return true
+	}
+	if path == "/api/reports" || strings.HasPrefix(path, "/api/reports/") {
+		return a.Reports
+	}
+
+	rest, ok := strings.CutPrefix(path, "/api/accounts/")
+	if !ok {
+		return false
+	}
+	idPart, sub, _ := strings.Cut(rest, "/")
+	if sub != "" && sub != "transactions" {
+		return false
+	}
+	accountID, err := strconv.ParseInt(idPart, 10, 64)
+	return err == nil && a.CanViewAccount(accountID)
+}
+
+// GetAdvisorAccess returns the advisor's access when the request is viewing
+// another user's finances, or nil
+func GetAdvisorAccess(ctx context.Context) *AdvisorAccess {
+	access, _ := ctx.Value(AdvisorAccessKey).(*AdvisorAccess)
+	return access
+}
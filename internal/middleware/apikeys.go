@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const APIKeyIDKey contextKey = "api_key_id"
+
+// APIKeyHeader carries an integration key
+const APIKeyHeader = "X-API-Key"
+
+// HashAPIKey is how integration keys are stored, so a copy of the database
+// can't be used to call the API
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKey authenticates automation services by an integration key, sent in
+// the X-API-Key header or, for services that can only call a URL, the
+// api_key query parameter. The request works in the profile the key was
+// created in.
+func APIKey(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+			if key == "" {
+				key = strings.TrimSpace(r.URL.Query().Get("api_key"))
+			}
+			if key == "" {
+				jsonError(w, "API key required", http.StatusUnauthorized)
+				return
+			}
+
+			hash := HashAPIKey(key)
+			var keyID, userID, profileID int64
+			err := db.QueryRowContext(r.Context(), "SELECT id, user_id, profile_id FROM api_keys WHERE key_hash = ?", hash).
+				Scan(&keyID, &userID, &profileID)
+			if err == sql.ErrNoRows {
+				jsonError(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				jsonError(w, "Failed to validate API key", http.StatusInternalServerError)
+				return
+			}
+
+			if !IsReplica(r.Context()) {
+				db.ExecContext(r.Context(), "UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now(), keyID)
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, APIKeyIDKey, keyID)
+			next.ServeHTTP(w, r.WithContext(WithProfileID(ctx, profileID)))
+		})
+	}
+}
+
+// GetAPIKeyID returns the integration key a request was authenticated with
+func GetAPIKeyID(ctx context.Context) (int64, bool) {
+	keyID, ok := ctx.Value(APIKeyIDKey).(int64)
+	return keyID, ok
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 )
@@ -12,10 +13,28 @@ type contextKey string
 
 const UserIDKey contextKey = "user_id"
 
-// Auth middleware validates the session and adds user ID to context
-func Auth(db *sql.DB, sessionSecret string) func(http.Handler) http.Handler {
+// Auth middleware validates the session, or the bearer access token, and
+// adds user ID to context. Sessions are looked up in sessions, usually a
+// SessionCache.
+func Auth(db *sql.DB, sessions SessionStore, sessionSecret string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Clients without cookies send the access token from /api/auth/token
+			if token, ok := BearerToken(r); ok {
+				userID, err := AccessTokenUser(r.Context(), db, sessionSecret, token)
+				if errors.Is(err, ErrInvalidAccessToken) || errors.Is(err, ErrAccessTokenExpired) {
+					jsonError(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					jsonError(w, "Failed to validate access token", http.StatusInternalServerError)
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserIDKey, userID)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			cookie, err := r.Cookie("session_id")
 			if err != nil {
 				jsonError(w, "Authentication required", http.StatusUnauthorized)
@@ -23,14 +42,8 @@ func Auth(db *sql.DB, sessionSecret string) func(http.Handler) http.Handler {
 			}
 
 			// Validate session
-			var userID int64
-			var expiresAt time.Time
-			err = db.QueryRow(
-				"SELECT user_id, expires_at FROM sessions WHERE id = ?",
-				cookie.Value,
-			).Scan(&userID, &expiresAt)
-
-			if err == sql.ErrNoRows {
+			session, err := sessions.Get(r.Context(), cookie.Value)
+			if errors.Is(err, ErrSessionNotFound) {
 				jsonError(w, "Invalid session", http.StatusUnauthorized)
 				return
 			}
@@ -40,14 +53,14 @@ func Auth(db *sql.DB, sessionSecret string) func(http.Handler) http.Handler {
 			}
 
 			// Check if session expired
-			if time.Now().After(expiresAt) {
-				db.Exec("DELETE FROM sessions WHERE id = ?", cookie.Value)
+			if time.Now().After(session.ExpiresAt) {
+				sessions.Delete(r.Context(), cookie.Value)
 				jsonError(w, "Session expired", http.StatusUnauthorized)
 				return
 			}
 
 			// Add user ID to context
-			ctx := context.WithValue(r.Context(), UserIDKey, userID)
+			ctx := context.WithValue(r.Context(), UserIDKey, session.UserID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
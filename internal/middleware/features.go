@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// FeatureChecker decides whether a user has a feature
+type FeatureChecker interface {
+	Enabled(ctx context.Context, userID int64, feature models.Feature) bool
+}
+
+// RequireFeature hides routes of an optional feature from users who
+// don't have it, answering as if they didn't exist. It must run after Auth.
+func RequireFeature(flags FeatureChecker, feature models.Feature) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				jsonError(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !flags.Enabled(r.Context(), userID, feature) {
+				jsonError(w, "Not found", http.StatusNotFound)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+type localeKey struct{}
+
+// localeState is the language a request is answered in. It's settled before
+// the handler runs, so translating an error never queries the database while
+// the handler may hold a connection in a transaction.
+type localeState struct {
+	locale string
+}
+
+// Localize answers in the user's language: error messages are translated
+// and handlers can localize labels with GetLocale. Outside a session the
+// Accept-Language header decides. Used again after Auth, it switches to the
+// signed-in user's locale preference.
+func Localize(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if state, ok := r.Context().Value(localeKey{}).(*localeState); ok {
+				if userID, ok := GetUserID(r.Context()); ok {
+					var locale sql.NullString
+					db.QueryRowContext(r.Context(), "SELECT locale FROM users WHERE id = ?", userID).Scan(&locale)
+					if locale.String != "" {
+						state.locale = locale.String
+					}
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			state := &localeState{locale: models.DefaultLocale}
+			if tag := preferredLanguage(r.Header.Get("Accept-Language")); tag != "" {
+				state.locale = tag
+			}
+			ctx := context.WithValue(r.Context(), localeKey{}, state)
+			next.ServeHTTP(&localeWriter{ResponseWriter: w, state: state}, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetLocale returns the locale the request is answered in
+func GetLocale(ctx context.Context) string {
+	if state, ok := ctx.Value(localeKey{}).(*localeState); ok {
+		return state.locale
+	}
+	return models.DefaultLocale
+}
+
+// preferredLanguage returns the first language tag of an Accept-Language
+// header
+func preferredLanguage(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	tag, _, _ := strings.Cut(first, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "*" {
+		return ""
+	}
+	return tag
+}
+
+// localeWriter translates the message of JSON error responses
+type localeWriter struct {
+	http.ResponseWriter
+	state       *localeState
+	translating bool
+}
+
+func (w *localeWriter) WriteHeader(status int) {
+	w.translating = status >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") &&
+		models.Language(w.state.locale) != models.LanguageEnglish
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *localeWriter) Write(b []byte) (int, error) {
+	if !w.translating {
+		return w.ResponseWriter.Write(b)
+	}
+	w.translating = false
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(b, &body); err != nil {
+		return w.ResponseWriter.Write(b)
+	}
+	message, ok := body["error"].(string)
+	if !ok {
+		return w.ResponseWriter.Write(b)
+	}
+	body["error"] = models.TranslateMessage(w.state.locale, message)
+	var buf bytes.Buffer
+	json.NewEncoder(&buf).Encode(body)
+	if _, err := w.ResponseWriter.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	// Callers check that everything they wrote was written
+	return len(b), nil
+}
+
+func (w *localeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+)
+
+const ProfileIDKey contextKey = "profile_id"
+
+// ProfileHeader selects the profile a request works in
+const ProfileHeader = "X-Profile-ID"
+
+// Profile reads the active profile from the X-Profile-ID header, or the
+// profile_id query parameter, and adds it to the context. Without either
+// the request works in the user's default profile, 0. It must run after
+// Auth.
+func Profile(db *sql.DB) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(ProfileHeader)
+			if value == "" {
+				value = r.URL.Query().Get("profile_id")
+			}
+			if value == "" || value == "0" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, ok := GetUserID(r.Context())
+			if !ok {
+				jsonError(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			profileID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || profileID < 0 {
+				jsonError(w, "Invalid profile ID", http.StatusBadRequest)
+				return
+			}
+
+			var exists bool
+			err = db.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM profiles WHERE id = ? AND user_id = ?)", profileID, userID).Scan(&exists)
+			if err != nil {
+				jsonError(w, "Failed to fetch profile", http.StatusInternalServerError)
+				return
+			}
+			if !exists {
+				jsonError(w, "Profile not found", http.StatusNotFound)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithProfileID(r.Context(), profileID)))
+		})
+	}
+}
+
+// WithProfileID returns a copy of ctx working in a profile, for work done
+// outside a request such as scheduled jobs
+func WithProfileID(ctx context.Context, profileID int64) context.Context {
+	return context.WithValue(ctx, ProfileIDKey, profileID)
+}
+
+// GetProfileID returns the active profile, 0 being the default profile
+func GetProfileID(ctx context.Context) int64 {
+	profileID, _ := ctx.Value(ProfileIDKey).(int64)
+	return profileID
+}
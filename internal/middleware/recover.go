@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recover turns a panic in a handler into a JSON 500 carrying an incident
+// ID. The stack trace is logged under the same ID instead of being sent to
+// the client, so a user reporting the ID leads straight to the log entry.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// Used by net/http to abort a response on purpose
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			incident := newIncidentID()
+			log.Printf("Panic [incident %s] on %s %s: %v\n%s", incident, r.Method, r.URL.Path, rec, debug.Stack())
+
+			// Too late for a clean error if the response was already started
+			if sw.wroteHeader {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error":       "Internal server error",
+				"incident_id": incident,
+			})
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+func newIncidentID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
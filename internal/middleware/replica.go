@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/kengru/odin-wallet/pkg/database"
+)
+
+const ReplicaKey contextKey = "replica"
+
+// PrimaryHeader names the primary in answers to writes sent to a replica
+const PrimaryHeader = "X-Wallet-Primary"
+
+// ReadOnlyReplica refuses requests that write with 503 Service Unavailable
+// while this server is a LiteFS read replica, naming the primary for the
+// client or proxy to retry there. Reads are served from the replica's copy,
+// marked so the middleware that records usage on reads leaves it alone.
+func ReadOnlyReplica(replication *database.Replication) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !replication.IsPrimary() {
+				switch r.Method {
+				case http.MethodGet, http.MethodHead, http.MethodOptions:
+					r = r.WithContext(context.WithValue(r.Context(), ReplicaKey, true))
+				default:
+					if primary := replication.Primary(); primary != "" {
+						w.Header().Set(PrimaryHeader, primary)
+					}
+					w.Header().Set("Retry-After", "1")
+					jsonError(w, "This server is a read replica; send writes to the primary", http.StatusServiceUnavailable)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IsReplica reports whether a read is being served by a read replica, where
+// nothing may be written, not even last-used times and usage counters
+func IsReplica(ctx context.Context) bool {
+	replica, _ := ctx.Value(ReplicaKey).(bool)
+	return replica
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxCachedSessions bounds the session cache; when it's full, entries past
+// their TTL are swept and, failing that, the cache starts over
+const maxCachedSessions = 10000
+
+// SessionCache is a SessionStore remembering which user a session belongs
+// to for a short TTL, so Auth doesn't go to the store on every request.
+// Sessions deleted through it leave the cache at once; anything deleted
+// elsewhere, such as by another server sharing a Redis store, stays valid
+// here until its entry expires.
+type SessionCache struct {
+	store   SessionStore
+	ttl     time.Duration
+	mu      sync.RWMutex
+	entries map[string]cachedSession
+}
+
+type cachedSession struct {
+	userID      int64
+	expiresAt   time.Time // when the session itself expires
+	cachedUntil time.Time
+}
+
+// NewSessionCache creates a cache in front of store keeping sessions for
+// ttl. A zero ttl turns caching off.
+func NewSessionCache(store SessionStore, ttl time.Duration) *SessionCache {
+	return &SessionCache{store: store, ttl: ttl, entries: make(map[string]cachedSession)}
+}
+
+func (c *SessionCache) Create(ctx context.Context, s Session) error {
+	return c.store.Create(ctx, s)
+}
+
+// Get returns a session from the cache when it was seen recently
+func (c *SessionCache) Get(ctx context.Context, id string) (Session, error) {
+	if userID, expiresAt, ok := c.cached(id); ok {
+		return Session{ID: id, UserID: userID, ExpiresAt: expiresAt}, nil
+	}
+	s, err := c.store.Get(ctx, id)
+	if err != nil {
+		return s, err
+	}
+	c.put(id, s.UserID, s.ExpiresAt)
+	return s, nil
+}
+
+// Delete drops a session, on logout or when it's found expired
+func (c *SessionCache) Delete(ctx context.Context, id string) error {
+	c.mu.Lock()
+	delete(c.entries, id)
+	c.mu.Unlock()
+	return c.store.Delete(ctx, id)
+}
+
+// DeleteUser drops every session of a user, when the user is erased
+func (c *SessionCache) DeleteUser(ctx context.Context, userID int64) error {
+	c.forget(userID)
+	return c.store.DeleteUser(ctx, userID)
+}
+
+func (c *SessionCache) Prune(ctx context.Context, userID int64, keep int) (int64, error) {
+	n, err := c.store.Prune(ctx, userID, keep)
+	if n > 0 {
+		// Which ones went isn't known, so the user's other sessions are
+		// looked up again
+		c.forget(userID)
+	}
+	return n, err
+}
+
+func (c *SessionCache) DeleteExpired(ctx context.Context) (int64, error) {
+	return c.store.DeleteExpired(ctx)
+}
+
+// cached returns the user and expiry of a cached session
+func (c *SessionCache) cached(sessionID string) (userID int64, expiresAt time.Time, ok bool) {
+	if c.ttl <= 0 {
+		return 0, time.Time{}, false
+	}
+	c.mu.RLock()
+	entry, ok := c.entries[sessionID]
+	c.mu.RUnlock()
+	if !ok || time.Now().After(entry.cachedUntil) {
+		return 0, time.Time{}, false
+	}
+	return entry.userID, entry.expiresAt, true
+}
+
+// put caches a session that was just looked up
+func (c *SessionCache) put(sessionID string, userID int64, expiresAt time.Time) {
+	if c.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	cachedUntil := now.Add(c.ttl)
+	// An expired session has to reach the store to be deleted
+	if expiresAt.Before(cachedUntil) {
+		cachedUntil = expiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCachedSessions {
+		for id, entry := range c.entries {
+			if now.After(entry.cachedUntil) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= maxCachedSessions {
+			c.entries = make(map[string]cachedSession)
+		}
+	}
+	c.entries[sessionID] = cachedSession{userID: userID, expiresAt: expiresAt, cachedUntil: cachedUntil}
+}
+
+// forget drops every cached session of a user
+func (c *SessionCache) forget(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, entry := range c.entries {
+		if entry.userID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/pkg/database"
+	"github.com/kengru/odin-wallet/pkg/redis"
+)
+
+// ErrSessionNotFound is returned for a session that doesn't exist or was
+// deleted
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a signed-in browser, identified by its session_id cookie
+type Session struct {
+	ID        string
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+// SessionStore keeps sessions. SQLite is the default; Redis lets several
+// servers share them.
+type SessionStore interface {
+	Create(ctx context.Context, s Session) error
+	// Get returns ErrSessionNotFound for unknown sessions. Expired sessions
+	// may still be returned; callers check ExpiresAt.
+	Get(ctx context.Context, id string) (Session, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteUser signs a user out everywhere
+	DeleteUser(ctx context.Context, userID int64) error
+	// Prune deletes all but the newest keep sessions of a user, returning
+	// how many went
+	Prune(ctx context.Context, userID int64, keep int) (int64, error)
+	// DeleteExpired removes sessions past their expiry, for stores that
+	// don't expire them on their own
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// sessionQuery looks up a session on every authenticated request, so it runs
+// as a prepared statement
+const sessionQuery = "SELECT user_id, expires_at FROM sessions WHERE id = ?"
+
+// SQLiteSessionStore keeps sessions in the sessions table
+type SQLiteSessionStore struct {
+	db    *sql.DB
+	stmts *database.Statements
+}
+
+func NewSQLiteSessionStore(db *sql.DB, stmts *database.Statements) *SQLiteSessionStore {
+	return &SQLiteSessionStore{db: db, stmts: stmts}
+}
+
+func (s *SQLiteSessionStore) Create(ctx context.Context, session Session) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO sessions (id, user_id, expires_at) VALUES (?, ?, ?)",
+		session.ID, session.UserID, session.ExpiresAt,
+	)
+	return err
+}
+
+func (s *SQLiteSessionStore) Get(ctx context.Context, id string) (Session, error) {
+	session := Session{ID: id}
+	err := s.stmts.QueryRowContext(ctx, sessionQuery, id).Scan(&session.UserID, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return session, ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (s *SQLiteSessionStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+func (s *SQLiteSessionStore) DeleteUser(ctx context.Context, userID int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+func (s *SQLiteSessionStore) Prune(ctx context.Context, userID int64, keep int) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM sessions WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM sessions WHERE user_id = ? ORDER BY created_at DESC LIMIT ?
+		)
+	`, userID, userID, keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *SQLiteSessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	// datetime() normalizes the stored timezone offset before comparing
+	result, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE datetime(expires_at) < datetime('now')")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RedisSessionStore keeps sessions in Redis, so any server can validate
+// them. Each session is a key holding "<user id>:<expiry in unix ms>" that
+// Redis expires on its own, and each user has a sorted set of their session
+// IDs scored by expiry in unix µs, used to sign them out and prune old
+// sessions.
+type RedisSessionStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisSessionStore creates a store whose keys all start with prefix, so
+// a Redis server can be shared
+func NewRedisSessionStore(client *redis.Client, prefix string) *RedisSessionStore {
+	return &RedisSessionStore{client: client, prefix: prefix}
+}
+
+func (s *RedisSessionStore) sessionKey(id string) string {
+	return s.prefix + "session:" + id
+}
+
+func (s *RedisSessionStore) userKey(userID int64) string {
+	return s.prefix + "user_sessions:" + strconv.FormatInt(userID, 10)
+}
+
+func (s *RedisSessionStore) Create(ctx context.Context, session Session) error {
+	ttl := time.Until(session.ExpiresAt).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := strconv.FormatInt(session.ExpiresAt.UnixMilli(), 10)
+	value := strconv.FormatInt(session.UserID, 10) + ":" + expiresAt
+	if _, err := s.client.Do(ctx, "SET", s.sessionKey(session.ID), value, "PX", strconv.FormatInt(ttl, 10)); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+
+	userKey := s.userKey(session.UserID)
+	score := strconv.FormatInt(session.ExpiresAt.UnixMicro(), 10)
+	if _, err := s.client.Do(ctx, "ZADD", userKey, score, session.ID); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	// Sessions all last as long, so the set expires with the newest one
+	if _, err := s.client.Do(ctx, "PEXPIREAT", userKey, expiresAt); err != nil {
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisSessionStore) Get(ctx context.Context, id string) (Session, error) {
+	session := Session{ID: id}
+	value, err := s.client.String(ctx, "GET", s.sessionKey(id))
+	if err == redis.Nil {
+		return session, ErrSessionNotFound
+	}
+	if err != nil {
+		return session, err
+	}
+	userID, expiresAt, ok := strings.Cut(value, ":")
+	if !ok {
+		return session, fmt.Errorf("invalid session value %q", value)
+	}
+	if session.UserID, err = strconv.ParseInt(userID, 10, 64); err != nil {
+		return session, fmt.Errorf("invalid session value %q", value)
+	}
+	ms, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil {
+		return session, fmt.Errorf("invalid session value %q", value)
+	}
+	session.ExpiresAt = time.UnixMilli(ms)
+	return session, nil
+}
+
+func (s *RedisSessionStore) Delete(ctx context.Context, id string) error {
+	session, err := s.Get(ctx, id)
+	if err == ErrSessionNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.Do(ctx, "DEL", s.sessionKey(id)); err != nil {
+		return err
+	}
+	_, err = s.client.Do(ctx, "ZREM", s.userKey(session.UserID), id)
+	return err
+}
+
+func (s *RedisSessionStore) DeleteUser(ctx context.Context, userID int64) error {
+	ids, err := s.client.Strings(ctx, "ZRANGE", s.userKey(userID), "0", "-1")
+	if err != nil {
+		return err
+	}
+	keys := []string{"DEL", s.userKey(userID)}
+	for _, id := range ids {
+		keys = append(keys, s.sessionKey(id))
+	}
+	_, err = s.client.Do(ctx, keys...)
+	return err
+}
+
+func (s *RedisSessionStore) Prune(ctx context.Context, userID int64, keep int) (int64, error) {
+	userKey := s.userKey(userID)
+	// Expired sessions are already gone from Redis
+	now := strconv.FormatInt(time.Now().UnixMicro(), 10)
+	if _, err := s.client.Do(ctx, "ZREMRANGEBYSCORE", userKey, "-inf", "("+now); err != nil {
+		return 0, err
+	}
+
+	// Sessions all last as long, so the ones expiring first are the oldest
+	ids, err := s.client.Strings(ctx, "ZRANGE", userKey, "0", strconv.Itoa(-keep-1))
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	del := []string{"DEL"}
+	rem := []string{"ZREM", userKey}
+	for _, id := range ids {
+		del = append(del, s.sessionKey(id))
+		rem = append(rem, id)
+	}
+	n, err := s.client.Int(ctx, del...)
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.client.Do(ctx, rem...)
+	return n, err
+}
+
+// Ping checks Redis can be reached
+func (s *RedisSessionStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx)
+}
+
+// DeleteExpired does nothing, since Redis expires sessions itself
+func (s *RedisSessionStore) DeleteExpired(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// RedisSessionStoreFromEnv reads SESSION_STORE, REDIS_URL and REDIS_PREFIX.
+// It returns nil when sessions stay in SQLite, the default.
+func RedisSessionStoreFromEnv(getenv func(string) string) (*RedisSessionStore, error) {
+	switch store := strings.ToLower(strings.TrimSpace(getenv("SESSION_STORE"))); store {
+	case "", "sqlite":
+		return nil, nil
+	case "redis":
+		url := getenv("REDIS_URL")
+		if url == "" {
+			return nil, fmt.Errorf("REDIS_URL is required with SESSION_STORE=redis")
+		}
+		client, err := redis.ParseURL(url)
+		if err != nil {
+			return nil, err
+		}
+		prefix := getenv("REDIS_PREFIX")
+		if prefix == "" {
+			prefix = "wallet:"
+		}
+		return NewRedisSessionStore(client, prefix), nil
+	default:
+		return nil, fmt.Errorf("invalid SESSION_STORE %q (use sqlite or redis)", store)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+type timeoutKey struct{}
+
+// timeoutState lets RouteTimeout find the context before QueryTimeout's
+// deadline and take over reporting timeouts
+type timeoutState struct {
+	base     context.Context
+	replaced bool
+}
+
+// QueryTimeout puts a deadline on the request context. Handlers pass that
+// context to every query, so database work for a slow or abandoned request
+// is cancelled instead of holding a connection. A zero timeout disables it.
+func QueryTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Remember the context without the deadline so a route can
+			// replace it with its own
+			state := &timeoutState{base: r.Context()}
+			ctx := context.WithValue(r.Context(), timeoutKey{}, state)
+			if timeout <= 0 {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			serveWithDeadline(w, r.WithContext(ctx), next, state)
+		})
+	}
+}
+
+// RouteTimeout replaces the QueryTimeout deadline for a group of routes, so
+// slow endpoints like PDF reports can get more time and cheap ones less.
+// Client disconnects still cancel the request. A zero timeout removes the
+// deadline.
+func RouteTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			base := r.Context()
+			if state, ok := base.Value(timeoutKey{}).(*timeoutState); ok {
+				state.replaced = true
+				base = state.base
+			}
+			var deadline context.Context = base
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				deadline, cancel = context.WithTimeout(base, timeout)
+				defer cancel()
+			}
+			// Values set since QueryTimeout (the session's user) are kept
+			ctx := &rerootedContext{Context: deadline, values: r.Context()}
+			serveWithDeadline(w, r.WithContext(ctx), next, nil)
+		})
+	}
+}
+
+// rerootedContext takes its deadline and cancellation from one context and
+// its values from another
+type rerootedContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c *rerootedContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// serveWithDeadline answers 503 with a JSON error when the deadline passed
+// before the handler wrote anything. It stays quiet when a RouteTimeout
+// further in replaced the deadline.
+func serveWithDeadline(w http.ResponseWriter, r *http.Request, next http.Handler, state *timeoutState) {
+	sw := &statusWriter{ResponseWriter: w}
+	next.ServeHTTP(sw, r)
+	if r.Context().Err() != context.DeadlineExceeded || (state != nil && state.replaced) {
+		return
+	}
+	log.Printf("Request %s %s exceeded its deadline", r.Method, r.URL.Path)
+	if !sw.wroteHeader {
+		jsonError(w, "Request timed out", http.StatusServiceUnavailable)
+	}
+}
+
+// statusWriter records whether a response was started, and its status
+type statusWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.status = http.StatusOK
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidAccessToken = errors.New("Invalid access token")
+	ErrAccessTokenExpired = errors.New("Access token expired")
+)
+
+// NewAccessToken signs a short-lived access token for a refresh token
+// family. Access tokens aren't stored: they stay valid until they expire or
+// their family is revoked.
+func NewAccessToken(secret string, userID int64, familyID string, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%d.%s.%d", userID, familyID, expiresAt.Unix())
+	return payload + "." + signToken(secret, payload)
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// AccessTokenUser checks an access token's signature and expiry and that
+// its family hasn't been revoked, and returns the user it was issued to
+func AccessTokenUser(ctx context.Context, db *sql.DB, secret, token string) (int64, error) {
+	payload, signature, found := cutLast(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(signToken(secret, payload))) {
+		return 0, ErrInvalidAccessToken
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidAccessToken
+	}
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAccessToken
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAccessToken
+	}
+	if time.Now().Unix() >= expires {
+		return 0, ErrAccessTokenExpired
+	}
+
+	// The family is live while it has a token that hasn't been revoked;
+	// signing out or erasing the account ends it
+	var live int
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM refresh_tokens WHERE family_id = ? AND user_id = ? AND revoked_at IS NULL
+	`, parts[1], userID).Scan(&live)
+	if err != nil {
+		return 0, err
+	}
+	if live == 0 {
+		return 0, ErrInvalidAccessToken
+	}
+	return userID, nil
+}
+
+func signToken(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/pkg/tracing"
+)
+
+// Trace starts a server span for every request, continuing the caller's
+// trace when it sends a traceparent header. Spans are named after the route
+// pattern rather than the path, so requests to the same endpoint group
+// together. A nil tracer traces nothing.
+func Trace(tracer *tracing.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if tracer == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracer.Start(tracing.Extract(r.Context(), r.Header), r.Method, tracing.SpanKindServer,
+				tracing.String("http.request.method", r.Method),
+				tracing.String("url.path", r.URL.Path),
+			)
+			defer span.End()
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+
+			// The pattern is only complete once the request was routed
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				span.SetName(r.Method + " " + rctx.RoutePattern())
+				span.SetAttributes(tracing.String("http.route", rctx.RoutePattern()))
+			}
+			if !sw.wroteHeader {
+				sw.status = http.StatusOK
+			}
+			span.SetAttributes(tracing.Int("http.response.status_code", sw.status))
+			if sw.status >= 500 {
+				span.SetError(http.StatusText(sw.status))
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TrackFeature counts uses of a feature for users who opted in to local usage
+// telemetry. Counters are only stored in the instance database, and not
+// counted on read replicas. It must run after Auth.
+func TrackFeature(db *sql.DB, feature string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID, ok := GetUserID(r.Context()); ok && !IsReplica(r.Context()) {
+				now := time.Now()
+				// The insert only happens when the user has opted in
+				_, err := db.ExecContext(r.Context(), `
+					INSERT INTO feature_usage (user_id, feature, count, first_used_at, last_used_at)
+					SELECT id, ?, 1, ?, ? FROM users WHERE id = ? AND telemetry_opt_in = 1
+					ON CONFLICT(user_id, feature) DO UPDATE SET
+						count = count + 1,
+						last_used_at = excluded.last_used_at
+				`, feature, now, now, userID)
+				if err != nil {
+					log.Printf("Failed to record feature usage for %s: %v", feature, err)
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
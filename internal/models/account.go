@@ -2,7 +2,9 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
 	"time"
+	"unicode/utf8"
 )
 
 // AccountType represents the type of financial account
@@ -15,6 +17,17 @@ const (
 	AccountTypeLoan       AccountType = "loan"
 	AccountTypeSaving     AccountType = "saving"
 	AccountTypeInvestment AccountType = "investment"
+	// AccountTypeAsset is a house, car or other property. Its value changes
+	// through valuations rather than deposits and withdrawals.
+	AccountTypeAsset AccountType = "asset"
+)
+
+// AccountStatus controls whether an account accepts new spending
+type AccountStatus string
+
+const (
+	AccountStatusActive AccountStatus = "active"
+	AccountStatusFrozen AccountStatus = "frozen"
 )
 
 // Account represents a financial account
@@ -25,9 +38,21 @@ type Account struct {
 	Type      AccountType `json:"type"`
 	Color     string      `json:"color"`
 	Currency  string      `json:"currency"`
+	ProfileID int64       `json:"profile_id"`
 	CreatedAt time.Time   `json:"created_at"`
 	UpdatedAt time.Time   `json:"updated_at"`
 
+	// Frozen accounts reject new expenses and withdrawals until FrozenUntil
+	// or until unfrozen manually
+	Status       AccountStatus `json:"status"`
+	FrozenUntil  *time.Time    `json:"frozen_until,omitempty"`
+	FrozenReason string        `json:"frozen_reason,omitempty"`
+
+	// Display details so the UI can render a recognizable card
+	Icon        string `json:"icon,omitempty"`
+	Institution string `json:"institution,omitempty"`
+	Last4       string `json:"last4,omitempty"`
+
 	// Common balance field (for cash, debit, saving, investment)
 	CurrentBalance float64 `json:"current_balance"`
 
@@ -35,14 +60,22 @@ type Account struct {
 	CreditLimit *float64 `json:"credit_limit,omitempty"`
 	CreditOwed  *float64 `json:"credit_owed,omitempty"`
 	ClosingDate *int     `json:"closing_date,omitempty"` // Day of month (1-31)
+	DueDate     *int     `json:"due_date,omitempty"`     // Payment due day of month (1-31)
 
 	// Loan specific
 	LoanInitialAmount *float64 `json:"loan_initial_amount,omitempty"`
 	LoanCurrentOwed   *float64 `json:"loan_current_owed,omitempty"`
 	MonthlyPayment    *float64 `json:"monthly_payment,omitempty"`
 
-	// Saving/Investment specific
+	// Saving/Investment interest earned, or card/loan interest charged
 	YearlyInterestRate *float64 `json:"yearly_interest_rate,omitempty"`
+
+	// Display balance formatted in the user's locale
+	FormattedBalance string `json:"formatted_balance,omitempty"`
+
+	// Version is bumped on every balance write, so a write based on a stale
+	// read can be detected
+	Version int64 `json:"-"`
 }
 
 // AccountDB is used for database scanning with nullable fields
@@ -53,14 +86,23 @@ type AccountDB struct {
 	Type               string
 	Color              string
 	Currency           string
+	ProfileID          int64
 	CurrentBalance     float64
 	CreditLimit        sql.NullFloat64
 	CreditOwed         sql.NullFloat64
 	ClosingDate        sql.NullInt64
+	DueDate            sql.NullInt64
 	LoanInitialAmount  sql.NullFloat64
 	LoanCurrentOwed    sql.NullFloat64
 	MonthlyPayment     sql.NullFloat64
 	YearlyInterestRate sql.NullFloat64
+	Status             sql.NullString
+	FrozenUntil        sql.NullTime
+	FrozenReason       sql.NullString
+	Icon               sql.NullString
+	Institution        sql.NullString
+	Last4              sql.NullString
+	Version            int64
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
 }
@@ -74,7 +116,12 @@ func (a *AccountDB) ToAccount() *Account {
 		Type:           AccountType(a.Type),
 		Color:          a.Color,
 		Currency:       a.Currency,
+		ProfileID:      a.ProfileID,
 		CurrentBalance: a.CurrentBalance,
+		Icon:           a.Icon.String,
+		Institution:    a.Institution.String,
+		Last4:          a.Last4.String,
+		Version:        a.Version,
 		CreatedAt:      a.CreatedAt,
 		UpdatedAt:      a.UpdatedAt,
 	}
@@ -89,6 +136,10 @@ func (a *AccountDB) ToAccount() *Account {
 		closingDate := int(a.ClosingDate.Int64)
 		account.ClosingDate = &closingDate
 	}
+	if a.DueDate.Valid {
+		dueDate := int(a.DueDate.Int64)
+		account.DueDate = &dueDate
+	}
 	if a.LoanInitialAmount.Valid {
 		account.LoanInitialAmount = &a.LoanInitialAmount.Float64
 	}
@@ -102,9 +153,72 @@ func (a *AccountDB) ToAccount() *Account {
 		account.YearlyInterestRate = &a.YearlyInterestRate.Float64
 	}
 
+	// Freezes expire at the end of the budget period that triggered them
+	account.Status = AccountStatusActive
+	if FreezeActive(a.Status, a.FrozenUntil) {
+		account.Status = AccountStatusFrozen
+		account.FrozenReason = a.FrozenReason.String
+		if a.FrozenUntil.Valid {
+			account.FrozenUntil = &a.FrozenUntil.Time
+		}
+	}
+
 	return account
 }
 
+// FreezeActive returns true if an account with this status and freeze end
+// currently rejects new spending
+func FreezeActive(status sql.NullString, frozenUntil sql.NullTime) bool {
+	return AccountStatus(status.String) == AccountStatusFrozen &&
+		(!frozenUntil.Valid || frozenUntil.Time.After(time.Now()))
+}
+
+// IsFrozen returns true if the account currently rejects new spending
+func (a *Account) IsFrozen() bool {
+	return a.Status == AccountStatusFrozen
+}
+
+// AccountIcons are the icon names the UI knows how to draw
+var AccountIcons = []string{
+	"wallet", "bank", "cash", "credit-card", "piggy-bank", "chart",
+	"home", "car", "briefcase", "graduation-cap", "gift", "globe",
+}
+
+// MaxInstitutionLength caps the institution name shown on account cards
+const MaxInstitutionLength = 64
+
+// ValidateAccountDisplay checks the optional display fields of an account.
+// Empty values are always allowed.
+func ValidateAccountDisplay(icon, institution, last4 string) error {
+	if icon != "" {
+		known := false
+		for _, i := range AccountIcons {
+			if i == icon {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid icon %q", icon)
+		}
+	}
+	if utf8.RuneCountInString(institution) > MaxInstitutionLength {
+		return fmt.Errorf("institution must be at most %d characters", MaxInstitutionLength)
+	}
+	if last4 != "" {
+		valid := len(last4) == 4
+		for _, c := range last4 {
+			if c < '0' || c > '9' {
+				valid = false
+			}
+		}
+		if !valid {
+			return fmt.Errorf("last4 must be exactly 4 digits")
+		}
+	}
+	return nil
+}
+
 // CreateAccountRequest represents the request to create an account
 type CreateAccountRequest struct {
 	Name     string      `json:"name"`
@@ -112,6 +226,11 @@ type CreateAccountRequest struct {
 	Color    string      `json:"color"`
 	Currency string      `json:"currency"`
 
+	// Display details, all optional
+	Icon        string `json:"icon,omitempty"`
+	Institution string `json:"institution,omitempty"`
+	Last4       string `json:"last4,omitempty"`
+
 	// Initial balance for cash/debit/saving/investment
 	InitialBalance *float64 `json:"initial_balance,omitempty"`
 
@@ -119,13 +238,14 @@ type CreateAccountRequest struct {
 	CreditLimit *float64 `json:"credit_limit,omitempty"`
 	CreditOwed  *float64 `json:"credit_owed,omitempty"`
 	ClosingDate *int     `json:"closing_date,omitempty"`
+	DueDate     *int     `json:"due_date,omitempty"`
 
 	// Loan specific
 	LoanInitialAmount *float64 `json:"loan_initial_amount,omitempty"`
 	LoanCurrentOwed   *float64 `json:"loan_current_owed,omitempty"`
 	MonthlyPayment    *float64 `json:"monthly_payment,omitempty"`
 
-	// Saving/Investment specific
+	// Saving/Investment interest earned, or card/loan interest charged
 	YearlyInterestRate *float64 `json:"yearly_interest_rate,omitempty"`
 }
 
@@ -135,16 +255,54 @@ type UpdateAccountRequest struct {
 	Color    *string `json:"color,omitempty"`
 	Currency *string `json:"currency,omitempty"`
 
+	// Display details; an empty string clears the field
+	Icon        *string `json:"icon,omitempty"`
+	Institution *string `json:"institution,omitempty"`
+	Last4       *string `json:"last4,omitempty"`
+
 	// Type-specific updates
 	CurrentBalance     *float64 `json:"current_balance,omitempty"`
 	CreditLimit        *float64 `json:"credit_limit,omitempty"`
 	CreditOwed         *float64 `json:"credit_owed,omitempty"`
 	ClosingDate        *int     `json:"closing_date,omitempty"`
+	DueDate            *int     `json:"due_date,omitempty"`
 	LoanCurrentOwed    *float64 `json:"loan_current_owed,omitempty"`
 	MonthlyPayment     *float64 `json:"monthly_payment,omitempty"`
 	YearlyInterestRate *float64 `json:"yearly_interest_rate,omitempty"`
 }
 
+// ConvertAccountRequest changes an account's type. Fields the new type has
+// and the old one didn't can be set; the rest carry over.
+type ConvertAccountRequest struct {
+	Type AccountType `json:"type"`
+
+	// Credit card fields, for a loan becoming a card
+	CreditLimit *float64 `json:"credit_limit,omitempty"`
+	ClosingDate *int     `json:"closing_date,omitempty"`
+	DueDate     *int     `json:"due_date,omitempty"`
+
+	// Loan fields, for a card becoming a loan; the initial amount defaults
+	// to what's owed
+	LoanInitialAmount *float64 `json:"loan_initial_amount,omitempty"`
+	MonthlyPayment    *float64 `json:"monthly_payment,omitempty"`
+
+	// Interest for a cash or debit account becoming a savings or investment
+	// account; other conversions keep the rate they have
+	YearlyInterestRate *float64 `json:"yearly_interest_rate,omitempty"`
+}
+
+// CanConvertTo reports whether an account can change to another type
+// without rewriting its history: between the types holding a balance, or
+// between the types owing one. Assets aren't converted, since their value
+// comes from valuations.
+func (a *Account) CanConvertTo(to AccountType) bool {
+	if a.Type == to || a.Type == AccountTypeAsset || to == AccountTypeAsset {
+		return false
+	}
+	target := Account{Type: to}
+	return a.IsAssetAccount() == target.IsAssetAccount() && a.IsLiabilityAccount() == target.IsLiabilityAccount()
+}
+
 // FinancialOverview represents the user's financial summary
 type FinancialOverview struct {
 	TotalAssets       float64            `json:"total_assets"`
@@ -153,12 +311,58 @@ type FinancialOverview struct {
 	BaseCurrency      string             `json:"base_currency"`
 	AssetsByType      map[string]float64 `json:"assets_by_type"`
 	LiabilitiesByType map[string]float64 `json:"liabilities_by_type"`
+	// Assets split by how quickly they can be spent: liquid is cash, debit
+	// and savings, illiquid is investments and property
+	LiquidAssets   float64 `json:"liquid_assets"`
+	IlliquidAssets float64 `json:"illiquid_assets"`
+	// Percent of the assets that are liquid, nil when there are no assets
+	LiquidityRatio *float64 `json:"liquidity_ratio,omitempty"`
+	// Each account's part in the totals, largest first
+	Accounts []AccountContribution `json:"accounts"`
+	// Set when the user's custom exchange rates were used for conversions
+	CustomRates bool `json:"custom_rates,omitempty"`
+	// Totals formatted in the user's locale, keyed like the fields above
+	Formatted map[string]string `json:"formatted"`
+	// Bills that are overdue or due in the next two weeks
+	UpcomingBills []UpcomingBill `json:"upcoming_bills"`
+}
+
+// Groups an account's balance counts toward in the overview
+const (
+	ContributionLiquid    = "liquid"
+	ContributionIlliquid  = "illiquid"
+	ContributionLiability = "liability"
+)
+
+// AccountContribution is one account's part in the financial overview.
+// Share is its percent of the total assets, or of the total liabilities for
+// liability accounts.
+type AccountContribution struct {
+	AccountID int64       `json:"account_id"`
+	Name      string      `json:"name"`
+	Type      AccountType `json:"type"`
+	Group     string      `json:"group"`
+	Currency  string      `json:"currency"`
+	Balance   float64     `json:"balance"`
+	Converted float64     `json:"converted"` // in the base currency
+	Share     float64     `json:"share"`
 }
 
 // IsAssetAccount returns true if this account type is an asset
 func (a *Account) IsAssetAccount() bool {
 	switch a.Type {
-	case AccountTypeCash, AccountTypeDebit, AccountTypeSaving, AccountTypeInvestment:
+	case AccountTypeCash, AccountTypeDebit, AccountTypeSaving, AccountTypeInvestment, AccountTypeAsset:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsLiquidAccount returns true if this account's balance can be spent right
+// away, unlike investments and property that have to be sold first
+func (a *Account) IsLiquidAccount() bool {
+	switch a.Type {
+	case AccountTypeCash, AccountTypeDebit, AccountTypeSaving:
 		return true
 	default:
 		return false
@@ -210,3 +414,45 @@ func (a *Account) GetLiabilityAmount() float64 {
 		return 0
 	}
 }
+
+// MaxSnapshotNoteLength caps the note stored with an account snapshot
+const MaxSnapshotNoteLength = 500
+
+// AccountSnapshot is an account's balances and limits as captured at a point
+// in time, e.g. before a major life event or at a fiscal-year boundary
+type AccountSnapshot struct {
+	ID                 int64       `json:"id"`
+	AccountID          int64       `json:"account_id"`
+	Note               string      `json:"note,omitempty"`
+	Name               string      `json:"name"`
+	Type               AccountType `json:"type"`
+	Currency           string      `json:"currency"`
+	CurrentBalance     float64     `json:"current_balance"`
+	CreditLimit        *float64    `json:"credit_limit,omitempty"`
+	CreditOwed         *float64    `json:"credit_owed,omitempty"`
+	LoanInitialAmount  *float64    `json:"loan_initial_amount,omitempty"`
+	LoanCurrentOwed    *float64    `json:"loan_current_owed,omitempty"`
+	MonthlyPayment     *float64    `json:"monthly_payment,omitempty"`
+	YearlyInterestRate *float64    `json:"yearly_interest_rate,omitempty"`
+	Status             string      `json:"status"`
+	CreatedAt          time.Time   `json:"created_at"`
+}
+
+// CreateSnapshotRequest captures an account snapshot
+type CreateSnapshotRequest struct {
+	Note string `json:"note"`
+}
+
+// AccountBalance is an account's balance at a past date, rebuilt from its
+// transaction history. Liabilities show the amount owed. Open is false when
+// the account didn't exist yet.
+type AccountBalance struct {
+	AccountID        int64       `json:"account_id"`
+	Name             string      `json:"name"`
+	Type             AccountType `json:"type"`
+	Currency         string      `json:"currency"`
+	AsOf             string      `json:"as_of"` // YYYY-MM-DD for the end of a day, RFC 3339 otherwise
+	Open             bool        `json:"open"`
+	Balance          float64     `json:"balance"`
+	FormattedBalance string      `json:"formatted_balance"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// AdvisorAccount is an account shared with an advisor
+type AdvisorAccount struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// AdvisorGrant gives another user, such as a financial advisor or an
+// accountant, read-only access to some of a user's accounts and optionally
+// their reports
+type AdvisorGrant struct {
+	ID           int64            `json:"id"`
+	AdvisorID    int64            `json:"advisor_id"`
+	AdvisorEmail string           `json:"advisor_email"`
+	AdvisorName  string           `json:"advisor_name,omitempty"`
+	Accounts     []AdvisorAccount `json:"accounts"`
+	Reports      bool             `json:"reports"`
+	LastUsedAt   *time.Time       `json:"last_used_at,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// AdvisorClient is a user who has shared their finances with the current
+// user. OwnerID goes in the X-Advisor-For header to view them.
+type AdvisorClient struct {
+	GrantID    int64            `json:"grant_id"`
+	OwnerID    int64            `json:"owner_id"`
+	OwnerEmail string           `json:"owner_email"`
+	OwnerName  string           `json:"owner_name,omitempty"`
+	Accounts   []AdvisorAccount `json:"accounts"`
+	Reports    bool             `json:"reports"`
+}
+
+// AdvisorGrantRequest shares accounts and reports with the user registered
+// with Email, replacing what was shared with them before
+type AdvisorGrantRequest struct {
+	Email      string  `json:"email"`
+	AccountIDs []int64 `json:"account_ids"`
+	Reports    bool    `json:"reports"`
+}
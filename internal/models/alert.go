@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// AlertDirection says which side of the threshold triggers a balance alert
+type AlertDirection string
+
+const (
+	AlertBelow AlertDirection = "below"
+	AlertAbove AlertDirection = "above"
+)
+
+// IsValid returns true if this is a known alert direction
+func (d AlertDirection) IsValid() bool {
+	return d == AlertBelow || d == AlertAbove
+}
+
+// Breached reports whether balance is on the alerting side of threshold
+func (d AlertDirection) Breached(balance, threshold float64) bool {
+	if d == AlertAbove {
+		return balance > threshold
+	}
+	return balance < threshold
+}
+
+// BalanceAlert notifies the user when an account's balance crosses a
+// threshold: below it for checking accounts running low, or above it for
+// credit owed growing too large. The balance is the amount owed for credit
+// cards and loans. An alert fires once per crossing and re-arms when the
+// balance recovers.
+type BalanceAlert struct {
+	ID        int64          `json:"id"`
+	AccountID int64          `json:"account_id"`
+	Direction AlertDirection `json:"direction"`
+	Threshold float64        `json:"threshold"`
+	Triggered bool           `json:"triggered"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// CreateBalanceAlertRequest adds a balance alert to an account
+type CreateBalanceAlertRequest struct {
+	Direction AlertDirection `json:"direction"`
+	Threshold float64        `json:"threshold"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// AnnouncementKind says what an announcement is about
+type AnnouncementKind string
+
+const (
+	AnnouncementMaintenance AnnouncementKind = "maintenance"
+	AnnouncementFeature     AnnouncementKind = "feature"
+	AnnouncementGeneral     AnnouncementKind = "general"
+)
+
+// IsValid checks if the announcement kind is known
+func (k AnnouncementKind) IsValid() bool {
+	switch k {
+	case AnnouncementMaintenance, AnnouncementFeature, AnnouncementGeneral:
+		return true
+	}
+	return false
+}
+
+// Limits on announcement text
+const (
+	MaxAnnouncementTitleLength   = 120
+	MaxAnnouncementMessageLength = 2000
+)
+
+// Announcement is a message an admin broadcast to every user's
+// notification feed. Recipients and Acknowledged count the users it reached
+// and those who dismissed it.
+type Announcement struct {
+	ID           int64            `json:"id"`
+	Kind         AnnouncementKind `json:"kind"`
+	Title        string           `json:"title"`
+	Message      string           `json:"message"`
+	CreatedBy    *int64           `json:"created_by,omitempty"`
+	Recipients   int              `json:"recipients"`
+	Acknowledged int              `json:"acknowledged"`
+	CreatedAt    time.Time        `json:"created_at"`
+}
+
+// CreateAnnouncementRequest broadcasts an announcement. Kind defaults to
+// general.
+type CreateAnnouncementRequest struct {
+	Kind    AnnouncementKind `json:"kind"`
+	Title   string           `json:"title"`
+	Message string           `json:"message"`
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ValuationSource tells how an asset valuation was made
+type ValuationSource string
+
+const (
+	ValuationManual       ValuationSource = "manual"
+	ValuationDepreciation ValuationSource = "depreciation"
+)
+
+// AssetValuation is one entry in an asset account's valuation history. Each
+// one is mirrored by a revalue transaction so the ledger adds up to the
+// account's value.
+type AssetValuation struct {
+	ID            int64           `json:"id"`
+	AccountID     int64           `json:"account_id"`
+	Value         float64         `json:"value"`
+	Change        float64         `json:"change"`
+	Source        ValuationSource `json:"source"`
+	Note          string          `json:"note,omitempty"`
+	TransactionID *int64          `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// ValuationRequest records a manual valuation of an asset
+type ValuationRequest struct {
+	Value float64 `json:"value"`
+	Note  string  `json:"note,omitempty"`
+}
+
+// DepreciationMethod selects how an asset loses value over time
+type DepreciationMethod string
+
+const (
+	// DepreciationStraightLine takes the same amount every month: the yearly
+	// rate of the value the schedule started from
+	DepreciationStraightLine DepreciationMethod = "straight_line"
+	// DepreciationDecliningBalance takes the yearly rate of the current
+	// value, so the monthly amount shrinks as the asset ages
+	DepreciationDecliningBalance DepreciationMethod = "declining_balance"
+)
+
+// DepreciationSchedule lowers an asset's value once a month until it
+// reaches the salvage value
+type DepreciationSchedule struct {
+	AccountID     int64              `json:"account_id"`
+	Method        DepreciationMethod `json:"method"`
+	YearlyRate    float64            `json:"yearly_rate"`
+	SalvageValue  float64            `json:"salvage_value"`
+	BaseValue     float64            `json:"base_value"`
+	LastAppliedAt time.Time          `json:"last_applied_at"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// DepreciationRequest sets an asset's depreciation schedule. YearlyRate is a
+// percentage of the value per year.
+type DepreciationRequest struct {
+	Method       DepreciationMethod `json:"method"`
+	YearlyRate   float64            `json:"yearly_rate"`
+	SalvageValue float64            `json:"salvage_value"`
+}
+
+// Validate checks a depreciation request, defaulting the method to
+// straight line
+func (r *DepreciationRequest) Validate() error {
+	if r.Method == "" {
+		r.Method = DepreciationStraightLine
+	}
+	if r.Method != DepreciationStraightLine && r.Method != DepreciationDecliningBalance {
+		return errors.New("method must be straight_line or declining_balance")
+	}
+	if r.YearlyRate <= 0 || r.YearlyRate > 100 {
+		return errors.New("yearly_rate must be between 0 and 100")
+	}
+	if r.SalvageValue < 0 {
+		return errors.New("salvage_value cannot be negative")
+	}
+	return nil
+}
+
+// AssetHistory is an asset's valuation history, newest first, along with its
+// depreciation schedule if it has one
+type AssetHistory struct {
+	AccountID    int64                 `json:"account_id"`
+	Currency     string                `json:"currency"`
+	Value        float64               `json:"value"`
+	Depreciation *DepreciationSchedule `json:"depreciation,omitempty"`
+	Valuations   []AssetValuation      `json:"valuations"`
+}
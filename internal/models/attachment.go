@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// MaxAttachmentSize caps uploaded receipt files
+const MaxAttachmentSize = 5 << 20
+
+// AttachmentContentTypes lists the file types accepted as attachments
+var AttachmentContentTypes = []string{"image/jpeg", "image/png", "image/webp", "image/gif", "application/pdf"}
+
+// Attachment is a file, usually a receipt photo, uploaded by a user and
+// optionally linked to a transaction
+type Attachment struct {
+	ID            int64     `json:"id"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	Filename      string    `json:"filename"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ParseReceiptRequest optionally names the account the receipt was paid
+// from, so the proposed transaction gets the right type
+type ParseReceiptRequest struct {
+	AccountID *int64 `json:"account_id,omitempty"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Activity types, the kinds of events in the audit log
+const (
+	ActivityTransaction = "transaction"
+	ActivityAccount     = "account"
+	ActivityBudget      = "budget"
+	ActivityLogin       = "login"
+	ActivityBill        = "bill"
+	ActivityProfile     = "profile"
+	ActivityAdvisor     = "advisor"
+	ActivityPeriod      = "period"
+	ActivityCreditScore = "credit_score"
+	ActivityInsurance   = "insurance"
+)
+
+// ActivityTypes lists every activity type, for validating filters
+var ActivityTypes = []string{ActivityTransaction, ActivityAccount, ActivityBudget, ActivityLogin, ActivityBill, ActivityProfile, ActivityAdvisor, ActivityPeriod, ActivityCreditScore, ActivityInsurance}
+
+// AuditEvent is one entry in a user's audit log
+type AuditEvent struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"-"`
+	Type     string `json:"type"`
+	Action   string `json:"action"`
+	EntityID *int64 `json:"entity_id,omitempty"`
+	// Summary describes the event for display. It never includes
+	// transaction descriptions or notes, which may be encrypted at rest.
+	Summary   string                 `json:"summary"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	IPAddress string                 `json:"ip_address,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// ActivityResponse is a page of the activity feed, newest first. Pass
+// next_before as before to get the following page.
+type ActivityResponse struct {
+	Events     []AuditEvent `json:"events"`
+	NextBefore *int64       `json:"next_before,omitempty"`
+}
+
+// ExportedAuditEvent is an audit event as streamed to an external sink. The
+// ID only grows, so receivers can drop events delivered twice.
+type ExportedAuditEvent struct {
+	ID        int64           `json:"id"`
+	UserID    int64           `json:"user_id"`
+	UserEmail string          `json:"user_email,omitempty"`
+	Type      string          `json:"type"`
+	Action    string          `json:"action"`
+	EntityID  *int64          `json:"entity_id,omitempty"`
+	Summary   string          `json:"summary"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	IPAddress string          `json:"ip_address,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// AuditSinkStatus is how far an audit export sink has got
+type AuditSinkStatus struct {
+	Sink string `json:"sink"`
+	// LastID is the last event delivered
+	LastID int64 `json:"last_id"`
+	// Pending counts the events waiting to be delivered
+	Pending       int64      `json:"pending"`
+	Failures      int        `json:"failures"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
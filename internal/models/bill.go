@@ -0,0 +1,87 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxBillNameLength caps bill names
+const MaxBillNameLength = 64
+
+// Bill is a recurring monthly payment, such as rent or a phone plan, paid
+// from one of the user's accounts. NextDueDate moves forward a month each
+// time the bill is paid, so a bill is overdue while it is in the past.
+// Autopay bills are paid from their account automatically on the due date.
+type Bill struct {
+	ID          int64               `json:"id"`
+	AccountID   int64               `json:"account_id"`
+	AccountName string              `json:"account_name,omitempty"`
+	Name        string              `json:"name"`
+	Amount      float64             `json:"amount"`
+	Currency    string              `json:"currency"`
+	DueDay      int                 `json:"due_day"` // 1-31, the last day in shorter months
+	Category    TransactionCategory `json:"category"`
+	Autopay     bool                `json:"autopay"`
+	NextDueDate time.Time           `json:"next_due_date"`
+	Overdue     bool                `json:"overdue"`
+	LastPaidAt  *time.Time          `json:"last_paid_at,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// BillPayment records a bill being paid for one due date, along with the
+// transaction that paid it when one was created
+type BillPayment struct {
+	ID            int64     `json:"id"`
+	BillID        int64     `json:"bill_id"`
+	DueDate       time.Time `json:"due_date"`
+	Amount        float64   `json:"amount"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	PaidAt        time.Time `json:"paid_at"`
+}
+
+// BillRequest creates or updates a bill. On update, omitted fields are left
+// unchanged.
+type BillRequest struct {
+	Name      *string              `json:"name,omitempty"`
+	Amount    *float64             `json:"amount,omitempty"`
+	DueDay    *int                 `json:"due_day,omitempty"`
+	AccountID *int64               `json:"account_id,omitempty"`
+	Category  *TransactionCategory `json:"category,omitempty"`
+	Autopay   *bool                `json:"autopay,omitempty"`
+}
+
+// PayBillRequest marks a bill paid for its current due date. Amount
+// defaults to the bill's amount. With CreateTransaction set, the payment is
+// also recorded as a transaction on the bill's account.
+type PayBillRequest struct {
+	Amount            *float64 `json:"amount,omitempty"`
+	CreateTransaction bool     `json:"create_transaction"`
+}
+
+// UpcomingBill is a bill due soon, or overdue, as shown in the overview
+type UpcomingBill struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	Amount          float64   `json:"amount"`
+	Currency        string    `json:"currency"`
+	FormattedAmount string    `json:"formatted_amount"`
+	DueDate         time.Time `json:"due_date"`
+	Autopay         bool      `json:"autopay"`
+	Overdue         bool      `json:"overdue"`
+}
+
+// ValidateBillName trims and checks a bill name
+func ValidateBillName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxBillNameLength {
+		return "", fmt.Errorf("name must be at most %d characters", MaxBillNameLength)
+	}
+	return name, nil
+}
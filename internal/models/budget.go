@@ -2,18 +2,171 @@ package models
 
 import "time"
 
-// CategoryBudget represents a monthly spending limit for a category
+// BudgetPeriod is the length of time a budget limit applies to
+type BudgetPeriod string
+
+const (
+	BudgetPeriodWeekly    BudgetPeriod = "weekly"
+	BudgetPeriodMonthly   BudgetPeriod = "monthly"
+	BudgetPeriodQuarterly BudgetPeriod = "quarterly"
+	BudgetPeriodYearly    BudgetPeriod = "yearly"
+)
+
+// IsValid returns true if this is a known budget period
+func (p BudgetPeriod) IsValid() bool {
+	switch p {
+	case BudgetPeriodWeekly, BudgetPeriodMonthly, BudgetPeriodQuarterly, BudgetPeriodYearly:
+		return true
+	default:
+		return false
+	}
+}
+
+// Bounds returns the start of the period containing t and the start of the
+// following period. Weeks start on Sunday, matching weekly reports.
+func (p BudgetPeriod) Bounds(t time.Time) (time.Time, time.Time) {
+	switch p {
+	case BudgetPeriodWeekly:
+		start := time.Date(t.Year(), t.Month(), t.Day()-int(t.Weekday()), 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 0, 7)
+	case BudgetPeriodQuarterly:
+		month := time.Month((int(t.Month())-1)/3*3 + 1)
+		start := time.Date(t.Year(), month, 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 3, 0)
+	case BudgetPeriodYearly:
+		start := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+// CategoryBudget represents a spending limit for a category. MonthlyLimit is
+// the limit per budget period; the name is kept for API compatibility.
 type CategoryBudget struct {
-	ID           int64     `json:"id"`
-	UserID       int64     `json:"user_id"`
-	Category     string    `json:"category"`
-	MonthlyLimit float64   `json:"monthly_limit"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int64        `json:"id"`
+	UserID       int64        `json:"user_id"`
+	Category     string       `json:"category"`
+	MonthlyLimit float64      `json:"monthly_limit"`
+	Period       BudgetPeriod `json:"period"`
+	Rollover     bool         `json:"rollover"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+
+	// FreezeAccountID is frozen for the rest of the period when the budget
+	// is exceeded
+	FreezeAccountID *int64 `json:"freeze_account_id,omitempty"`
 }
 
-// SetBudgetRequest represents the request to set a category budget
+// SetBudgetRequest represents the request to set a category budget. Period
+// defaults to monthly. EffectiveFrom (YYYY-MM-DD) backdates the change and
+// defaults to now.
 type SetBudgetRequest struct {
-	Category     string  `json:"category"`
+	Category      string       `json:"category"`
+	MonthlyLimit  float64      `json:"monthly_limit"`
+	Period        BudgetPeriod `json:"period,omitempty"`
+	Rollover      bool         `json:"rollover"`
+	EffectiveFrom string       `json:"effective_from,omitempty"`
+
+	// FreezeAccountID optionally names an account to freeze when the budget
+	// is exceeded
+	FreezeAccountID *int64 `json:"freeze_account_id,omitempty"`
+}
+
+// BudgetVersion is a category budget as it was set from EffectiveFrom until
+// the next version. Deleted versions mark when the budget was removed.
+type BudgetVersion struct {
+	ID            int64        `json:"id"`
+	Category      string       `json:"category"`
+	MonthlyLimit  float64      `json:"monthly_limit"`
+	Period        BudgetPeriod `json:"period"`
+	Rollover      bool         `json:"rollover"`
+	Deleted       bool         `json:"deleted"`
+	EffectiveFrom time.Time    `json:"effective_from"`
+	EffectiveTo   *time.Time   `json:"effective_to,omitempty"`
+}
+
+// BudgetProgress is a budget's state for a single period
+type BudgetProgress struct {
+	CategoryBudget
+	PeriodStart string  `json:"period_start"`
+	PeriodEnd   string  `json:"period_end"`
+	CarriedOver float64 `json:"carried_over"`
+	Available   float64 `json:"available"`
+	Spent       float64 `json:"spent"`
+	Remaining   float64 `json:"remaining"`
+	Percentage  float64 `json:"percentage"`
+	Currency    string  `json:"currency"`
+}
+
+// TotalBudgetProgress is spending against the user's overall monthly cap
+type TotalBudgetProgress struct {
+	MonthlyLimit   float64 `json:"monthly_limit"`
+	PeriodStart    string  `json:"period_start"`
+	PeriodEnd      string  `json:"period_end"`
+	Spent          float64 `json:"spent"`
+	Remaining      float64 `json:"remaining"`
+	Percentage     float64 `json:"percentage"`
+	DaysRemaining  int     `json:"days_remaining"`
+	DailyAllowance float64 `json:"daily_allowance"`
+	Currency       string  `json:"currency"`
+}
+
+// SetTotalBudgetRequest represents the request to set the overall monthly cap
+type SetTotalBudgetRequest struct {
 	MonthlyLimit float64 `json:"monthly_limit"`
 }
+
+// BudgetMode is how a user budgets. In zero-based mode every unit of a
+// month's income is given a job by allocating it to a spending category or
+// an envelope.
+type BudgetMode string
+
+const (
+	BudgetModeStandard  BudgetMode = "standard"
+	BudgetModeZeroBased BudgetMode = "zero_based"
+)
+
+// IsValid returns true if this is a known budget mode
+func (m BudgetMode) IsValid() bool {
+	return m == BudgetModeStandard || m == BudgetModeZeroBased
+}
+
+// BudgetAllocation gives part of a month's income to a spending category or
+// to an envelope saving toward a goal; exactly one of them is set. Amounts
+// are in the user's preferred currency.
+type BudgetAllocation struct {
+	ID         int64     `json:"id"`
+	Month      string    `json:"month"` // YYYY-MM
+	Category   string    `json:"category,omitempty"`
+	EnvelopeID *int64    `json:"envelope_id,omitempty"`
+	Label      string    `json:"label"`
+	Amount     float64   `json:"amount"`
+	Spent      *float64  `json:"spent,omitempty"` // category allocations only
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ZeroBasedBudget is a month's income and how it has been allocated.
+// RemainingToAllocate is what still needs a job; it's negative when more
+// was allocated than was earned.
+type ZeroBasedBudget struct {
+	Month               string             `json:"month"`
+	Currency            string             `json:"currency"`
+	Income              float64            `json:"income"`
+	Allocated           float64            `json:"allocated"`
+	RemainingToAllocate float64            `json:"remaining_to_allocate"`
+	Allocations         []BudgetAllocation `json:"allocations"`
+	Warnings            []string           `json:"warnings"`
+}
+
+// SetAllocationRequest allocates an amount to a category or an envelope for
+// a month (YYYY-MM, the current month by default). An amount of 0 removes
+// the allocation.
+type SetAllocationRequest struct {
+	Month      string  `json:"month,omitempty"`
+	Category   string  `json:"category,omitempty"`
+	EnvelopeID *int64  `json:"envelope_id,omitempty"`
+	Amount     float64 `json:"amount"`
+}
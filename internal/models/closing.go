@@ -0,0 +1,17 @@
+package models
+
+// PeriodClosing is how far a user's books are closed. Transactions dated
+// before OpenFrom can't be edited until their month is reopened. Balances
+// are every account's closing balance on ClosedThrough, for checking against
+// bank statements.
+type PeriodClosing struct {
+	ClosedThrough *string          `json:"closed_through"` // last closed day, YYYY-MM-DD
+	OpenFrom      *string          `json:"open_from"`      // first open day, YYYY-MM-DD
+	Balances      []AccountBalance `json:"balances,omitempty"`
+}
+
+// ClosePeriodRequest names a financial month, YYYY-MM. Closing it closes
+// every month before it too; reopening it reopens every month after it.
+type ClosePeriodRequest struct {
+	Month string `json:"month"`
+}
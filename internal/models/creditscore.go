@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Credit scores are entered by hand from a bureau's report. Bureaus use
+// different scales, so any score in this range is accepted.
+const (
+	MinCreditScore = 0
+	MaxCreditScore = 1000
+
+	MaxCreditBureauLength    = 64
+	MaxCreditScoreNoteLength = 500
+)
+
+// CreditScoreReminderMonths is how old the latest score can get before users
+// with reminders on are asked to record a new one
+const CreditScoreReminderMonths = 3
+
+// CreditScore is a score the user looked up on RecordedOn
+type CreditScore struct {
+	ID         int64     `json:"id"`
+	Score      int       `json:"score"`
+	Bureau     string    `json:"bureau,omitempty"`
+	RecordedOn string    `json:"recorded_on"` // YYYY-MM-DD
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreditScoreRequest records a score. RecordedOn (YYYY-MM-DD) defaults to
+// today.
+type CreditScoreRequest struct {
+	Score      *int   `json:"score"`
+	Bureau     string `json:"bureau,omitempty"`
+	RecordedOn string `json:"recorded_on,omitempty"`
+	Note       string `json:"note,omitempty"`
+}
+
+// CreditScorePoint is one score in a chart series
+type CreditScorePoint struct {
+	Date  string `json:"date"`
+	Score int    `json:"score"`
+}
+
+// CreditScoreSeries is one bureau's scores, oldest first. Change is the
+// difference between the latest score and the one before it.
+type CreditScoreSeries struct {
+	Bureau string             `json:"bureau"`
+	Points []CreditScorePoint `json:"points"`
+	Latest int                `json:"latest"`
+	Change *int               `json:"change,omitempty"`
+}
+
+// CreditScoreHistory is the user's recorded scores, newest first, with a
+// series per bureau for charting
+type CreditScoreHistory struct {
+	Scores    []CreditScore       `json:"scores"`
+	Series    []CreditScoreSeries `json:"series"`
+	Reminders bool                `json:"reminders"`
+}
+
+// CreditScoreRemindersRequest turns quarterly credit score reminders on or
+// off
+type CreditScoreRemindersRequest struct {
+	Enabled bool `json:"enabled"`
+}
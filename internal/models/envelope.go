@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxEnvelopeNameLength caps envelope names
+const MaxEnvelopeNameLength = 64
+
+// Envelope is a named portion of an asset account's balance set aside for a
+// goal, so one bank account can back several sinking funds. Its balance is
+// the sum of its allocations.
+type Envelope struct {
+	ID           int64     `json:"id"`
+	AccountID    int64     `json:"account_id"`
+	Name         string    `json:"name"`
+	TargetAmount *float64  `json:"target_amount,omitempty"`
+	Balance      float64   `json:"balance"`
+	Progress     *float64  `json:"progress,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// EnvelopeAllocation moves money into (positive) or out of (negative) an
+// envelope, optionally against the transaction that funded or spent it
+type EnvelopeAllocation struct {
+	ID            int64     `json:"id"`
+	EnvelopeID    int64     `json:"envelope_id"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	Amount        float64   `json:"amount"`
+	Note          string    `json:"note,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// EnvelopeSummary is an account's envelopes along with the part of its
+// balance no envelope claims
+type EnvelopeSummary struct {
+	AccountID   int64      `json:"account_id"`
+	Currency    string     `json:"currency"`
+	Balance     float64    `json:"balance"`
+	Allocated   float64    `json:"allocated"`
+	Unallocated float64    `json:"unallocated"`
+	Envelopes   []Envelope `json:"envelopes"`
+}
+
+// EnvelopeRequest creates or updates an envelope. On update, omitted fields
+// are left unchanged and a target of 0 removes the target.
+type EnvelopeRequest struct {
+	Name         *string  `json:"name,omitempty"`
+	TargetAmount *float64 `json:"target_amount,omitempty"`
+}
+
+// AllocateRequest records an allocation against an envelope
+type AllocateRequest struct {
+	Amount        float64 `json:"amount"`
+	TransactionID *int64  `json:"transaction_id,omitempty"`
+	Note          string  `json:"note,omitempty"`
+}
+
+// ValidateEnvelopeName trims and checks an envelope name
+func ValidateEnvelopeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxEnvelopeNameLength {
+		return "", fmt.Errorf("name must be at most %d characters", MaxEnvelopeNameLength)
+	}
+	return name, nil
+}
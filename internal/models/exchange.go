@@ -0,0 +1,53 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// CustomExchangeRate is a rate entered by a user, such as a bank's or an
+// informal market's, used instead of the fetched rate in their conversions
+type CustomExchangeRate struct {
+	Base      string    `json:"base"`
+	Target    string    `json:"target"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetCustomRateRequest pins a rate: one Base is worth Rate Target
+type SetCustomRateRequest struct {
+	Base   string  `json:"base"`
+	Target string  `json:"target"`
+	Rate   float64 `json:"rate"`
+}
+
+// Normalize upper-cases the currency codes and validates the request
+func (r *SetCustomRateRequest) Normalize() error {
+	r.Base = strings.ToUpper(strings.TrimSpace(r.Base))
+	r.Target = strings.ToUpper(strings.TrimSpace(r.Target))
+	if !IsCurrencyCode(r.Base) || !IsCurrencyCode(r.Target) {
+		return fmt.Errorf("base and target must be 3-letter currency codes")
+	}
+	if r.Base == r.Target {
+		return fmt.Errorf("base and target must be different currencies")
+	}
+	if r.Rate <= 0 || math.IsInf(r.Rate, 0) || math.IsNaN(r.Rate) {
+		return fmt.Errorf("rate must be positive")
+	}
+	return nil
+}
+
+// IsCurrencyCode reports whether s looks like an ISO 4217 code such as USD
+func IsCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Feature names an optional subsystem that can be switched on or off for a
+// whole deployment (FEATURE_FLAGS) or for single users, without a separate
+// build
+type Feature string
+
+const (
+	// FeatureBankFeeds is balances pushed by banks and scripts
+	FeatureBankFeeds Feature = "bank_feeds"
+	// FeatureIntegrations is integration keys and the automation API and
+	// quick add they authenticate
+	FeatureIntegrations Feature = "integrations"
+	// FeatureTelegram is quick entry over Telegram
+	FeatureTelegram Feature = "telegram"
+)
+
+// Features lists every known feature flag
+var Features = []Feature{FeatureBankFeeds, FeatureIntegrations, FeatureTelegram}
+
+// onByDefault are the released features, which everyone gets unless
+// FEATURE_FLAGS or an override turns them off. Experimental features start
+// off.
+var onByDefault = map[Feature]bool{FeatureBankFeeds: true, FeatureIntegrations: true, FeatureTelegram: true}
+
+// OnByDefault reports whether f is on when FEATURE_FLAGS doesn't set it
+func (f Feature) OnByDefault() bool {
+	return onByDefault[f]
+}
+
+// IsValid reports whether f is a known feature flag
+func (f Feature) IsValid() bool {
+	for _, known := range Features {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+// FeatureOverride turns a feature on or off for one user, whatever the
+// deployment default
+type FeatureOverride struct {
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	Feature   Feature   `json:"feature"`
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FeatureFlagsResponse is the admin view of the flags: the deployment
+// defaults and every per-user override
+type FeatureFlagsResponse struct {
+	Defaults  map[Feature]bool  `json:"defaults"`
+	Overrides []FeatureOverride `json:"overrides"`
+}
+
+// SetFeatureOverrideRequest turns a feature on or off for a user
+type SetFeatureOverrideRequest struct {
+	Enabled bool `json:"enabled"`
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is used for users who haven't chosen one
+const DefaultLocale = "en-US"
+
+// Languages the API's messages and labels are translated to. English is
+// the source; other languages fall back to it for anything missing.
+const (
+	LanguageEnglish = "en"
+	LanguageSpanish = "es"
+)
+
+// Language returns the language of a locale such as "es-DO"
+func Language(locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(locale)), "-")
+	if lang == LanguageSpanish {
+		return LanguageSpanish
+	}
+	return LanguageEnglish
+}
+
+// localizedCategoryLabels translates CategoryLabels
+var localizedCategoryLabels = map[string]map[TransactionCategory]string{
+	LanguageSpanish: {
+		CategoryGroceries:      "Supermercado",
+		CategoryDining:         "Restaurantes",
+		CategoryTransport:      "Transporte",
+		CategoryUtilities:      "Servicios",
+		CategoryRent:           "Alquiler",
+		CategoryHealthcare:     "Salud",
+		CategoryEntertainment:  "Entretenimiento",
+		CategoryShopping:       "Compras",
+		CategorySubscriptions:  "Suscripciones",
+		CategoryGames:          "Juegos",
+		CategoryTravel:         "Viajes",
+		CategoryEducation:      "Educación",
+		CategoryFitness:        "Ejercicio",
+		CategoryPersonal:       "Cuidado personal",
+		CategoryGifts:          "Regalos",
+		CategoryIncome:         "Ingresos",
+		CategoryTransfer:       "Transferencia",
+		CategoryOther:          "Otros",
+		CategoryOpeningBalance: "Saldo inicial",
+		CategoryCashWithdrawal: "Retiro de efectivo",
+	},
+}
+
+// LocalizedCategoryLabel returns a category's label in the locale's
+// language. Unknown categories are returned as they are.
+func LocalizedCategoryLabel(locale string, category TransactionCategory) string {
+	if label, ok := localizedCategoryLabels[Language(locale)][category]; ok {
+		return label
+	}
+	if label, ok := CategoryLabels[category]; ok {
+		return label
+	}
+	return string(category)
+}
+
+var spanishMonths = [...]string{
+	"enero", "febrero", "marzo", "abril", "mayo", "junio",
+	"julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre",
+}
+
+// MonthLabel names the month of t in the locale's language, e.g.
+// "January 2026" or "enero de 2026"
+func MonthLabel(locale string, t time.Time) string {
+	if Language(locale) == LanguageSpanish {
+		return fmt.Sprintf("%s de %d", spanishMonths[t.Month()-1], t.Year())
+	}
+	return t.Format("January 2006")
+}
+
+// DateLabel writes out a date in the locale's language, e.g.
+// "January 5, 2026" or "5 de enero de 2026"
+func DateLabel(locale string, t time.Time) string {
+	if Language(locale) == LanguageSpanish {
+		return fmt.Sprintf("%d de %s de %d", t.Day(), spanishMonths[t.Month()-1], t.Year())
+	}
+	return t.Format("January 2, 2006")
+}
+
+// WeekLabel names the week starting on t, e.g. "Week of January 5, 2026"
+// or "Semana del 5 de enero de 2026"
+func WeekLabel(locale string, t time.Time) string {
+	if Language(locale) == LanguageSpanish {
+		return "Semana del " + DateLabel(locale, t)
+	}
+	return "Week of " + DateLabel(locale, t)
+}
+
+// messages translates API error messages, keyed by the English message
+var messages = map[string]map[string]string{
+	LanguageSpanish: {
+		"Authentication required":                      "Se requiere iniciar sesión",
+		"Not authenticated":                            "No has iniciado sesión",
+		"Invalid session":                              "Sesión no válida",
+		"Session expired":                              "La sesión expiró",
+		"Session not found":                            "Sesión no encontrada",
+		"User not found in context":                    "Usuario no encontrado en el contexto",
+		"Invalid email or password":                    "Correo o contraseña incorrectos",
+		"Incorrect password":                           "Contraseña incorrecta",
+		"Invalid email address":                        "Correo electrónico no válido",
+		"Password must be at least 8 characters":       "La contraseña debe tener al menos 8 caracteres",
+		"Registration requires a valid invite":         "El registro requiere una invitación válida",
+		"This invite is for a different email address": "Esta invitación es para otro correo electrónico",
+		"Invalid access token":                         "Token de acceso no válido",
+		"Access token expired":                         "El token de acceso expiró",
+		"Invalid refresh token":                        "Token de actualización no válido",
+		"Refresh token expired":                        "El token de actualización expiró",
+		"Refresh token revoked":                        "El token de actualización fue revocado",
+		"Refresh token already used":                   "El token de actualización ya fue usado",
+		"Refresh token is required":                    "El token de actualización es obligatorio",
+		"Invalid request body":                         "Cuerpo de la solicitud no válido",
+		"Request timed out":                            "La solicitud tardó demasiado",
+		"No fields to update":                          "No hay campos para actualizar",
+
+		"Account not found":                                 "Cuenta no encontrada",
+		"Invalid account ID":                                "ID de cuenta no válido",
+		"Source account not found":                          "Cuenta de origen no encontrada",
+		"Destination account not found":                     "Cuenta de destino no encontrada",
+		"Source account is frozen":                          "La cuenta de origen está congelada",
+		"Loan accounts cannot be frozen":                    "Las cuentas de préstamo no se pueden congelar",
+		"Transaction not found":                             "Transacción no encontrada",
+		"Invalid transaction ID":                            "ID de transacción no válido",
+		"Transaction not found in this account":             "Transacción no encontrada en esta cuenta",
+		"Invalid transaction type for this account":         "Tipo de transacción no válido para esta cuenta",
+		"Invalid category":                                  "Categoría no válida",
+		"Amount must be positive":                           "El monto debe ser positivo",
+		"Fee cannot be negative":                            "La comisión no puede ser negativa",
+		"Value cannot be negative":                          "El valor no puede ser negativo",
+		"Monthly limit must be positive":                    "El límite mensual debe ser positivo",
+		"Spending can't be recorded on a loan":              "No se pueden registrar gastos en un préstamo",
+		"Not enough unallocated balance in this account":    "No hay suficiente saldo sin asignar en esta cuenta",
+		"Only withdrawals and expenses can be reimbursable": "Solo los retiros y gastos pueden ser reembolsables",
+
+		"Profile not found":                           "Perfil no encontrado",
+		"Invalid profile ID":                          "ID de perfil no válido",
+		"A profile with this name already exists":     "Ya existe un perfil con este nombre",
+		"The default profile can't be changed":        "El perfil principal no se puede cambiar",
+		"Move or delete the profile's accounts first": "Mueve o elimina primero las cuentas del perfil",
+		"Not available with advisor access":           "No disponible con acceso de asesor",
+
+		"No total budget set":                       "No hay un presupuesto total definido",
+		"Zero-based budgeting is off":               "El presupuesto base cero está desactivado",
+		"This month is already closed":              "Este mes ya está cerrado",
+		"This month isn't closed":                   "Este mes no está cerrado",
+		"Only months that have ended can be closed": "Solo se pueden cerrar meses que ya terminaron",
+		"File is required":                          "El archivo es obligatorio",
+		"File is empty":                             "El archivo está vacío",
+		"The file has no accounts to import":        "El archivo no tiene cuentas para importar",
+		"Notification not found":                    "Notificación no encontrada",
+		"Telegram bot is not configured":            "El bot de Telegram no está configurado",
+		"No Telegram chat is linked":                "No hay un chat de Telegram vinculado",
+	},
+}
+
+// messagePrefixes translates messages that end with a detail, such as the
+// value that was rejected
+var messagePrefixes = map[string][][2]string{
+	LanguageSpanish: {
+		{"Invalid category: ", "Categoría no válida: "},
+		{"Invalid transaction type: ", "Tipo de transacción no válido: "},
+		{"Invalid locale. Must be one of ", "Idioma no válido. Debe ser uno de "},
+		{"Invalid date format. Use ", "Formato de fecha no válido. Usa "},
+		{"Allocations exceed income by ", "Las asignaciones superan los ingresos por "},
+		{"Spending is over the allocation for ", "El gasto supera la asignación de "},
+		{"Projected to go negative: ", "Saldo negativo proyectado: "},
+	},
+}
+
+// TranslateMessage returns an API message in the locale's language, or the
+// message itself when it has no translation
+func TranslateMessage(locale, message string) string {
+	lang := Language(locale)
+	if translated, ok := messages[lang][message]; ok {
+		return translated
+	}
+	for _, p := range messagePrefixes[lang] {
+		if rest, ok := strings.CutPrefix(message, p[0]); ok {
+			return p[1] + rest
+		}
+	}
+	return message
+}
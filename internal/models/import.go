@@ -0,0 +1,48 @@
+package models
+
+// MaxImportSize caps uploaded GnuCash, Money Manager EX and statement files
+const MaxImportSize = 50 << 20
+
+// Import formats
+const (
+	ImportGnuCash = "gnucash"
+	ImportMMEX    = "mmex"
+)
+
+// ImportAccountPreview is an account an import would create
+type ImportAccountPreview struct {
+	Name             string      `json:"name"`
+	Type             AccountType `json:"type"`
+	Currency         string      `json:"currency"`
+	Balance          float64     `json:"balance"`
+	TransactionCount int         `json:"transaction_count"`
+}
+
+// ImportCategoryMapping maps a category of the imported file to the
+// category its transactions get
+type ImportCategoryMapping struct {
+	Source           string              `json:"source"`
+	Category         TransactionCategory `json:"category"`
+	TransactionCount int                 `json:"transaction_count"`
+}
+
+// ImportPreview is what an import would create, for review before it's run
+type ImportPreview struct {
+	Format           string                  `json:"format"`
+	Accounts         []ImportAccountPreview  `json:"accounts"`
+	Categories       []ImportCategoryMapping `json:"categories"`
+	TransactionCount int                     `json:"transaction_count"`
+	TransferCount    int                     `json:"transfer_count"`
+	FirstDate        *string                 `json:"first_date"`
+	LastDate         *string                 `json:"last_date"`
+	Skipped          int                     `json:"skipped"`
+}
+
+// ImportResult is what an import created
+type ImportResult struct {
+	Format           string  `json:"format"`
+	AccountIDs       []int64 `json:"account_ids"`
+	TransactionCount int     `json:"transaction_count"`
+	TransferCount    int     `json:"transfer_count"`
+	Skipped          int     `json:"skipped"` // statement entries already recorded in the account
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// InsightKind is the kind of finding an insight reports
+type InsightKind string
+
+const (
+	// InsightCategoryChange compares a category's spending this month with
+	// the same point last month
+	InsightCategoryChange InsightKind = "category_change"
+	// InsightTotalChange does the same for all spending
+	InsightTotalChange InsightKind = "total_change"
+	// InsightTopCategory names the category taking the largest share of
+	// this month's spending
+	InsightTopCategory InsightKind = "top_category"
+	// InsightSubscriptions totals what subscriptions cost a month
+	InsightSubscriptions InsightKind = "subscriptions"
+)
+
+// Insight is a finding about the user's spending in the active profile,
+// such as "You spent 40% more on dining this month". Insights are worked
+// out again periodically; one the user dismissed stays dismissed for its
+// period.
+type Insight struct {
+	ID          int64           `json:"id"`
+	Kind        InsightKind     `json:"kind"`
+	Title       string          `json:"title"`
+	Message     string          `json:"message"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Period      string          `json:"period"` // YYYY-MM
+	DismissedAt *time.Time      `json:"dismissed_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// InsuranceType is what an insurance policy covers
+type InsuranceType string
+
+const (
+	InsuranceHealth InsuranceType = "health"
+	InsuranceLife   InsuranceType = "life"
+	InsuranceAuto   InsuranceType = "auto"
+	InsuranceHome   InsuranceType = "home"
+	InsuranceTravel InsuranceType = "travel"
+	InsuranceOther  InsuranceType = "other"
+)
+
+// IsValid returns true if this is a known insurance type
+func (t InsuranceType) IsValid() bool {
+	switch t {
+	case InsuranceHealth, InsuranceLife, InsuranceAuto, InsuranceHome, InsuranceTravel, InsuranceOther:
+		return true
+	default:
+		return false
+	}
+}
+
+// PremiumFrequency is how often an insurance premium is paid
+type PremiumFrequency string
+
+const (
+	PremiumMonthly   PremiumFrequency = "monthly"
+	PremiumQuarterly PremiumFrequency = "quarterly"
+	PremiumYearly    PremiumFrequency = "yearly"
+)
+
+// PaymentsPerYear returns how many premiums are paid a year, or 0 for an
+// unknown frequency
+func (f PremiumFrequency) PaymentsPerYear() int {
+	switch f {
+	case PremiumMonthly:
+		return 12
+	case PremiumQuarterly:
+		return 4
+	case PremiumYearly:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// InsuranceRenewalReminderDays is how many days before a policy renews its
+// reminder is sent
+const InsuranceRenewalReminderDays = 30
+
+// MaxInsuranceNameLength caps policy names, providers and policy numbers
+const MaxInsuranceNameLength = 64
+
+// MaxInsuranceNotesLength caps the notes stored with a policy
+const MaxInsuranceNotesLength = 500
+
+// InsurancePolicy is an insurance policy the user holds. Its premium can be
+// linked to the bill that pays it.
+type InsurancePolicy struct {
+	ID               int64            `json:"id"`
+	Name             string           `json:"name"`
+	Type             InsuranceType    `json:"type"`
+	Provider         string           `json:"provider,omitempty"`
+	PolicyNumber     string           `json:"policy_number,omitempty"`
+	Premium          float64          `json:"premium"`
+	PremiumFrequency PremiumFrequency `json:"premium_frequency"`
+	AnnualPremium    float64          `json:"annual_premium"`
+	Currency         string           `json:"currency"`
+	CoverageAmount   *float64         `json:"coverage_amount,omitempty"`
+	RenewalDate      string           `json:"renewal_date"` // YYYY-MM-DD
+	DaysUntilRenewal int              `json:"days_until_renewal"`
+	BillID           *int64           `json:"bill_id,omitempty"`
+	BillName         string           `json:"bill_name,omitempty"`
+	Notes            string           `json:"notes,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// InsurancePolicyRequest creates or updates a policy. On update, omitted
+// fields are left unchanged; a coverage_amount or bill_id of 0 clears it.
+type InsurancePolicyRequest struct {
+	Name             *string           `json:"name,omitempty"`
+	Type             *InsuranceType    `json:"type,omitempty"`
+	Provider         *string           `json:"provider,omitempty"`
+	PolicyNumber     *string           `json:"policy_number,omitempty"`
+	Premium          *float64          `json:"premium,omitempty"`
+	PremiumFrequency *PremiumFrequency `json:"premium_frequency,omitempty"`
+	Currency         *string           `json:"currency,omitempty"`
+	CoverageAmount   *float64          `json:"coverage_amount,omitempty"`
+	RenewalDate      *string           `json:"renewal_date,omitempty"`
+	BillID           *int64            `json:"bill_id,omitempty"`
+	Notes            *string           `json:"notes,omitempty"`
+}
+
+// RenewPolicyRequest renews a policy, moving its renewal date a year ahead
+// unless RenewalDate gives the new one. Premium optionally sets the new
+// premium.
+type RenewPolicyRequest struct {
+	RenewalDate string   `json:"renewal_date,omitempty"`
+	Premium     *float64 `json:"premium,omitempty"`
+}
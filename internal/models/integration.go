@@ -0,0 +1,128 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxAPIKeys is how many integration keys a user can have at once
+const MaxAPIKeys = 10
+
+// APIKeyPrefix starts every integration key, so leaked keys are easy to
+// recognize
+const APIKeyPrefix = "wk_"
+
+// APIKey lets an automation service such as Zapier or IFTTT call the
+// integration endpoints for a user, in the profile it was created in. The
+// key itself is only returned when it's created.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Key        string     `json:"key,omitempty"`
+	Hint       string     `json:"hint"` // the start of the key, to tell keys apart
+	ProfileID  int64      `json:"profile_id"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest names a new integration key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// Normalize validates the request
+func (r *CreateAPIKeyRequest) Normalize() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(r.Name) > 100 {
+		return fmt.Errorf("name must be at most 100 characters")
+	}
+	return nil
+}
+
+// IntegrationMe identifies the user a key belongs to. Zapier calls it to
+// test a connection and labels the connection with Email.
+type IntegrationMe struct {
+	ID      int64  `json:"id"`
+	Email   string `json:"email"`
+	KeyID   int64  `json:"key_id"`
+	KeyName string `json:"key_name"`
+}
+
+// IntegrationTransactionRequest records a transaction from an automation.
+// Type defaults to spending: an expense on credit cards and a withdrawal
+// on other accounts.
+type IntegrationTransactionRequest struct {
+	AccountID   int64               `json:"account_id"`
+	Type        TransactionType     `json:"type"`
+	Amount      float64             `json:"amount"`
+	Description string              `json:"description"`
+	Category    TransactionCategory `json:"category"`
+}
+
+// QuickEntryRequest is a phrase such as "coffee 4.50 visa" to record
+type QuickEntryRequest struct {
+	Text string `json:"text"`
+}
+
+// QuickEntryResponse is the recorded transaction and a sentence describing
+// it, for a shortcut to show or speak
+type QuickEntryResponse struct {
+	Transaction Transaction `json:"transaction"`
+	AccountName string      `json:"account_name"`
+	Message     string      `json:"message"`
+}
+
+// BalanceFeed lets a script or a bank push an account's balance to
+// POST /api/integrations/balance, signed with the feed's secret. The
+// secret is only returned when the feed is created.
+type BalanceFeed struct {
+	ID             int64      `json:"id"`
+	AccountID      int64      `json:"account_id"`
+	Name           string     `json:"name"`
+	Secret         string     `json:"secret,omitempty"`
+	LastBalance    *float64   `json:"last_balance,omitempty"`
+	LastReceivedAt *time.Time `json:"last_received_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// CreateBalanceFeedRequest maps an account to a balance feed
+type CreateBalanceFeedRequest struct {
+	AccountID int64  `json:"account_id"`
+	Name      string `json:"name"`
+}
+
+// Normalize validates the request
+func (r *CreateBalanceFeedRequest) Normalize() error {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if utf8.RuneCountInString(r.Name) > 100 {
+		return fmt.Errorf("name must be at most 100 characters")
+	}
+	return nil
+}
+
+// BalanceUpdateRequest is a balance pushed by a feed: the amount owed for
+// credit cards and loans, the balance for other accounts. Currency is
+// optional and checked against the account's when given.
+type BalanceUpdateRequest struct {
+	FeedID   int64    `json:"feed_id"`
+	Balance  *float64 `json:"balance"`
+	Currency string   `json:"currency"`
+}
+
+// BalanceUpdateResult is how a pushed balance was reconciled. Adjustment is
+// the change recorded as a transaction, zero when the balance already
+// matched.
+type BalanceUpdateResult struct {
+	AccountID       int64   `json:"account_id"`
+	PreviousBalance float64 `json:"previous_balance"`
+	Balance         float64 `json:"balance"`
+	Adjustment      float64 `json:"adjustment"`
+}
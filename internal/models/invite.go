@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RegistrationMode controls who can create an account
+type RegistrationMode string
+
+const (
+	// RegistrationOpen lets anyone register
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInvite requires an invite from an admin, except for the
+	// addresses in ADMIN_EMAILS
+	RegistrationInvite RegistrationMode = "invite"
+)
+
+// ParseRegistrationMode parses a mode name, defaulting to open
+func ParseRegistrationMode(s string) (RegistrationMode, error) {
+	switch RegistrationMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", RegistrationOpen:
+		return RegistrationOpen, nil
+	case RegistrationInvite:
+		return RegistrationInvite, nil
+	}
+	return "", fmt.Errorf("invalid REGISTRATION_MODE %q: expected open or invite", s)
+}
+
+// Invite lifetimes, in hours
+const (
+	DefaultInviteHours = 72
+	MaxInviteHours     = 30 * 24
+)
+
+// Invite lets one person register while registration is invite-only. The
+// token itself is only returned when the invite is created.
+type Invite struct {
+	ID        int64      `json:"id"`
+	Token     string     `json:"token,omitempty"`
+	Path      string     `json:"path,omitempty"` // Registration link, relative to the instance
+	Email     *string    `json:"email,omitempty"`
+	CreatedBy *int64     `json:"created_by,omitempty"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	UsedBy    *int64     `json:"used_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateInviteRequest optionally restricts an invite to one email address
+// and sets how many hours it stays valid
+type CreateInviteRequest struct {
+	Email          *string `json:"email"`
+	ExpiresInHours *int    `json:"expires_in_hours"`
+}
+
+// RegistrationInfo tells the registration page whether an invite is needed
+// and, when one is given, whether it can be used
+type RegistrationInfo struct {
+	Mode        RegistrationMode `json:"mode"`
+	InviteValid *bool            `json:"invite_valid,omitempty"`
+	InviteEmail *string          `json:"invite_email,omitempty"`
+}
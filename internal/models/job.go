@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// JobStatus is the state of a scheduled background job, as reported to
+// admins. Runs are only tracked in memory and reset on restart.
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	Running      bool       `json:"running"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastDuration float64    `json:"last_duration_seconds,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	// LastResult summarizes what the last successful run did
+	LastResult string `json:"last_result,omitempty"`
+	Runs       int    `json:"runs"`
+	Failures   int    `json:"failures"`
+}
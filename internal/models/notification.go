@@ -0,0 +1,165 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NotificationType identifies what produced a notification
+type NotificationType string
+
+const (
+	NotificationAnomalyTransaction NotificationType = "anomaly_transaction"
+	NotificationAnomalyCategory    NotificationType = "anomaly_category_spike"
+	NotificationBudgetTotal        NotificationType = "budget_total"
+	NotificationAccountFrozen      NotificationType = "account_frozen"
+	NotificationPaymentDue         NotificationType = "payment_due"
+	NotificationBalanceAlert       NotificationType = "balance_alert"
+	NotificationBillDue            NotificationType = "bill_due"
+	NotificationCreditScore        NotificationType = "credit_score_reminder"
+	NotificationInsuranceRenewal   NotificationType = "insurance_renewal"
+	NotificationAnnouncement       NotificationType = "announcement"
+	NotificationReportWebhook      NotificationType = "report_webhook_failed"
+)
+
+// NotificationTypes lists every notification type, in the order
+// preferences are shown
+var NotificationTypes = []NotificationType{
+	NotificationPaymentDue,
+	NotificationBillDue,
+	NotificationInsuranceRenewal,
+	NotificationBalanceAlert,
+	NotificationBudgetTotal,
+	NotificationAccountFrozen,
+	NotificationAnomalyTransaction,
+	NotificationAnomalyCategory,
+	NotificationCreditScore,
+	NotificationAnnouncement,
+	NotificationReportWebhook,
+}
+
+// IsValid checks if the notification type is known
+func (t NotificationType) IsValid() bool {
+	for _, known := range NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification channels. Email goes through the configured SMTP server and
+// push to the user's linked Telegram chat.
+const (
+	NotificationChannelInApp = "in_app"
+	NotificationChannelEmail = "email"
+	NotificationChannelPush  = "push"
+)
+
+// Notification is an entry in the user's notification feed
+type Notification struct {
+	ID             int64            `json:"id"`
+	UserID         int64            `json:"user_id"`
+	Type           NotificationType `json:"type"`
+	Title          string           `json:"title"`
+	Message        string           `json:"message"`
+	Data           json.RawMessage  `json:"data,omitempty"`
+	AcknowledgedAt *time.Time       `json:"acknowledged_at,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+
+	// DedupeKey prevents the same finding from being reported twice
+	DedupeKey string `json:"-"`
+}
+
+// NotificationPreference is where one type of notification is delivered
+type NotificationPreference struct {
+	Type  NotificationType `json:"type"`
+	InApp bool             `json:"in_app"`
+	Email bool             `json:"email"`
+	Push  bool             `json:"push"`
+}
+
+// DefaultNotificationPreference is used for types the user hasn't set.
+// Everything shows in the app, and payment and renewal reminders and failed
+// report webhooks are also emailed.
+func DefaultNotificationPreference(t NotificationType) NotificationPreference {
+	pref := NotificationPreference{Type: t, InApp: true}
+	switch t {
+	case NotificationPaymentDue, NotificationBillDue, NotificationInsuranceRenewal, NotificationReportWebhook:
+		pref.Email = true
+	}
+	return pref
+}
+
+// QuietHours is a daily window, in the user's timezone, during which email
+// and push notifications are held back and delivered once it ends. Start
+// and End are HH:MM; a window whose end is before its start runs past
+// midnight.
+type QuietHours struct {
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone,omitempty"` // IANA name, default the server's
+}
+
+// Validate checks the window's times and timezone
+func (q QuietHours) Validate() error {
+	start, err := time.Parse("15:04", q.Start)
+	if err != nil {
+		return fmt.Errorf("invalid quiet hours start: use HH:MM")
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return fmt.Errorf("invalid quiet hours end: use HH:MM")
+	}
+	if start.Equal(end) {
+		return fmt.Errorf("quiet hours must start and end at different times")
+	}
+	if q.Timezone != "" {
+		if _, err := time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", q.Timezone)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether now falls within the window
+func (q QuietHours) Contains(now time.Time) bool {
+	if q.Timezone != "" {
+		if loc, err := time.LoadLocation(q.Timezone); err == nil {
+			now = now.In(loc)
+		}
+	}
+	clock := now.Format("15:04")
+	if q.Start < q.End {
+		return clock >= q.Start && clock < q.End
+	}
+	return clock >= q.Start || clock < q.End
+}
+
+// NotificationSettings are the user's delivery preferences for every
+// notification type and their quiet hours. EmailAvailable and PushAvailable
+// report whether those channels can deliver for the user.
+type NotificationSettings struct {
+	Preferences    []NotificationPreference `json:"preferences"`
+	QuietHours     *QuietHours              `json:"quiet_hours"`
+	EmailAvailable bool                     `json:"email_available"`
+	PushAvailable  bool                     `json:"push_available"`
+}
+
+// NotificationPreferenceRequest changes the channels of one notification
+// type. Omitted channels are left unchanged.
+type NotificationPreferenceRequest struct {
+	Type  NotificationType `json:"type"`
+	InApp *bool            `json:"in_app,omitempty"`
+	Email *bool            `json:"email,omitempty"`
+	Push  *bool            `json:"push,omitempty"`
+}
+
+// UpdateNotificationSettingsRequest changes notification preferences. Quiet
+// hours are left unchanged when omitted and turned off with an empty start
+// and end.
+type UpdateNotificationSettingsRequest struct {
+	Preferences []NotificationPreferenceRequest `json:"preferences,omitempty"`
+	QuietHours  *QuietHours                     `json:"quiet_hours,omitempty"`
+}
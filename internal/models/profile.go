@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultProfileID is the profile every user starts with. It has no row in
+// the profiles table.
+const DefaultProfileID = 0
+
+// DefaultProfileName is the name shown for the default profile
+const DefaultProfileName = "Personal"
+
+// MaxProfileNameLength caps profile names
+const MaxProfileNameLength = 64
+
+// ProfileKind is what a profile's finances are for
+type ProfileKind string
+
+const (
+	ProfileKindPersonal ProfileKind = "personal"
+	ProfileKindBusiness ProfileKind = "business"
+)
+
+// IsValid returns true if this is a known profile kind
+func (k ProfileKind) IsValid() bool {
+	return k == ProfileKindPersonal || k == ProfileKindBusiness
+}
+
+// Profile partitions a user's accounts, budgets and reports, such as
+// keeping a business apart from personal finances. Requests work in one
+// profile at a time.
+type Profile struct {
+	ID           int64       `json:"id"`
+	Name         string      `json:"name"`
+	Kind         ProfileKind `json:"kind"`
+	IsDefault    bool        `json:"is_default"`
+	AccountCount int         `json:"account_count"`
+	CreatedAt    *time.Time  `json:"created_at,omitempty"`
+}
+
+// ProfileRequest creates or updates a profile. On update, omitted fields are
+// left unchanged.
+type ProfileRequest struct {
+	Name *string      `json:"name,omitempty"`
+	Kind *ProfileKind `json:"kind,omitempty"`
+}
+
+// MoveAccountRequest moves an account into a profile
+type MoveAccountRequest struct {
+	AccountID int64 `json:"account_id"`
+}
+
+// ValidateProfileName trims and checks a profile name
+func ValidateProfileName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > MaxProfileNameLength {
+		return "", fmt.Errorf("name must be at most %d characters", MaxProfileNameLength)
+	}
+	if strings.EqualFold(name, DefaultProfileName) {
+		return "", fmt.Errorf("%s is the default profile's name", DefaultProfileName)
+	}
+	return name, nil
+}
@@ -8,3 +8,41 @@ type Session struct {
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// Token lifetimes for clients that authenticate with a bearer token instead
+// of the session cookie
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Grant types accepted by the token endpoint
+const (
+	GrantPassword     = "password"
+	GrantRefreshToken = "refresh_token"
+)
+
+// TokenRequest asks for a new token pair, either with the user's credentials
+// or with a refresh token
+type TokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Email        string `json:"email,omitempty"`
+	Password     string `json:"password,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// TokenResponse is an access token and the refresh token that replaces it
+// when it expires. The refresh token can only be used once.
+type TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int    `json:"refresh_expires_in"`
+	User             *User  `json:"user,omitempty"`
+}
+
+// RevokeTokenRequest signs out the device a refresh token was issued to
+type RevokeTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
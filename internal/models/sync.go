@@ -0,0 +1,85 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MaxSyncMutations caps the mutations accepted in one sync request
+const MaxSyncMutations = 100
+
+// Entities clients can sync
+const (
+	SyncEntityAccount     = "account"
+	SyncEntityTransaction = "transaction"
+)
+
+// SyncChange is the current state of an entity changed since the client's
+// token, or a tombstone when it was deleted
+type SyncChange struct {
+	Entity    string      `json:"entity"`
+	ID        int64       `json:"id"`
+	Deleted   bool        `json:"deleted,omitempty"`
+	ChangedAt *time.Time  `json:"changed_at,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// SyncResponse is a page of changes. Clients store Token and pass it as
+// since on the next pull; HasMore means another pull is needed right away.
+// Full responses (no since) hold every entity and replace the local copy.
+type SyncResponse struct {
+	Changes []SyncChange `json:"changes"`
+	Token   string       `json:"token"`
+	HasMore bool         `json:"has_more"`
+	Full    bool         `json:"full,omitempty"`
+}
+
+// SyncMutationOp is a change made on a client while offline
+type SyncMutationOp string
+
+const (
+	SyncOpCreate SyncMutationOp = "create"
+	SyncOpUpdate SyncMutationOp = "update"
+)
+
+// SyncMutation is one client-side change. ClientID is unique per mutation
+// so retried batches aren't applied twice. Updates carry the token the
+// client last synced at as BaseToken; if the entity changed on the server
+// since, the mutation is a conflict and the server's version is kept.
+type SyncMutation struct {
+	ClientID  string          `json:"client_id"`
+	Entity    string          `json:"entity"`
+	Op        SyncMutationOp  `json:"op"`
+	ID        *int64          `json:"id,omitempty"`         // Entity to update
+	AccountID *int64          `json:"account_id,omitempty"` // Account a transaction is created on
+	BaseToken string          `json:"base_token,omitempty"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SyncRequest is a batch of client mutations, applied in order
+type SyncRequest struct {
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+// SyncMutationStatus is the outcome of a mutation
+type SyncMutationStatus string
+
+const (
+	SyncStatusApplied  SyncMutationStatus = "applied"
+	SyncStatusConflict SyncMutationStatus = "conflict" // Server version kept, see Data
+	SyncStatusRejected SyncMutationStatus = "rejected" // Invalid, see Error
+)
+
+// SyncMutationResult reports what happened to one mutation, with the
+// entity's current server state in Data
+type SyncMutationResult struct {
+	ClientID string             `json:"client_id"`
+	Status   SyncMutationStatus `json:"status"`
+	Error    string             `json:"error,omitempty"`
+	Data     json.RawMessage    `json:"data,omitempty"`
+}
+
+// SyncPushResponse holds a result per mutation, in request order
+type SyncPushResponse struct {
+	Results []SyncMutationResult `json:"results"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// TaxTreatment marks income or spending as relevant at filing time
+type TaxTreatment string
+
+const (
+	// TaxDeductible is personal spending that can be deducted
+	TaxDeductible TaxTreatment = "deductible"
+	// TaxBusiness is business income or spending
+	TaxBusiness TaxTreatment = "business"
+	// TaxNone excludes a transaction whose category is tax-relevant. It is
+	// only valid on transactions.
+	TaxNone TaxTreatment = "none"
+)
+
+// IsValid returns true for the treatments a category can be tagged with
+func (t TaxTreatment) IsValid() bool {
+	return t == TaxDeductible || t == TaxBusiness
+}
+
+// IsValidForTransaction returns true for the treatments a transaction can be
+// tagged with, which include TaxNone
+func (t TaxTreatment) IsValidForTransaction() bool {
+	return t.IsValid() || t == TaxNone
+}
+
+// TaxCategory tags every transaction in a category with a tax treatment.
+// A transaction's own treatment takes precedence.
+type TaxCategory struct {
+	Category  TransactionCategory `json:"category"`
+	Treatment TaxTreatment        `json:"treatment"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// TaxCategoryRequest tags a category
+type TaxCategoryRequest struct {
+	Treatment TaxTreatment `json:"treatment"`
+}
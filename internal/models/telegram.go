@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// TelegramLinkCodeTTL is how long a link code can be sent to the bot
+const TelegramLinkCodeTTL = 15 * time.Minute
+
+// TelegramLink is a Telegram chat linked to a user for quick entry
+type TelegramLink struct {
+	ChatID    int64     `json:"chat_id"`
+	AccountID *int64    `json:"account_id,omitempty"` // Where "spent" messages are recorded
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TelegramStatus describes the bot's availability and the user's link
+type TelegramStatus struct {
+	Enabled bool          `json:"enabled"`
+	Link    *TelegramLink `json:"link,omitempty"`
+}
+
+// TelegramLinkCode is a one-time code the user sends to the bot to link
+// their chat
+type TelegramLinkCode struct {
+	Code      string    `json:"code"`
+	Command   string    `json:"command"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// UpdateTelegramRequest picks the account "spent" messages are recorded on
+type UpdateTelegramRequest struct {
+	AccountID *int64 `json:"account_id"`
+}
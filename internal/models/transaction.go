@@ -1,6 +1,14 @@
 package models
 
-import "time"
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
 
 // TransactionType represents the type of transaction
 type TransactionType string
@@ -10,6 +18,11 @@ const (
 	TransactionTypeWithdrawal TransactionType = "withdrawal"
 	TransactionTypeExpense    TransactionType = "expense"
 	TransactionTypePayment    TransactionType = "payment"
+
+	// TransactionTypeRevalue records a change in the market value of an
+	// investment account, as opposed to money paid in or taken out. Its
+	// amount is signed: positive for a gain, negative for a loss.
+	TransactionTypeRevalue TransactionType = "revalue"
 )
 
 // TransactionCategory represents predefined expense categories
@@ -34,8 +47,24 @@ const (
 	CategoryIncome        TransactionCategory = "income"
 	CategoryTransfer      TransactionCategory = "transfer"
 	CategoryOther         TransactionCategory = "other"
+
+	// CategoryOpeningBalance marks the transaction that records an account's
+	// starting balance. It is assigned by the server, can't be chosen for new
+	// transactions and is left out of income and spending figures.
+	CategoryOpeningBalance TransactionCategory = "opening_balance"
+
+	// CategoryCashWithdrawal marks both sides of an ATM withdrawal moving
+	// money from a bank account into a cash account. Like opening balances it
+	// is server-assigned and isn't spending.
+	CategoryCashWithdrawal TransactionCategory = "cash_withdrawal"
 )
 
+// IsSystemCategory reports whether a category is assigned by the server
+// rather than chosen by users
+func IsSystemCategory(category TransactionCategory) bool {
+	return category == CategoryOpeningBalance || category == CategoryCashWithdrawal
+}
+
 // AllCategories returns all available transaction categories
 func AllCategories() []TransactionCategory {
 	return []TransactionCategory{
@@ -60,6 +89,18 @@ func AllCategories() []TransactionCategory {
 	}
 }
 
+// EssentialCategories are the expenses that continue when income stops,
+// used to size an emergency fund
+func EssentialCategories() []TransactionCategory {
+	return []TransactionCategory{
+		CategoryGroceries,
+		CategoryTransport,
+		CategoryUtilities,
+		CategoryRent,
+		CategoryHealthcare,
+	}
+}
+
 // CategoryLabels returns human-readable labels for categories
 var CategoryLabels = map[TransactionCategory]string{
 	CategoryGroceries:     "Groceries",
@@ -80,12 +121,24 @@ var CategoryLabels = map[TransactionCategory]string{
 	CategoryIncome:        "Income",
 	CategoryTransfer:      "Transfer",
 	CategoryOther:         "Other",
+
+	CategoryOpeningBalance: "Opening balance",
+	CategoryCashWithdrawal: "Cash withdrawal",
+}
+
+// CategoryOption is a category users can choose, with its label in their
+// language
+type CategoryOption struct {
+	Category TransactionCategory `json:"category"`
+	Label    string              `json:"label"`
 }
 
 // Transaction represents a financial transaction
 type Transaction struct {
 	ID                  int64               `json:"id"`
 	AccountID           int64               `json:"account_id"`
+	AccountName         string              `json:"account_name,omitempty"`
+	AccountColor        string              `json:"account_color,omitempty"`
 	Type                TransactionType     `json:"type"`
 	Amount              float64             `json:"amount"`
 	Description         string              `json:"description"`
@@ -93,23 +146,229 @@ type Transaction struct {
 	BalanceAfter        float64             `json:"balance_after"`
 	LinkedTransactionID *int64              `json:"linked_transaction_id,omitempty"`
 	LinkedAccountName   string              `json:"linked_account_name,omitempty"`
+	Notes               string              `json:"notes,omitempty"`
+	Metadata            map[string]string   `json:"metadata,omitempty"`
+	Location            *Location           `json:"location,omitempty"`
+	ReimbursementStatus ReimbursementStatus `json:"reimbursement_status,omitempty"`
+	ReimbursedByID      *int64              `json:"reimbursed_by_transaction_id,omitempty"`
+	TaxTreatment        TaxTreatment        `json:"tax_treatment,omitempty"`
+	IsPrivate           bool                `json:"is_private"`
 	CreatedAt           time.Time           `json:"created_at"`
 }
 
+// ReimbursementStatus tracks money spent on someone else's behalf, such as
+// work expenses. Reimbursable expenses and the deposits that repay them
+// aren't personal income or spending, so reports leave them out.
+type ReimbursementStatus string
+
+const (
+	// ReimbursementPending is a reimbursable expense not yet repaid
+	ReimbursementPending ReimbursementStatus = "pending"
+	// ReimbursementReimbursed is a reimbursable expense linked to the
+	// deposit that repaid it
+	ReimbursementReimbursed ReimbursementStatus = "reimbursed"
+	// ReimbursementDeposit is a deposit that repaid reimbursable expenses
+	ReimbursementDeposit ReimbursementStatus = "reimbursement"
+)
+
+// Redact hides everything but the amount, type and date of a private
+// transaction. It is applied when a transaction is shown to anyone other
+// than the owner of its account.
+func (t *Transaction) Redact() {
+	if !t.IsPrivate {
+		return
+	}
+	t.Description = "Private transaction"
+	t.Category = CategoryOther
+	t.Notes = ""
+	t.Metadata = nil
+	t.Location = nil
+	t.ReimbursedByID = nil
+	t.LinkedTransactionID = nil
+	t.LinkedAccountName = ""
+}
+
+// TransactionDB is used for database scanning with nullable fields
+type TransactionDB struct {
+	ID                  int64
+	AccountID           int64
+	Type                string
+	Amount              float64
+	Description         sql.NullString
+	Category            sql.NullString
+	BalanceAfter        float64
+	LinkedTransactionID sql.NullInt64
+	Notes               sql.NullString
+	Metadata            sql.NullString
+	IsPrivate           bool
+	CreatedAt           time.Time
+	Latitude            sql.NullFloat64
+	Longitude           sql.NullFloat64
+	PlaceName           sql.NullString
+	ReimbursementStatus sql.NullString
+	ReimbursedByID      sql.NullInt64
+	TaxTreatment        sql.NullString
+}
+
+// ToTransaction converts TransactionDB to Transaction
+func (t *TransactionDB) ToTransaction() *Transaction {
+	transaction := &Transaction{
+		ID:           t.ID,
+		AccountID:    t.AccountID,
+		Type:         TransactionType(t.Type),
+		Amount:       t.Amount,
+		Description:  t.Description.String,
+		Category:     TransactionCategory(t.Category.String),
+		BalanceAfter: t.BalanceAfter,
+		Notes:        t.Notes.String,
+		IsPrivate:    t.IsPrivate,
+		CreatedAt:    t.CreatedAt,
+	}
+
+	if t.LinkedTransactionID.Valid {
+		transaction.LinkedTransactionID = &t.LinkedTransactionID.Int64
+	}
+	transaction.ReimbursementStatus = ReimbursementStatus(t.ReimbursementStatus.String)
+	transaction.TaxTreatment = TaxTreatment(t.TaxTreatment.String)
+	if t.ReimbursedByID.Valid {
+		transaction.ReimbursedByID = &t.ReimbursedByID.Int64
+	}
+	if t.Metadata.Valid && t.Metadata.String != "" {
+		// Ignore malformed metadata rather than failing the whole row
+		json.Unmarshal([]byte(t.Metadata.String), &transaction.Metadata)
+	}
+	if (t.Latitude.Valid && t.Longitude.Valid) || t.PlaceName.String != "" {
+		transaction.Location = &Location{PlaceName: t.PlaceName.String}
+		if t.Latitude.Valid && t.Longitude.Valid {
+			transaction.Location.Latitude = &t.Latitude.Float64
+			transaction.Location.Longitude = &t.Longitude.Float64
+		}
+	}
+
+	return transaction
+}
+
 // CreateTransactionRequest represents the request to create a transaction
 type CreateTransactionRequest struct {
 	Type        TransactionType     `json:"type"`
 	Amount      float64             `json:"amount"`
 	Description string              `json:"description"`
 	Category    TransactionCategory `json:"category"`
+	Location    *Location           `json:"location,omitempty"`
+	// Reimbursable marks a withdrawal or expense as paid on someone else's
+	// behalf, pending reimbursement
+	Reimbursable bool `json:"reimbursable,omitempty"`
+	// TaxTreatment overrides the tax treatment of the category
+	TaxTreatment TaxTreatment `json:"tax_treatment,omitempty"`
+	IsPrivate    bool         `json:"is_private"`
+}
+
+// ParseTransactionRequest is a description of a transaction in everyday
+// words, such as "paid 1,200 DOP for electricity yesterday from BHD debit"
+type ParseTransactionRequest struct {
+	Text string `json:"text"`
+}
+
+// ParsedTransaction is what was read from a ParseTransactionRequest, for the
+// user to check before it's recorded on AccountID. Warnings point out what
+// couldn't be read or won't be recorded as written.
+type ParsedTransaction struct {
+	AccountID   *int64                   `json:"account_id"`
+	AccountName string                   `json:"account_name,omitempty"`
+	Transaction CreateTransactionRequest `json:"transaction"`
+	Currency    string                   `json:"currency,omitempty"` // as written, when the text names one
+	Date        string                   `json:"date"`               // YYYY-MM-DD
+	Warnings    []string                 `json:"warnings,omitempty"`
+	Source      string                   `json:"source"` // "rules" or "llm"
+}
+
+// UpdateTransactionRequest represents the request to edit a transaction's
+// descriptive fields. Amount and type are not editable since they drive balances.
+type UpdateTransactionRequest struct {
+	Description *string              `json:"description,omitempty"`
+	Category    *TransactionCategory `json:"category,omitempty"`
+	Notes       *string              `json:"notes,omitempty"`
+	Metadata    *map[string]string   `json:"metadata,omitempty"`
+	Location    *Location            `json:"location,omitempty"` // an empty location clears it
+	// Reimbursable flags or unflags a withdrawal or expense as reimbursable.
+	// Unflagging unlinks it from its reimbursement.
+	Reimbursable *bool `json:"reimbursable,omitempty"`
+	// TaxTreatment overrides the tax treatment of the category; empty
+	// falls back to it again
+	TaxTreatment *TaxTreatment `json:"tax_treatment,omitempty"`
+	IsPrivate    *bool         `json:"is_private,omitempty"`
+}
+
+// LinkReimbursementRequest links a reimbursable expense to the deposit that
+// repaid it
+type LinkReimbursementRequest struct {
+	DepositID int64 `json:"deposit_id"`
 }
 
-// TransferRequest represents the request to create a transfer between accounts
+// ReimbursementList is the user's reimbursable expenses with the total
+// still to be repaid in the preferred currency
+type ReimbursementList struct {
+	Currency     string        `json:"currency"`
+	Pending      float64       `json:"pending"`
+	Transactions []Transaction `json:"transactions"`
+}
+
+// MaxPlaceNameLength caps transaction place names
+const MaxPlaceNameLength = 128
+
+// Location is where a transaction happened: a point in decimal degrees
+// (WGS 84, as GPS and geocoders report it), a place name, or both. They are
+// stored in separate columns so places can be geocoded or reverse geocoded
+// later without parsing.
+type Location struct {
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	PlaceName string   `json:"place_name,omitempty"`
+}
+
+// IsEmpty reports whether the location has neither a point nor a name
+func (l *Location) IsEmpty() bool {
+	return l.Latitude == nil && l.Longitude == nil && strings.TrimSpace(l.PlaceName) == ""
+}
+
+// Validate trims the place name and checks the coordinates, which must be
+// given together
+func (l *Location) Validate() error {
+	l.PlaceName = strings.TrimSpace(l.PlaceName)
+	if utf8.RuneCountInString(l.PlaceName) > MaxPlaceNameLength {
+		return fmt.Errorf("place_name must be at most %d characters", MaxPlaceNameLength)
+	}
+	if (l.Latitude == nil) != (l.Longitude == nil) {
+		return errors.New("latitude and longitude must be given together")
+	}
+	if l.Latitude != nil && (*l.Latitude < -90 || *l.Latitude > 90) {
+		return errors.New("latitude must be between -90 and 90")
+	}
+	if l.Longitude != nil && (*l.Longitude < -180 || *l.Longitude > 180) {
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// TransferRequest represents the request to create a transfer between accounts.
+// Amount and Fee are in the source account's currency. ReceivedAmount is
+// what the destination was credited, in its currency, when the bank
+// converted at its own rate; the shortfall against the mid-market rate is
+// recorded as the FX margin.
 type TransferRequest struct {
-	FromAccountID int64   `json:"from_account_id"`
-	ToAccountID   int64   `json:"to_account_id"`
-	Amount        float64 `json:"amount"`
-	Description   string  `json:"description"`
+	FromAccountID  int64    `json:"from_account_id"`
+	ToAccountID    int64    `json:"to_account_id"`
+	Amount         float64  `json:"amount"`
+	Description    string   `json:"description"`
+	ReceivedAmount *float64 `json:"received_amount,omitempty"`
+	Fee            float64  `json:"fee,omitempty"`
+}
+
+// RevalueRequest sets an investment account's current market value. The
+// difference from the stored balance is recorded as a revalue transaction.
+type RevalueRequest struct {
+	Value       float64 `json:"value"`
+	Description string  `json:"description"`
 }
 
 // TransactionListResponse represents paginated transaction list
@@ -134,6 +393,47 @@ func ValidTransactionTypesForAccount(accountType AccountType) []TransactionType
 	}
 }
 
+// BalanceChangeType returns the transaction type that moves an account's
+// balance field by a positive or negative delta: deposits and withdrawals for
+// assets, expenses and payments for the amount owed on liabilities
+func BalanceChangeType(accountType AccountType, delta float64) TransactionType {
+	switch accountType {
+	case AccountTypeCreditCard, AccountTypeLoan:
+		if delta < 0 {
+			return TransactionTypePayment
+		}
+		return TransactionTypeExpense
+	default:
+		if delta < 0 {
+			return TransactionTypeWithdrawal
+		}
+		return TransactionTypeDeposit
+	}
+}
+
+// LedgerTransactionTypes returns the transaction types an account's history
+// can hold: those users record, the ones balance edits are recorded as, and
+// revaluations for investments
+func LedgerTransactionTypes(accountType AccountType) []TransactionType {
+	types := append(ValidTransactionTypesForAccount(accountType), BalanceChangeType(accountType, 1), BalanceChangeType(accountType, -1))
+	if accountType == AccountTypeInvestment {
+		types = append(types, TransactionTypeRevalue)
+	}
+	return types
+}
+
+// BalanceEffect is how a transaction changes its account's balance field:
+// deposits and card expenses raise it, withdrawals and payments lower it.
+// Revalue amounts already carry their sign.
+func BalanceEffect(txType TransactionType, amount float64) float64 {
+	switch txType {
+	case TransactionTypeDeposit, TransactionTypeExpense, TransactionTypeRevalue:
+		return amount
+	default:
+		return -amount
+	}
+}
+
 // IsValidTransactionType checks if a transaction type is valid for an account type
 func IsValidTransactionType(txType TransactionType, accountType AccountType) bool {
 	validTypes := ValidTransactionTypesForAccount(accountType)
@@ -144,3 +444,34 @@ func IsValidTransactionType(txType TransactionType, accountType AccountType) boo
 	}
 	return false
 }
+
+// CardPaymentAmount selects how a card payment's amount is resolved
+type CardPaymentAmount string
+
+const (
+	// CardPayStatement pays what is left of the last statement balance
+	CardPayStatement CardPaymentAmount = "statement_balance"
+	// CardPayMinimum pays the minimum due on that statement
+	CardPayMinimum CardPaymentAmount = "minimum"
+	// CardPayCustom pays the amount given in the request
+	CardPayCustom CardPaymentAmount = "custom"
+)
+
+// PayCardRequest pays a credit card from an asset account. Custom amounts
+// are in the card's currency.
+type PayCardRequest struct {
+	SourceAccountID int64             `json:"source_account_id"`
+	AmountType      CardPaymentAmount `json:"amount_type"`
+	Amount          float64           `json:"amount,omitempty"`
+	Description     string            `json:"description,omitempty"`
+}
+
+// ATMWithdrawalRequest withdraws cash from a debit account into a cash
+// account. Amount and Fee are in the debit account's currency.
+type ATMWithdrawalRequest struct {
+	FromAccountID int64   `json:"from_account_id"`
+	ToAccountID   int64   `json:"to_account_id"`
+	Amount        float64 `json:"amount"`
+	Fee           float64 `json:"fee,omitempty"`
+	Description   string  `json:"description,omitempty"`
+}
@@ -3,18 +3,26 @@ package models
 import "time"
 
 type User struct {
-	ID                  int64     `json:"id"`
-	Email               string    `json:"email"`
-	Name                *string   `json:"name,omitempty"`
-	PreferredCurrency   string    `json:"preferred_currency"`
-	OnboardingCompleted bool      `json:"onboarding_completed"`
-	PasswordHash        string    `json:"-"`
-	CreatedAt           time.Time `json:"created_at"`
+	ID                  int64      `json:"id"`
+	Email               string     `json:"email"`
+	Name                *string    `json:"name,omitempty"`
+	PreferredCurrency   string     `json:"preferred_currency"`
+	Locale              string     `json:"locale"`
+	WeekStart           int        `json:"week_start"`      // 0 = Sunday
+	MonthStartDay       int        `json:"month_start_day"` // 1-28
+	OnboardingCompleted bool       `json:"onboarding_completed"`
+	IsAdmin             bool       `json:"is_admin"`
+	TelemetryOptIn      bool       `json:"telemetry_opt_in"`
+	BudgetMode          BudgetMode `json:"budget_mode"`
+	PasswordHash        string     `json:"-"`
+	CreatedAt           time.Time  `json:"created_at"`
 }
 
 type RegisterRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Required when registration is invite-only
+	InviteToken string `json:"invite_token,omitempty"`
 }
 
 type LoginRequest struct {
@@ -28,6 +36,56 @@ type AuthResponse struct {
 }
 
 type UpdatePreferencesRequest struct {
-	Name              *string `json:"name,omitempty"`
-	PreferredCurrency *string `json:"preferred_currency,omitempty"`
+	Name              *string     `json:"name,omitempty"`
+	PreferredCurrency *string     `json:"preferred_currency,omitempty"`
+	Locale            *string     `json:"locale,omitempty"`
+	WeekStart         *int        `json:"week_start,omitempty"`
+	MonthStartDay     *int        `json:"month_start_day,omitempty"`
+	TelemetryOptIn    *bool       `json:"telemetry_opt_in,omitempty"`
+	BudgetMode        *BudgetMode `json:"budget_mode,omitempty"`
+}
+
+// DeleteAccountRequest confirms permanent deletion of the current user.
+// With Export set, the response includes a copy of all their data.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Export   bool   `json:"export"`
+}
+
+// PeriodPreferences are where a user's weeks and months begin. Reports use
+// them instead of Sunday weeks and calendar months.
+type PeriodPreferences struct {
+	WeekStart     time.Weekday
+	MonthStartDay int // 1-28, e.g. 25 for a payday on the 25th
+}
+
+// MaxMonthStartDay keeps financial months the same shape in every month
+const MaxMonthStartDay = 28
+
+// WeekContaining returns the start of the week containing t
+func (p PeriodPreferences) WeekContaining(t time.Time) time.Time {
+	offset := (int(t.Weekday()) - int(p.WeekStart) + 7) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+// MonthStarting returns the start of the financial month labelled year-month,
+// which begins on the start day of that calendar month
+func (p PeriodPreferences) MonthStarting(year int, month time.Month, loc *time.Location) time.Time {
+	return time.Date(year, month, p.monthStartDay(), 0, 0, 0, 0, loc)
+}
+
+// MonthContaining returns the start of the financial month containing t
+func (p PeriodPreferences) MonthContaining(t time.Time) time.Time {
+	start := p.MonthStarting(t.Year(), t.Month(), t.Location())
+	if t.Before(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return start
+}
+
+func (p PeriodPreferences) monthStartDay() int {
+	if p.MonthStartDay < 1 || p.MonthStartDay > MaxMonthStartDay {
+		return 1
+	}
+	return p.MonthStartDay
 }
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ReportWebhook posts the user's weekly report to a URL of their choice,
+// e.g. an n8n or Zapier pipeline. Deliveries are signed with Secret, which
+// is only returned when it's created or rotated.
+type ReportWebhook struct {
+	URL           string     `json:"url"`
+	Weekday       int        `json:"weekday"` // 0 = Sunday
+	Secret        string     `json:"secret,omitempty"`
+	LastPeriod    *string    `json:"last_period,omitempty"` // start of the last week sent or given up on
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// SetReportWebhookRequest creates or changes the report webhook
+type SetReportWebhookRequest struct {
+	URL          string `json:"url"`
+	Weekday      *int   `json:"weekday"` // default Monday
+	RotateSecret bool   `json:"rotate_secret"`
+}
+
+// Normalize validates the request
+func (r *SetReportWebhookRequest) Normalize() error {
+	r.URL = strings.TrimSpace(r.URL)
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if len(r.URL) > 2048 {
+		return fmt.Errorf("url must be at most 2048 characters")
+	}
+	if r.Weekday == nil {
+		monday := int(time.Monday)
+		r.Weekday = &monday
+	}
+	if *r.Weekday < 0 || *r.Weekday > 6 {
+		return fmt.Errorf("weekday must be between 0 (Sunday) and 6 (Saturday)")
+	}
+	return nil
+}
+
+// ReportWebhookDelivery is the body posted to a report webhook
+type ReportWebhookDelivery struct {
+	Event  string      `json:"event"`
+	SentAt time.Time   `json:"sent_at"`
+	Report interface{} `json:"report"`
+}
+
+// ReportWebhookTestResult is how a test delivery went
+type ReportWebhookTestResult struct {
+	Delivered  bool   `json:"delivered"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
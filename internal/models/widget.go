@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// PinnedItemKind identifies which number a pinned item shows
+type PinnedItemKind string
+
+const (
+	PinnedAccountBalance  PinnedItemKind = "account_balance"
+	PinnedBudgetRemaining PinnedItemKind = "budget_remaining"
+	PinnedSafeToSpend     PinnedItemKind = "safe_to_spend"
+)
+
+// PinnedItem is a number the user chose to show on widgets
+type PinnedItem struct {
+	ID        int64          `json:"id"`
+	Kind      PinnedItemKind `json:"kind"`
+	AccountID *int64         `json:"account_id,omitempty"`
+	Category  *string        `json:"category,omitempty"`
+	Label     string         `json:"label,omitempty"`
+	Position  int            `json:"position"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// PinnedItemInput describes a single pinned item in a SetPinnedItemsRequest
+type PinnedItemInput struct {
+	Kind      PinnedItemKind `json:"kind"`
+	AccountID *int64         `json:"account_id,omitempty"`
+	Category  *string        `json:"category,omitempty"`
+	Label     string         `json:"label,omitempty"`
+}
+
+// SetPinnedItemsRequest replaces the user's pinned items. Items are shown in
+// the order given.
+type SetPinnedItemsRequest struct {
+	Items []PinnedItemInput `json:"items"`
+}
+
+// WidgetValue is a single resolved pinned number
+type WidgetValue struct {
+	Kind     PinnedItemKind `json:"kind"`
+	Label    string         `json:"label"`
+	Value    float64        `json:"value"`
+	Currency string         `json:"currency"`
+}
+
+// WidgetResponse is the compact payload for widgets and watch complications
+type WidgetResponse struct {
+	Items     []WidgetValue `json:"items"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
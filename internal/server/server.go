@@ -0,0 +1,714 @@
+// Package server wires the services, background jobs and handlers of the
+// API together, so the binary and the integration tests run the same router.
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kengru/odin-wallet/internal/handlers"
+	"github.com/kengru/odin-wallet/internal/jobs"
+	appMiddleware "github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/internal/services/nlparse"
+	"github.com/kengru/odin-wallet/pkg/database"
+	"github.com/kengru/odin-wallet/pkg/hooks"
+	"github.com/kengru/odin-wallet/pkg/tracing"
+)
+
+// Config is what the API needs besides the database. Nil Mailer, Telegram
+// and OCR turn off email, the Telegram bot and receipt OCR.
+type Config struct {
+	SessionSecret    string
+	RegistrationMode models.RegistrationMode
+	AdminEmails      []string
+	QueryTimeout     time.Duration
+	SlowTimeout      time.Duration
+	ReminderDays     int
+	Mailer           *services.Mailer
+	Telegram         *services.TelegramClient
+	OCR              services.OCRProvider
+
+	// Parser reads transactions from text; nil uses the built-in rules
+	Parser nlparse.Parser
+
+	// Hooks are the plugin hooks compiled in; nil runs none
+	Hooks *hooks.Registry
+
+	// FeatureDefaults turns optional features on or off for the whole
+	// deployment; users can still be given their own setting
+	FeatureDefaults map[models.Feature]bool
+
+	// SessionCacheTTL is how long a validated session is trusted without
+	// checking the session store; zero checks on every request
+	SessionCacheTTL time.Duration
+
+	// SessionStore keeps sessions; nil keeps them in the database. Servers
+	// sharing one, such as a Redis store, can run side by side.
+	SessionStore appMiddleware.SessionStore
+
+	// Replication is how the database is replicated; nil is none. Read
+	// replicas refuse writes and skip the background jobs.
+	Replication *database.Replication
+
+	// Tracer traces requests and background jobs; nil traces nothing.
+	// Database statements are traced when the database was opened with
+	// database.Options.Trace.
+	Tracer *tracing.Tracer
+
+	// AuditSinks receive every audit event as it's recorded; nil keeps the
+	// audit log in the database only
+	AuditSinks []services.AuditSink
+}
+
+// Server is the wired-up API. Routes has every /api route, relative to
+// where it's mounted.
+type Server struct {
+	Routes    chi.Router
+	Exchange  *services.ExchangeService
+	Scheduler *jobs.Scheduler
+	Features  *services.FeatureFlags
+
+	// ReportWebhooks delivers the weekly report webhooks, also run hourly
+	// by Scheduler
+	ReportWebhooks *handlers.ReportWebhookHandler
+
+	// Insights works out the spending insights, also run by Scheduler
+	Insights *services.InsightService
+
+	// AuditExport streams audit events to Config.AuditSinks; nil without
+	// sinks
+	AuditExport *services.AuditExporter
+
+	telegram    *handlers.TelegramHandler
+	hooks       *hooks.Registry
+	replication *database.Replication
+	tracer      *tracing.Tracer
+	stop        context.CancelFunc
+}
+
+// New builds the services, registers the background jobs and routes the
+// API. Nothing runs until Start.
+func New(db *sql.DB, cfg Config) (*Server, error) {
+	// Initialize exchange rate service
+	exchangeService := services.NewExchangeService(db)
+
+	notificationService := services.NewNotificationService(db, cfg.Mailer, cfg.Telegram)
+
+	// Flag unusual spending in the notification feed
+	anomalyService := services.NewAnomalyService(db, exchangeService, notificationService)
+
+	// Alert users approaching their overall monthly budget
+	budgetService := services.NewBudgetService(db, exchangeService, notificationService)
+
+	// Remind users of upcoming credit card payments
+	reminderService := services.NewPaymentReminderService(db, notificationService, cfg.ReminderDays)
+
+	// Findings about each user's spending, for the insights feed
+	insightService := services.NewInsightService(db, exchangeService)
+
+	// Notify users when balances cross their alert thresholds
+	balanceAlertService := services.NewBalanceAlertService(db, notificationService)
+
+	parser := cfg.Parser
+	if parser == nil {
+		parser = nlparse.Rules{}
+	}
+
+	hookRegistry := cfg.Hooks
+	if hookRegistry == nil {
+		hookRegistry = hooks.New()
+	}
+
+	// Optional features, per deployment and per user
+	featureFlags := services.NewFeatureFlags(db, cfg.FeatureDefaults)
+
+	// Serializes balance writes per account
+	accountLocker := services.NewAccountLocker()
+
+	// Report balances that drift from their transaction history
+	integrityService := services.NewIntegrityService(db, accountLocker)
+	depreciationService := services.NewDepreciationService(db, accountLocker)
+
+	// Prepared statements for the queries on hot paths
+	stmts := database.NewStatements(db)
+
+	sessionStore := cfg.SessionStore
+	if sessionStore == nil {
+		sessionStore = appMiddleware.NewSQLiteSessionStore(db, stmts)
+	}
+	sessions := appMiddleware.NewSessionCache(sessionStore, cfg.SessionCacheTTL)
+
+	replication := cfg.Replication
+	if replication == nil {
+		replication = database.NewReplication(database.ReplicationOff, "")
+	}
+
+	// Background jobs, which write, so only the primary runs them
+	scheduler := jobs.NewScheduler()
+	scheduler.SetActive(replication.IsPrimary)
+	scheduler.SetTracer(cfg.Tracer)
+	for _, job := range []jobs.Job{
+		{
+			Name:     "exchange_rates",
+			Schedule: "0 6 * * *",
+			Retries:  3,
+			Run: func(ctx context.Context) (string, error) {
+				return "", exchangeService.FetchAndStore(ctx)
+			},
+		},
+		{
+			Name:       "spending_anomalies",
+			Schedule:   "@every 1h",
+			RunAtStart: true,
+			Run: func(ctx context.Context) (string, error) {
+				return "", anomalyService.Run(ctx)
+			},
+		},
+		{
+			Name:       "budget_alerts",
+			Schedule:   "@every 15m",
+			RunAtStart: true,
+			Run: func(ctx context.Context) (string, error) {
+				return "", budgetService.RunAlertChecks(ctx)
+			},
+		},
+		{
+			Name:       "payment_reminders",
+			Schedule:   "@every 1h",
+			RunAtStart: true,
+			Retries:    2,
+			Run: func(ctx context.Context) (string, error) {
+				return "", reminderService.Run(ctx, time.Now())
+			},
+		},
+		{
+			Name:       "spending_insights",
+			Schedule:   "@every 6h",
+			RunAtStart: true,
+			Run: func(ctx context.Context) (string, error) {
+				n, err := insightService.Run(ctx, time.Now())
+				return fmt.Sprintf("%d insights", n), err
+			},
+		},
+		{
+			Name:     "notification_deliveries",
+			Schedule: "@every 5m",
+			Run: func(ctx context.Context) (string, error) {
+				n, err := notificationService.DeliverPending(ctx, time.Now())
+				return fmt.Sprintf("%d notifications delivered", n), err
+			},
+		},
+		{
+			Name:     "credit_score_reminders",
+			Schedule: "0 9 * * *",
+			Run: func(ctx context.Context) (string, error) {
+				n, err := services.RemindCreditScores(ctx, db, notificationService, time.Now())
+				return fmt.Sprintf("%d reminders sent", n), err
+			},
+		},
+		{
+			Name:       "balance_integrity",
+			Schedule:   "@every 24h",
+			RunAtStart: true,
+			Run: func(ctx context.Context) (string, error) {
+				n, err := integrityService.RunCheck(ctx)
+				return fmt.Sprintf("%d accounts with discrepancies", n), err
+			},
+		},
+		{
+			Name:       "asset_depreciation",
+			Schedule:   "0 3 * * *",
+			RunAtStart: true,
+			Run: func(ctx context.Context) (string, error) {
+				n, err := depreciationService.Run(ctx)
+				return fmt.Sprintf("%d assets depreciated", n), err
+			},
+		},
+		{
+			Name:       "expired_sessions",
+			Schedule:   "@every 1h",
+			RunAtStart: true,
+			Run: func(ctx context.Context) (string, error) {
+				result, err := services.CleanupExpired(ctx, db, sessions)
+				return result.String(), err
+			},
+		},
+	} {
+		if err := scheduler.Register(job); err != nil {
+			return nil, fmt.Errorf("failed to register job: %w", err)
+		}
+	}
+
+	// Stream audit events to the security log sinks
+	auditExporter := services.NewAuditExporter(db, cfg.AuditSinks)
+	auditService := services.NewAuditService(db, auditExporter)
+
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(db, sessions, cfg.SessionSecret, cfg.RegistrationMode, cfg.AdminEmails, auditService)
+	accountHandler := handlers.NewAccountHandler(db, stmts, exchangeService, accountLocker, balanceAlertService, auditService)
+	transactionHandler := handlers.NewTransactionHandler(db, stmts, exchangeService, accountLocker, budgetService, balanceAlertService, auditService, hookRegistry)
+	exchangeHandler := handlers.NewExchangeHandler(exchangeService)
+	reportHandler := handlers.NewReportHandler(db, exchangeService, budgetService, hookRegistry)
+	reportWebhookHandler := handlers.NewReportWebhookHandler(db, reportHandler, notificationService)
+	budgetHandler := handlers.NewBudgetHandler(db, budgetService, auditService)
+	featureHandler := handlers.NewFeatureHandler(featureFlags)
+	adminHandler := handlers.NewAdminHandler(db, accountLocker, integrityService, scheduler, notificationService)
+	replicationHandler := handlers.NewReplicationHandler(db, replication)
+	auditExportHandler := handlers.NewAuditExportHandler(auditExporter)
+	notificationHandler := handlers.NewNotificationHandler(db, notificationService)
+	insightHandler := handlers.NewInsightHandler(db, insightService)
+	activityHandler := handlers.NewActivityHandler(db)
+	widgetHandler := handlers.NewWidgetHandler(db, exchangeService, budgetService)
+	planningHandler := handlers.NewPlanningHandler(db, exchangeService)
+	attachmentHandler := handlers.NewAttachmentHandler(db, cfg.OCR)
+	telegramHandler := handlers.NewTelegramHandler(db, cfg.Telegram, transactionHandler, featureFlags)
+	syncHandler := handlers.NewSyncHandler(db, transactionHandler)
+	integrationHandler := handlers.NewIntegrationHandler(db, transactionHandler, parser)
+	balanceFeedHandler := handlers.NewBalanceFeedHandler(db, accountHandler, featureFlags)
+	parseHandler := handlers.NewParseHandler(db, parser)
+	billHandler := handlers.NewBillHandler(db, transactionHandler, auditService)
+	creditScoreHandler := handlers.NewCreditScoreHandler(db, auditService)
+	insuranceHandler := handlers.NewInsuranceHandler(db, auditService)
+	profileHandler := handlers.NewProfileHandler(db, auditService)
+	advisorHandler := handlers.NewAdvisorHandler(db, auditService)
+	periodHandler := handlers.NewPeriodHandler(db, auditService)
+	exportHandler := handlers.NewExportHandler(db)
+	importHandler := handlers.NewImportHandler(db, accountLocker, auditService, hookRegistry)
+
+	// Pay autopay bills on their due date
+	if err := scheduler.Register(jobs.Job{
+		Name:       "bill_autopay",
+		Schedule:   "@every 1h",
+		RunAtStart: true,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := billHandler.PayAutopay(ctx)
+			return fmt.Sprintf("%d bills paid", n), err
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to register job: %w", err)
+	}
+
+	// Post weekly reports to the webhooks users configured
+	if err := scheduler.Register(jobs.Job{
+		Name:       "report_webhooks",
+		Schedule:   "@every 1h",
+		RunAtStart: true,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := reportWebhookHandler.DeliverDue(ctx, time.Now())
+			return fmt.Sprintf("%d reports delivered", n), err
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to register job: %w", err)
+	}
+
+	// API routes
+	r := chi.NewRouter()
+	r.NotFound(handlers.NotFound)
+	r.Use(appMiddleware.Trace(cfg.Tracer))
+	r.Use(appMiddleware.ReadOnlyReplica(replication))
+	r.Use(appMiddleware.QueryTimeout(cfg.QueryTimeout))
+	r.Use(appMiddleware.Localize(db))
+	slow := appMiddleware.RouteTimeout(cfg.SlowTimeout)
+
+	// Auth routes (public)
+	r.Route("/auth", func(r chi.Router) {
+		r.Get("/registration", authHandler.RegistrationInfo)
+		r.Post("/register", authHandler.Register)
+		r.Post("/login", authHandler.Login)
+		r.Post("/logout", authHandler.Logout)
+		r.Post("/token", authHandler.Token)
+		r.Post("/token/revoke", authHandler.RevokeToken)
+		r.Get("/me", authHandler.Me)
+		r.Delete("/me", authHandler.DeleteMe)
+	})
+
+	// Zapier and IFTTT, authenticated by integration key
+	r.Route("/integrations/v1", func(r chi.Router) {
+		r.Use(appMiddleware.APIKey(db))
+		r.Use(appMiddleware.RequireFeature(featureFlags, models.FeatureIntegrations))
+		r.Use(appMiddleware.Localize(db))
+		r.Use(appMiddleware.TrackFeature(db, "integrations"))
+		r.Get("/me", integrationHandler.Me)
+		r.Get("/accounts", accountHandler.List)
+		r.Get("/triggers/transactions", integrationHandler.NewTransactions)
+		r.Get("/triggers/notifications", notificationHandler.List)
+		r.Post("/actions/transactions", integrationHandler.CreateTransaction)
+	})
+
+	// Balances pushed by scripts and banks, authenticated by the feed's
+	// signature
+	r.Post("/integrations/balance", balanceFeedHandler.Receive)
+
+	// Quick add from iOS Shortcuts and Android automations
+	r.With(appMiddleware.APIKey(db), appMiddleware.RequireFeature(featureFlags, models.FeatureIntegrations),
+		appMiddleware.Localize(db), appMiddleware.TrackFeature(db, "quick")).
+		Post("/quick", integrationHandler.Quick)
+
+	// Protected routes
+	r.Group(func(r chi.Router) {
+		r.Use(appMiddleware.Auth(db, sessions, cfg.SessionSecret))
+		// Before Advisor, so advisors read in their own language
+		r.Use(appMiddleware.Localize(db))
+		r.Use(appMiddleware.Advisor(db))
+		r.Use(appMiddleware.Profile(db))
+
+		// User preferences
+		r.Put("/user/preferences", authHandler.UpdatePreferences)
+		r.Post("/user/complete-onboarding", authHandler.CompleteOnboarding)
+		r.Get("/user/features", featureHandler.List)
+
+		// Profile routes
+		r.Route("/profiles", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "profiles"))
+			r.Get("/", profileHandler.List)
+			r.Post("/", profileHandler.Create)
+			r.Patch("/{id}", profileHandler.Update)
+			r.Delete("/{id}", profileHandler.Delete)
+			r.Post("/{id}/accounts", profileHandler.MoveAccount)
+		})
+
+		// Advisor access
+		r.Route("/advisors", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "advisors"))
+			r.Get("/", advisorHandler.List)
+			r.Post("/", advisorHandler.Grant)
+			r.Delete("/{id}", advisorHandler.Revoke)
+			r.Get("/clients", advisorHandler.Clients)
+		})
+
+		// Period closing
+		r.Route("/periods", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "periods"))
+			r.Get("/closing", periodHandler.GetClosing)
+			r.Post("/close", periodHandler.Close)
+			r.Post("/reopen", periodHandler.Reopen)
+		})
+
+		// Plain-text accounting export
+		r.With(appMiddleware.TrackFeature(db, "export"), slow).Get("/export/ledger", exportHandler.Ledger)
+
+		// Migration from GnuCash and Money Manager EX
+		r.Route("/import", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "import"), slow)
+			r.Post("/", importHandler.Import)
+			r.Post("/preview", importHandler.Preview)
+			r.Get("/presets", importHandler.Presets)
+		})
+
+		// Account routes
+		r.Route("/accounts", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "accounts"))
+			r.With(appMiddleware.ETag).Get("/", accountHandler.List)
+			r.Post("/", accountHandler.Create)
+			r.Get("/{id}", accountHandler.Get)
+			r.Put("/{id}", accountHandler.Update)
+			r.Delete("/{id}", accountHandler.Delete)
+			r.Get("/{id}/balance", accountHandler.BalanceAsOf)
+			r.Post("/{id}/adjust-balance", accountHandler.AdjustBalance)
+			r.Post("/{id}/revalue", accountHandler.Revalue)
+			r.Get("/{id}/valuations", accountHandler.ListValuations)
+			r.Post("/{id}/valuations", accountHandler.AddValuation)
+			r.Put("/{id}/depreciation", accountHandler.SetDepreciation)
+			r.Delete("/{id}/depreciation", accountHandler.DeleteDepreciation)
+			r.Post("/{id}/unfreeze", accountHandler.Unfreeze)
+			r.Post("/{id}/convert", accountHandler.Convert)
+			r.Get("/{id}/loan/what-if", accountHandler.LoanWhatIf)
+
+			// Envelopes inside asset accounts
+			r.Get("/{id}/envelopes", accountHandler.ListEnvelopes)
+			r.Post("/{id}/envelopes", accountHandler.CreateEnvelope)
+			r.Put("/{id}/envelopes/{envelopeID}", accountHandler.UpdateEnvelope)
+			r.Delete("/{id}/envelopes/{envelopeID}", accountHandler.DeleteEnvelope)
+			r.Get("/{id}/envelopes/{envelopeID}/allocations", accountHandler.ListAllocations)
+			r.Post("/{id}/envelopes/{envelopeID}/allocations", accountHandler.Allocate)
+
+			// Balance alerts
+			r.Get("/{id}/alerts", accountHandler.ListAlerts)
+			r.Post("/{id}/alerts", accountHandler.CreateAlert)
+			r.Delete("/{id}/alerts/{alertID}", accountHandler.DeleteAlert)
+
+			// Snapshots
+			r.Post("/{id}/snapshot", accountHandler.CreateSnapshot)
+			r.Get("/{id}/snapshots", accountHandler.ListSnapshots)
+			r.Delete("/{id}/snapshots/{snapshotID}", accountHandler.DeleteSnapshot)
+
+			// Transaction routes nested under accounts
+			r.Get("/{id}/transactions", transactionHandler.ListByAccount)
+			r.Post("/{id}/transactions", transactionHandler.Create)
+			r.With(appMiddleware.TrackFeature(db, "transfers")).Post("/{id}/pay", transactionHandler.PayCard)
+		})
+
+		// Overview route
+		r.With(appMiddleware.TrackFeature(db, "overview"), appMiddleware.ETag).Get("/overview", accountHandler.Overview)
+
+		// Bills
+		r.Route("/bills", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "bills"))
+			r.Get("/", billHandler.List)
+			r.Post("/", billHandler.Create)
+			r.Get("/{id}", billHandler.Get)
+			r.Put("/{id}", billHandler.Update)
+			r.Delete("/{id}", billHandler.Delete)
+			r.Post("/{id}/pay", billHandler.Pay)
+			r.Get("/{id}/payments", billHandler.ListPayments)
+		})
+
+		// Credit scores
+		r.Route("/credit-scores", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "credit_scores"))
+			r.Get("/", creditScoreHandler.List)
+			r.Post("/", creditScoreHandler.Create)
+			r.Put("/reminders", creditScoreHandler.SetReminders)
+			r.Delete("/{id}", creditScoreHandler.Delete)
+		})
+
+		// Insurance policies
+		r.Route("/insurance", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "insurance"))
+			r.Get("/", insuranceHandler.List)
+			r.Post("/", insuranceHandler.Create)
+			r.Get("/{id}", insuranceHandler.Get)
+			r.Put("/{id}", insuranceHandler.Update)
+			r.Delete("/{id}", insuranceHandler.Delete)
+			r.Post("/{id}/renew", insuranceHandler.Renew)
+		})
+
+		// Transactions across all accounts
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "transactions"))
+			r.Get("/transactions/categories", transactionHandler.Categories)
+			r.Get("/transactions/recent", transactionHandler.Recent)
+			r.Get("/transactions/search", transactionHandler.Search)
+			r.Post("/transactions/parse", parseHandler.Parse)
+			r.Patch("/transactions/{id}", transactionHandler.Update)
+			r.Post("/transactions/{id}/move", transactionHandler.Move)
+			r.Get("/transactions/reimbursable", transactionHandler.ListReimbursable)
+			r.Post("/transactions/{id}/reimbursement", transactionHandler.LinkReimbursement)
+			r.Delete("/transactions/{id}/reimbursement", transactionHandler.UnlinkReimbursement)
+		})
+
+		// Transfers
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "transfers"))
+			r.Post("/transfers", transactionHandler.Transfer)
+			r.Post("/transfers/atm", transactionHandler.ATMWithdrawal)
+		})
+
+		// Attachments and receipt parsing
+		r.Route("/attachments", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "attachments"))
+			r.Get("/", attachmentHandler.List)
+			r.With(slow).Post("/", attachmentHandler.Upload)
+			r.Get("/{id}/file", attachmentHandler.Download)
+			r.Delete("/{id}", attachmentHandler.Delete)
+			r.With(slow).Post("/{id}/parse", attachmentHandler.Parse)
+		})
+
+		// Offline sync for mobile clients
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "sync"))
+			r.Get("/sync", syncHandler.Pull)
+			r.With(slow).Post("/sync", syncHandler.Push)
+		})
+
+		// Integration keys
+		r.Route("/integrations/keys", func(r chi.Router) {
+			r.Use(appMiddleware.RequireFeature(featureFlags, models.FeatureIntegrations))
+			r.Use(appMiddleware.TrackFeature(db, "integrations"))
+			r.Get("/", integrationHandler.ListKeys)
+			r.Post("/", integrationHandler.CreateKey)
+			r.Delete("/{id}", integrationHandler.DeleteKey)
+		})
+
+		// Balance feeds
+		r.Route("/integrations/balance-feeds", func(r chi.Router) {
+			r.Use(appMiddleware.RequireFeature(featureFlags, models.FeatureBankFeeds))
+			r.Use(appMiddleware.TrackFeature(db, "balance_feeds"))
+			r.Get("/", balanceFeedHandler.List)
+			r.Post("/", balanceFeedHandler.Create)
+			r.Delete("/{id}", balanceFeedHandler.Delete)
+		})
+
+		// Telegram quick entry
+		r.Route("/telegram", func(r chi.Router) {
+			r.Use(appMiddleware.RequireFeature(featureFlags, models.FeatureTelegram))
+			r.Use(appMiddleware.TrackFeature(db, "telegram"))
+			r.Get("/", telegramHandler.Status)
+			r.Put("/", telegramHandler.Update)
+			r.Delete("/", telegramHandler.Unlink)
+			r.Post("/link", telegramHandler.CreateLinkCode)
+		})
+
+		// Exchange rates
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "exchange_rates"))
+			r.Use(appMiddleware.ETag)
+			r.Get("/exchange-rates", exchangeHandler.GetRates)
+			r.Get("/exchange-rates/convert", exchangeHandler.Convert)
+		})
+		r.Route("/exchange/custom", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "exchange_rates"))
+			r.Get("/", exchangeHandler.ListCustomRates)
+			r.Put("/", exchangeHandler.SetCustomRate)
+			r.Delete("/{base}/{target}", exchangeHandler.DeleteCustomRate)
+		})
+
+		// Weekly report webhook. It's kept out of /reports, which advisors
+		// can read, since its URL works as a credential.
+		r.Route("/webhooks/report", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "reports"))
+			r.Get("/", reportWebhookHandler.Get)
+			r.Put("/", reportWebhookHandler.Set)
+			r.Delete("/", reportWebhookHandler.Delete)
+			r.With(slow).Post("/test", reportWebhookHandler.Test)
+		})
+
+		// Reports
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "reports"))
+			r.Get("/reports", reportHandler.GetReport)
+			r.With(slow).Get("/reports/monthly.pdf", reportHandler.MonthlyPDF)
+			r.Get("/reports/compare", reportHandler.Compare)
+			r.Get("/reports/categories/{category}/trend", reportHandler.CategoryTrend)
+			r.Get("/reports/heatmap", reportHandler.Heatmap)
+			r.Get("/reports/by-location", reportHandler.ByLocation)
+			r.Get("/reports/fx-costs", reportHandler.FXCosts)
+			r.Get("/reports/tax", reportHandler.TaxReport)
+			r.Get("/reports/tax/categories", reportHandler.ListTaxCategories)
+			r.Put("/reports/tax/categories/{category}", reportHandler.SetTaxCategory)
+			r.Delete("/reports/tax/categories/{category}", reportHandler.DeleteTaxCategory)
+			r.Get("/reports/investments", reportHandler.Investments)
+			r.With(slow).Get("/reports/year-in-review", reportHandler.YearInReview)
+			r.With(slow).Get("/reports/year-in-review.pdf", reportHandler.YearInReviewPDF)
+		})
+
+		// Planning
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "planning"))
+			r.Get("/planning/debt-payoff", planningHandler.DebtPayoff)
+			r.Get("/planning/retirement", planningHandler.Retirement)
+			r.Get("/planning/emergency-fund", planningHandler.EmergencyFund)
+			r.Get("/planning/runway", planningHandler.Runway)
+		})
+
+		// Budgets
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "budgets"))
+			r.Get("/budgets", budgetHandler.List)
+			r.Get("/budgets/progress", budgetHandler.Progress)
+			r.Get("/budgets/history", budgetHandler.History)
+			r.Get("/budgets/total", budgetHandler.GetTotal)
+			r.Put("/budgets/total", budgetHandler.SetTotal)
+			r.Delete("/budgets/total", budgetHandler.DeleteTotal)
+			r.Get("/budgets/zero-based", budgetHandler.ZeroBased)
+			r.Post("/budgets/zero-based/allocations", budgetHandler.Allocate)
+			r.Post("/budgets", budgetHandler.Set)
+			r.Delete("/budgets/{category}", budgetHandler.Delete)
+		})
+
+		// Widgets
+		r.Group(func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "widgets"))
+			r.Get("/widgets", widgetHandler.Widgets)
+			r.Get("/pinned", widgetHandler.ListPinned)
+			r.Put("/pinned", widgetHandler.SetPinned)
+		})
+
+		// Insights
+		r.Route("/insights", func(r chi.Router) {
+			r.Use(appMiddleware.TrackFeature(db, "insights"))
+			r.Get("/", insightHandler.List)
+			r.With(slow).Post("/refresh", insightHandler.Refresh)
+			r.Post("/{id}/dismiss", insightHandler.Dismiss)
+		})
+
+		// Notifications
+		r.Get("/notifications", notificationHandler.List)
+		r.Get("/notifications/preferences", notificationHandler.Preferences)
+		r.Put("/notifications/preferences", notificationHandler.UpdatePreferences)
+		r.Post("/notifications/acknowledge-all", notificationHandler.AcknowledgeAll)
+		r.Post("/notifications/{id}/acknowledge", notificationHandler.Acknowledge)
+
+		// Activity
+		r.With(appMiddleware.TrackFeature(db, "activity")).Get("/activity", activityHandler.List)
+
+		// Admin
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(appMiddleware.RequireAdmin(db))
+			r.Get("/usage", adminHandler.FeatureUsage)
+			r.Get("/stats", adminHandler.Stats)
+			r.Get("/account-locks", adminHandler.AccountLocks)
+			r.Get("/jobs", adminHandler.Jobs)
+			r.Get("/replication", replicationHandler.Status)
+			r.Post("/replication/checkpoint", replicationHandler.Checkpoint)
+			r.Get("/audit-export", auditExportHandler.Status)
+			r.Get("/integrity", adminHandler.Integrity)
+			r.Post("/integrity/repair", adminHandler.RepairIntegrity)
+			r.Get("/invites", adminHandler.ListInvites)
+			r.Post("/invites", adminHandler.CreateInvite)
+			r.Delete("/invites/{id}", adminHandler.DeleteInvite)
+			r.Get("/announcements", adminHandler.ListAnnouncements)
+			r.Post("/announcements", adminHandler.CreateAnnouncement)
+			r.Delete("/announcements/{id}", adminHandler.DeleteAnnouncement)
+			r.Get("/features", featureHandler.AdminList)
+			r.Put("/features/{feature}/users/{userID}", featureHandler.SetOverride)
+			r.Delete("/features/{feature}/users/{userID}", featureHandler.ClearOverride)
+		})
+	})
+
+	return &Server{Routes: r, Exchange: exchangeService, Scheduler: scheduler, Features: featureFlags, ReportWebhooks: reportWebhookHandler, Insights: insightService,
+		AuditExport: auditExporter, telegram: telegramHandler, hooks: hookRegistry, replication: replication, tracer: cfg.Tracer}, nil
+}
+
+// Start runs the background jobs, the Telegram bot and the audit export
+// until Stop
+func (s *Server) Start(ctx context.Context) {
+	ctx, s.stop = context.WithCancel(ctx)
+
+	// Quick entry over Telegram, answered by the server that can record
+	// the transactions
+	if s.replication.IsPrimary() {
+		s.telegram.StartBot(ctx)
+	}
+
+	s.Scheduler.Start(ctx)
+	// Exporting records each sink's progress, so replicas leave it to the
+	// primary
+	s.AuditExport.Start(ctx, s.replication.IsPrimary)
+	go s.tracer.Run(ctx)
+}
+
+// Stop ends the background work for a safe shutdown, once the HTTP server
+// has stopped taking requests: the Telegram bot, the jobs and the audit
+// export stop, runs in progress and plugin notification hooks finish, and
+// the plugin shutdown hooks run, and the last spans are exported. Audit
+// events not yet exported are sent after the next start. The database is left for the
+// caller to close last. Stop returns early, leaving work unfinished, when
+// ctx ends.
+func (s *Server) Stop(ctx context.Context) error {
+	if s.stop != nil {
+		s.stop()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Scheduler.Wait()
+		s.AuditExport.Wait()
+		s.hooks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("background work still running: %w", ctx.Err())
+	}
+	s.hooks.Shutdown(ctx)
+	// A collector that's down was already logged and shouldn't fail the
+	// shutdown
+	s.tracer.Shutdown(ctx)
+	return nil
+}
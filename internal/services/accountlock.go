@@ -0,0 +1,115 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// AccountLocker serializes balance writes per account. Handlers that read an
+// account balance and write a new one must hold the account's lock for the
+// whole read-modify-write so concurrent requests can't interleave.
+type AccountLocker struct {
+	mu    sync.Mutex
+	locks map[int64]*accountLock
+	stats AccountLockStats
+}
+
+type accountLock struct {
+	mu      sync.Mutex
+	waiters int // goroutines holding or waiting for the lock
+}
+
+// AccountLockStats reports how long requests waited for account locks
+type AccountLockStats struct {
+	Acquisitions int64         `json:"acquisitions"`
+	Contended    int64         `json:"contended"`
+	TotalWait    time.Duration `json:"-"`
+	MaxWait      time.Duration `json:"-"`
+	TotalWaitMs  float64       `json:"total_wait_ms"`
+	AvgWaitMs    float64       `json:"avg_wait_ms"`
+	MaxWaitMs    float64       `json:"max_wait_ms"`
+	ActiveLocks  int           `json:"active_locks"`
+}
+
+// NewAccountLocker creates a new account locker
+func NewAccountLocker() *AccountLocker {
+	return &AccountLocker{locks: make(map[int64]*accountLock)}
+}
+
+// Lock acquires the locks for the given accounts and returns a function that
+// releases them. Locks are always taken in ascending ID order so transfers
+// between the same accounts in opposite directions can't deadlock.
+func (l *AccountLocker) Lock(accountIDs ...int64) (unlock func()) {
+	ids := make([]int64, 0, len(accountIDs))
+	seen := make(map[int64]bool)
+	for _, id := range accountIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	start := time.Now()
+	held := make([]*accountLock, 0, len(ids))
+	contended := false
+	for _, id := range ids {
+		l.mu.Lock()
+		lock, ok := l.locks[id]
+		if !ok {
+			lock = &accountLock{}
+			l.locks[id] = lock
+		}
+		if lock.waiters > 0 {
+			contended = true
+		}
+		lock.waiters++
+		l.mu.Unlock()
+
+		lock.mu.Lock()
+		held = append(held, lock)
+	}
+	l.record(time.Since(start), contended)
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].mu.Unlock()
+			held[i].waiters--
+			if held[i].waiters == 0 {
+				delete(l.locks, ids[i])
+			}
+		}
+	}
+}
+
+func (l *AccountLocker) record(wait time.Duration, contended bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.stats.Acquisitions++
+	if contended {
+		l.stats.Contended++
+	}
+	l.stats.TotalWait += wait
+	if wait > l.stats.MaxWait {
+		l.stats.MaxWait = wait
+	}
+}
+
+// Stats returns a snapshot of the lock wait metrics since startup
+func (l *AccountLocker) Stats() AccountLockStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := l.stats
+	stats.ActiveLocks = len(l.locks)
+	stats.TotalWaitMs = float64(stats.TotalWait) / float64(time.Millisecond)
+	stats.MaxWaitMs = float64(stats.MaxWait) / float64(time.Millisecond)
+	if stats.Acquisitions > 0 {
+		stats.AvgWaitMs = stats.TotalWaitMs / float64(stats.Acquisitions)
+	}
+	return stats
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"math"
+)
+
+// maxAmortizationMonths stops schedules that would take longer than a
+// century to pay off
+const maxAmortizationMonths = 1200
+
+// ErrPaymentTooLow is returned when a payment never pays a balance off
+var ErrPaymentTooLow = errors.New("monthly payment does not cover the interest")
+
+// Payoff summarizes paying a balance off with a fixed monthly payment
+type Payoff struct {
+	Months        int     `json:"months"`
+	TotalInterest float64 `json:"total_interest"`
+	TotalPaid     float64 `json:"total_paid"`
+}
+
+// MonthlyRate converts a yearly interest rate in percent to a monthly rate
+func MonthlyRate(yearlyRatePct float64) float64 {
+	return yearlyRatePct / 100 / 12
+}
+
+// Amortize simulates paying off balance with a fixed monthly payment, with
+// interest charged monthly on the remaining balance. The last payment only
+// covers what is left.
+func Amortize(balance, yearlyRatePct, payment float64) (Payoff, error) {
+	var p Payoff
+	rate := MonthlyRate(yearlyRatePct)
+	for balance > balanceTolerance {
+		if p.Months == maxAmortizationMonths {
+			return p, ErrPaymentTooLow
+		}
+		interest := roundCents(balance * rate)
+		if payment <= interest {
+			return p, ErrPaymentTooLow
+		}
+		paid := math.Min(payment, balance+interest)
+		balance = roundCents(balance + interest - paid)
+		p.Months++
+		p.TotalInterest += interest
+		p.TotalPaid += paid
+	}
+	p.TotalInterest = roundCents(p.TotalInterest)
+	p.TotalPaid = roundCents(p.TotalPaid)
+	return p, nil
+}
+
+func roundCents(x float64) float64 {
+	return math.Round(x*100) / 100
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// Anomaly detection thresholds
+const (
+	anomalyLookbackDays  = 90  // history used for rolling averages
+	anomalyRecentDays    = 7   // transactions checked on each run
+	anomalyMinSamples    = 5   // minimum history before flagging a transaction
+	anomalyStdDevFactor  = 3.0 // how far above the mean a transaction must be
+	anomalyMeanFactor    = 2.0 // and at least this multiple of the mean
+	anomalySpikeFactor   = 1.5 // month-to-date vs average monthly spend
+	anomalySpikeMonths   = 3   // months averaged for category spikes
+	anomalySpikeMinMonth = 2   // months with spending required for a baseline
+)
+
+// AnomalyService flags unusually large transactions and sudden category
+// spikes relative to each user's rolling averages
+type AnomalyService struct {
+	db              *sql.DB
+	exchangeService *ExchangeService
+	notifications   *NotificationService
+}
+
+// NewAnomalyService creates a new anomaly detection service
+func NewAnomalyService(db *sql.DB, exchangeService *ExchangeService, notifications *NotificationService) *AnomalyService {
+	return &AnomalyService{db: db, exchangeService: exchangeService, notifications: notifications}
+}
+
+type spendingRecord struct {
+	id          int64
+	amount      float64
+	category    string
+	description string
+	createdAt   time.Time
+}
+
+// Run analyzes every user's recent spending
+func (s *AnomalyService) Run(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, COALESCE(preferred_currency, 'DOP') FROM users")
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	type user struct {
+		id       int64
+		currency string
+	}
+	var users []user
+	for rows.Next() {
+		var u user
+		if err := rows.Scan(&u.id, &u.currency); err != nil {
+			continue
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+
+	for _, u := range users {
+		if err := s.analyzeUser(ctx, u.id, u.currency, time.Now()); err != nil {
+			log.Printf("Anomaly detection failed for user %d: %v", u.id, err)
+		}
+	}
+	return nil
+}
+
+func (s *AnomalyService) analyzeUser(ctx context.Context, userID int64, baseCurrency string, now time.Time) error {
+	since := now.AddDate(0, 0, -(anomalyLookbackDays + anomalyRecentDays))
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	if spikeStart := monthStart.AddDate(0, -anomalySpikeMonths, 0); spikeStart.Before(since) {
+		since = spikeStart
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id, t.amount, COALESCE(t.category, 'other'), COALESCE(t.description, ''), t.created_at, a.currency
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND t.type IN ('withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('transfer', 'opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ?
+		ORDER BY t.created_at
+	`, userID, since)
+	if err != nil {
+		return fmt.Errorf("failed to fetch transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var records []spendingRecord
+	for rows.Next() {
+		var r spendingRecord
+		var currency string
+		if err := rows.Scan(&r.id, &r.amount, &r.category, &r.description, &r.createdAt, &currency); err != nil {
+			continue
+		}
+		r.description = DecryptField(userID, r.description)
+		if currency != baseCurrency {
+			if converted, err := s.exchangeService.ConvertFor(userID, r.amount, currency, baseCurrency); err == nil {
+				r.amount = converted
+			}
+		}
+		records = append(records, r)
+	}
+
+	s.flagLargeTransactions(ctx, userID, baseCurrency, records, now)
+	s.flagCategorySpikes(ctx, userID, baseCurrency, records, monthStart)
+	return nil
+}
+
+// flagLargeTransactions compares each recent transaction with the same
+// category's history, falling back to all spending when the category has
+// too little history
+func (s *AnomalyService) flagLargeTransactions(ctx context.Context, userID int64, currency string, records []spendingRecord, now time.Time) {
+	recentCutoff := now.AddDate(0, 0, -anomalyRecentDays)
+	locale := UserLocale(ctx, s.db, userID)
+
+	for _, r := range records {
+		if r.createdAt.Before(recentCutoff) {
+			continue
+		}
+
+		windowStart := r.createdAt.AddDate(0, 0, -anomalyLookbackDays)
+		var categoryHistory, allHistory []float64
+		for _, h := range records {
+			if h.id == r.id || h.createdAt.Before(windowStart) || !h.createdAt.Before(r.createdAt) {
+				continue
+			}
+			allHistory = append(allHistory, h.amount)
+			if h.category == r.category {
+				categoryHistory = append(categoryHistory, h.amount)
+			}
+		}
+
+		history := categoryHistory
+		if len(history) < anomalyMinSamples {
+			history = allHistory
+		}
+		if len(history) < anomalyMinSamples {
+			continue
+		}
+
+		mean, stdDev := meanStdDev(history)
+		if r.amount <= mean+anomalyStdDevFactor*stdDev || r.amount <= anomalyMeanFactor*mean {
+			continue
+		}
+
+		label := r.description
+		if label == "" {
+			label = r.category
+		}
+		err := s.notifications.Notify(ctx, userID, models.NotificationAnomalyTransaction,
+			"Unusually large transaction",
+			fmt.Sprintf("%s for %s is %.1fx your usual %s.", label,
+				FormatMoney(r.amount, currency, locale), r.amount/mean, FormatMoney(mean, currency, locale)),
+			fmt.Sprintf("anomaly:tx:%d", r.id),
+			map[string]interface{}{
+				"transaction_id": r.id,
+				"category":       r.category,
+				"amount":         r.amount,
+				"average":        mean,
+				"currency":       currency,
+			})
+		if err != nil {
+			log.Printf("Failed to notify anomaly: %v", err)
+		}
+	}
+}
+
+// flagCategorySpikes compares month-to-date spending per category with the
+// average of the previous months
+func (s *AnomalyService) flagCategorySpikes(ctx context.Context, userID int64, currency string, records []spendingRecord, monthStart time.Time) {
+	baselineStart := monthStart.AddDate(0, -anomalySpikeMonths, 0)
+	locale := UserLocale(ctx, s.db, userID)
+
+	current := make(map[string]float64)
+	monthly := make(map[string]map[string]float64) // category -> month -> total
+	for _, r := range records {
+		switch {
+		case !r.createdAt.Before(monthStart):
+			current[r.category] += r.amount
+		case !r.createdAt.Before(baselineStart):
+			if monthly[r.category] == nil {
+				monthly[r.category] = make(map[string]float64)
+			}
+			monthly[r.category][r.createdAt.Format("2006-01")] += r.amount
+		}
+	}
+
+	for category, spent := range current {
+		months := monthly[category]
+		if len(months) < anomalySpikeMinMonth {
+			continue
+		}
+		var total float64
+		for _, amount := range months {
+			total += amount
+		}
+		average := total / anomalySpikeMonths
+		if average <= 0 || spent <= anomalySpikeFactor*average {
+			continue
+		}
+
+		percent := (spent - average) / average * 100
+		err := s.notifications.Notify(ctx, userID, models.NotificationAnomalyCategory,
+			"Spending spike in "+category,
+			fmt.Sprintf("You have spent %s on %s this month, %.0f%% more than your %d-month average of %s.",
+				FormatMoney(spent, currency, locale), category, percent, anomalySpikeMonths, FormatMoney(average, currency, locale)),
+			fmt.Sprintf("anomaly:spike:%s:%s", category, monthStart.Format("2006-01")),
+			map[string]interface{}{
+				"category": category,
+				"amount":   spent,
+				"average":  average,
+				"month":    monthStart.Format("2006-01"),
+				"currency": currency,
+			})
+		if err != nil {
+			log.Printf("Failed to notify spending spike: %v", err)
+		}
+	}
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// AuditService records what users did: logins, account and budget changes
+// and transactions. It feeds the activity stream.
+type AuditService struct {
+	db       *sql.DB
+	exporter *AuditExporter
+}
+
+// NewAuditService records events, streaming them off the server with
+// exporter; a nil exporter keeps them in the database only
+func NewAuditService(db *sql.DB, exporter *AuditExporter) *AuditService {
+	return &AuditService{db: db, exporter: exporter}
+}
+
+// Record stores an event. Failures are logged rather than returned: the
+// change being audited has already happened.
+func (s *AuditService) Record(ctx context.Context, event models.AuditEvent) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	var details interface{}
+	if len(event.Details) > 0 {
+		encoded, err := json.Marshal(event.Details)
+		if err == nil {
+			details = string(encoded)
+		}
+	}
+
+	// The request may have been cancelled right after the change committed
+	ctx = context.WithoutCancel(ctx)
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO audit_log (user_id, type, action, entity_id, summary, details, ip_address, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.UserID, event.Type, event.Action, event.EntityID, event.Summary, details, nullIfEmpty(event.IPAddress), event.CreatedAt)
+	if err != nil {
+		log.Printf("Failed to record audit event %s.%s for user %d: %v", event.Type, event.Action, event.UserID, err)
+		return
+	}
+	s.exporter.Notify()
+}
+
+// ClientIP returns the address a request came from, without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+const (
+	// auditExportBatch is how many events are sent to a sink at a time
+	auditExportBatch = 100
+	// auditExportPoll is how often sinks are checked without a new event,
+	// which picks up events recorded by another process
+	auditExportPoll = 30 * time.Second
+	// auditExportMaxDelay caps the wait between retries of a failing sink
+	auditExportMaxDelay = 5 * time.Minute
+)
+
+// AuditSink receives audit events streamed off the server. Events are
+// delivered at least once, in order.
+type AuditSink interface {
+	// Name identifies the sink's progress; renaming one starts it over
+	Name() string
+	Send(ctx context.Context, events []models.ExportedAuditEvent) error
+}
+
+// AuditExporter streams new audit events to the configured sinks. The
+// audit log itself is the buffer: each sink's position in it is kept in
+// audit_export_cursors, so a sink that's down gets everything it missed
+// once it's back, even across restarts.
+type AuditExporter struct {
+	db     *sql.DB
+	sinks  []AuditSink
+	notify chan struct{}
+
+	// flushing serializes exports, so no event is sent twice at once
+	flushing sync.Mutex
+	running  sync.WaitGroup
+}
+
+// NewAuditExporter creates an exporter to sinks. It's nil, exporting
+// nothing, without sinks.
+func NewAuditExporter(db *sql.DB, sinks []AuditSink) *AuditExporter {
+	if len(sinks) == 0 {
+		return nil
+	}
+	return &AuditExporter{db: db, sinks: sinks, notify: make(chan struct{}, 1)}
+}
+
+// Notify tells the exporter an event was recorded
+func (e *AuditExporter) Notify() {
+	if e == nil {
+		return
+	}
+	select {
+	case e.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Start exports in the background until ctx is cancelled, as soon as
+// events are recorded. Failing sinks are retried with a doubling delay;
+// the others carry on. Nothing is exported while active returns false, as
+// on a read replica.
+func (e *AuditExporter) Start(ctx context.Context, active func() bool) {
+	if e == nil {
+		return
+	}
+	e.running.Add(1)
+	go func() {
+		defer e.running.Done()
+		delay := time.Duration(0)
+		for {
+			wait := auditExportPoll
+			if delay > 0 {
+				wait = delay
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-e.notify:
+				// A failing sink waits out its delay
+				if delay > 0 {
+					<-timer.C
+				}
+			case <-timer.C:
+			}
+			timer.Stop()
+
+			if active != nil && !active() {
+				continue
+			}
+			if err := e.Flush(ctx); err != nil && ctx.Err() == nil {
+				delay = min(max(2*delay, time.Second), auditExportMaxDelay)
+				continue
+			}
+			delay = 0
+		}
+	}()
+}
+
+// Wait blocks until the background export stopped after its context was
+// cancelled
+func (e *AuditExporter) Wait() {
+	if e == nil {
+		return
+	}
+	e.running.Wait()
+}
+
+// Flush sends every sink the events it hasn't had yet. A sink seen for the
+// first time starts after the newest event rather than with the whole log.
+// It returns the first sink's error, after trying all of them.
+func (e *AuditExporter) Flush(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.flushing.Lock()
+	defer e.flushing.Unlock()
+
+	var firstErr error
+	for _, sink := range e.sinks {
+		if err := e.flushSink(ctx, sink); err != nil {
+			if ctx.Err() != nil {
+				// Shutting down, which isn't the sink's fault
+				return err
+			}
+			log.Printf("Audit export to %s failed: %v", sink.Name(), err)
+			e.db.ExecContext(context.WithoutCancel(ctx), `
+				UPDATE audit_export_cursors SET failures = failures + 1, last_error = ? WHERE sink = ?
+			`, err.Error(), sink.Name())
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (e *AuditExporter) flushSink(ctx context.Context, sink AuditSink) error {
+	if _, err := e.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO audit_export_cursors (sink, last_id)
+		SELECT ?, COALESCE(MAX(id), 0) FROM audit_log
+	`, sink.Name()); err != nil {
+		return fmt.Errorf("failed to start sink: %w", err)
+	}
+	var lastID int64
+	if err := e.db.QueryRowContext(ctx, "SELECT last_id FROM audit_export_cursors WHERE sink = ?", sink.Name()).Scan(&lastID); err != nil {
+		return fmt.Errorf("failed to read sink position: %w", err)
+	}
+
+	for {
+		events, err := e.pending(ctx, lastID)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		if err := sink.Send(ctx, events); err != nil {
+			return err
+		}
+		lastID = events[len(events)-1].ID
+		if _, err := e.db.ExecContext(context.WithoutCancel(ctx), `
+			UPDATE audit_export_cursors SET last_id = ?, failures = 0, last_error = NULL, last_success_at = ?
+			WHERE sink = ?
+		`, lastID, time.Now(), sink.Name()); err != nil {
+			return fmt.Errorf("failed to save sink position: %w", err)
+		}
+	}
+}
+
+// pending returns the next batch of events after lastID
+func (e *AuditExporter) pending(ctx context.Context, lastID int64) ([]models.ExportedAuditEvent, error) {
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT a.id, a.user_id, COALESCE(u.email, ''), a.type, a.action, a.entity_id, a.summary, a.details, a.ip_address, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON a.user_id = u.id
+		WHERE a.id > ?
+		ORDER BY a.id
+		LIMIT ?
+	`, lastID, auditExportBatch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.ExportedAuditEvent
+	for rows.Next() {
+		var event models.ExportedAuditEvent
+		var entityID sql.NullInt64
+		var details, ipAddress sql.NullString
+		if err := rows.Scan(&event.ID, &event.UserID, &event.UserEmail, &event.Type, &event.Action, &entityID,
+			&event.Summary, &details, &ipAddress, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if entityID.Valid {
+			event.EntityID = &entityID.Int64
+		}
+		if details.Valid && json.Valid([]byte(details.String)) {
+			event.Details = json.RawMessage(details.String)
+		}
+		event.IPAddress = ipAddress.String
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Status reports each sink's progress
+func (e *AuditExporter) Status(ctx context.Context) ([]models.AuditSinkStatus, error) {
+	statuses := []models.AuditSinkStatus{}
+	if e == nil {
+		return statuses, nil
+	}
+	for _, sink := range e.sinks {
+		status := models.AuditSinkStatus{Sink: sink.Name()}
+		var lastError sql.NullString
+		var lastSuccessAt sql.NullTime
+		err := e.db.QueryRowContext(ctx, `
+			SELECT last_id, failures, last_error, last_success_at FROM audit_export_cursors WHERE sink = ?
+		`, sink.Name()).Scan(&status.LastID, &status.Failures, &lastError, &lastSuccessAt)
+		if err == sql.ErrNoRows {
+			// Not started yet; it starts after the newest event
+			statuses = append(statuses, status)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		status.LastError = lastError.String
+		if lastSuccessAt.Valid {
+			status.LastSuccessAt = &lastSuccessAt.Time
+		}
+		if err := e.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log WHERE id > ?", status.LastID).Scan(&status.Pending); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// AuditSinksFromEnv configures the audit export sinks: AUDIT_SYSLOG_ADDR
+// (udp://, tcp:// or tls:// host:port) for a syslog server, and
+// AUDIT_WEBHOOK_URL with an optional AUDIT_WEBHOOK_SECRET for an HTTP
+// endpoint. Neither set exports nothing.
+func AuditSinksFromEnv(getenv func(string) string) ([]AuditSink, error) {
+	var sinks []AuditSink
+	if addr := getenv("AUDIT_SYSLOG_ADDR"); addr != "" {
+		sink, err := NewSyslogSink(addr)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if endpoint := getenv("AUDIT_WEBHOOK_URL"); endpoint != "" {
+		sink, err := NewWebhookSink(endpoint, getenv("AUDIT_WEBHOOK_SECRET"))
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// SyslogSink writes each event as an RFC 5424 message whose text is the
+// event in JSON, with the auth facility. Over TCP and TLS, messages are
+// framed by octet counting (RFC 6587).
+type SyslogSink struct {
+	network  string
+	addr     string
+	tls      *tls.Config
+	hostname string
+
+	conn net.Conn
+}
+
+// NewSyslogSink parses an address such as udp://logs.example.com:514
+func NewSyslogSink(rawURL string) (*SyslogSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid AUDIT_SYSLOG_ADDR %q: expected udp://, tcp:// or tls:// host:port", rawURL)
+	}
+	sink := &SyslogSink{addr: u.Host}
+	switch u.Scheme {
+	case "udp", "tcp":
+		sink.network = u.Scheme
+	case "tls":
+		sink.network = "tcp"
+		sink.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("invalid AUDIT_SYSLOG_ADDR %q: expected udp://, tcp:// or tls:// host:port", rawURL)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("invalid AUDIT_SYSLOG_ADDR %q: missing port", rawURL)
+	}
+	sink.hostname, _ = os.Hostname()
+	if sink.hostname == "" {
+		sink.hostname = "-"
+	}
+	return sink, nil
+}
+
+func (s *SyslogSink) Name() string { return "syslog" }
+
+// Send writes the events on one connection, reconnecting on the next call
+// after an error
+func (s *SyslogSink) Send(ctx context.Context, events []models.ExportedAuditEvent) error {
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		var err error
+		if s.tls != nil {
+			s.conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.tls}).DialContext(ctx, s.network, s.addr)
+		} else {
+			s.conn, err = dialer.DialContext(ctx, s.network, s.addr)
+		}
+		if err != nil {
+			s.conn = nil
+			return fmt.Errorf("failed to connect: %w", err)
+		}
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	for _, event := range events {
+		msg, err := s.format(event)
+		if err != nil {
+			return err
+		}
+		if s.network == "tcp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+		if _, err := s.conn.Write(msg); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("failed to write: %w", err)
+		}
+	}
+	return nil
+}
+
+// format builds "<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG";
+// PRI 38 is the auth facility at the informational level
+func (s *SyslogSink) format(event models.ExportedAuditEvent) ([]byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("<38>1 %s %s odin-wallet %d audit - ",
+		event.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"), s.hostname, os.Getpid())
+	return append([]byte(header), body...), nil
+}
+
+// WebhookSink posts batches of events as {"events": [...]}. With a secret,
+// requests are signed like report webhooks in X-Wallet-Signature.
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func NewWebhookSink(endpoint, secret string) (*WebhookSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid AUDIT_WEBHOOK_URL %q: expected an http:// or https:// URL", endpoint)
+	}
+	return &WebhookSink{url: endpoint, secret: secret, client: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (s *WebhookSink) Name() string { return "webhook" }
+
+func (s *WebhookSink) Send(ctx context.Context, events []models.ExportedAuditEvent) error {
+	body, err := json.Marshal(map[string]interface{}{"events": events})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "OdinWallet-Webhook/1")
+	req.Header.Set("X-Wallet-Event", "audit")
+	if s.secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Wallet-Signature", "t="+timestamp+",v1="+SignWebhook(s.secret, timestamp, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook signs a webhook body sent at timestamp: the hex HMAC-SHA256
+// of "<timestamp>.<body>" with the secret
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
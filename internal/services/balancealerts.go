@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// BalanceAlertService evaluates users' balance alerts after balances change
+type BalanceAlertService struct {
+	db            *sql.DB
+	notifications *NotificationService
+}
+
+// NewBalanceAlertService creates a new balance alert service
+func NewBalanceAlertService(db *sql.DB, notifications *NotificationService) *BalanceAlertService {
+	return &BalanceAlertService{db: db, notifications: notifications}
+}
+
+// Check evaluates an account's alerts against its current balance. Alerts
+// that just crossed their threshold notify the user; alerts whose balance
+// recovered re-arm so the next crossing notifies again.
+func (s *BalanceAlertService) Check(ctx context.Context, accountID int64) error {
+	var userID int64
+	var name, currency string
+	var accountType models.AccountType
+	var balance float64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT user_id, name, currency, type,
+		       CASE type
+		           WHEN 'credit_card' THEN COALESCE(credit_owed, 0)
+		           WHEN 'loan' THEN COALESCE(loan_current_owed, 0)
+		           ELSE current_balance
+		       END
+		FROM accounts WHERE id = ?
+	`, accountID).Scan(&userID, &name, &currency, &accountType, &balance)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch account: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id, direction, threshold, triggered FROM balance_alerts WHERE account_id = ?", accountID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch balance alerts: %w", err)
+	}
+	var alerts []models.BalanceAlert
+	for rows.Next() {
+		var a models.BalanceAlert
+		if err := rows.Scan(&a.ID, &a.Direction, &a.Threshold, &a.Triggered); err == nil {
+			alerts = append(alerts, a)
+		}
+	}
+	rows.Close()
+
+	for _, a := range alerts {
+		breached := a.Direction.Breached(balance, a.Threshold)
+		if breached == a.Triggered {
+			continue
+		}
+
+		// Flip the state first so concurrent checks notify only once
+		result, err := s.db.ExecContext(ctx,
+			"UPDATE balance_alerts SET triggered = ?, updated_at = ? WHERE id = ? AND triggered = ?",
+			breached, time.Now(), a.ID, a.Triggered)
+		if err != nil {
+			return fmt.Errorf("failed to update balance alert: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 || !breached || s.notifications == nil {
+			continue
+		}
+
+		locale := UserLocale(ctx, s.db, userID)
+		label := "Balance"
+		if accountType == models.AccountTypeCreditCard || accountType == models.AccountTypeLoan {
+			label = "Amount owed"
+		}
+		message := fmt.Sprintf("%s on %s is %s, %s your alert of %s.",
+			label, name, FormatMoney(balance, currency, locale), a.Direction, FormatMoney(a.Threshold, currency, locale))
+
+		err = s.notifications.Notify(ctx, userID, models.NotificationBalanceAlert,
+			"Balance alert: "+name,
+			message,
+			fmt.Sprintf("balance_alert:%d:%d", a.ID, time.Now().UnixNano()),
+			map[string]interface{}{
+				"account_id": accountID,
+				"alert_id":   a.ID,
+				"direction":  a.Direction,
+				"threshold":  a.Threshold,
+				"balance":    balance,
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
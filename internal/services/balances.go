@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// BalanceChangesSince returns how much the transactions recorded at or after
+// at moved the balance field of each of the user's accounts: deposits, card
+// expenses and signed revalues raise it, withdrawals and payments lower it.
+// Accounts without such transactions are left out.
+func BalanceChangesSince(ctx context.Context, db *sql.DB, userID int64, at time.Time) (map[int64]float64, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.account_id,
+		       COALESCE(SUM(CASE WHEN t.type IN ('deposit', 'expense', 'revalue') THEN t.amount ELSE -t.amount END), 0)
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND t.created_at >= ?
+		GROUP BY t.account_id
+	`, userID, at.In(time.Now().Location()).Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make(map[int64]float64)
+	for rows.Next() {
+		var accountID int64
+		var delta float64
+		if err := rows.Scan(&accountID, &delta); err != nil {
+			return nil, err
+		}
+		changes[accountID] = delta
+	}
+	return changes, rows.Err()
+}
+
+// BalanceBefore undoes changes, the account's entry from
+// BalanceChangesSince, giving the balance it showed just before that
+// instant. Liabilities give the amount owed; loans that haven't recorded a
+// payment yet still owe their initial amount.
+func BalanceBefore(account *models.Account, changes float64) float64 {
+	switch account.Type {
+	case models.AccountTypeCreditCard:
+		return account.GetLiabilityAmount() - changes
+	case models.AccountTypeLoan:
+		owed := account.GetLiabilityAmount()
+		if account.LoanCurrentOwed == nil && account.LoanInitialAmount != nil {
+			owed = *account.LoanInitialAmount
+		}
+		return owed - changes
+	default:
+		return account.CurrentBalance - changes
+	}
+}
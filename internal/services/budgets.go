@@ -0,0 +1,584 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ErrNoTotalBudget is returned when the user has not set an overall cap
+var ErrNoTotalBudget = errors.New("no total budget set")
+
+// totalBudgetAlertThresholds are the percentages of the overall monthly cap
+// that trigger a notification
+var totalBudgetAlertThresholds = []float64{80, 100}
+
+// BudgetService calculates budget progress, including rollover of unspent
+// amounts between periods, and alerts users approaching their overall cap
+type BudgetService struct {
+	db              *sql.DB
+	exchangeService *ExchangeService
+	notifications   *NotificationService
+}
+
+// NewBudgetService creates a new budget service
+func NewBudgetService(db *sql.DB, exchangeService *ExchangeService, notifications *NotificationService) *BudgetService {
+	return &BudgetService{db: db, exchangeService: exchangeService, notifications: notifications}
+}
+
+// List returns the budgets of the user's active profile ordered by category
+func (s *BudgetService) List(ctx context.Context, userID int64) ([]models.CategoryBudget, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, category, monthly_limit, COALESCE(period, 'monthly'), COALESCE(rollover, 0),
+			   created_at, updated_at, freeze_account_id
+		FROM category_budgets
+		WHERE user_id = ? AND profile_id = ?
+		ORDER BY category
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	budgets := []models.CategoryBudget{}
+	for rows.Next() {
+		var b models.CategoryBudget
+		var freezeAccountID sql.NullInt64
+		err := rows.Scan(&b.ID, &b.UserID, &b.Category, &b.MonthlyLimit, &b.Period, &b.Rollover,
+			&b.CreatedAt, &b.UpdatedAt, &freezeAccountID)
+		if err != nil {
+			continue
+		}
+		if freezeAccountID.Valid {
+			b.FreezeAccountID = &freezeAccountID.Int64
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, nil
+}
+
+// History returns every version of the budgets of the user's active
+// profile, oldest first. An empty category returns all categories.
+func (s *BudgetService) History(ctx context.Context, userID int64, category string) ([]models.BudgetVersion, error) {
+	query := `
+		SELECT id, category, monthly_limit, period, rollover, effective_from
+		FROM budget_versions
+		WHERE user_id = ? AND profile_id = ?
+	`
+	args := []interface{}{userID, middleware.GetProfileID(ctx)}
+	if category != "" {
+		query += " AND category = ?"
+		args = append(args, category)
+	}
+	query += " ORDER BY category, effective_from, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.BudgetVersion{}
+	for rows.Next() {
+		var v models.BudgetVersion
+		var limit sql.NullFloat64
+		if err := rows.Scan(&v.ID, &v.Category, &limit, &v.Period, &v.Rollover, &v.EffectiveFrom); err != nil {
+			continue
+		}
+		v.MonthlyLimit = limit.Float64
+		v.Deleted = !limit.Valid
+		versions = append(versions, v)
+	}
+
+	// Each version lasts until the next one for the same category
+	for i := range versions {
+		if i+1 < len(versions) && versions[i+1].Category == versions[i].Category {
+			versions[i].EffectiveTo = &versions[i+1].EffectiveFrom
+		}
+	}
+
+	return versions, nil
+}
+
+// RecordVersion adds a budget version to the active profile, in the
+// transaction that changes category_budgets so the two always agree. A nil
+// limit records a deletion.
+func (s *BudgetService) RecordVersion(ctx context.Context, tx *sql.Tx, userID int64, category string, limit *float64, period models.BudgetPeriod, rollover bool, effectiveFrom time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO budget_versions (user_id, profile_id, category, monthly_limit, period, rollover, effective_from, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, middleware.GetProfileID(ctx), category, limit, string(period), rollover, effectiveFrom, time.Now())
+	return err
+}
+
+// versionAt returns the version in effect at t, or nil if the budget did not
+// exist then. versions must be sorted by effective date.
+func versionAt(versions []models.BudgetVersion, t time.Time) *models.BudgetVersion {
+	var current *models.BudgetVersion
+	for i := range versions {
+		if versions[i].EffectiveFrom.After(t) {
+			break
+		}
+		current = &versions[i]
+	}
+	if current == nil || current.Deleted {
+		return nil
+	}
+	return current
+}
+
+// Progress returns the progress of every budget in effect at at, for the
+// period containing at. Amounts are in the user's preferred currency. Past
+// periods use the limit that was in effect at the end of the period.
+// Budgets with rollover carry unspent amounts forward for as long as the
+// budget has existed with the same period; overspending is not carried.
+func (s *BudgetService) Progress(ctx context.Context, userID int64, at time.Time) ([]models.BudgetProgress, error) {
+	history, err := s.History(ctx, userID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch budgets: %w", err)
+	}
+
+	byCategory := make(map[string][]models.BudgetVersion)
+	var categories []string
+	for _, v := range history {
+		if _, ok := byCategory[v.Category]; !ok {
+			categories = append(categories, v.Category)
+		}
+		byCategory[v.Category] = append(byCategory[v.Category], v)
+	}
+
+	type activeBudget struct {
+		versions []models.BudgetVersion
+		current  *models.BudgetVersion
+		since    time.Time // when the budget was last created
+		runStart time.Time // start of the first period rollover is counted from
+	}
+
+	var active []activeBudget
+	earliest := at
+	now := time.Now()
+	for _, category := range categories {
+		versions := byCategory[category]
+		current := versionAt(versions, at)
+		if current == nil {
+			continue
+		}
+
+		// A finished period uses the version in effect when it ended
+		asOf := at
+		if _, end := current.Period.Bounds(at); !end.After(now) {
+			if v := versionAt(versions, end.Add(-time.Nanosecond)); v != nil && v.Period == current.Period {
+				current, asOf = v, end.Add(-time.Nanosecond)
+			}
+		}
+
+		// Walk back through the versions since the budget was last created.
+		// Rollover only counts periods of the current length.
+		start, _ := current.Period.Bounds(at)
+		since, runStart := current.EffectiveFrom, start
+		samePeriod := true
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			if v.EffectiveFrom.After(asOf) {
+				continue
+			}
+			if v.Deleted {
+				break
+			}
+			since = v.EffectiveFrom
+			samePeriod = samePeriod && v.Period == current.Period
+			if current.Rollover && samePeriod {
+				runStart, _ = current.Period.Bounds(v.EffectiveFrom.In(at.Location()))
+			}
+		}
+		if runStart.Before(earliest) {
+			earliest = runStart
+		}
+
+		active = append(active, activeBudget{versions: versions, current: current, since: since, runStart: runStart})
+	}
+
+	if len(active) == 0 {
+		return []models.BudgetProgress{}, nil
+	}
+
+	currency, err := s.preferredCurrency(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user preferences: %w", err)
+	}
+
+	spending, err := s.spending(ctx, userID, currency, earliest, at)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := make([]models.BudgetProgress, 0, len(active))
+	for _, a := range active {
+		b := a.current
+		start, end := b.Period.Bounds(at)
+
+		var carried float64
+		if b.Rollover {
+			periodStart, periodEnd := a.runStart, a.runStart
+			for periodStart.Before(start) {
+				periodStart, periodEnd = b.Period.Bounds(periodStart)
+				v := versionAt(a.versions, periodEnd.Add(-time.Nanosecond))
+				if v == nil || !v.Rollover {
+					carried = 0
+				} else {
+					unspent := v.MonthlyLimit + carried - spending.total(b.Category, periodStart, periodEnd)
+					carried = max(unspent, 0)
+				}
+				periodStart = periodEnd
+			}
+		}
+
+		spent := spending.total(b.Category, start, end)
+		available := b.MonthlyLimit + carried
+		p := models.BudgetProgress{
+			CategoryBudget: models.CategoryBudget{
+				ID:           b.ID,
+				UserID:       userID,
+				Category:     b.Category,
+				MonthlyLimit: b.MonthlyLimit,
+				Period:       b.Period,
+				Rollover:     b.Rollover,
+				CreatedAt:    a.since,
+				UpdatedAt:    b.EffectiveFrom,
+			},
+			PeriodStart: start.Format("2006-01-02"),
+			PeriodEnd:   end.AddDate(0, 0, -1).Format("2006-01-02"),
+			CarriedOver: carried,
+			Available:   available,
+			Spent:       spent,
+			Remaining:   available - spent,
+			Currency:    currency,
+		}
+		if available > 0 {
+			p.Percentage = spent / available * 100
+		}
+		progress = append(progress, p)
+	}
+
+	return progress, nil
+}
+
+// TotalProgress returns spending against the user's overall monthly cap for
+// the month containing at. Transfers between accounts and opening
+// balances are not spending. The cap belongs to the default profile, so
+// only its accounts count.
+func (s *BudgetService) TotalProgress(ctx context.Context, userID int64, at time.Time) (*models.TotalBudgetProgress, error) {
+	ctx = middleware.WithProfileID(ctx, models.DefaultProfileID)
+
+	var limit sql.NullFloat64
+	err := s.db.QueryRowContext(ctx, "SELECT monthly_budget FROM users WHERE id = ?", userID).Scan(&limit)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to fetch total budget: %w", err)
+	}
+	if !limit.Valid {
+		return nil, ErrNoTotalBudget
+	}
+
+	currency, err := s.preferredCurrency(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user preferences: %w", err)
+	}
+
+	start, end := models.BudgetPeriodMonthly.Bounds(at)
+	spending, err := s.spending(ctx, userID, currency, start, at)
+	if err != nil {
+		return nil, err
+	}
+
+	var spent float64
+	for _, record := range spending {
+		category := models.TransactionCategory(record.category)
+		if category != models.CategoryTransfer && !models.IsSystemCategory(category) && record.createdAt.Before(end) {
+			spent += record.amount
+		}
+	}
+
+	progress := &models.TotalBudgetProgress{
+		MonthlyLimit: limit.Float64,
+		PeriodStart:  start.Format("2006-01-02"),
+		PeriodEnd:    end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Spent:        spent,
+		Remaining:    limit.Float64 - spent,
+		Currency:     currency,
+	}
+	if limit.Float64 > 0 {
+		progress.Percentage = spent / limit.Float64 * 100
+	}
+
+	// Days left including today, when looking at the current month
+	today := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+	if !today.Before(start) && today.Before(end) {
+		progress.DaysRemaining = int(end.Sub(today).Hours()/24 + 0.5)
+	}
+	if progress.DaysRemaining > 0 && progress.Remaining > 0 {
+		progress.DailyAllowance = progress.Remaining / float64(progress.DaysRemaining)
+	}
+
+	return progress, nil
+}
+
+// CheckTotalBudgets notifies users whose spending has crossed an alert
+// threshold of their overall monthly cap. Each threshold is reported once
+// per month.
+func (s *BudgetService) CheckTotalBudgets(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM users WHERE monthly_budget IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	now := time.Now()
+	for _, userID := range userIDs {
+		progress, err := s.TotalProgress(ctx, userID, now)
+		if err != nil {
+			log.Printf("Total budget check failed for user %d: %v", userID, err)
+			continue
+		}
+
+		// Only the highest threshold crossed is reported
+		for i := len(totalBudgetAlertThresholds) - 1; i >= 0; i-- {
+			threshold := totalBudgetAlertThresholds[i]
+			if progress.Percentage < threshold {
+				continue
+			}
+
+			title := fmt.Sprintf("%.0f%% of monthly budget used", threshold)
+			locale := UserLocale(ctx, s.db, userID)
+			message := fmt.Sprintf("You have spent %s of your %s monthly budget.",
+				FormatMoney(progress.Spent, progress.Currency, locale), FormatMoney(progress.MonthlyLimit, progress.Currency, locale))
+			if threshold >= 100 {
+				title = "Monthly budget exceeded"
+				message = fmt.Sprintf("You have spent %s, %s over your monthly budget.",
+					FormatMoney(progress.Spent, progress.Currency, locale), FormatMoney(-progress.Remaining, progress.Currency, locale))
+			}
+
+			err := s.notifications.Notify(ctx, userID, models.NotificationBudgetTotal, title, message,
+				fmt.Sprintf("budget:total:%s:%.0f", progress.PeriodStart[:7], threshold),
+				map[string]interface{}{
+					"threshold":     threshold,
+					"spent":         progress.Spent,
+					"monthly_limit": progress.MonthlyLimit,
+					"currency":      progress.Currency,
+				})
+			if err != nil {
+				log.Printf("Failed to notify total budget: %v", err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// EnforceFreezes freezes the designated account of every exceeded budget in
+// the active profile until the end of the budget's period. Each budget freezes at most once per
+// period, so a manual unfreeze sticks until the next period.
+func (s *BudgetService) EnforceFreezes(ctx context.Context, userID int64) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT category, freeze_account_id, COALESCE(frozen_period, '')
+		FROM category_budgets
+		WHERE user_id = ? AND profile_id = ? AND freeze_account_id IS NOT NULL
+	`, userID, middleware.GetProfileID(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to fetch budgets: %w", err)
+	}
+
+	type freezeRule struct {
+		accountID    int64
+		frozenPeriod string
+	}
+	rules := make(map[string]freezeRule)
+	for rows.Next() {
+		var category string
+		var rule freezeRule
+		if err := rows.Scan(&category, &rule.accountID, &rule.frozenPeriod); err == nil {
+			rules[category] = rule
+		}
+	}
+	rows.Close()
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	progress, err := s.Progress(ctx, userID, now)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range progress {
+		rule, ok := rules[p.Category]
+		if !ok || p.Spent <= p.Available || rule.frozenPeriod == p.PeriodStart {
+			continue
+		}
+
+		_, until := p.Period.Bounds(now)
+		reason := fmt.Sprintf("%s budget exceeded", categoryName(p.Category))
+
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE accounts SET status = ?, frozen_until = ?, frozen_reason = ?, updated_at = ?
+			WHERE id = ? AND user_id = ?
+		`, string(models.AccountStatusFrozen), until, reason, now, rule.accountID, userID)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE category_budgets SET frozen_period = ? WHERE user_id = ? AND profile_id = ? AND category = ?
+			`, p.PeriodStart, userID, middleware.GetProfileID(ctx), p.Category)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to freeze account: %w", err)
+		}
+
+		if s.notifications != nil {
+			err := s.notifications.Notify(ctx, userID, models.NotificationAccountFrozen,
+				"Account frozen",
+				fmt.Sprintf("%s. New expenses on the linked account are blocked until %s.", reason, until.Format("2006-01-02")),
+				fmt.Sprintf("freeze:%d:%s:%s", rule.accountID, p.Category, p.PeriodStart),
+				map[string]interface{}{
+					"account_id":   rule.accountID,
+					"category":     p.Category,
+					"frozen_until": until,
+				})
+			if err != nil {
+				log.Printf("Failed to notify account freeze: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// enforceAllFreezes runs EnforceFreezes for every profile with a freeze rule
+func (s *BudgetService) enforceAllFreezes(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT user_id, profile_id FROM category_budgets WHERE freeze_account_id IS NOT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to fetch users: %w", err)
+	}
+
+	type userProfile struct{ userID, profileID int64 }
+	var profiles []userProfile
+	for rows.Next() {
+		var p userProfile
+		if err := rows.Scan(&p.userID, &p.profileID); err == nil {
+			profiles = append(profiles, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range profiles {
+		if err := s.EnforceFreezes(middleware.WithProfileID(ctx, p.profileID), p.userID); err != nil {
+			log.Printf("Budget freeze check failed for user %d: %v", p.userID, err)
+		}
+	}
+	return nil
+}
+
+// categoryName capitalizes a category for messages
+func categoryName(category string) string {
+	if label, ok := models.CategoryLabels[models.TransactionCategory(category)]; ok {
+		return label
+	}
+	return category
+}
+
+// RunAlertChecks checks overall budgets and enforces budget freezes for
+// every user
+func (s *BudgetService) RunAlertChecks(ctx context.Context) error {
+	if err := s.CheckTotalBudgets(ctx); err != nil {
+		return fmt.Errorf("budget alert check failed: %w", err)
+	}
+	if err := s.enforceAllFreezes(ctx); err != nil {
+		return fmt.Errorf("budget freeze check failed: %w", err)
+	}
+	return nil
+}
+
+type categorySpend struct {
+	category  string
+	amount    float64
+	createdAt time.Time
+}
+
+type spendingHistory []categorySpend
+
+func (h spendingHistory) total(category string, start, end time.Time) float64 {
+	var total float64
+	for _, s := range h {
+		if s.category == category && !s.createdAt.Before(start) && s.createdAt.Before(end) {
+			total += s.amount
+		}
+	}
+	return total
+}
+
+// spending loads the expenses on the active profile's accounts since start,
+// converted to currency.
+// Expenses dated after at are included so the current period is complete.
+func (s *BudgetService) spending(ctx context.Context, userID int64, currency string, start, at time.Time) (spendingHistory, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT COALESCE(t.category, 'other'), t.amount, t.created_at, a.currency
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ? AND t.type IN ('withdrawal', 'expense') AND t.created_at >= ?
+		  AND t.reimbursement_status IS NULL
+	`, userID, middleware.GetProfileID(ctx), start.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var history spendingHistory
+	for rows.Next() {
+		var record categorySpend
+		var accountCurrency string
+		if err := rows.Scan(&record.category, &record.amount, &record.createdAt, &accountCurrency); err != nil {
+			continue
+		}
+		if accountCurrency != currency && s.exchangeService != nil {
+			if converted, err := s.exchangeService.ConvertFor(userID, record.amount, accountCurrency, currency); err == nil {
+				record.amount = converted
+			}
+		}
+		record.createdAt = record.createdAt.In(at.Location())
+		history = append(history, record)
+	}
+	return history, nil
+}
+
+func (s *BudgetService) preferredCurrency(ctx context.Context, userID int64) (string, error) {
+	var preferredCurrency sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT preferred_currency FROM users WHERE id = ?", userID).Scan(&preferredCurrency)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if preferredCurrency.Valid && preferredCurrency.String != "" {
+		return preferredCurrency.String, nil
+	}
+	return "DOP", nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+)
+
+// CleanupResult counts the rows removed by CleanupExpired
+type CleanupResult struct {
+	Sessions      int64
+	RefreshTokens int64
+	LinkCodes     int64
+}
+
+func (r CleanupResult) String() string {
+	return fmt.Sprintf("removed %d expired sessions, %d expired refresh tokens and %d expired Telegram link codes", r.Sessions, r.RefreshTokens, r.LinkCodes)
+}
+
+// CleanupExpired deletes expired sessions from sessions, and expired refresh
+// tokens and Telegram link codes. Expired rows are otherwise only removed
+// when they are presented again.
+func CleanupExpired(ctx context.Context, db *sql.DB, sessions middleware.SessionStore) (CleanupResult, error) {
+	var result CleanupResult
+	var err error
+	result.Sessions, err = sessions.DeleteExpired(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+
+	// Access tokens expire long before the refresh token issued with them, so
+	// an expired family has nothing left to revoke
+	// datetime() normalizes the stored timezone offset before comparing
+	res, err := db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE datetime(expires_at) < datetime('now')")
+	if err != nil {
+		return result, fmt.Errorf("failed to delete expired refresh tokens: %w", err)
+	}
+	result.RefreshTokens, _ = res.RowsAffected()
+
+	res, err = db.ExecContext(ctx, "DELETE FROM telegram_link_codes WHERE datetime(expires_at) < datetime('now')")
+	if err != nil {
+		return result, fmt.Errorf("failed to delete expired link codes: %w", err)
+	}
+	result.LinkCodes, _ = res.RowsAffected()
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// RemindCreditScores asks users with credit score reminders on to record a
+// new score once their latest one is models.CreditScoreReminderMonths old,
+// or when they haven't recorded any. Each user is reminded at most once a
+// quarter. It returns how many reminders were sent.
+func RemindCreditScores(ctx context.Context, db *sql.DB, notifications *NotificationService, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT u.id, (SELECT MAX(recorded_on) FROM credit_scores WHERE user_id = u.id)
+		FROM users u
+		WHERE u.credit_score_reminders = 1
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	type due struct {
+		userID int64
+		latest sql.NullString
+	}
+	var users []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.userID, &d.latest); err != nil {
+			continue
+		}
+		users = append(users, d)
+	}
+	rows.Close()
+
+	staleBefore := now.AddDate(0, -models.CreditScoreReminderMonths, 0).Format("2006-01-02")
+	quarter := fmt.Sprintf("%d-Q%d", now.Year(), (int(now.Month())-1)/3+1)
+	sent := 0
+	for _, u := range users {
+		if u.latest.Valid && u.latest.String > staleBefore {
+			continue
+		}
+
+		dedupeKey := "credit_score:" + quarter
+		var reminded bool
+		err := db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM notifications WHERE user_id = ? AND dedupe_key = ?)
+		`, u.userID, dedupeKey).Scan(&reminded)
+		if err != nil || reminded {
+			continue
+		}
+
+		message := "Check your credit report and record your latest score to keep tracking it."
+		data := map[string]interface{}{}
+		if u.latest.Valid {
+			message = fmt.Sprintf("Your last credit score is from %s. Check your credit report and record your latest score.", u.latest.String)
+			data["last_recorded_on"] = u.latest.String
+		}
+		if err := notifications.Notify(ctx, u.userID, models.NotificationCreditScore, "Time to update your credit score", message, dedupeKey, data); err != nil {
+			log.Printf("Credit score reminder failed for user %d: %v", u.userID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// DebtStrategy decides which debt receives money left over after minimums
+type DebtStrategy string
+
+const (
+	// DebtAvalanche pays the highest interest rate first, which minimizes
+	// total interest
+	DebtAvalanche DebtStrategy = "avalanche"
+	// DebtSnowball pays the smallest balance first, which clears individual
+	// debts soonest
+	DebtSnowball DebtStrategy = "snowball"
+)
+
+// IsValid returns true for a known strategy
+func (s DebtStrategy) IsValid() bool {
+	return s == DebtAvalanche || s == DebtSnowball
+}
+
+// Debt is a balance to pay off, in the plan's currency
+type Debt struct {
+	AccountID          int64   `json:"account_id"`
+	Name               string  `json:"name"`
+	Type               string  `json:"type"`
+	Balance            float64 `json:"balance"`
+	YearlyInterestRate float64 `json:"yearly_interest_rate"`
+	MinimumPayment     float64 `json:"minimum_payment"`
+
+	// Filled in by the plan
+	PayoffMonth   int     `json:"payoff_month"`
+	TotalInterest float64 `json:"total_interest"`
+}
+
+// DebtPayment is one debt's share of a month in the plan
+type DebtPayment struct {
+	AccountID int64   `json:"account_id"`
+	Payment   float64 `json:"payment"`
+	Interest  float64 `json:"interest"`
+	Balance   float64 `json:"balance"`
+}
+
+// DebtPlanMonth is one month of a payoff plan
+type DebtPlanMonth struct {
+	Month     int           `json:"month"`
+	Date      string        `json:"date"` // YYYY-MM
+	Payments  []DebtPayment `json:"payments"`
+	Interest  float64       `json:"interest"`
+	Remaining float64       `json:"remaining"`
+}
+
+// DebtPlan is a month-by-month schedule that pays off every debt
+type DebtPlan struct {
+	Strategy       DebtStrategy    `json:"strategy"`
+	MonthlyBudget  float64         `json:"monthly_budget"`
+	MinimumPayment float64         `json:"minimum_payments"`
+	Months         int             `json:"months"`
+	PayoffDate     string          `json:"payoff_date"`
+	TotalInterest  float64         `json:"total_interest"`
+	TotalPaid      float64         `json:"total_paid"`
+	Debts          []Debt          `json:"debts"`
+	Schedule       []DebtPlanMonth `json:"schedule"`
+}
+
+// BudgetTooLowError is returned when the monthly budget doesn't cover the
+// minimum payments
+type BudgetTooLowError struct {
+	Minimum float64
+}
+
+func (e *BudgetTooLowError) Error() string {
+	return fmt.Sprintf("monthly budget must cover the minimum payments of %.2f", e.Minimum)
+}
+
+// PlanDebtPayoff sequences a fixed monthly budget across debts. Every month
+// interest is charged, each debt gets its minimum payment, and whatever is
+// left goes to the first unpaid debt in strategy order; as debts are paid
+// off their minimums roll into the next one. The first payment is made the
+// month after start.
+func PlanDebtPayoff(debts []Debt, monthlyBudget float64, strategy DebtStrategy, start time.Time) (*DebtPlan, error) {
+	plan := &DebtPlan{
+		Strategy:      strategy,
+		MonthlyBudget: monthlyBudget,
+		Debts:         append([]Debt(nil), debts...),
+		Schedule:      []DebtPlanMonth{},
+	}
+	for _, d := range plan.Debts {
+		plan.MinimumPayment += d.MinimumPayment
+	}
+	plan.MinimumPayment = roundCents(plan.MinimumPayment)
+	if monthlyBudget < plan.MinimumPayment {
+		return nil, &BudgetTooLowError{Minimum: plan.MinimumPayment}
+	}
+
+	sort.SliceStable(plan.Debts, func(i, j int) bool {
+		a, b := plan.Debts[i], plan.Debts[j]
+		if strategy == DebtAvalanche && a.YearlyInterestRate != b.YearlyInterestRate {
+			return a.YearlyInterestRate > b.YearlyInterestRate
+		}
+		return a.Balance < b.Balance
+	})
+
+	balances := make([]float64, len(plan.Debts))
+	var remaining float64
+	for i, d := range plan.Debts {
+		balances[i] = d.Balance
+		remaining += d.Balance
+	}
+
+	for remaining > balanceTolerance {
+		if len(plan.Schedule) == maxAmortizationMonths {
+			return nil, ErrPaymentTooLow
+		}
+		month := DebtPlanMonth{Month: len(plan.Schedule) + 1, Payments: []DebtPayment{}}
+		month.Date = monthLabel(start, month.Month)
+		payments := make([]DebtPayment, len(plan.Debts))
+		available := monthlyBudget
+
+		// Interest and minimum payments
+		for i, d := range plan.Debts {
+			if balances[i] <= balanceTolerance {
+				continue
+			}
+			interest := roundCents(balances[i] * MonthlyRate(d.YearlyInterestRate))
+			balances[i] += interest
+			pay := math.Min(d.MinimumPayment, balances[i])
+			balances[i] = roundCents(balances[i] - pay)
+			available -= pay
+			payments[i] = DebtPayment{AccountID: d.AccountID, Payment: pay, Interest: interest}
+			plan.Debts[i].TotalInterest += interest
+			month.Interest += interest
+		}
+
+		// Everything left goes to debts in strategy order
+		for i := range plan.Debts {
+			if available <= 0 {
+				break
+			}
+			if balances[i] <= balanceTolerance {
+				continue
+			}
+			pay := math.Min(available, balances[i])
+			balances[i] = roundCents(balances[i] - pay)
+			available -= pay
+			payments[i].AccountID = plan.Debts[i].AccountID
+			payments[i].Payment += pay
+		}
+
+		remaining = 0
+		for i := range plan.Debts {
+			if payments[i].AccountID == 0 {
+				continue
+			}
+			payments[i].Payment = roundCents(payments[i].Payment)
+			payments[i].Balance = balances[i]
+			month.Payments = append(month.Payments, payments[i])
+			plan.TotalPaid += payments[i].Payment
+			if balances[i] <= balanceTolerance && plan.Debts[i].PayoffMonth == 0 {
+				plan.Debts[i].PayoffMonth = month.Month
+			}
+			remaining += balances[i]
+		}
+		month.Interest = roundCents(month.Interest)
+		month.Remaining = roundCents(remaining)
+		plan.TotalInterest += month.Interest
+		plan.Schedule = append(plan.Schedule, month)
+
+		// A budget that only covers interest never finishes
+		if month.Month > 1 && month.Remaining >= plan.Schedule[month.Month-2].Remaining {
+			return nil, ErrPaymentTooLow
+		}
+	}
+
+	for i := range plan.Debts {
+		plan.Debts[i].TotalInterest = roundCents(plan.Debts[i].TotalInterest)
+	}
+	plan.Months = len(plan.Schedule)
+	plan.PayoffDate = monthLabel(start, plan.Months)
+	plan.TotalInterest = roundCents(plan.TotalInterest)
+	plan.TotalPaid = roundCents(plan.TotalPaid)
+	return plan, nil
+}
+
+// monthLabel returns the YYYY-MM that is n months after start
+func monthLabel(start time.Time, n int) string {
+	first := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+	return first.AddDate(0, n, 0).Format("2006-01")
+}
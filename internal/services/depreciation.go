@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// DepreciationService lowers the value of asset accounts that have a
+// depreciation schedule, once for every month since it was last applied
+type DepreciationService struct {
+	db     *sql.DB
+	locker *AccountLocker
+}
+
+// NewDepreciationService creates a new depreciation service
+func NewDepreciationService(db *sql.DB, locker *AccountLocker) *DepreciationService {
+	return &DepreciationService{db: db, locker: locker}
+}
+
+// Run applies every schedule that is due and returns how many assets were
+// depreciated. Months missed while the server was down are caught up.
+func (s *DepreciationService) Run(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.account_id, a.user_id, d.method, d.yearly_rate, d.salvage_value, d.base_value, d.last_applied_at
+		FROM asset_depreciation d
+		JOIN accounts a ON d.account_id = a.id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch depreciation schedules: %w", err)
+	}
+	type schedule struct {
+		models.DepreciationSchedule
+		userID int64
+	}
+	var schedules []schedule
+	for rows.Next() {
+		var d schedule
+		if err := rows.Scan(&d.AccountID, &d.userID, &d.Method, &d.YearlyRate, &d.SalvageValue, &d.BaseValue, &d.LastAppliedAt); err != nil {
+			continue
+		}
+		schedules = append(schedules, d)
+	}
+	rows.Close()
+
+	now := time.Now()
+	applied := 0
+	for _, d := range schedules {
+		months := monthsSince(d.LastAppliedAt, now)
+		if months == 0 {
+			continue
+		}
+		changed, err := s.apply(ctx, d.userID, d.DepreciationSchedule, months, now)
+		if err != nil {
+			log.Printf("Depreciation of account %d failed: %v", d.AccountID, err)
+			continue
+		}
+		if changed {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// apply depreciates one asset by the given number of months, never below
+// its salvage value, and moves the schedule forward
+func (s *DepreciationService) apply(ctx context.Context, userID int64, d models.DepreciationSchedule, months int, now time.Time) (bool, error) {
+	unlock := s.locker.Lock(d.AccountID)
+	defer unlock()
+
+	var balance float64
+	var version int64
+	err := s.db.QueryRowContext(ctx, "SELECT current_balance, version FROM accounts WHERE id = ?", d.AccountID).Scan(&balance, &version)
+	if err != nil {
+		return false, err
+	}
+
+	value := depreciatedValue(d, balance, months)
+	change := math.Round((value-balance)*100) / 100
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if change != 0 {
+		result, err := tx.ExecContext(ctx,
+			"UPDATE accounts SET current_balance = ?, version = version + 1, updated_at = ? WHERE id = ? AND version = ?",
+			value, now, d.AccountID, version)
+		if err != nil {
+			return false, err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			// Changed by another process; the next run picks it up
+			return false, fmt.Errorf("account was modified concurrently")
+		}
+
+		result, err = tx.ExecContext(ctx, `
+			INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, d.AccountID, string(models.TransactionTypeRevalue), change, EncryptField(userID, "Depreciation"), string(models.CategoryOther), value, now)
+		if err != nil {
+			return false, err
+		}
+		transactionID, _ := result.LastInsertId()
+
+		note := "Monthly depreciation"
+		if months > 1 {
+			note = fmt.Sprintf("Depreciation for %d months", months)
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO asset_valuations (account_id, value, change, source, note, transaction_id, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, d.AccountID, value, change, string(models.ValuationDepreciation), note, transactionID, now)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE asset_depreciation SET last_applied_at = ? WHERE account_id = ?",
+		d.LastAppliedAt.AddDate(0, months, 0), d.AccountID)
+	if err != nil {
+		return false, err
+	}
+	return change != 0, tx.Commit()
+}
+
+// depreciatedValue is what an asset worth value is worth after the given
+// number of months on a schedule. An asset already at or below its salvage
+// value keeps its value.
+func depreciatedValue(d models.DepreciationSchedule, value float64, months int) float64 {
+	if value <= d.SalvageValue {
+		return value
+	}
+	monthlyRate := d.YearlyRate / 100 / 12
+	for i := 0; i < months; i++ {
+		switch d.Method {
+		case models.DepreciationDecliningBalance:
+			value -= value * monthlyRate
+		default:
+			value -= d.BaseValue * monthlyRate
+		}
+	}
+	value = math.Max(value, d.SalvageValue)
+	return math.Round(value*100) / 100
+}
+
+// monthsSince counts the whole months from since to now
+func monthsSince(since, now time.Time) int {
+	months := 0
+	for !since.AddDate(0, months+1, 0).After(now) {
+		months++
+	}
+	return months
+}
@@ -1,13 +1,18 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/pkg/tracing"
 )
 
 // ExchangeService handles fetching and caching exchange rates
@@ -17,6 +22,18 @@ type ExchangeService struct {
 	mu         sync.RWMutex
 	rates      map[string]float64 // cache: "USD_DOP" -> rate
 	updatedAt  time.Time
+
+	// Rates users pinned for their own conversions, keyed like rates
+	custom map[int64]map[string]float64
+
+	// Rate tables by base currency, each valid for the update it was built
+	// from
+	byBase map[string]baseRates
+}
+
+type baseRates struct {
+	updatedAt time.Time
+	rates     map[string]float64
 }
 
 // ExchangeRateAPIResponse represents the API response from open.er-api.com
@@ -31,6 +48,8 @@ type ExchangeRates struct {
 	Base      string             `json:"base"`
 	Rates     map[string]float64 `json:"rates"`
 	UpdatedAt time.Time          `json:"updated_at"`
+	// Targets whose rate is the user's custom rate rather than a fetched one
+	Custom []string `json:"custom,omitempty"`
 }
 
 // NewExchangeService creates a new exchange service
@@ -38,18 +57,30 @@ func NewExchangeService(db *sql.DB) *ExchangeService {
 	return &ExchangeService{
 		db: db,
 		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
+			Timeout:   10 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
-		rates: make(map[string]float64),
+		rates:  make(map[string]float64),
+		custom: make(map[int64]map[string]float64),
+		byBase: make(map[string]baseRates),
 	}
 }
 
 // FetchAndStore fetches rates from open.er-api.com and stores them in the database
-func (s *ExchangeService) FetchAndStore() error {
+func (s *ExchangeService) FetchAndStore(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "ExchangeService.FetchAndStore", tracing.SpanKindInternal)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
 	log.Println("Fetching exchange rates from open.er-api.com...")
 
 	// Fetch USD-based rates (this API supports DOP)
-	resp, err := s.httpClient.Get("https://open.er-api.com/v6/latest/USD")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://open.er-api.com/v6/latest/USD", nil)
+	if err != nil {
+		return fmt.Errorf("failed to build exchange rate request: %w", err)
+	}
+	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to fetch exchange rates: %w", err)
 	}
@@ -80,7 +111,7 @@ func (s *ExchangeService) FetchAndStore() error {
 	now := time.Now()
 
 	// Start a transaction
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
@@ -88,7 +119,7 @@ func (s *ExchangeService) FetchAndStore() error {
 
 	// Store USD -> other currencies
 	for currency, rate := range rates {
-		if err := s.upsertRate(tx, "USD", currency, rate, now); err != nil {
+		if err := s.upsertRate(ctx, tx, "USD", currency, rate, now); err != nil {
 			return err
 		}
 	}
@@ -96,7 +127,7 @@ func (s *ExchangeService) FetchAndStore() error {
 	// Store reverse rates (other -> USD)
 	for currency, rate := range rates {
 		if rate > 0 {
-			if err := s.upsertRate(tx, currency, "USD", 1/rate, now); err != nil {
+			if err := s.upsertRate(ctx, tx, currency, "USD", 1/rate, now); err != nil {
 				return err
 			}
 		}
@@ -108,14 +139,14 @@ func (s *ExchangeService) FetchAndStore() error {
 			// DOP to EUR
 			if dopRate > 0 {
 				dopToEur := eurRate / dopRate
-				if err := s.upsertRate(tx, "DOP", "EUR", dopToEur, now); err != nil {
+				if err := s.upsertRate(ctx, tx, "DOP", "EUR", dopToEur, now); err != nil {
 					return err
 				}
 			}
 			// EUR to DOP
 			if eurRate > 0 {
 				eurToDop := dopRate / eurRate
-				if err := s.upsertRate(tx, "EUR", "DOP", eurToDop, now); err != nil {
+				if err := s.upsertRate(ctx, tx, "EUR", "DOP", eurToDop, now); err != nil {
 					return err
 				}
 			}
@@ -124,7 +155,7 @@ func (s *ExchangeService) FetchAndStore() error {
 
 	// Store identity rates (1:1)
 	for _, curr := range supportedCurrencies {
-		if err := s.upsertRate(tx, curr, curr, 1.0, now); err != nil {
+		if err := s.upsertRate(ctx, tx, curr, curr, 1.0, now); err != nil {
 			return err
 		}
 	}
@@ -134,7 +165,7 @@ func (s *ExchangeService) FetchAndStore() error {
 	}
 
 	// Update in-memory cache
-	s.loadRatesFromDB()
+	s.loadRatesFromDB(ctx)
 
 	log.Printf("Exchange rates updated successfully. USD->DOP: %.2f, USD->EUR: %.4f",
 		rates["DOP"], rates["EUR"])
@@ -142,8 +173,8 @@ func (s *ExchangeService) FetchAndStore() error {
 	return nil
 }
 
-func (s *ExchangeService) upsertRate(tx *sql.Tx, base, target string, rate float64, updatedAt time.Time) error {
-	_, err := tx.Exec(`
+func (s *ExchangeService) upsertRate(ctx context.Context, tx *sql.Tx, base, target string, rate float64, updatedAt time.Time) error {
+	_, err := tx.ExecContext(ctx, `
 		INSERT INTO exchange_rates (base_currency, target_currency, rate, updated_at)
 		VALUES (?, ?, ?, ?)
 		ON CONFLICT(base_currency, target_currency) DO UPDATE SET
@@ -157,11 +188,11 @@ func (s *ExchangeService) upsertRate(tx *sql.Tx, base, target string, rate float
 }
 
 // loadRatesFromDB loads all rates from the database into memory
-func (s *ExchangeService) loadRatesFromDB() {
+func (s *ExchangeService) loadRatesFromDB(ctx context.Context) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	rows, err := s.db.Query(`SELECT base_currency, target_currency, rate, updated_at FROM exchange_rates`)
+	rows, err := s.db.QueryContext(ctx, `SELECT base_currency, target_currency, rate, updated_at FROM exchange_rates`)
 	if err != nil {
 		log.Printf("Failed to load exchange rates from DB: %v", err)
 		return
@@ -211,68 +242,231 @@ func (s *ExchangeService) Convert(amount float64, from, to string) (float64, err
 	return amount * rate, nil
 }
 
-// GetAllRates returns all rates for a base currency
-func (s *ExchangeService) GetAllRates(base string) *ExchangeRates {
+// GetRateFor returns the rate a user converts with: their custom rate for
+// the pair (or its inverse) when they set one, otherwise the fetched rate.
+// custom reports whether a custom rate was used.
+func (s *ExchangeService) GetRateFor(userID int64, from, to string) (rate float64, custom bool, ok bool) {
+	if from == to {
+		return 1.0, false, true
+	}
+
+	s.mu.RLock()
+	userRates := s.custom[userID]
+	if rate, ok := userRates[from+"_"+to]; ok {
+		s.mu.RUnlock()
+		return rate, true, true
+	}
+	if rate, ok := userRates[to+"_"+from]; ok {
+		s.mu.RUnlock()
+		return 1 / rate, true, true
+	}
+	s.mu.RUnlock()
+
+	rate, ok = s.GetRate(from, to)
+	return rate, false, ok
+}
+
+// ConvertFor converts an amount with the rates a user converts with
+func (s *ExchangeService) ConvertFor(userID int64, amount float64, from, to string) (float64, error) {
+	rate, _, ok := s.GetRateFor(userID, from, to)
+	if !ok {
+		return 0, fmt.Errorf("exchange rate not found for %s->%s", from, to)
+	}
+	return amount * rate, nil
+}
+
+// HasCustomRates reports whether a user has pinned any rates
+func (s *ExchangeService) HasCustomRates(userID int64) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
+	return len(s.custom[userID]) > 0
+}
 
-	rates := make(map[string]float64)
-	for key, rate := range s.rates {
-		if len(key) > 4 && key[:3] == base && key[3] == '_' {
-			target := key[4:]
-			rates[target] = rate
+// ListCustomRates returns a user's custom rates
+func (s *ExchangeService) ListCustomRates(ctx context.Context, userID int64) ([]models.CustomExchangeRate, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT base_currency, target_currency, rate, updated_at
+		FROM custom_exchange_rates
+		WHERE user_id = ?
+		ORDER BY base_currency, target_currency
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch custom rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []models.CustomExchangeRate{}
+	for rows.Next() {
+		var r models.CustomExchangeRate
+		if err := rows.Scan(&r.Base, &r.Target, &r.Rate, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan custom rate: %w", err)
 		}
+		rates = append(rates, r)
 	}
+	return rates, rows.Err()
+}
 
-	return &ExchangeRates{
-		Base:      base,
-		Rates:     rates,
-		UpdatedAt: s.updatedAt,
+// SetCustomRate pins a user's rate for a pair. A rate for the reverse pair is
+// replaced, since the inverse of this one is used for it.
+func (s *ExchangeService) SetCustomRate(ctx context.Context, userID int64, base, target string, rate float64) (*models.CustomExchangeRate, error) {
+	now := time.Now()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM custom_exchange_rates WHERE user_id = ? AND base_currency = ? AND target_currency = ?
+	`, userID, target, base); err != nil {
+		return nil, fmt.Errorf("failed to replace reverse rate: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO custom_exchange_rates (user_id, base_currency, target_currency, rate, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, base_currency, target_currency) DO UPDATE SET
+			rate = excluded.rate,
+			updated_at = excluded.updated_at
+	`, userID, base, target, rate, now, now); err != nil {
+		return nil, fmt.Errorf("failed to save custom rate: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.custom[userID] == nil {
+		s.custom[userID] = make(map[string]float64)
+	}
+	delete(s.custom[userID], target+"_"+base)
+	s.custom[userID][base+"_"+target] = rate
+	s.mu.Unlock()
+
+	return &models.CustomExchangeRate{Base: base, Target: target, Rate: rate, UpdatedAt: now}, nil
 }
 
-// GetUpdatedAt returns the last update time
-func (s *ExchangeService) GetUpdatedAt() time.Time {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return s.updatedAt
+// DeleteCustomRate removes a user's rate for a pair, going back to the
+// fetched rate. It reports whether there was one.
+func (s *ExchangeService) DeleteCustomRate(ctx context.Context, userID int64, base, target string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM custom_exchange_rates WHERE user_id = ? AND base_currency = ? AND target_currency = ?
+	`, userID, base, target)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete custom rate: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.custom[userID], base+"_"+target)
+	s.mu.Unlock()
+
+	n, _ := result.RowsAffected()
+	return n > 0, nil
 }
 
-// StartDailyUpdater starts a goroutine that updates rates daily
-func (s *ExchangeService) StartDailyUpdater() {
-	go func() {
-		// Calculate time until next 6 AM
-		now := time.Now()
-		next := time.Date(now.Year(), now.Month(), now.Day(), 6, 0, 0, 0, now.Location())
-		if now.After(next) {
-			next = next.Add(24 * time.Hour)
+// loadCustomRates loads every user's custom rates into memory
+func (s *ExchangeService) loadCustomRates(ctx context.Context) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id, base_currency, target_currency, rate FROM custom_exchange_rates`)
+	if err != nil {
+		log.Printf("Failed to load custom exchange rates from DB: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	custom := make(map[int64]map[string]float64)
+	for rows.Next() {
+		var userID int64
+		var base, target string
+		var rate float64
+		if err := rows.Scan(&userID, &base, &target, &rate); err != nil {
+			continue
+		}
+		if custom[userID] == nil {
+			custom[userID] = make(map[string]float64)
 		}
+		custom[userID][base+"_"+target] = rate
+	}
+
+	s.mu.Lock()
+	s.custom = custom
+	s.mu.Unlock()
+}
 
-		// Wait until 6 AM
-		time.Sleep(time.Until(next))
+// GetAllRatesFor returns all rates for a base currency as a user converts
+// with them, listing the targets that use a custom rate
+func (s *ExchangeService) GetAllRatesFor(userID int64, base string) *ExchangeRates {
+	rates := s.GetAllRates(base)
 
-		// Then run every 24 hours
-		ticker := time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for key, rate := range s.custom[userID] {
+		var target string
+		switch {
+		case key[:3] == base:
+			target = key[4:]
+		case key[4:] == base:
+			target = key[:3]
+			rate = 1 / rate
+		default:
+			continue
+		}
+		rates.Rates[target] = rate
+		rates.Custom = append(rates.Custom, target)
+	}
+	sort.Strings(rates.Custom)
+	return rates
+}
 
-		for {
-			if err := s.FetchAndStore(); err != nil {
-				log.Printf("Failed to update exchange rates: %v", err)
+// GetAllRates returns all rates for a base currency. The table is built
+// once per base and rate update; callers get their own copy.
+func (s *ExchangeService) GetAllRates(base string) *ExchangeRates {
+	s.mu.RLock()
+	cached, ok := s.byBase[base]
+	updatedAt := s.updatedAt
+	s.mu.RUnlock()
+
+	if !ok || !cached.updatedAt.Equal(updatedAt) {
+		s.mu.Lock()
+		cached = baseRates{updatedAt: s.updatedAt, rates: make(map[string]float64)}
+		for key, rate := range s.rates {
+			if len(key) > 4 && key[:3] == base && key[3] == '_' {
+				target := key[4:]
+				cached.rates[target] = rate
 			}
-			<-ticker.C
 		}
-	}()
-	log.Println("Daily exchange rate updater started (runs at 6 AM)")
+		// Only real bases are kept, so arbitrary ones can't grow the cache
+		if len(cached.rates) > 0 {
+			s.byBase[base] = cached
+		}
+		s.mu.Unlock()
+	}
+
+	rates := make(map[string]float64, len(cached.rates))
+	for target, rate := range cached.rates {
+		rates[target] = rate
+	}
+	return &ExchangeRates{
+		Base:      base,
+		Rates:     rates,
+		UpdatedAt: cached.updatedAt,
+	}
+}
+
+// GetUpdatedAt returns the last update time
+func (s *ExchangeService) GetUpdatedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.updatedAt
 }
 
 // Init initializes the service by loading from DB or fetching if empty
-func (s *ExchangeService) Init() error {
+func (s *ExchangeService) Init(ctx context.Context) error {
 	// First try to load from DB
-	s.loadRatesFromDB()
+	s.loadRatesFromDB(ctx)
+	s.loadCustomRates(ctx)
 
 	// If no rates in DB or rates are older than 24 hours, fetch new ones
 	if len(s.rates) == 0 || time.Since(s.updatedAt) > 24*time.Hour {
-		if err := s.FetchAndStore(); err != nil {
+		if err := s.FetchAndStore(ctx); err != nil {
 			// If fetch fails but we have cached rates, continue with warning
 			if len(s.rates) > 0 {
 				log.Printf("Warning: Failed to fetch new rates, using cached rates from %v: %v", s.updatedAt, err)
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// FeatureFlags decides which optional features a user gets. A user's
+// override wins over the deployment default, and FEATURE_FLAGS changes the
+// built-in default of a feature.
+type FeatureFlags struct {
+	db       *sql.DB
+	defaults map[models.Feature]bool
+}
+
+func NewFeatureFlags(db *sql.DB, defaults map[models.Feature]bool) *FeatureFlags {
+	all := make(map[models.Feature]bool, len(models.Features))
+	for _, feature := range models.Features {
+		enabled, ok := defaults[feature]
+		if !ok {
+			enabled = feature.OnByDefault()
+		}
+		all[feature] = enabled
+	}
+	return &FeatureFlags{db: db, defaults: all}
+}
+
+// FeatureDefaultsFromEnv reads the deployment defaults from FEATURE_FLAGS, a
+// comma-separated list of features to turn on, e.g. "bank_feeds". A leading
+// "-" turns one off, e.g. "-telegram".
+func FeatureDefaultsFromEnv(getenv func(string) string) (map[models.Feature]bool, error) {
+	defaults := make(map[models.Feature]bool)
+	for _, name := range strings.Split(getenv("FEATURE_FLAGS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		enabled := !strings.HasPrefix(name, "-")
+		feature := models.Feature(strings.TrimPrefix(name, "-"))
+		if !feature.IsValid() {
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS: unknown feature %q", feature)
+		}
+		defaults[feature] = enabled
+	}
+	return defaults, nil
+}
+
+// Defaults returns the deployment-wide setting of every feature
+func (f *FeatureFlags) Defaults() map[models.Feature]bool {
+	defaults := make(map[models.Feature]bool, len(f.defaults))
+	for feature, enabled := range f.defaults {
+		defaults[feature] = enabled
+	}
+	return defaults
+}
+
+// Enabled reports whether a user has a feature. When the override can't be
+// read the deployment default applies.
+func (f *FeatureFlags) Enabled(ctx context.Context, userID int64, feature models.Feature) bool {
+	var enabled bool
+	err := f.db.QueryRowContext(ctx,
+		"SELECT enabled FROM feature_flags WHERE user_id = ? AND feature = ?", userID, feature,
+	).Scan(&enabled)
+	if err == nil {
+		return enabled
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Failed to read feature flag %s for user %d: %v", feature, userID, err)
+	}
+	return f.defaults[feature]
+}
+
+// ForUser returns every feature as the user gets it
+func (f *FeatureFlags) ForUser(ctx context.Context, userID int64) (map[models.Feature]bool, error) {
+	features := f.Defaults()
+	rows, err := f.db.QueryContext(ctx, "SELECT feature, enabled FROM feature_flags WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var feature models.Feature
+		var enabled bool
+		if err := rows.Scan(&feature, &enabled); err != nil {
+			return nil, err
+		}
+		// Overrides of features that were since removed are ignored
+		if feature.IsValid() {
+			features[feature] = enabled
+		}
+	}
+	return features, rows.Err()
+}
+
+// ListOverrides returns every per-user override
+func (f *FeatureFlags) ListOverrides(ctx context.Context) ([]models.FeatureOverride, error) {
+	rows, err := f.db.QueryContext(ctx, `
+		SELECT ff.user_id, u.email, ff.feature, ff.enabled, ff.updated_at
+		FROM feature_flags ff
+		JOIN users u ON ff.user_id = u.id
+		ORDER BY ff.feature, u.email
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []models.FeatureOverride{}
+	for rows.Next() {
+		var o models.FeatureOverride
+		if err := rows.Scan(&o.UserID, &o.Email, &o.Feature, &o.Enabled, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// SetOverride turns a feature on or off for a user. It returns false when
+// the user doesn't exist.
+func (f *FeatureFlags) SetOverride(ctx context.Context, userID int64, feature models.Feature, enabled bool) (bool, error) {
+	result, err := f.db.ExecContext(ctx, `
+		INSERT INTO feature_flags (user_id, feature, enabled, updated_at)
+		SELECT id, ?, ?, ? FROM users WHERE id = ?
+		ON CONFLICT(user_id, feature) DO UPDATE SET
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at
+	`, feature, enabled, time.Now(), userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ClearOverride puts a user back on the deployment default. It returns
+// false when the user had no override.
+func (f *FeatureFlags) ClearOverride(ctx context.Context, userID int64, feature models.Feature) (bool, error) {
+	result, err := f.db.ExecContext(ctx, "DELETE FROM feature_flags WHERE user_id = ? AND feature = ?", userID, feature)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix marks a value encrypted with a per-user field key. Values
+// without it are plaintext written before encryption was enabled.
+const encryptedPrefix = "enc:v1:"
+
+// FieldCipher encrypts sensitive fields (transaction descriptions, notes and
+// locations) with a key derived per user from a server master key, so a copy of
+// the database file doesn't reveal what was spent on
+type FieldCipher struct {
+	master []byte
+	keys   sync.Map // user ID -> cipher.AEAD
+}
+
+var fieldCipher *FieldCipher
+
+// FieldCipherFromEnv reads the 32-byte master key from DATA_ENCRYPTION_KEY
+// (hex or base64) or from the file named by DATA_ENCRYPTION_KEY_FILE, where
+// a KMS or secrets manager can mount it. It returns nil when neither is set,
+// which leaves fields unencrypted.
+func FieldCipherFromEnv(getenv func(string) string) (*FieldCipher, error) {
+	value := getenv("DATA_ENCRYPTION_KEY")
+	if path := getenv("DATA_ENCRYPTION_KEY_FILE"); path != "" {
+		if value != "" {
+			return nil, fmt.Errorf("set only one of DATA_ENCRYPTION_KEY and DATA_ENCRYPTION_KEY_FILE")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read DATA_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		value = string(data)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	master, err := hex.DecodeString(value)
+	if err != nil {
+		master, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil || len(master) != 32 {
+		return nil, fmt.Errorf("data encryption key must be 32 bytes, hex or base64 encoded")
+	}
+	return &FieldCipher{master: master}, nil
+}
+
+// SetFieldCipher enables field encryption for values written from now on.
+// A nil cipher disables it; encrypted values then can't be read back.
+func SetFieldCipher(c *FieldCipher) {
+	fieldCipher = c
+}
+
+// FieldEncryptionEnabled reports whether sensitive fields are encrypted, in
+// which case they can't be searched in SQL
+func FieldEncryptionEnabled() bool {
+	return fieldCipher != nil
+}
+
+// EncryptField encrypts a sensitive value for the user. Empty values and
+// values written while encryption is off are stored as they are.
+func EncryptField(userID int64, value string) string {
+	if fieldCipher == nil || value == "" || strings.HasPrefix(value, encryptedPrefix) {
+		return value
+	}
+	aead, err := fieldCipher.userKey(userID)
+	if err != nil {
+		// Only a broken master key gets here, and that is rejected at startup
+		panic(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// EncryptCoordinate encrypts a latitude or longitude for the user. With
+// encryption off the number is stored as it is.
+func EncryptCoordinate(userID int64, value float64) interface{} {
+	if fieldCipher == nil {
+		return value
+	}
+	return EncryptField(userID, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// DecryptField returns the plaintext of a value stored with EncryptField.
+// Plaintext values pass through unchanged. A value that can't be decrypted
+// (wrong or missing key) is returned as stored.
+func DecryptField(userID int64, value string) string {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value
+	}
+	if fieldCipher == nil {
+		return value
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return value
+	}
+	aead, err := fieldCipher.userKey(userID)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return value
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return value
+	}
+	return string(plaintext)
+}
+
+func (c *FieldCipher) userKey(userID int64) (cipher.AEAD, error) {
+	if aead, ok := c.keys.Load(userID); ok {
+		return aead.(cipher.AEAD), nil
+	}
+	mac := hmac.New(sha256.New, c.master)
+	mac.Write([]byte("odin-wallet field key:" + strconv.FormatInt(userID, 10)))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c.keys.Store(userID, aead)
+	return aead, nil
+}
+
+// EncryptExistingFields encrypts descriptions, notes and locations written
+// before encryption was enabled. It runs at startup and does nothing once every
+// row is encrypted.
+func EncryptExistingFields(ctx context.Context, db *sql.DB) error {
+	if fieldCipher == nil {
+		return nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.id, a.user_id, t.description, t.notes, t.place_name, t.latitude, t.longitude
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE (t.description != '' AND t.description NOT LIKE ?)
+		   OR (t.notes != '' AND t.notes NOT LIKE ?)
+		   OR (t.place_name != '' AND t.place_name NOT LIKE ?)
+		   OR typeof(t.latitude) = 'real' OR typeof(t.longitude) = 'real'
+	`, encryptedPrefix+"%", encryptedPrefix+"%", encryptedPrefix+"%")
+	if err != nil {
+		return fmt.Errorf("failed to fetch transactions: %w", err)
+	}
+	type pending struct {
+		id, userID                                         int64
+		description, notes, placeName, latitude, longitude sql.NullString
+	}
+	var plain []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.userID, &p.description, &p.notes, &p.placeName, &p.latitude, &p.longitude); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		plain = append(plain, p)
+	}
+	rows.Close()
+	if len(plain) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, p := range plain {
+		if _, err := tx.ExecContext(ctx, "UPDATE transactions SET description = ?, notes = ?, place_name = ?, latitude = ?, longitude = ? WHERE id = ?",
+			encryptNull(p.userID, p.description), encryptNull(p.userID, p.notes), encryptNull(p.userID, p.placeName),
+			encryptNull(p.userID, p.latitude), encryptNull(p.userID, p.longitude), p.id); err != nil {
+			return fmt.Errorf("failed to encrypt transaction %d: %w", p.id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Encrypted descriptions, notes and locations of %d existing transactions", len(plain))
+	return nil
+}
+
+func encryptNull(userID int64, value sql.NullString) interface{} {
+	if !value.Valid {
+		return nil
+	}
+	return EncryptField(userID, value.String)
+}
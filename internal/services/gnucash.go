@@ -0,0 +1,202 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// gnucashAccountTypes maps GnuCash account types to the accounts they are
+// imported as. Income, expense and equity accounts become categories.
+var gnucashAccountTypes = map[string]models.AccountType{
+	"BANK":       models.AccountTypeDebit,
+	"CASH":       models.AccountTypeCash,
+	"CREDIT":     models.AccountTypeCreditCard,
+	"ASSET":      models.AccountTypeSaving,
+	"RECEIVABLE": models.AccountTypeSaving,
+	"STOCK":      models.AccountTypeInvestment,
+	"MUTUAL":     models.AccountTypeInvestment,
+	"LIABILITY":  models.AccountTypeLoan,
+	"PAYABLE":    models.AccountTypeLoan,
+}
+
+// gnucashFile is the part of a GnuCash XML book the import reads
+type gnucashFile struct {
+	Accounts     []gnucashAccount     `xml:"book>account"`
+	Transactions []gnucashTransaction `xml:"book>transaction"`
+}
+
+type gnucashAccount struct {
+	ID             string `xml:"id"`
+	Name           string `xml:"name"`
+	Type           string `xml:"type"`
+	CommoditySpace string `xml:"commodity>space"`
+	Commodity      string `xml:"commodity>id"`
+	Parent         string `xml:"parent"`
+}
+
+type gnucashTransaction struct {
+	Currency    string         `xml:"currency>id"`
+	DatePosted  string         `xml:"date-posted>date"`
+	Description string         `xml:"description"`
+	Splits      []gnucashSplit `xml:"splits>split"`
+}
+
+type gnucashSplit struct {
+	Memo     string `xml:"memo"`
+	Value    string `xml:"value"`
+	Quantity string `xml:"quantity"`
+	Account  string `xml:"account"`
+}
+
+// parseGnuCash reads a GnuCash XML book. Bank, cash, credit, asset and
+// liability accounts are imported with their history; income, expense and
+// equity accounts become the categories of the transactions that use them.
+// Splits between two imported accounts are transfers.
+func parseGnuCash(data []byte) (*ImportedBook, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.New("Invalid GnuCash file: it couldn't be decompressed")
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var file gnucashFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, errors.New("Invalid GnuCash file: " + err.Error())
+	}
+
+	accounts := make(map[string]gnucashAccount, len(file.Accounts))
+	for _, a := range file.Accounts {
+		accounts[a.ID] = a
+	}
+	// path is an account's full name below the root, e.g. "Expenses:Auto:Fuel"
+	path := func(id string) string {
+		var parts []string
+		for a, ok := accounts[id]; ok && a.Type != "ROOT" && len(parts) < 32; a, ok = accounts[a.Parent] {
+			parts = append([]string{a.Name}, parts...)
+		}
+		return strings.Join(parts, ":")
+	}
+
+	book := &ImportedBook{}
+	currencies := make(map[string]string)
+	for _, t := range file.Transactions {
+		date, err := time.Parse("2006-01-02 15:04:05 -0700", strings.TrimSpace(t.DatePosted))
+		if err != nil {
+			book.Skipped++
+			continue
+		}
+
+		type posting struct {
+			account string
+			amount  float64
+			memo    string
+		}
+		var real []posting
+		var category posting
+		var categoryType string
+		skipped := false
+		for _, s := range t.Splits {
+			a, ok := accounts[s.Account]
+			if !ok {
+				continue
+			}
+			if _, ok := gnucashAccountTypes[a.Type]; !ok {
+				// The largest income, expense or equity split names the category
+				value := gnucashAmount(s.Value)
+				if a.Type != "TRADING" && a.Type != "ROOT" && math.Abs(value) > math.Abs(category.amount) {
+					category = posting{account: path(a.ID), amount: value}
+					categoryType = a.Type
+				}
+				continue
+			}
+
+			// Securities are tracked by their value in the transaction's currency
+			amount, currency := gnucashAmount(s.Quantity), a.Commodity
+			if a.CommoditySpace != "CURRENCY" && a.CommoditySpace != "ISO4217" {
+				amount, currency = gnucashAmount(s.Value), t.Currency
+			}
+			if amount == 0 {
+				continue
+			}
+			if _, ok := currencies[a.ID]; !ok {
+				currencies[a.ID] = currency
+				book.Accounts = append(book.Accounts, ImportedAccount{Key: a.ID, Name: a.Name, Type: gnucashAccountTypes[a.Type], Currency: currency})
+			}
+			if currencies[a.ID] != currency {
+				skipped = true
+				continue
+			}
+			real = append(real, posting{account: a.ID, amount: amount, memo: s.Memo})
+		}
+		if skipped {
+			book.Skipped++
+		}
+		if len(real) == 0 {
+			if category.amount != 0 {
+				book.Skipped++
+			}
+			continue
+		}
+
+		if len(real) == 2 && category.amount == 0 && (real[0].amount < 0) != (real[1].amount < 0) {
+			from, to := real[0], real[1]
+			if from.amount > 0 {
+				from, to = to, from
+			}
+			book.Entries = append(book.Entries, ImportedEntry{
+				Date:        date,
+				Account:     from.account,
+				Amount:      from.amount,
+				ToAccount:   to.account,
+				ToAmount:    to.amount,
+				Description: t.Description,
+				Notes:       from.memo,
+			})
+			continue
+		}
+
+		for _, p := range real {
+			book.Entries = append(book.Entries, ImportedEntry{
+				Date:        date,
+				Account:     p.account,
+				Amount:      p.amount,
+				Description: t.Description,
+				Notes:       p.memo,
+				Category:    category.account,
+				Opening:     categoryType == "EQUITY",
+			})
+		}
+	}
+
+	return book, nil
+}
+
+// gnucashAmount parses a GnuCash rational amount such as "-12345/100"
+func gnucashAmount(s string) float64 {
+	num, denom, found := strings.Cut(strings.TrimSpace(s), "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(denom, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ImportedAccount is an account read from another app's file
+type ImportedAccount struct {
+	Key      string
+	Name     string
+	Type     models.AccountType
+	Currency string
+}
+
+// ImportedEntry is a transaction read from another app's file. Amount is
+// the signed change in the account's value: positive when money comes into
+// an asset or a debt is paid down. Transfers move -Amount out of Account and
+// ToAmount, in ToAccount's currency, into ToAccount.
+type ImportedEntry struct {
+	Date        time.Time
+	Account     string
+	Amount      float64
+	ToAccount   string
+	ToAmount    float64
+	Description string
+	Notes       string
+	Category    string // the file's category, e.g. "Expenses:Auto:Fuel"
+	Opening     bool   // an opening balance rather than income or spending
+}
+
+// IsTransfer reports whether the entry moves money between two accounts
+func (e ImportedEntry) IsTransfer() bool {
+	return e.ToAccount != ""
+}
+
+// ImportedBook is the accounts and history read from another app's file,
+// ordered by date
+type ImportedBook struct {
+	Format   string
+	Accounts []ImportedAccount
+	Entries  []ImportedEntry
+	Skipped  int // entries that couldn't be represented
+}
+
+// ParseImport reads a GnuCash XML file (compressed or not), a Money Manager
+// EX database or, when format names a bank preset, a bank statement. An empty
+// format is detected from the content.
+func ParseImport(data []byte, format string) (*ImportedBook, error) {
+	if format == "" {
+		switch {
+		case bytes.HasPrefix(data, []byte("SQLite format 3\x00")):
+			format = models.ImportMMEX
+		case bytes.HasPrefix(data, []byte{0x1f, 0x8b}), bytes.Contains(data[:min(len(data), 512)], []byte("<gnc-v2")):
+			format = models.ImportGnuCash
+		default:
+			return nil, errors.New("Unrecognized file: upload a GnuCash XML file or a Money Manager EX database")
+		}
+	}
+
+	var book *ImportedBook
+	var err error
+	switch format {
+	case models.ImportGnuCash:
+		book, err = parseGnuCash(data)
+	case models.ImportMMEX:
+		book, err = parseMMEX(data)
+	default:
+		preset, ok := FindBankPreset(format)
+		if !ok {
+			names := []string{models.ImportGnuCash, models.ImportMMEX}
+			for _, p := range bankPresets {
+				names = append(names, p.Name)
+			}
+			return nil, errors.New("Invalid format. Use one of " + strings.Join(names, ", "))
+		}
+		book, err = parseBankStatement(data, preset)
+	}
+	if err != nil {
+		return nil, err
+	}
+	book.Format = format
+	sort.SliceStable(book.Entries, func(i, j int) bool { return book.Entries[i].Date.Before(book.Entries[j].Date) })
+	return book, nil
+}
+
+// Categories maps each of the file's categories to the category its
+// transactions are imported with: the one suggested for it, unless
+// overrides names another
+func (b *ImportedBook) Categories(overrides map[string]models.TransactionCategory) map[string]models.TransactionCategory {
+	incoming := make(map[string]int)
+	for _, e := range b.Entries {
+		if e.Opening || e.IsTransfer() || e.Category == "" {
+			continue
+		}
+		if e.Amount > 0 {
+			incoming[e.Category]++
+		} else {
+			incoming[e.Category]--
+		}
+	}
+
+	mapping := make(map[string]models.TransactionCategory, len(incoming))
+	for source, n := range incoming {
+		if category, ok := overrides[source]; ok {
+			mapping[source] = category
+		} else {
+			mapping[source] = SuggestCategory(source, n > 0)
+		}
+	}
+	return mapping
+}
+
+// CategoryFor returns the category an entry is imported with, given the
+// mapping returned by Categories
+func (b *ImportedBook) CategoryFor(e ImportedEntry, mapping map[string]models.TransactionCategory) models.TransactionCategory {
+	switch {
+	case e.Opening:
+		return models.CategoryOpeningBalance
+	case e.IsTransfer():
+		return models.CategoryTransfer
+	}
+	if category, ok := mapping[e.Category]; ok {
+		return category
+	}
+	if e.Amount > 0 {
+		return models.CategoryIncome
+	}
+	return models.CategoryOther
+}
+
+// Preview summarizes what importing the book would create, given the
+// mapping returned by Categories
+func (b *ImportedBook) Preview(mapping map[string]models.TransactionCategory) models.ImportPreview {
+	preview := models.ImportPreview{
+		Format:     b.Format,
+		Accounts:   []models.ImportAccountPreview{},
+		Categories: []models.ImportCategoryMapping{},
+		Skipped:    b.Skipped,
+	}
+
+	accounts := make(map[string]*models.ImportAccountPreview)
+	for _, a := range b.Accounts {
+		preview.Accounts = append(preview.Accounts, models.ImportAccountPreview{Name: a.Name, Type: a.Type, Currency: a.Currency})
+	}
+	for i, a := range b.Accounts {
+		accounts[a.Key] = &preview.Accounts[i]
+	}
+
+	categories := make(map[string]*models.ImportCategoryMapping)
+	for _, e := range b.Entries {
+		if a, ok := accounts[e.Account]; ok {
+			a.Balance += e.Amount
+			a.TransactionCount++
+		}
+		if e.IsTransfer() {
+			if a, ok := accounts[e.ToAccount]; ok {
+				a.Balance += e.ToAmount
+				a.TransactionCount++
+			}
+			preview.TransferCount++
+			continue
+		}
+		preview.TransactionCount++
+		if e.Opening || e.Category == "" {
+			continue
+		}
+		c, ok := categories[e.Category]
+		if !ok {
+			c = &models.ImportCategoryMapping{Source: e.Category, Category: mapping[e.Category]}
+			categories[e.Category] = c
+		}
+		c.TransactionCount++
+	}
+	for i := range preview.Accounts {
+		preview.Accounts[i].Balance = math.Round(preview.Accounts[i].Balance*100) / 100
+	}
+	for _, c := range categories {
+		preview.Categories = append(preview.Categories, *c)
+	}
+	sort.Slice(preview.Categories, func(i, j int) bool { return preview.Categories[i].Source < preview.Categories[j].Source })
+
+	if len(b.Entries) > 0 {
+		first := b.Entries[0].Date.Format("2006-01-02")
+		last := b.Entries[len(b.Entries)-1].Date.Format("2006-01-02")
+		preview.FirstDate, preview.LastDate = &first, &last
+	}
+	return preview
+}
+
+// categoryKeywords suggests categories from the words of another app's
+// category names or a bank's transaction descriptions, in English and
+// Spanish. The longest matching keyword wins, so "farmacia" isn't taken for
+// "car"; on a tie earlier entries win, so more specific words come first.
+var categoryKeywords = []struct {
+	category models.TransactionCategory
+	words    []string
+}{
+	{models.CategorySubscriptions, []string{"subscription", "streaming", "suscripci", "netflix", "spotify"}},
+	{models.CategoryUtilities, []string{"utilit", "electric", "water", "phone", "internet", "cable", "edenorte", "edesur", "edeeste", "claro", "altice", "viva", "luz", "agua", "telefon"}},
+	{models.CategoryRent, []string{"rent", "mortgage", "housing", "alquiler", "renta", "hipoteca"}},
+	{models.CategoryGroceries, []string{"grocer", "supermarket", "supermercado", "colmado", "bravo", "jumbo", "sirena"}},
+	{models.CategoryDining, []string{"dining", "restaurant", "meal", "coffee", "cafe", "takeout", "food", "comida", "cafeteria", "pizzeria"}},
+	{models.CategoryTransport, []string{"auto", "car", "fuel", "transport", "taxi", "bus", "parking", "train", "toll", "gasolin", "combustible", "peaje", "parqueo", "uber", "transporte"}},
+	{models.CategoryHealthcare, []string{"health", "medical", "doctor", "dental", "pharmacy", "medicine", "hospital", "farmacia", "clinica", "medic", "salud"}},
+	{models.CategoryFitness, []string{"fitness", "gym", "sport", "gimnasio"}},
+	{models.CategoryGames, []string{"game", "juego"}},
+	{models.CategoryEntertainment, []string{"entertainment", "movie", "music", "hobb", "recreation", "leisure", "cine", "entretenimiento"}},
+	{models.CategoryTravel, []string{"travel", "vacation", "holiday", "hotel", "flight", "airfare", "viaje", "aerolinea", "vuelo"}},
+	{models.CategoryEducation, []string{"education", "school", "tuition", "book", "course", "colegio", "universidad", "escuela", "libreria"}},
+	{models.CategoryShopping, []string{"shopping", "clothing", "clothes", "household", "electronics", "tienda", "ropa"}},
+	{models.CategoryPersonal, []string{"personal", "haircut", "salon", "barberia"}},
+	{models.CategoryGifts, []string{"gift", "charit", "donation", "regalo", "donaci"}},
+}
+
+// incomeKeywords mark categories of money coming in
+var incomeKeywords = []string{"income", "salary", "wage", "paycheck", "bonus", "interest", "dividend", "nomina", "salario", "sueldo", "interes", "ingreso"}
+
+// SuggestCategory picks the category closest to another app's category
+// name, e.g. "Expenses:Auto:Fuel" becomes transport. Income is only
+// suggested for money coming in.
+func SuggestCategory(source string, income bool) models.TransactionCategory {
+	words := strings.FieldsFunc(foldText(source), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) > 0 {
+		leaf := models.TransactionCategory(words[len(words)-1])
+		for _, c := range models.AllCategories() {
+			if c == leaf && c != models.CategoryTransfer && (c != models.CategoryIncome || income) {
+				return c
+			}
+		}
+	}
+
+	// match returns the length of the longest keyword starting a word
+	match := func(keywords []string) int {
+		longest := 0
+		for _, word := range words {
+			for _, keyword := range keywords {
+				if strings.HasPrefix(word, keyword) && len(keyword) > longest {
+					longest = len(keyword)
+				}
+			}
+		}
+		return longest
+	}
+	if income && match(incomeKeywords) > 0 {
+		return models.CategoryIncome
+	}
+	best, bestLength := models.CategoryOther, 0
+	for _, k := range categoryKeywords {
+		if n := match(k.words); n > bestLength {
+			best, bestLength = k.category, n
+		}
+	}
+	if bestLength > 0 {
+		return best
+	}
+	if income {
+		return models.CategoryIncome
+	}
+	return models.CategoryOther
+}
@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// Insight thresholds
+const (
+	insightMinDays          = 3    // days into the month before comparing it with the last
+	insightChangeThreshold  = 0.25 // change in a category's spending worth reporting
+	insightTotalThreshold   = 0.20 // change in all spending worth reporting
+	insightMinShare         = 0.10 // share of the month's spending a changed category must have
+	insightTopShare         = 0.30 // share the top category must have to be reported
+	insightSubscriptionDays = 30   // window subscriptions are totaled over
+)
+
+// InsightService works out findings about each user's spending, such as a
+// category costing much more than last month, and keeps them in the
+// insights table for the user to read and dismiss
+type InsightService struct {
+	db              *sql.DB
+	exchangeService *ExchangeService
+}
+
+func NewInsightService(db *sql.DB, exchangeService *ExchangeService) *InsightService {
+	return &InsightService{db: db, exchangeService: exchangeService}
+}
+
+// generatedInsight is an insight worked out on this run
+type generatedInsight struct {
+	key     string
+	kind    models.InsightKind
+	title   string
+	message string
+	data    map[string]interface{}
+}
+
+// Run works out every user's insights, returning how many are current
+func (s *InsightService) Run(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM users")
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	var users []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+
+	total := 0
+	for _, userID := range users {
+		n, err := s.Generate(ctx, userID, now)
+		if err != nil {
+			log.Printf("Insights failed for user %d: %v", userID, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Generate works out a user's insights for the month of now in each of
+// their profiles. Insights that no longer hold are removed unless the user
+// dismissed them.
+func (s *InsightService) Generate(ctx context.Context, userID int64, now time.Time) (int, error) {
+	var currency string
+	if err := s.db.QueryRowContext(ctx, "SELECT COALESCE(preferred_currency, 'DOP') FROM users WHERE id = ?", userID).Scan(&currency); err != nil {
+		return 0, fmt.Errorf("failed to fetch user: %w", err)
+	}
+	locale := UserLocale(ctx, s.db, userID)
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	since := monthStart.AddDate(0, -1, 0)
+	if subscriptionsStart := now.AddDate(0, 0, -insightSubscriptionDays); subscriptionsStart.Before(since) {
+		since = subscriptionsStart
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.amount, COALESCE(t.category, 'other'), t.created_at, a.currency, a.profile_id
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND t.type IN ('withdrawal', 'expense')
+		  AND COALESCE(t.category, 'other') NOT IN ('transfer', 'opening_balance', 'cash_withdrawal')
+		  AND t.reimbursement_status IS NULL
+		  AND t.created_at >= ?
+	`, userID, since)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch transactions: %w", err)
+	}
+
+	type record struct {
+		amount    float64
+		category  string
+		createdAt time.Time
+	}
+	profiles := map[int64][]record{}
+	for rows.Next() {
+		var r record
+		var accountCurrency string
+		var profileID int64
+		if err := rows.Scan(&r.amount, &r.category, &r.createdAt, &accountCurrency, &profileID); err != nil {
+			continue
+		}
+		if accountCurrency != currency {
+			if converted, err := s.exchangeService.ConvertFor(userID, r.amount, accountCurrency, currency); err == nil {
+				r.amount = converted
+			}
+		}
+		profiles[profileID] = append(profiles[profileID], r)
+	}
+	rows.Close()
+
+	// Profiles without spending this time still get their old insights
+	// cleared
+	profileRows, err := s.db.QueryContext(ctx, "SELECT DISTINCT profile_id FROM insights WHERE user_id = ?", userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch insights: %w", err)
+	}
+	for profileRows.Next() {
+		var profileID int64
+		if profileRows.Scan(&profileID) == nil {
+			if _, ok := profiles[profileID]; !ok {
+				profiles[profileID] = nil
+			}
+		}
+	}
+	profileRows.Close()
+
+	// Last month up to the same point, so a month in progress is compared
+	// fairly
+	prevStart := monthStart.AddDate(0, -1, 0)
+	prevEnd := prevStart.Add(now.Sub(monthStart))
+	if prevEnd.After(monthStart) {
+		prevEnd = monthStart
+	}
+	subscriptionsStart := now.AddDate(0, 0, -insightSubscriptionDays)
+
+	total := 0
+	for profileID, records := range profiles {
+		current, previous := map[string]float64{}, map[string]float64{}
+		var subscriptions float64
+		for _, r := range records {
+			switch {
+			case !r.createdAt.Before(monthStart):
+				current[r.category] += r.amount
+			case !r.createdAt.Before(prevStart) && r.createdAt.Before(prevEnd):
+				previous[r.category] += r.amount
+			}
+			if r.category == string(models.CategorySubscriptions) && !r.createdAt.Before(subscriptionsStart) {
+				subscriptions += r.amount
+			}
+		}
+
+		insights := monthInsights(current, previous, subscriptions, now, currency, locale)
+		if err := s.save(ctx, userID, profileID, monthStart.Format("2006-01"), insights); err != nil {
+			return total, err
+		}
+		total += len(insights)
+	}
+	return total, nil
+}
+
+// monthInsights works out the findings about a month in progress from the
+// spending per category so far, the spending up to the same point last
+// month and the subscriptions paid in the last 30 days
+func monthInsights(current, previous map[string]float64, subscriptions float64, now time.Time, currency, locale string) []generatedInsight {
+	var insights []generatedInsight
+	period := now.Format("2006-01")
+	money := func(amount float64) string { return FormatMoney(amount, currency, locale) }
+
+	var spent, spentBefore float64
+	for _, amount := range current {
+		spent += amount
+	}
+	for _, amount := range previous {
+		spentBefore += amount
+	}
+
+	if now.Day() >= insightMinDays {
+		if spentBefore > 0 && spent > 0 {
+			if change := spent/spentBefore - 1; math.Abs(change) >= insightTotalThreshold {
+				insights = append(insights, generatedInsight{
+					key:   "total_change:" + period,
+					kind:  models.InsightTotalChange,
+					title: fmt.Sprintf("Spending %s %.0f%%", upOrDown(change), math.Abs(change)*100),
+					message: fmt.Sprintf("You spent %.0f%% %s this month: %s so far, against %s by this point last month.",
+						math.Abs(change)*100, moreOrLess(change), money(spent), money(spentBefore)),
+					data: map[string]interface{}{"amount": spent, "previous": spentBefore, "change": change, "currency": currency},
+				})
+			}
+		}
+
+		categories := make([]string, 0, len(current))
+		for category := range current {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			amount, before := current[category], previous[category]
+			if before <= 0 || math.Max(amount, before) < insightMinShare*math.Max(spent, spentBefore) {
+				continue
+			}
+			change := amount/before - 1
+			if math.Abs(change) < insightChangeThreshold {
+				continue
+			}
+			label := categoryLabel(category)
+			insights = append(insights, generatedInsight{
+				key:   "category_change:" + category + ":" + period,
+				kind:  models.InsightCategoryChange,
+				title: fmt.Sprintf("%s %s %.0f%%", label, upOrDown(change), math.Abs(change)*100),
+				message: fmt.Sprintf("You spent %.0f%% %s on %s this month: %s so far, against %s by this point last month.",
+					math.Abs(change)*100, moreOrLess(change), strings.ToLower(label), money(amount), money(before)),
+				data: map[string]interface{}{"category": category, "amount": amount, "previous": before, "change": change, "currency": currency},
+			})
+		}
+
+		top, topAmount := "", 0.0
+		for _, category := range categories {
+			if current[category] > topAmount {
+				top, topAmount = category, current[category]
+			}
+		}
+		if spent > 0 && topAmount/spent >= insightTopShare {
+			label := categoryLabel(top)
+			insights = append(insights, generatedInsight{
+				key:     "top_category:" + period,
+				kind:    models.InsightTopCategory,
+				title:   label + " leads your spending",
+				message: fmt.Sprintf("%s is %.0f%% of what you've spent this month, %s of %s.", label, topAmount/spent*100, money(topAmount), money(spent)),
+				data:    map[string]interface{}{"category": top, "amount": topAmount, "share": topAmount / spent, "currency": currency},
+			})
+		}
+	}
+
+	if subscriptions > 0 {
+		insights = append(insights, generatedInsight{
+			key:   "subscriptions:" + period,
+			kind:  models.InsightSubscriptions,
+			title: fmt.Sprintf("Subscriptions total %s/mo", money(subscriptions)),
+			message: fmt.Sprintf("Your subscriptions came to %s over the last %d days, about %s a year.",
+				money(subscriptions), insightSubscriptionDays, money(subscriptions*12)),
+			data: map[string]interface{}{"amount": subscriptions, "yearly": subscriptions * 12, "currency": currency},
+		})
+	}
+	return insights
+}
+
+func upOrDown(change float64) string {
+	if change > 0 {
+		return "up"
+	}
+	return "down"
+}
+
+func moreOrLess(change float64) string {
+	if change > 0 {
+		return "more"
+	}
+	return "less"
+}
+
+func categoryLabel(category string) string {
+	if label, ok := models.CategoryLabels[models.TransactionCategory(category)]; ok {
+		return label
+	}
+	return category
+}
+
+// save upserts a profile's insights for a period and removes the ones that
+// no longer hold. Dismissed insights are updated but stay dismissed.
+func (s *InsightService) save(ctx context.Context, userID, profileID int64, period string, insights []generatedInsight) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	keys := make([]interface{}, 0, len(insights))
+	for _, insight := range insights {
+		data, err := json.Marshal(insight.data)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO insights (user_id, profile_id, key, kind, title, message, data, period, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id, profile_id, key) DO UPDATE SET
+				title = excluded.title, message = excluded.message, data = excluded.data, updated_at = excluded.updated_at
+		`, userID, profileID, insight.key, string(insight.kind), insight.title, insight.message, string(data), period, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to save insight: %w", err)
+		}
+		keys = append(keys, insight.key)
+	}
+
+	query := "DELETE FROM insights WHERE user_id = ? AND profile_id = ? AND period = ? AND dismissed_at IS NULL"
+	args := []interface{}{userID, profileID, period}
+	if len(keys) > 0 {
+		query += " AND key NOT IN (?" + strings.Repeat(", ?", len(keys)-1) + ")"
+		args = append(args, keys...)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to remove stale insights: %w", err)
+	}
+	return tx.Commit()
+}
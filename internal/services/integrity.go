@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// balanceTolerance absorbs floating point noise when comparing balances
+const balanceTolerance = 0.005
+
+// IntegrityService verifies that stored account balances agree with the
+// transaction history behind them
+type IntegrityService struct {
+	db     *sql.DB
+	locker *AccountLocker
+}
+
+// NewIntegrityService creates a new balance integrity checker
+func NewIntegrityService(db *sql.DB, locker *AccountLocker) *IntegrityService {
+	return &IntegrityService{db: db, locker: locker}
+}
+
+// AccountIntegrity is the result of checking one account. The opening
+// balance is implied by the first transaction's balance_after; every later
+// balance_after should follow from it, and the account's stored balance
+// should equal the last one.
+type AccountIntegrity struct {
+	AccountID            int64   `json:"account_id"`
+	UserID               int64   `json:"user_id"`
+	Name                 string  `json:"name"`
+	Type                 string  `json:"type"`
+	TransactionCount     int     `json:"transaction_count"`
+	OpeningBalance       float64 `json:"opening_balance"`
+	StoredBalance        float64 `json:"stored_balance"`
+	ReconstructedBalance float64 `json:"reconstructed_balance"`
+	Difference           float64 `json:"difference"`
+	ChainBreaks          int     `json:"chain_breaks"`
+	FirstBreakID         *int64  `json:"first_break_transaction_id,omitempty"`
+	Repaired             int     `json:"repaired,omitempty"`
+}
+
+// OK reports whether the account has no discrepancies
+func (a AccountIntegrity) OK() bool {
+	return a.ChainBreaks == 0 && math.Abs(a.Difference) < balanceTolerance
+}
+
+// IntegrityReport summarizes a check across accounts. Only accounts with
+// discrepancies are listed.
+type IntegrityReport struct {
+	CheckedAt       time.Time          `json:"checked_at"`
+	AccountsChecked int                `json:"accounts_checked"`
+	Discrepancies   []AccountIntegrity `json:"discrepancies"`
+	Repaired        bool               `json:"repaired"`
+}
+
+// Check verifies every account, or only accountID when it is non-zero. With
+// repair set, broken balance_after chains are rewritten from the opening
+// balance. Stored account balances are never changed; a remaining
+// difference is reported so it can be fixed with a balance adjustment.
+func (s *IntegrityService) Check(ctx context.Context, accountID int64, repair bool) (*IntegrityReport, error) {
+	query := `
+		SELECT id, user_id, name, type,
+		       CASE type
+		           WHEN 'credit_card' THEN COALESCE(credit_owed, 0)
+		           WHEN 'loan' THEN COALESCE(loan_current_owed, 0)
+		           ELSE current_balance
+		       END
+		FROM accounts`
+	args := []interface{}{}
+	if accountID != 0 {
+		query += " WHERE id = ?"
+		args = append(args, accountID)
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []AccountIntegrity
+	for rows.Next() {
+		var a AccountIntegrity
+		if err := rows.Scan(&a.AccountID, &a.UserID, &a.Name, &a.Type, &a.StoredBalance); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		accounts = append(accounts, a)
+	}
+	rows.Close()
+
+	report := &IntegrityReport{
+		CheckedAt:     time.Now(),
+		Discrepancies: []AccountIntegrity{},
+		Repaired:      repair,
+	}
+	for _, a := range accounts {
+		result, err := s.checkAccount(ctx, a, repair)
+		if err != nil {
+			return nil, fmt.Errorf("account %d: %w", a.AccountID, err)
+		}
+		report.AccountsChecked++
+		if !result.OK() || result.Repaired > 0 {
+			report.Discrepancies = append(report.Discrepancies, result)
+		}
+	}
+
+	return report, nil
+}
+
+func (s *IntegrityService) checkAccount(ctx context.Context, a AccountIntegrity, repair bool) (AccountIntegrity, error) {
+	// Hold the account lock so a concurrent write can't be mistaken for a
+	// discrepancy (or be overwritten by a repair)
+	unlock := s.locker.Lock(a.AccountID)
+	defer unlock()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, type, amount, balance_after
+		FROM transactions
+		WHERE account_id = ?
+		ORDER BY created_at, id
+	`, a.AccountID)
+	if err != nil {
+		return a, err
+	}
+
+	type fix struct {
+		id           int64
+		balanceAfter float64
+	}
+	var fixes []fix
+	var expected float64
+	for rows.Next() {
+		var id int64
+		var txType string
+		var amount, balanceAfter float64
+		if err := rows.Scan(&id, &txType, &amount, &balanceAfter); err != nil {
+			rows.Close()
+			return a, err
+		}
+
+		effect := models.BalanceEffect(models.TransactionType(txType), amount)
+		if a.TransactionCount == 0 {
+			a.OpeningBalance = balanceAfter - effect
+			expected = a.OpeningBalance
+		}
+		a.TransactionCount++
+		expected += effect
+
+		if math.Abs(balanceAfter-expected) >= balanceTolerance {
+			a.ChainBreaks++
+			if a.FirstBreakID == nil {
+				breakID := id
+				a.FirstBreakID = &breakID
+			}
+			fixes = append(fixes, fix{id: id, balanceAfter: expected})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return a, err
+	}
+
+	// Without history there is nothing to reconstruct from
+	if a.TransactionCount == 0 {
+		a.ReconstructedBalance = a.StoredBalance
+		return a, nil
+	}
+	a.ReconstructedBalance = expected
+	a.Difference = a.StoredBalance - a.ReconstructedBalance
+
+	if repair && len(fixes) > 0 {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return a, err
+		}
+		defer tx.Rollback()
+		for _, f := range fixes {
+			if _, err := tx.ExecContext(ctx, "UPDATE transactions SET balance_after = ? WHERE id = ?", f.balanceAfter, f.id); err != nil {
+				return a, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return a, err
+		}
+		a.Repaired = len(fixes)
+	}
+
+	return a, nil
+}
+
+// RunCheck runs a read-only check of every account, logging any whose
+// balances don't match their history, and returns how many there were
+func (s *IntegrityService) RunCheck(ctx context.Context) (int, error) {
+	report, err := s.Check(ctx, 0, false)
+	if err != nil {
+		return 0, err
+	}
+	for _, a := range report.Discrepancies {
+		log.Printf("Balance integrity: account %d (%s) stored %.2f, reconstructed %.2f, %d broken balance_after entries",
+			a.AccountID, a.Name, a.StoredBalance, a.ReconstructedBalance, a.ChainBreaks)
+	}
+	return len(report.Discrepancies), nil
+}
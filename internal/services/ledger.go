@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LedgerFormat is a plain-text accounting file format
+type LedgerFormat string
+
+const (
+	LedgerBeancount LedgerFormat = "beancount"
+	LedgerLedger    LedgerFormat = "ledger"
+)
+
+// LedgerPosting moves Amount of Currency into Account, or out of it when
+// negative. A posting without a currency takes whatever balances the
+// transaction. Cost, when set, is the total value of the posting in
+// CostCurrency, for conversions between currencies.
+type LedgerPosting struct {
+	Account      string
+	Amount       float64
+	Currency     string
+	Cost         float64
+	CostCurrency string
+}
+
+// LedgerTransaction is one balanced entry of a plain-text ledger
+type LedgerTransaction struct {
+	Date      time.Time
+	Narration string
+	Postings  []LedgerPosting
+}
+
+// LedgerAccountName joins components into a hierarchical account name such
+// as "Assets:Debit:Main-Checking". Characters other than letters and digits
+// separate words, and each word is capitalized, since both formats restrict
+// what account names may contain.
+func LedgerAccountName(components ...string) string {
+	parts := make([]string, 0, len(components))
+	for _, c := range components {
+		words := strings.FieldsFunc(c, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, word := range words {
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			words[i] = string(runes)
+		}
+		part := strings.Join(words, "-")
+		if part == "" {
+			part = "Unnamed"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ":")
+}
+
+// WriteLedger writes transactions as a beancount or ledger file. Every
+// account is opened on the day it's first used; accountCurrencies maps
+// accounts to the only currency they hold, where known.
+func WriteLedger(w io.Writer, format LedgerFormat, title string, accountCurrencies map[string]string, transactions []LedgerTransaction) error {
+	opened := make(map[string]time.Time)
+	var accounts []string
+	for _, t := range transactions {
+		for _, p := range t.Postings {
+			if first, ok := opened[p.Account]; !ok || t.Date.Before(first) {
+				if !ok {
+					accounts = append(accounts, p.Account)
+				}
+				opened[p.Account] = t.Date
+			}
+		}
+	}
+	sort.Strings(accounts)
+
+	var b strings.Builder
+	if format == LedgerBeancount {
+		fmt.Fprintf(&b, "option \"title\" %s\n", beancountString(title))
+		b.WriteString("\n")
+		for _, account := range accounts {
+			fmt.Fprintf(&b, "%s open %s", opened[account].Format("2006-01-02"), account)
+			if currency := accountCurrencies[account]; currency != "" {
+				b.WriteString(" " + currency)
+			}
+			b.WriteString("\n")
+		}
+	} else {
+		fmt.Fprintf(&b, "; %s\n", title)
+		b.WriteString("\n")
+		for _, account := range accounts {
+			fmt.Fprintf(&b, "account %s\n", account)
+		}
+	}
+
+	for _, t := range transactions {
+		b.WriteString("\n")
+		if format == LedgerBeancount {
+			fmt.Fprintf(&b, "%s * %s\n", t.Date.Format("2006-01-02"), beancountString(oneLine(t.Narration)))
+		} else {
+			fmt.Fprintf(&b, "%s * %s\n", t.Date.Format("2006-01-02"), oneLine(t.Narration))
+		}
+		for _, p := range t.Postings {
+			if p.Currency == "" {
+				fmt.Fprintf(&b, "  %s\n", p.Account)
+				continue
+			}
+			fmt.Fprintf(&b, "  %-48s  %s %s", p.Account, ledgerAmount(p.Amount, p.Currency), p.Currency)
+			if p.CostCurrency != "" {
+				fmt.Fprintf(&b, " @@ %s %s", ledgerAmount(p.Cost, p.CostCurrency), p.CostCurrency)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ledgerAmount formats an amount with the currency's minor digits
+func ledgerAmount(amount float64, currency string) string {
+	decimals := 2
+	if cf, ok := currencies[currency]; ok {
+		decimals = cf.Decimals
+	}
+	return strconv.FormatFloat(amount, 'f', decimals, 64)
+}
+
+// beancountString quotes s as a beancount string
+func beancountString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// oneLine collapses whitespace, including line breaks, to single spaces
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
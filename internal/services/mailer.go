@@ -0,0 +1,58 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// Mailer sends plain text emails through an SMTP server
+type Mailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// MailerFromEnv configures a mailer from SMTP_HOST, SMTP_PORT (default 587),
+// SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM. It returns nil when SMTP_HOST
+// is not set, which disables email.
+func MailerFromEnv(getenv func(string) string) (*Mailer, error) {
+	host := getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+
+	port := getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := getenv("SMTP_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("SMTP_FROM is required when SMTP_HOST is set")
+	}
+
+	m := &Mailer{addr: net.JoinHostPort(host, port), from: from}
+	if username := getenv("SMTP_USERNAME"); username != "" {
+		m.auth = smtp.PlainAuth("", username, getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+// Send delivers a plain text email to a single recipient
+func (m *Mailer) Send(to, subject, body string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	msg := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// mmexAccountTypes maps Money Manager EX account types to the accounts they
+// are imported as
+var mmexAccountTypes = map[string]models.AccountType{
+	"Cash":        models.AccountTypeCash,
+	"Checking":    models.AccountTypeDebit,
+	"Credit Card": models.AccountTypeCreditCard,
+	"Loan":        models.AccountTypeLoan,
+	"Savings":     models.AccountTypeSaving,
+	"Term":        models.AccountTypeSaving,
+	"Asset":       models.AccountTypeSaving,
+	"Investment":  models.AccountTypeInvestment,
+	"Shares":      models.AccountTypeInvestment,
+}
+
+// parseMMEX reads a Money Manager EX database (.mmb). Both the older schema
+// with a subcategory table and the newer one with nested categories are
+// supported; split transactions become one entry per split.
+func parseMMEX(data []byte) (*ImportedBook, error) {
+	// The SQLite driver only reads files
+	f, err := os.CreateTemp("", "odin-mmex-*.mmb")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+f.Name()+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if !mmexHasColumn(db, "CHECKINGACCOUNT_V1", "TRANSID") || !mmexHasColumn(db, "ACCOUNTLIST_V1", "ACCOUNTID") {
+		return nil, errors.New("Invalid Money Manager EX database: no accounts or transactions were found")
+	}
+
+	categories, err := mmexCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	payees := make(map[int64]string)
+	if rows, err := db.Query("SELECT PAYEEID, PAYEENAME FROM PAYEE_V1"); err == nil {
+		for rows.Next() {
+			var id int64
+			var name sql.NullString
+			if rows.Scan(&id, &name) == nil {
+				payees[id] = name.String
+			}
+		}
+		rows.Close()
+	}
+
+	book := &ImportedBook{}
+	initialDate := "NULL"
+	if mmexHasColumn(db, "ACCOUNTLIST_V1", "INITIALDATE") {
+		initialDate = "a.INITIALDATE"
+	}
+	rows, err := db.Query(`
+		SELECT a.ACCOUNTID, a.ACCOUNTNAME, COALESCE(a.ACCOUNTTYPE, ''), COALESCE(a.INITIALBAL, 0),
+		       COALESCE(c.CURRENCY_SYMBOL, ''), ` + initialDate + `
+		FROM ACCOUNTLIST_V1 a
+		LEFT JOIN CURRENCYFORMATS_V1 c ON a.CURRENCYID = c.CURRENCYID
+		ORDER BY a.ACCOUNTID
+	`)
+	if err != nil {
+		return nil, errors.New("Invalid Money Manager EX database: " + err.Error())
+	}
+	initial := make(map[string]float64)
+	initialDates := make(map[string]string)
+	for rows.Next() {
+		var id int64
+		var name, accountType, currency string
+		var balance float64
+		var date sql.NullString
+		if err := rows.Scan(&id, &name, &accountType, &balance, &currency, &date); err != nil {
+			continue
+		}
+		walletType, ok := mmexAccountTypes[accountType]
+		if !ok {
+			walletType = models.AccountTypeDebit
+		}
+		key := strconv.FormatInt(id, 10)
+		book.Accounts = append(book.Accounts, ImportedAccount{Key: key, Name: name, Type: walletType, Currency: strings.ToUpper(currency)})
+		initial[key] = balance
+		initialDates[key] = date.String
+	}
+	rows.Close()
+
+	subcategory := "-1"
+	if mmexHasColumn(db, "CHECKINGACCOUNT_V1", "SUBCATEGID") {
+		subcategory = "COALESCE(SUBCATEGID, -1)"
+	}
+	deleted := ""
+	if mmexHasColumn(db, "CHECKINGACCOUNT_V1", "DELETEDTIME") {
+		deleted = "AND COALESCE(DELETEDTIME, '') = ''"
+	}
+	rows, err = db.Query(`
+		SELECT TRANSID, ACCOUNTID, COALESCE(TOACCOUNTID, -1), COALESCE(PAYEEID, -1), TRANSCODE,
+		       COALESCE(TRANSAMOUNT, 0), COALESCE(TOTRANSAMOUNT, TRANSAMOUNT, 0), COALESCE(NOTES, ''),
+		       COALESCE(CATEGID, -1), ` + subcategory + `, COALESCE(TRANSDATE, '')
+		FROM CHECKINGACCOUNT_V1
+		WHERE COALESCE(STATUS, '') != 'V' ` + deleted + `
+		ORDER BY TRANSDATE, TRANSID
+	`)
+	if err != nil {
+		return nil, errors.New("Invalid Money Manager EX database: " + err.Error())
+	}
+	type mmexTransaction struct {
+		id    int64
+		entry ImportedEntry
+		split mmexSplit // the whole transaction when it isn't split
+		sign  float64
+	}
+	var transactions []mmexTransaction
+	firstDates := make(map[string]time.Time)
+	for rows.Next() {
+		var id, accountID, toAccountID, payeeID, categoryID, subcatID int64
+		var code, notes, date string
+		var amount, toAmount float64
+		if err := rows.Scan(&id, &accountID, &toAccountID, &payeeID, &code, &amount, &toAmount, &notes, &categoryID, &subcatID, &date); err != nil {
+			book.Skipped++
+			continue
+		}
+		at, err := mmexDate(date)
+		if err != nil {
+			book.Skipped++
+			continue
+		}
+		account := strconv.FormatInt(accountID, 10)
+		if _, ok := initial[account]; !ok {
+			book.Skipped++
+			continue
+		}
+		if first, ok := firstDates[account]; !ok || at.Before(first) {
+			firstDates[account] = at
+		}
+
+		entry := ImportedEntry{Date: at, Account: account, Description: payees[payeeID], Notes: notes}
+		if entry.Description == "" {
+			entry.Description = notes
+		}
+		switch code {
+		case "Transfer":
+			to := strconv.FormatInt(toAccountID, 10)
+			if _, ok := initial[to]; !ok || to == account {
+				book.Skipped++
+				continue
+			}
+			entry.Amount, entry.ToAccount, entry.ToAmount = -amount, to, toAmount
+			book.Entries = append(book.Entries, entry)
+		case "Deposit":
+			transactions = append(transactions, mmexTransaction{id: id, entry: entry, split: mmexSplit{categoryID, subcatID, amount}, sign: 1})
+		case "Withdrawal":
+			transactions = append(transactions, mmexTransaction{id: id, entry: entry, split: mmexSplit{categoryID, subcatID, amount}, sign: -1})
+		default:
+			book.Skipped++
+		}
+	}
+	rows.Close()
+
+	splits, err := mmexSplits(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range transactions {
+		parts, ok := splits[t.id]
+		if !ok {
+			parts = []mmexSplit{t.split}
+		}
+		for _, p := range parts {
+			entry := t.entry
+			entry.Amount = t.sign * p.amount
+			entry.Category = categories.name(p.categoryID, p.subcatID)
+			book.Entries = append(book.Entries, entry)
+		}
+	}
+
+	// Opening balances come first in each account's history
+	var openings []ImportedEntry
+	for _, a := range book.Accounts {
+		if initial[a.Key] == 0 {
+			continue
+		}
+		at, err := mmexDate(initialDates[a.Key])
+		if first, ok := firstDates[a.Key]; err != nil || (ok && first.Before(at)) {
+			at = firstDates[a.Key]
+		}
+		if at.IsZero() {
+			at = time.Now()
+		}
+		openings = append(openings, ImportedEntry{
+			Date:        at,
+			Account:     a.Key,
+			Amount:      initial[a.Key],
+			Description: "Opening balance",
+			Opening:     true,
+		})
+	}
+	book.Entries = append(openings, book.Entries...)
+	return book, nil
+}
+
+type mmexSplit struct {
+	categoryID, subcatID int64
+	amount               float64
+}
+
+// mmexSplits returns the split parts of split transactions, by transaction
+func mmexSplits(db *sql.DB) (map[int64][]mmexSplit, error) {
+	splits := make(map[int64][]mmexSplit)
+	if !mmexHasColumn(db, "SPLITTRANSACTIONS_V1", "TRANSID") {
+		return splits, nil
+	}
+	subcategory := "-1"
+	if mmexHasColumn(db, "SPLITTRANSACTIONS_V1", "SUBCATEGID") {
+		subcategory = "COALESCE(SUBCATEGID, -1)"
+	}
+	rows, err := db.Query(`SELECT TRANSID, COALESCE(CATEGID, -1), ` + subcategory + `, COALESCE(SPLITTRANSAMOUNT, 0) FROM SPLITTRANSACTIONS_V1 ORDER BY SPLITTRANSID`)
+	if err != nil {
+		return nil, errors.New("Invalid Money Manager EX database: " + err.Error())
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var s mmexSplit
+		if err := rows.Scan(&id, &s.categoryID, &s.subcatID, &s.amount); err == nil {
+			splits[id] = append(splits[id], s)
+		}
+	}
+	return splits, nil
+}
+
+// mmexCategoryNames resolves category IDs to names such as "Food:Groceries"
+type mmexCategoryNames struct {
+	categories    map[int64]string
+	parents       map[int64]int64
+	subcategories map[int64]string
+}
+
+func (c mmexCategoryNames) name(categoryID, subcatID int64) string {
+	var parts []string
+	for id := categoryID; id > 0 && len(parts) < 16; id = c.parents[id] {
+		name, ok := c.categories[id]
+		if !ok {
+			break
+		}
+		parts = append([]string{name}, parts...)
+	}
+	if sub, ok := c.subcategories[subcatID]; ok {
+		parts = append(parts, sub)
+	}
+	return strings.Join(parts, ":")
+}
+
+// mmexCategories reads the category tree. Older databases keep one level of
+// subcategories in their own table; newer ones nest categories by PARENTID.
+func mmexCategories(db *sql.DB) (mmexCategoryNames, error) {
+	names := mmexCategoryNames{
+		categories:    make(map[int64]string),
+		parents:       make(map[int64]int64),
+		subcategories: make(map[int64]string),
+	}
+	parent := "-1"
+	if mmexHasColumn(db, "CATEGORY_V1", "PARENTID") {
+		parent = "COALESCE(PARENTID, -1)"
+	}
+	rows, err := db.Query("SELECT CATEGID, COALESCE(CATEGNAME, ''), " + parent + " FROM CATEGORY_V1")
+	if err != nil {
+		return names, errors.New("Invalid Money Manager EX database: " + err.Error())
+	}
+	for rows.Next() {
+		var id, parentID int64
+		var name string
+		if rows.Scan(&id, &name, &parentID) == nil {
+			names.categories[id] = name
+			names.parents[id] = parentID
+		}
+	}
+	rows.Close()
+
+	if mmexHasColumn(db, "SUBCATEGORY_V1", "SUBCATEGID") {
+		rows, err := db.Query("SELECT SUBCATEGID, COALESCE(SUBCATEGNAME, '') FROM SUBCATEGORY_V1")
+		if err != nil {
+			return names, errors.New("Invalid Money Manager EX database: " + err.Error())
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if rows.Scan(&id, &name) == nil {
+				names.subcategories[id] = name
+			}
+		}
+		rows.Close()
+	}
+	return names, nil
+}
+
+// mmexHasColumn reports whether a table of the database has a column, as
+// the schema changed between Money Manager EX versions
+func mmexHasColumn(db *sql.DB, table, column string) bool {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	return err == nil && count > 0
+}
+
+// mmexDate parses a transaction date, stored as YYYY-MM-DD and, since
+// version 1.6, optionally with a time
+func mmexDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// DefaultLocale is used for users who haven't chosen one
+const DefaultLocale = models.DefaultLocale
+
+// LocaleFormat describes how a locale writes amounts of money
+type LocaleFormat struct {
+	Thousands   string
+	Decimal     string
+	SymbolAfter bool // "1.234,56 €" instead of "€1,234.56"
+}
+
+// CurrencyFormat is the display symbol and number of minor digits of a currency
+type CurrencyFormat struct {
+	Symbol   string
+	Decimals int
+}
+
+var locales = map[string]LocaleFormat{
+	"en-US": {Thousands: ",", Decimal: "."},
+	"en-GB": {Thousands: ",", Decimal: "."},
+	"es-DO": {Thousands: ",", Decimal: "."},
+	"es-ES": {Thousands: ".", Decimal: ",", SymbolAfter: true},
+	"de-DE": {Thousands: ".", Decimal: ",", SymbolAfter: true},
+	"fr-FR": {Thousands: "\u00a0", Decimal: ",", SymbolAfter: true},
+	"pt-BR": {Thousands: ".", Decimal: ","},
+}
+
+var currencies = map[string]CurrencyFormat{
+	"DOP": {Symbol: "RD$", Decimals: 2},
+	"USD": {Symbol: "US$", Decimals: 2},
+	"EUR": {Symbol: "€", Decimals: 2},
+	"GBP": {Symbol: "£", Decimals: 2},
+	"CAD": {Symbol: "CA$", Decimals: 2},
+	"MXN": {Symbol: "MX$", Decimals: 2},
+	"BRL": {Symbol: "R$", Decimals: 2},
+	"JPY": {Symbol: "¥", Decimals: 0},
+}
+
+// localSymbols override a currency's symbol in the locale where it is the
+// local currency, e.g. plain "$" for dollars in the US
+var localSymbols = map[string]map[string]string{
+	"en-US": {"USD": "$"},
+	"es-DO": {"DOP": "RD$"},
+}
+
+// IsValidLocale reports whether locale is supported
+func IsValidLocale(locale string) bool {
+	_, ok := locales[locale]
+	return ok
+}
+
+// SupportedLocales returns the supported locale tags
+func SupportedLocales() []string {
+	tags := make([]string, 0, len(locales))
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// UserLocale returns the user's display locale, or DefaultLocale
+func UserLocale(ctx context.Context, db *sql.DB, userID int64) string {
+	var locale sql.NullString
+	db.QueryRowContext(ctx, "SELECT locale FROM users WHERE id = ?", userID).Scan(&locale)
+	if IsValidLocale(locale.String) {
+		return locale.String
+	}
+	return DefaultLocale
+}
+
+// FormatMoney formats an amount for display in the given locale, e.g.
+// "$1,234.56" (en-US), "RD$1,234.56" (es-DO) or "1.234,56 €" (de-DE).
+// Unknown locales fall back to DefaultLocale; unknown currencies are shown
+// with their code and two decimals.
+func FormatMoney(amount float64, currency, locale string) string {
+	lf, ok := locales[locale]
+	if !ok {
+		lf = locales[DefaultLocale]
+		locale = DefaultLocale
+	}
+	cf, ok := currencies[currency]
+	if !ok {
+		cf = CurrencyFormat{Symbol: currency, Decimals: 2}
+	}
+	symbol := cf.Symbol
+	if local, ok := localSymbols[locale][currency]; ok {
+		symbol = local
+	}
+
+	sign := ""
+	rounded := math.Round(amount*math.Pow10(cf.Decimals)) / math.Pow10(cf.Decimals)
+	if rounded < 0 {
+		sign = "-"
+		rounded = -rounded
+	}
+
+	number := strconv.FormatFloat(rounded, 'f', cf.Decimals, 64)
+	intPart, decPart, _ := strings.Cut(number, ".")
+	for i := len(intPart) - 3; i > 0; i -= 3 {
+		intPart = intPart[:i] + lf.Thousands + intPart[i:]
+	}
+	if decPart != "" {
+		number = intPart + lf.Decimal + decPart
+	} else {
+		number = intPart
+	}
+
+	// Currency codes and multi-letter symbols read better with a space
+	if lf.SymbolAfter {
+		return sign + number + "\u00a0" + symbol
+	}
+	if symbol == currency {
+		return sign + symbol + " " + number
+	}
+	return sign + symbol + number
+}
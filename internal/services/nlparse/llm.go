@@ -0,0 +1,246 @@
+package nlparse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// SourceLLM marks results read by a language model
+const SourceLLM = "llm"
+
+// Completer answers a prompt with a language model
+type Completer interface {
+	Complete(ctx context.Context, system, prompt string) (string, error)
+}
+
+// FromEnv configures parsing from NLPARSE_PROVIDER:
+//
+//   - "rules" (the default) parses with Rules, on the server
+//   - "openai" sends the text, with the names, types and currencies of the
+//     user's accounts, to an OpenAI-compatible chat completions endpoint:
+//     NLPARSE_URL (default OpenAI's), NLPARSE_API_KEY and NLPARSE_MODEL.
+//     Rules parses whenever the model fails.
+func FromEnv(getenv func(string) string) (Parser, error) {
+	switch provider := strings.ToLower(strings.TrimSpace(getenv("NLPARSE_PROVIDER"))); provider {
+	case "", "rules":
+		return Rules{}, nil
+	case "openai":
+		model := strings.TrimSpace(getenv("NLPARSE_MODEL"))
+		if model == "" {
+			return nil, fmt.Errorf("NLPARSE_MODEL is required when NLPARSE_PROVIDER is openai")
+		}
+		url := strings.TrimSpace(getenv("NLPARSE_URL"))
+		if url == "" {
+			url = "https://api.openai.com/v1/chat/completions"
+		}
+		return &LLM{
+			Completer: &OpenAICompleter{URL: url, APIKey: getenv("NLPARSE_API_KEY"), Model: model, client: &http.Client{Timeout: 20 * time.Second}},
+			Fallback:  Rules{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid NLPARSE_PROVIDER %q: expected rules or openai", provider)
+	}
+}
+
+// LLM parses with a language model, falling back to another parser when
+// the model can't be reached or its answer can't be used
+type LLM struct {
+	Completer Completer
+	Fallback  Parser
+}
+
+const llmSystemPrompt = `You read personal finance transactions from short texts.
+Answer with only a JSON object with these fields:
+"account_id": the id of the account it's on, from the accounts given, or null if the text doesn't say;
+"type": "withdrawal" for spending from cash, debit or saving accounts, "expense" for spending on a credit card, "deposit" for money received, "payment" for a credit card or loan payment;
+"amount": the amount, a positive number;
+"currency": the ISO 4217 code of the currency the text names, or "" if it names none;
+"category": one of the categories given;
+"description": a short description of what it was for, in the text's language, without the amount, account or date;
+"date": the day it happened, as YYYY-MM-DD, using today's date for relative days.`
+
+// llmAnswer is the JSON the model is asked for
+type llmAnswer struct {
+	AccountID   *int64  `json:"account_id"`
+	Type        string  `json:"type"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	Category    string  `json:"category"`
+	Description string  `json:"description"`
+	Date        string  `json:"date"`
+}
+
+// Parse asks the model, checking its answer against the accounts and
+// categories the user has
+func (l *LLM) Parse(ctx context.Context, in Input) (*models.ParsedTransaction, error) {
+	result, err := l.parse(ctx, in)
+	if err != nil {
+		log.Printf("Language model parsing failed, falling back: %v", err)
+		return l.Fallback.Parse(ctx, in)
+	}
+	return result, nil
+}
+
+func (l *LLM) parse(ctx context.Context, in Input) (*models.ParsedTransaction, error) {
+	type promptAccount struct {
+		ID       int64              `json:"id"`
+		Name     string             `json:"name"`
+		Type     models.AccountType `json:"type"`
+		Currency string             `json:"currency"`
+	}
+	prompt := struct {
+		Text       string                       `json:"text"`
+		Today      string                       `json:"today"`
+		Accounts   []promptAccount              `json:"accounts"`
+		Categories []models.TransactionCategory `json:"categories"`
+	}{Text: in.Text, Today: in.Now.Format("2006-01-02 (Monday)")}
+	for _, a := range in.Accounts {
+		prompt.Accounts = append(prompt.Accounts, promptAccount{ID: a.ID, Name: a.Name, Type: a.Type, Currency: a.Currency})
+	}
+	for _, c := range models.AllCategories() {
+		if c != models.CategoryTransfer {
+			prompt.Categories = append(prompt.Categories, c)
+		}
+	}
+	body, err := json.Marshal(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := l.Completer.Complete(ctx, llmSystemPrompt, string(body))
+	if err != nil {
+		return nil, err
+	}
+	// Models sometimes fence JSON despite being asked not to
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(strings.TrimPrefix(content, "```json"), "```")
+	content = strings.TrimSuffix(content, "```")
+
+	var answer llmAnswer
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, fmt.Errorf("unexpected answer: %w", err)
+	}
+	if answer.Amount <= 0 {
+		return nil, ErrNoAmount
+	}
+
+	result := &models.ParsedTransaction{
+		Source:   SourceLLM,
+		Currency: strings.ToUpper(strings.TrimSpace(answer.Currency)),
+		Transaction: models.CreateTransactionRequest{
+			Amount:      answer.Amount,
+			Description: strings.TrimSpace(answer.Description),
+			Category:    models.TransactionCategory(answer.Category),
+			Type:        models.TransactionType(answer.Type),
+		},
+	}
+	req := &result.Transaction
+	if !slices.Contains(prompt.Categories, req.Category) {
+		req.Category = models.CategoryOther
+	}
+
+	result.Date = in.Now.Format("2006-01-02")
+	if d, err := time.ParseInLocation("2006-01-02", answer.Date, in.Now.Location()); err == nil && !d.After(in.Now) {
+		result.Date = answer.Date
+	}
+
+	var account *models.Account
+	if answer.AccountID != nil {
+		for _, a := range in.Accounts {
+			if a.ID == *answer.AccountID {
+				account = a
+			}
+		}
+	}
+	switch req.Type {
+	case models.TransactionTypeDeposit, models.TransactionTypeWithdrawal, models.TransactionTypeExpense, models.TransactionTypePayment:
+	default:
+		req.Type = models.TransactionTypeWithdrawal
+		if account != nil && account.Type == models.AccountTypeCreditCard {
+			req.Type = models.TransactionTypeExpense
+		}
+	}
+
+	if account == nil {
+		result.Warnings = append(result.Warnings, "Choose the account to record it on")
+		return result, nil
+	}
+	id := account.ID
+	result.AccountID = &id
+	result.AccountName = account.Name
+	result.Warnings = append(result.Warnings, Check(result, account, in.Now)...)
+	return result, nil
+}
+
+// OpenAICompleter calls an OpenAI-compatible chat completions endpoint,
+// which most hosted and self-hosted model servers offer
+type OpenAICompleter struct {
+	URL    string
+	APIKey string
+	Model  string
+	client *http.Client
+}
+
+// Complete sends the prompt and returns the first choice's message
+func (o *OpenAICompleter) Complete(ctx context.Context, system, prompt string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": o.Model,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": prompt},
+		},
+		"temperature":     0,
+		"response_format": map[string]string{"type": "json_object"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("completion request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read completion: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("completion endpoint returned %s", resp.Status)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &completion); err != nil {
+		return "", fmt.Errorf("failed to decode completion: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("completion has no choices")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
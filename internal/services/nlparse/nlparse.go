@@ -0,0 +1,422 @@
+// Package nlparse turns a transaction described in everyday words, such as
+// "paid 1,200 DOP for electricity yesterday from BHD debit", into a request
+// to record it. Rules reads the usual phrasings without any outside service;
+// LLM hands the text to a language model and falls back to Rules.
+package nlparse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ErrNoAmount is returned for text without an amount to record
+var ErrNoAmount = errors.New("no amount found: try something like \"coffee 4.50 visa\"")
+
+// Input is the text to parse and what it's read against
+type Input struct {
+	Text     string
+	Accounts []*models.Account // the accounts the transaction can go on
+	Now      time.Time
+}
+
+// Parser reads a transaction from text. Errors other than ErrNoAmount mean
+// the parser failed, not that the text was unclear: what couldn't be read
+// is reported in the result's warnings.
+type Parser interface {
+	Parse(ctx context.Context, in Input) (*models.ParsedTransaction, error)
+}
+
+// SourceRules marks results read by Rules
+const SourceRules = "rules"
+
+// Rules parses text with keyword rules, in English and Spanish
+type Rules struct{}
+
+var (
+	// Currency symbols written in front of amounts, longest first
+	currencySymbols = []struct{ symbol, currency string }{
+		{"RD$", "DOP"}, {"US$", "USD"}, {"€", "EUR"}, {"$", ""},
+	}
+	currencyWords = map[string]string{
+		"dop": "DOP", "peso": "DOP", "pesos": "DOP",
+		"usd": "USD", "dollar": "USD", "dollars": "USD", "dolares": "USD",
+		"eur": "EUR", "euro": "EUR", "euros": "EUR",
+	}
+
+	// Words that make the transaction money coming in
+	incomeWords = []string{"received", "receive", "earned", "got", "deposited", "recibi", "cobre"}
+	// Words that only say the transaction happened, left out of descriptions
+	verbWords = []string{"paid", "pay", "spent", "spend", "bought", "buy", "received", "receive", "earned", "got", "deposited", "pague", "gaste", "compre", "recibi", "cobre"}
+	// Words that link the parts of a phrase, left out of descriptions next
+	// to the parts that were read
+	linkWords = []string{"for", "from", "on", "with", "using", "via", "in", "at", "to", "of", "por", "de", "con", "en", "desde", "para"}
+
+	// Words that often describe spending in a category. The word stays in
+	// the description; only category names themselves are taken out of it.
+	categoryKeywords = map[models.TransactionCategory][]string{
+		models.CategoryDining:        {"coffee", "cafe", "lunch", "dinner", "breakfast", "restaurant", "pizza", "almuerzo", "cena", "desayuno"},
+		models.CategoryGroceries:     {"supermarket", "grocery", "market", "supermercado", "colmado"},
+		models.CategoryTransport:     {"uber", "taxi", "gas", "fuel", "bus", "parking", "gasolina", "pasaje"},
+		models.CategoryUtilities:     {"electricity", "power", "water", "internet", "phone", "luz", "agua", "telefono"},
+		models.CategoryRent:          {"alquiler"},
+		models.CategoryHealthcare:    {"pharmacy", "doctor", "dentist", "farmacia", "medico"},
+		models.CategoryEntertainment: {"movie", "movies", "cinema", "cine"},
+		models.CategorySubscriptions: {"netflix", "spotify", "subscription"},
+		models.CategoryFitness:       {"gym", "gimnasio"},
+		models.CategoryTravel:        {"flight", "hotel", "vuelo"},
+		models.CategoryGifts:         {"gift", "regalo"},
+		models.CategoryIncome:        {"salary", "paycheck", "salario", "sueldo"},
+	}
+
+	weekdays = map[string]time.Weekday{
+		"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+		"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+		"domingo": time.Sunday, "lunes": time.Monday, "martes": time.Tuesday, "miercoles": time.Wednesday,
+		"jueves": time.Thursday, "viernes": time.Friday, "sabado": time.Saturday,
+	}
+)
+
+// phrase is the text being parsed, word by word, with the words already
+// read marked used
+type phrase struct {
+	words []string
+	used  []bool
+}
+
+// Parse reads the amount, currency, date, account, category and type from
+// the text. Whatever is left, without the verbs and linking words around
+// it, is the description.
+func (Rules) Parse(ctx context.Context, in Input) (*models.ParsedTransaction, error) {
+	p := &phrase{words: strings.Fields(in.Text)}
+	p.used = make([]bool, len(p.words))
+	result := &models.ParsedTransaction{Source: SourceRules}
+	req := &result.Transaction
+
+	amount, currency, ok := p.amount()
+	if !ok {
+		return nil, ErrNoAmount
+	}
+	req.Amount = amount
+	if currency == "" {
+		currency = p.currency()
+	}
+	result.Currency = currency
+
+	date := p.date(in.Now)
+	result.Date = date.Format("2006-01-02")
+
+	account := p.account(in.Accounts)
+	if account == nil {
+		var candidates []string
+		for _, a := range in.Accounts {
+			if a.Type != models.AccountTypeLoan {
+				account = a
+				candidates = append(candidates, a.Name)
+			}
+		}
+		if len(candidates) != 1 {
+			account = nil
+			if len(candidates) == 0 {
+				result.Warnings = append(result.Warnings, "You don't have an account to record it on yet")
+			} else {
+				result.Warnings = append(result.Warnings, "Name the account to use, one of: "+strings.Join(candidates, ", "))
+			}
+		}
+	}
+
+	req.Category = p.category()
+	income := req.Category == models.CategoryIncome || p.has(incomeWords)
+	switch {
+	case income:
+		req.Type = models.TransactionTypeDeposit
+	case account != nil && account.Type == models.AccountTypeCreditCard:
+		req.Type = models.TransactionTypeExpense
+	default:
+		req.Type = models.TransactionTypeWithdrawal
+	}
+	req.Description = p.description()
+
+	if account != nil {
+		id := account.ID
+		result.AccountID = &id
+		result.AccountName = account.Name
+		result.Warnings = append(result.Warnings, Check(result, account, in.Now)...)
+	}
+	return result, nil
+}
+
+// Check returns the warnings about recording a parsed transaction on an
+// account: an amount in another currency, a loan, or a day other than today
+func Check(result *models.ParsedTransaction, account *models.Account, now time.Time) []string {
+	var warnings []string
+	if result.Currency != "" && !strings.EqualFold(result.Currency, account.Currency) {
+		warnings = append(warnings, fmt.Sprintf("The amount is in %s but %s is in %s", result.Currency, account.Name, account.Currency))
+	}
+	if account.Type == models.AccountTypeLoan {
+		warnings = append(warnings, "Spending can't be recorded on a loan")
+	}
+	if result.Date != now.Format("2006-01-02") {
+		warnings = append(warnings, "It will be recorded today, not on "+result.Date)
+	}
+	return warnings
+}
+
+// amount reads the first amount, with the currency its symbol stands for
+func (p *phrase) amount() (float64, string, bool) {
+	for i, w := range p.words {
+		// The 3 of "3 days ago" is a date
+		if i+1 < len(p.words) && (word(p.words[i+1]) == "days" || word(p.words[i+1]) == "day") {
+			continue
+		}
+		if amount, currency, ok := parseAmount(w); ok {
+			p.used[i] = true
+			return amount, currency, true
+		}
+	}
+	return 0, "", false
+}
+
+// parseAmount reads "1,200", "4,50", "1.234,56", "RD$500" or "20€"
+func parseAmount(w string) (float64, string, bool) {
+	s := strings.ToUpper(strings.TrimRight(w, ".,;:!?"))
+	currency := ""
+	for _, c := range currencySymbols {
+		if trimmed, ok := strings.CutPrefix(s, c.symbol); ok {
+			s, currency = trimmed, c.currency
+			break
+		}
+	}
+	if trimmed, ok := strings.CutSuffix(s, "€"); ok {
+		s, currency = trimmed, "EUR"
+	}
+	if s == "" || strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) && r != ',' && r != '.' }) >= 0 {
+		return 0, "", false
+	}
+
+	// The last separator is the decimal one when both are used; a lone comma
+	// is decimal with one or two digits after it
+	comma, dot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	switch {
+	case comma >= 0 && dot >= 0 && comma > dot:
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case comma >= 0 && dot >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case comma >= 0 && strings.Count(s, ",") == 1 && len(s)-comma <= 3:
+		s = strings.Replace(s, ",", ".", 1)
+	case comma >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case strings.Count(s, ".") > 1:
+		s = strings.ReplaceAll(s, ".", "")
+	}
+
+	amount, err := strconv.ParseFloat(s, 64)
+	if err != nil || amount <= 0 {
+		return 0, "", false
+	}
+	return amount, currency, true
+}
+
+// currency reads a currency code, name or symbol on its own, such as "DOP",
+// "pesos" or "€"
+func (p *phrase) currency() string {
+	for i, w := range p.words {
+		if p.used[i] {
+			continue
+		}
+		if currency, ok := currencyWords[word(w)]; ok {
+			p.used[i] = true
+			return currency
+		}
+		for _, c := range currencySymbols {
+			if strings.EqualFold(w, c.symbol) && c.currency != "" {
+				p.used[i] = true
+				return c.currency
+			}
+		}
+	}
+	return ""
+}
+
+// date reads "today", "yesterday", "3 days ago", "monday", "last friday"
+// or a YYYY-MM-DD date. Without one it's today.
+func (p *phrase) date(now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for i, w := range p.words {
+		if p.used[i] {
+			continue
+		}
+		switch lower := word(w); {
+		case lower == "today" || lower == "hoy":
+			p.used[i] = true
+			return today
+		case lower == "yesterday" || lower == "ayer":
+			p.used[i] = true
+			return today.AddDate(0, 0, -1)
+		case lower == "ago" && i >= 2 && (word(p.words[i-1]) == "days" || word(p.words[i-1]) == "day"):
+			days, err := strconv.Atoi(p.words[i-2])
+			if err != nil || days < 0 || days > 366 || p.used[i-2] {
+				continue
+			}
+			p.used[i-2], p.used[i-1], p.used[i] = true, true, true
+			return today.AddDate(0, 0, -days)
+		default:
+			if weekday, ok := weekdays[lower]; ok {
+				p.used[i] = true
+				back := (int(today.Weekday()) - int(weekday) + 7) % 7
+				if i > 0 && word(p.words[i-1]) == "last" {
+					p.used[i-1] = true
+					if back == 0 {
+						back = 7
+					}
+				}
+				return today.AddDate(0, 0, -back)
+			}
+			if d, err := time.ParseInLocation("2006-01-02", strings.Trim(w, ".,;:!?"), now.Location()); err == nil {
+				p.used[i] = true
+				return d
+			}
+		}
+	}
+	return today
+}
+
+// account finds the account the text names. The longest full name in the
+// text wins; otherwise a single word of one account's name, such as "visa"
+// for "Visa Gold", picks it.
+func (p *phrase) account(accounts []*models.Account) *models.Account {
+	var best *models.Account
+	var bestAt, bestLen int
+	for _, a := range accounts {
+		name := strings.Fields(strings.ToLower(a.Name))
+		if len(name) == 0 || len(name) <= bestLen {
+			continue
+		}
+		for i := 0; i+len(name) <= len(p.words); i++ {
+			if p.matches(i, name) {
+				best, bestAt, bestLen = a, i, len(name)
+				break
+			}
+		}
+	}
+	if best != nil {
+		for i := bestAt; i < bestAt+bestLen; i++ {
+			p.used[i] = true
+		}
+		return best
+	}
+
+	for i, w := range p.words {
+		lower := word(w)
+		if p.used[i] || len(lower) < 3 {
+			continue
+		}
+		var match *models.Account
+		matches := 0
+		for _, a := range accounts {
+			if slices.Contains(strings.Fields(strings.ToLower(a.Name)), lower) {
+				match = a
+				matches++
+			}
+		}
+		if matches == 1 {
+			p.used[i] = true
+			return match
+		}
+	}
+	return nil
+}
+
+func (p *phrase) matches(at int, name []string) bool {
+	for i := range name {
+		if p.used[at+i] || word(p.words[at+i]) != name[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// category reads a category name, or guesses one from a keyword such as
+// "coffee". A category named outright wins.
+func (p *phrase) category() models.TransactionCategory {
+	var guessed models.TransactionCategory
+	for i, w := range p.words {
+		if p.used[i] {
+			continue
+		}
+		lower := word(w)
+		category := models.TransactionCategory(lower)
+		if slices.Contains(models.AllCategories(), category) && category != models.CategoryTransfer {
+			p.used[i] = true
+			return category
+		}
+		if guessed == "" {
+			guessed = keywordCategory(lower)
+		}
+	}
+	if guessed == "" {
+		return models.CategoryOther
+	}
+	return guessed
+}
+
+func keywordCategory(w string) models.TransactionCategory {
+	for category, keywords := range categoryKeywords {
+		if slices.Contains(keywords, w) {
+			return category
+		}
+	}
+	return ""
+}
+
+// has reports whether any of the words is in the text and not yet read
+func (p *phrase) has(words []string) bool {
+	for i, w := range p.words {
+		if !p.used[i] && slices.Contains(words, word(w)) {
+			return true
+		}
+	}
+	return false
+}
+
+// description is the words not read as anything else, without verbs, and
+// without linking words at its ends or in front of a part that was read,
+// like "from" in "from BHD debit"
+func (p *phrase) description() string {
+	var kept []string
+	for i, w := range p.words {
+		if p.used[i] {
+			continue
+		}
+		lower := word(w)
+		if slices.Contains(verbWords, lower) {
+			continue
+		}
+		if slices.Contains(linkWords, lower) && (i+1 == len(p.words) || p.used[i+1]) {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	for len(kept) > 0 && slices.Contains(linkWords, word(kept[0])) {
+		kept = kept[1:]
+	}
+	for len(kept) > 0 && slices.Contains(linkWords, word(kept[len(kept)-1])) {
+		kept = kept[:len(kept)-1]
+	}
+	return strings.Join(kept, " ")
+}
+
+// word lowercases a word and drops the punctuation around it
+func word(w string) string {
+	return strings.TrimFunc(strings.ToLower(w), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
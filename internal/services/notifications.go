@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// NotificationService writes entries to users' notification feeds and
+// delivers them by email and push according to each user's preferences
+type NotificationService struct {
+	db       *sql.DB
+	mailer   *Mailer         // nil disables email
+	telegram *TelegramClient // nil disables push
+}
+
+// NewNotificationService creates a new notification service. Notifications
+// are emailed when mailer is not nil and pushed to linked Telegram chats
+// when telegram is not nil.
+func NewNotificationService(db *sql.DB, mailer *Mailer, telegram *TelegramClient) *NotificationService {
+	return &NotificationService{db: db, mailer: mailer, telegram: telegram}
+}
+
+// EmailEnabled reports whether notifications can be emailed
+func (s *NotificationService) EmailEnabled() bool {
+	return s.mailer != nil
+}
+
+// PushEnabled reports whether notifications can be pushed
+func (s *NotificationService) PushEnabled() bool {
+	return s.telegram != nil
+}
+
+// Notify adds a notification to the user's feed and delivers it on the
+// channels the user chose for its type. data is stored as JSON.
+// Notifications with a dedupe key that was already used for the user are
+// ignored, so callers can safely re-run their checks. During the user's
+// quiet hours, email and push are held until DeliverPending runs after
+// they end.
+func (s *NotificationService) Notify(ctx context.Context, userID int64, notifType models.NotificationType, title, message, dedupeKey string, data interface{}) error {
+	var dataJSON sql.NullString
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification data: %w", err)
+		}
+		dataJSON = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	var key sql.NullString
+	if dedupeKey != "" {
+		key = sql.NullString{String: dedupeKey, Valid: true}
+	}
+
+	pref, err := s.Preference(ctx, userID, notifType)
+	if err != nil {
+		return fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+	channels := s.channels(pref)
+	now := time.Now()
+	quiet, err := s.quietNow(ctx, userID, now)
+	if err != nil {
+		return fmt.Errorf("failed to fetch quiet hours: %w", err)
+	}
+	var pending sql.NullString
+	if quiet && len(channels) > 0 {
+		pending = sql.NullString{String: strings.Join(channels, ","), Valid: true}
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO notifications (user_id, type, title, message, data, dedupe_key, in_app, pending_channels, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, string(notifType), title, message, dataJSON, key, pref.InApp, pending, now)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 || quiet {
+		return nil
+	}
+
+	s.deliver(ctx, userID, channels, title, message)
+	return nil
+}
+
+// Broadcast notifies every user, returning how many were notified. Each
+// user gets it at most once per dedupe key.
+func (s *NotificationService) Broadcast(ctx context.Context, notifType models.NotificationType, title, message, dedupeKey string, data interface{}) (int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM users ORDER BY id")
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch users: %w", err)
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			continue
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+
+	sent := 0
+	for _, userID := range userIDs {
+		if err := s.Notify(ctx, userID, notifType, title, message, dedupeKey, data); err != nil {
+			log.Printf("Broadcast to user %d failed: %v", userID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// DeliverPending sends the email and push notifications held back by quiet
+// hours that have since ended. It returns how many notifications were
+// delivered.
+func (s *NotificationService) DeliverPending(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, title, message, pending_channels
+		FROM notifications
+		WHERE pending_channels IS NOT NULL
+		ORDER BY created_at, id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch pending notifications: %w", err)
+	}
+	type held struct {
+		id       int64
+		userID   int64
+		title    string
+		message  string
+		channels string
+	}
+	var pending []held
+	for rows.Next() {
+		var h held
+		if err := rows.Scan(&h.id, &h.userID, &h.title, &h.message, &h.channels); err != nil {
+			continue
+		}
+		pending = append(pending, h)
+	}
+	rows.Close()
+
+	delivered := 0
+	quiet := make(map[int64]bool)
+	for _, h := range pending {
+		inQuietHours, ok := quiet[h.userID]
+		if !ok {
+			if inQuietHours, err = s.quietNow(ctx, h.userID, now); err != nil {
+				log.Printf("Failed to fetch quiet hours for user %d: %v", h.userID, err)
+				continue
+			}
+			quiet[h.userID] = inQuietHours
+		}
+		if inQuietHours {
+			continue
+		}
+
+		// Cleared first so a failed delivery isn't retried on every run
+		if _, err := s.db.ExecContext(ctx, "UPDATE notifications SET pending_channels = NULL WHERE id = ?", h.id); err != nil {
+			return delivered, fmt.Errorf("failed to update notification: %w", err)
+		}
+		s.deliver(ctx, h.userID, strings.Split(h.channels, ","), h.title, h.message)
+		delivered++
+	}
+	return delivered, nil
+}
+
+// Preference returns the channels the user chose for a notification type,
+// or its defaults
+func (s *NotificationService) Preference(ctx context.Context, userID int64, notifType models.NotificationType) (models.NotificationPreference, error) {
+	pref := models.NotificationPreference{Type: notifType}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT in_app, email, push FROM notification_preferences WHERE user_id = ? AND type = ?
+	`, userID, string(notifType)).Scan(&pref.InApp, &pref.Email, &pref.Push)
+	if err == sql.ErrNoRows {
+		return models.DefaultNotificationPreference(notifType), nil
+	}
+	return pref, err
+}
+
+// QuietHours returns the user's quiet hours, or nil when they have none
+func (s *NotificationService) QuietHours(ctx context.Context, userID int64) (*models.QuietHours, error) {
+	var start, end, timezone sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT quiet_hours_start, quiet_hours_end, quiet_hours_timezone FROM users WHERE id = ?
+	`, userID).Scan(&start, &end, &timezone)
+	if err != nil {
+		return nil, err
+	}
+	if start.String == "" || end.String == "" {
+		return nil, nil
+	}
+	return &models.QuietHours{Start: start.String, End: end.String, Timezone: timezone.String}, nil
+}
+
+func (s *NotificationService) quietNow(ctx context.Context, userID int64, now time.Time) (bool, error) {
+	quiet, err := s.QuietHours(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return quiet != nil && quiet.Contains(now), nil
+}
+
+// channels lists the delivery channels, besides the feed, that pref turns
+// on and that are configured
+func (s *NotificationService) channels(pref models.NotificationPreference) []string {
+	var channels []string
+	if pref.Email && s.mailer != nil {
+		channels = append(channels, models.NotificationChannelEmail)
+	}
+	if pref.Push && s.telegram != nil {
+		channels = append(channels, models.NotificationChannelPush)
+	}
+	return channels
+}
+
+// deliver sends a notification on each channel. Failures are logged since
+// the notification is already in the feed.
+func (s *NotificationService) deliver(ctx context.Context, userID int64, channels []string, title, message string) {
+	for _, channel := range channels {
+		var err error
+		switch channel {
+		case models.NotificationChannelEmail:
+			err = s.email(ctx, userID, title, message)
+		case models.NotificationChannelPush:
+			err = s.push(ctx, userID, title, message)
+		}
+		if err != nil {
+			log.Printf("Notification %s delivery failed for user %d: %v", channel, userID, err)
+		}
+	}
+}
+
+func (s *NotificationService) email(ctx context.Context, userID int64, title, message string) error {
+	if s.mailer == nil {
+		return nil
+	}
+	var email string
+	if err := s.db.QueryRowContext(ctx, "SELECT email FROM users WHERE id = ?", userID).Scan(&email); err != nil {
+		return err
+	}
+	return s.mailer.Send(email, title, message+"\n")
+}
+
+// push sends the notification to the user's linked Telegram chat. Users
+// without one are skipped.
+func (s *NotificationService) push(ctx context.Context, userID int64, title, message string) error {
+	if s.telegram == nil {
+		return nil
+	}
+	var chatID int64
+	err := s.db.QueryRowContext(ctx, "SELECT chat_id FROM telegram_links WHERE user_id = ?", userID).Scan(&chatID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.telegram.SendMessage(ctx, chatID, title+"\n"+message)
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// OCRProvider extracts the text printed on a receipt image
+type OCRProvider interface {
+	ExtractText(ctx context.Context, image []byte, contentType string) (string, error)
+}
+
+// OCRProviderFromEnv configures receipt OCR from OCR_PROVIDER:
+//
+//   - "tesseract" runs the tesseract CLI (OCR_TESSERACT_PATH, default
+//     "tesseract"; OCR_LANGUAGES, default "eng+spa")
+//   - "http" posts the image to OCR_URL with an optional bearer OCR_API_KEY
+//     and expects the text back, as plain text or JSON {"text": "..."}
+//
+// It returns nil when OCR_PROVIDER is not set, which disables parsing.
+func OCRProviderFromEnv(getenv func(string) string) (OCRProvider, error) {
+	switch provider := getenv("OCR_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "tesseract":
+		path := getenv("OCR_TESSERACT_PATH")
+		if path == "" {
+			path = "tesseract"
+		}
+		languages := getenv("OCR_LANGUAGES")
+		if languages == "" {
+			languages = "eng+spa"
+		}
+		return &TesseractOCR{Path: path, Languages: languages}, nil
+	case "http":
+		url := getenv("OCR_URL")
+		if url == "" {
+			return nil, fmt.Errorf("OCR_URL is required when OCR_PROVIDER is http")
+		}
+		return &HTTPOCR{URL: url, APIKey: getenv("OCR_API_KEY"), client: &http.Client{Timeout: 30 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("invalid OCR_PROVIDER %q: expected tesseract or http", provider)
+	}
+}
+
+// TesseractOCR runs a local tesseract binary
+type TesseractOCR struct {
+	Path      string
+	Languages string
+}
+
+// ExtractText feeds the image to tesseract on stdin and returns its output
+func (t *TesseractOCR) ExtractText(ctx context.Context, image []byte, contentType string) (string, error) {
+	cmd := exec.CommandContext(ctx, t.Path, "stdin", "stdout", "-l", t.Languages)
+	cmd.Stdin = bytes.NewReader(image)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// HTTPOCR sends images to an external OCR service
+type HTTPOCR struct {
+	URL    string
+	APIKey string
+	client *http.Client
+}
+
+// ExtractText posts the image and reads the recognized text from the response
+func (h *HTTPOCR) ExtractText(ctx context.Context, image []byte, contentType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(image))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+h.APIKey)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("OCR request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read OCR response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OCR service returned %s", resp.Status)
+	}
+
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var result struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return "", fmt.Errorf("failed to decode OCR response: %w", err)
+		}
+		return result.Text, nil
+	}
+	return string(body), nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordParams are the argon2id cost parameters used for new hashes
+type PasswordParams struct {
+	MemoryKiB   uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for argon2id
+var DefaultPasswordParams = PasswordParams{MemoryKiB: 64 * 1024, Iterations: 3, Parallelism: 2}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var passwordParams = DefaultPasswordParams
+
+// ParsePasswordParams builds hashing parameters from configuration values.
+// Empty values keep the defaults.
+func ParsePasswordParams(memoryKiB, iterations, parallelism string) (PasswordParams, error) {
+	params := DefaultPasswordParams
+	if memoryKiB != "" {
+		v, err := strconv.ParseUint(memoryKiB, 10, 32)
+		if err != nil || v < 8*1024 {
+			return params, fmt.Errorf("argon2 memory must be at least 8192 KiB, got %q", memoryKiB)
+		}
+		params.MemoryKiB = uint32(v)
+	}
+	if iterations != "" {
+		v, err := strconv.ParseUint(iterations, 10, 32)
+		if err != nil || v < 1 {
+			return params, fmt.Errorf("argon2 iterations must be a positive integer, got %q", iterations)
+		}
+		params.Iterations = uint32(v)
+	}
+	if parallelism != "" {
+		v, err := strconv.ParseUint(parallelism, 10, 8)
+		if err != nil || v < 1 {
+			return params, fmt.Errorf("argon2 parallelism must be between 1 and 255, got %q", parallelism)
+		}
+		params.Parallelism = uint8(v)
+	}
+	return params, nil
+}
+
+// SetPasswordParams changes the parameters used for new hashes. Existing
+// hashes keep verifying with the parameters they were created with and are
+// upgraded on the next login (see NeedsRehash).
+func SetPasswordParams(params PasswordParams) {
+	passwordParams = params
+}
+
+// HashPassword hashes a password for storage using argon2id, encoded as
+// $argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := passwordParams
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.MemoryKiB, p.Parallelism, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.MemoryKiB, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword reports whether password matches the stored hash. Both
+// argon2id and legacy bcrypt hashes are accepted.
+func CheckPassword(hash, password string) bool {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.MemoryKiB, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1
+}
+
+// NeedsRehash reports whether a stored hash should be replaced after a
+// successful login: bcrypt hashes, and argon2id hashes created with
+// different parameters than the current ones.
+func NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2Hash(hash)
+	return err != nil || params != passwordParams
+}
+
+func decodeArgon2Hash(hash string) (PasswordParams, []byte, []byte, error) {
+	var params PasswordParams
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("not an argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.MemoryKiB, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	return params, salt, key, nil
+}
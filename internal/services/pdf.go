@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in PDF points
+const (
+	PDFPageWidth  = 595.28
+	PDFPageHeight = 841.89
+	pdfMargin     = 50.0
+)
+
+// PDFDocument is a minimal PDF 1.4 writer for text-based documents such as
+// reports. It only uses the standard Helvetica fonts, so no font files need
+// to be embedded. Content flows top-down with automatic page breaks.
+type PDFDocument struct {
+	pages   []*bytes.Buffer
+	current *bytes.Buffer
+	y       float64
+}
+
+// NewPDFDocument creates a document with a single empty page
+func NewPDFDocument() *PDFDocument {
+	d := &PDFDocument{}
+	d.AddPage()
+	return d
+}
+
+// AddPage starts a new page and resets the cursor to the top margin
+func (d *PDFDocument) AddPage() {
+	d.current = &bytes.Buffer{}
+	d.pages = append(d.pages, d.current)
+	d.y = PDFPageHeight - pdfMargin
+}
+
+// Text draws text at an absolute position (origin is the bottom-left corner)
+func (d *PDFDocument) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.current, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(text))
+}
+
+// Line draws a thin horizontal rule across the content area at the cursor
+func (d *PDFDocument) Line() {
+	d.ensureSpace(8)
+	fmt.Fprintf(d.current, "0.8 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n",
+		pdfMargin, d.y, PDFPageWidth-pdfMargin, d.y)
+	d.y -= 8
+}
+
+// Title writes a large bold line
+func (d *PDFDocument) Title(text string) {
+	d.ensureSpace(28)
+	d.Text(pdfMargin, d.y-20, 20, true, text)
+	d.y -= 28
+}
+
+// Heading writes a bold section heading
+func (d *PDFDocument) Heading(text string) {
+	d.ensureSpace(26)
+	d.y -= 8
+	d.Text(pdfMargin, d.y-13, 13, true, text)
+	d.y -= 18
+}
+
+// Paragraph writes a single line of body text
+func (d *PDFDocument) Paragraph(text string) {
+	d.ensureSpace(15)
+	d.Text(pdfMargin, d.y-10, 10, false, text)
+	d.y -= 15
+}
+
+// Row writes a line of cells with the given column widths
+func (d *PDFDocument) Row(cells []string, widths []float64, bold bool) {
+	d.ensureSpace(15)
+	x := pdfMargin
+	for i, cell := range cells {
+		d.Text(x, d.y-10, 10, bold, cell)
+		if i < len(widths) {
+			x += widths[i]
+		}
+	}
+	d.y -= 15
+}
+
+// Spacer moves the cursor down
+func (d *PDFDocument) Spacer(height float64) {
+	d.y -= height
+}
+
+func (d *PDFDocument) ensureSpace(height float64) {
+	if d.y-height < pdfMargin {
+		d.AddPage()
+	}
+}
+
+// Bytes serializes the document
+func (d *PDFDocument) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+
+	writeObj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4: catalog, page tree, regular and bold fonts.
+	// Pages and their content streams follow, two objects per page.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+
+	writeObj("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		writeObj(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PDFPageWidth, PDFPageHeight, 6+i*2,
+		))
+		writeObj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", page.Len(), page.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfEscape converts text to a WinAnsi-encoded PDF string literal body
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch r {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '€':
+			b.WriteString("\\200")
+		case '–':
+			b.WriteString("\\226")
+		case '—':
+			b.WriteString("\\227")
+		case '•':
+			b.WriteString("\\225")
+		case '→':
+			b.WriteString("->")
+		case '←':
+			b.WriteString("<-")
+		default:
+			switch {
+			case r >= 32 && r < 127:
+				b.WriteRune(r)
+			case r >= 160 && r <= 255:
+				fmt.Fprintf(&b, "\\%03o", r)
+			default:
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
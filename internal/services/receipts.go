@@ -0,0 +1,159 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ReceiptData is what could be read off a receipt. Fields that couldn't be
+// found are left empty.
+type ReceiptData struct {
+	Merchant string   `json:"merchant,omitempty"`
+	Date     string   `json:"date,omitempty"` // YYYY-MM-DD
+	Total    *float64 `json:"total,omitempty"`
+}
+
+var (
+	// Amounts with two decimals, in either 1,234.56 or 1.234,56 notation
+	receiptAmount  = regexp.MustCompile(`(\d{1,3}(?:[.,]\d{3})+|\d+)[.,](\d{2})\b`)
+	receiptISODate = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	receiptDate    = regexp.MustCompile(`\b(\d{1,2})[/.-](\d{1,2})[/.-](\d{4}|\d{2})\b`)
+
+	// Lines holding the amount paid, in English and Spanish
+	receiptTotalWords = []string{"total", "amount due", "balance due", "a pagar", "importe", "monto"}
+	// Lines that look like a total but aren't
+	receiptNotTotalWords = []string{"subtotal", "sub-total", "sub total", "total items", "total articulos", "itbis", "tax"}
+	// Header lines that aren't the merchant's name
+	receiptHeaderWords = []string{"receipt", "recibo", "factura", "invoice", "rnc", "tel:", "tel.", "telefono", "www", "http", "@", "fecha", "date"}
+)
+
+// ParseReceipt extracts the merchant, date and total from OCR text. Dates
+// like 03/04/2025 are read day first when dayFirst is set (most locales) and
+// month first otherwise, unless one of the numbers can only be a day.
+func ParseReceipt(text string, dayFirst bool) ReceiptData {
+	var data ReceiptData
+	lines := strings.Split(text, "\n")
+
+	// The merchant's name is usually the first line with real words on it
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if receiptMerchantLine(line) {
+			data.Merchant = line
+			break
+		}
+	}
+
+	for _, line := range lines {
+		if d, ok := receiptLineDate(line, dayFirst); ok {
+			data.Date = d.Format("2006-01-02")
+			break
+		}
+	}
+
+	// The total is the largest amount on a total line; without one, the
+	// largest amount anywhere on the receipt
+	var total, largest float64
+	for i, line := range lines {
+		amounts := receiptAmounts(line)
+		for _, a := range amounts {
+			if a > largest {
+				largest = a
+			}
+		}
+		lower := strings.ToLower(line)
+		if !containsAny(lower, receiptTotalWords) || containsAny(lower, receiptNotTotalWords) {
+			continue
+		}
+		// Some receipts print the amount on the line below the label
+		if len(amounts) == 0 && i+1 < len(lines) {
+			amounts = receiptAmounts(lines[i+1])
+		}
+		for _, a := range amounts {
+			if a > total {
+				total = a
+			}
+		}
+	}
+	if total == 0 {
+		total = largest
+	}
+	if total > 0 {
+		data.Total = &total
+	}
+
+	return data
+}
+
+func receiptMerchantLine(line string) bool {
+	letters := 0
+	for _, r := range line {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < 3 || letters*2 < len([]rune(line)) {
+		return false
+	}
+	return !containsAny(strings.ToLower(line), receiptHeaderWords)
+}
+
+func receiptAmounts(line string) []float64 {
+	// Dates like 25.12.2025 would otherwise read as amounts
+	line = receiptDate.ReplaceAllString(receiptISODate.ReplaceAllString(line, " "), " ")
+
+	var amounts []float64
+	for _, m := range receiptAmount.FindAllStringSubmatch(line, -1) {
+		whole := strings.NewReplacer(",", "", ".", "").Replace(m[1])
+		if v, err := strconv.ParseFloat(whole+"."+m[2], 64); err == nil {
+			amounts = append(amounts, v)
+		}
+	}
+	return amounts
+}
+
+func receiptLineDate(line string, dayFirst bool) (time.Time, bool) {
+	if m := receiptISODate.FindStringSubmatch(line); m != nil {
+		return receiptMakeDate(m[1], m[2], m[3])
+	}
+	m := receiptDate.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	first, _ := strconv.Atoi(m[1])
+	second, _ := strconv.Atoi(m[2])
+	year := m[3]
+	if len(year) == 2 {
+		year = "20" + year
+	}
+	if first > 12 || (dayFirst && second <= 12) {
+		return receiptMakeDate(year, m[2], m[1])
+	}
+	return receiptMakeDate(year, m[1], m[2])
+}
+
+func receiptMakeDate(year, month, day string) (time.Time, bool) {
+	y, _ := strconv.Atoi(year)
+	mo, _ := strconv.Atoi(month)
+	d, _ := strconv.Atoi(day)
+	if mo < 1 || mo > 12 || d < 1 || d > 31 || y < 2000 {
+		return time.Time{}, false
+	}
+	t := time.Date(y, time.Month(mo), d, 0, 0, 0, 0, time.UTC)
+	// Reject dates that overflowed into the next month, like 31/02
+	if t.Day() != d {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+func containsAny(s string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(s, w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// DefaultReminderDays is how many days before a due date reminders start
+const DefaultReminderDays = 3
+
+// PaymentReminderService reminds users to pay their credit cards and bills
+// before they are due
+type PaymentReminderService struct {
+	db            *sql.DB
+	notifications *NotificationService
+	daysBefore    int
+}
+
+// NewPaymentReminderService creates a new reminder service. Reminders are
+// sent daysBefore days ahead of each due date.
+func NewPaymentReminderService(db *sql.DB, notifications *NotificationService, daysBefore int) *PaymentReminderService {
+	return &PaymentReminderService{db: db, notifications: notifications, daysBefore: daysBefore}
+}
+
+type reminderCard struct {
+	id          int64
+	userID      int64
+	name        string
+	currency    string
+	closingDay  sql.NullInt64
+	dueDay      int
+	currentOwed float64
+}
+
+// Run sends reminders for every credit card and bill whose payment is due
+// within the reminder window, and for insurance policies renewing within
+// models.InsuranceRenewalReminderDays. Each due date is reminded about once.
+func (s *PaymentReminderService) Run(ctx context.Context, now time.Time) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, a.user_id, a.name, a.currency, a.closing_date, a.due_date, COALESCE(a.credit_owed, 0)
+		FROM accounts a
+		WHERE a.type = 'credit_card' AND a.due_date IS NOT NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to fetch credit cards: %w", err)
+	}
+	var cards []reminderCard
+	for rows.Next() {
+		var c reminderCard
+		if err := rows.Scan(&c.id, &c.userID, &c.name, &c.currency, &c.closingDay, &c.dueDay, &c.currentOwed); err != nil {
+			continue
+		}
+		cards = append(cards, c)
+	}
+	rows.Close()
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, c := range cards {
+		if err := s.remind(ctx, c, today); err != nil {
+			log.Printf("Payment reminder failed for account %d: %v", c.id, err)
+		}
+	}
+	if err := s.remindBills(ctx, today); err != nil {
+		return err
+	}
+	return s.remindInsuranceRenewals(ctx, today)
+}
+
+type reminderBill struct {
+	id       int64
+	userID   int64
+	name     string
+	amount   float64
+	currency string
+	autopay  bool
+	due      time.Time
+}
+
+// remindBills sends a reminder for every bill due within the reminder
+// window, once per due date. Autopay bills are announced rather than asked
+// to be paid.
+func (s *PaymentReminderService) remindBills(ctx context.Context, today time.Time) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT b.id, b.user_id, b.name, b.amount, a.currency, b.autopay, b.next_due_date
+		FROM bills b
+		JOIN accounts a ON b.account_id = a.id
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to fetch bills: %w", err)
+	}
+	var bills []reminderBill
+	for rows.Next() {
+		var b reminderBill
+		if err := rows.Scan(&b.id, &b.userID, &b.name, &b.amount, &b.currency, &b.autopay, &b.due); err != nil {
+			continue
+		}
+		bills = append(bills, b)
+	}
+	rows.Close()
+
+	for _, b := range bills {
+		due := time.Date(b.due.Year(), b.due.Month(), b.due.Day(), 0, 0, 0, 0, today.Location())
+		// Overdue bills were reminded about before they fell due
+		if due.Before(today) || today.Before(due.AddDate(0, 0, -s.daysBefore)) {
+			continue
+		}
+
+		locale := UserLocale(ctx, s.db, b.userID)
+		when := "on " + due.Format("Jan 2")
+		if due.Equal(today) {
+			when = "today"
+		}
+		amount := FormatMoney(b.amount, b.currency, locale)
+		title := fmt.Sprintf("%s due %s", b.name, when)
+		message := fmt.Sprintf("Pay %s for %s by %s.", amount, b.name, due.Format("Monday, January 2"))
+		if b.autopay {
+			title = fmt.Sprintf("%s will be paid %s", b.name, when)
+			message = fmt.Sprintf("%s for %s will be paid automatically on %s.", amount, b.name, due.Format("Monday, January 2"))
+		}
+
+		dedupeKey := fmt.Sprintf("bill_due:%d:%s", b.id, due.Format("2006-01-02"))
+		var sent bool
+		err := s.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM notifications WHERE user_id = ? AND dedupe_key = ?)
+		`, b.userID, dedupeKey).Scan(&sent)
+		if err != nil || sent {
+			continue
+		}
+
+		err = s.notifications.Notify(ctx, b.userID, models.NotificationBillDue, title, message, dedupeKey, map[string]interface{}{
+			"bill_id":  b.id,
+			"due_date": due.Format("2006-01-02"),
+			"amount":   b.amount,
+			"currency": b.currency,
+			"autopay":  b.autopay,
+		})
+		if err != nil {
+			log.Printf("Bill reminder failed for bill %d: %v", b.id, err)
+		}
+	}
+	return nil
+}
+
+// remindInsuranceRenewals sends a reminder for every insurance policy that
+// renews within models.InsuranceRenewalReminderDays, once per renewal date
+func (s *PaymentReminderService) remindInsuranceRenewals(ctx context.Context, today time.Time) error {
+	type reminderPolicy struct {
+		id       int64
+		userID   int64
+		name     string
+		premium  float64
+		currency string
+		renewal  string
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, p.user_id, p.name, p.premium, p.currency, p.renewal_date
+		FROM insurance_policies p
+		WHERE p.renewal_date >= ? AND p.renewal_date <= ?
+	`, today.Format("2006-01-02"), today.AddDate(0, 0, models.InsuranceRenewalReminderDays).Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("failed to fetch insurance policies: %w", err)
+	}
+	var policies []reminderPolicy
+	for rows.Next() {
+		var p reminderPolicy
+		if err := rows.Scan(&p.id, &p.userID, &p.name, &p.premium, &p.currency, &p.renewal); err != nil {
+			continue
+		}
+		policies = append(policies, p)
+	}
+	rows.Close()
+
+	for _, p := range policies {
+		renewal, err := time.ParseInLocation("2006-01-02", p.renewal, today.Location())
+		if err != nil {
+			continue
+		}
+
+		dedupeKey := fmt.Sprintf("insurance_renewal:%d:%s", p.id, p.renewal)
+		var sent bool
+		err = s.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM notifications WHERE user_id = ? AND dedupe_key = ?)
+		`, p.userID, dedupeKey).Scan(&sent)
+		if err != nil || sent {
+			continue
+		}
+
+		locale := UserLocale(ctx, s.db, p.userID)
+		when := "on " + renewal.Format("Jan 2")
+		if renewal.Equal(today) {
+			when = "today"
+		}
+		title := fmt.Sprintf("%s renews %s", p.name, when)
+		message := fmt.Sprintf("Your %s policy renews on %s. Review its coverage and compare quotes before then; the current premium is %s.",
+			p.name, renewal.Format("Monday, January 2"), FormatMoney(p.premium, p.currency, locale))
+
+		err = s.notifications.Notify(ctx, p.userID, models.NotificationInsuranceRenewal, title, message, dedupeKey, map[string]interface{}{
+			"policy_id":    p.id,
+			"renewal_date": p.renewal,
+			"premium":      p.premium,
+			"currency":     p.currency,
+		})
+		if err != nil {
+			log.Printf("Insurance renewal reminder failed for policy %d: %v", p.id, err)
+		}
+	}
+	return nil
+}
+
+func (s *PaymentReminderService) remind(ctx context.Context, c reminderCard, today time.Time) error {
+	due := nextDueDate(c.dueDay, today)
+	if today.Before(due.AddDate(0, 0, -s.daysBefore)) {
+		return nil
+	}
+
+	dedupeKey := fmt.Sprintf("payment_due:%d:%s", c.id, due.Format("2006-01-02"))
+	var sent bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM notifications WHERE user_id = ? AND dedupe_key = ?)
+	`, c.userID, dedupeKey).Scan(&sent)
+	if err != nil || sent {
+		return err
+	}
+
+	amount, err := s.statementAmount(ctx, c, due)
+	if err != nil {
+		return err
+	}
+	if amount < balanceTolerance {
+		return nil
+	}
+
+	locale := UserLocale(ctx, s.db, c.userID)
+	when := "on " + due.Format("Jan 2")
+	if due.Equal(today) {
+		when = "today"
+	}
+	title := fmt.Sprintf("%s payment due %s", c.name, when)
+	message := fmt.Sprintf("Pay %s on %s by %s to avoid interest and late fees.",
+		FormatMoney(amount, c.currency, locale), c.name, due.Format("Monday, January 2"))
+
+	err = s.notifications.Notify(ctx, c.userID, models.NotificationPaymentDue, title, message, dedupeKey, map[string]interface{}{
+		"account_id": c.id,
+		"due_date":   due.Format("2006-01-02"),
+		"amount":     amount,
+		"currency":   c.currency,
+	})
+	return err
+}
+
+// statementAmount is what has to be paid by due: the balance owed when the
+// statement closed, less payments made since. Cards without a closing date
+// use the current amount owed.
+func (s *PaymentReminderService) statementAmount(ctx context.Context, c reminderCard, due time.Time) (float64, error) {
+	if !c.closingDay.Valid {
+		return c.currentOwed, nil
+	}
+
+	return StatementBalance(ctx, s.db, c.id, statementClosing(int(c.closingDay.Int64), due))
+}
+
+// dayInMonth returns the given day of a month, clamped to the month's last
+// day so a due date on the 31st falls on the 30th in April
+func dayInMonth(year int, month time.Month, day int, loc *time.Location) time.Time {
+	if last := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// nextDueDate returns the first due date on or after today
+func nextDueDate(dueDay int, today time.Time) time.Time {
+	due := dayInMonth(today.Year(), today.Month(), dueDay, today.Location())
+	if due.Before(today) {
+		next := time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location())
+		due = dayInMonth(next.Year(), next.Month(), dueDay, today.Location())
+	}
+	return due
+}
+
+// NextBillDueDate returns a bill's first due date on or after today
+func NextBillDueDate(dueDay int, today time.Time) time.Time {
+	return nextDueDate(dueDay, today)
+}
+
+// FollowingBillDueDate returns the due date a month after due
+func FollowingBillDueDate(dueDay int, due time.Time) time.Time {
+	next := time.Date(due.Year(), due.Month()+1, 1, 0, 0, 0, 0, due.Location())
+	return dayInMonth(next.Year(), next.Month(), dueDay, due.Location())
+}
+
+// statementClosing returns the last statement closing date before due
+func statementClosing(closingDay int, due time.Time) time.Time {
+	closing := dayInMonth(due.Year(), due.Month(), closingDay, due.Location())
+	if !closing.Before(due) {
+		prev := time.Date(due.Year(), due.Month()-1, 1, 0, 0, 0, 0, due.Location())
+		closing = dayInMonth(prev.Year(), prev.Month(), closingDay, due.Location())
+	}
+	return closing
+}
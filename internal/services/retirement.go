@@ -0,0 +1,144 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultInvestmentReturn is the expected yearly return, as a percentage,
+// of an investment account with no interest rate set
+const DefaultInvestmentReturn = 6.0
+
+// RetirementScenarioSpread is how many percentage points the pessimistic and
+// optimistic scenarios take from or add to each account's expected rate
+const RetirementScenarioSpread = 2.0
+
+// RetirementAccount is a balance that grows until retirement, in the
+// projection's currency
+type RetirementAccount struct {
+	AccountID  int64   `json:"account_id"`
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Balance    float64 `json:"balance"`
+	YearlyRate float64 `json:"yearly_rate"`
+}
+
+// RetirementPoint is the projected position at the end of a year
+type RetirementPoint struct {
+	Year        int     `json:"year"`
+	Age         int     `json:"age"`
+	Date        string  `json:"date"` // YYYY-MM
+	Contributed float64 `json:"contributed"`
+	Value       float64 `json:"value"`
+}
+
+// RetirementScenario is one growth curve of a projection
+type RetirementScenario struct {
+	Name           string            `json:"name"`
+	RateAdjustment float64           `json:"rate_adjustment"`
+	FinalValue     float64           `json:"final_value"`
+	Contributed    float64           `json:"contributed"`
+	Growth         float64           `json:"growth"`
+	Points         []RetirementPoint `json:"points"`
+}
+
+// RetirementProjection projects savings and investments to a target age
+// under pessimistic, expected and optimistic returns
+type RetirementProjection struct {
+	CurrentAge          int                  `json:"current_age"`
+	TargetAge           int                  `json:"target_age"`
+	Years               int                  `json:"years"`
+	MonthlyContribution float64              `json:"monthly_contribution"`
+	StartingBalance     float64              `json:"starting_balance"`
+	ContributionRate    float64              `json:"contribution_rate"`
+	Accounts            []RetirementAccount  `json:"accounts"`
+	Scenarios           []RetirementScenario `json:"scenarios"`
+}
+
+// ProjectRetirement grows each account at its own yearly rate, compounded
+// monthly, and adds the monthly contribution at the balance-weighted rate
+// of all accounts (or DefaultInvestmentReturn with nothing saved yet). Each
+// scenario shifts every rate by the same number of points, never below 0.
+func ProjectRetirement(accounts []RetirementAccount, monthlyContribution float64, currentAge, targetAge int, start time.Time) *RetirementProjection {
+	projection := &RetirementProjection{
+		CurrentAge:          currentAge,
+		TargetAge:           targetAge,
+		Years:               targetAge - currentAge,
+		MonthlyContribution: monthlyContribution,
+		Accounts:            append([]RetirementAccount{}, accounts...),
+		ContributionRate:    DefaultInvestmentReturn,
+	}
+
+	var weighted float64
+	for _, a := range accounts {
+		projection.StartingBalance += a.Balance
+		weighted += a.Balance * a.YearlyRate
+	}
+	if projection.StartingBalance > 0 {
+		projection.ContributionRate = math.Round(weighted/projection.StartingBalance*100) / 100
+	}
+	projection.StartingBalance = roundCents(projection.StartingBalance)
+
+	for _, s := range []struct {
+		name       string
+		adjustment float64
+	}{
+		{"pessimistic", -RetirementScenarioSpread},
+		{"expected", 0},
+		{"optimistic", RetirementScenarioSpread},
+	} {
+		projection.Scenarios = append(projection.Scenarios,
+			projectScenario(projection, s.name, s.adjustment, start))
+	}
+	return projection
+}
+
+// projectScenario runs one scenario month by month, keeping a point at the
+// end of every year
+func projectScenario(p *RetirementProjection, name string, adjustment float64, start time.Time) RetirementScenario {
+	scenario := RetirementScenario{
+		Name:           name,
+		RateAdjustment: adjustment,
+		Points:         []RetirementPoint{},
+	}
+
+	balances := make([]float64, len(p.Accounts))
+	rates := make([]float64, len(p.Accounts))
+	for i, a := range p.Accounts {
+		balances[i] = a.Balance
+		rates[i] = MonthlyRate(math.Max(a.YearlyRate+adjustment, 0))
+	}
+	contributionRate := MonthlyRate(math.Max(p.ContributionRate+adjustment, 0))
+	var pot, contributed float64
+
+	for month := 1; month <= p.Years*12; month++ {
+		for i := range balances {
+			balances[i] += balances[i] * rates[i]
+		}
+		pot += pot*contributionRate + p.MonthlyContribution
+		contributed += p.MonthlyContribution
+
+		if month%12 != 0 {
+			continue
+		}
+		value := pot
+		for _, b := range balances {
+			value += b
+		}
+		scenario.Points = append(scenario.Points, RetirementPoint{
+			Year:        month / 12,
+			Age:         p.CurrentAge + month/12,
+			Date:        monthLabel(start, month),
+			Contributed: roundCents(contributed),
+			Value:       roundCents(value),
+		})
+	}
+
+	scenario.FinalValue = p.StartingBalance
+	if n := len(scenario.Points); n > 0 {
+		scenario.FinalValue = scenario.Points[n-1].Value
+	}
+	scenario.Contributed = roundCents(contributed)
+	scenario.Growth = roundCents(scenario.FinalValue - p.StartingBalance - scenario.Contributed)
+	return scenario
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// DefaultRunwayDays is how far ahead a runway projection looks
+const DefaultRunwayDays = 30
+
+// RunwayHistoryDays is how many days of spending are averaged into the daily
+// discretionary spending of each account
+const RunwayHistoryDays = 90
+
+// RunwayAccount is an asset account projected forward in its own currency.
+// DailySpending is its average discretionary spending per day.
+type RunwayAccount struct {
+	AccountID     int64         `json:"account_id"`
+	Name          string        `json:"name"`
+	Type          string        `json:"type"`
+	Currency      string        `json:"currency"`
+	Balance       float64       `json:"balance"`
+	DailySpending float64       `json:"daily_spending"`
+	Scheduled     float64       `json:"scheduled"`
+	EndBalance    float64       `json:"end_balance"`
+	LowestBalance float64       `json:"lowest_balance"`
+	LowestOn      string        `json:"lowest_on"`
+	NegativeOn    *string       `json:"negative_on,omitempty"`
+	Points        []RunwayPoint `json:"points"`
+}
+
+// RunwayPoint is an account's projected balance at the end of a day
+type RunwayPoint struct {
+	Date      string  `json:"date"` // YYYY-MM-DD
+	Balance   float64 `json:"balance"`
+	Scheduled float64 `json:"scheduled,omitempty"`
+}
+
+// RunwayItem is a scheduled payment out of an account, such as a bill
+type RunwayItem struct {
+	BillID    int64   `json:"bill_id"`
+	Name      string  `json:"name"`
+	AccountID int64   `json:"account_id"`
+	Date      string  `json:"date"` // YYYY-MM-DD
+	Amount    float64 `json:"amount"`
+}
+
+// RunwayBill is a bill that schedules payments in a runway projection
+type RunwayBill struct {
+	ID          int64
+	Name        string
+	AccountID   int64
+	Amount      float64
+	DueDay      int
+	NextDueDate time.Time
+}
+
+// RunwayProjection projects asset account balances day by day
+type RunwayProjection struct {
+	Days        int             `json:"days"`
+	HistoryDays int             `json:"history_days"`
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	AtRisk      bool            `json:"at_risk"`
+	Accounts    []RunwayAccount `json:"accounts"`
+	Scheduled   []RunwayItem    `json:"scheduled"`
+	Warnings    []string        `json:"warnings"`
+}
+
+// ScheduleBills lists the payments of bills falling due from today through
+// the following days. Overdue bills are still owed, so they are scheduled
+// for today.
+func ScheduleBills(bills []RunwayBill, today time.Time, days int) []RunwayItem {
+	end := today.AddDate(0, 0, days)
+	items := []RunwayItem{}
+	for _, b := range bills {
+		due := time.Date(b.NextDueDate.Year(), b.NextDueDate.Month(), b.NextDueDate.Day(), 0, 0, 0, 0, today.Location())
+		if due.Before(today) {
+			items = append(items, RunwayItem{BillID: b.ID, Name: b.Name, AccountID: b.AccountID, Date: today.Format("2006-01-02"), Amount: b.Amount})
+			due = FollowingBillDueDate(b.DueDay, due)
+			for due.Before(today) {
+				due = FollowingBillDueDate(b.DueDay, due)
+			}
+		}
+		for ; !due.After(end); due = FollowingBillDueDate(b.DueDay, due) {
+			items = append(items, RunwayItem{BillID: b.ID, Name: b.Name, AccountID: b.AccountID, Date: due.Format("2006-01-02"), Amount: b.Amount})
+		}
+	}
+	return items
+}
+
+// ProjectRunway walks each account forward from today for the given days,
+// taking its average daily spending and its scheduled payments off the
+// balance at the end of each day. An account is at risk when its balance is
+// projected to fall below zero.
+func ProjectRunway(accounts []RunwayAccount, items []RunwayItem, today time.Time, days int) *RunwayProjection {
+	projection := &RunwayProjection{
+		Days:        days,
+		HistoryDays: RunwayHistoryDays,
+		From:        today.Format("2006-01-02"),
+		To:          today.AddDate(0, 0, days).Format("2006-01-02"),
+		Accounts:    []RunwayAccount{},
+		Scheduled:   items,
+		Warnings:    []string{},
+	}
+
+	scheduled := make(map[int64]map[string]float64)
+	for _, item := range items {
+		if scheduled[item.AccountID] == nil {
+			scheduled[item.AccountID] = make(map[string]float64)
+		}
+		scheduled[item.AccountID][item.Date] += item.Amount
+	}
+
+	for _, a := range accounts {
+		balance := a.Balance
+		a.LowestBalance = balance
+		a.LowestOn = projection.From
+		a.Points = make([]RunwayPoint, 0, days+1)
+		for day := 0; day <= days; day++ {
+			date := today.AddDate(0, 0, day).Format("2006-01-02")
+			due := scheduled[a.AccountID][date]
+			// Today's spending has partly happened already and is in the
+			// balance, so it starts tomorrow
+			if day > 0 {
+				balance -= a.DailySpending
+			}
+			balance -= due
+			a.Scheduled += due
+			a.Points = append(a.Points, RunwayPoint{Date: date, Balance: math.Round(balance*100) / 100, Scheduled: due})
+
+			if balance < a.LowestBalance {
+				a.LowestBalance = balance
+				a.LowestOn = date
+			}
+			if balance < -balanceTolerance && a.NegativeOn == nil {
+				negativeOn := date
+				a.NegativeOn = &negativeOn
+				projection.AtRisk = true
+			}
+		}
+		a.EndBalance = math.Round(balance*100) / 100
+		a.LowestBalance = math.Round(a.LowestBalance*100) / 100
+		a.Scheduled = math.Round(a.Scheduled*100) / 100
+		projection.Accounts = append(projection.Accounts, a)
+	}
+	return projection
+}
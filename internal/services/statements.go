@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+)
+
+// Credit cards don't store a minimum payment, so the common issuer rule is
+// assumed: a percentage of the balance with a fixed floor
+const (
+	CardMinimumPaymentRate  = 0.02
+	CardMinimumPaymentFloor = 25
+)
+
+// CardMinimumPayment is the minimum payment due on a card balance
+func CardMinimumPayment(balance float64) float64 {
+	if balance <= 0 {
+		return 0
+	}
+	return math.Min(math.Max(balance*CardMinimumPaymentRate, CardMinimumPaymentFloor), balance)
+}
+
+// StatementBalance is what is left to pay on the statement that closed on
+// closing: the balance owed at the end of that day, less payments made since
+func StatementBalance(ctx context.Context, db *sql.DB, accountID int64, closing time.Time) (float64, error) {
+	closed := closing.AddDate(0, 0, 1).Format("2006-01-02 15:04:05")
+
+	var statementBalance sql.NullFloat64
+	err := db.QueryRowContext(ctx, `
+		SELECT balance_after FROM transactions
+		WHERE account_id = ? AND created_at < ?
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, accountID, closed).Scan(&statementBalance)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	var paid float64
+	err = db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount), 0) FROM transactions
+		WHERE account_id = ? AND type = 'payment' AND created_at >= ?
+	`, accountID, closed).Scan(&paid)
+	if err != nil {
+		return 0, err
+	}
+
+	return math.Max(statementBalance.Float64-paid, 0), nil
+}
+
+// LastStatementClosing returns the most recent statement closing date on or
+// before today
+func LastStatementClosing(closingDay int, today time.Time) time.Time {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	return statementClosing(closingDay, today.AddDate(0, 0, 1))
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramPollTimeout is how long a getUpdates call waits for new messages
+const telegramPollTimeout = 30 * time.Second
+
+// TelegramClient talks to the Telegram Bot API
+type TelegramClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// TelegramMessage is an incoming chat message
+type TelegramMessage struct {
+	UpdateID int64
+	ChatID   int64
+	Text     string
+}
+
+// TelegramFromEnv configures the bot from TELEGRAM_BOT_TOKEN, with
+// TELEGRAM_API_URL (default https://api.telegram.org) for self-hosted Bot API
+// servers. It returns nil when TELEGRAM_BOT_TOKEN is not set, which disables
+// the bot.
+func TelegramFromEnv(getenv func(string) string) (*TelegramClient, error) {
+	token := getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return nil, nil
+	}
+	if strings.ContainsAny(token, "/?# ") {
+		return nil, fmt.Errorf("invalid TELEGRAM_BOT_TOKEN")
+	}
+
+	apiURL := getenv("TELEGRAM_API_URL")
+	if apiURL == "" {
+		apiURL = "https://api.telegram.org"
+	}
+	return &TelegramClient{
+		baseURL: strings.TrimRight(apiURL, "/") + "/bot" + token,
+		client:  &http.Client{Timeout: telegramPollTimeout + 10*time.Second},
+	}, nil
+}
+
+// GetUpdates long-polls for messages after the given update ID
+func (c *TelegramClient) GetUpdates(ctx context.Context, offset int64) ([]TelegramMessage, error) {
+	params := url.Values{}
+	params.Set("offset", strconv.FormatInt(offset, 10))
+	params.Set("timeout", strconv.Itoa(int(telegramPollTimeout.Seconds())))
+	params.Set("allowed_updates", `["message"]`)
+
+	var updates []struct {
+		UpdateID int64 `json:"update_id"`
+		Message  *struct {
+			Chat struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+			Text string `json:"text"`
+		} `json:"message"`
+	}
+	if err := c.call(ctx, "getUpdates?"+params.Encode(), nil, &updates); err != nil {
+		return nil, err
+	}
+
+	messages := make([]TelegramMessage, 0, len(updates))
+	for _, u := range updates {
+		m := TelegramMessage{UpdateID: u.UpdateID}
+		// Updates without text (stickers, edits) are still returned so the
+		// offset moves past them
+		if u.Message != nil {
+			m.ChatID = u.Message.Chat.ID
+			m.Text = u.Message.Text
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// SendMessage sends a plain text message to a chat
+func (c *TelegramClient) SendMessage(ctx context.Context, chatID int64, text string) error {
+	return c.call(ctx, "sendMessage", map[string]interface{}{"chat_id": chatID, "text": text}, nil)
+}
+
+func (c *TelegramClient) call(ctx context.Context, method string, body interface{}, result interface{}) error {
+	httpMethod := http.MethodGet
+	var payload []byte
+	if body != nil {
+		httpMethod = http.MethodPost
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, httpMethod, c.baseURL+"/"+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// Don't log the URL, it holds the bot token
+		if urlErr, ok := err.(*url.Error); ok {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode telegram response: %w", err)
+	}
+	if !envelope.OK {
+		return fmt.Errorf("telegram %s failed: %s", strings.SplitN(method, "?", 2)[0], envelope.Description)
+	}
+	if result != nil {
+		if err := json.Unmarshal(envelope.Result, result); err != nil {
+			return fmt.Errorf("failed to decode telegram result: %w", err)
+		}
+	}
+	return nil
+}
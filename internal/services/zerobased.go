@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+)
+
+// ErrZeroBasedOff is returned when the user hasn't switched to zero-based
+// budgeting
+var ErrZeroBasedOff = errors.New("zero-based budgeting is off")
+
+// ZeroBasedEnabled reports whether the user budgets in zero-based mode
+func (s *BudgetService) ZeroBasedEnabled(ctx context.Context, userID int64) (bool, error) {
+	var mode sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT budget_mode FROM users WHERE id = ?", userID).Scan(&mode)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return models.BudgetMode(mode.String) == models.BudgetModeZeroBased, nil
+}
+
+// ZeroBased returns the active profile's income for the calendar month
+// starting at month and how it has been allocated. Income is what was
+// deposited that month, leaving out transfers between accounts and opening
+// balances. Allocations to categories show what has been spent against
+// them.
+func (s *BudgetService) ZeroBased(ctx context.Context, userID int64, month time.Time) (*models.ZeroBasedBudget, error) {
+	enabled, err := s.ZeroBasedEnabled(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch budget mode: %w", err)
+	}
+	if !enabled {
+		return nil, ErrZeroBasedOff
+	}
+
+	currency, err := s.preferredCurrency(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user preferences: %w", err)
+	}
+	start, end := models.BudgetPeriodMonthly.Bounds(month)
+	plan := &models.ZeroBasedBudget{
+		Month:       start.Format("2006-01"),
+		Currency:    currency,
+		Allocations: []models.BudgetAllocation{},
+		Warnings:    []string{},
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.amount, a.currency
+		FROM transactions t
+		JOIN accounts a ON t.account_id = a.id
+		WHERE a.user_id = ? AND a.profile_id = ? AND t.type = 'deposit'
+		  AND t.created_at >= ? AND t.created_at < ?
+		  AND COALESCE(t.category, 'other') NOT IN (?, ?, ?)
+		  AND t.reimbursement_status IS NULL
+	`, userID, middleware.GetProfileID(ctx), start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"),
+		string(models.CategoryTransfer), string(models.CategoryOpeningBalance), string(models.CategoryCashWithdrawal))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch income: %w", err)
+	}
+	for rows.Next() {
+		var amount float64
+		var accountCurrency string
+		if err := rows.Scan(&amount, &accountCurrency); err != nil {
+			continue
+		}
+		if accountCurrency != currency && s.exchangeService != nil {
+			if converted, err := s.exchangeService.ConvertFor(userID, amount, accountCurrency, currency); err == nil {
+				amount = converted
+			}
+		}
+		plan.Income += amount
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT b.id, b.category, b.envelope_id, COALESCE(e.name, ''), b.amount, b.created_at, b.updated_at
+		FROM budget_allocations b
+		LEFT JOIN envelopes e ON b.envelope_id = e.id
+		WHERE b.user_id = ? AND b.profile_id = ? AND b.month = ?
+		ORDER BY b.amount DESC, b.id
+	`, userID, middleware.GetProfileID(ctx), plan.Month)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch allocations: %w", err)
+	}
+	locale := middleware.GetLocale(ctx)
+	for rows.Next() {
+		var allocation models.BudgetAllocation
+		var category sql.NullString
+		var envelopeID sql.NullInt64
+		var envelopeName string
+		if err := rows.Scan(&allocation.ID, &category, &envelopeID, &envelopeName, &allocation.Amount, &allocation.CreatedAt, &allocation.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to read allocation: %w", err)
+		}
+		allocation.Month = plan.Month
+		if envelopeID.Valid {
+			allocation.EnvelopeID = &envelopeID.Int64
+			allocation.Label = envelopeName
+		} else {
+			allocation.Category = category.String
+			allocation.Label = models.LocalizedCategoryLabel(locale, models.TransactionCategory(category.String))
+		}
+		plan.Allocated += allocation.Amount
+		plan.Allocations = append(plan.Allocations, allocation)
+	}
+	rows.Close()
+	plan.RemainingToAllocate = plan.Income - plan.Allocated
+
+	spending, err := s.spending(ctx, userID, currency, start, month)
+	if err != nil {
+		return nil, err
+	}
+	formatLocale := UserLocale(ctx, s.db, userID)
+	if plan.RemainingToAllocate < -balanceTolerance {
+		plan.Warnings = append(plan.Warnings, models.TranslateMessage(locale,
+			"Allocations exceed income by "+FormatMoney(-plan.RemainingToAllocate, currency, formatLocale)))
+	}
+	for i, allocation := range plan.Allocations {
+		if allocation.Category == "" {
+			continue
+		}
+		spent := spending.total(allocation.Category, start, end)
+		plan.Allocations[i].Spent = &spent
+		if spent-allocation.Amount > balanceTolerance {
+			plan.Warnings = append(plan.Warnings, models.TranslateMessage(locale,
+				fmt.Sprintf("Spending is over the allocation for %s by %s", allocation.Label, FormatMoney(spent-allocation.Amount, currency, formatLocale))))
+		}
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,268 @@
+package testutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Redis is an in-memory stand-in for a Redis server, speaking RESP2 and
+// knowing just the commands the session store sends
+type Redis struct {
+	URL string
+
+	mu      sync.Mutex
+	strings map[string]string
+	zsets   map[string]map[string]float64
+	expires map[string]time.Time
+}
+
+// NewRedis starts a Redis stand-in that stops when the test ends
+func NewRedis(t testing.TB) *Redis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	r := &Redis{
+		URL:     "redis://" + listener.Addr().String() + "/0",
+		strings: make(map[string]string),
+		zsets:   make(map[string]map[string]float64),
+		expires: make(map[string]time.Time),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+// Keys returns the keys that haven't expired, sorted
+func (r *Redis) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	for key := range r.strings {
+		if r.live(key) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range r.zsets {
+		if r.live(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *Redis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, r.exec(args)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// live drops key if it has expired, reporting whether it's still there
+func (r *Redis) live(key string) bool {
+	if at, ok := r.expires[key]; ok && !time.Now().Before(at) {
+		delete(r.strings, key)
+		delete(r.zsets, key)
+		delete(r.expires, key)
+	}
+	_, isString := r.strings[key]
+	_, isSet := r.zsets[key]
+	return isString || isSet
+}
+
+func (r *Redis) exec(args []string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(args) == 0 {
+		return "-ERR empty command\r\n"
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		if len(args) != 5 || strings.ToUpper(args[3]) != "PX" {
+			return "-ERR syntax error\r\n"
+		}
+		ms, err := strconv.ParseInt(args[4], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer\r\n"
+		}
+		r.strings[args[1]] = args[2]
+		r.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return "+OK\r\n"
+	case "GET":
+		if !r.live(args[1]) {
+			return "$-1\r\n"
+		}
+		return bulk(r.strings[args[1]])
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if r.live(key) {
+				n++
+			}
+			delete(r.strings, key)
+			delete(r.zsets, key)
+			delete(r.expires, key)
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "PEXPIREAT":
+		ms, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer\r\n"
+		}
+		if !r.live(args[1]) {
+			return ":0\r\n"
+		}
+		r.expires[args[1]] = time.UnixMilli(ms)
+		return ":1\r\n"
+	case "ZADD":
+		score, err := strconv.ParseFloat(args[2], 64)
+		if err != nil {
+			return "-ERR value is not a valid float\r\n"
+		}
+		r.live(args[1])
+		set := r.zsets[args[1]]
+		if set == nil {
+			set = make(map[string]float64)
+			r.zsets[args[1]] = set
+		}
+		_, exists := set[args[3]]
+		set[args[3]] = score
+		if exists {
+			return ":0\r\n"
+		}
+		return ":1\r\n"
+	case "ZREM":
+		n := 0
+		if r.live(args[1]) {
+			for _, member := range args[2:] {
+				if _, ok := r.zsets[args[1]][member]; ok {
+					delete(r.zsets[args[1]], member)
+					n++
+				}
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "ZREMRANGEBYSCORE":
+		max, err := strconv.ParseFloat(strings.TrimPrefix(args[3], "("), 64)
+		if err != nil {
+			return "-ERR max is not a float\r\n"
+		}
+		n := 0
+		if r.live(args[1]) {
+			for member, score := range r.zsets[args[1]] {
+				if score < max || (score == max && !strings.HasPrefix(args[3], "(")) {
+					delete(r.zsets[args[1]], member)
+					n++
+				}
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "ZRANGE":
+		if !r.live(args[1]) {
+			return "*0\r\n"
+		}
+		members := r.sorted(args[1])
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if start < 0 {
+			start += len(members)
+		}
+		if stop < 0 {
+			stop += len(members)
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= len(members) {
+			stop = len(members) - 1
+		}
+		if start > stop {
+			return "*0\r\n"
+		}
+		reply := fmt.Sprintf("*%d\r\n", stop-start+1)
+		for _, member := range members[start : stop+1] {
+			reply += bulk(member)
+		}
+		return reply
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+// sorted returns a sorted set's members by score, then by member
+func (r *Redis) sorted(key string) []string {
+	set := r.zsets[key]
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if set[members[i]] != set[members[j]] {
+			return set[members[i]] < set[members[j]]
+		}
+		return members[i] < members[j]
+	})
+	return members
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
@@ -0,0 +1,387 @@
+// Package testutil runs the fully wired API against an in-memory SQLite
+// database for integration tests. Each App has its own database, so tests
+// can run in parallel.
+package testutil
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	appMiddleware "github.com/kengru/odin-wallet/internal/middleware"
+	"github.com/kengru/odin-wallet/internal/models"
+	"github.com/kengru/odin-wallet/internal/server"
+	"github.com/kengru/odin-wallet/internal/services"
+	"github.com/kengru/odin-wallet/pkg/database"
+)
+
+// Password is the password of every user the helpers register
+const Password = "password123"
+
+// App is a running API server backed by its own in-memory database
+type App struct {
+	DB     *sql.DB
+	Server *server.Server
+	URL    string
+}
+
+// DefaultConfig is the configuration NewApp uses: open registration, no
+// email, Telegram or OCR, and no background jobs
+func DefaultConfig() server.Config {
+	return server.Config{
+		SessionSecret:    "test-session-secret",
+		SessionCacheTTL:  30 * time.Second,
+		RegistrationMode: models.RegistrationOpen,
+		QueryTimeout:     30 * time.Second,
+		SlowTimeout:      time.Minute,
+		ReminderDays:     services.DefaultReminderDays,
+	}
+}
+
+// NewApp starts the API with DefaultConfig. Everything is shut down when
+// the test ends.
+func NewApp(t testing.TB) *App {
+	t.Helper()
+	return NewAppWithConfig(t, DefaultConfig())
+}
+
+// NewAppWithConfig starts the API with the given configuration
+func NewAppWithConfig(t testing.TB, cfg server.Config) *App {
+	t.Helper()
+
+	// Every connection to :memory: opens a new, empty database, so the pool
+	// is held to the one connection the migrations ran on
+	db, err := database.Init(":memory:", database.Options{
+		Tuning: database.Tuning{JournalMode: "MEMORY", MaxOpenConns: 1, MaxIdleConns: 1},
+		Trace:  cfg.Tracer != nil,
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize database: %v", err)
+	}
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	t.Cleanup(func() { db.Close() })
+	return serve(t, db, cfg)
+}
+
+// Peer starts another server on the app's database, like a second instance
+// behind a load balancer. Clients moved to it with On keep their cookies.
+func (a *App) Peer(t testing.TB, cfg server.Config) *App {
+	t.Helper()
+	return serve(t, a.DB, cfg)
+}
+
+func serve(t testing.TB, db *sql.DB, cfg server.Config) *App {
+	t.Helper()
+	srv, err := server.New(db, cfg)
+	if err != nil {
+		t.Fatalf("failed to set up server: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(appMiddleware.Recover)
+	r.Use(appMiddleware.Secure(appMiddleware.DefaultSecurityHeaders))
+	r.Mount("/api", srv.Routes)
+	httpServer := httptest.NewServer(r)
+	t.Cleanup(httpServer.Close)
+	return &App{DB: db, Server: srv, URL: httpServer.URL}
+}
+
+// Client makes requests to the app with its own cookie jar, so each client
+// is a separate browser session
+type Client struct {
+	t    testing.TB
+	app  *App
+	http *http.Client
+
+	// Set by Register and Login
+	User *models.User
+}
+
+// Client returns a client that isn't logged in
+func (a *App) Client(t testing.TB) *Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("failed to create cookie jar: %v", err)
+	}
+	return &Client{t: t, app: a, http: &http.Client{Jar: jar, Timeout: 30 * time.Second}}
+}
+
+// On returns the client sending its requests to another app, with the same
+// cookie jar. Cookies don't depend on the port, so the session goes along.
+func (c *Client) On(a *App) *Client {
+	return &Client{t: c.t, app: a, http: c.http, User: c.User}
+}
+
+// Register creates a user with Password and returns a client logged in as
+// them
+func (a *App) Register(t testing.TB, email string) *Client {
+	t.Helper()
+	c := a.Client(t)
+	var auth models.AuthResponse
+	c.Post("/api/auth/register", models.RegisterRequest{Email: email, Password: Password}).
+		Expect(http.StatusCreated).
+		Decode(&auth)
+	c.User = auth.User
+	return c
+}
+
+// Login logs the client in, returning the response for the caller to check
+func (c *Client) Login(email, password string) *Response {
+	c.t.Helper()
+	resp := c.Post("/api/auth/login", models.LoginRequest{Email: email, Password: password})
+	if resp.StatusCode == http.StatusOK {
+		var auth models.AuthResponse
+		resp.Decode(&auth)
+		c.User = auth.User
+	}
+	return resp
+}
+
+// Get sends a GET request
+func (c *Client) Get(path string) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodGet, path, nil)
+}
+
+// Post sends body as JSON in a POST request
+func (c *Client) Post(path string, body interface{}) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPost, path, body)
+}
+
+// Put sends body as JSON in a PUT request
+func (c *Client) Put(path string, body interface{}) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPut, path, body)
+}
+
+// Patch sends body as JSON in a PATCH request
+func (c *Client) Patch(path string, body interface{}) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodPatch, path, body)
+}
+
+// Delete sends a DELETE request
+func (c *Client) Delete(path string) *Response {
+	c.t.Helper()
+	return c.Do(http.MethodDelete, path, nil)
+}
+
+// Do sends a request to path, which includes the /api prefix. A non-nil
+// body is sent as JSON, or as is when it's a string.
+func (c *Client) Do(method, path string, body interface{}) *Response {
+	c.t.Helper()
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			c.t.Fatalf("failed to encode request body: %v", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	contentType := ""
+	if reader != nil {
+		contentType = "application/json"
+	}
+	return c.send(method, path, reader, contentType)
+}
+
+// Upload posts a multipart form with a file under "file" and the given
+// fields, the way the frontend uploads imports and attachments
+func (c *Client) Upload(path, filename string, data []byte, fields map[string]string) *Response {
+	c.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			c.t.Fatalf("failed to build upload: %v", err)
+		}
+	}
+	file, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		c.t.Fatalf("failed to build upload: %v", err)
+	}
+	file.Write(data)
+	if err := form.Close(); err != nil {
+		c.t.Fatalf("failed to build upload: %v", err)
+	}
+	return c.send(http.MethodPost, path, &body, form.FormDataContentType())
+}
+
+func (c *Client) send(method, path string, reader io.Reader, contentType string) *Response {
+	c.t.Helper()
+
+	req, err := http.NewRequest(method, c.app.URL+path, reader)
+	if err != nil {
+		c.t.Fatalf("failed to build request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("failed to read %s %s response: %v", method, path, err)
+	}
+	return &Response{t: c.t, request: method + " " + path, StatusCode: resp.StatusCode, Header: resp.Header, Body: data}
+}
+
+// Response is a response that was read in full
+type Response struct {
+	t       testing.TB
+	request string
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Expect fails the test unless the response has the given status
+func (r *Response) Expect(status int) *Response {
+	r.t.Helper()
+	if r.StatusCode != status {
+		r.t.Fatalf("%s: got status %d, want %d: %s", r.request, r.StatusCode, status, r.Body)
+	}
+	return r
+}
+
+// Decode unmarshals the JSON body into v
+func (r *Response) Decode(v interface{}) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Fatalf("%s: failed to decode %s: %v", r.request, r.Body, err)
+	}
+}
+
+// Error returns the message of an error response
+func (r *Response) Error() string {
+	r.t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	r.Decode(&body)
+	return body.Error
+}
+
+// CreateAccount creates an account, failing the test if it can't
+func (c *Client) CreateAccount(req models.CreateAccountRequest) models.Account {
+	c.t.Helper()
+	var account models.Account
+	c.Post("/api/accounts", req).Expect(http.StatusCreated).Decode(&account)
+	return account
+}
+
+// Account fetches an account, failing the test if it can't
+func (c *Client) Account(id int64) models.Account {
+	c.t.Helper()
+	var account models.Account
+	c.Get(fmt.Sprintf("/api/accounts/%d", id)).Expect(http.StatusOK).Decode(&account)
+	return account
+}
+
+// Fixture is a registered user with a typical set of DOP accounts
+type Fixture struct {
+	Client   *Client
+	Checking models.Account // debit, 25,000 balance
+	Savings  models.Account // saving, 100,000 balance
+	Card     models.Account // credit card, 50,000 limit, 5,000 owed
+}
+
+// Fixture balances
+const (
+	CheckingBalance = 25000.0
+	SavingsBalance  = 100000.0
+	CardLimit       = 50000.0
+	CardOwed        = 5000.0
+)
+
+// Seed registers a user with a checking account, a savings account and a
+// credit card
+func (a *App) Seed(t testing.TB, email string) *Fixture {
+	t.Helper()
+	c := a.Register(t, email)
+	closing, due := 5, 25
+	return &Fixture{
+		Client: c,
+		Checking: c.CreateAccount(models.CreateAccountRequest{
+			Name: "Checking", Type: models.AccountTypeDebit, Currency: "DOP", InitialBalance: float64Ptr(CheckingBalance),
+		}),
+		Savings: c.CreateAccount(models.CreateAccountRequest{
+			Name: "Savings", Type: models.AccountTypeSaving, Currency: "DOP", InitialBalance: float64Ptr(SavingsBalance),
+		}),
+		Card: c.CreateAccount(models.CreateAccountRequest{
+			Name: "Card", Type: models.AccountTypeCreditCard, Currency: "DOP",
+			CreditLimit: float64Ptr(CardLimit), CreditOwed: float64Ptr(CardOwed), ClosingDate: &closing, DueDate: &due,
+		}),
+	}
+}
+
+// SeedHistory inserts n transactions straight into the database, spread
+// evenly over the given accounts and the days before now. Every tenth one
+// is a deposit and the rest are expenses across all categories. It's meant
+// for benchmarks, so account balances aren't updated to match.
+func (a *App) SeedHistory(t testing.TB, n, days int, accounts ...models.Account) {
+	t.Helper()
+	if len(accounts) == 0 || n < 1 || days < 1 {
+		return
+	}
+
+	categories, err := json.Marshal(models.AllCategories())
+	if err != nil {
+		t.Fatalf("failed to encode categories: %v", err)
+	}
+	now := time.Now().Format("2006-01-02 15:04:05")
+	minutes := days * 24 * 60
+
+	per := n / len(accounts)
+	for i, account := range accounts {
+		count := per
+		if i == 0 {
+			count += n % len(accounts)
+		}
+		_, err := a.DB.Exec(`
+			INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+			WITH RECURSIVE seq(x) AS (SELECT 0 UNION ALL SELECT x + 1 FROM seq WHERE x + 1 < ?)
+			SELECT ?,
+			       CASE WHEN x % 10 = 0 THEN 'deposit' ELSE 'expense' END,
+			       x % 5000 + 1,
+			       'Purchase ' || x,
+			       json_extract(?, '$[' || (x % json_array_length(?)) || ']'),
+			       0,
+			       strftime('%Y-%m-%d %H:%M:%S', ?, '-' || (x * ? / ?) || ' minutes')
+			FROM seq
+		`, count, account.ID, string(categories), string(categories), now, minutes, count)
+		if err != nil {
+			t.Fatalf("failed to seed history: %v", err)
+		}
+	}
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,10 @@
+//go:build !sqlcipher
+
+package database
+
+import _ "github.com/mattn/go-sqlite3"
+
+// EncryptionSupported reports whether this build can open encrypted
+// databases. Build with -tags sqlcipher to link SQLCipher instead of plain
+// SQLite.
+const EncryptionSupported = false
@@ -0,0 +1,11 @@
+//go:build sqlcipher
+
+package database
+
+// SQLCipher is a fork of go-sqlite3 registered under the same driver name
+import _ "github.com/mutecomm/go-sqlcipher/v4"
+
+// EncryptionSupported reports whether this build can open encrypted
+// databases. Build with -tags sqlcipher to link SQLCipher instead of plain
+// SQLite.
+const EncryptionSupported = true
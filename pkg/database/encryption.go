@@ -0,0 +1,136 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// plaintextHeader starts every unencrypted SQLite file. SQLCipher encrypts
+// the header too, so an encrypted file never starts with it.
+var plaintextHeader = []byte("SQLite format 3\x00")
+
+// ValidateEncryptionKey checks a DB_ENCRYPTION_KEY value: a passphrase, or
+// 64 hex characters used as the raw 256-bit key
+func ValidateEncryptionKey(key string) error {
+	if key == "" {
+		return nil
+	}
+	if !EncryptionSupported {
+		return fmt.Errorf("DB_ENCRYPTION_KEY is set but this build has no SQLCipher support: build with -tags sqlcipher")
+	}
+	if strings.ContainsAny(key, "\"'\x00") {
+		return fmt.Errorf("DB_ENCRYPTION_KEY must not contain quotes")
+	}
+	if len(key) < 16 {
+		return fmt.Errorf("DB_ENCRYPTION_KEY must be at least 16 characters")
+	}
+	return nil
+}
+
+// sqlcipherKey formats a key for PRAGMA key. Hex keys are passed raw so
+// SQLCipher skips its passphrase derivation.
+func sqlcipherKey(key string) string {
+	if len(key) == 64 {
+		if _, err := hex.DecodeString(key); err == nil {
+			return "x'" + key + "'"
+		}
+	}
+	return key
+}
+
+// isEncrypted reports whether the database file exists and is encrypted.
+// A missing or empty file is neither, it's created in whichever form is
+// configured.
+func isEncrypted(dbPath string) (exists, encrypted bool, err error) {
+	f, err := os.Open(dbPath)
+	if os.IsNotExist(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(plaintextHeader))
+	n, err := io.ReadFull(f, header)
+	if n == 0 {
+		return false, false, nil
+	}
+	if err != nil {
+		// Shorter than a header: not a database either way
+		return true, true, nil
+	}
+	return true, !bytes.Equal(header, plaintextHeader), nil
+}
+
+// checkEncryption refuses to open a database in the wrong form, with a hint
+// instead of SQLite's "file is not a database"
+func checkEncryption(dbPath, key string) error {
+	if err := ValidateEncryptionKey(key); err != nil {
+		return err
+	}
+	exists, encrypted, err := isEncrypted(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+	if key != "" && !encrypted {
+		return fmt.Errorf("%s is not encrypted: stop the server and run `wallet encrypt-db` to encrypt it with DB_ENCRYPTION_KEY", dbPath)
+	}
+	if key == "" && encrypted {
+		return fmt.Errorf("%s is encrypted or not a SQLite database: set DB_ENCRYPTION_KEY", dbPath)
+	}
+	return nil
+}
+
+// EncryptFile writes an encrypted copy of the plaintext database at src to
+// dst with SQLCipher's sqlcipher_export. dst must not exist yet.
+func EncryptFile(src, dst, key string) error {
+	if key == "" {
+		return fmt.Errorf("DB_ENCRYPTION_KEY is not set")
+	}
+	if err := ValidateEncryptionKey(key); err != nil {
+		return err
+	}
+	exists, encrypted, err := isEncrypted(src)
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%s does not exist", src)
+	}
+	if encrypted {
+		return fmt.Errorf("%s is already encrypted", src)
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+
+	db, err := sql.Open("sqlite3", src+"?_foreign_keys=off")
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	// ATTACH and the export have to run on the same connection
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("ATTACH DATABASE ? AS encrypted KEY ?", dst, sqlcipherKey(key)); err != nil {
+		return fmt.Errorf("failed to create encrypted database: %w", err)
+	}
+	if _, err := db.Exec("SELECT sqlcipher_export('encrypted')"); err != nil {
+		db.Exec("DETACH DATABASE encrypted")
+		os.Remove(dst)
+		return fmt.Errorf("failed to copy data: %w", err)
+	}
+	if _, err := db.Exec("DETACH DATABASE encrypted"); err != nil {
+		return fmt.Errorf("failed to finish encrypted database: %w", err)
+	}
+	return nil
+}
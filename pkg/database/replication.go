@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicationMode is how the database file is replicated offsite
+type ReplicationMode string
+
+const (
+	// ReplicationOff runs a single server with no replication
+	ReplicationOff ReplicationMode = "off"
+	// ReplicationLitestream runs a single server whose WAL Litestream
+	// streams to object storage
+	ReplicationLitestream ReplicationMode = "litestream"
+	// ReplicationLiteFS runs a primary and read replicas on a LiteFS mount.
+	// Only the node holding the LiteFS lease writes.
+	ReplicationLiteFS ReplicationMode = "litefs"
+)
+
+// ParseReplicationMode parses a mode name, defaulting to off
+func ParseReplicationMode(s string) (ReplicationMode, error) {
+	switch ReplicationMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ReplicationOff:
+		return ReplicationOff, nil
+	case ReplicationLitestream:
+		return ReplicationLitestream, nil
+	case ReplicationLiteFS:
+		return ReplicationLiteFS, nil
+	default:
+		return "", fmt.Errorf("invalid replication mode %q (use off, litestream or litefs)", s)
+	}
+}
+
+// Replication tells whether this server is the one that writes. Litestream
+// and unreplicated servers always are; on LiteFS, replicas find a .primary
+// file naming the primary next to the database, and the primary doesn't.
+type Replication struct {
+	Mode   ReplicationMode
+	dbPath string
+
+	mu             sync.Mutex
+	lastCheckpoint *Checkpoint
+}
+
+func NewReplication(mode ReplicationMode, dbPath string) *Replication {
+	if mode == "" {
+		mode = ReplicationOff
+	}
+	return &Replication{Mode: mode, dbPath: dbPath}
+}
+
+// IsPrimary reports whether this server may write. It's checked on every
+// request, since LiteFS can move the primary while the server runs.
+func (r *Replication) IsPrimary() bool {
+	return r == nil || r.Mode != ReplicationLiteFS || r.Primary() == ""
+}
+
+// Primary returns the host LiteFS says is the primary, or "" on the primary
+// itself and outside LiteFS
+func (r *Replication) Primary() string {
+	if r == nil || r.Mode != ReplicationLiteFS {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(r.dbPath), ".primary"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ReplicationStatus is what the admin API reports about replication
+type ReplicationStatus struct {
+	Mode        ReplicationMode `json:"mode"`
+	Primary     bool            `json:"primary"`
+	PrimaryHost string          `json:"primary_host,omitempty"`
+	JournalMode string          `json:"journal_mode"`
+	// WALBytes is the size of the write-ahead log not yet checkpointed
+	// into the database file
+	WALBytes       int64       `json:"wal_bytes"`
+	LastCheckpoint *Checkpoint `json:"last_checkpoint,omitempty"`
+}
+
+// Status reports the mode, whether this server is the primary and the
+// state of the write-ahead log
+func (r *Replication) Status(ctx context.Context, db *sql.DB) (ReplicationStatus, error) {
+	status := ReplicationStatus{Mode: r.Mode, Primary: r.IsPrimary(), PrimaryHost: r.Primary()}
+	if err := db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&status.JournalMode); err != nil {
+		return status, fmt.Errorf("failed to read journal mode: %w", err)
+	}
+	status.JournalMode = strings.ToUpper(status.JournalMode)
+	if info, err := os.Stat(r.dbPath + "-wal"); err == nil {
+		status.WALBytes = info.Size()
+	}
+	r.mu.Lock()
+	status.LastCheckpoint = r.lastCheckpoint
+	r.mu.Unlock()
+	return status, nil
+}
+
+// Checkpoint runs a passive checkpoint and keeps its result for Status
+func (r *Replication) Checkpoint(ctx context.Context, db *sql.DB) (Checkpoint, error) {
+	cp, err := PassiveCheckpoint(ctx, db)
+	if err != nil {
+		return cp, err
+	}
+	r.mu.Lock()
+	r.lastCheckpoint = &cp
+	r.mu.Unlock()
+	return cp, nil
+}
+
+// Checkpoint is the result of copying the write-ahead log into the
+// database file
+type Checkpoint struct {
+	// Busy is set when a reader, such as Litestream, kept part of the log
+	// from being copied
+	Busy bool `json:"busy"`
+	// LogFrames is the number of frames in the log and Checkpointed the
+	// number copied into the database
+	LogFrames    int       `json:"log_frames"`
+	Checkpointed int       `json:"checkpointed_frames"`
+	At           time.Time `json:"at"`
+}
+
+// PassiveCheckpoint copies what it can of the write-ahead log into the
+// database without waiting for readers or blocking writers. Litestream
+// keeps a read transaction open on the frames it hasn't replicated yet, so
+// a passive checkpoint never drops WAL it still needs; the frames it holds
+// are left for its own checkpoints.
+func PassiveCheckpoint(ctx context.Context, db *sql.DB) (Checkpoint, error) {
+	var busy int
+	cp := Checkpoint{At: time.Now()}
+	if err := db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(PASSIVE)").Scan(&busy, &cp.LogFrames, &cp.Checkpointed); err != nil {
+		return cp, fmt.Errorf("checkpoint failed: %w", err)
+	}
+	cp.Busy = busy != 0
+	return cp, nil
+}
+
+// checkReplication refuses settings replication can't work with
+func checkReplication(mode ReplicationMode, tuning Tuning) error {
+	if mode == "" || mode == ReplicationOff {
+		return nil
+	}
+	if tuning.JournalMode != "WAL" {
+		return fmt.Errorf("%s replication needs the WAL journal mode, not %s", mode, tuning.JournalMode)
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaCheckMode controls what happens when the live schema drifts from the
+// schema the migrations produce
+type SchemaCheckMode string
+
+const (
+	SchemaCheckOff    SchemaCheckMode = "off"
+	SchemaCheckWarn   SchemaCheckMode = "warn"
+	SchemaCheckStrict SchemaCheckMode = "strict"
+)
+
+// ParseSchemaCheckMode parses a mode name, defaulting to strict
+func ParseSchemaCheckMode(s string) (SchemaCheckMode, error) {
+	switch SchemaCheckMode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", SchemaCheckStrict:
+		return SchemaCheckStrict, nil
+	case SchemaCheckWarn:
+		return SchemaCheckWarn, nil
+	case SchemaCheckOff:
+		return SchemaCheckOff, nil
+	default:
+		return "", fmt.Errorf("invalid schema check mode %q (use strict, warn or off)", s)
+	}
+}
+
+// SchemaReport lists the differences between the live and expected schema.
+// Drift entries are problems that cause runtime scan errors; notices are
+// harmless extras such as columns added by hand.
+type SchemaReport struct {
+	Drift   []string
+	Notices []string
+}
+
+// HasDrift returns true if the schema does not match the migrations
+func (r *SchemaReport) HasDrift() bool {
+	return len(r.Drift) > 0
+}
+
+type columnInfo struct {
+	Type    string
+	NotNull bool
+	PK      bool
+}
+
+type tableSchema struct {
+	Columns     map[string]columnInfo
+	ForeignKeys map[string]bool
+	Uniques     map[string]bool
+	Checks      map[string]bool
+}
+
+type schemaSnapshot struct {
+	Tables  map[string]*tableSchema
+	Indexes map[string]string // index name -> table
+}
+
+// VerifySchema compares the live schema against a reference database built by
+// running the migrations from scratch in memory
+func VerifySchema(db *sql.DB) (*SchemaReport, error) {
+	ref, err := sql.Open("sqlite3", ":memory:?_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reference database: %w", err)
+	}
+	defer ref.Close()
+	// Every connection to :memory: is a separate database
+	ref.SetMaxOpenConns(1)
+
+	if err := migrate(ref); err != nil {
+		return nil, fmt.Errorf("failed to build reference schema: %w", err)
+	}
+
+	expected, err := snapshotSchema(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference schema: %w", err)
+	}
+	live, err := snapshotSchema(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read live schema: %w", err)
+	}
+
+	return diffSchema(expected, live), nil
+}
+
+// checkSchema runs VerifySchema and applies the configured mode
+func checkSchema(db *sql.DB, mode SchemaCheckMode) error {
+	if mode == SchemaCheckOff {
+		return nil
+	}
+
+	report, err := VerifySchema(db)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range report.Notices {
+		log.Printf("Schema notice: %s", n)
+	}
+	if !report.HasDrift() {
+		return nil
+	}
+
+	for _, d := range report.Drift {
+		log.Printf("Schema drift: %s", d)
+	}
+	if mode == SchemaCheckStrict {
+		return fmt.Errorf("database schema does not match the expected migration state (%d problems); fix the database or set DB_SCHEMA_CHECK=warn to start anyway", len(report.Drift))
+	}
+	return nil
+}
+
+func snapshotSchema(db *sql.DB) (*schemaSnapshot, error) {
+	snap := &schemaSnapshot{
+		Tables:  make(map[string]*tableSchema),
+		Indexes: make(map[string]string),
+	}
+
+	rows, err := db.Query(`
+		SELECT type, name, tbl_name, COALESCE(sql, '')
+		FROM sqlite_master
+		WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	var tableSQL = make(map[string]string)
+	for rows.Next() {
+		var objType, name, table, objSQL string
+		if err := rows.Scan(&objType, &name, &table, &objSQL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if objType == "table" {
+			tableSQL[name] = objSQL
+		} else if objSQL != "" {
+			// Auto-created indexes (UNIQUE constraints) have no SQL and are
+			// covered by the table definition
+			snap.Indexes[name] = table
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for table, tSQL := range tableSQL {
+		ts := &tableSchema{
+			Columns:     make(map[string]columnInfo),
+			ForeignKeys: make(map[string]bool),
+			Uniques:     make(map[string]bool),
+			Checks:      make(map[string]bool),
+		}
+
+		colRows, err := db.Query("SELECT name, type, \"notnull\", pk FROM pragma_table_info(?)", table)
+		if err != nil {
+			return nil, err
+		}
+		for colRows.Next() {
+			var name, colType string
+			var notNull, pk int
+			if err := colRows.Scan(&name, &colType, &notNull, &pk); err != nil {
+				colRows.Close()
+				return nil, err
+			}
+			ts.Columns[name] = columnInfo{Type: strings.ToUpper(colType), NotNull: notNull == 1, PK: pk > 0}
+		}
+		colRows.Close()
+
+		fkRows, err := db.Query(`SELECT "from", "table", COALESCE("to", '') FROM pragma_foreign_key_list(?)`, table)
+		if err != nil {
+			return nil, err
+		}
+		for fkRows.Next() {
+			var from, refTable, to string
+			if err := fkRows.Scan(&from, &refTable, &to); err != nil {
+				fkRows.Close()
+				return nil, err
+			}
+			ts.ForeignKeys[fmt.Sprintf("%s -> %s(%s)", from, refTable, to)] = true
+		}
+		fkRows.Close()
+
+		// UNIQUE table constraints, identified by their column list
+		uqRows, err := db.Query(`
+			SELECT group_concat(ii.name, ', ')
+			FROM pragma_index_list(?) il, pragma_index_info(il.name) ii
+			WHERE il.origin = 'u'
+			GROUP BY il.name
+		`, table)
+		if err != nil {
+			return nil, err
+		}
+		for uqRows.Next() {
+			var cols string
+			if err := uqRows.Scan(&cols); err != nil {
+				uqRows.Close()
+				return nil, err
+			}
+			ts.Uniques[cols] = true
+		}
+		uqRows.Close()
+
+		for _, check := range extractChecks(tSQL) {
+			ts.Checks[check] = true
+		}
+
+		snap.Tables[table] = ts
+	}
+
+	return snap, nil
+}
+
+var (
+	checkKeyword = regexp.MustCompile(`(?i)\bCHECK\s*\(`)
+	whitespace   = regexp.MustCompile(`\s+`)
+)
+
+// extractChecks returns the normalized body of every CHECK constraint
+func extractChecks(tableSQL string) []string {
+	var checks []string
+	for _, loc := range checkKeyword.FindAllStringIndex(tableSQL, -1) {
+		depth := 0
+		start := loc[1] - 1
+		for i := start; i < len(tableSQL); i++ {
+			switch tableSQL[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				body := whitespace.ReplaceAllString(tableSQL[start+1:i], " ")
+				checks = append(checks, strings.TrimSpace(body))
+				break
+			}
+		}
+	}
+	return checks
+}
+
+func diffSchema(expected, live *schemaSnapshot) *SchemaReport {
+	report := &SchemaReport{}
+
+	for _, table := range sortedKeys(expected.Tables) {
+		exp := expected.Tables[table]
+		got, ok := live.Tables[table]
+		if !ok {
+			report.Drift = append(report.Drift, fmt.Sprintf("missing table %s", table))
+			continue
+		}
+
+		for _, col := range sortedKeys(exp.Columns) {
+			expCol := exp.Columns[col]
+			gotCol, ok := got.Columns[col]
+			if !ok {
+				report.Drift = append(report.Drift, fmt.Sprintf("missing column %s.%s", table, col))
+				continue
+			}
+			if gotCol.Type != expCol.Type {
+				report.Drift = append(report.Drift, fmt.Sprintf("column %s.%s has type %q, expected %q", table, col, gotCol.Type, expCol.Type))
+			}
+			if gotCol.NotNull != expCol.NotNull {
+				report.Drift = append(report.Drift, fmt.Sprintf("column %s.%s has NOT NULL=%t, expected %t", table, col, gotCol.NotNull, expCol.NotNull))
+			}
+			if gotCol.PK != expCol.PK {
+				report.Drift = append(report.Drift, fmt.Sprintf("column %s.%s has PRIMARY KEY=%t, expected %t", table, col, gotCol.PK, expCol.PK))
+			}
+		}
+		for _, col := range sortedKeys(got.Columns) {
+			if _, ok := exp.Columns[col]; !ok {
+				report.Notices = append(report.Notices, fmt.Sprintf("unexpected column %s.%s", table, col))
+			}
+		}
+
+		for _, fk := range sortedKeys(exp.ForeignKeys) {
+			if !got.ForeignKeys[fk] {
+				report.Drift = append(report.Drift, fmt.Sprintf("missing foreign key on %s: %s", table, fk))
+			}
+		}
+		for _, unique := range sortedKeys(exp.Uniques) {
+			if !got.Uniques[unique] {
+				report.Drift = append(report.Drift, fmt.Sprintf("missing constraint on %s: UNIQUE(%s)", table, unique))
+			}
+		}
+		for _, check := range sortedKeys(exp.Checks) {
+			if !got.Checks[check] {
+				report.Drift = append(report.Drift, fmt.Sprintf("missing or different constraint on %s: CHECK (%s)", table, check))
+			}
+		}
+	}
+
+	for _, table := range sortedKeys(live.Tables) {
+		if _, ok := expected.Tables[table]; !ok {
+			report.Notices = append(report.Notices, fmt.Sprintf("unexpected table %s", table))
+		}
+	}
+
+	for _, index := range sortedKeys(expected.Indexes) {
+		table, ok := live.Indexes[index]
+		if !ok {
+			report.Drift = append(report.Drift, fmt.Sprintf("missing index %s", index))
+		} else if table != expected.Indexes[index] {
+			report.Drift = append(report.Drift, fmt.Sprintf("index %s is on table %s, expected %s", index, table, expected.Indexes[index]))
+		}
+	}
+
+	return report
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
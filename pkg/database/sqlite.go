@@ -1,35 +1,78 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/kengru/odin-wallet/pkg/tracing"
 )
 
+// Options configures database initialization
+type Options struct {
+	// SchemaCheck controls startup verification of the live schema
+	SchemaCheck SchemaCheckMode
+	// Tuning sets the pragmas and connection pool limits
+	Tuning Tuning
+	// EncryptionKey opens the database with SQLCipher. It needs a build
+	// with -tags sqlcipher.
+	EncryptionKey string
+	// Replication is how the database is replicated; LiteFS replicas
+	// leave migrations to the primary
+	Replication ReplicationMode
+	// Trace records the statements run inside a trace as spans
+	Trace bool
+}
+
 // Init initializes the SQLite database and runs migrations
-func Init(dbPath string) (*sql.DB, error) {
+func Init(dbPath string, opts Options) (*sql.DB, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
+	if err := checkEncryption(dbPath, opts.EncryptionKey); err != nil {
+		return nil, err
+	}
+
+	tuning := opts.Tuning.withDefaults()
+	if err := checkReplication(opts.Replication, tuning); err != nil {
+		return nil, err
+	}
+	var db *sql.DB
+	var err error
+	if opts.Trace {
+		db, err = tracing.OpenDB("sqlite3", tuning.dsn(dbPath, opts.EncryptionKey))
+	} else {
+		db, err = sql.Open("sqlite3", tuning.dsn(dbPath, opts.EncryptionKey))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(tuning.MaxOpenConns)
+	db.SetMaxIdleConns(tuning.MaxIdleConns)
 
 	// Test connection
 	if err := db.Ping(); err != nil {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Run migrations
-	if err := migrate(db); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	// Run migrations, unless this is a read replica: its copy of the
+	// database can't be written and gets the primary's migrations
+	if NewReplication(opts.Replication, dbPath).IsPrimary() {
+		if err := migrate(db); err != nil {
+			return nil, fmt.Errorf("failed to run migrations: %w", err)
+		}
+	}
+
+	// Verify the schema matches what the migrations expect
+	if err := checkSchema(db, opts.SchemaCheck); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
@@ -59,7 +102,7 @@ func migrate(db *sql.DB) error {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			user_id INTEGER NOT NULL,
 			name TEXT NOT NULL,
-			type TEXT NOT NULL CHECK (type IN ('cash', 'debit', 'credit_card', 'loan', 'saving', 'investment')),
+			type TEXT NOT NULL CHECK (type IN ('cash', 'debit', 'credit_card', 'loan', 'saving', 'investment', 'asset')),
 			color TEXT NOT NULL DEFAULT '#DDE61F',
 			currency TEXT NOT NULL DEFAULT 'USD',
 			current_balance REAL DEFAULT 0,
@@ -79,7 +122,7 @@ func migrate(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS transactions (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			account_id INTEGER NOT NULL,
-			type TEXT NOT NULL CHECK (type IN ('deposit', 'withdrawal', 'expense', 'payment')),
+			type TEXT NOT NULL CHECK (type IN ('deposit', 'withdrawal', 'expense', 'payment', 'revalue')),
 			amount REAL NOT NULL,
 			description TEXT,
 			category TEXT DEFAULT 'other',
@@ -110,14 +153,575 @@ func migrate(db *sql.DB) error {
 			UNIQUE(user_id, category)
 		)`,
 
+		// Feature usage counters (opt-in, never leave the instance)
+		`CREATE TABLE IF NOT EXISTS feature_usage (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			feature TEXT NOT NULL,
+			count INTEGER NOT NULL DEFAULT 0,
+			first_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, feature)
+		)`,
+
+		// Notification feed
+		`CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			title TEXT NOT NULL,
+			message TEXT NOT NULL,
+			data TEXT,
+			dedupe_key TEXT,
+			acknowledged_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, dedupe_key)
+		)`,
+
+		// Channels each notification type is delivered on, for types the
+		// user changed from the defaults
+		`CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			in_app INTEGER NOT NULL DEFAULT 1,
+			email INTEGER NOT NULL DEFAULT 0,
+			push INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, type),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Every change to a category budget, so past periods use the limit
+		// that was in effect at the time. A NULL limit marks a deletion.
+		`CREATE TABLE IF NOT EXISTS budget_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			category TEXT NOT NULL,
+			monthly_limit REAL,
+			period TEXT NOT NULL DEFAULT 'monthly',
+			rollover INTEGER NOT NULL DEFAULT 0,
+			effective_from DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Numbers pinned to widgets
+		`CREATE TABLE IF NOT EXISTS pinned_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			account_id INTEGER,
+			category TEXT,
+			label TEXT,
+			position INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		// Named portions of an asset account's balance
+		`CREATE TABLE IF NOT EXISTS envelopes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			target_amount REAL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		// Money moved into (positive) or out of (negative) an envelope
+		`CREATE TABLE IF NOT EXISTS envelope_allocations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			envelope_id INTEGER NOT NULL,
+			transaction_id INTEGER,
+			amount REAL NOT NULL,
+			note TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (envelope_id) REFERENCES envelopes(id) ON DELETE CASCADE,
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL
+		)`,
+
+		// Per-account balance thresholds that notify when crossed
+		`CREATE TABLE IF NOT EXISTS balance_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			account_id INTEGER NOT NULL,
+			direction TEXT NOT NULL CHECK (direction IN ('below', 'above')),
+			threshold REAL NOT NULL,
+			triggered INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		// Account balances and limits captured on demand
+		`CREATE TABLE IF NOT EXISTS account_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_id INTEGER NOT NULL,
+			note TEXT,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			currency TEXT NOT NULL,
+			current_balance REAL NOT NULL DEFAULT 0,
+			credit_limit REAL,
+			credit_owed REAL,
+			loan_initial_amount REAL,
+			loan_current_owed REAL,
+			monthly_payment REAL,
+			yearly_interest_rate REAL,
+			status TEXT NOT NULL DEFAULT 'active',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		// Uploaded files such as receipt photos, stored with the rest of the
+		// data so backups stay a single file
+		`CREATE TABLE IF NOT EXISTS attachments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			transaction_id INTEGER,
+			filename TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL
+		)`,
+
+		// Telegram chats linked for quick entry, and the one-time codes
+		// users send the bot to link them
+		`CREATE TABLE IF NOT EXISTS telegram_links (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL UNIQUE,
+			chat_id INTEGER NOT NULL UNIQUE,
+			account_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE SET NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS telegram_link_codes (
+			code TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Exchange rates users pinned for their own conversions, e.g. a
+		// bank's rate, overriding the fetched ones
+		`CREATE TABLE IF NOT EXISTS custom_exchange_rates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			base_currency TEXT NOT NULL,
+			target_currency TEXT NOT NULL,
+			rate REAL NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, base_currency, target_currency),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Change log for the sync API: the latest change to each synced
+		// entity, numbered by a sequence that only grows. Rows are written
+		// by the triggers below.
+		`CREATE TABLE IF NOT EXISTS sync_changes (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			entity TEXT NOT NULL,
+			entity_id INTEGER NOT NULL,
+			deleted INTEGER NOT NULL DEFAULT 0,
+			changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+		// Client mutations already applied, so retried batches aren't
+		// applied twice
+		`CREATE TABLE IF NOT EXISTS sync_mutations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			client_id TEXT NOT NULL,
+			result TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(user_id, client_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Single-use registration links for invite-only instances
+		`CREATE TABLE IF NOT EXISTS invites (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			token_hash TEXT NOT NULL UNIQUE,
+			email TEXT,
+			created_by INTEGER,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			used_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (used_by) REFERENCES users(id) ON DELETE SET NULL
+		)`,
+
+		// Messages admins broadcast to every user's notification feed
+		`CREATE TABLE IF NOT EXISTS announcements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL DEFAULT 'general' CHECK (kind IN ('maintenance', 'feature', 'general')),
+			title TEXT NOT NULL,
+			message TEXT NOT NULL,
+			created_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		)`,
+
+		// What each user did, for the activity stream
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			action TEXT NOT NULL,
+			entity_id INTEGER,
+			summary TEXT NOT NULL,
+			details TEXT,
+			ip_address TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Valuation history of asset accounts (houses, cars)
+		`CREATE TABLE IF NOT EXISTS asset_valuations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_id INTEGER NOT NULL,
+			value REAL NOT NULL,
+			change REAL NOT NULL,
+			source TEXT NOT NULL CHECK (source IN ('manual', 'depreciation')),
+			note TEXT,
+			transaction_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE,
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL
+		)`,
+
+		// Optional depreciation schedule of an asset account, applied monthly
+		`CREATE TABLE IF NOT EXISTS asset_depreciation (
+			account_id INTEGER PRIMARY KEY,
+			method TEXT NOT NULL CHECK (method IN ('straight_line', 'declining_balance')),
+			yearly_rate REAL NOT NULL,
+			salvage_value REAL NOT NULL DEFAULT 0,
+			base_value REAL NOT NULL,
+			last_applied_at DATETIME NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		// Recurring monthly bills and the record of each one being paid
+		`CREATE TABLE IF NOT EXISTS bills (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			account_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			amount REAL NOT NULL,
+			due_day INTEGER NOT NULL CHECK (due_day BETWEEN 1 AND 31),
+			category TEXT NOT NULL DEFAULT 'other',
+			autopay INTEGER NOT NULL DEFAULT 0,
+			next_due_date DATETIME NOT NULL,
+			last_paid_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS bill_payments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			bill_id INTEGER NOT NULL,
+			due_date DATETIME NOT NULL,
+			amount REAL NOT NULL,
+			transaction_id INTEGER,
+			paid_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (bill_id) REFERENCES bills(id) ON DELETE CASCADE,
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE SET NULL
+		)`,
+
+		// Categories tagged as tax-relevant
+		`CREATE TABLE IF NOT EXISTS tax_categories (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			category TEXT NOT NULL,
+			treatment TEXT NOT NULL CHECK (treatment IN ('deductible', 'business')),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, category)
+		)`,
+
+		// Profiles other than the default one, which has no row
+		`CREATE TABLE IF NOT EXISTS profiles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			kind TEXT NOT NULL CHECK (kind IN ('personal', 'business')),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, name)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS advisor_grants (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			advisor_id INTEGER NOT NULL,
+			reports INTEGER NOT NULL DEFAULT 0,
+			last_used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (advisor_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, advisor_id)
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS advisor_grant_accounts (
+			grant_id INTEGER NOT NULL,
+			account_id INTEGER NOT NULL,
+			PRIMARY KEY (grant_id, account_id),
+			FOREIGN KEY (grant_id) REFERENCES advisor_grants(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		`CREATE TABLE IF NOT EXISTS fx_conversions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			transaction_id INTEGER NOT NULL,
+			from_currency TEXT NOT NULL,
+			to_currency TEXT NOT NULL,
+			amount REAL NOT NULL,
+			received_amount REAL NOT NULL,
+			mid_market_amount REAL NOT NULL,
+			fee REAL NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (transaction_id) REFERENCES transactions(id) ON DELETE CASCADE
+		)`,
+
+		// Refresh tokens for clients that don't use the session cookie. Each
+		// login starts a family; rotated tokens are kept so reuse is detected.
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			family_id TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			expires_at DATETIME NOT NULL,
+			rotated_at DATETIME,
+			revoked_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Zero-based budgeting: parts of a month's income given to a
+		// category or an envelope
+		`CREATE TABLE IF NOT EXISTS budget_allocations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			profile_id INTEGER NOT NULL DEFAULT 0,
+			month TEXT NOT NULL,
+			category TEXT,
+			envelope_id INTEGER,
+			amount REAL NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			CHECK ((category IS NULL) != (envelope_id IS NULL)),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (envelope_id) REFERENCES envelopes(id) ON DELETE CASCADE
+		)`,
+
+		// Credit scores the user recorded by hand
+		`CREATE TABLE IF NOT EXISTS credit_scores (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			score INTEGER NOT NULL,
+			bureau TEXT,
+			recorded_on TEXT NOT NULL,
+			note TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Insurance policies, optionally linked to the bill paying the premium
+		`CREATE TABLE IF NOT EXISTS insurance_policies (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			provider TEXT,
+			policy_number TEXT,
+			premium REAL NOT NULL,
+			premium_frequency TEXT NOT NULL DEFAULT 'monthly',
+			currency TEXT NOT NULL,
+			coverage_amount REAL,
+			renewal_date TEXT NOT NULL,
+			bill_id INTEGER,
+			notes TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (bill_id) REFERENCES bills(id) ON DELETE SET NULL
+		)`,
+
+		// Per-user feature flag overrides; deployment defaults come from
+		// FEATURE_FLAGS
+		`CREATE TABLE IF NOT EXISTS feature_flags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			feature TEXT NOT NULL,
+			enabled INTEGER NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, feature)
+		)`,
+
+		// Weekly report deliveries to a URL of the user's choice. last_period
+		// is the start of the last week delivered or given up on, attempts
+		// the failed tries for the week after it.
+		`CREATE TABLE IF NOT EXISTS report_webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL UNIQUE,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			weekday INTEGER NOT NULL DEFAULT 1 CHECK (weekday BETWEEN 0 AND 6),
+			last_period TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_attempt_at DATETIME,
+			last_error TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Keys automation services call the integration endpoints with,
+		// stored hashed. Each works in the profile it was created in.
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			profile_id INTEGER NOT NULL DEFAULT 0,
+			name TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			hint TEXT NOT NULL,
+			last_used_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)`,
+
+		// Findings about each profile's spending, worked out again
+		// periodically. key identifies a finding within its period, so
+		// a dismissed one isn't brought back.
+		`CREATE TABLE IF NOT EXISTS insights (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			profile_id INTEGER NOT NULL DEFAULT 0,
+			key TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			title TEXT NOT NULL,
+			message TEXT NOT NULL,
+			data TEXT,
+			period TEXT NOT NULL,
+			dismissed_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			UNIQUE(user_id, profile_id, key)
+		)`,
+
+		// Accounts whose balance a script or bank pushes in. The secret
+		// signs the updates; last_signed_at is the Unix time of the newest
+		// accepted signature, so older updates can't be replayed.
+		`CREATE TABLE IF NOT EXISTS balance_feeds (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			account_id INTEGER NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			last_balance REAL,
+			last_signed_at INTEGER,
+			last_received_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (account_id) REFERENCES accounts(id) ON DELETE CASCADE
+		)`,
+
+		// How far each audit export sink has got through audit_log
+		`CREATE TABLE IF NOT EXISTS audit_export_cursors (
+			sink TEXT PRIMARY KEY,
+			last_id INTEGER NOT NULL,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			last_success_at DATETIME
+		)`,
+
 		// Indexes for performance
 		`CREATE INDEX IF NOT EXISTS idx_accounts_user_id ON accounts(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions(account_id)`,
+		// Covers listing an account's history newest first and date range
+		// scans per account; it replaced an index on account_id alone
+		`DROP INDEX IF EXISTS idx_transactions_account_id`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_account_created ON transactions(account_id, created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_transactions_created_at ON transactions(created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens(family_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_exchange_rates_base ON exchange_rates(base_currency)`,
 		`CREATE INDEX IF NOT EXISTS idx_category_budgets_user_id ON category_budgets(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_user_created ON notifications(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_dedupe_key ON notifications(dedupe_key)`,
+		`CREATE INDEX IF NOT EXISTS idx_pinned_items_user_id ON pinned_items(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_budget_versions_user_category ON budget_versions(user_id, category, effective_from)`,
+		`CREATE INDEX IF NOT EXISTS idx_envelopes_account_id ON envelopes(account_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_envelope_allocations_envelope_id ON envelope_allocations(envelope_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_balance_alerts_account_id ON balance_alerts(account_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_account_snapshots_account_id ON account_snapshots(account_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_user_id ON attachments(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_transaction_id ON attachments(transaction_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_telegram_link_codes_user_id ON telegram_link_codes(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_changes_user_seq ON sync_changes(user_id, seq)`,
+		`CREATE INDEX IF NOT EXISTS idx_sync_changes_entity ON sync_changes(entity, entity_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_asset_valuations_account_id ON asset_valuations(account_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_bills_user_id ON bills(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_bill_payments_bill_id ON bill_payments(bill_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_advisor_grants_advisor_id ON advisor_grants(advisor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_fx_conversions_user_id ON fx_conversions(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_budget_allocations_user_month ON budget_allocations(user_id, profile_id, month)`,
+		`CREATE INDEX IF NOT EXISTS idx_credit_scores_user_id ON credit_scores(user_id, recorded_on)`,
+		`CREATE INDEX IF NOT EXISTS idx_insurance_policies_user_id ON insurance_policies(user_id)`,
+	}
+
+	// Record every write to synced entities in the change log. The owner
+	// expression finds the user; deletes cascading from an account have no
+	// owner left and are covered by the account's own tombstone.
+	syncedTables := []struct {
+		table  string
+		entity string
+		owner  string
+	}{
+		{"accounts", "account", "%s.user_id"},
+		{"transactions", "transaction", "(SELECT user_id FROM accounts WHERE id = %s.account_id)"},
+	}
+	for _, t := range syncedTables {
+		for _, event := range []string{"INSERT", "UPDATE", "DELETE"} {
+			row, deleted := "NEW", 0
+			if event == "DELETE" {
+				row, deleted = "OLD", 1
+			}
+			owner := fmt.Sprintf(t.owner, row)
+			migrations = append(migrations, fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS sync_%s_%s AFTER %s ON %s
+				WHEN %s IS NOT NULL
+				BEGIN
+					DELETE FROM sync_changes WHERE entity = '%s' AND entity_id = %s.id;
+					INSERT INTO sync_changes (user_id, entity, entity_id, deleted) VALUES (%s, '%s', %s.id, %d);
+				END`,
+				t.table, strings.ToLower(event), event, t.table,
+				owner,
+				t.entity, row,
+				owner, t.entity, row, deleted))
+		}
 	}
 
 	for _, migration := range migrations {
@@ -135,7 +739,49 @@ func migrate(db *sql.DB) error {
 		{"users", "name", "ALTER TABLE users ADD COLUMN name TEXT"},
 		{"users", "preferred_currency", "ALTER TABLE users ADD COLUMN preferred_currency TEXT DEFAULT 'DOP'"},
 		{"users", "onboarding_completed", "ALTER TABLE users ADD COLUMN onboarding_completed INTEGER DEFAULT 0"},
+		{"users", "is_admin", "ALTER TABLE users ADD COLUMN is_admin INTEGER DEFAULT 0"},
+		{"users", "telemetry_opt_in", "ALTER TABLE users ADD COLUMN telemetry_opt_in INTEGER DEFAULT 0"},
+		{"users", "monthly_budget", "ALTER TABLE users ADD COLUMN monthly_budget REAL"},
+		{"users", "locale", "ALTER TABLE users ADD COLUMN locale TEXT DEFAULT 'en-US'"},
+		{"users", "week_start", "ALTER TABLE users ADD COLUMN week_start INTEGER DEFAULT 0"},
+		{"users", "month_start_day", "ALTER TABLE users ADD COLUMN month_start_day INTEGER DEFAULT 1"},
+		{"accounts", "status", "ALTER TABLE accounts ADD COLUMN status TEXT DEFAULT 'active'"},
+		{"accounts", "frozen_until", "ALTER TABLE accounts ADD COLUMN frozen_until DATETIME"},
+		{"accounts", "frozen_reason", "ALTER TABLE accounts ADD COLUMN frozen_reason TEXT"},
+		{"accounts", "due_date", "ALTER TABLE accounts ADD COLUMN due_date INTEGER"},
+		{"accounts", "version", "ALTER TABLE accounts ADD COLUMN version INTEGER NOT NULL DEFAULT 0"},
+		{"accounts", "icon", "ALTER TABLE accounts ADD COLUMN icon TEXT"},
+		{"accounts", "institution", "ALTER TABLE accounts ADD COLUMN institution TEXT"},
+		{"accounts", "last4", "ALTER TABLE accounts ADD COLUMN last4 TEXT"},
 		{"transactions", "linked_transaction_id", "ALTER TABLE transactions ADD COLUMN linked_transaction_id INTEGER REFERENCES transactions(id)"},
+		{"transactions", "notes", "ALTER TABLE transactions ADD COLUMN notes TEXT"},
+		{"transactions", "metadata", "ALTER TABLE transactions ADD COLUMN metadata TEXT"},
+		{"transactions", "is_private", "ALTER TABLE transactions ADD COLUMN is_private INTEGER DEFAULT 0"},
+		{"transactions", "latitude", "ALTER TABLE transactions ADD COLUMN latitude REAL"},
+		{"transactions", "longitude", "ALTER TABLE transactions ADD COLUMN longitude REAL"},
+		{"transactions", "place_name", "ALTER TABLE transactions ADD COLUMN place_name TEXT"},
+		{"transactions", "reimbursement_status", "ALTER TABLE transactions ADD COLUMN reimbursement_status TEXT CHECK (reimbursement_status IN ('pending', 'reimbursed', 'reimbursement'))"},
+		{"transactions", "reimbursed_by_id", "ALTER TABLE transactions ADD COLUMN reimbursed_by_id INTEGER REFERENCES transactions(id) ON DELETE SET NULL"},
+		{"transactions", "tax_treatment", "ALTER TABLE transactions ADD COLUMN tax_treatment TEXT CHECK (tax_treatment IN ('deductible', 'business', 'none'))"},
+		// Profile columns are 0 for the default profile
+		{"accounts", "profile_id", "ALTER TABLE accounts ADD COLUMN profile_id INTEGER NOT NULL DEFAULT 0"},
+		{"category_budgets", "profile_id", "ALTER TABLE category_budgets ADD COLUMN profile_id INTEGER NOT NULL DEFAULT 0"},
+		{"budget_versions", "profile_id", "ALTER TABLE budget_versions ADD COLUMN profile_id INTEGER NOT NULL DEFAULT 0"},
+		{"category_budgets", "period", "ALTER TABLE category_budgets ADD COLUMN period TEXT DEFAULT 'monthly'"},
+		{"category_budgets", "rollover", "ALTER TABLE category_budgets ADD COLUMN rollover INTEGER DEFAULT 0"},
+		{"category_budgets", "freeze_account_id", "ALTER TABLE category_budgets ADD COLUMN freeze_account_id INTEGER REFERENCES accounts(id) ON DELETE SET NULL"},
+		{"category_budgets", "frozen_period", "ALTER TABLE category_budgets ADD COLUMN frozen_period TEXT"},
+		// First instant of the user's open period; everything before is closed
+		{"users", "closed_before", "ALTER TABLE users ADD COLUMN closed_before DATETIME"},
+		{"users", "budget_mode", "ALTER TABLE users ADD COLUMN budget_mode TEXT DEFAULT 'standard'"},
+		{"users", "credit_score_reminders", "ALTER TABLE users ADD COLUMN credit_score_reminders INTEGER DEFAULT 0"},
+		{"users", "quiet_hours_start", "ALTER TABLE users ADD COLUMN quiet_hours_start TEXT"},
+		{"users", "quiet_hours_end", "ALTER TABLE users ADD COLUMN quiet_hours_end TEXT"},
+		{"users", "quiet_hours_timezone", "ALTER TABLE users ADD COLUMN quiet_hours_timezone TEXT"},
+		// Notifications hidden from the feed are still kept for deduping
+		{"notifications", "in_app", "ALTER TABLE notifications ADD COLUMN in_app INTEGER NOT NULL DEFAULT 1"},
+		// Email and push channels held back by quiet hours, comma separated
+		{"notifications", "pending_channels", "ALTER TABLE notifications ADD COLUMN pending_channels TEXT"},
 	}
 
 	for _, m := range alterMigrations {
@@ -146,9 +792,151 @@ func migrate(db *sql.DB) error {
 		}
 	}
 
+	// Indexes on columns added above
+	alterIndexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_transactions_linked_transaction_id ON transactions(linked_transaction_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_transactions_reimbursed_by ON transactions(reimbursed_by_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_pending ON notifications(user_id) WHERE pending_channels IS NOT NULL`,
+	}
+
+	for _, idx := range alterIndexes {
+		if _, err := db.Exec(idx); err != nil {
+			return fmt.Errorf("index migration failed: %w\nSQL: %s", err, idx)
+		}
+	}
+
+	// Widen CHECK constraints of tables created before a value was allowed.
+	// SQLite can't alter a constraint, so the stored table definition is
+	// rewritten, which is safe as long as existing rows still pass.
+	checkMigrations := []struct {
+		table string
+		old   string
+		new   string
+	}{
+		{"transactions",
+			"CHECK (type IN ('deposit', 'withdrawal', 'expense', 'payment'))",
+			"CHECK (type IN ('deposit', 'withdrawal', 'expense', 'payment', 'revalue'))"},
+		{"accounts",
+			"CHECK (type IN ('cash', 'debit', 'credit_card', 'loan', 'saving', 'investment'))",
+			"CHECK (type IN ('cash', 'debit', 'credit_card', 'loan', 'saving', 'investment', 'asset'))"},
+	}
+
+	for _, m := range checkMigrations {
+		if err := widenCheck(db, m.table, m.old, m.new); err != nil {
+			return fmt.Errorf("check migration on %s failed: %w", m.table, err)
+		}
+	}
+
+	// Change UNIQUE constraints of tables created before a column was part
+	// of them. Unlike a CHECK, the constraint has an index behind it, so the
+	// table is rebuilt.
+	uniqueMigrations := []struct {
+		table string
+		old   string
+		new   string
+	}{
+		{"category_budgets", "UNIQUE(user_id, category)", "UNIQUE(user_id, profile_id, category)"},
+	}
+
+	for _, m := range uniqueMigrations {
+		if err := rebuildTable(db, m.table, m.old, m.new); err != nil {
+			return fmt.Errorf("unique migration on %s failed: %w", m.table, err)
+		}
+	}
+
+	// Data migrations run after the schema is complete and must be idempotent
+	dataMigrations := []string{
+		// Budgets created before versioning start their history at creation
+		`INSERT INTO budget_versions (user_id, category, monthly_limit, period, rollover, effective_from, created_at)
+		SELECT cb.user_id, cb.category, cb.monthly_limit, COALESCE(cb.period, 'monthly'), COALESCE(cb.rollover, 0), cb.created_at, cb.updated_at
+		FROM category_budgets cb
+		WHERE NOT EXISTS (
+			SELECT 1 FROM budget_versions v WHERE v.user_id = cb.user_id AND v.category = cb.category
+		)`,
+		// Accounts created before opening balance transactions get one for
+		// the balance their history doesn't explain: the balance before the
+		// first transaction, or the stored balance if there are none
+		`INSERT INTO transactions (account_id, type, amount, description, category, balance_after, created_at)
+		SELECT o.id,
+		       CASE
+		           WHEN o.type IN ('credit_card', 'loan') THEN CASE WHEN o.opening < 0 THEN 'payment' ELSE 'expense' END
+		           ELSE CASE WHEN o.opening < 0 THEN 'withdrawal' ELSE 'deposit' END
+		       END,
+		       ABS(o.opening), 'Opening balance', 'opening_balance', o.opening, o.created_at
+		FROM (
+			SELECT a.id, a.type, a.created_at,
+			       COALESCE(
+			           (SELECT t.balance_after - CASE WHEN t.type IN ('deposit', 'expense', 'revalue') THEN t.amount ELSE -t.amount END
+			            FROM transactions t
+			            WHERE t.account_id = a.id
+			            ORDER BY t.created_at, t.id
+			            LIMIT 1),
+			           CASE a.type
+			               WHEN 'credit_card' THEN COALESCE(a.credit_owed, 0)
+			               WHEN 'loan' THEN COALESCE(a.loan_current_owed, 0)
+			               ELSE a.current_balance
+			           END
+			       ) AS opening
+			FROM accounts a
+			WHERE NOT EXISTS (
+				SELECT 1 FROM transactions t WHERE t.account_id = a.id AND t.category = 'opening_balance'
+			)
+		) o
+		WHERE ABS(o.opening) >= 0.005`,
+	}
+
+	for _, m := range dataMigrations {
+		if _, err := db.Exec(m); err != nil {
+			return fmt.Errorf("data migration failed: %w\nSQL: %s", err, m)
+		}
+	}
+
 	return nil
 }
 
+// widenCheck replaces a CHECK constraint in a table's stored definition. It
+// does nothing once the definition no longer contains the old constraint.
+func widenCheck(db *sql.DB, table, old, new string) error {
+	var found bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ? AND instr(sql, ?) > 0)", table, old).Scan(&found)
+	if err != nil || !found {
+		return err
+	}
+
+	// writable_schema is per connection, so everything runs on one
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRow("PRAGMA schema_version").Scan(&version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("PRAGMA writable_schema = ON"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sqlite_master SET sql = replace(sql, ?, ?) WHERE type = 'table' AND name = ?", old, new, table); err != nil {
+		return err
+	}
+	// Bumping the version makes every connection reload the schema
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA schema_version = %d", version+1)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("PRAGMA writable_schema = OFF"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 // columnExists checks if a column exists in a table
 func columnExists(db *sql.DB, table, column string) bool {
 	query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name='%s'", table, column)
@@ -158,3 +946,64 @@ func columnExists(db *sql.DB, table, column string) bool {
 	}
 	return count > 0
 }
+
+// rebuildTable replaces old with new in a table's definition by copying its
+// rows into a table created from the new definition. Indexes are recreated;
+// the table must have no triggers and no other table may reference it.
+func rebuildTable(db *sql.DB, table, old, new string) error {
+	var tableSQL string
+	err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ? AND instr(sql, ?) > 0", table, old).Scan(&tableSQL)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Foreign keys can only be switched off outside a transaction, and the
+	// pragma is per connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	rows, err := conn.QueryContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err != nil {
+		return err
+	}
+	var indexes []string
+	for rows.Next() {
+		var indexSQL string
+		if err := rows.Scan(&indexSQL); err == nil {
+			indexes = append(indexes, indexSQL)
+		}
+	}
+	rows.Close()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rebuilt := table + "_rebuild"
+	createSQL := strings.Replace(strings.Replace(tableSQL, old, new, 1), "CREATE TABLE "+table, "CREATE TABLE "+rebuilt, 1)
+	statements := []string{
+		createSQL,
+		fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", rebuilt, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, table),
+	}
+	for _, stmt := range append(statements, indexes...) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\nSQL: %s", err, stmt)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+)
+
+// Statements caches prepared statements for the queries on hot paths, so
+// SQLite parses each of them once per database rather than on every call.
+// Queries are keyed by their exact text.
+type Statements struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+// NewStatements creates an empty statement cache for db
+func NewStatements(db *sql.DB) *Statements {
+	return &Statements{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// Prepare returns the cached statement for query, preparing it first if
+// needed. Preparing takes a connection from the pool, so it must not be
+// called while the caller holds one in a transaction; use Warm and TxExecContext for
+// statements run inside transactions.
+func (s *Statements) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	stmt, ok := s.stmts[query]
+	s.mu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+
+	// Prepared without holding the lock, which would otherwise be held
+	// while waiting for a free connection
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another caller may have prepared it in the meantime
+	if cached, ok := s.stmts[query]; ok {
+		stmt.Close()
+		return cached, nil
+	}
+	s.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Warm prepares queries ahead of their first use. A query that fails to
+// prepare is logged and left to run unprepared.
+func (s *Statements) Warm(queries ...string) {
+	for _, query := range queries {
+		if _, err := s.Prepare(context.Background(), query); err != nil {
+			log.Printf("Failed to prepare statement: %v\nSQL: %s", err, query)
+		}
+	}
+}
+
+// QueryRowContext runs a query expected to return at most one row with its
+// cached statement
+func (s *Statements) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	stmt, err := s.Prepare(ctx, query)
+	if err != nil {
+		// The error surfaces when the row is scanned
+		return s.db.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// ExecContext runs a query without returning rows with its cached statement
+func (s *Statements) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := s.Prepare(ctx, query)
+	if err != nil {
+		return s.db.ExecContext(ctx, query, args...)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// TxExecContext runs a query in tx with its cached statement. Only warmed
+// statements are used; anything else runs unprepared, since preparing it
+// would need a second connection.
+func (s *Statements) TxExecContext(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	s.mu.Lock()
+	stmt, ok := s.stmts[query]
+	s.mu.Unlock()
+	if !ok {
+		return tx.ExecContext(ctx, query, args...)
+	}
+	return tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+}
+
+// Close closes every cached statement
+func (s *Statements) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range s.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.stmts, query)
+	}
+	return firstErr
+}
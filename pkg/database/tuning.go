@@ -0,0 +1,135 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tuning holds the SQLite pragmas and connection pool settings. Zero values
+// fall back to DefaultTuning.
+type Tuning struct {
+	// JournalMode is the journal_mode pragma; WAL lets readers proceed while
+	// a write is in progress
+	JournalMode string
+	// Synchronous is the synchronous pragma; NORMAL is durable in WAL mode
+	// except for the last commits before a power loss
+	Synchronous string
+	// BusyTimeout is how long a connection waits for a lock held by another
+	// before failing with "database is locked"
+	BusyTimeout  time.Duration
+	MaxOpenConns int
+	MaxIdleConns int
+}
+
+// DefaultTuning suits a single server handling concurrent API requests
+var DefaultTuning = Tuning{
+	JournalMode:  "WAL",
+	Synchronous:  "NORMAL",
+	BusyTimeout:  5 * time.Second,
+	MaxOpenConns: 10,
+	MaxIdleConns: 5,
+}
+
+var (
+	journalModes = []string{"DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF"}
+	syncModes    = []string{"OFF", "NORMAL", "FULL", "EXTRA"}
+)
+
+// TuningFromEnv reads tuning overrides from DB_JOURNAL_MODE, DB_SYNCHRONOUS,
+// DB_BUSY_TIMEOUT (e.g. "5s"), DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS
+func TuningFromEnv(getenv func(string) string) (Tuning, error) {
+	t := DefaultTuning
+
+	if v := getenv("DB_JOURNAL_MODE"); v != "" {
+		mode, err := oneOf("DB_JOURNAL_MODE", v, journalModes)
+		if err != nil {
+			return t, err
+		}
+		t.JournalMode = mode
+	}
+	if v := getenv("DB_SYNCHRONOUS"); v != "" {
+		mode, err := oneOf("DB_SYNCHRONOUS", v, syncModes)
+		if err != nil {
+			return t, err
+		}
+		t.Synchronous = mode
+	}
+	if v := getenv("DB_BUSY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return t, fmt.Errorf("invalid DB_BUSY_TIMEOUT %q: expected a duration like 5s", v)
+		}
+		t.BusyTimeout = d
+	}
+	if v := getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return t, fmt.Errorf("invalid DB_MAX_OPEN_CONNS %q: expected a positive integer", v)
+		}
+		t.MaxOpenConns = n
+	}
+	if v := getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return t, fmt.Errorf("invalid DB_MAX_IDLE_CONNS %q: expected a non-negative integer", v)
+		}
+		t.MaxIdleConns = n
+	}
+	if t.MaxIdleConns > t.MaxOpenConns {
+		t.MaxIdleConns = t.MaxOpenConns
+	}
+
+	return t, nil
+}
+
+func oneOf(name, value string, allowed []string) (string, error) {
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	for _, a := range allowed {
+		if upper == a {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s %q: expected one of %s", name, value, strings.Join(allowed, ", "))
+}
+
+// withDefaults fills unset fields from DefaultTuning
+func (t Tuning) withDefaults() Tuning {
+	if t.JournalMode == "" {
+		t.JournalMode = DefaultTuning.JournalMode
+	}
+	if t.Synchronous == "" {
+		t.Synchronous = DefaultTuning.Synchronous
+	}
+	if t.BusyTimeout == 0 {
+		t.BusyTimeout = DefaultTuning.BusyTimeout
+	}
+	if t.MaxOpenConns == 0 {
+		t.MaxOpenConns = DefaultTuning.MaxOpenConns
+	}
+	if t.MaxIdleConns == 0 {
+		t.MaxIdleConns = DefaultTuning.MaxIdleConns
+	}
+	return t
+}
+
+// dsn builds the connection string. The pragmas are passed as driver
+// parameters so every pooled connection gets them, not just the first.
+// Transactions take the write lock up front (_txlock=immediate): a deferred
+// transaction that reads a balance and then writes can't wait out a
+// concurrent writer and fails with "database is locked" regardless of the
+// busy timeout. A non-empty key is set before any other pragma.
+func (t Tuning) dsn(dbPath, key string) string {
+	params := url.Values{}
+	if key != "" {
+		params.Set("_pragma_key", sqlcipherKey(key))
+	}
+	params.Set("_foreign_keys", "on")
+	params.Set("_journal_mode", t.JournalMode)
+	params.Set("_synchronous", t.Synchronous)
+	params.Set("_busy_timeout", strconv.FormatInt(t.BusyTimeout.Milliseconds(), 10))
+	params.Set("_txlock", "immediate")
+	return dbPath + "?" + params.Encode()
+}
@@ -0,0 +1,229 @@
+// Package hooks lets self-hosters compile extensions into the server, such
+// as pushing new transactions to their own spreadsheet, without changing the
+// handlers. A plugin is a Go package that registers its hooks in init:
+//
+//	func init() {
+//		hooks.OnTransactionCreated(func(ctx context.Context, t hooks.Transaction) {
+//			appendRow(ctx, t)
+//		})
+//	}
+//
+// and is compiled in with a blank import in cmd/server.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Timeout bounds each run of a notification hook
+const Timeout = 30 * time.Second
+
+// ErrSkipRow is returned by an import row hook to leave the row out of the
+// import
+var ErrSkipRow = errors.New("skip import row")
+
+// Transaction is a transaction that was just recorded on one of a user's
+// accounts
+type Transaction struct {
+	ID           int64
+	UserID       int64
+	AccountID    int64
+	Type         string
+	Amount       float64
+	Currency     string
+	Description  string
+	Category     string
+	BalanceAfter float64
+	IsPrivate    bool
+	CreatedAt    time.Time
+}
+
+// Report is an income and spending report a user just generated
+type Report struct {
+	UserID        int64
+	Format        string // "json" or "pdf"
+	Period        string // "week" or "month"
+	PeriodStart   string
+	PeriodEnd     string
+	Currency      string
+	TotalIncome   float64
+	TotalExpenses float64
+	// ExpensesByCategory is what was spent per category, in Currency
+	ExpensesByCategory map[string]float64
+}
+
+// ImportRow is one entry of a file being imported, before it's saved. Hooks
+// may rewrite Description, Notes and Category; the rest is read-only.
+type ImportRow struct {
+	UserID      int64
+	Format      string
+	Date        time.Time
+	Account     string
+	Amount      float64
+	Transfer    bool
+	Description string
+	Notes       string
+	Category    string
+}
+
+// Registry holds the hooks registered for each extension point.
+// Notification hooks run in the background, each on its own goroutine, so a
+// slow plugin never holds up a request; import row hooks run in order while
+// the file is read.
+type Registry struct {
+	mu                 sync.RWMutex
+	transactionCreated []func(context.Context, Transaction)
+	reportGenerated    []func(context.Context, Report)
+	importRow          []func(context.Context, *ImportRow) error
+	shutdown           []func(context.Context)
+
+	running sync.WaitGroup
+}
+
+func New() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry plugins register with and the server runs
+var Default = New()
+
+// OnTransactionCreated registers fn with Default
+func OnTransactionCreated(fn func(context.Context, Transaction)) {
+	Default.OnTransactionCreated(fn)
+}
+
+// OnReportGenerated registers fn with Default
+func OnReportGenerated(fn func(context.Context, Report)) {
+	Default.OnReportGenerated(fn)
+}
+
+// OnImportRow registers fn with Default
+func OnImportRow(fn func(context.Context, *ImportRow) error) {
+	Default.OnImportRow(fn)
+}
+
+// OnShutdown registers fn with Default
+func OnShutdown(fn func(context.Context)) {
+	Default.OnShutdown(fn)
+}
+
+// OnTransactionCreated runs fn after every transaction recorded through the
+// API, sync, bills or the Telegram bot. Imports report their rows through
+// OnImportRow instead.
+func (r *Registry) OnTransactionCreated(fn func(context.Context, Transaction)) {
+	r.mu.Lock()
+	r.transactionCreated = append(r.transactionCreated, fn)
+	r.mu.Unlock()
+}
+
+// OnReportGenerated runs fn after a user fetches a report
+func (r *Registry) OnReportGenerated(fn func(context.Context, Report)) {
+	r.mu.Lock()
+	r.reportGenerated = append(r.reportGenerated, fn)
+	r.mu.Unlock()
+}
+
+// OnImportRow runs fn on every row of an import and of its preview. Returning
+// ErrSkipRow drops the row; any other error rejects the whole file, with the
+// error shown to the user.
+func (r *Registry) OnImportRow(fn func(context.Context, *ImportRow) error) {
+	r.mu.Lock()
+	r.importRow = append(r.importRow, fn)
+	r.mu.Unlock()
+}
+
+// OnShutdown runs fn once when the server shuts down safely: after it
+// stopped taking requests and its background jobs and notification hooks
+// finished, and before the database is closed, so fn can still write. The
+// context ends when the shutdown timeout runs out.
+func (r *Registry) OnShutdown(fn func(context.Context)) {
+	r.mu.Lock()
+	r.shutdown = append(r.shutdown, fn)
+	r.mu.Unlock()
+}
+
+// TransactionCreated runs the transaction created hooks
+func (r *Registry) TransactionCreated(ctx context.Context, t Transaction) {
+	r.mu.RLock()
+	fns := r.transactionCreated
+	r.mu.RUnlock()
+	for _, fn := range fns {
+		r.background(ctx, "transaction created", func(ctx context.Context) { fn(ctx, t) })
+	}
+}
+
+// ReportGenerated runs the report generated hooks
+func (r *Registry) ReportGenerated(ctx context.Context, report Report) {
+	r.mu.RLock()
+	fns := r.reportGenerated
+	r.mu.RUnlock()
+	for _, fn := range fns {
+		r.background(ctx, "report generated", func(ctx context.Context) { fn(ctx, report) })
+	}
+}
+
+// ImportRow runs the import row hooks on a row, stopping at the first error
+func (r *Registry) ImportRow(ctx context.Context, row *ImportRow) error {
+	r.mu.RLock()
+	fns := r.importRow
+	r.mu.RUnlock()
+	for _, fn := range fns {
+		if err := fn(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasImportRowHooks reports whether any import row hook is registered, so
+// imports can skip copying rows when there's nothing to run
+func (r *Registry) HasImportRowHooks() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.importRow) > 0
+}
+
+// Wait blocks until the notification hooks already started have returned
+func (r *Registry) Wait() {
+	r.running.Wait()
+}
+
+// Shutdown runs the shutdown hooks in the order they were registered. A
+// panicking plugin is logged and the rest still run.
+func (r *Registry) Shutdown(ctx context.Context) {
+	r.mu.RLock()
+	fns := r.shutdown
+	r.mu.RUnlock()
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if rec := recover(); rec != nil {
+					log.Printf("Panic in shutdown hook: %v\n%s", rec, debug.Stack())
+				}
+			}()
+			fn(ctx)
+		}()
+	}
+}
+
+// background runs a hook detached from the request that triggered it. A
+// panicking plugin is logged rather than taking the server down.
+func (r *Registry) background(ctx context.Context, point string, run func(context.Context)) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), Timeout)
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		defer cancel()
+		defer func() {
+			if rec := recover(); rec != nil {
+				log.Printf("Panic in %s hook: %v\n%s", point, rec, debug.Stack())
+			}
+		}()
+		run(ctx)
+	}()
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Transport traces the requests made through base as client spans and
+// passes the trace on in their traceparent header. Requests made outside a
+// trace go through untouched.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "HTTP "+req.Method, SpanKindClient,
+		String("http.request.method", req.Method),
+		String("server.address", req.URL.Hostname()),
+		String("url.full", redactURL(req)),
+	)
+	if span == nil {
+		return t.base.RoundTrip(req)
+	}
+	defer span.End()
+
+	// RoundTrippers must not change the request they're given
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetError(resp.Status)
+	}
+	return resp, nil
+}
+
+// redactURL drops credentials and the query, which may hold API keys
+func redactURL(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = ""
+	return u.String()
+}
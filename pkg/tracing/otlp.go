@@ -0,0 +1,324 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxQueuedSpans bounds the spans waiting for export; more are dropped
+	// while the collector is unreachable
+	maxQueuedSpans = 2048
+	// maxBatchSpans is how many spans are sent per request
+	maxBatchSpans = 512
+)
+
+// Config configures a Tracer
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces URL, e.g.
+	// http://localhost:4318/v1/traces
+	Endpoint string
+	// Headers are sent with every export, e.g. an API key
+	Headers map[string]string
+	// ServiceName names the service in the collector
+	ServiceName string
+	// SampleRatio is the share of traces kept, from 0 to 1
+	SampleRatio float64
+	// Interval is how often ended spans are exported
+	Interval time.Duration
+}
+
+// New creates a tracer exporting to cfg.Endpoint. Nothing is sent until
+// Run.
+func New(cfg Config) *Tracer {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "odin-wallet"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	return &Tracer{
+		sampleRatio: cfg.SampleRatio,
+		exporter: &exporter{
+			cfg:    cfg,
+			client: &http.Client{Timeout: 10 * time.Second},
+			flush:  make(chan struct{}, 1),
+		},
+	}
+}
+
+// FromEnv reads the standard OpenTelemetry variables:
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT with
+// /v1/traces appended; OTEL_EXPORTER_OTLP_HEADERS as key=value pairs;
+// OTEL_SERVICE_NAME; and OTEL_TRACES_SAMPLER_ARG as the sample ratio. It
+// returns nil, turning tracing off, when no endpoint is set or
+// OTEL_TRACES_EXPORTER is none.
+func FromEnv(getenv func(string) string) (*Tracer, error) {
+	if strings.EqualFold(getenv("OTEL_TRACES_EXPORTER"), "none") || strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: expected an http:// or https:// URL", endpoint)
+	}
+
+	cfg := Config{Endpoint: endpoint, ServiceName: getenv("OTEL_SERVICE_NAME"), SampleRatio: 1}
+	if v := getenv("OTEL_EXPORTER_OTLP_HEADERS"); v != "" {
+		cfg.Headers = make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(key) == "" {
+				return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: expected key=value pairs")
+			}
+			// Values may be percent-encoded
+			if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+				value = decoded
+			}
+			cfg.Headers[strings.TrimSpace(key)] = value
+		}
+	}
+	if v := getenv("OTEL_TRACES_SAMPLER_ARG"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("invalid OTEL_TRACES_SAMPLER_ARG %q: expected a ratio from 0 to 1", v)
+		}
+		cfg.SampleRatio = ratio
+	}
+	return New(cfg), nil
+}
+
+// Run exports ended spans every interval until ctx is cancelled
+func (t *Tracer) Run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	ticker := time.NewTicker(t.exporter.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.exporter.flush:
+		}
+		t.exporter.export(ctx)
+	}
+}
+
+// Shutdown exports the spans still queued
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.export(ctx)
+}
+
+type exporter struct {
+	cfg    Config
+	client *http.Client
+	flush  chan struct{}
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	// sending serializes exports, keeping spans in order
+	sending sync.Mutex
+}
+
+func (e *exporter) add(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueuedSpans {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= maxBatchSpans {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// export sends the queued spans in batches, dropping a batch the collector
+// refuses so a bad span doesn't block the rest
+func (e *exporter) export(ctx context.Context) error {
+	e.sending.Lock()
+	defer e.sending.Unlock()
+
+	e.mu.Lock()
+	queue := e.queue
+	e.queue = nil
+	if e.dropped > 0 {
+		log.Printf("Tracing: dropped %d spans while the collector was behind", e.dropped)
+		e.dropped = 0
+	}
+	e.mu.Unlock()
+
+	var firstErr error
+	for len(queue) > 0 {
+		n := min(len(queue), maxBatchSpans)
+		if err := e.send(ctx, queue[:n]); err != nil {
+			log.Printf("Tracing: failed to export %d spans: %v", n, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		queue = queue[n:]
+	}
+	return firstErr
+}
+
+func (e *exporter) send(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The OTLP/JSON encoding of ExportTraceServiceRequest. IDs are hex and
+// 64-bit integers are strings, as the protocol's JSON mapping requires.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	// Code is 0 unset, 1 ok or 2 error
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *exporter) encode(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.TraceID(),
+			SpanID:            s.SpanID(),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.failed {
+			span.Status = otlpStatus{Code: 2, Message: s.message}
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, span)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]Attribute{String("service.name", e.cfg.ServiceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/kengru/odin-wallet"}, Spans: encoded}},
+	}}}
+}
+
+func encodeAttributes(attrs []Attribute) []otlpAttribute {
+	encoded := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		var value otlpValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpAttribute{Key: attr.Key, Value: value})
+	}
+	return encoded
+}
@@ -0,0 +1,247 @@
+// Package tracing records OpenTelemetry spans and exports them over OTLP,
+// so requests can be followed through handlers, queries and outgoing calls
+// in Jaeger, Tempo or any other OTLP collector. It implements the parts of
+// the OpenTelemetry SDK the server needs: W3C trace context propagation,
+// ratio sampling and batched OTLP/HTTP export with JSON encoding.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind says what side of a call a span is on
+type SpanKind int
+
+// Values from the OTLP protocol
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Attribute is a key-value pair describing a span. Values are strings,
+// bools, ints, int64s or float64s.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key, value string) Attribute      { return Attribute{key, value} }
+func Int(key string, value int) Attribute     { return Attribute{key, int64(value)} }
+func Int64(key string, value int64) Attribute { return Attribute{key, value} }
+func Bool(key string, value bool) Attribute   { return Attribute{key, value} }
+
+// Tracer starts spans and exports the sampled ones when they end. A nil
+// Tracer starts nothing.
+type Tracer struct {
+	sampleRatio float64
+	exporter    *exporter
+}
+
+// Span is an operation being traced. Methods on a nil Span do nothing, so
+// callers don't check whether tracing is on.
+type Span struct {
+	tracer   *Tracer
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+
+	mu      sync.Mutex
+	name    string
+	kind    SpanKind
+	start   time.Time
+	end     time.Time
+	attrs   []Attribute
+	failed  bool
+	message string
+	ended   bool
+}
+
+type spanKey struct{}
+
+// remoteParent is a span from another service, read from traceparent
+type remoteParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+type remoteKey struct{}
+
+// SpanFromContext returns the span ctx is in, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns ctx inside span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start begins a span. It's a child of the span in ctx, or of a remote
+// parent read by Extract; otherwise it starts a trace, sampled at the
+// tracer's ratio.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now(), attrs: attrs}
+	rand.Read(span.spanID[:])
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.traceID, span.parentID, span.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		span.traceID, span.parentID, span.sampled = remote.traceID, remote.spanID, remote.sampled
+	} else {
+		rand.Read(span.traceID[:])
+		span.sampled = t.sample(span.traceID)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Start begins a child of the span in ctx with its tracer. Without one
+// nothing is traced, so background work is only traced when something
+// started a trace for it.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind, attrs...)
+}
+
+// sample keeps a trace when its ID falls under the ratio, so every service
+// using the same ratio makes the same choice
+func (t *Tracer) sample(traceID [16]byte) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>1) < t.sampleRatio*float64(uint64(1)<<63)
+}
+
+// SetName renames the span, as when the route is only known once the
+// request was routed
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with err. A nil err does nothing.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetError(err.Error())
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed = true
+	s.message = message
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Only the first call
+// counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sampled {
+		s.tracer.exporter.add(s)
+	}
+}
+
+// TraceID returns the span's trace ID in hex
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SpanID returns the span's ID in hex
+func (s *Span) SpanID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.spanID[:])
+}
+
+// Inject adds the traceparent header for the span in ctx, so the service
+// called continues the trace
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	flags := "00"
+	if span.sampled {
+		flags = "01"
+	}
+	header.Set("traceparent", "00-"+span.TraceID()+"-"+span.SpanID()+"-"+flags)
+}
+
+// Extract reads a traceparent header, so the next span started from the
+// returned context continues the caller's trace. Invalid headers are
+// ignored.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	parts := strings.Split(strings.TrimSpace(header.Get("traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var remote remoteParent
+	if _, err := hex.Decode(remote.traceID[:], []byte(parts[1])); err != nil || remote.traceID == [16]byte{} {
+		return ctx
+	}
+	if _, err := hex.Decode(remote.spanID[:], []byte(parts[2])); err != nil || remote.spanID == [8]byte{} {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return ctx
+	}
+	remote.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, remoteKey{}, remote)
+}